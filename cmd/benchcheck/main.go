@@ -0,0 +1,127 @@
+// Command benchcheck compares `go test -bench` output against a stored
+// baseline and fails when a benchmark got slower by more than a threshold.
+// With -count > 1 the fastest run of each benchmark is compared, which keeps
+// one noisy run from failing the check.
+//
+// Usage:
+//
+//	benchcheck -baseline testdata/bench_baseline.txt [-threshold 20] [bench.txt]
+//
+// Results are read from stdin when no file is given.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	baseline := flag.String("baseline", "", "benchmark output to compare against (required)")
+	threshold := flag.Float64("threshold", 20, "maximum allowed slowdown in percent")
+	flag.Parse()
+
+	if err := run(*baseline, *threshold, flag.Arg(0), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "benchcheck: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(baselinePath string, threshold float64, currentPath string, out io.Writer) error {
+	if baselinePath == "" {
+		return fmt.Errorf("-baseline is required")
+	}
+	base, err := parseFile(baselinePath)
+	if err != nil {
+		return err
+	}
+
+	var current map[string]float64
+	if currentPath == "" {
+		current, err = parse(os.Stdin)
+	} else {
+		current, err = parseFile(currentPath)
+	}
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return fmt.Errorf("no benchmark results in input")
+	}
+
+	regressions := compare(base, current, threshold, out)
+	if len(regressions) > 0 {
+		return fmt.Errorf("%d benchmark(s) regressed more than %.0f%%: %s",
+			len(regressions), threshold, strings.Join(regressions, ", "))
+	}
+	return nil
+}
+
+// compare prints one line per benchmark and returns the names that are more
+// than threshold percent slower than base. Benchmarks missing from base are
+// reported but never fail.
+func compare(base, current map[string]float64, threshold float64, out io.Writer) []string {
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var regressions []string
+	for _, name := range names {
+		cur := current[name]
+		old, ok := base[name]
+		if !ok {
+			fmt.Fprintf(out, "%-40s %12.1f ns/op  (no baseline)\n", name, cur)
+			continue
+		}
+
+		delta := (cur - old) / old * 100
+		status := "ok"
+		if delta > threshold {
+			status = "REGRESSION"
+			regressions = append(regressions, name)
+		}
+		fmt.Fprintf(out, "%-40s %12.1f ns/op  baseline %12.1f  %+6.1f%%  %s\n", name, cur, old, delta, status)
+	}
+	return regressions
+}
+
+func parseFile(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+// benchLine matches "BenchmarkName-8   1000   123.4 ns/op ...". The -N
+// GOMAXPROCS suffix is dropped so results from different machines compare.
+var benchLine = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+\d+\s+([\d.]+) ns/op`)
+
+// parse returns the fastest ns/op of every benchmark in r.
+func parse(r io.Reader) (map[string]float64, error) {
+	results := make(map[string]float64)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		m := benchLine.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		ns, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", sc.Text(), err)
+		}
+		if old, ok := results[m[1]]; !ok || ns < old {
+			results[m[1]] = ns
+		}
+	}
+	return results, sc.Err()
+}
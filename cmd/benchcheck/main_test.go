@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+const sampleOutput = `goos: linux
+goarch: amd64
+pkg: github.com/hpn/hpn-g-router/internal/domain
+BenchmarkGetNextKey_10Keys-4     	 8303908	       127.3 ns/op
+BenchmarkGetNextKey_10Keys-4     	 8303908	       120.0 ns/op
+BenchmarkMarkAsDead              	  323365	      5918 ns/op	     12 B/op
+PASS
+`
+
+func TestParse(t *testing.T) {
+	got, err := parse(strings.NewReader(sampleOutput))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	want := map[string]float64{
+		"BenchmarkGetNextKey_10Keys": 120.0, // fastest of the runs, suffix dropped
+		"BenchmarkMarkAsDead":        5918,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parse() = %v, want %v", got, want)
+	}
+	for name, ns := range want {
+		if got[name] != ns {
+			t.Errorf("%s = %v, want %v", name, got[name], ns)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := map[string]float64{"BenchmarkA": 100, "BenchmarkB": 100, "BenchmarkC": 100}
+
+	tests := []struct {
+		name    string
+		current map[string]float64
+		want    []string
+	}{
+		{"within threshold", map[string]float64{"BenchmarkA": 119}, nil},
+		{"faster", map[string]float64{"BenchmarkA": 50}, nil},
+		{"regressed", map[string]float64{"BenchmarkA": 121, "BenchmarkB": 100}, []string{"BenchmarkA"}},
+		{"new benchmark", map[string]float64{"BenchmarkNew": 1000}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compare(base, tt.current, 20, io.Discard)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("compare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Command benchmark load-tests a running router: it sends chat completion
+// requests from a number of concurrent workers for a fixed duration and
+// prints latency percentiles, throughput and the error rate.
+//
+// Usage:
+//
+//	benchmark [-url http://localhost:8080] [-concurrency 10] [-duration 30s]
+//	          [-model gpt-3.5-turbo] [-prompt "Say hello"] [-output report.json]
+//
+// Only requests answered with 200 count as successes; latency percentiles
+// are computed over successes so fast failures don't flatter the figures.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Latencies are recorded in microseconds between 1µs and 5 minutes with three
+// significant digits.
+const (
+	minLatencyMicros = 1
+	maxLatencyMicros = int64(5 * time.Minute / time.Microsecond)
+	sigFigs          = 3
+)
+
+type config struct {
+	url         string
+	concurrency int
+	duration    time.Duration
+	timeout     time.Duration
+	model       string
+	prompt      string
+	output      string
+}
+
+// Report is the benchmark summary, also written as JSON with -output.
+type Report struct {
+	URL         string        `json:"url"`
+	Model       string        `json:"model"`
+	Concurrency int           `json:"concurrency"`
+	Duration    float64       `json:"duration_seconds"`
+	Requests    int64         `json:"requests"`
+	Successes   int64         `json:"successes"`
+	Errors      int64         `json:"errors"`
+	ErrorRate   float64       `json:"error_rate"`
+	RPS         float64       `json:"requests_per_second"`
+	Latency     LatencyReport `json:"latency_ms"`
+
+	// StatusCodes counts responses by HTTP status; transport failures are
+	// counted under 0.
+	StatusCodes map[int]int64 `json:"status_codes"`
+}
+
+// LatencyReport holds latency percentiles of successful requests in milliseconds.
+type LatencyReport struct {
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Mean float64 `json:"mean"`
+	Max  float64 `json:"max"`
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.url, "url", "http://localhost:8080", "router base URL")
+	flag.IntVar(&cfg.concurrency, "concurrency", 10, "concurrent workers")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "how long to send requests")
+	flag.DurationVar(&cfg.timeout, "timeout", 60*time.Second, "timeout per request")
+	flag.StringVar(&cfg.model, "model", "gpt-3.5-turbo", "model to request")
+	flag.StringVar(&cfg.prompt, "prompt", "Say hello in one word.", "user message to send")
+	flag.StringVar(&cfg.output, "output", "", "also write the report as JSON to this file")
+	flag.Parse()
+
+	if err := run(cfg, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "benchmark: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg config, out io.Writer) error {
+	if cfg.concurrency < 1 {
+		return fmt.Errorf("-concurrency must be at least 1")
+	}
+	if cfg.duration <= 0 {
+		return fmt.Errorf("-duration must be positive")
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"model":    cfg.model,
+		"messages": []map[string]string{{"role": "user", "content": cfg.prompt}},
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout:   cfg.timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: cfg.concurrency},
+	}
+	endpoint := strings.TrimSuffix(cfg.url, "/") + "/v1/chat/completions"
+
+	report := benchmark(context.Background(), client, endpoint, body, cfg)
+	printReport(out, report)
+
+	if cfg.output != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(cfg.output, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workerStats is what one worker collected; workers never share state.
+type workerStats struct {
+	hist        *hdrhistogram.Histogram
+	errors      int64
+	statusCodes map[int]int64
+}
+
+func newWorkerStats() *workerStats {
+	return &workerStats{
+		hist:        hdrhistogram.New(minLatencyMicros, maxLatencyMicros, sigFigs),
+		statusCodes: make(map[int]int64),
+	}
+}
+
+// benchmark sends requests from cfg.concurrency workers until cfg.duration
+// has passed. Requests cut off by the deadline are not counted.
+func benchmark(ctx context.Context, client *http.Client, endpoint string, body []byte, cfg config) Report {
+	ctx, cancel := context.WithTimeout(ctx, cfg.duration)
+	defer cancel()
+
+	stats := make([]*workerStats, cfg.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range stats {
+		stats[i] = newWorkerStats()
+		wg.Add(1)
+		go func(s *workerStats) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				s.send(ctx, client, endpoint, body)
+			}
+		}(stats[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	total := newWorkerStats()
+	for _, s := range stats {
+		total.hist.Merge(s.hist)
+		total.errors += s.errors
+		for code, n := range s.statusCodes {
+			total.statusCodes[code] += n
+		}
+	}
+
+	report := summarize(total.hist, total.errors, elapsed)
+	report.URL = endpoint
+	report.Model = cfg.model
+	report.Concurrency = cfg.concurrency
+	report.StatusCodes = total.statusCodes
+	return report
+}
+
+func (s *workerStats) send(ctx context.Context, client *http.Client, endpoint string, body []byte) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		s.errors++
+		s.statusCodes[0]++
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	latency := time.Since(start)
+
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		s.errors++
+		s.statusCodes[0]++
+		return
+	}
+
+	s.statusCodes[resp.StatusCode]++
+	if resp.StatusCode != http.StatusOK {
+		s.errors++
+		return
+	}
+	_ = s.hist.RecordValue(latency.Microseconds())
+}
+
+// summarize turns the latencies of successful requests and the error count
+// into a report.
+func summarize(hist *hdrhistogram.Histogram, errors int64, elapsed time.Duration) Report {
+	successes := hist.TotalCount()
+	r := Report{
+		Duration:  elapsed.Seconds(),
+		Requests:  successes + errors,
+		Successes: successes,
+		Errors:    errors,
+	}
+	if r.Requests > 0 {
+		r.ErrorRate = float64(errors) / float64(r.Requests)
+	}
+	if elapsed > 0 {
+		r.RPS = float64(r.Requests) / elapsed.Seconds()
+	}
+	if successes > 0 {
+		r.Latency = LatencyReport{
+			P50:  microsToMillis(float64(hist.ValueAtQuantile(50))),
+			P95:  microsToMillis(float64(hist.ValueAtQuantile(95))),
+			P99:  microsToMillis(float64(hist.ValueAtQuantile(99))),
+			Mean: microsToMillis(hist.Mean()),
+			Max:  microsToMillis(float64(hist.Max())),
+		}
+	}
+	return r
+}
+
+func microsToMillis(us float64) float64 {
+	return us / 1000
+}
+
+func printReport(out io.Writer, r Report) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Target\t%s\n", r.URL)
+	fmt.Fprintf(tw, "Model\t%s\n", r.Model)
+	fmt.Fprintf(tw, "Concurrency\t%d\n", r.Concurrency)
+	fmt.Fprintf(tw, "Duration\t%.1fs\n", r.Duration)
+	fmt.Fprintf(tw, "Requests\t%d\n", r.Requests)
+	fmt.Fprintf(tw, "Successes\t%d\n", r.Successes)
+	fmt.Fprintf(tw, "Errors\t%d (%.2f%%)\n", r.Errors, r.ErrorRate*100)
+	fmt.Fprintf(tw, "RPS\t%.2f\n", r.RPS)
+	fmt.Fprintf(tw, "Latency P50\t%.2f ms\n", r.Latency.P50)
+	fmt.Fprintf(tw, "Latency P95\t%.2f ms\n", r.Latency.P95)
+	fmt.Fprintf(tw, "Latency P99\t%.2f ms\n", r.Latency.P99)
+	fmt.Fprintf(tw, "Latency mean\t%.2f ms\n", r.Latency.Mean)
+	fmt.Fprintf(tw, "Latency max\t%.2f ms\n", r.Latency.Max)
+
+	codes := make([]int, 0, len(r.StatusCodes))
+	for code := range r.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "transport error"
+		}
+		fmt.Fprintf(tw, "Status %s\t%d\n", label, r.StatusCodes[code])
+	}
+	tw.Flush()
+}
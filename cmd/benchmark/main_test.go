@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+func TestSummarize_Percentiles(t *testing.T) {
+	hist := hdrhistogram.New(minLatencyMicros, maxLatencyMicros, sigFigs)
+	for ms := int64(1); ms <= 100; ms++ {
+		if err := hist.RecordValue(ms * 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := summarize(hist, 25, 5*time.Second)
+
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"p50", r.Latency.P50, 50},
+		{"p95", r.Latency.P95, 95},
+		{"p99", r.Latency.P99, 99},
+		{"max", r.Latency.Max, 100},
+		{"mean", r.Latency.Mean, 50.5},
+		{"rps", r.RPS, 25},
+		{"error rate", r.ErrorRate, 0.2},
+	}
+	for _, tt := range tests {
+		// Three significant digits leave at most 0.1% error.
+		if math.Abs(tt.got-tt.want) > tt.want*0.001 {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if r.Requests != 125 || r.Successes != 100 || r.Errors != 25 {
+		t.Errorf("requests/successes/errors = %d/%d/%d, want 125/100/25", r.Requests, r.Successes, r.Errors)
+	}
+}
+
+func TestSummarize_NoRequests(t *testing.T) {
+	r := summarize(hdrhistogram.New(minLatencyMicros, maxLatencyMicros, sigFigs), 0, time.Second)
+	if r.Requests != 0 || r.ErrorRate != 0 || r.Latency != (LatencyReport{}) {
+		t.Errorf("summarize() = %+v, want an empty report", r)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %s, want /v1/chat/completions", r.URL.Path)
+		}
+		var body struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Model != "gpt-4" || body.Messages[0].Content != "ping" {
+			t.Errorf("body = %+v (%v), want model gpt-4 and prompt ping", body, err)
+		}
+		if calls.Add(1)%4 == 0 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"object":"chat.completion"}`))
+	}))
+	defer server.Close()
+
+	output := filepath.Join(t.TempDir(), "report.json")
+	var out bytes.Buffer
+	err := run(config{
+		url:         server.URL + "/",
+		concurrency: 4,
+		duration:    200 * time.Millisecond,
+		timeout:     time.Second,
+		model:       "gpt-4",
+		prompt:      "ping",
+		output:      output,
+	}, &out)
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	for _, want := range []string{"Latency P99", "RPS", "Status 200", "Status 429"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary missing %q:\n%s", want, out.String())
+		}
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	if r.Successes == 0 || r.Errors == 0 || r.Requests != r.Successes+r.Errors {
+		t.Errorf("report = %+v, want both successes and 429 errors", r)
+	}
+	if r.StatusCodes[http.StatusTooManyRequests] != r.Errors {
+		t.Errorf("status_codes = %v, want every error to be a 429", r.StatusCodes)
+	}
+}
+
+func TestRun_InvalidFlags(t *testing.T) {
+	for _, cfg := range []config{
+		{concurrency: 0, duration: time.Second},
+		{concurrency: 1, duration: 0},
+	} {
+		if err := run(cfg, &bytes.Buffer{}); err == nil {
+			t.Errorf("run(%+v) error = nil, want a flag error", cfg)
+		}
+	}
+}
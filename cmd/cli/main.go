@@ -0,0 +1,333 @@
+// Command cli manages a running router through its admin API, so operators
+// don't have to hand-craft curl requests.
+//
+// Usage:
+//
+//	hpn-router-cli [--router-url URL] [--admin-token TOKEN] [--json] <command>
+//
+//	hpn-router-cli keys list
+//	hpn-router-cli keys add --key=AIzaSy... --provider=google --name=backup
+//	hpn-router-cli keys remove --name=backup
+//	hpn-router-cli keys revive --name=primary
+//	hpn-router-cli health
+//	hpn-router-cli stats
+//
+// The router URL and admin token default to HPN_ROUTER_URL and
+// HPN_ADMIN_TOKEN (or HPN_ROUTER_ADMIN_TOKEN, as read by the server).
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/handler"
+)
+
+const defaultRouterURL = "http://localhost:8080"
+
+func main() {
+	if err := newRootCmd(os.Getenv).Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// options are the global flags shared by every command.
+type options struct {
+	routerURL  string
+	adminToken string
+	json       bool
+	timeout    time.Duration
+}
+
+// newRootCmd builds the command tree. getenv supplies flag defaults so tests
+// don't depend on the environment.
+func newRootCmd(getenv func(string) string) *cobra.Command {
+	opts := &options{}
+
+	root := &cobra.Command{
+		Use:          "hpn-router-cli",
+		Short:        "Manage a running hpn-g-router through its admin API",
+		SilenceUsage: true,
+	}
+
+	routerURL := getenv("HPN_ROUTER_URL")
+	if routerURL == "" {
+		routerURL = defaultRouterURL
+	}
+	adminToken := getenv("HPN_ADMIN_TOKEN")
+	if adminToken == "" {
+		adminToken = getenv("HPN_ROUTER_ADMIN_TOKEN")
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&opts.routerURL, "router-url", routerURL, "router base URL (env HPN_ROUTER_URL)")
+	flags.StringVar(&opts.adminToken, "admin-token", adminToken, "admin API token (env HPN_ADMIN_TOKEN)")
+	flags.BoolVar(&opts.json, "json", false, "print the raw JSON response")
+	flags.DurationVar(&opts.timeout, "timeout", 10*time.Second, "request timeout")
+
+	keys := &cobra.Command{Use: "keys", Short: "List and manage keys in the pool"}
+	keys.AddCommand(
+		newKeysListCmd(opts),
+		newKeysAddCmd(opts),
+		newKeysRemoveCmd(opts),
+		newKeysReviveCmd(opts),
+	)
+	root.AddCommand(keys, newHealthCmd(opts), newStatsCmd(opts))
+	return root
+}
+
+func newKeysListCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List keys with their rotation status",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var resp handler.KeyListResponse
+			raw, err := opts.client().do(cmd.Context(), http.MethodGet, "/admin/keys", nil, &resp)
+			if err != nil {
+				return err
+			}
+			return opts.print(cmd.OutOrStdout(), raw, func(tw *tabwriter.Writer) {
+				fmt.Fprintln(tw, "NAME\tKEY\tSTATUS\tDEAD SINCE")
+				for _, k := range resp.Data {
+					since := "-"
+					if k.DeadSince != nil {
+						since = k.DeadSince.Local().Format(time.RFC3339)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", orDash(k.Name), k.Key, k.Status, since)
+				}
+			})
+		},
+	}
+}
+
+func newKeysAddCmd(opts *options) *cobra.Command {
+	var req handler.AddKeyRequest
+	cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add a key to rotation until the router restarts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var resp handler.KeyStatus
+			raw, err := opts.client().do(cmd.Context(), http.MethodPost, "/admin/keys", req, &resp)
+			if err != nil {
+				return err
+			}
+			return opts.print(cmd.OutOrStdout(), raw, func(tw *tabwriter.Writer) {
+				fmt.Fprintf(tw, "added %s (%s)\n", resp.Name, resp.Key)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&req.Key, "key", "", "API key to add")
+	cmd.Flags().StringVar(&req.Provider, "provider", "google", "provider the key belongs to")
+	cmd.Flags().StringVar(&req.Name, "name", "", "unique name for the key")
+	_ = cmd.MarkFlagRequired("key")
+	_ = cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+func newKeysRemoveCmd(opts *options) *cobra.Command {
+	return newKeyActionCmd(opts, "remove", "Remove a key from the pool until the router restarts", http.MethodDelete, "")
+}
+
+func newKeysReviveCmd(opts *options) *cobra.Command {
+	return newKeyActionCmd(opts, "revive", "Return a dead key to rotation now", http.MethodPost, "/revive")
+}
+
+// newKeyActionCmd builds a command acting on the key given by --name.
+func newKeyActionCmd(opts *options, use, short, method, suffix string) *cobra.Command {
+	var name string
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var resp handler.KeyActionResponse
+			path := "/admin/keys/" + url.PathEscape(name) + suffix
+			raw, err := opts.client().do(cmd.Context(), method, path, nil, &resp)
+			if err != nil {
+				return err
+			}
+			return opts.print(cmd.OutOrStdout(), raw, func(tw *tabwriter.Writer) {
+				fmt.Fprintf(tw, "%s: %s (%d active, %d dead)\n", name, resp.Status, resp.ActiveCount, resp.DeadCount)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "configured name of the key")
+	_ = cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+func newHealthCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "health",
+		Short: "Report whether the router can serve requests",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var resp handler.ReadinessResponse
+			raw, err := opts.client().do(cmd.Context(), http.MethodGet, "/healthz/ready", nil, &resp)
+
+			// A router with no active keys answers 503 with a readiness body;
+			// print it and still fail so scripts can rely on the exit code.
+			var apiErr *apiError
+			notReady := errors.As(err, &apiErr) && apiErr.status == http.StatusServiceUnavailable && resp.Status != ""
+			if err != nil && !notReady {
+				return err
+			}
+			if err := opts.print(cmd.OutOrStdout(), raw, func(tw *tabwriter.Writer) {
+				fmt.Fprintf(tw, "%s (%d active keys)\n", resp.Status, resp.ActiveKeys)
+			}); err != nil {
+				return err
+			}
+			if notReady {
+				return errNotReady
+			}
+			return nil
+		},
+	}
+}
+
+var errNotReady = errors.New("router is not ready")
+
+func newStatsCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats",
+		Short: "Show request totals and per-key usage",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var resp handler.UsageResponse
+			raw, err := opts.client().do(cmd.Context(), http.MethodGet, "/admin/usage", nil, &resp)
+			if err != nil {
+				return err
+			}
+			return opts.print(cmd.OutOrStdout(), raw, func(tw *tabwriter.Writer) {
+				fmt.Fprintf(tw, "Requests\t%d\n", resp.Requests)
+				fmt.Fprintf(tw, "Input tokens\t%d\n", resp.InputTokens)
+				fmt.Fprintf(tw, "Output tokens\t%d\n", resp.OutputTokens)
+				fmt.Fprintf(tw, "Cost (USD)\t%.4f\n", resp.CostUSD)
+				fmt.Fprintf(tw, "Slow requests\t%d\n", resp.SlowRequests)
+				fmt.Fprintln(tw)
+				fmt.Fprintln(tw, "NAME\tKEY\tUSAGE\tIN FLIGHT")
+				for _, k := range resp.Keys {
+					fmt.Fprintf(tw, "%s\t%s\t%.3f\t%d\n", orDash(k.Name), k.Key, k.Usage, k.InFlight)
+				}
+			})
+		},
+	}
+}
+
+// print writes raw indented with --json, or the table rendered by table.
+func (o *options) print(out io.Writer, raw []byte, table func(*tabwriter.Writer)) error {
+	if o.json {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		_, err := buf.WriteTo(out)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func (o *options) client() *client {
+	return &client{
+		baseURL: strings.TrimSuffix(o.routerURL, "/"),
+		token:   o.adminToken,
+		http:    &http.Client{Timeout: o.timeout},
+	}
+}
+
+// client calls the router's HTTP API.
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// apiError is a non-2xx response from the router.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("router returned %d: %s", e.status, e.message)
+	}
+	return fmt.Sprintf("router returned %d", e.status)
+}
+
+// do sends a request with an optional JSON body and decodes the response into
+// out. It returns the raw response body for --json output. Non-2xx responses
+// return an *apiError; their body is still decoded into out when possible.
+func (c *client) do(ctx context.Context, method, path string, body, out any) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set(handler.AdminTokenHeader, c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{status: resp.StatusCode}
+		var oe adapter.OpenAIError
+		if json.Unmarshal(raw, &oe) == nil {
+			apiErr.message = oe.Error.Message
+		}
+		_ = json.Unmarshal(raw, out)
+		return raw, apiErr
+	}
+
+	if err := json.Unmarshal(raw, out); err != nil {
+		return raw, fmt.Errorf("decode response: %w", err)
+	}
+	return raw, nil
+}
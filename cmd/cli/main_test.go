@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testToken = "s3cret-admin-token"
+
+// mockRouter answers each "METHOD path" in routes with the given status and
+// body, and records the last request body it received.
+type mockRouter struct {
+	routes   map[string]mockResponse
+	lastBody string
+}
+
+type mockResponse struct {
+	status int
+	body   string
+}
+
+func newMockRouter(t *testing.T, routes map[string]mockResponse) (*httptest.Server, *mockRouter) {
+	t.Helper()
+
+	m := &mockRouter{routes: routes}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Admin-Token") != testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"invalid admin token","type":"authentication_error"}}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		m.lastBody = string(body)
+
+		resp, ok := m.routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"no route","type":"not_found_error"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(server.Close)
+	return server, m
+}
+
+// runCLI executes the CLI against url with the given arguments.
+func runCLI(url string, args ...string) (string, error) {
+	env := map[string]string{"HPN_ROUTER_URL": url, "HPN_ADMIN_TOKEN": testToken}
+	cmd := newRootCmd(func(k string) string { return env[k] })
+
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestKeysList(t *testing.T) {
+	server, _ := newMockRouter(t, map[string]mockResponse{
+		"GET /admin/keys": {http.StatusOK, `{"object":"list","data":[
+			{"key":"AIza...0001","name":"primary","status":"active"},
+			{"key":"AIza...0002","name":"backup","status":"dead","dead_since":"2026-01-02T03:04:05Z"}]}`},
+	})
+
+	out, err := runCLI(server.URL, "keys", "list")
+	if err != nil {
+		t.Fatalf("keys list error = %v", err)
+	}
+	for _, want := range []string{"NAME", "primary", "AIza...0001", "active", "backup", "dead"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestKeysAdd(t *testing.T) {
+	server, m := newMockRouter(t, map[string]mockResponse{
+		"POST /admin/keys": {http.StatusCreated, `{"key":"AIza...0003","name":"extra","status":"active"}`},
+	})
+
+	out, err := runCLI(server.URL, "keys", "add", "--key=AIzaSyExtraKey00000003", "--provider=google", "--name=extra")
+	if err != nil {
+		t.Fatalf("keys add error = %v", err)
+	}
+	if !strings.Contains(out, "added extra (AIza...0003)") {
+		t.Errorf("output = %q", out)
+	}
+
+	var sent map[string]string
+	if err := json.Unmarshal([]byte(m.lastBody), &sent); err != nil {
+		t.Fatalf("request body is not JSON: %v", err)
+	}
+	want := map[string]string{"key": "AIzaSyExtraKey00000003", "provider": "google", "name": "extra"}
+	for k, v := range want {
+		if sent[k] != v {
+			t.Errorf("request %s = %q, want %q", k, sent[k], v)
+		}
+	}
+
+	if _, err := runCLI(server.URL, "keys", "add", "--name=extra"); err == nil {
+		t.Error("keys add without --key succeeded")
+	}
+}
+
+func TestKeysRemoveAndRevive(t *testing.T) {
+	server, _ := newMockRouter(t, map[string]mockResponse{
+		"DELETE /admin/keys/backup":      {http.StatusOK, `{"status":"removed","active_count":1,"dead_count":0}`},
+		"POST /admin/keys/backup/revive": {http.StatusOK, `{"status":"active","active_count":2,"dead_count":0}`},
+	})
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"keys", "remove", "--name=backup"}, "backup: removed (1 active, 0 dead)"},
+		{[]string{"keys", "revive", "--name=backup"}, "backup: active (2 active, 0 dead)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args[1], func(t *testing.T) {
+			out, err := runCLI(server.URL, tt.args...)
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("output = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeysRevive_UnknownName(t *testing.T) {
+	server, _ := newMockRouter(t, map[string]mockResponse{})
+
+	_, err := runCLI(server.URL, "keys", "revive", "--name=missing")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("error = %v, want the router's 404", err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{"ready", http.StatusOK, `{"status":"ready","active_keys":3}`, "ready (3 active keys)", false},
+		{"not ready", http.StatusServiceUnavailable, `{"status":"not_ready","active_keys":0}`, "not_ready (0 active keys)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newMockRouter(t, map[string]mockResponse{
+				"GET /healthz/ready": {tt.status, tt.body},
+			})
+
+			out, err := runCLI(server.URL, "health")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("output = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	server, _ := newMockRouter(t, map[string]mockResponse{
+		"GET /admin/usage": {http.StatusOK, `{"requests":42,"input_tokens":1000,"output_tokens":500,"cost_usd":0.0012,
+			"keys":[{"key":"AIza...0001","name":"primary","usage":0.75,"in_flight":2}]}`},
+	})
+
+	out, err := runCLI(server.URL, "stats")
+	if err != nil {
+		t.Fatalf("stats error = %v", err)
+	}
+	for _, want := range []string{"Requests", "42", "1000", "primary", "0.750"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	server, _ := newMockRouter(t, map[string]mockResponse{
+		"GET /admin/usage": {http.StatusOK, `{"requests":42,"keys":[]}`},
+	})
+
+	out, err := runCLI(server.URL, "stats", "--json")
+	if err != nil {
+		t.Fatalf("stats --json error = %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if got["requests"] != float64(42) {
+		t.Errorf("requests = %v, want 42", got["requests"])
+	}
+}
+
+func TestAdminTokenFlag(t *testing.T) {
+	server, _ := newMockRouter(t, map[string]mockResponse{
+		"GET /admin/usage": {http.StatusOK, `{"requests":0,"keys":[]}`},
+	})
+
+	_, err := runCLI(server.URL, "stats", "--admin-token=wrong")
+	if err == nil || !strings.Contains(err.Error(), "invalid admin token") {
+		t.Errorf("error = %v, want the router's 401 message", err)
+	}
+}
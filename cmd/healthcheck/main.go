@@ -0,0 +1,83 @@
+// Command healthcheck asks a running router whether it is ready to serve,
+// for container health checks such as the HEALTHCHECK of the Dockerfile.
+// It calls GET /healthz/ready and exits 0 when the router answers 200, 1
+// when it answers 503 or any other status, and 2 when it cannot be reached.
+//
+// Usage:
+//
+//	healthcheck [--min-active-keys N]
+//
+// The router URL defaults to HPN_ROUTER_URL, or http://localhost:8080. With
+// --min-active-keys the router is also unhealthy while fewer than N keys are
+// in rotation.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultRouterURL = "http://localhost:8080"
+
+// timeout bounds the whole readiness request.
+const timeout = 5 * time.Second
+
+// Exit codes.
+const (
+	exitHealthy     = 0
+	exitUnhealthy   = 1
+	exitUnreachable = 2
+)
+
+func main() {
+	minActiveKeys := flag.Int("min-active-keys", 0, "also require at least this many keys in rotation")
+	flag.Parse()
+
+	routerURL := os.Getenv("HPN_ROUTER_URL")
+	if routerURL == "" {
+		routerURL = defaultRouterURL
+	}
+	os.Exit(check(&http.Client{Timeout: timeout}, routerURL, *minActiveKeys, os.Stderr))
+}
+
+// readiness is the body of GET /healthz/ready.
+type readiness struct {
+	Status     string `json:"status"`
+	ActiveKeys int    `json:"active_keys"`
+}
+
+// check calls the readiness endpoint of the router at routerURL and returns
+// the exit code, explaining failures on out.
+func check(client *http.Client, routerURL string, minActiveKeys int, out io.Writer) int {
+	resp, err := client.Get(strings.TrimSuffix(routerURL, "/") + "/healthz/ready")
+	if err != nil {
+		fmt.Fprintf(out, "healthcheck: %v\n", err)
+		return exitUnreachable
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(out, "healthcheck: router not ready: %s\n", resp.Status)
+		return exitUnhealthy
+	}
+	if minActiveKeys <= 0 {
+		return exitHealthy
+	}
+
+	var r readiness
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		fmt.Fprintf(out, "healthcheck: invalid readiness response: %v\n", err)
+		return exitUnhealthy
+	}
+	if r.ActiveKeys < minActiveKeys {
+		fmt.Fprintf(out, "healthcheck: %d active keys, want at least %d\n", r.ActiveKeys, minActiveKeys)
+		return exitUnhealthy
+	}
+	return exitHealthy
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		minActiveKeys int
+		want          int
+	}{
+		{"ready", http.StatusOK, `{"status":"ready","active_keys":3}`, 0, exitHealthy},
+		{"not ready", http.StatusServiceUnavailable, `{"status":"not_ready","active_keys":0}`, 0, exitUnhealthy},
+		{"other status", http.StatusInternalServerError, ``, 0, exitUnhealthy},
+		{"enough keys", http.StatusOK, `{"status":"ready","active_keys":3}`, 3, exitHealthy},
+		{"too few keys", http.StatusOK, `{"status":"ready","active_keys":2}`, 3, exitUnhealthy},
+		{"invalid body", http.StatusOK, `not json`, 1, exitUnhealthy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/healthz/ready" {
+					t.Errorf("path = %s, want /healthz/ready", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			if got := check(server.Client(), server.URL+"/", tt.minActiveKeys, io.Discard); got != tt.want {
+				t.Errorf("check() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	client := &http.Client{Timeout: time.Second}
+	if got := check(client, url, 0, io.Discard); got != exitUnreachable {
+		t.Errorf("check() = %d, want %d", got, exitUnreachable)
+	}
+}
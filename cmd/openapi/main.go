@@ -0,0 +1,117 @@
+// Command openapi renders the router's OpenAPI document exactly as the server
+// serves it, and optionally validates the output against a JSON Schema such as
+// the official OpenAPI 3.0 schema.
+//
+// Usage:
+//
+//	openapi [-format json|yaml] [-o file] [-schema oas-3.0.schema.json]
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+
+	"github.com/hpn/hpn-g-router/internal/handler"
+	"github.com/hpn/hpn-g-router/internal/spec"
+)
+
+func main() {
+	format := flag.String("format", "json", "output format: json or yaml")
+	out := flag.String("o", "", "output file (default stdout)")
+	schemaPath := flag.String("schema", "", "JSON Schema file to validate the rendered document against")
+	flag.Parse()
+
+	if err := run(*format, *out, *schemaPath); err != nil {
+		fmt.Fprintf(os.Stderr, "openapi: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(format, out, schemaPath string) error {
+	doc, err := spec.Build(spec.APIVersion)
+	if err != nil {
+		return fmt.Errorf("build spec: %w", err)
+	}
+	h, err := handler.NewSpecHandler(doc)
+	if err != nil {
+		return fmt.Errorf("render spec: %w", err)
+	}
+
+	var rendered []byte
+	switch format {
+	case "json":
+		rendered = h.JSON()
+	case "yaml":
+		rendered = h.YAML()
+	default:
+		return fmt.Errorf("unknown format %q, want json or yaml", format)
+	}
+
+	if schemaPath != "" {
+		if err := validate(rendered, format, schemaPath); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "openapi: %s document is valid against %s\n", format, schemaPath)
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(rendered)
+		return err
+	}
+	return os.WriteFile(out, rendered, 0o644)
+}
+
+// validate decodes the rendered bytes and checks them against the schema file.
+func validate(rendered []byte, format, schemaPath string) error {
+	schema, err := jsonschema.Compile(schemaPath)
+	if err != nil {
+		return fmt.Errorf("compile schema %s: %w", schemaPath, err)
+	}
+
+	var value interface{}
+	switch format {
+	case "json":
+		value, err = decodeJSON(rendered)
+	case "yaml":
+		value, err = yamlToJSONValue(rendered)
+	}
+	if err != nil {
+		return fmt.Errorf("decode rendered %s: %w", format, err)
+	}
+
+	if err := schema.Validate(value); err != nil {
+		return fmt.Errorf("rendered %s document is invalid: %#v", format, err)
+	}
+	return nil
+}
+
+// yamlToJSONValue decodes YAML into the JSON value model the validator expects.
+func yamlToJSONValue(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(raw)
+}
+
+// decodeJSON decodes with UseNumber so integers are not turned into floats.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,186 @@
+// Command replay sends the requests of a recording made by
+// recorder.RecordingMiddleware to a target router, in order, and reports every
+// response whose status code or body differs from the recorded one.
+//
+// Usage:
+//
+//	replay -target http://localhost:8080 [-ignore-fields id,created] [-timeout 60s] recording.ndjson
+//
+// Bodies are compared as JSON with the ignored fields removed at any depth;
+// server-sent event streams are compared one data line at a time.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/recorder"
+)
+
+func main() {
+	target := flag.String("target", "", "base URL to replay requests against (required)")
+	ignore := flag.String("ignore-fields", "id,created", "comma-separated JSON fields left out of body comparisons")
+	timeout := flag.Duration("timeout", 60*time.Second, "timeout per request")
+	flag.Parse()
+
+	client := &http.Client{Timeout: *timeout}
+	if err := run(flag.Arg(0), *target, splitFields(*ignore), client, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(path, target string, ignore map[string]bool, client *http.Client, out io.Writer) error {
+	if path == "" {
+		return fmt.Errorf("a recording file is required")
+	}
+	if target == "" {
+		return fmt.Errorf("-target is required")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := recorder.ReadEntries(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	mismatches, err := replay(entries, strings.TrimSuffix(target, "/"), ignore, client, out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d requests replayed, %d mismatches\n", len(entries), mismatches)
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d responses differ from the recording", mismatches, len(entries))
+	}
+	return nil
+}
+
+// replay sends every entry to target and prints one line per mismatch.
+func replay(entries []recorder.Entry, target string, ignore map[string]bool, client *http.Client, out io.Writer) (int, error) {
+	mismatches := 0
+	for i, e := range entries {
+		status, body, err := send(client, target, e)
+		if err != nil {
+			return mismatches, fmt.Errorf("request %d (%s %s): %w", i+1, e.Method, e.Path, err)
+		}
+
+		switch {
+		case status != e.Status:
+			mismatches++
+			fmt.Fprintf(out, "#%d %s %s: status %d, recorded %d\n", i+1, e.Method, e.Path, status, e.Status)
+		case !sameBody(body, e.ResponseBody, ignore):
+			mismatches++
+			fmt.Fprintf(out, "#%d %s %s: body differs from the recording\n", i+1, e.Method, e.Path)
+		}
+	}
+	return mismatches, nil
+}
+
+func send(client *http.Client, target string, e recorder.Entry) (int, string, error) {
+	req, err := http.NewRequest(e.Method, target+e.Path, strings.NewReader(e.RequestBody))
+	if err != nil {
+		return 0, "", err
+	}
+	for k, vs := range e.RequestHeader {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// sameBody compares two response bodies with the ignored fields removed.
+func sameBody(got, want string, ignore map[string]bool) bool {
+	return normalize(got, ignore) == normalize(want, ignore)
+}
+
+// normalize re-encodes a JSON body, or each JSON "data:" line of an event
+// stream, without the ignored fields. Other text is compared as is.
+func normalize(body string, ignore map[string]bool) string {
+	if v, ok := decode(body); ok {
+		return encode(strip(v, ignore))
+	}
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	for i, line := range lines {
+		data, isData := strings.CutPrefix(line, "data: ")
+		if !isData {
+			continue
+		}
+		if v, ok := decode(data); ok {
+			lines[i] = "data: " + encode(strip(v, ignore))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func decode(s string) (any, bool) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+	return v, true
+}
+
+// encode renders v with sorted object keys.
+func encode(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+	return strings.TrimSpace(buf.String())
+}
+
+// strip removes the ignored fields from every object in v.
+func strip(v any, ignore map[string]bool) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if ignore[k] {
+				delete(t, k)
+				continue
+			}
+			t[k] = strip(child, ignore)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = strip(child, ignore)
+		}
+	}
+	return v
+}
+
+func splitFields(s string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields[f] = true
+		}
+	}
+	return fields
+}
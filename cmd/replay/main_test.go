@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/recorder"
+)
+
+// newRouter answers like the router: every completion gets a fresh id and
+// created time, so only the ignored fields differ between runs.
+func newRouter(out *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	var n atomic.Int64
+	r := gin.New()
+	if out != nil {
+		r.Use(recorder.RecordingMiddleware(out))
+	}
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Model == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "model is required", "type": "invalid_request_error"}})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":      fmt.Sprintf("chatcmpl-%d", n.Add(1)),
+			"created": time.Now().UnixNano(),
+			"model":   req.Model,
+			"choices": []gin.H{{"index": 0, "message": gin.H{"role": "assistant", "content": "hi"}}},
+		})
+	})
+	r.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "healthy"}) })
+	return r
+}
+
+// record sends three requests through the recording middleware and writes
+// the recording to a temp file.
+func record(t *testing.T) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	r := newRouter(&out)
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4"}`)),
+		httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)),
+		httptest.NewRequest(http.MethodGet, "/health", nil),
+	} {
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	path := filepath.Join(t.TempDir(), "recording.ndjson")
+	if err := os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun_NoMismatches(t *testing.T) {
+	path := record(t)
+	target := httptest.NewServer(newRouter(nil))
+	defer target.Close()
+
+	var out bytes.Buffer
+	if err := run(path, target.URL, splitFields("id,created"), target.Client(), &out); err != nil {
+		t.Fatalf("run() error = %v, output:\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "3 requests replayed, 0 mismatches") {
+		t.Errorf("output = %q, want 3 requests and no mismatches", out.String())
+	}
+}
+
+func TestRun_ReportsMismatches(t *testing.T) {
+	path := record(t)
+
+	tests := []struct {
+		name   string
+		ignore string
+		target http.HandlerFunc
+		want   string
+	}{
+		{
+			name:   "volatile fields compared",
+			ignore: "",
+			target: newRouter(nil).ServeHTTP,
+			want:   "#1 POST /v1/chat/completions: body differs from the recording",
+		},
+		{
+			name:   "status changed",
+			ignore: "id,created",
+			target: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			want:   "#3 GET /health: status 503, recorded 200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := httptest.NewServer(tt.target)
+			defer target.Close()
+
+			var out bytes.Buffer
+			if err := run(path, target.URL, splitFields(tt.ignore), target.Client(), &out); err == nil {
+				t.Error("run() error = nil, want mismatches reported")
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	ignore := splitFields("id, created")
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"ignored fields", `{"id":"a","created":1,"model":"m"}`, `{"model":"m","id":"b","created":2}`, true},
+		{"nested ignored fields", `{"data":[{"id":"a","x":1}]}`, `{"data":[{"id":"b","x":1}]}`, true},
+		{"other field differs", `{"id":"a","model":"m"}`, `{"id":"a","model":"n"}`, false},
+		{"event stream", "data: {\"id\":\"a\",\"x\":1}\n\ndata: [DONE]\n", "data: {\"id\":\"b\",\"x\":1}\n\ndata: [DONE]\n", true},
+		{"event stream differs", "data: {\"x\":1}\n\ndata: [DONE]\n", "data: {\"x\":2}\n\ndata: [DONE]\n", false},
+		{"plain text", "ok", "ok", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameBody(tt.a, tt.b, ignore); got != tt.same {
+				t.Errorf("sameBody() = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+// Fuzz targets for request parsing.
+//
+// Run one target at a time (CI runs FuzzHandleChatCompletion for 60s):
+//
+//	go test ./cmd/server -run '^$' -fuzz=FuzzHandleChatCompletion -fuzztime=60s
+//	go test ./cmd/server -run '^$' -fuzz=FuzzHashRequest -fuzztime=60s
+//
+// Corpus layout:
+//
+//	cmd/server/testdata/fuzz/<FuzzTarget>/<hash>
+//	    Inputs that made a target fail. `go test -fuzz` writes them here and
+//	    plain `go test` replays every file as a regression case, so commit them
+//	    together with the fix. Each file is in the "go test fuzz v1" format:
+//	    a header line followed by one []byte("...") line per fuzz argument.
+//
+//	$GOCACHE/fuzz/github.com/hpn/hpn-g-router/cmd/server/<FuzzTarget>/
+//	    The generated corpus of interesting inputs. It is local to the machine
+//	    and is not committed.
+//
+// The f.Add seeds below are always replayed by plain `go test`.
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/handler"
+)
+
+// fuzzAPIKey must never appear in logs or responses.
+const fuzzAPIKey = "AIzaSyFuzzKey000000000000000000000000"
+
+// chatSeeds are request bodies taken from the handler tests plus malformed
+// variants that exercise the binding errors.
+var chatSeeds = []string{
+	`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`,
+	`{"model":"gpt-4","messages":[{"role":"user","content":"world"}]}`,
+	`{"model":"gpt-4","messages":[]}`,
+	`{"messages":[]}`,
+	`{"model":"gemini-2.0-flash","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}],"temperature":0.2,"max_tokens":64}`,
+	`{"model":"gpt-4","messages":[{"role":"user","content":"` + fuzzAPIKey + `"}]}`,
+	`{"model":1,"messages":"x"}`,
+	`{"model":"gpt-4","messages":[{"role":"user"}]`,
+	`[]`,
+	`null`,
+	``,
+}
+
+// syncBuffer is a bytes.Buffer safe for the logger and the fuzz loop.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// take returns and clears the buffered output.
+func (b *syncBuffer) take() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.buf.String()
+	b.buf.Reset()
+	return s
+}
+
+// newFuzzRouter serves POST /v1/chat/completions with a ProxyHandler whose
+// upstream always answers with a valid Gemini response and whose logs go to logs.
+func newFuzzRouter(f *testing.F, logs *syncBuffer) *gin.Engine {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"ok"}],"role":"model"},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":1,"candidatesTokenCount":1,"totalTokenCount":2}}`))
+	}))
+	f.Cleanup(upstream.Close)
+
+	km := domain.NewKeyManager([]string{fuzzAPIKey}, 0)
+	h := handler.NewProxyHandler(km, nil,
+		handler.WithLogger(slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+		handler.WithAdapterOptions(adapter.WithBaseURL(upstream.URL)),
+	)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/chat/completions", h.HandleChatCompletion)
+	return r
+}
+
+// FuzzHandleChatCompletion checks that no request body makes the chat handler
+// panic, answer with anything but JSON, or leak the API key.
+func FuzzHandleChatCompletion(f *testing.F) {
+	for _, seed := range chatSeeds {
+		f.Add([]byte(seed))
+	}
+
+	logs := &syncBuffer{}
+	r := newFuzzRouter(f, logs)
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req) // a panic fails the fuzz run
+
+		if !json.Valid(w.Body.Bytes()) {
+			t.Fatalf("status %d: response is not valid JSON: %q", w.Code, w.Body.String())
+		}
+		if !bytes.Contains(body, []byte(fuzzAPIKey)) && strings.Contains(w.Body.String(), fuzzAPIKey) {
+			t.Fatalf("response contains the raw API key: %s", w.Body.String())
+		}
+		if out := logs.take(); strings.Contains(out, fuzzAPIKey) && !bytes.Contains(body, []byte(fuzzAPIKey)) {
+			t.Fatalf("logs contain the raw API key: %s", out)
+		}
+	})
+}
+
+// FuzzHashRequest checks that HashRequest accepts any input and always
+// returns a 64-character hex digest.
+func FuzzHashRequest(f *testing.F) {
+	for _, seed := range chatSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		got := handler.HashRequest(body)
+		if len(got) != 64 {
+			t.Fatalf("HashRequest() = %q, want 64 hex characters", got)
+		}
+		if got != handler.HashRequest(body) {
+			t.Fatal("HashRequest() is not deterministic")
+		}
+	})
+}
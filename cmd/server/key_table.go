@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/ui"
+)
+
+// keyTableInterval is the least time between two key pool tables printed
+// for key events.
+const keyTableInterval = time.Second
+
+// keyPoolStatus returns a key pool table row for every key km manages.
+// Keys without a name show their fingerprint; weights come from the config,
+// so keys added at runtime show none.
+func keyPoolStatus(km *domain.KeyManager, weights map[string]int) []ui.KeyStatus {
+	states := km.GetKeyStates()
+	rows := make([]ui.KeyStatus, len(states))
+	for i, s := range states {
+		row := ui.KeyStatus{
+			Name:       s.Name,
+			Status:     s.Status,
+			Provider:   string(km.KeyProvider(s.Key)),
+			Weight:     "-",
+			LastUsed:   "never",
+			ErrorCount: strconv.Itoa(s.DeathCount),
+		}
+		if row.Name == "" {
+			row.Name = domain.KeyFingerprint(s.Key)
+		}
+		if row.Provider == "" {
+			row.Provider = "-"
+		}
+		if w, ok := weights[s.Key]; ok {
+			row.Weight = strconv.Itoa(w)
+		}
+		if s.LastUsedAt != nil {
+			row.LastUsed = s.LastUsedAt.Format("15:04:05")
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// keyTablePrinter prints the key pool table when keys die or are revived,
+// at most once per interval. Events inside the interval are covered by a
+// single print at its end, so the last table shown is always current.
+type keyTablePrinter struct {
+	print    func()
+	interval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	pending bool
+}
+
+// Notify handles a key pool event; subscribe it to the event bus.
+func (p *keyTablePrinter) Notify(e domain.KeyEvent) {
+	switch e.Type {
+	case domain.KeyEventDead, domain.KeyEventAllDead, domain.KeyEventRevived:
+	default:
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending {
+		return
+	}
+	if wait := p.interval - time.Since(p.last); wait > 0 {
+		p.pending = true
+		time.AfterFunc(wait, p.flush)
+		return
+	}
+	p.last = time.Now()
+	p.print()
+}
+
+// flush prints the table held back by Notify.
+func (p *keyTablePrinter) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = false
+	p.last = time.Now()
+	p.print()
+}
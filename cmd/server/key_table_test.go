@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestKeyPoolStatus(t *testing.T) {
+	const named, unnamed = "AIzaSyKeyTableNamed00000001", "AIzaSyKeyTableUnnamed000002"
+	km := domain.NewKeyManager([]string{named, unnamed}, time.Hour,
+		domain.WithKeyNames(map[string]string{named: "primary"}),
+		domain.WithKeyProviders(map[string]domain.ProviderType{named: domain.ProviderGoogle}))
+	km.MarkAsDead(unnamed, "")
+
+	rows := keyPoolStatus(km, map[string]int{named: 3})
+	if len(rows) != 2 {
+		t.Fatalf("len(rows) = %d, want 2", len(rows))
+	}
+	got := map[string]string{}
+	for _, r := range rows {
+		got[r.Name] = r.Status + " " + r.Provider + " " + r.Weight + " " + r.LastUsed + " " + r.ErrorCount
+	}
+	want := map[string]string{
+		"primary":                      "active google 3 never 0",
+		domain.KeyFingerprint(unnamed): "dead - - never 1",
+	}
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("row %s = %q, want %q", name, got[name], w)
+		}
+	}
+}
+
+func TestKeyTablePrinter_Throttles(t *testing.T) {
+	var prints atomic.Int32
+	p := &keyTablePrinter{print: func() { prints.Add(1) }, interval: 50 * time.Millisecond}
+
+	p.Notify(domain.KeyEvent{Type: domain.KeyEventKeysAdded})
+	if got := prints.Load(); got != 0 {
+		t.Fatalf("prints after keys_added = %d, want 0", got)
+	}
+
+	for _, typ := range []domain.KeyEventType{domain.KeyEventDead, domain.KeyEventDead, domain.KeyEventRevived, domain.KeyEventAllDead} {
+		p.Notify(domain.KeyEvent{Type: typ})
+	}
+	if got := prints.Load(); got != 1 {
+		t.Fatalf("prints right after a burst = %d, want 1", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for prints.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := prints.Load(); got != 2 {
+		t.Errorf("prints after the interval = %d, want 2: one at once and one for the rest of the burst", got)
+	}
+}
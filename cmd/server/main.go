@@ -1,8 +1,11 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
-	"fmt"
+	"errors"
+	"flag"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -11,17 +14,32 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gopkg.in/natefinch/lumberjack.v2"
 
+	"github.com/hpn/hpn-g-router/internal/adapter"
 	"github.com/hpn/hpn-g-router/internal/config"
 	"github.com/hpn/hpn-g-router/internal/domain"
 	"github.com/hpn/hpn-g-router/internal/handler"
+	"github.com/hpn/hpn-g-router/internal/metrics"
+	"github.com/hpn/hpn-g-router/internal/notifier"
+	"github.com/hpn/hpn-g-router/internal/profiling"
+	"github.com/hpn/hpn-g-router/internal/recorder"
 	"github.com/hpn/hpn-g-router/internal/security"
+	"github.com/hpn/hpn-g-router/internal/spec"
 	"github.com/hpn/hpn-g-router/internal/ui"
 )
 
 func main() {
-	logger := setupLogger()
-	logger.Info("starting hpn-g-router")
+	warmUp := flag.Bool("warm-up", false, "check every key with its provider before serving; keys that fail start out dead")
+	flag.Parse()
+
+	// Log to stdout until the config says where logs go.
+	logger, _ := setupLogger(config.LoggingConfig{Level: os.Getenv("HPN_ROUTER_LOGGING_LEVEL")})
+	logger.Info("starting hpn-g-router",
+		slog.String("version", Version),
+		slog.String("git_commit", GitCommit),
+		slog.String("build_time", BuildTime),
+	)
 
 	cfg, err := config.GetConfig()
 	if err != nil {
@@ -29,6 +47,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	logger, logFile := setupLogger(cfg.Logging)
+	ui.SetTheme(ui.NewTheme(cfg.Logging.UITheme))
+	// The banner, endpoint table, key table and shutdown messages are part
+	// of the cyberpunk console only.
+	fancyConsole := cfg.Logging.UITheme == ui.ThemeCyberpunk
+
 	logger.Info("config loaded",
 		slog.String("host", cfg.Server.Host),
 		slog.Int("port", cfg.Server.Port),
@@ -38,70 +62,526 @@ func main() {
 
 	activeKeys := cfg.GetActiveKeys()
 	keys := make([]string, len(activeKeys))
+	providers := make(map[string]domain.ProviderType, len(activeKeys))
+	names := make(map[string]string, len(activeKeys))
+	weights := make(map[string]int, len(activeKeys))
+	limits := make(map[string]domain.QuotaLimits)
+	rateLimits := make(map[string]int64)
+	tags := make(map[string][]string)
+	priorities := make(map[string]int)
+	regions := make(map[string]domain.KeyRegion)
+	expiries := make(map[string]time.Time)
 	for i, k := range activeKeys {
 		keys[i] = k.Key
+		providers[k.Key] = k.Provider
+		names[k.Key] = k.Name
+		weights[k.Key] = k.Weight
+		if k.DailyTokenLimit > 0 || k.MonthlyTokenLimit > 0 {
+			limits[k.Key] = domain.QuotaLimits{Daily: k.DailyTokenLimit, Monthly: k.MonthlyTokenLimit}
+		}
+		if k.TokensPerMinute > 0 {
+			rateLimits[k.Key] = k.TokensPerMinute
+		}
+		if len(k.Tags) > 0 {
+			tags[k.Key] = k.Tags
+		}
+		if k.Priority != 0 {
+			priorities[k.Key] = k.Priority
+		}
+		if k.Region != "" || k.BaseURL != "" {
+			regions[k.Key] = domain.KeyRegion{Region: k.Region, BaseURL: k.BaseURL}
+		}
+		if k.ExpiresAt != nil {
+			expiries[k.Key] = *k.ExpiresAt
+		}
+	}
+
+	kmOpts := []domain.KeyManagerOption{
+		domain.WithStrategy(cfg.KeyPool.Strategy),
+		domain.WithSecureRandom(cfg.KeyPool.SecureRandom),
+		domain.WithDecayAlpha(cfg.KeyPool.DecayAlpha),
+		domain.WithRevivalStrategy(cfg.KeyPool.RevivalStrategy),
+		domain.WithKeyProviders(providers),
+		domain.WithKeyNames(names),
+		domain.WithKeyTags(tags),
+		domain.WithKeyPriorities(priorities),
+		domain.WithKeyWeights(weights),
+		domain.WithKeyRegions(regions),
+		domain.WithKeyExpiries(expiries),
+		domain.WithMaxConcurrentPerKey(cfg.KeyPool.MaxConcurrentPerKey),
+		domain.WithMinActiveKeys(cfg.KeyPool.MinActiveKeysThreshold),
+		domain.WithMaxKeyAge(time.Duration(cfg.KeyPool.MaxKeyAgeDays) * 24 * time.Hour),
+		domain.WithStatePath(cfg.Admin.StatePath),
+		domain.WithLogger(logger),
 	}
 
+	events := domain.NewEventBus(domain.WithEventBusLogger(logger))
+	kmOpts = append(kmOpts, domain.WithEventBus(events))
+
+	var webhook *notifier.WebhookNotifier
+	if cfg.Notifications.WebhookURL != "" {
+		webhook = notifier.NewWebhookNotifier(cfg.Notifications.WebhookURL,
+			notifier.WithRetryCount(cfg.Notifications.WebhookRetryCount),
+			notifier.WithHMACSecret(cfg.Notifications.HMACSecret),
+			notifier.WithLogger(logger),
+		)
+		events.Subscribe(webhook.Notify)
+		logger.Info("key event webhook enabled")
+	}
+
+	var quota *domain.QuotaTracker
+	if len(limits) > 0 {
+		quota = domain.NewQuotaTracker(limits)
+		quota.Start()
+		kmOpts = append(kmOpts, domain.WithQuotaTracker(quota))
+		logger.Info("token quotas enabled", slog.Int("keys", len(limits)))
+	}
+
+	var tokenRate *domain.TokenRateLimiter
+	if len(rateLimits) > 0 {
+		tokenRate = domain.NewTokenRateLimiter(rateLimits)
+		kmOpts = append(kmOpts, domain.WithTokenRateLimiter(tokenRate))
+		logger.Info("tokens-per-minute limits enabled", slog.Int("keys", len(rateLimits)))
+	}
+
+	var regionProbe *domain.RegionLatencyProbe
+	if cfg.KeyPool.RegionLatencySelection {
+		urls := []string{cfg.Provider.Google.BaseURL}
+		for _, r := range regions {
+			urls = append(urls, r.BaseURL)
+		}
+		regionProbe = domain.NewRegionLatencyProbe(urls,
+			domain.WithProbeInterval(time.Duration(cfg.KeyPool.RegionProbeIntervalSeconds)*time.Second),
+			domain.WithProbeLogger(logger),
+		)
+		regionProbe.Start()
+		kmOpts = append(kmOpts, domain.WithRegionProbe(regionProbe, cfg.Provider.Google.BaseURL))
+		logger.Info("region latency selection enabled", slog.Int("endpoints", len(regionProbe.URLs())))
+	}
+
+	if len(cfg.KeyPool.ProviderCooldownSeconds) > 0 {
+		cooldowns := make(map[domain.ProviderType]time.Duration, len(cfg.KeyPool.ProviderCooldownSeconds))
+		for p, s := range cfg.KeyPool.ProviderCooldownSeconds {
+			cooldowns[p] = time.Duration(s) * time.Second
+		}
+		kmOpts = append(kmOpts, domain.WithProviderCooldowns(cooldowns))
+	}
 	cooldown := time.Duration(cfg.KeyPool.CooldownSeconds) * time.Second
-	km := domain.NewKeyManager(keys, cooldown)
+	km := domain.NewKeyManager(keys, cooldown, kmOpts...)
+
+	if path := cfg.Admin.SnapshotPath; path != "" {
+		snapshot, err := domain.ReadSnapshotFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			logger.Warn("failed to read key pool snapshot",
+				slog.String("path", path),
+				slog.String("error", err.Error()),
+			)
+		default:
+			logger.Info("key pool snapshot restored",
+				slog.String("path", path),
+				slog.Time("created_at", snapshot.CreatedAt),
+				slog.Int("dead_keys", km.Restore(snapshot)),
+			)
+		}
+	}
+
+	if path := cfg.Admin.StatePath; path != "" {
+		maxAge := time.Duration(cfg.Admin.StateMaxAgeSeconds) * time.Second
+		state, err := domain.ReadStateFile(path, maxAge)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case errors.Is(err, domain.ErrStateExpired):
+			logger.Info("key pool state too old, starting fresh",
+				slog.String("path", path),
+				slog.Time("created_at", state.CreatedAt),
+			)
+		case err != nil:
+			logger.Warn("failed to read key pool state",
+				slog.String("path", path),
+				slog.String("error", err.Error()),
+			)
+		default:
+			logger.Info("key pool state restored",
+				slog.String("path", path),
+				slog.Time("created_at", state.CreatedAt),
+				slog.Int("dead_keys", km.Restore(state)),
+			)
+		}
+	}
 
 	logger.Info("key manager ready",
 		slog.Int("total_keys", km.TotalKeyCount()),
 		slog.Duration("cooldown", cooldown),
 	)
+	// Started after the restore so key ages from the state file are checked.
+	km.StartKeyAgeChecks(domain.DefaultKeyAgeCheckInterval)
+
+	if fancyConsole {
+		printKeyTable := func() { ui.PrintKeyPoolStatus(keyPoolStatus(km, weights)) }
+		printKeyTable()
+		events.Subscribe((&keyTablePrinter{print: printKeyTable, interval: keyTableInterval}).Notify)
+	}
+
+	// One transport for all per-request adapters so upstream connections are reused.
+	httpClient := &http.Client{
+		Transport: newHTTPTransport(cfg.HTTP),
+		Timeout:   adapter.DefaultTimeout,
+	}
+
+	latency := domain.NewLatencyTracker(domain.DefaultLatencyAlpha)
+
+	// Cancelled on shutdown to stop background goroutines.
+	runCtx, stopRun := context.WithCancel(context.Background())
+	defer stopRun()
+
+	cache := handler.NewFlashCache(runCtx, handler.WithCacheLogger(logger))
+	requestRate := handler.NewRequestRate(handler.DefaultRateWindow)
+	latencyStats := handler.NewLatencyStats(cfg.Metrics.LatencyWindow)
+	stream := handler.NewMetricsStream(km,
+		handler.WithStreamCache(cache),
+		handler.WithStreamRequestRate(requestRate),
+	)
+
+	costRouter := domain.NewCostRouter(cfg.Routing.CostTable(),
+		domain.WithFallbackToFirst(cfg.Routing.FallbackToFirst),
+	)
+
+	// Already validated with the rest of the config.
+	safetyAllowlist, _ := security.ParseIPAllowlist(cfg.Provider.Google.SafetyNoneAllowlist)
+
+	// Base URLs the admin API can change at runtime.
+	baseURLs := domain.NewProviderBaseURLRegistry(map[domain.ProviderType]string{
+		domain.ProviderGoogle: cfg.Provider.Google.BaseURL,
+	})
+
+	if *warmUp {
+		failed := warmUpKeys(runCtx, km, warmUpAdapter(cfg, km, httpClient, baseURLs), cfg.StartupChecks.WarmUpModels, logger)
+		logger.Info("key warm-up done",
+			slog.Int("failed", failed),
+			slog.Int("active_keys", km.ActiveKeyCount()),
+		)
+	}
+
+	proxyOpts := []handler.ProxyHandlerOption{
+		handler.WithMaxRetries(cfg.KeyPool.RetryCount),
+		handler.WithEndpointRetries(cfg.KeyPool.EndpointRetries),
+		handler.WithRetryableStatusCodes(cfg.KeyPool.RetryableStatusCodes),
+		handler.WithNonRetryableStatusCodes(cfg.KeyPool.NonRetryableStatusCodes),
+		handler.WithMaxBatchConcurrency(cfg.KeyPool.MaxBatchConcurrency),
+		handler.WithLatencyTracker(latency),
+		handler.WithRequestQueue(handler.NewRequestQueue(
+			cfg.Server.QueueMaxSize,
+			time.Duration(cfg.Server.QueueTimeoutSeconds)*time.Second,
+		)),
+		handler.WithLogger(logger),
+		handler.WithResponseValidation(cfg.Proxy.ValidateResponses),
+		handler.WithExposeAttemptHeader(cfg.Proxy.ExposeAttemptHeader),
+		handler.WithErrorDetails(cfg.Logging.Level == "debug"),
+		handler.WithAccurateTokenEstimation(cfg.CostEstimation.UseAccurateTokenizer),
+		handler.WithAsyncCostEstimation(cfg.CostEstimation.AsyncBufferSize),
+		handler.WithContextLimitMap(cfg.KeyPool.MaxContextTokens),
+		handler.WithRetryOnEmptyResponse(cfg.KeyPool.RetryOnEmptyResponse),
+		handler.WithForwardUser(cfg.Provider.Google.ForwardUserField),
+		handler.WithAdapterCacheSize(cfg.Provider.Google.AdapterCacheEntries),
+		handler.WithAdapterOptions(
+			adapter.WithHTTPClient(httpClient),
+			adapter.WithDefaultTopK(cfg.Provider.Google.DefaultTopK),
+			adapter.WithGoogleSearchGrounding(cfg.Provider.Google.SearchGrounding),
+			adapter.WithSafetySettings(cfg.Provider.Google.SafetySettings),
+			adapter.WithSystemPromptSeparator(cfg.Provider.Google.SystemPromptSeparator),
+			adapter.WithGlobalSystemPrompt(cfg.Provider.GlobalSystemPrompt),
+			adapter.WithDefaultMaxTokens(cfg.Provider.DefaultMaxTokens),
+			adapter.WithFlashDefaultMaxTokens(cfg.Provider.Google.FlashDefaultMaxTokens),
+			adapter.WithMaxAllowedTokens(cfg.Provider.MaxAllowedTokens),
+			adapter.WithBaseURLProvider(baseURLs.For(domain.ProviderGoogle)),
+			adapter.WithRouterVersion(Version),
+		),
+		handler.WithSafetyAllowlist(safetyAllowlist),
+		handler.WithMetricsStream(stream),
+		handler.WithModelCache(cache),
+		handler.WithBuildInfo(buildInfo()),
+		handler.WithMaxCandidates(cfg.Provider.Google.MaxCandidates),
+		handler.WithProviderRouter(func(model string) domain.ProviderType {
+			return costRouter.SelectProvider(model, km.ActiveProviders())
+		}),
+	}
+	if len(cfg.Routing.Rules) > 0 {
+		// Already validated with the rest of the config.
+		rules, _ := domain.NewRoutingRuleEngine(cfg.Routing.Rules)
+		proxyOpts = append(proxyOpts, handler.WithRoutingRules(rules))
+		logger.Info("routing rules enabled", slog.Int("rules", rules.Len()))
+	}
+	if cfg.KeyPool.LatencyBasedSelection {
+		proxyOpts = append(proxyOpts, handler.WithLatencyBasedSelection())
+	}
+	if cfg.KeyPool.RegionLatencySelection {
+		proxyOpts = append(proxyOpts, handler.WithRegionLatencySelection())
+	}
+	if len(cfg.KeyPool.ProviderWeight) > 0 {
+		proxyOpts = append(proxyOpts, handler.WithProviderBalancer(
+			domain.NewProviderBalancer(km, cfg.KeyPool.ProviderWeight),
+		))
+	}
+	if quota != nil {
+		proxyOpts = append(proxyOpts, handler.WithQuotaTracker(quota))
+	}
+	if tokenRate != nil {
+		proxyOpts = append(proxyOpts, handler.WithTokenRateLimiter(tokenRate))
+	}
+	if len(cfg.Provider.RateLimitPerMinute) > 0 {
+		providers := make([]domain.Provider, 0, len(cfg.Provider.RateLimitPerMinute))
+		for p, n := range cfg.Provider.RateLimitPerMinute {
+			providers = append(providers, domain.Provider{Type: p, RateLimitPerMinute: n})
+		}
+		proxyOpts = append(proxyOpts, handler.WithProviderRateLimiter(domain.NewProviderRateLimiter(providers)))
+	}
+	if cfg.Dev.ChaosMode {
+		chaos := cfg.Dev.ChaosConfig
+		proxyOpts = append(proxyOpts, handler.WithAdapterWrapper(func(_ string, p adapter.AIProvider) adapter.AIProvider {
+			return adapter.NewChaosAdapter(p, chaos)
+		}))
+		logger.Warn("chaos mode enabled, injecting provider failures",
+			slog.Float64("failure_rate", chaos.FailureRate),
+			slog.String("error_type", chaos.ErrorType),
+			slog.Duration("min_delay", chaos.DelayRange[0]),
+			slog.Duration("max_delay", chaos.DelayRange[1]),
+		)
+	}
+
+	m := metrics.New(km)
+	m.SetBuildInfo(Version, GitCommit)
+	turnover := metrics.NewKeyTurnoverTracker(km)
+	events.Subscribe(turnover.Notify)
+	proxyOpts = append(proxyOpts, handler.WithProviderErrorObserver(m.ObserveProviderError))
 
 	proxyHandler := handler.NewProxyHandler(
 		km,
 		nil, // adapter created per-request with rotated key
-		handler.WithMaxRetries(cfg.KeyPool.RetryCount),
-		handler.WithLogger(logger),
+		proxyOpts...,
 	)
 
 	if cfg.Logging.Level != "debug" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	r := gin.New()
-	r.Use(handler.RecoveryMiddleware(logger))
+	var influx *metrics.InfluxDBReporter
+	if cfg.Metrics.InfluxDB.URL != "" {
+		influxCfg := cfg.Metrics.InfluxDB
+		influx = metrics.NewInfluxDBReporter(influxCfg.URL, influxCfg.Org, influxCfg.Bucket, influxCfg.Token, km,
+			func() metrics.UsageTotals {
+				t := handler.GetCostTotals()
+				return metrics.UsageTotals{Requests: t.Requests, TokensIn: t.InputTokens, TokensOut: t.OutputTokens, CostUSD: t.CostUSD}
+			},
+			metrics.WithFlushInterval(time.Duration(influxCfg.FlushIntervalSeconds)*time.Second),
+			metrics.WithInfluxTag("strategy", string(cfg.KeyPool.Strategy)),
+			metrics.WithInfluxLogger(logger),
+		)
+		influx.Start()
+		logger.Info("influxdb reporter started",
+			slog.String("bucket", influxCfg.Bucket),
+			slog.Int("flush_interval_seconds", influxCfg.FlushIntervalSeconds),
+		)
+	}
+
+	// Already validated with the rest of the config.
+	ipExtractor, _ := handler.NewRealIPExtractor(cfg.Server.TrustedProxies,
+		handler.WithTrustedProxyCount(cfg.Server.TrustedProxyCount),
+		handler.WithTrustedProxyHeader(cfg.Server.TrustedProxyHeader),
+	)
+
+	r := gin.New(handler.WithIPExtractor(ipExtractor))
+	// /v1/chat/completions/ redirects to /v1/chat/completions, 301 for GET
+	// and 307 otherwise so clients send the body again.
+	r.RedirectTrailingSlash = true
+	r.NoRoute(handler.NotFoundHandler())
+	r.Use(handler.RecoveryMiddleware(logger,
+		handler.WithPanicObserver(m.ObservePanic),
+		handler.WithStackTraceInResponse(cfg.Logging.Level == "debug"),
+	))
+	r.Use(m.Middleware())
+	r.Use(handler.StatsMiddleware(latencyStats))
 	r.Use(handler.CORSMiddleware())
 	r.Use(handler.StripAuthHeadersMiddleware())
-	r.Use(handler.LoggingMiddleware(logger))
+	userUsage := handler.NewUserUsageTracker()
+	logFields := make(map[string]bool, len(cfg.Logging.RequestLogFields))
+	for _, f := range cfg.Logging.RequestLogFields {
+		logFields[f] = true
+	}
+	r.Use(handler.RequestIDMiddleware(handler.WithRequestIDHeader(cfg.Server.RequestIDHeader)))
+	r.Use(handler.LoggingMiddleware(logger,
+		handler.WithUserUsageTracker(userUsage),
+		handler.WithSlowRequestThreshold(time.Duration(cfg.Logging.SlowRequestThresholdSeconds)*time.Second),
+		handler.WithSlowRequestObserver(m.ObserveSlowRequest),
+		handler.WithDebugSampleRate(cfg.Logging.DebugSampleRate),
+		handler.WithBodyHashing(cfg.Logging.BodyHashing),
+		handler.WithRequestBodyRedaction(cfg.Security.RedactRequestBodies),
+		handler.WithRequestLogFields(logFields),
+	))
+	r.Use(handler.RequestSizeMiddleware())
+	r.Use(requestRate.Middleware())
+	// Compressed bodies are counted by RequestSizeMiddleware; recordings
+	// keep them uncompressed.
+	if cfg.Server.CompressionLevel != gzip.NoCompression {
+		compressionOpts := []handler.CompressionOption{handler.WithCompressionMinSize(cfg.Server.CompressionMinSize)}
+		if !cfg.Security.RedactRequestBodies {
+			compressionOpts = append(compressionOpts, handler.WithCompressionCache(cache))
+		}
+		r.Use(handler.CompressionMiddleware(cfg.Server.CompressionLevel, compressionOpts...))
+	}
 
-	cache := handler.NewFlashCache(handler.WithCacheLogger(logger))
-	r.Use(handler.CacheMiddleware(cache, logger))
+	var recording *os.File
+	if cfg.Server.RecordPath != "" {
+		f, err := os.OpenFile(cfg.Server.RecordPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			logger.Error("failed to open record file", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		recording = f
+		// Admin requests carry provider API keys and are never recorded.
+		r.Use(recorder.RecordingMiddleware(recording,
+			recorder.WithRedactedBodies(cfg.Security.RedactRequestBodies),
+			recorder.WithSkippedPaths("/admin/"),
+		))
+		logger.Warn("recording traffic", slog.String("path", cfg.Server.RecordPath))
+	}
+
+	// Normalize model names before caching so aliases share cache entries.
+	r.Use(handler.ModelNormalizationMiddleware(cfg.Models.Aliases(), logger))
 
-	logger.Info("flash cache ready", slog.Duration("ttl", handler.DefaultCacheTTL))
+	r.Use(handler.ContentNegotiationMiddleware())
+	// Retries with an Idempotency-Key are answered before the cache and the
+	// provider.
+	r.Use(handler.IdempotencyMiddleware(handler.NewIdempotencyStore(runCtx, handler.WithCacheLogger(logger)), logger))
+	// The cache keeps responses under a hash of the request body and logs
+	// it on hits, so it is off while bodies are redacted.
+	if cfg.Security.RedactRequestBodies {
+		logger.Info("flash cache disabled by security.redact_request_bodies")
+	} else {
+		r.Use(handler.CacheMiddleware(cache, logger))
+		logger.Info("flash cache ready", slog.Duration("ttl", handler.DefaultCacheTTL))
+	}
+
+	// Requests that reach the provider run on the worker pool, when enabled.
+	proxied := r.Group("")
+	var pool *handler.WorkerPool
+	if cfg.Server.WorkerPoolSize > 0 {
+		pool = handler.NewWorkerPool(cfg.Server.WorkerPoolSize)
+		proxied.Use(handler.WorkerPoolMiddleware(pool))
+		m.ObserveWorkerPool(pool)
+		logger.Info("worker pool ready", slog.Int("size", cfg.Server.WorkerPoolSize))
+	}
 
-	r.POST("/v1/chat/completions", proxyHandler.HandleChatCompletion)
+	proxied.POST("/v1/chat/completions", proxyHandler.HandleChatCompletion)
+	proxied.POST("/v1/chat/completions/batch", proxyHandler.HandleBatchCompletion)
 	r.GET("/v1/models", proxyHandler.HandleModels)
 	r.GET("/health", proxyHandler.HandleHealth)
-	r.POST("/chat/completions", proxyHandler.HandleChatCompletion)
+	r.GET("/healthz/ready", proxyHandler.HandleReady)
+	r.GET("/metrics", m.Handler())
 
-	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	srv := &http.Server{
-		Addr:         addr,
-		Handler:      r,
-		ReadTimeout:  time.Duration(cfg.Server.ReadTimeoutSeconds) * time.Second,
-		WriteTimeout: time.Duration(cfg.Server.WriteTimeoutSeconds) * time.Second,
+	if cfg.Admin.Token != "" {
+		adminHandler := handler.NewAdminHandler(km,
+			handler.WithAdminLogger(logger),
+			handler.WithAdminLatencyTracker(latency),
+			handler.WithAdminSnapshotPath(cfg.Admin.SnapshotPath),
+			handler.WithAdminDrainTimeout(time.Duration(cfg.Admin.DrainTimeoutSeconds)*time.Second),
+			handler.WithAdminTokenRateLimiter(tokenRate),
+			handler.WithAdminUserUsageTracker(userUsage),
+			handler.WithAdminBaseURLRegistry(baseURLs),
+			handler.WithAdminCache(cache),
+			handler.WithAdminConfig(cfg),
+			handler.WithAdminLogLevel(handler.NewLogLevel(logLevel,
+				time.Duration(cfg.Admin.LogLevelRevertSeconds)*time.Second)),
+		)
+		admin := r.Group("/admin", handler.AdminAuthMiddleware(cfg.Admin.Token, logger))
+		admin.GET("/keys", adminHandler.HandleListKeys)
+		admin.POST("/keys", adminHandler.HandleAddKey)
+		admin.POST("/keys/batch", adminHandler.HandleAddKeys)
+		admin.DELETE("/keys/batch", adminHandler.HandleRemoveKeys)
+		admin.DELETE("/keys/:name", adminHandler.HandleRemoveKey)
+		admin.GET("/keys/latency", adminHandler.HandleKeyLatency)
+		admin.GET("/keys/state", adminHandler.HandleKeyStates)
+		admin.GET("/keys/:name/state", adminHandler.HandleKeyState)
+		admin.POST("/keys/:name/revive", adminHandler.HandleReviveKey)
+		admin.POST("/keys/:name/kill", adminHandler.HandleKillKey)
+		admin.POST("/keys/:name/pause", adminHandler.HandlePauseKey)
+		admin.POST("/keys/:name/resume", adminHandler.HandleResumeKey)
+		admin.POST("/snapshot", adminHandler.HandleSnapshot)
+		admin.GET("/usage", adminHandler.HandleUsage)
+		admin.GET("/usage/projection", adminHandler.HandleUsageProjection)
+		admin.GET("/usage/users", adminHandler.HandleUserUsage)
+		admin.DELETE("/usage/users/:id", adminHandler.HandleResetUserUsage)
+		admin.GET("/cache/entries", adminHandler.HandleCacheEntries)
+		admin.GET("/config/schema", adminHandler.HandleConfigSchema)
+		admin.GET("/config/current", adminHandler.HandleConfigCurrent)
+		admin.PUT("/config/cooldown", adminHandler.HandleSetCooldown)
+		admin.PUT("/config/strategy", adminHandler.HandleSetStrategy)
+		admin.PUT("/providers/:type/base-url", adminHandler.HandleSetProviderBaseURL)
+		admin.GET("/log-level", adminHandler.HandleGetLogLevel)
+		admin.PUT("/log-level", adminHandler.HandleSetLogLevel)
+		admin.GET("/metrics/stream", stream.HandleStream)
+		admin.GET("/metrics/key-health", turnover.HandleKeyHealth)
+		admin.GET("/stats/latency", latencyStats.HandleLatency)
+	} else {
+		logger.Info("admin API disabled, set admin.token to enable")
 	}
+	proxied.POST("/chat/completions", proxyHandler.HandleChatCompletion)
+	proxied.POST("/v1/embeddings", proxyHandler.HandleEmbeddings)
+	r.GET("/v1/embeddings", handler.MethodNotAllowedHandler(http.MethodPost))
+
+	apiDoc, err := spec.Build(spec.APIVersion)
+	if err != nil {
+		logger.Error("failed to build openapi spec", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	specHandler, err := handler.NewSpecHandler(apiDoc)
+	if err != nil {
+		logger.Error("failed to render openapi spec", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	r.GET("/openapi.json", specHandler.HandleJSON)
+	r.GET("/openapi.yaml", specHandler.HandleYAML)
+
+	srv := handler.NewServer(cfg.Server, handler.CanonicalPathHandler(r))
 
 	go func() {
-		logger.Info("server starting", slog.String("address", addr))
-		ui.PrintBanner()
-		ui.PrintStartupInfo(cfg.Server.Host, cfg.Server.Port, len(cfg.GetActiveKeys()), string(cfg.KeyPool.Strategy))
+		logger.Info("server starting",
+			slog.String("address", srv.Addr),
+			slog.Bool("tls", cfg.Server.TLSEnabled),
+			slog.Bool("auto_cert", cfg.Server.TLSEnabled && cfg.Server.TLSAutoCert),
+		)
+		if fancyConsole {
+			ui.PrintBanner()
+			ui.PrintStartupInfo(cfg.Server.Host, cfg.Server.Port, len(cfg.GetActiveKeys()), string(cfg.KeyPool.Strategy))
+		}
 
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := handler.ListenAndServe(srv, cfg.Server); err != nil && err != http.ErrServerClosed {
 			logger.Error("server error", slog.String("error", err.Error()))
 			os.Exit(1)
 		}
 	}()
 
+	pprofServer := profiling.NewServer(cfg.Server.Host,
+		profiling.WithPProf(cfg.Logging.Level == "debug" && cfg.Server.PProfEnabled, cfg.Server.PProfPort),
+		profiling.WithLogger(logger),
+	)
+	if cfg.Server.PProfEnabled && !pprofServer.Enabled() {
+		logger.Info("pprof disabled, set logging.level to debug to enable")
+	}
+	if err := pprofServer.Start(); err != nil {
+		logger.Error("failed to start pprof server", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-quit
 
 	logger.Info("shutdown signal received", slog.String("signal", sig.String()))
-	ui.PrintShutdown()
+	if fancyConsole {
+		ui.PrintShutdown()
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
 	defer cancel()
@@ -111,14 +591,86 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Account the costs still queued before the totals are reported.
+	proxyHandler.Close()
+
+	// Saved after in-flight requests finish so their outcomes are included.
+	if path := cfg.Admin.StatePath; path != "" {
+		if err := km.SaveState(path); err != nil {
+			logger.Error("failed to save key pool state",
+				slog.String("path", path),
+				slog.String("error", err.Error()),
+			)
+		} else {
+			logger.Info("key pool state saved", slog.String("path", path))
+		}
+	}
+
+	if pool != nil {
+		pool.Close()
+	}
+
+	if err := pprofServer.Shutdown(ctx); err != nil {
+		logger.Error("pprof shutdown error", slog.String("error", err.Error()))
+	}
+
+	if influx != nil {
+		influx.Stop()
+	}
+
+	// Drain the event bus first so queued events still reach the webhook.
+	events.Close()
+	if webhook != nil {
+		webhook.Close()
+	}
+
+	if quota != nil {
+		quota.Stop()
+	}
+	if regionProbe != nil {
+		regionProbe.Stop()
+	}
+	km.StopKeyAgeChecks()
+
+	if recording != nil {
+		recording.Close()
+	}
+
+	stopRun()
+
 	logger.Info("server stopped gracefully")
-	ui.PrintGoodbye()
+	if fancyConsole {
+		ui.PrintGoodbye()
+	}
+
+	if logFile != nil {
+		logFile.Close()
+	}
 }
 
-func setupLogger() *slog.Logger {
+// newHTTPTransport builds the pooled transport shared by all upstream requests.
+func newHTTPTransport(cfg config.HTTPConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = cfg.MaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.IdleConnTimeout = time.Duration(cfg.IdleConnTimeoutSeconds) * time.Second
+	t.TLSHandshakeTimeout = time.Duration(cfg.TLSHandshakeTimeoutSeconds) * time.Second
+	t.DisableCompression = cfg.DisableCompression
+	return t
+}
+
+// logLevel is the level of the logger built by setupLogger. The admin API
+// changes it at runtime.
+var logLevel = new(slog.LevelVar)
+
+// setupLogger builds the JSON logger described by cfg. It writes to stdout,
+// or with cfg.OutputPath set to that file, rotated by size, and to stdout as
+// well when cfg.AlsoLogToStdout is set. The returned file is nil when
+// logging to stdout only; the caller closes it on shutdown.
+func setupLogger(cfg config.LoggingConfig) (*slog.Logger, *lumberjack.Logger) {
 	level := slog.LevelInfo
 
-	switch os.Getenv("HPN_ROUTER_LOGGING_LEVEL") {
+	switch cfg.Level {
 	case "debug":
 		level = slog.LevelDebug
 	case "warn":
@@ -127,14 +679,32 @@ func setupLogger() *slog.Logger {
 		level = slog.LevelError
 	}
 
+	var out io.Writer = os.Stdout
+	var file *lumberjack.Logger
+	if cfg.OutputPath != "" {
+		file = &lumberjack.Logger{
+			Filename:   cfg.OutputPath,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAgeDays,
+		}
+		out = file
+		if cfg.AlsoLogToStdout {
+			out = io.MultiWriter(os.Stdout, file)
+		}
+	}
+
 	// Create base JSON handler
-	baseHandler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	logLevel.Set(level)
+	baseHandler := slog.NewJSONHandler(out, &slog.HandlerOptions{Level: logLevel})
 
-	// Wrap with security redactor to sanitize sensitive data in logs
-	redactedHandler := security.NewRedactedHandler(baseHandler)
+	// Wrap with security redactor to sanitize sensitive data in logs. The
+	// mode is validated with the config; the bootstrap logger has none.
+	mode, _ := security.ParseRedactMode(cfg.RedactMode)
+	redactedHandler := security.NewRedactedHandler(baseHandler, security.WithRedactMode(mode))
 
 	logger := slog.New(redactedHandler)
 	slog.SetDefault(logger)
 
-	return logger
+	return logger, file
 }
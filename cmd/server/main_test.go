@@ -5,8 +5,11 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -14,8 +17,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/config"
 	"github.com/hpn/hpn-g-router/internal/domain"
 	"github.com/hpn/hpn-g-router/internal/handler"
+	"github.com/hpn/hpn-g-router/internal/testutil"
 )
 
 // Constants for test API keys (from test_api_key.txt)
@@ -34,94 +39,35 @@ const (
 // ============================================================================
 
 // setupMockProvider creates an httptest server that simulates Google Gemini API behavior.
-// It returns different HTTP responses based on the Authorization header:
+// It returns different HTTP responses based on the ?key= query parameter:
 //   - KEY_1 → 429 Too Many Requests (Rate Limited)
 //   - KEY_2 → 500 Internal Server Error (Server Error)
 //   - REAL_API_KEY → 200 OK with valid Gemini response
 //   - FAKE_API_KEY → 401 Unauthorized (Invalid API Key)
+//   - any other key → 401 Unauthorized
 func setupMockProvider(t *testing.T) *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract API key from query parameter (Gemini uses ?key=XXX)
-		apiKey := r.URL.Query().Get("key")
-
-		t.Logf("[MOCK PROVIDER] Received request with API key: %s", maskKey(apiKey))
-
-		// Simulate different provider responses based on API key
-		switch apiKey {
-		case TEST_KEY_1:
-			// Simulate rate limiting (429)
-			t.Logf("[MOCK PROVIDER] Returning 429 for KEY_1")
-			w.WriteHeader(http.StatusTooManyRequests)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": map[string]interface{}{
-					"code":    429,
-					"message": "Resource has been exhausted (e.g. check quota).",
-					"status":  "RESOURCE_EXHAUSTED",
-				},
-			})
-
-		case TEST_KEY_2:
-			// Simulate server error (500)
-			t.Logf("[MOCK PROVIDER] Returning 500 for KEY_2")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": map[string]interface{}{
-					"code":    500,
-					"message": "Internal server error",
-					"status":  "INTERNAL",
-				},
-			})
-
-		case REAL_API_KEY:
-			// Simulate successful response (200)
-			t.Logf("[MOCK PROVIDER] Returning 200 for REAL_KEY")
-			w.WriteHeader(http.StatusOK)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"candidates": []map[string]interface{}{
-					{
-						"content": map[string]interface{}{
-							"parts": []map[string]interface{}{
-								{"text": "Hello! I'm working correctly with the real API key."},
-							},
-							"role": "model",
-						},
-						"finishReason": "STOP",
-						"index":        0,
-					},
-				},
-				"usageMetadata": map[string]interface{}{
-					"promptTokenCount":     10,
-					"candidatesTokenCount": 15,
-					"totalTokenCount":      25,
-				},
-			})
-
-		case FAKE_API_KEY:
-			// Simulate invalid API key (401)
-			t.Logf("[MOCK PROVIDER] Returning 401 for FAKE_KEY")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": map[string]interface{}{
-					"code":    401,
-					"message": "API key not valid. Please pass a valid API key.",
-					"status":  "UNAUTHENTICATED",
-				},
-			})
-
-		default:
-			// Unknown key
-			t.Logf("[MOCK PROVIDER] Returning 401 for unknown key: %s", maskKey(apiKey))
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": map[string]interface{}{
-					"code":    401,
-					"message": "API key not valid",
-					"status":  "UNAUTHENTICATED",
-				},
-			})
-		}
-	}))
+	t.Helper()
+	mock := testutil.NewConfigurableMockProvider(testutil.MockBehavior{
+		StatusCode:   http.StatusUnauthorized,
+		ResponseBody: testutil.GeminiErrorBody(http.StatusUnauthorized, "API key not valid"),
+	})
+	ctl := mock.Control()
+	ctl.SetKey(TEST_KEY_1, testutil.MockBehavior{
+		StatusCode:   http.StatusTooManyRequests,
+		ResponseBody: testutil.GeminiErrorBody(http.StatusTooManyRequests, "Resource has been exhausted (e.g. check quota)."),
+	})
+	ctl.SetKey(TEST_KEY_2, testutil.MockBehavior{
+		StatusCode:   http.StatusInternalServerError,
+		ResponseBody: testutil.GeminiErrorBody(http.StatusInternalServerError, "Internal server error"),
+	})
+	ctl.SetKey(REAL_API_KEY, testutil.MockBehavior{
+		ResponseBody: testutil.GeminiResponseBody("Hello! I'm working correctly with the real API key."),
+	})
+	ctl.SetKey(FAKE_API_KEY, testutil.MockBehavior{
+		StatusCode:   http.StatusUnauthorized,
+		ResponseBody: testutil.GeminiErrorBody(http.StatusUnauthorized, "API key not valid. Please pass a valid API key."),
+	})
+	return httptest.NewServer(mock)
 }
 
 // setupRouter creates a Gin router configured with the ProxyHandler and middleware.
@@ -136,146 +82,23 @@ func setupRouter(keyManager *domain.KeyManager, mockBaseURL string) *gin.Engine
 	router.Use(handler.CORSMiddleware())
 	router.Use(handler.StripAuthHeadersMiddleware())
 
-	// Create ProxyHandler with custom adapter options
+	// Create ProxyHandler pointing its per-request adapters at the mock provider
 	// Note: We pass nil as adapter because it's created per-request with the rotated key
 	proxyHandler := handler.NewProxyHandler(
 		keyManager,
 		nil,
 		handler.WithMaxRetries(3),
+		handler.WithBaseURL(mockBaseURL),
 	)
 
-	// We need to customize the handler to use our mock base URL
-	// This is done by wrapping the handler with custom logic
-	customHandler := createCustomProxyHandler(keyManager, mockBaseURL)
-
 	// Register routes (same as production)
-	router.POST("/v1/chat/completions", customHandler)
+	router.POST("/v1/chat/completions", proxyHandler.HandleChatCompletion)
 	router.GET("/v1/models", proxyHandler.HandleModels)
 	router.GET("/health", proxyHandler.HandleHealth)
 
 	return router
 }
 
-// createCustomProxyHandler creates a custom handler that uses the mock base URL.
-// This is necessary because the production handler creates adapters with the default Gemini URL.
-func createCustomProxyHandler(keyManager *domain.KeyManager, mockBaseURL string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Parse OpenAI-compatible request
-		var req adapter.OpenAIRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": gin.H{
-					"message": "Invalid request body: " + err.Error(),
-					"type":    "invalid_request_error",
-				},
-			})
-			return
-		}
-
-		// Validate request
-		if len(req.Messages) == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": gin.H{
-					"message": "messages array is required",
-					"type":    "invalid_request_error",
-				},
-			})
-			return
-		}
-
-		// Execute with retry logic (max 3 attempts)
-		var lastErr error
-		maxRetries := 3
-
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			// Get next key from KeyManager
-			key, err := keyManager.GetNextKey()
-			if err != nil {
-				c.JSON(http.StatusServiceUnavailable, gin.H{
-					"error": gin.H{
-						"message": "No API keys available",
-						"type":    "server_error",
-					},
-				})
-				return
-			}
-
-			// Create adapter with mock base URL
-			geminiAdapter := adapter.NewGeminiAdapter(
-				key,
-				adapter.WithBaseURL(mockBaseURL),
-			)
-
-			// Execute request
-			resp, err := geminiAdapter.ChatCompletion(c.Request.Context(), req)
-			if err == nil {
-				// Success!
-				c.Set("attempts", attempt)
-				c.JSON(http.StatusOK, resp)
-				return
-			}
-
-			// Check if error is retryable
-			if isRetryableError(err) {
-				// Mark key as dead and retry with next key
-				keyManager.MarkAsDead(key)
-				lastErr = err
-				continue
-			}
-
-			// Non-retryable error
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": gin.H{
-					"message": err.Error(),
-					"type":    "invalid_request_error",
-				},
-			})
-			return
-		}
-
-		// All retries exhausted
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": gin.H{
-				"message": "Service temporarily unavailable. Please try again later.",
-				"type":    "server_error",
-			},
-		})
-		_ = lastErr // Silence unused variable warning
-	}
-}
-
-// isRetryableError determines if an error should trigger a retry.
-func isRetryableError(err error) bool {
-	errStr := err.Error()
-	// Check for rate limiting (429)
-	if strings.Contains(errStr, "429") || strings.Contains(errStr, "rate limit") {
-		return true
-	}
-	// Check for server errors (5xx)
-	if strings.Contains(errStr, "500") ||
-		strings.Contains(errStr, "502") ||
-		strings.Contains(errStr, "503") ||
-		strings.Contains(errStr, "504") {
-		return true
-	}
-	// Check for quota exhausted
-	if strings.Contains(errStr, "quota") || strings.Contains(errStr, "exhausted") {
-		return true
-	}
-	return false
-}
-
-// maskKey returns a masked version of the API key for logging (first 8 chars + last 4 chars).
-func maskKey(key string) string {
-	if key == "" {
-		return ""
-	}
-	if len(key) <= 12 {
-		return "***"
-	}
-	return key[:8] + "..." + key[len(key)-4:]
-}
-
 // ============================================================================
 // TEST SCENARIOS
 // ============================================================================
@@ -610,3 +433,59 @@ func TestModelsEndpoint(t *testing.T) {
 
 	t.Log("\n=== TEST PASSED: Models Endpoint ===")
 }
+
+func TestSetupLogger_OutputFile(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "router.log")
+	configPath := filepath.Join(dir, "config.yaml")
+	yaml := `
+logging:
+  level: info
+  output_path: "` + logPath + `"
+  max_size_mb: 10
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`
+	if err := os.WriteFile(configPath, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(config.EnvAPIKeys, "")
+	config.ResetConfig()
+	t.Cleanup(config.ResetConfig)
+	cfg, err := config.GetConfigWithPath(configPath)
+	if err != nil {
+		t.Fatalf("GetConfigWithPath() error = %v", err)
+	}
+
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	logger, logFile := setupLogger(cfg.Logging)
+	if logFile == nil {
+		t.Fatal("setupLogger() returned no log file for logging.output_path")
+	}
+	logger.Info("router started")
+	logger.Debug("below the configured level")
+	if err := logFile.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("log file has %d lines, want 1:\n%s", len(lines), data)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v: %s", err, lines[0])
+	}
+	if entry["msg"] != "router started" || entry["level"] != "INFO" {
+		t.Errorf("log entry = %v, want msg=router started level=INFO", entry)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import "github.com/hpn/hpn-g-router/internal/handler"
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.Version=$(git describe --tags) -X main.GitCommit=$(git rev-parse --short HEAD) -X main.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// as done by `make build`.
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildTime = "unknown"
+)
+
+// buildInfo returns the build information of the running binary.
+func buildInfo() handler.BuildInfo {
+	return handler.BuildInfo{Version: Version, GitCommit: GitCommit, BuildTime: BuildTime}
+}
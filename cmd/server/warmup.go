@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/config"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// warmUpTimeout bounds the warm-up of a single key.
+const warmUpTimeout = 10 * time.Second
+
+// keyWarmer is an adapter that can check its key with the provider.
+type keyWarmer interface {
+	WarmUp(ctx context.Context, models []string) error
+}
+
+// warmUpKeys runs the provider warm-up for every active key before the
+// server starts, logging the outcome per key. Keys that fail are marked dead
+// so the first requests do not land on them. Keys newAdapter returns nil for
+// are skipped. It returns the number of keys that failed.
+func warmUpKeys(ctx context.Context, km *domain.KeyManager, newAdapter func(key string) keyWarmer, models []string, logger *slog.Logger) int {
+	failed := 0
+	for _, key := range km.GetActiveKeys() {
+		attrs := []any{
+			slog.String("key_name", km.KeyName(key)),
+			slog.String("fingerprint", domain.KeyFingerprint(key)),
+		}
+		a := newAdapter(key)
+		if a == nil {
+			logger.Info("key warm-up skipped, provider not supported", attrs...)
+			continue
+		}
+
+		keyCtx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+		start := time.Now()
+		err := a.WarmUp(keyCtx, models)
+		cancel()
+		if err != nil {
+			failed++
+			logger.Warn("key warm-up failed, marking dead", append(attrs, slog.String("error", err.Error()))...)
+			km.MarkAsDead(key, err.Error())
+			continue
+		}
+		logger.Info("key warm-up ok", append(attrs, slog.Duration("latency", time.Since(start)))...)
+	}
+	return failed
+}
+
+// warmUpAdapter returns the adapter warmUpKeys checks a key with: Gemini
+// for Google keys, at the key's regional base URL when it has one, and
+// OpenAI for OpenAI keys. Other providers get nil.
+func warmUpAdapter(cfg *config.Configuration, km *domain.KeyManager, client *http.Client, baseURLs *domain.ProviderBaseURLRegistry) func(key string) keyWarmer {
+	openAIBaseURL := adapter.DefaultOpenAIBaseURL
+	for _, p := range cfg.Providers {
+		if p.Type == domain.ProviderOpenAI && p.Enabled {
+			openAIBaseURL = p.BaseURL
+			break
+		}
+	}
+
+	return func(key string) keyWarmer {
+		switch km.KeyProvider(key) {
+		case domain.ProviderGoogle, "":
+			baseURL := adapter.WithBaseURLProvider(baseURLs.For(domain.ProviderGoogle))
+			if u := km.KeyBaseURL(key); u != "" {
+				baseURL = adapter.WithBaseURL(u)
+			}
+			return adapter.NewGeminiAdapter(key, adapter.WithHTTPClient(client), baseURL)
+		case domain.ProviderOpenAI:
+			return adapter.NewOpenAIAdapter(key, adapter.WithOpenAIBaseURL(openAIBaseURL), adapter.WithOpenAIHTTPClient(client))
+		}
+		return nil
+	}
+}
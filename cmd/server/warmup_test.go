@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestWarmUpKeys(t *testing.T) {
+	const (
+		goodKey    = "AIzaSyWarmUpGoodKey000000001"
+		revokedKey = "AIzaSyWarmUpRevokedKey00002"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/models/gemini-1.5-flash:countTokens") {
+			t.Errorf("unexpected warm-up request %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("key") == revokedKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":401,"message":"API key not valid","status":"UNAUTHENTICATED"}}`))
+			return
+		}
+		w.Write([]byte(`{"totalTokens":1}`))
+	}))
+	defer server.Close()
+
+	km := domain.NewKeyManager([]string{goodKey, revokedKey}, time.Hour,
+		domain.WithKeyNames(map[string]string{goodKey: "good", revokedKey: "revoked"}))
+	newAdapter := func(key string) keyWarmer {
+		return adapter.NewGeminiAdapter(key, adapter.WithBaseURL(server.URL))
+	}
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	if failed := warmUpKeys(context.Background(), km, newAdapter, []string{"gemini-1.5-flash"}, logger); failed != 1 {
+		t.Errorf("warmUpKeys() = %d, want 1", failed)
+	}
+	if !km.IsKeyDead(revokedKey) {
+		t.Error("key rejected with 401 is not marked dead")
+	}
+	if km.IsKeyDead(goodKey) {
+		t.Error("working key is marked dead")
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, "key_name=revoked") || !strings.Contains(out, "key_name=good") {
+		t.Errorf("log = %q, want a line per key", out)
+	}
+	if strings.Contains(out, revokedKey) || strings.Contains(out, goodKey) {
+		t.Errorf("log = %q, want no raw keys", out)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/config"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+// Key check statuses.
+const (
+	statusOK      = "ok"
+	statusSkipped = "skipped"
+)
+
+// keyCheck is the outcome of checking one key.
+type keyCheck struct {
+	name     string
+	provider domain.ProviderType
+	status   string
+	latency  time.Duration
+	err      error
+}
+
+// healthChecker is an adapter that can check its key with the provider.
+type healthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// checkKeys runs the provider health check for every active key, prints a
+// table of the results to out and reports whether every check passed. Keys
+// of providers the command cannot check are listed as skipped.
+func checkKeys(cfg *config.Configuration, timeout time.Duration, out io.Writer) bool {
+	client := &http.Client{Timeout: timeout}
+	openAIBaseURL := adapter.DefaultOpenAIBaseURL
+	for _, p := range cfg.Providers {
+		if p.Type == domain.ProviderOpenAI && p.Enabled {
+			openAIBaseURL = p.BaseURL
+			break
+		}
+	}
+
+	var checks []keyCheck
+	for _, k := range cfg.GetActiveKeys() {
+		c := keyCheck{name: k.Name, provider: k.Provider}
+		if c.name == "" {
+			c.name = security.MaskKey(k.Key)
+		}
+
+		var check healthChecker
+		switch k.Provider {
+		case domain.ProviderGoogle:
+			baseURL := cfg.Provider.Google.BaseURL
+			if k.BaseURL != "" {
+				baseURL = k.BaseURL
+			}
+			check = adapter.NewGeminiAdapter(k.Key, adapter.WithBaseURL(baseURL), adapter.WithHTTPClient(client))
+		case domain.ProviderOpenAI:
+			check = adapter.NewOpenAIAdapter(k.Key, adapter.WithOpenAIBaseURL(openAIBaseURL), adapter.WithOpenAIHTTPClient(client))
+		}
+
+		if check == nil {
+			c.status = statusSkipped
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			start := time.Now()
+			c.err = check.HealthCheck(ctx)
+			c.latency = time.Since(start)
+			cancel()
+			c.status = checkStatus(c.err)
+		}
+		checks = append(checks, c)
+	}
+
+	printChecks(out, checks)
+
+	failed := 0
+	for _, c := range checks {
+		if c.err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(out, "✗ %d of %d key checks failed\n", failed, len(checks))
+		for _, c := range checks {
+			if c.err != nil {
+				fmt.Fprintf(out, "  - %s: %v\n", c.name, c.err)
+			}
+		}
+		return false
+	}
+	fmt.Fprintf(out, "✓ All key checks passed\n")
+	return true
+}
+
+// checkStatus summarizes a check error for the table: the provider's HTTP
+// status, "timeout" or "unreachable".
+func checkStatus(err error) string {
+	var adapterErr *adapter.AdapterError
+	var timeoutErr interface{ Timeout() bool }
+	switch {
+	case err == nil:
+		return statusOK
+	case errors.As(err, &adapterErr):
+		return "error " + strconv.Itoa(adapterErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &timeoutErr) && timeoutErr.Timeout():
+		return "timeout"
+	default:
+		return "unreachable"
+	}
+}
+
+// printChecks writes checks to out as a table with aligned columns.
+func printChecks(out io.Writer, checks []keyCheck) {
+	rows := [][]string{{"key_name", "provider", "status", "latency_ms"}}
+	for _, c := range checks {
+		latency := "-"
+		if c.status != statusSkipped {
+			latency = strconv.FormatInt(c.latency.Milliseconds(), 10)
+		}
+		rows = append(rows, []string{c.name, string(c.provider), c.status, latency})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = fmt.Sprintf("%-*s", widths[i], cell)
+		}
+		fmt.Fprintln(out, strings.TrimRight(strings.Join(cells, " | "), " "))
+	}
+}
@@ -0,0 +1,98 @@
+// Command validate checks a router config file the way the server would load
+// it, so CI can reject a bad config before it is deployed.
+//
+// Usage:
+//
+//	validate [-config configs/config.yaml] [-dry-run] [-timeout 10s]
+//
+// The path defaults to $HPN_ROUTER_CONFIG, then to the server's config search
+// paths. Environment overrides such as HPN_API_KEYS apply as they do for the
+// server. With -dry-run every active key of a provider the command can check
+// is checked with its adapter's HealthCheck, which lists the provider's
+// models with the key. Each check is bounded by -timeout.
+//
+// The exit code is 0 for a valid config whose checks all passed, 1 when
+// validation fails, 2 when the file cannot be read or parsed and 3 when a
+// key check fails.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/config"
+)
+
+// EnvConfigPath names the config file when -config is not given.
+const EnvConfigPath = "HPN_ROUTER_CONFIG"
+
+// recommendedKeys is the fewest active keys that leave room for failover.
+const recommendedKeys = 3
+
+// Exit codes.
+const (
+	exitValid       = 0
+	exitInvalid     = 1
+	exitParse       = 2
+	exitUnreachable = 3
+)
+
+// DefaultCheckTimeout bounds each key check made with -dry-run.
+const DefaultCheckTimeout = 10 * time.Second
+
+// options holds the flags besides the config path.
+type options struct {
+	// dryRun checks every active key against its provider.
+	dryRun bool
+
+	// timeout bounds each key check.
+	timeout time.Duration
+}
+
+func main() {
+	path := flag.String("config", os.Getenv(EnvConfigPath), "config file to validate")
+	var opts options
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "also check that every active key reaches its provider")
+	flag.DurationVar(&opts.timeout, "timeout", DefaultCheckTimeout, "timeout for each key check")
+	flag.Parse()
+
+	os.Exit(run(*path, opts, os.Stdout))
+}
+
+// run loads the config at path, reports the result to out and returns the
+// exit code.
+func run(path string, opts options, out io.Writer) int {
+	cfg, err := config.GetConfigWithPath(path)
+	if err != nil {
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			fmt.Fprintf(out, "✗ Config invalid: %d error(s)\n", len(verr.Errors))
+			for _, fe := range verr.Errors {
+				if fe.Value != "" {
+					fmt.Fprintf(out, "  - %s %s (got %q)\n", fe.Field, fe.Message, fe.Value)
+				} else {
+					fmt.Fprintf(out, "  - %s %s\n", fe.Field, fe.Message)
+				}
+			}
+			return exitInvalid
+		}
+		fmt.Fprintf(out, "✗ Config could not be loaded: %v\n", err)
+		return exitParse
+	}
+
+	active := len(cfg.GetActiveKeys())
+	fmt.Fprintf(out, "✓ Config valid: %d active keys, strategy=%s, port=%d\n",
+		active, cfg.KeyPool.Strategy, cfg.Server.Port)
+	if active < recommendedKeys {
+		fmt.Fprintf(out, "[WARN] Only %d keys active, recommend at least %d\n", active, recommendedKeys)
+	}
+
+	if opts.dryRun && !checkKeys(cfg, opts.timeout, out) {
+		return exitUnreachable
+	}
+	return exitValid
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// binary is the command built by TestMain. go run reports every failure as
+// exit code 1, so the tests run a built binary to see the real code.
+var binary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "validate")
+	if err != nil {
+		panic(err)
+	}
+	binary = filepath.Join(dir, "validate")
+	if out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		panic(fmt.Sprintf("go build: %v\n%s", err, out))
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// runValidate runs the command with args and returns its output and exit code.
+func runValidate(t *testing.T, env []string, args ...string) (string, int) {
+	t.Helper()
+
+	cmd := exec.Command(binary, args...)
+	// Keys from the environment would replace the ones in the test configs.
+	cmd.Env = append(os.Environ(), "HPN_API_KEYS=")
+	cmd.Env = append(cmd.Env, env...)
+	var stdout strings.Builder
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return stdout.String(), 0
+	case errors.As(err, &exitErr):
+		return stdout.String(), exitErr.ExitCode()
+	default:
+		t.Fatalf("run %s error = %v", binary, err)
+		return "", 0
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      []string
+		wantCode int
+		want     []string
+		dontWant []string
+	}{
+		{
+			name:     "valid",
+			args:     []string{"--config=testdata/valid_config.yaml"},
+			wantCode: exitValid,
+			want:     []string{"✓ Config valid: 3 active keys, strategy=round-robin, port=9090"},
+			dontWant: []string{"[WARN]"},
+		},
+		{
+			name:     "path from env",
+			env:      []string{EnvConfigPath + "=testdata/valid_config.yaml"},
+			wantCode: exitValid,
+			want:     []string{"✓ Config valid: 3 active keys"},
+		},
+		{
+			name:     "too few keys",
+			args:     []string{"--config=testdata/few_keys_config.yaml"},
+			wantCode: exitValid,
+			want:     []string{"✓ Config valid: 1 active keys", "[WARN] Only 1 keys active, recommend at least 3"},
+		},
+		{
+			name:     "invalid",
+			args:     []string{"--config=testdata/invalid_config.yaml"},
+			wantCode: exitInvalid,
+			want: []string{
+				"✗ Config invalid: 2 error(s)",
+				`server.port must be between 1 and 65535 (got "70000")`,
+				`key_pool.strategy`,
+			},
+		},
+		{
+			name:     "malformed",
+			args:     []string{"--config=testdata/malformed_config.yaml"},
+			wantCode: exitParse,
+			want:     []string{"✗ Config could not be loaded"},
+		},
+		{
+			name:     "missing file",
+			args:     []string{"--config=testdata/does_not_exist.yaml"},
+			wantCode: exitParse,
+			want:     []string{"✗ Config could not be loaded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, code := runValidate(t, tt.env, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d\n%s", code, tt.wantCode, out)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("output missing %q:\n%s", w, out)
+				}
+			}
+			for _, w := range tt.dontWant {
+				if strings.Contains(out, w) {
+					t.Errorf("output contains %q:\n%s", w, out)
+				}
+			}
+		})
+	}
+}
+
+// newProviderMocks starts a Gemini and an OpenAI mock that accept keys
+// starting with "good" and answer after delay.
+func newProviderMocks(t *testing.T, delay time.Duration) (gemini, openAI *httptest.Server) {
+	t.Helper()
+	gemini = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if r.Method != http.MethodGet || r.URL.Path != "/models" {
+			http.NotFound(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Query().Get("key"), "good") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"API key not valid","status":"INVALID_ARGUMENT"}}`))
+			return
+		}
+		w.Write([]byte(`{"models":[{"name":"models/gemini-1.5-flash"}]}`))
+	}))
+	openAI = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer good") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error"}}`))
+			return
+		}
+		w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4","object":"model"}]}`))
+	}))
+	t.Cleanup(gemini.Close)
+	t.Cleanup(openAI.Close)
+	return gemini, openAI
+}
+
+// writeDryRunConfig writes a config with a Google, an OpenAI and an
+// Anthropic key, using googleKey and openAIKey for the first two.
+func writeDryRunConfig(t *testing.T, gemini, openAI *httptest.Server, googleKey, openAIKey string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := `
+provider:
+  google:
+    base_url: "` + gemini.URL + `"
+providers:
+  - name: OpenAI
+    type: openai
+    base_url: "` + openAI.URL + `/v1"
+    enabled: true
+key_pool:
+  keys:
+    - name: gemini-primary
+      key: "` + googleKey + `"
+      provider: google
+      enabled: true
+    - name: openai-primary
+      key: "` + openAIKey + `"
+      provider: openai
+      enabled: true
+    - key: "sk-ant-TestKey000000000001"
+      provider: anthropic
+      enabled: true
+`
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate_DryRun(t *testing.T) {
+	gemini, openAI := newProviderMocks(t, 0)
+	slowGemini, slowOpenAI := newProviderMocks(t, 500*time.Millisecond)
+
+	tests := []struct {
+		name     string
+		config   string
+		timeout  string
+		wantCode int
+		wantRows []string
+		want     []string
+	}{
+		{
+			name:     "all reachable",
+			config:   writeDryRunConfig(t, gemini, openAI, "goodGoogleKey000000000001", "goodOpenAIKey00000000001"),
+			timeout:  "10s",
+			wantCode: exitValid,
+			wantRows: []string{
+				`^key_name +\| provider +\| status +\| latency_ms$`,
+				`^gemini-primary +\| google +\| ok +\| \d+$`,
+				`^openai-primary +\| openai +\| ok +\| \d+$`,
+				`^sk-ant-T\.\.\.0001 +\| anthropic +\| skipped +\| -$`,
+			},
+			want: []string{"✓ All key checks passed"},
+		},
+		{
+			name:     "rejected keys",
+			config:   writeDryRunConfig(t, gemini, openAI, "badGoogleKey0000000000001", "badOpenAIKey000000000001"),
+			timeout:  "10s",
+			wantCode: exitUnreachable,
+			wantRows: []string{
+				`^gemini-primary +\| google +\| error 400 +\| \d+$`,
+				`^openai-primary +\| openai +\| error 401 +\| \d+$`,
+			},
+			want: []string{"✗ 2 of 3 key checks failed", "gemini-primary: provider API error [400 INVALID_ARGUMENT]"},
+		},
+		{
+			name:     "timeout",
+			config:   writeDryRunConfig(t, slowGemini, slowOpenAI, "goodGoogleKey000000000001", "goodOpenAIKey00000000001"),
+			timeout:  "50ms",
+			wantCode: exitUnreachable,
+			wantRows: []string{
+				`^gemini-primary +\| google +\| timeout +\| \d+$`,
+				`^openai-primary +\| openai +\| timeout +\| \d+$`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, code := runValidate(t, nil, "--config="+tt.config, "--dry-run", "--timeout="+tt.timeout)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d\n%s", code, tt.wantCode, out)
+			}
+			for _, row := range tt.wantRows {
+				if !regexp.MustCompile("(?m)" + row).MatchString(out) {
+					t.Errorf("output has no row matching %s:\n%s", row, out)
+				}
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("output missing %q:\n%s", w, out)
+				}
+			}
+			for _, key := range []string{"goodGoogleKey000000000001", "badOpenAIKey000000000001"} {
+				if strings.Contains(out, key) {
+					t.Errorf("output leaks key %s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate_WithoutDryRunSkipsChecks(t *testing.T) {
+	gemini, openAI := newProviderMocks(t, 0)
+	config := writeDryRunConfig(t, gemini, openAI, "badGoogleKey0000000000001", "badOpenAIKey000000000001")
+
+	out, code := runValidate(t, nil, "--config="+config)
+	if code != exitValid {
+		t.Errorf("exit code = %d, want %d\n%s", code, exitValid, out)
+	}
+	if strings.Contains(out, "key_name") {
+		t.Errorf("output has a key table without --dry-run:\n%s", out)
+	}
+}
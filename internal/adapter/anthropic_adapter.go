@@ -0,0 +1,507 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAnthropicBaseURL is the default Anthropic API endpoint.
+	DefaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+
+	// AnthropicVersion is the API version sent as anthropic-version for
+	// models before Claude 3.5, unless WithAnthropicVersion sets another.
+	AnthropicVersion = "2023-06-01"
+
+	// AnthropicVersionClaude35 is the API version sent for Claude 3.5 and
+	// later models, unless WithAnthropicVersion sets another.
+	AnthropicVersionClaude35 = "2024-01-01"
+
+	// AnthropicCapabilityTools marks API versions that accept tools.
+	AnthropicCapabilityTools = "tools"
+
+	// AnthropicToolsBeta is the beta feature that enables tool use. It is
+	// added to the anthropic-beta header of every request that has tools.
+	AnthropicToolsBeta = "tools-2024-04-04"
+
+	// DefaultAnthropicMaxTokens is sent as max_tokens, which Anthropic
+	// requires, when the request sets no limit.
+	DefaultAnthropicMaxTokens = 4096
+)
+
+// AnthropicVersionCapabilities lists the features of each anthropic-version.
+// A request using a feature its version lacks fails before it is sent;
+// versions missing from the map are not checked.
+var AnthropicVersionCapabilities = map[string][]string{
+	"2023-01-01":             {},
+	AnthropicVersion:         {AnthropicCapabilityTools},
+	AnthropicVersionClaude35: {AnthropicCapabilityTools},
+}
+
+// AnthropicAdapter implements AIProvider for the Anthropic Messages API. The
+// router does not route requests to Anthropic keys yet.
+type AnthropicAdapter struct {
+	apiKey       string
+	baseURL      string
+	httpClient   *http.Client
+	betaFeatures []string
+	version      string
+	apiVersion   string
+}
+
+// AnthropicAdapterOption is a functional option for configuring AnthropicAdapter.
+type AnthropicAdapterOption func(*AnthropicAdapter)
+
+// WithAnthropicBaseURL sets a custom base URL for the Anthropic API.
+func WithAnthropicBaseURL(url string) AnthropicAdapterOption {
+	return func(a *AnthropicAdapter) {
+		a.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithAnthropicHTTPClient sets the HTTP client requests are sent with.
+func WithAnthropicHTTPClient(client *http.Client) AnthropicAdapterOption {
+	return func(a *AnthropicAdapter) {
+		a.httpClient = client
+	}
+}
+
+// WithAnthropicBetaFeatures sends features in the anthropic-beta header of
+// every request. AnthropicToolsBeta is added for requests with tools.
+func WithAnthropicBetaFeatures(features ...string) AnthropicAdapterOption {
+	return func(a *AnthropicAdapter) {
+		a.betaFeatures = append(a.betaFeatures, features...)
+	}
+}
+
+// WithAnthropicVersion sends v as anthropic-version for every model instead
+// of choosing AnthropicVersion or AnthropicVersionClaude35 by model.
+func WithAnthropicVersion(v string) AnthropicAdapterOption {
+	return func(a *AnthropicAdapter) { a.apiVersion = v }
+}
+
+// WithAnthropicRouterVersion sets the router version that goes into the
+// system_fingerprint of responses.
+func WithAnthropicRouterVersion(v string) AnthropicAdapterOption {
+	return func(a *AnthropicAdapter) { a.version = v }
+}
+
+// NewAnthropicAdapter creates a new AnthropicAdapter with the given API key.
+func NewAnthropicAdapter(apiKey string, opts ...AnthropicAdapterOption) *AnthropicAdapter {
+	a := &AnthropicAdapter{
+		apiKey:     apiKey,
+		baseURL:    DefaultAnthropicBaseURL,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Name returns the provider identifier.
+func (a *AnthropicAdapter) Name() string {
+	return "anthropic"
+}
+
+// ChatCompletion translates req to a Messages API request, sends it and
+// translates the answer back. Tools become Anthropic tools and tool_use
+// blocks in the answer become tool calls.
+func (a *AnthropicAdapter) ChatCompletion(ctx context.Context, req OpenAIRequest) (OpenAIResponse, error) {
+	if req.Logprobs {
+		return OpenAIResponse{}, &LogprobsNotSupportedError{Provider: "Anthropic"}
+	}
+	version := a.apiVersionFor(req.Model)
+	if len(req.Tools) > 0 && !anthropicVersionSupports(version, AnthropicCapabilityTools) {
+		return OpenAIResponse{}, &ToolsNotSupportedError{Provider: "Anthropic", Version: version}
+	}
+
+	anthropicReq, err := mapToAnthropicRequest(req)
+	if err != nil {
+		return OpenAIResponse{}, err
+	}
+	body, err := json.Marshal(anthropicReq)
+	if err != nil {
+		return OpenAIResponse{}, fmt.Errorf("failed to marshal anthropic request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return OpenAIResponse{}, fmt.Errorf("failed to create http request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	a.setHeaders(httpReq, version, len(req.Tools) > 0)
+
+	var resp AnthropicResponse
+	if err := a.do(httpReq, &resp); err != nil {
+		return OpenAIResponse{}, err
+	}
+	return a.mapToOpenAIResponse(resp, req.Model)
+}
+
+// HealthCheck lists the models the key can use and returns nil when
+// Anthropic answers 200. Other answers are returned as *AdapterError.
+func (a *AnthropicAdapter) HealthCheck(ctx context.Context) error {
+	_, err := a.ListModels(ctx)
+	return err
+}
+
+// ListModels returns the IDs of the models the key can use, from GET
+// /models. Non-200 responses are returned as *AdapterError.
+func (a *AnthropicAdapter) ListModels(ctx context.Context) ([]string, error) {
+	var ids []string
+	afterID := ""
+	for {
+		endpoint := fmt.Sprintf("%s/models?limit=%d", a.baseURL, anthropicModelPageSize)
+		if afterID != "" {
+			endpoint += "&after_id=" + url.QueryEscape(afterID)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create http request: %w", err)
+		}
+		a.setHeaders(httpReq, a.apiVersionFor(""), false)
+
+		var list AnthropicModelList
+		if err := a.do(httpReq, &list); err != nil {
+			return nil, err
+		}
+		for _, m := range list.Data {
+			ids = append(ids, m.ID)
+		}
+		if !list.HasMore || list.LastID == "" {
+			return ids, nil
+		}
+		afterID = list.LastID
+	}
+}
+
+// anthropicModelPageSize is the most models Anthropic returns per page.
+const anthropicModelPageSize = 1000
+
+// WarmUp is HealthCheck; Anthropic has no cheap per-model check, so models
+// are not checked one by one.
+func (a *AnthropicAdapter) WarmUp(ctx context.Context, _ []string) error {
+	return a.HealthCheck(ctx)
+}
+
+// setHeaders adds the key, API version and beta features to req, with
+// AnthropicToolsBeta when the request has tools.
+func (a *AnthropicAdapter) setHeaders(req *http.Request, version string, tools bool) {
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("anthropic-version", version)
+
+	features := a.betaFeatures
+	if tools && !slices.Contains(features, AnthropicToolsBeta) {
+		features = append(features[:len(features):len(features)], AnthropicToolsBeta)
+	}
+	if len(features) > 0 {
+		req.Header.Set("anthropic-beta", strings.Join(features, ","))
+	}
+}
+
+// apiVersionFor returns the anthropic-version to send for model: the one
+// set with WithAnthropicVersion, else AnthropicVersionClaude35 for Claude 3.5
+// and later models and AnthropicVersion for older ones.
+func (a *AnthropicAdapter) apiVersionFor(model string) string {
+	if a.apiVersion != "" {
+		return a.apiVersion
+	}
+	if major, minor := claudeVersion(model); major > 3 || major == 3 && minor >= 5 {
+		return AnthropicVersionClaude35
+	}
+	return AnthropicVersion
+}
+
+// claudeVersion returns the major and minor version of a Claude model name,
+// e.g. 3 and 5 for claude-3-5-sonnet-20240620 and 4 and 0 for
+// claude-sonnet-4-20250514. Dates are skipped; unversioned names give 0, 0.
+func claudeVersion(model string) (major, minor int) {
+	parts := strings.FieldsFunc(strings.ToLower(model), func(r rune) bool { return r == '-' || r == '.' })
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || len(part) > 2 {
+			continue
+		}
+		if i+1 < len(parts) && len(parts[i+1]) <= 2 {
+			minor, _ = strconv.Atoi(parts[i+1])
+		}
+		return n, minor
+	}
+	return 0, 0
+}
+
+// anthropicVersionSupports reports whether AnthropicVersionCapabilities
+// lists capability for version. Unknown versions support everything.
+func anthropicVersionSupports(version, capability string) bool {
+	capabilities, known := AnthropicVersionCapabilities[version]
+	return !known || slices.Contains(capabilities, capability)
+}
+
+// do sends req and decodes a successful response into out, if it is not
+// nil. Non-200 responses are returned as *AdapterError.
+func (a *AnthropicAdapter) do(req *http.Request, out interface{}) error {
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute anthropic request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read anthropic response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var anthropicErr AnthropicErrorResponse
+		if err := json.Unmarshal(body, &anthropicErr); err == nil && anthropicErr.Error.Message != "" {
+			return newAdapterError(resp.StatusCode, anthropicErr.Error.Type, anthropicErr.Error.Message)
+		}
+		return newAdapterError(resp.StatusCode, "", string(body))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to unmarshal anthropic response: %w", err)
+	}
+	return nil
+}
+
+// mapToAnthropicRequest converts an OpenAI request to Anthropic format.
+// System messages become the system prompt, tool messages become
+// tool_result blocks, and consecutive messages of one role are merged, since
+// Anthropic requires user and assistant turns to alternate.
+func mapToAnthropicRequest(req OpenAIRequest) (AnthropicRequest, error) {
+	out := AnthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     DefaultAnthropicMaxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+	}
+	if req.MaxTokens != nil {
+		out.MaxTokens = *req.MaxTokens
+	}
+	if req.MaxCompletionTokens != nil {
+		out.MaxTokens = *req.MaxCompletionTokens
+	}
+
+	var system []string
+	for _, msg := range req.Messages {
+		role := msg.Role
+		var blocks []AnthropicContentBlock
+		switch msg.Role {
+		case "system":
+			system = append(system, msg.Content)
+			continue
+		case "tool":
+			role = "user"
+			blocks = append(blocks, AnthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			})
+		case "assistant":
+			if msg.Content != "" {
+				blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage("{}")
+				if call.Function.Arguments != "" {
+					if !json.Valid([]byte(call.Function.Arguments)) {
+						return AnthropicRequest{}, fmt.Errorf("tool call %s has invalid JSON arguments", call.ID)
+					}
+					input = json.RawMessage(call.Function.Arguments)
+				}
+				blocks = append(blocks, AnthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+			}
+		default:
+			role = "user"
+			blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: msg.Content})
+		}
+
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+			continue
+		}
+		out.Messages = append(out.Messages, AnthropicMessage{Role: role, Content: blocks})
+	}
+	out.System = strings.Join(system, DefaultSystemPromptSeparator)
+
+	for _, tool := range req.Tools {
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		out.Tools = append(out.Tools, AnthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	return out, nil
+}
+
+// mapToOpenAIResponse converts an Anthropic response to OpenAI format. Text
+// blocks are joined into the message content and tool_use blocks become
+// tool calls.
+func (a *AnthropicAdapter) mapToOpenAIResponse(resp AnthropicResponse, model string) (OpenAIResponse, error) {
+	var text strings.Builder
+	var toolCalls []OpenAIToolCall
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			toolCalls = append(toolCalls, OpenAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: OpenAIFunctionCall{Name: block.Name, Arguments: args},
+			})
+		}
+	}
+
+	id := resp.ID
+	if id == "" {
+		id = fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	}
+	return OpenAIResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []OpenAIChoice{{
+			Index: 0,
+			Message: OpenAIMessage{
+				Role:      "assistant",
+				Content:   text.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: mapAnthropicStopReason(resp.StopReason),
+		}},
+		Usage: OpenAIUsage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+		SystemFingerprint: defaultFingerprints.Generate(a.Name(), resp.Model, a.version),
+		InternalModel:     resp.Model,
+	}, nil
+}
+
+// mapAnthropicStopReason converts an Anthropic stop_reason to an OpenAI
+// finish_reason.
+func mapAnthropicStopReason(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
+
+// Anthropic Messages API types.
+
+// AnthropicRequest represents an Anthropic Messages API request.
+type AnthropicRequest struct {
+	Model         string             `json:"model"`
+	Messages      []AnthropicMessage `json:"messages"`
+	System        string             `json:"system,omitempty"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
+}
+
+// AnthropicMessage is one user or assistant turn.
+type AnthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
+}
+
+// AnthropicContentBlock is a text, tool_use or tool_result block.
+type AnthropicContentBlock struct {
+	Type string `json:"type"`
+
+	// Text is the text of a text block.
+	Text string `json:"text,omitempty"`
+
+	// ID, Name and Input describe a tool_use block.
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// ToolUseID and Content answer a tool_use block in a tool_result block.
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// AnthropicTool describes a tool the model may use.
+type AnthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+// AnthropicResponse represents an Anthropic Messages API response.
+type AnthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Role       string                  `json:"role"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      AnthropicUsage          `json:"usage"`
+}
+
+// AnthropicUsage contains token usage statistics.
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicModelList represents a page of the Anthropic models list.
+type AnthropicModelList struct {
+	Data    []AnthropicModel `json:"data"`
+	HasMore bool             `json:"has_more"`
+	LastID  string           `json:"last_id,omitempty"`
+}
+
+// AnthropicModel is a model in AnthropicModelList.
+type AnthropicModel struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// AnthropicErrorResponse represents an error response from the Anthropic API.
+type AnthropicErrorResponse struct {
+	Error AnthropicErrorDetail `json:"error"`
+}
+
+// AnthropicErrorDetail contains the error details.
+type AnthropicErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,268 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestAnthropicAdapter_ToolRoundTrip(t *testing.T) {
+	var gotReq AnthropicRequest
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/messages" {
+			t.Errorf("request = %s %s, want POST /messages", r.Method, r.URL.Path)
+		}
+		gotHeader = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Write([]byte(`{"id":"msg_01","model":"claude-3-opus-20240229","role":"assistant",
+			"content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"toolu_01","name":"get_weather","input":{"city":"Hanoi"}}],
+			"stop_reason":"tool_use","usage":{"input_tokens":20,"output_tokens":10}}`))
+	}))
+	defer server.Close()
+
+	a := NewAnthropicAdapter("sk-ant-test", WithAnthropicBaseURL(server.URL), WithAnthropicBetaFeatures("max-tokens-3-5-sonnet-2024-07-15"))
+	resp, err := a.ChatCompletion(context.Background(), OpenAIRequest{
+		Model: "claude-3-opus-20240229",
+		Messages: []OpenAIMessage{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Weather in Hanoi?"},
+		},
+		Tools: []OpenAITool{{Type: "function", Function: OpenAIFunctionDefinition{
+			Name:        "get_weather",
+			Description: "Current weather for a city",
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion() error = %v", err)
+	}
+
+	if got, want := gotHeader.Get("anthropic-beta"), "max-tokens-3-5-sonnet-2024-07-15,"+AnthropicToolsBeta; got != want {
+		t.Errorf("anthropic-beta = %q, want %q", got, want)
+	}
+	if got := gotHeader.Get("x-api-key"); got != "sk-ant-test" {
+		t.Errorf("x-api-key = %q, want sk-ant-test", got)
+	}
+	if gotReq.System != "Be brief." || len(gotReq.Messages) != 1 {
+		t.Errorf("system = %q, messages = %+v, want the system prompt split from one user turn", gotReq.System, gotReq.Messages)
+	}
+	if len(gotReq.Tools) != 1 {
+		t.Fatalf("tools = %+v, want one tool", gotReq.Tools)
+	}
+	tool := gotReq.Tools[0]
+	if tool.Name != "get_weather" || tool.Description != "Current weather for a city" || tool.InputSchema["type"] != "object" {
+		t.Errorf("tool = %+v, want get_weather with its description and input_schema", tool)
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", choice.FinishReason)
+	}
+	if choice.Message.Content != "Checking." {
+		t.Errorf("content = %q, want Checking.", choice.Message.Content)
+	}
+	if len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("tool_calls = %+v, want one call", choice.Message.ToolCalls)
+	}
+	call := choice.Message.ToolCalls[0]
+	if call.ID != "toolu_01" || call.Type != "function" || call.Function.Name != "get_weather" {
+		t.Errorf("tool call = %+v, want toolu_01 get_weather", call)
+	}
+	var args map[string]string
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || args["city"] != "Hanoi" {
+		t.Errorf("arguments = %s, want {\"city\":\"Hanoi\"}", call.Function.Arguments)
+	}
+	if resp.Usage.TotalTokens != 30 {
+		t.Errorf("usage.total_tokens = %d, want 30", resp.Usage.TotalTokens)
+	}
+}
+
+func TestAnthropicAdapter_BetaHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		features []string
+		tools    bool
+		want     string
+	}{
+		{"none", nil, false, ""},
+		{"configured", []string{"prompt-caching-2024-07-31"}, false, "prompt-caching-2024-07-31"},
+		{"tools", nil, true, AnthropicToolsBeta},
+		{"tools already configured", []string{AnthropicToolsBeta}, true, AnthropicToolsBeta},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("anthropic-beta")
+				w.Write([]byte(`{"id":"msg_01","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn"}`))
+			}))
+			defer server.Close()
+
+			req := OpenAIRequest{Model: "claude-3-haiku-20240307", Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}}
+			if tt.tools {
+				req.Tools = []OpenAITool{{Type: "function", Function: OpenAIFunctionDefinition{Name: "noop"}}}
+			}
+			a := NewAnthropicAdapter("sk-ant-test", WithAnthropicBaseURL(server.URL), WithAnthropicBetaFeatures(tt.features...))
+			if _, err := a.ChatCompletion(context.Background(), req); err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("anthropic-beta = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapToAnthropicRequest_ToolResults(t *testing.T) {
+	req, err := mapToAnthropicRequest(OpenAIRequest{
+		Model: "claude-3-haiku-20240307",
+		Messages: []OpenAIMessage{
+			{Role: "user", Content: "Weather in Hanoi and Hue?"},
+			{Role: "assistant", ToolCalls: []OpenAIToolCall{
+				{ID: "toolu_01", Type: "function", Function: OpenAIFunctionCall{Name: "get_weather", Arguments: `{"city":"Hanoi"}`}},
+				{ID: "toolu_02", Type: "function", Function: OpenAIFunctionCall{Name: "get_weather", Arguments: `{"city":"Hue"}`}},
+			}},
+			{Role: "tool", ToolCallID: "toolu_01", Content: "31C"},
+			{Role: "tool", ToolCallID: "toolu_02", Content: "29C"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("mapToAnthropicRequest() error = %v", err)
+	}
+
+	if len(req.Messages) != 3 {
+		t.Fatalf("messages = %+v, want user, assistant and one merged user turn", req.Messages)
+	}
+	uses := req.Messages[1].Content
+	if len(uses) != 2 || uses[0].Type != "tool_use" || string(uses[0].Input) != `{"city":"Hanoi"}` {
+		t.Errorf("assistant content = %+v, want two tool_use blocks", uses)
+	}
+	results := req.Messages[2].Content
+	if req.Messages[2].Role != "user" || len(results) != 2 || results[1].ToolUseID != "toolu_02" || results[1].Content != "29C" {
+		t.Errorf("tool results = %+v, want two tool_result blocks in one user turn", req.Messages[2])
+	}
+	if req.MaxTokens != DefaultAnthropicMaxTokens {
+		t.Errorf("max_tokens = %d, want %d", req.MaxTokens, DefaultAnthropicMaxTokens)
+	}
+
+	_, err = mapToAnthropicRequest(OpenAIRequest{Messages: []OpenAIMessage{{Role: "assistant", ToolCalls: []OpenAIToolCall{
+		{ID: "toolu_03", Function: OpenAIFunctionCall{Name: "f", Arguments: "{"}},
+	}}}})
+	if err == nil {
+		t.Error("mapToAnthropicRequest() with invalid arguments error = nil")
+	}
+}
+
+func TestAnthropicAdapter_HealthCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "sk-ant-good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer server.Close()
+
+	if err := NewAnthropicAdapter("sk-ant-good", WithAnthropicBaseURL(server.URL)).HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck() error = %v, want nil", err)
+	}
+	err := NewAnthropicAdapter("sk-ant-bad", WithAnthropicBaseURL(server.URL)).HealthCheck(context.Background())
+	var adapterErr *AdapterError
+	if !errors.As(err, &adapterErr) || adapterErr.StatusCode != http.StatusUnauthorized || adapterErr.ProviderCode != "authentication_error" {
+		t.Errorf("HealthCheck() error = %v, want a 401 authentication_error *AdapterError", err)
+	}
+}
+
+func TestAnthropicAdapter_ListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" || r.Header.Get("x-api-key") != "sk-ant-good" {
+			t.Errorf("request = %s with key %q, want /models with sk-ant-good", r.URL.Path, r.Header.Get("x-api-key"))
+		}
+		if r.URL.Query().Get("after_id") == "" {
+			w.Write([]byte(`{"data":[{"id":"claude-sonnet-4-20250514"}],"has_more":true,"last_id":"claude-sonnet-4-20250514"}`))
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"claude-3-5-haiku-20241022"}],"has_more":false}`))
+	}))
+	defer server.Close()
+
+	ids, err := NewAnthropicAdapter("sk-ant-good", WithAnthropicBaseURL(server.URL)).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if want := []string{"claude-sonnet-4-20250514", "claude-3-5-haiku-20241022"}; !slices.Equal(ids, want) {
+		t.Errorf("ListModels() = %v, want %v", ids, want)
+	}
+}
+
+func TestAnthropicAdapter_VersionHeader(t *testing.T) {
+	tests := []struct {
+		model   string
+		version string
+		want    string
+	}{
+		{"claude-3-haiku-20240307", "", AnthropicVersion},
+		{"claude-2.1", "", AnthropicVersion},
+		{"claude-3-5-sonnet-20240620", "", AnthropicVersionClaude35},
+		{"claude-3-7-sonnet-20250219", "", AnthropicVersionClaude35},
+		{"claude-sonnet-4-20250514", "", AnthropicVersionClaude35},
+		{"claude-3-5-sonnet-20240620", AnthropicVersion, AnthropicVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model+"/"+tt.version, func(t *testing.T) {
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("anthropic-version")
+				w.Write([]byte(`{"id":"msg_01","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn"}`))
+			}))
+			defer server.Close()
+
+			opts := []AnthropicAdapterOption{WithAnthropicBaseURL(server.URL)}
+			if tt.version != "" {
+				opts = append(opts, WithAnthropicVersion(tt.version))
+			}
+			req := OpenAIRequest{Model: tt.model, Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}}
+			if _, err := NewAnthropicAdapter("sk-ant-test", opts...).ChatCompletion(context.Background(), req); err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("anthropic-version = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnthropicAdapter_ToolsNotSupported(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	a := NewAnthropicAdapter("sk-ant-test", WithAnthropicBaseURL(server.URL), WithAnthropicVersion("2023-01-01"))
+	_, err := a.ChatCompletion(context.Background(), OpenAIRequest{
+		Model:    "claude-3-haiku-20240307",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hi"}},
+		Tools:    []OpenAITool{{Type: "function", Function: OpenAIFunctionDefinition{Name: "noop"}}},
+	})
+	var toolsErr *ToolsNotSupportedError
+	if !errors.As(err, &toolsErr) || toolsErr.Version != "2023-01-01" {
+		t.Errorf("ChatCompletion() error = %v, want a *ToolsNotSupportedError for 2023-01-01", err)
+	}
+	if called {
+		t.Error("request sent to Anthropic, want it rejected before")
+	}
+}
@@ -0,0 +1,132 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Error types a ChaosAdapter injects.
+const (
+	ChaosErrorRateLimit   = "rate_limit"
+	ChaosErrorServerError = "server_error"
+	ChaosErrorTimeout     = "timeout"
+)
+
+// ChaosErrorTypes lists the valid values of ChaosConfig.ErrorType.
+var ChaosErrorTypes = []string{ChaosErrorRateLimit, ChaosErrorServerError, ChaosErrorTimeout}
+
+// ChaosConfig is the failure a ChaosAdapter injects.
+type ChaosConfig struct {
+	// FailureRate is the probability, from 0 to 1, that a call fails.
+	FailureRate float64 `json:"failure_rate" mapstructure:"failure_rate"`
+
+	// ErrorType is the failure injected, one of ChaosErrorTypes. Empty
+	// injects server errors.
+	ErrorType string `json:"error_type" mapstructure:"error_type"`
+
+	// DelayRange bounds the random delay injected before every call, such
+	// as [10ms, 500ms]. The zero range injects no delay.
+	DelayRange [2]time.Duration `json:"delay_range" mapstructure:"delay_range"`
+}
+
+// ChaosAdapter wraps an AIProvider and fails or delays its completions and
+// embeddings as configured, to test how the router copes with a provider
+// misbehaving. Health checks, warm-ups and model lists pass through.
+type ChaosAdapter struct {
+	inner AIProvider
+	cfg   ChaosConfig
+}
+
+// NewChaosAdapter returns inner with the failures of cfg injected.
+func NewChaosAdapter(inner AIProvider, cfg ChaosConfig) *ChaosAdapter {
+	return &ChaosAdapter{inner: inner, cfg: cfg}
+}
+
+// ChatCompletion waits for the injected delay, then fails with the
+// configured error at FailureRate or calls the wrapped adapter.
+func (a *ChaosAdapter) ChatCompletion(ctx context.Context, req OpenAIRequest) (OpenAIResponse, error) {
+	if err := a.inject(ctx); err != nil {
+		return OpenAIResponse{}, err
+	}
+	return a.inner.ChatCompletion(ctx, req)
+}
+
+// Embeddings injects failures like ChatCompletion into the wrapped
+// adapter's embeddings.
+func (a *ChaosAdapter) Embeddings(ctx context.Context, req OpenAIEmbeddingRequest) (OpenAIEmbeddingResponse, error) {
+	embedder, ok := a.inner.(interface {
+		Embeddings(ctx context.Context, req OpenAIEmbeddingRequest) (OpenAIEmbeddingResponse, error)
+	})
+	if !ok {
+		return OpenAIEmbeddingResponse{}, fmt.Errorf("%s adapter does not support embeddings", a.inner.Name())
+	}
+	if err := a.inject(ctx); err != nil {
+		return OpenAIEmbeddingResponse{}, err
+	}
+	return embedder.Embeddings(ctx, req)
+}
+
+// Name returns the wrapped adapter's name.
+func (a *ChaosAdapter) Name() string {
+	return a.inner.Name()
+}
+
+// HealthCheck calls the wrapped adapter.
+func (a *ChaosAdapter) HealthCheck(ctx context.Context) error {
+	return a.inner.HealthCheck(ctx)
+}
+
+// WarmUp calls the wrapped adapter.
+func (a *ChaosAdapter) WarmUp(ctx context.Context, models []string) error {
+	return a.inner.WarmUp(ctx, models)
+}
+
+// ListModels calls the wrapped adapter.
+func (a *ChaosAdapter) ListModels(ctx context.Context) ([]string, error) {
+	return a.inner.ListModels(ctx)
+}
+
+// inject waits for a random delay in DelayRange and returns the configured
+// error at FailureRate, or nil. It returns ctx's error when ctx ends first.
+func (a *ChaosAdapter) inject(ctx context.Context) error {
+	if d := a.delay(); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if a.cfg.FailureRate <= 0 || rand.Float64() >= a.cfg.FailureRate {
+		return nil
+	}
+	return a.failure()
+}
+
+// delay returns a random duration in DelayRange.
+func (a *ChaosAdapter) delay() time.Duration {
+	lo, hi := a.cfg.DelayRange[0], a.cfg.DelayRange[1]
+	if hi <= lo {
+		return lo
+	}
+	return lo + rand.N(hi-lo+1)
+}
+
+// failure returns the error of ErrorType as the wrapped adapter would
+// report it.
+func (a *ChaosAdapter) failure() error {
+	switch a.cfg.ErrorType {
+	case ChaosErrorRateLimit:
+		return &ProviderRateLimitError{
+			Provider: a.inner.Name(),
+			Err:      newAdapterError(http.StatusTooManyRequests, "RESOURCE_EXHAUSTED", "chaos: injected rate limit"),
+		}
+	case ChaosErrorTimeout:
+		return &ProviderTimeoutError{Provider: a.inner.Name(), Err: context.DeadlineExceeded}
+	}
+	return newAdapterError(http.StatusServiceUnavailable, "UNAVAILABLE", "chaos: injected server error")
+}
@@ -0,0 +1,108 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// countingProvider answers every completion and counts the calls.
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) ChatCompletion(ctx context.Context, req OpenAIRequest) (OpenAIResponse, error) {
+	p.calls++
+	return OpenAIResponse{ID: "ok"}, nil
+}
+
+func (p *countingProvider) Name() string                                      { return "counting" }
+func (p *countingProvider) HealthCheck(ctx context.Context) error             { return nil }
+func (p *countingProvider) WarmUp(ctx context.Context, models []string) error { return nil }
+func (p *countingProvider) ListModels(ctx context.Context) ([]string, error)  { return nil, nil }
+
+func TestChaosAdapter_FailureRate(t *testing.T) {
+	const calls = 100
+	for _, tt := range []struct {
+		rate      float64
+		wantFails int
+	}{
+		{1.0, calls},
+		{0.0, 0},
+	} {
+		inner := &countingProvider{}
+		a := NewChaosAdapter(inner, ChaosConfig{FailureRate: tt.rate})
+		fails := 0
+		for range calls {
+			if _, err := a.ChatCompletion(context.Background(), OpenAIRequest{}); err != nil {
+				fails++
+			}
+		}
+		if fails != tt.wantFails {
+			t.Errorf("FailureRate %v: %d of %d calls failed, want %d", tt.rate, fails, calls, tt.wantFails)
+		}
+		if inner.calls != calls-tt.wantFails {
+			t.Errorf("FailureRate %v: wrapped adapter called %d times, want %d", tt.rate, inner.calls, calls-tt.wantFails)
+		}
+	}
+}
+
+func TestChaosAdapter_ErrorType(t *testing.T) {
+	for _, tt := range []struct {
+		errorType string
+		check     func(error) bool
+	}{
+		{ChaosErrorRateLimit, func(err error) bool {
+			var rl *ProviderRateLimitError
+			return errors.As(err, &rl) && rl.Err.StatusCode == http.StatusTooManyRequests && rl.Err.Retryable
+		}},
+		{ChaosErrorServerError, func(err error) bool {
+			var ae *AdapterError
+			return errors.As(err, &ae) && ae.StatusCode == http.StatusServiceUnavailable && ae.Retryable
+		}},
+		{"", func(err error) bool {
+			var ae *AdapterError
+			return errors.As(err, &ae) && ae.StatusCode == http.StatusServiceUnavailable
+		}},
+		{ChaosErrorTimeout, func(err error) bool {
+			var te *ProviderTimeoutError
+			return errors.As(err, &te) && te.Provider == "counting"
+		}},
+	} {
+		a := NewChaosAdapter(&countingProvider{}, ChaosConfig{FailureRate: 1, ErrorType: tt.errorType})
+		if _, err := a.ChatCompletion(context.Background(), OpenAIRequest{}); !tt.check(err) {
+			t.Errorf("ErrorType %q: error = %v (%T)", tt.errorType, err, err)
+		}
+	}
+}
+
+func TestChaosAdapter_Delay(t *testing.T) {
+	a := NewChaosAdapter(&countingProvider{}, ChaosConfig{DelayRange: [2]time.Duration{20 * time.Millisecond, 30 * time.Millisecond}})
+	start := time.Now()
+	if _, err := a.ChatCompletion(context.Background(), OpenAIRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("call took %v, want at least 20ms", d)
+	}
+
+	// A cancelled request does not wait out the delay.
+	a = NewChaosAdapter(&countingProvider{}, ChaosConfig{DelayRange: [2]time.Duration{time.Hour, time.Hour}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := a.ChatCompletion(ctx, OpenAIRequest{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
+
+func TestChaosAdapter_Embeddings(t *testing.T) {
+	a := NewChaosAdapter(&countingProvider{}, ChaosConfig{})
+	if _, err := a.Embeddings(context.Background(), OpenAIEmbeddingRequest{}); err == nil {
+		t.Error("Embeddings on an adapter without embeddings succeeded, want an error")
+	}
+	if a.Name() != "counting" {
+		t.Errorf("Name() = %q, want the wrapped adapter's", a.Name())
+	}
+}
@@ -0,0 +1,194 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// AdapterError is a non-200 answer from a provider API. Callers inspect it
+// with errors.As instead of matching on the error text.
+type AdapterError struct {
+	// StatusCode is the HTTP status the provider answered with.
+	StatusCode int
+
+	// ProviderCode is the provider's own error status, e.g.
+	// "RESOURCE_EXHAUSTED". Empty when the body carried none.
+	ProviderCode string
+
+	// ProviderMessage is the provider's error message, or the raw body when
+	// it was not a provider error document.
+	ProviderMessage string
+
+	// Retryable reports whether the request may succeed with another key:
+	// rate limits, exhausted quota and transient server errors.
+	Retryable bool
+}
+
+// newAdapterError builds the error for a provider answer with status and
+// the given provider code and message, deciding whether it is retryable.
+func newAdapterError(status int, code, message string) *AdapterError {
+	retryable := code == "RESOURCE_EXHAUSTED"
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		retryable = true
+	}
+	return &AdapterError{
+		StatusCode:      status,
+		ProviderCode:    code,
+		ProviderMessage: message,
+		Retryable:       retryable,
+	}
+}
+
+// LogprobsNotSupportedError is returned for requests asking for logprobs
+// from a provider that does not report them. Another key would fail the
+// same way, so it is not retryable.
+type LogprobsNotSupportedError struct {
+	// Provider names the provider, e.g. "Gemini".
+	Provider string
+}
+
+// Error implements error.
+func (e *LogprobsNotSupportedError) Error() string {
+	return fmt.Sprintf("logprobs not supported by %s provider", e.Provider)
+}
+
+// ResponseFormatNotSupportedError is returned for requests asking for a
+// response format the provider or model cannot produce. Another key would
+// fail the same way, so it is not retryable.
+type ResponseFormatNotSupportedError struct {
+	// Provider names the provider, e.g. "Gemini".
+	Provider string
+
+	// Type is the requested response_format type.
+	Type string
+
+	// Model is the provider model that lacks the format, or "" when the
+	// provider supports it with no model.
+	Model string
+}
+
+// Error implements error.
+func (e *ResponseFormatNotSupportedError) Error() string {
+	if e.Model != "" {
+		return fmt.Sprintf("response_format %s not supported by %s model %s; use a newer model", e.Type, e.Provider, e.Model)
+	}
+	return fmt.Sprintf("response_format %s not supported by %s provider; use %s or %s", e.Type, e.Provider, ResponseFormatText, ResponseFormatJSONObject)
+}
+
+// ToolsNotSupportedError is returned for requests with tools sent with a
+// provider API version that does not accept them. Another key would fail
+// the same way, so it is not retryable.
+type ToolsNotSupportedError struct {
+	// Provider names the provider, e.g. "Anthropic".
+	Provider string
+
+	// Version is the provider API version lacking tools.
+	Version string
+}
+
+// Error implements error.
+func (e *ToolsNotSupportedError) Error() string {
+	return fmt.Sprintf("tools not supported by %s API version %s; configure a version that supports them", e.Provider, e.Version)
+}
+
+// EmptyResponseError is returned for a provider answer of 200 with no
+// candidates and no block reason, which Gemini occasionally sends. The same
+// request usually succeeds when sent again, so it is retryable.
+type EmptyResponseError struct {
+	// Provider names the provider, e.g. "Gemini".
+	Provider string
+}
+
+// Error implements error.
+func (e *EmptyResponseError) Error() string {
+	return fmt.Sprintf("empty response from %s provider: no candidates", e.Provider)
+}
+
+// ProviderTimeoutError is returned when a provider does not answer in time.
+// The key is likely fine, so the request may be retried with another key
+// without taking this one out of rotation.
+type ProviderTimeoutError struct {
+	// Provider names the provider, e.g. "Gemini".
+	Provider string
+
+	// Err is the underlying transport error.
+	Err error
+}
+
+// Error implements error.
+func (e *ProviderTimeoutError) Error() string {
+	return fmt.Sprintf("timeout waiting for %s provider: %v", e.Provider, e.Err)
+}
+
+// Unwrap returns the underlying transport error.
+func (e *ProviderTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// ProviderRateLimitError is returned when a provider rejects a key for rate
+// or quota limits. The key should rest, so it is taken out of rotation.
+type ProviderRateLimitError struct {
+	// Provider names the provider, e.g. "Gemini".
+	Provider string
+
+	// Err is the provider's answer.
+	Err *AdapterError
+}
+
+// Error implements error.
+func (e *ProviderRateLimitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the provider's answer, so errors.As still finds the
+// *AdapterError.
+func (e *ProviderRateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// isTimeout reports whether err from executing a request means the provider
+// did not answer in time.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, http.ErrHandlerTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Error implements error.
+func (e *AdapterError) Error() string {
+	if e.ProviderCode != "" {
+		return fmt.Sprintf("provider API error [%d %s]: %s", e.StatusCode, e.ProviderCode, e.ProviderMessage)
+	}
+	return fmt.Sprintf("provider API error [%d]: %s", e.StatusCode, e.ProviderMessage)
+}
+
+// HTTPStatusCode returns the HTTP status the provider answered with.
+func (e *AdapterError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// IsRateLimit reports whether the provider rejected the request for rate
+// or quota limits.
+func (e *AdapterError) IsRateLimit() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.ProviderCode == "RESOURCE_EXHAUSTED"
+}
+
+// ShouldRetry reports whether another key may get past the error: rate
+// limits and provider server errors. It implements domain.ProviderError.
+func (e *AdapterError) ShouldRetry() bool {
+	return e.Retryable
+}
+
+// ShouldMarkDead reports whether the key that got the error should leave
+// rotation; it does whenever the request is retried. It implements
+// domain.ProviderError.
+func (e *AdapterError) ShouldMarkDead() bool {
+	return e.Retryable
+}
@@ -0,0 +1,174 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestGeminiAdapter_ChatCompletion_AdapterError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantCode      string
+		wantMessage   string
+		wantRetryable bool
+		wantRateLimit bool
+	}{
+		{
+			name:          "rate limited",
+			status:        http.StatusTooManyRequests,
+			body:          `{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`,
+			wantCode:      "RESOURCE_EXHAUSTED",
+			wantMessage:   "Resource has been exhausted",
+			wantRetryable: true,
+			wantRateLimit: true,
+		},
+		{
+			name:        "unauthorized",
+			status:      http.StatusUnauthorized,
+			body:        `{"error":{"code":401,"message":"API key not valid","status":"UNAUTHENTICATED"}}`,
+			wantCode:    "UNAUTHENTICATED",
+			wantMessage: "API key not valid",
+		},
+		{
+			name:          "server error without error document",
+			status:        http.StatusServiceUnavailable,
+			body:          "upstream overloaded",
+			wantMessage:   "upstream overloaded",
+			wantRetryable: true,
+		},
+		{
+			name:          "quota exhausted as forbidden",
+			status:        http.StatusForbidden,
+			body:          `{"error":{"code":403,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`,
+			wantCode:      "RESOURCE_EXHAUSTED",
+			wantMessage:   "Quota exceeded",
+			wantRetryable: true,
+			wantRateLimit: true,
+		},
+		{
+			name:        "bad request",
+			status:      http.StatusBadRequest,
+			body:        `{"error":{"code":400,"message":"Invalid argument","status":"INVALID_ARGUMENT"}}`,
+			wantCode:    "INVALID_ARGUMENT",
+			wantMessage: "Invalid argument",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			a := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+			_, err := a.ChatCompletion(context.Background(), OpenAIRequest{
+				Model:    "gpt-4",
+				Messages: []OpenAIMessage{{Role: "user", Content: "hi"}},
+			})
+
+			var adapterErr *AdapterError
+			if !errors.As(err, &adapterErr) {
+				t.Fatalf("ChatCompletion() error = %v, want *AdapterError", err)
+			}
+			if got := adapterErr.HTTPStatusCode(); got != tt.status {
+				t.Errorf("HTTPStatusCode() = %d, want %d", got, tt.status)
+			}
+			if adapterErr.ProviderCode != tt.wantCode {
+				t.Errorf("ProviderCode = %q, want %q", adapterErr.ProviderCode, tt.wantCode)
+			}
+			if adapterErr.ProviderMessage != tt.wantMessage {
+				t.Errorf("ProviderMessage = %q, want %q", adapterErr.ProviderMessage, tt.wantMessage)
+			}
+			if adapterErr.Retryable != tt.wantRetryable {
+				t.Errorf("Retryable = %v, want %v", adapterErr.Retryable, tt.wantRetryable)
+			}
+			if got := adapterErr.IsRateLimit(); got != tt.wantRateLimit {
+				t.Errorf("IsRateLimit() = %v, want %v", got, tt.wantRateLimit)
+			}
+			var rateLimitErr *ProviderRateLimitError
+			if got := errors.As(err, &rateLimitErr); got != tt.wantRateLimit {
+				t.Errorf("error is *ProviderRateLimitError = %v, want %v", got, tt.wantRateLimit)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_ChatCompletion_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-release }))
+	defer server.Close()
+	defer close(release)
+
+	a := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL), WithTimeout(20*time.Millisecond))
+	_, err := a.ChatCompletion(context.Background(), OpenAIRequest{
+		Model:    "gpt-4",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hi"}},
+	})
+
+	var timeoutErr *ProviderTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("ChatCompletion() error = %v, want *ProviderTimeoutError", err)
+	}
+	if timeoutErr.Provider != "Gemini" || strings.Contains(err.Error(), "test-api-key") {
+		t.Errorf("error = %q, want a Gemini timeout without the key", err)
+	}
+	var rateLimitErr *ProviderRateLimitError
+	if errors.As(err, &rateLimitErr) {
+		t.Error("timeout is also a *ProviderRateLimitError")
+	}
+}
+
+func TestAdapterError_Error(t *testing.T) {
+	tests := []struct {
+		err  *AdapterError
+		want string
+	}{
+		{
+			&AdapterError{StatusCode: 429, ProviderCode: "RESOURCE_EXHAUSTED", ProviderMessage: "slow down"},
+			"provider API error [429 RESOURCE_EXHAUSTED]: slow down",
+		},
+		{&AdapterError{StatusCode: 502, ProviderMessage: "bad gateway"}, "provider API error [502]: bad gateway"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestKeyManager_HandleError_AdapterError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantRetry bool
+		wantDead  bool
+	}{
+		{"rate limit", newAdapterError(http.StatusTooManyRequests, "RESOURCE_EXHAUSTED", "slow down"), true, true},
+		{"server error", newAdapterError(http.StatusServiceUnavailable, "UNAVAILABLE", "overloaded"), true, true},
+		{"unauthorized", newAdapterError(http.StatusUnauthorized, "UNAUTHENTICATED", "bad key"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := domain.NewKeyManager([]string{"key-a", "key-b"}, time.Minute)
+			if got := km.HandleError("key-a", tt.err); got != tt.wantRetry {
+				t.Errorf("HandleError() = %v, want %v", got, tt.wantRetry)
+			}
+			if got := km.IsKeyDead("key-a"); got != tt.wantDead {
+				t.Errorf("IsKeyDead() = %v, want %v", got, tt.wantDead)
+			}
+		})
+	}
+}
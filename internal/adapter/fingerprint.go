@@ -0,0 +1,38 @@
+package adapter
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"sync"
+)
+
+// fingerprintLength is how many base64 characters of the hash a fingerprint
+// keeps after its "fp_<provider>_" prefix.
+const fingerprintLength = 16
+
+// FingerprintGenerator derives the system_fingerprint of responses from the
+// provider, the provider model a request was mapped to and the router
+// version, so clients can tell when the backend serving a model changed.
+// The zero value is ready to use and safe for concurrent use.
+type FingerprintGenerator struct {
+	cache sync.Map
+}
+
+// defaultFingerprints is shared by all adapters, which are created per request.
+var defaultFingerprints = &FingerprintGenerator{}
+
+// Generate returns "fp_<provider>_" followed by the first 16 characters of
+// the base64 SHA-256 of provider, model and version, so the provider can be
+// read off a response. The same inputs always give the same fingerprint.
+func (f *FingerprintGenerator) Generate(provider, model, version string) string {
+	// NUL cannot occur in the parts, so different parts never join alike.
+	input := strings.Join([]string{provider, model, version}, "\x00")
+	if fp, ok := f.cache.Load(input); ok {
+		return fp.(string)
+	}
+	sum := sha256.Sum256([]byte(input))
+	fp := "fp_" + provider + "_" + base64.RawURLEncoding.EncodeToString(sum[:])[:fingerprintLength]
+	f.cache.Store(input, fp)
+	return fp
+}
@@ -0,0 +1,71 @@
+package adapter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFingerprintGenerator_Generate(t *testing.T) {
+	var f FingerprintGenerator
+	fp := f.Generate("gemini", "gemini-1.5-pro", "v1.2.0")
+
+	if !strings.HasPrefix(fp, "fp_gemini_") || len(fp) != len("fp_gemini_")+fingerprintLength {
+		t.Fatalf("Generate() = %q, want fp_gemini_ and %d characters", fp, fingerprintLength)
+	}
+	if again := f.Generate("gemini", "gemini-1.5-pro", "v1.2.0"); again != fp {
+		t.Errorf("Generate() = %q on the second call, want %q", again, fp)
+	}
+	if other := new(FingerprintGenerator).Generate("gemini", "gemini-1.5-pro", "v1.2.0"); other != fp {
+		t.Errorf("Generate() = %q from another generator, want %q", other, fp)
+	}
+
+	for _, tt := range []struct{ provider, model, version string }{
+		{"gemini", "gemini-1.5-flash", "v1.2.0"},
+		{"gemini", "gemini-1.5-pro", "v1.3.0"},
+		{"openai", "gemini-1.5-pro", "v1.2.0"},
+		{"gemini", "gemini-1.5-prov1.2.0", ""},
+	} {
+		if got := f.Generate(tt.provider, tt.model, tt.version); got == fp {
+			t.Errorf("Generate(%q, %q, %q) = %q, want it to differ", tt.provider, tt.model, tt.version, got)
+		}
+	}
+}
+
+func TestGeminiAdapter_SystemFingerprint(t *testing.T) {
+	resp := GeminiResponse{Candidates: []GeminiCandidate{{Content: GeminiContent{Parts: []GeminiPart{{Text: "hi"}}}}}}
+	g := NewGeminiAdapter("test-api-key", WithRouterVersion("v1.2.0"))
+
+	gpt4 := g.mapToOpenAIResponse(resp, "gpt-4")
+	if want := defaultFingerprints.Generate("gemini", g.mapModelName("gpt-4"), "v1.2.0"); gpt4.SystemFingerprint != want {
+		t.Errorf("SystemFingerprint = %q, want %q", gpt4.SystemFingerprint, want)
+	}
+	if again := g.mapToOpenAIResponse(resp, "gpt-4"); again.SystemFingerprint != gpt4.SystemFingerprint {
+		t.Errorf("SystemFingerprint = %q on the second response, want %q", again.SystemFingerprint, gpt4.SystemFingerprint)
+	}
+	if other := g.mapToOpenAIResponse(resp, "gemini-1.5-flash"); other.SystemFingerprint == gpt4.SystemFingerprint {
+		t.Error("SystemFingerprint is the same for a different model")
+	}
+}
+
+func TestGeminiAdapter_ActualModel(t *testing.T) {
+	resp := GeminiResponse{Candidates: []GeminiCandidate{{Content: GeminiContent{Parts: []GeminiPart{{Text: "hi"}}}}}}
+	g := NewGeminiAdapter("test-api-key")
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4", "gemini-1.5-pro"},
+		{"gpt-4o-mini", "gemini-1.5-flash-8b"},
+		{"gemini-2.0-flash", "gemini-2.0-flash"},
+	}
+	for _, tt := range tests {
+		if got := g.ActualModel(tt.model); got != tt.want {
+			t.Errorf("ActualModel(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+		out := g.mapToOpenAIResponse(resp, tt.model)
+		if out.InternalModel != tt.want || out.Model != tt.model {
+			t.Errorf("response for %q has Model %q, InternalModel %q; want %q and %q", tt.model, out.Model, out.InternalModel, tt.model, tt.want)
+		}
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
+	"unicode"
 )
 
 const (
@@ -18,14 +22,62 @@ const (
 
 	// DefaultTimeout is the default HTTP client timeout.
 	DefaultTimeout = 30 * time.Second
+
+	// DefaultGeminiEmbeddingModel is used when the client asks for an OpenAI embedding model.
+	DefaultGeminiEmbeddingModel = "text-embedding-004"
+
+	// MinGeminiPenalty and MaxGeminiPenalty bound presence and frequency penalties.
+	MinGeminiPenalty = 0.0
+	MaxGeminiPenalty = 2.0
 )
 
+// MaxGeminiCandidates is the largest candidateCount Gemini accepts, and so
+// the largest n a chat completion may ask for.
+const MaxGeminiCandidates = 8
+
+// MaxGeminiThinkingBudget is the largest thinkingBudget, in tokens, Gemini
+// accepts for chain-of-thought reasoning.
+const MaxGeminiThinkingBudget = 24576
+
+// DefaultSystemPromptSeparator joins multiple system messages into one
+// systemInstruction.
+const DefaultSystemPromptSeparator = "\n\n"
+
+// midConversationSystemPrefix marks a system message that followed a user
+// turn, which Gemini cannot take as a systemInstruction, inside the next
+// user message.
+const midConversationSystemPrefix = "[SYSTEM]: "
+
+// HeaderUserID carries a chat completion's user field to Gemini when
+// WithForwardUser is on.
+const HeaderUserID = "X-HPN-User-ID"
+
+// MaxUserIDLength is the longest user value forwarded, in bytes.
+const MaxUserIDLength = 256
+
 // GeminiAdapter implements AIProvider for Google Gemini API.
 // It translates OpenAI-compatible requests to Gemini format and vice versa.
 type GeminiAdapter struct {
 	apiKey     string
 	baseURL    string
+	baseURLs   BaseURLProvider
 	httpClient *http.Client
+	cache      *ResponseCache
+	logger     *slog.Logger
+
+	defaultTopK    int
+	thinkingBudget *int
+	safetySettings []GeminiSafetySetting
+	systemSep      string
+	version        string
+	forwardUser    bool
+
+	searchGrounding bool
+
+	globalSystemPrompt    string
+	defaultMaxTokens      int
+	flashDefaultMaxTokens int
+	maxAllowedTokens      int
 }
 
 // GeminiAdapterOption is a functional option for configuring GeminiAdapter.
@@ -38,6 +90,20 @@ func WithBaseURL(url string) GeminiAdapterOption {
 	}
 }
 
+// BaseURLProvider supplies the API base URL at request time, so it can be
+// changed without rebuilding adapters.
+type BaseURLProvider interface {
+	BaseURL() string
+}
+
+// WithBaseURLProvider reads the base URL from p on every request. It takes
+// precedence over WithBaseURL while p returns a non-empty URL.
+func WithBaseURLProvider(p BaseURLProvider) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		g.baseURLs = p
+	}
+}
+
 // WithHTTPClient sets a custom HTTP client.
 func WithHTTPClient(client *http.Client) GeminiAdapterOption {
 	return func(g *GeminiAdapter) {
@@ -45,6 +111,14 @@ func WithHTTPClient(client *http.Client) GeminiAdapterOption {
 	}
 }
 
+// WithTransport sets the RoundTripper used by the HTTP client, typically a
+// shared *http.Transport so keep-alive connections are reused across adapters.
+func WithTransport(t http.RoundTripper) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		g.httpClient.Transport = t
+	}
+}
+
 // WithTimeout sets the HTTP client timeout.
 func WithTimeout(timeout time.Duration) GeminiAdapterOption {
 	return func(g *GeminiAdapter) {
@@ -52,6 +126,134 @@ func WithTimeout(timeout time.Duration) GeminiAdapterOption {
 	}
 }
 
+// WithAdapterLogger sets the logger used for request mapping warnings.
+func WithAdapterLogger(l *slog.Logger) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		g.logger = l
+	}
+}
+
+// WithDefaultTopK sets the topK sent with every chat completion unless the
+// request overrides it. Zero leaves topK to Gemini's default.
+func WithDefaultTopK(k int) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		if k > 0 {
+			g.defaultTopK = k
+		}
+	}
+}
+
+// WithDefaultThinkingBudget sets the thinkingBudget sent with every chat
+// completion unless the request overrides it, capped at
+// MaxGeminiThinkingBudget. Zero turns thinking off; a negative n leaves it
+// to Gemini's default.
+func WithDefaultThinkingBudget(n int) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		if n >= 0 {
+			n = min(n, MaxGeminiThinkingBudget)
+			g.thinkingBudget = &n
+		}
+	}
+}
+
+// WithSafetySettings sets the safety settings sent with every chat completion
+// unless the request overrides them.
+func WithSafetySettings(settings []GeminiSafetySetting) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		g.safetySettings = settings
+	}
+}
+
+// WithSystemPromptSeparator sets the text placed between system messages
+// when several are merged. The default is DefaultSystemPromptSeparator.
+func WithSystemPromptSeparator(sep string) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		g.systemSep = sep
+	}
+}
+
+// WithGlobalSystemPrompt puts prompt at the start of every chat completion's
+// systemInstruction, before the client's system messages, joined with the
+// system prompt separator.
+func WithGlobalSystemPrompt(prompt string) GeminiAdapterOption {
+	return func(g *GeminiAdapter) { g.globalSystemPrompt = prompt }
+}
+
+// WithDefaultMaxTokens sets maxOutputTokens for chat completions that send
+// neither max_tokens nor max_completion_tokens. Zero leaves them unlimited.
+func WithDefaultMaxTokens(n int) GeminiAdapterOption {
+	return func(g *GeminiAdapter) { g.defaultMaxTokens = n }
+}
+
+// WithFlashDefaultMaxTokens sets maxOutputTokens for chat completions sent to
+// a Gemini Flash model that send neither max_tokens nor
+// max_completion_tokens, in place of the WithDefaultMaxTokens default. Zero
+// uses that default.
+func WithFlashDefaultMaxTokens(n int) GeminiAdapterOption {
+	return func(g *GeminiAdapter) { g.flashDefaultMaxTokens = n }
+}
+
+// WithMaxAllowedTokens caps maxOutputTokens; larger client limits are cut
+// to n with a warning. Zero allows any limit.
+func WithMaxAllowedTokens(n int) GeminiAdapterOption {
+	return func(g *GeminiAdapter) { g.maxAllowedTokens = n }
+}
+
+// WithRouterVersion sets the router version that goes into the
+// system_fingerprint of responses.
+func WithRouterVersion(v string) GeminiAdapterOption {
+	return func(g *GeminiAdapter) { g.version = v }
+}
+
+// WithForwardUser sends the user field of chat completions, sanitized with
+// SanitizeUserID, as the HeaderUserID header. Off, the field is dropped.
+func WithForwardUser(enabled bool) GeminiAdapterOption {
+	return func(g *GeminiAdapter) { g.forwardUser = enabled }
+}
+
+// WithGoogleSearchGrounding lets Gemini ground its answers in Google Search
+// results by sending the googleSearch tool with every chat completion. The
+// sources it used are returned as the choices' grounding_metadata.
+func WithGoogleSearchGrounding(enabled bool) GeminiAdapterOption {
+	return func(g *GeminiAdapter) { g.searchGrounding = enabled }
+}
+
+// SanitizeUserID makes a client's user value safe to send as a header: it
+// keeps printable ASCII only, trims surrounding spaces and cuts the result
+// to MaxUserIDLength bytes.
+func SanitizeUserID(user string) string {
+	user = strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, user)
+	user = strings.TrimSpace(user)
+	if len(user) > MaxUserIDLength {
+		user = strings.TrimSpace(user[:MaxUserIDLength])
+	}
+	return user
+}
+
+// WithAdapterCache enables conditional requests for repeated chat completions.
+// Up to maxEntries responses are kept; the least recently used is evicted first.
+func WithAdapterCache(maxEntries int) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		if maxEntries > 0 {
+			g.cache = NewResponseCache(maxEntries)
+		}
+	}
+}
+
+// WithResponseCache is WithAdapterCache with a cache that outlives the
+// adapter, for adapters created per request for the same API key. A nil
+// cache disables conditional requests.
+func WithResponseCache(cache *ResponseCache) GeminiAdapterOption {
+	return func(g *GeminiAdapter) {
+		g.cache = cache
+	}
+}
+
 // NewGeminiAdapter creates a new GeminiAdapter with the given API key.
 func NewGeminiAdapter(apiKey string, opts ...GeminiAdapterOption) *GeminiAdapter {
 	g := &GeminiAdapter{
@@ -60,6 +262,8 @@ func NewGeminiAdapter(apiKey string, opts ...GeminiAdapterOption) *GeminiAdapter
 		httpClient: &http.Client{
 			Timeout: DefaultTimeout,
 		},
+		logger:    slog.Default(),
+		systemSep: DefaultSystemPromptSeparator,
 	}
 
 	for _, opt := range opts {
@@ -78,56 +282,292 @@ func (g *GeminiAdapter) Name() string {
 // It translates the OpenAI request to Gemini format, makes the API call,
 // and translates the response back to OpenAI format.
 func (g *GeminiAdapter) ChatCompletion(ctx context.Context, req OpenAIRequest) (OpenAIResponse, error) {
+	if err := g.checkResponseFormat(req); err != nil {
+		return OpenAIResponse{}, err
+	}
+
 	// Map OpenAI request to Gemini request
 	geminiReq := g.mapToGeminiRequest(req)
+	g.applyOverrides(ctx, &geminiReq)
 
 	// Build the API URL
 	model := g.mapModelName(req.Model)
-	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s", g.baseURL, model, g.apiKey)
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent?key=%s", g.currentBaseURL(), url.PathEscape(model), g.apiKey)
 
+	// Look up the previous response to this exact request, if caching is on
+	var cacheKey string
+	var cached responseCacheEntry
+	if g.cache != nil {
+		cacheKey = requestKey(model, geminiReq)
+		cached, _ = g.cache.get(cacheKey)
+	}
+
+	// Forward the end user for Gemini's abuse detection, if enabled
+	var header http.Header
+	if user := SanitizeUserID(req.User); g.forwardUser && user != "" {
+		header = http.Header{HeaderUserID: []string{user}}
+	}
+
+	// Execute request and parse Gemini response
+	var geminiResp GeminiResponse
+	notModified, err := g.postConditional(ctx, endpoint, geminiReq, &geminiResp, cached.generationID, header)
+	if err != nil {
+		return OpenAIResponse{}, err
+	}
+	if notModified {
+		return cached.response, nil
+	}
+
+	// Map Gemini response to OpenAI response
+	resp := g.mapToOpenAIResponse(geminiResp, req.Model)
+	if g.cache != nil && geminiResp.GenerationID != "" {
+		g.cache.put(cacheKey, geminiResp.GenerationID, resp)
+	}
+	return resp, nil
+}
+
+// Embeddings creates embeddings for each input string using Gemini's batchEmbedContents.
+// Gemini does not report token usage for embeddings, so Usage is left zero.
+func (g *GeminiAdapter) Embeddings(ctx context.Context, req OpenAIEmbeddingRequest) (OpenAIEmbeddingResponse, error) {
+	model := g.mapEmbeddingModelName(req.Model)
+	endpoint := fmt.Sprintf("%s/models/%s:batchEmbedContents?key=%s", g.currentBaseURL(), url.PathEscape(model), g.apiKey)
+
+	geminiReq := GeminiBatchEmbedRequest{
+		Requests: make([]GeminiEmbedContentRequest, len(req.Input)),
+	}
+	for i, text := range req.Input {
+		geminiReq.Requests[i] = GeminiEmbedContentRequest{
+			Model:   "models/" + model,
+			Content: GeminiContent{Parts: []GeminiPart{{Text: text}}},
+		}
+	}
+
+	var geminiResp GeminiBatchEmbedResponse
+	if err := g.post(ctx, endpoint, geminiReq, &geminiResp); err != nil {
+		return OpenAIEmbeddingResponse{}, err
+	}
+
+	resp := OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]OpenAIEmbedding, len(geminiResp.Embeddings)),
+		Model:  req.Model,
+	}
+	for i, e := range geminiResp.Embeddings {
+		resp.Data[i] = OpenAIEmbedding{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: e.Values,
+		}
+	}
+
+	return resp, nil
+}
+
+// CountTokens returns how many tokens Gemini counts in text for model. It
+// generates nothing, so it is a cheap way to check that a key works.
+func (g *GeminiAdapter) CountTokens(ctx context.Context, model, text string) (int, error) {
+	model = g.mapModelName(model)
+	endpoint := fmt.Sprintf("%s/models/%s:countTokens?key=%s", g.currentBaseURL(), url.PathEscape(model), g.apiKey)
+
+	req := GeminiCountTokensRequest{
+		Contents: []GeminiContent{{Role: "user", Parts: []GeminiPart{{Text: text}}}},
+	}
+	var resp GeminiCountTokensResponse
+	if err := g.post(ctx, endpoint, req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.TotalTokens, nil
+}
+
+// HealthCheck lists the models the key can use, which costs no quota, and
+// returns nil when Gemini answers 200. Other answers are returned as
+// *AdapterError.
+func (g *GeminiAdapter) HealthCheck(ctx context.Context) error {
+	_, err := g.ListModels(ctx)
+	return err
+}
+
+// ListModels returns the IDs of the models the key can use, such as
+// gemini-1.5-flash, from GET /models. Non-200 responses are returned as
+// *AdapterError.
+func (g *GeminiAdapter) ListModels(ctx context.Context) ([]string, error) {
+	var ids []string
+	pageToken := ""
+	for {
+		endpoint := fmt.Sprintf("%s/models?key=%s&pageSize=%d", g.currentBaseURL(), g.apiKey, geminiModelPageSize)
+		if pageToken != "" {
+			endpoint += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		var list GeminiModelList
+		if err := g.get(ctx, endpoint, &list); err != nil {
+			return nil, err
+		}
+		for _, m := range list.Models {
+			ids = append(ids, strings.TrimPrefix(m.Name, "models/"))
+		}
+		if list.NextPageToken == "" {
+			return ids, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// geminiModelPageSize is the most models Gemini returns per page.
+const geminiModelPageSize = 1000
+
+// get requests url and decodes a successful response into out. Non-200
+// responses are returned as *AdapterError.
+func (g *GeminiAdapter) get(ctx context.Context, url string, out interface{}) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create http request: %w", redactURLError(err))
+	}
+
+	resp, err := g.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to execute gemini request: %w", redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read gemini response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return geminiAPIError(resp.StatusCode, respBody)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal gemini response: %w", err)
+	}
+	return nil
+}
+
+// WarmUp counts the tokens of a one-word prompt with each of models, which
+// spends no quota, and returns the first error. Without models it is
+// HealthCheck.
+func (g *GeminiAdapter) WarmUp(ctx context.Context, models []string) error {
+	if len(models) == 0 {
+		return g.HealthCheck(ctx)
+	}
+	for _, model := range models {
+		if _, err := g.CountTokens(ctx, model, "ping"); err != nil {
+			return fmt.Errorf("warm up %s: %w", model, err)
+		}
+	}
+	return nil
+}
+
+// currentBaseURL returns the base URL for a request: the provider's, when
+// one is set and has a URL, else the fixed one.
+func (g *GeminiAdapter) currentBaseURL() string {
+	if g.baseURLs != nil {
+		if u := g.baseURLs.BaseURL(); u != "" {
+			return strings.TrimSuffix(u, "/")
+		}
+	}
+	return g.baseURL
+}
+
+// post sends payload as JSON to url and decodes a successful response into out.
+// Non-200 responses are returned as *AdapterError.
+func (g *GeminiAdapter) post(ctx context.Context, url string, payload, out interface{}) error {
+	_, err := g.postConditional(ctx, url, payload, out, "", nil)
+	return err
+}
+
+// postConditional is post with an optional If-None-Match value and extra
+// headers. It reports notModified instead of an error when the server answers
+// 304, leaving out untouched.
+func (g *GeminiAdapter) postConditional(ctx context.Context, url string, payload, out interface{}, ifNoneMatch string, header http.Header) (notModified bool, err error) {
 	// Marshal the request body
-	body, err := json.Marshal(geminiReq)
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return OpenAIResponse{}, fmt.Errorf("failed to marshal gemini request: %w", err)
+		return false, fmt.Errorf("failed to marshal gemini request: %w", err)
 	}
 
 	// Create HTTP request
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
-		return OpenAIResponse{}, fmt.Errorf("failed to create http request: %w", err)
+		return false, fmt.Errorf("failed to create http request: %w", redactURLError(err))
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		for _, v := range values {
+			httpReq.Header.Add(name, v)
+		}
+	}
+	if ifNoneMatch != "" {
+		httpReq.Header.Set("If-None-Match", ifNoneMatch)
+	}
 
 	// Execute request
 	resp, err := g.httpClient.Do(httpReq)
 	if err != nil {
-		return OpenAIResponse{}, fmt.Errorf("failed to execute gemini request: %w", err)
+		return false, requestError(err)
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return OpenAIResponse{}, fmt.Errorf("failed to read gemini response: %w", err)
+		if isTimeout(err) {
+			return false, &ProviderTimeoutError{Provider: "Gemini", Err: err}
+		}
+		return false, fmt.Errorf("failed to read gemini response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotModified && ifNoneMatch != "" {
+		return true, nil
 	}
 
 	// Check for API errors
 	if resp.StatusCode != http.StatusOK {
-		var geminiErr GeminiErrorResponse
-		if err := json.Unmarshal(respBody, &geminiErr); err == nil && geminiErr.Error.Message != "" {
-			return OpenAIResponse{}, fmt.Errorf("gemini API error [%d]: %s", resp.StatusCode, geminiErr.Error.Message)
-		}
-		return OpenAIResponse{}, fmt.Errorf("gemini API error [%d]: %s", resp.StatusCode, string(respBody))
+		return false, rateLimitError(geminiAPIError(resp.StatusCode, respBody))
 	}
 
-	// Parse Gemini response
-	var geminiResp GeminiResponse
-	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
-		return OpenAIResponse{}, fmt.Errorf("failed to unmarshal gemini response: %w", err)
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return false, fmt.Errorf("failed to unmarshal gemini response: %w", err)
 	}
 
-	// Map Gemini response to OpenAI response
-	return g.mapToOpenAIResponse(geminiResp, req.Model), nil
+	return false, nil
+}
+
+// requestError returns the error for a Gemini request that got no answer:
+// *ProviderTimeoutError when Gemini did not answer in time.
+func requestError(err error) error {
+	err = redactURLError(err)
+	if isTimeout(err) {
+		return &ProviderTimeoutError{Provider: "Gemini", Err: err}
+	}
+	return fmt.Errorf("failed to execute gemini request: %w", err)
+}
+
+// rateLimitError wraps a rate limit answer in *ProviderRateLimitError and
+// returns other answers unchanged.
+func rateLimitError(err *AdapterError) error {
+	if err.IsRateLimit() {
+		return &ProviderRateLimitError{Provider: "Gemini", Err: err}
+	}
+	return err
+}
+
+// geminiAPIError returns the *AdapterError for a non-200 Gemini response.
+func geminiAPIError(status int, body []byte) *AdapterError {
+	var geminiErr GeminiErrorResponse
+	if err := json.Unmarshal(body, &geminiErr); err == nil && geminiErr.Error.Message != "" {
+		return newAdapterError(status, geminiErr.Error.Status, geminiErr.Error.Message)
+	}
+	return newAdapterError(status, "", string(body))
+}
+
+// redactURLError drops the request URL, which carries the API key in its
+// query, from errors returned by net/http.
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+	}
+	return err
 }
 
 // mapToGeminiRequest converts an OpenAI request to Gemini format.
@@ -137,19 +577,45 @@ func (g *GeminiAdapter) mapToGeminiRequest(req OpenAIRequest) GeminiRequest {
 		GenerationConfig: GeminiGenerationConfig{},
 	}
 
-	var systemInstruction string
+	// System messages before the first turn are merged into systemInstruction.
+	// Gemini has no system role inside the conversation, so later ones are
+	// held back and prepended to the next user message.
+	var systemPrompts, pendingSystem []string
 
 	// Process messages and handle role mapping
 	for _, msg := range req.Messages {
 		switch msg.Role {
 		case "system":
-			// Gemini doesn't have a system role - prepend to context or use systemInstruction
-			systemInstruction = msg.Content
+			if strings.TrimSpace(msg.Content) == "" {
+				continue
+			}
+			if len(geminiReq.Contents) == 0 {
+				systemPrompts = append(systemPrompts, msg.Content)
+			} else {
+				pendingSystem = append(pendingSystem, midConversationSystemPrefix+msg.Content)
+			}
 		case "user":
+			if len(msg.ContentParts) > 0 {
+				var parts []GeminiPart
+				if len(pendingSystem) > 0 {
+					parts = append(parts, GeminiPart{Text: strings.Join(pendingSystem, g.systemSep)})
+					pendingSystem = nil
+				}
+				geminiReq.Contents = append(geminiReq.Contents, GeminiContent{
+					Role:  "user",
+					Parts: append(parts, mapContentParts(msg.ContentParts)...),
+				})
+				continue
+			}
+			content := msg.Content
+			if len(pendingSystem) > 0 {
+				content = strings.Join(append(pendingSystem, content), g.systemSep)
+				pendingSystem = nil
+			}
 			geminiReq.Contents = append(geminiReq.Contents, GeminiContent{
 				Role: "user",
 				Parts: []GeminiPart{
-					{Text: msg.Content},
+					{Text: content},
 				},
 			})
 		case "assistant":
@@ -163,11 +629,27 @@ func (g *GeminiAdapter) mapToGeminiRequest(req OpenAIRequest) GeminiRequest {
 		}
 	}
 
-	// If there's a system message, add it as systemInstruction
-	if systemInstruction != "" {
+	// A system message after the last user turn becomes a user turn of its own.
+	if len(pendingSystem) > 0 {
+		geminiReq.Contents = append(geminiReq.Contents, GeminiContent{
+			Role: "user",
+			Parts: []GeminiPart{
+				{Text: strings.Join(pendingSystem, g.systemSep)},
+			},
+		})
+	}
+
+	// The global system prompt comes before the client's
+	if g.globalSystemPrompt != "" {
+		systemPrompts = append([]string{g.globalSystemPrompt}, systemPrompts...)
+		g.logger.Debug("global system prompt injected", slog.String("prompt", g.globalSystemPrompt))
+	}
+
+	// If there are system messages, merge them into systemInstruction
+	if len(systemPrompts) > 0 {
 		geminiReq.SystemInstruction = &GeminiContent{
 			Parts: []GeminiPart{
-				{Text: systemInstruction},
+				{Text: strings.Join(systemPrompts, g.systemSep)},
 			},
 		}
 	}
@@ -176,21 +658,149 @@ func (g *GeminiAdapter) mapToGeminiRequest(req OpenAIRequest) GeminiRequest {
 	if req.Temperature != nil {
 		geminiReq.GenerationConfig.Temperature = req.Temperature
 	}
-	if req.MaxTokens != nil {
-		geminiReq.GenerationConfig.MaxOutputTokens = req.MaxTokens
-	}
+	geminiReq.GenerationConfig.MaxOutputTokens = g.resolveMaxOutputTokens(req, g.mapModelName(req.Model))
 	if req.TopP != nil {
 		geminiReq.GenerationConfig.TopP = req.TopP
 	}
 	if len(req.Stop) > 0 {
 		geminiReq.GenerationConfig.StopSequences = req.Stop
 	}
+	if req.PresencePenalty != nil && *req.PresencePenalty != 0 {
+		geminiReq.GenerationConfig.PresencePenalty = g.clampPenalty("presence_penalty", *req.PresencePenalty)
+	}
+	if req.FrequencyPenalty != nil && *req.FrequencyPenalty != 0 {
+		geminiReq.GenerationConfig.FrequencyPenalty = g.clampPenalty("frequency_penalty", *req.FrequencyPenalty)
+	}
+	if req.ResponseFormat != nil && req.ResponseFormat.Type == ResponseFormatJSONObject {
+		geminiReq.GenerationConfig.ResponseMimeType = "application/json"
+	}
+	if req.N != nil && *req.N > 1 {
+		geminiReq.GenerationConfig.CandidateCount = req.N
+	}
+
+	if len(req.Tools) > 0 {
+		decls := make([]GeminiFunctionDeclaration, len(req.Tools))
+		for i, tool := range req.Tools {
+			decls[i] = GeminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			}
+		}
+		geminiReq.Tools = []GeminiTool{{FunctionDeclarations: decls}}
+	}
+	if g.searchGrounding {
+		geminiReq.Tools = append(geminiReq.Tools, GeminiTool{GoogleSearch: &GeminiGoogleSearch{}})
+	}
+	geminiReq.ToolConfig = mapToolConfig(req)
 
 	return geminiReq
 }
 
+// mapContentParts converts the text and file_uri parts of a message to
+// Gemini parts, in order. Files become fileData parts.
+func mapContentParts(parts []OpenAIContentPart) []GeminiPart {
+	out := make([]GeminiPart, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case ContentPartText:
+			out = append(out, GeminiPart{Text: part.Text})
+		case ContentPartFileURI:
+			out = append(out, GeminiPart{FileData: &GeminiFileData{MimeType: part.MimeType, FileURI: part.FileURI}})
+		}
+	}
+	return out
+}
+
+// mapToolConfig maps tool_choice and parallel_tool_calls to a Gemini tool
+// config, or returns nil to keep Gemini's default, AUTO. Gemini cannot limit
+// the number of calls, so parallel_tool_calls false forces a call to the
+// chosen function, or to the first tool when none was chosen.
+func mapToolConfig(req OpenAIRequest) *GeminiToolConfig {
+	var cfg GeminiFunctionCallingConfig
+	if tc := req.ToolChoice; tc != nil {
+		switch {
+		case tc.Function != "":
+			cfg = GeminiFunctionCallingConfig{Mode: FunctionCallingAny, AllowedFunctionNames: []string{tc.Function}}
+		case tc.Mode == ToolChoiceNone:
+			cfg.Mode = FunctionCallingNone
+		case tc.Mode == ToolChoiceAuto:
+			cfg.Mode = FunctionCallingAuto
+		case tc.Mode == ToolChoiceRequired:
+			cfg.Mode = FunctionCallingAny
+		}
+	}
+
+	parallel := req.ParallelToolCalls == nil || *req.ParallelToolCalls
+	if !parallel && cfg.Mode != FunctionCallingNone && len(cfg.AllowedFunctionNames) == 0 && len(req.Tools) > 0 {
+		cfg = GeminiFunctionCallingConfig{Mode: FunctionCallingAny, AllowedFunctionNames: []string{req.Tools[0].Function.Name}}
+	}
+
+	if cfg.Mode == "" {
+		return nil
+	}
+	return &GeminiToolConfig{FunctionCallingConfig: cfg}
+}
+
+// resolveMaxOutputTokens returns the output limit for req sent to the
+// Gemini model: max_completion_tokens, else max_tokens, else the default set
+// with WithFlashDefaultMaxTokens for Flash models or WithDefaultMaxTokens,
+// cut to the maximum set with WithMaxAllowedTokens with a warning. Nil means
+// no limit.
+func (g *GeminiAdapter) resolveMaxOutputTokens(req OpenAIRequest, model string) *int {
+	limit := req.MaxCompletionTokens
+	if limit == nil {
+		limit = req.MaxTokens
+	}
+	if limit == nil {
+		n := g.defaultMaxTokens
+		if g.flashDefaultMaxTokens > 0 && isFlashModel(model) {
+			n = g.flashDefaultMaxTokens
+		}
+		if n > 0 {
+			limit = &n
+		}
+	}
+	if limit != nil && g.maxAllowedTokens > 0 && *limit > g.maxAllowedTokens {
+		g.logger.Warn("max_tokens above maximum, clamped",
+			slog.Int("max_tokens", *limit),
+			slog.Int("clamped", g.maxAllowedTokens),
+		)
+		n := g.maxAllowedTokens
+		limit = &n
+	}
+	return limit
+}
+
+// isFlashModel reports whether model is a Gemini Flash model, such as
+// gemini-1.5-flash or gemini-1.5-flash-8b.
+func isFlashModel(model string) bool {
+	return strings.Contains(model, "-flash")
+}
+
+// clampPenalty fits an OpenAI penalty (-2.0 to 2.0) into Gemini's supported
+// range (0.0 to 2.0), logging a warning when the value had to change.
+func (g *GeminiAdapter) clampPenalty(name string, v float64) *float64 {
+	clamped := v
+	if clamped < MinGeminiPenalty {
+		clamped = MinGeminiPenalty
+	}
+	if clamped > MaxGeminiPenalty {
+		clamped = MaxGeminiPenalty
+	}
+	if clamped != v {
+		g.logger.Warn("penalty outside gemini range, clamped",
+			slog.String("param", name),
+			slog.Float64("value", v),
+			slog.Float64("clamped", clamped),
+		)
+	}
+	return &clamped
+}
+
 // mapToOpenAIResponse converts a Gemini response to OpenAI format.
 func (g *GeminiAdapter) mapToOpenAIResponse(resp GeminiResponse, model string) OpenAIResponse {
+	actual := g.ActualModel(model)
 	openAIResp := OpenAIResponse{
 		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano()),
 		Object:  "chat.completion",
@@ -198,39 +808,129 @@ func (g *GeminiAdapter) mapToOpenAIResponse(resp GeminiResponse, model string) O
 		Model:   model,
 		Choices: make([]OpenAIChoice, 0),
 		Usage:   OpenAIUsage{},
+
+		SystemFingerprint: defaultFingerprints.Generate(g.Name(), actual, g.version),
+		InternalModel:     actual,
 	}
 
-	// Map candidates to choices
+	// Map candidates to choices; functionCall parts become tool calls
 	for i, candidate := range resp.Candidates {
 		content := ""
-		if len(candidate.Content.Parts) > 0 {
-			content = candidate.Content.Parts[0].Text
+		var toolCalls []OpenAIToolCall
+		for _, part := range candidate.Content.Parts {
+			if part.Thought {
+				// Internal reasoning is not exposed to clients; its
+				// tokens are still counted in the usage below.
+				continue
+			}
+			if part.FunctionCall != nil {
+				toolCalls = append(toolCalls, g.mapFunctionCall(*part.FunctionCall, i, len(toolCalls)))
+			} else if content == "" {
+				content = part.Text
+			}
 		}
 
 		choice := OpenAIChoice{
 			Index: i,
 			Message: OpenAIMessage{
-				Role:    "assistant",
-				Content: content,
+				Role:      "assistant",
+				Content:   content,
+				ToolCalls: toolCalls,
 			},
 			FinishReason: g.mapFinishReason(candidate.FinishReason),
+			Logprobs:     nil,
+
+			GroundingMetadata: mapGroundingMetadata(candidate.GroundingMetadata),
+		}
+		if len(toolCalls) > 0 {
+			choice.FinishReason = "tool_calls"
 		}
 
 		openAIResp.Choices = append(openAIResp.Choices, choice)
 	}
 
-	// Map usage metadata
+	// A blocked prompt has no candidates, only the block reason. Report it as
+	// a filtered choice so clients see why, as OpenAI does.
+	if len(resp.Candidates) == 0 && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		openAIResp.Choices = append(openAIResp.Choices, OpenAIChoice{
+			Index: 0,
+			Message: OpenAIMessage{
+				Role:    "assistant",
+				Content: "",
+			},
+			FinishReason: "content_filter",
+			Blocked:      true,
+		})
+	}
+
+	// Map usage metadata; candidatesTokenCount already covers every
+	// candidate, so per-candidate counts are only summed without it.
+	// Thinking tokens are billed as output, so they count as completion
+	// tokens.
 	if resp.UsageMetadata != nil {
 		openAIResp.Usage = OpenAIUsage{
 			PromptTokens:     resp.UsageMetadata.PromptTokenCount,
-			CompletionTokens: resp.UsageMetadata.CandidatesTokenCount,
+			CompletionTokens: resp.UsageMetadata.CandidatesTokenCount + resp.UsageMetadata.ThoughtsTokenCount,
 			TotalTokens:      resp.UsageMetadata.TotalTokenCount,
 		}
 	}
+	var candidateTokens int
+	for _, candidate := range resp.Candidates {
+		candidateTokens += candidate.TokenCount
+	}
+	if openAIResp.Usage.CompletionTokens == 0 && candidateTokens > 0 {
+		openAIResp.Usage.CompletionTokens = candidateTokens
+		openAIResp.Usage.TotalTokens = openAIResp.Usage.PromptTokens + candidateTokens
+	}
 
 	return openAIResp
 }
 
+// mapGroundingMetadata converts the search grounding of a candidate, or
+// returns nil when the candidate was not grounded.
+func mapGroundingMetadata(m *GeminiGroundingMetadata) *GroundingMetadata {
+	if m == nil {
+		return nil
+	}
+	out := &GroundingMetadata{WebSearchQueries: m.WebSearchQueries}
+	for _, chunk := range m.GroundingChunks {
+		if chunk.Web != nil {
+			out.Sources = append(out.Sources, GroundingSource{URI: chunk.Web.URI, Title: chunk.Web.Title})
+		}
+	}
+	if m.SearchEntryPoint != nil {
+		out.SearchEntryPoint = m.SearchEntryPoint.RenderedContent
+	}
+	return out
+}
+
+// mapFunctionCall converts a Gemini functionCall part to an OpenAI tool
+// call. Gemini calls carry no ID, so one is made from the time and the
+// call's candidate and position.
+func (g *GeminiAdapter) mapFunctionCall(fc GeminiFunctionCall, candidate, n int) OpenAIToolCall {
+	args := "{}"
+	if len(fc.Args) > 0 {
+		// Args came from JSON, so it always marshals.
+		b, _ := json.Marshal(fc.Args)
+		args = string(b)
+	}
+	return OpenAIToolCall{
+		ID:   fmt.Sprintf("call_%d_%d_%d", time.Now().UnixNano(), candidate, n),
+		Type: "function",
+		Function: OpenAIFunctionCall{
+			Name:      fc.Name,
+			Arguments: args,
+		},
+	}
+}
+
+// ActualModel returns the Gemini model a request for model is sent to. It
+// takes the requested model rather than remembering the last one, as one
+// adapter may serve several requests.
+func (g *GeminiAdapter) ActualModel(model string) string {
+	return g.mapModelName(model)
+}
+
 // mapModelName converts OpenAI model names to Gemini equivalents.
 func (g *GeminiAdapter) mapModelName(model string) string {
 	// Map common OpenAI model names to Gemini equivalents
@@ -253,6 +953,42 @@ func (g *GeminiAdapter) mapModelName(model string) string {
 	return model
 }
 
+// jsonModeUnsupportedPrefixes lists the Gemini models, by name prefix, that
+// reject responseMimeType.
+var jsonModeUnsupportedPrefixes = []string{"gemini-1.0-", "gemini-pro-vision"}
+
+// checkResponseFormat returns a ResponseFormatNotSupportedError when req
+// asks for a response format Gemini or the requested model cannot produce.
+func (g *GeminiAdapter) checkResponseFormat(req OpenAIRequest) error {
+	if req.ResponseFormat == nil {
+		return nil
+	}
+	switch req.ResponseFormat.Type {
+	case "", ResponseFormatText:
+		return nil
+	case ResponseFormatJSONObject:
+		model := g.mapModelName(req.Model)
+		for _, prefix := range jsonModeUnsupportedPrefixes {
+			if strings.HasPrefix(model, prefix) {
+				return &ResponseFormatNotSupportedError{Provider: "Gemini", Type: req.ResponseFormat.Type, Model: model}
+			}
+		}
+		return nil
+	default:
+		return &ResponseFormatNotSupportedError{Provider: "Gemini", Type: req.ResponseFormat.Type}
+	}
+}
+
+// mapEmbeddingModelName converts OpenAI embedding model names to Gemini equivalents.
+func (g *GeminiAdapter) mapEmbeddingModelName(model string) string {
+	switch model {
+	case "", "text-embedding-ada-002", "text-embedding-3-small", "text-embedding-3-large":
+		return DefaultGeminiEmbeddingModel
+	default:
+		return model
+	}
+}
+
 // mapFinishReason converts Gemini finish reasons to OpenAI format.
 func (g *GeminiAdapter) mapFinishReason(reason string) string {
 	reasonMap := map[string]string{
@@ -260,6 +996,7 @@ func (g *GeminiAdapter) mapFinishReason(reason string) string {
 		"MAX_TOKENS":    "length",
 		"SAFETY":        "content_filter",
 		"RECITATION":    "content_filter",
+		"FUNCTION_CALL": "tool_calls",
 		"OTHER":         "stop",
 		"FINISH_REASON_UNSPECIFIED": "stop",
 	}
@@ -281,6 +1018,48 @@ type GeminiRequest struct {
 	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
 	GenerationConfig  GeminiGenerationConfig  `json:"generationConfig,omitempty"`
 	SafetySettings    []GeminiSafetySetting   `json:"safetySettings,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+// GeminiTool is a set of functions the model may call, or a built-in tool
+// such as Google Search.
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations,omitempty"`
+
+	// GoogleSearch lets the model ground its answer in Google Search
+	// results. It takes no settings and is sent as {}.
+	GoogleSearch *GeminiGoogleSearch `json:"googleSearch,omitempty"`
+}
+
+// GeminiGoogleSearch enables grounding with Google Search.
+type GeminiGoogleSearch struct{}
+
+// GeminiFunctionDeclaration describes a callable function.
+type GeminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// Function calling modes of GeminiFunctionCallingConfig.
+const (
+	FunctionCallingAuto = "AUTO"
+	FunctionCallingAny  = "ANY"
+	FunctionCallingNone = "NONE"
+)
+
+// GeminiToolConfig controls how the model uses its tools.
+type GeminiToolConfig struct {
+	FunctionCallingConfig GeminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+// GeminiFunctionCallingConfig sets whether the model may, must or must not
+// call functions. With mode ANY, AllowedFunctionNames limits the functions
+// it may call.
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
 }
 
 // GeminiContent represents a content block in Gemini format.
@@ -291,16 +1070,55 @@ type GeminiContent struct {
 
 // GeminiPart represents a part of a content block.
 type GeminiPart struct {
-	Text string `json:"text,omitempty"`
+	Text         string              `json:"text,omitempty"`
+	FunctionCall *GeminiFunctionCall `json:"functionCall,omitempty"`
+
+	// FileData references a file in Cloud Storage, such as a video, audio
+	// file or document.
+	FileData *GeminiFileData `json:"fileData,omitempty"`
+
+	// Thought marks a part holding the model's reasoning rather than its
+	// answer.
+	Thought bool `json:"thought,omitempty"`
+}
+
+// GeminiFileData is a file in Cloud Storage the model reads.
+type GeminiFileData struct {
+	MimeType string `json:"mimeType"`
+	FileURI  string `json:"fileUri"`
+}
+
+// GeminiFunctionCall is a function the model asks the client to call.
+type GeminiFunctionCall struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
 }
 
 // GeminiGenerationConfig contains generation parameters.
 type GeminiGenerationConfig struct {
-	Temperature     *float64 `json:"temperature,omitempty"`
-	TopP            *float64 `json:"topP,omitempty"`
-	TopK            *int     `json:"topK,omitempty"`
-	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
-	StopSequences   []string `json:"stopSequences,omitempty"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	TopK             *int     `json:"topK,omitempty"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+	CandidateCount   *int     `json:"candidateCount,omitempty"`
+
+	// ResponseMimeType is the output format, "application/json" for JSON
+	// mode; empty is plain text.
+	ResponseMimeType string `json:"responseMimeType,omitempty"`
+
+	// ThinkingConfig controls chain-of-thought reasoning on models that
+	// support it.
+	ThinkingConfig *GeminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// GeminiThinkingConfig contains the thinking parameters.
+type GeminiThinkingConfig struct {
+	// ThinkingBudget is the number of tokens the model may spend
+	// reasoning; 0 turns thinking off.
+	ThinkingBudget *int `json:"thinkingBudget,omitempty"`
 }
 
 // GeminiSafetySetting configures content safety filtering.
@@ -313,6 +1131,13 @@ type GeminiSafetySetting struct {
 type GeminiResponse struct {
 	Candidates    []GeminiCandidate    `json:"candidates"`
 	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+
+	// PromptFeedback carries the block reason when the prompt itself was
+	// blocked, in which case there are no candidates.
+	PromptFeedback *GeminiPromptFeedback `json:"promptFeedback,omitempty"`
+
+	// GenerationID identifies this generation; it is sent back as If-None-Match.
+	GenerationID string `json:"generation_id,omitempty"`
 }
 
 // GeminiCandidate represents a single generated candidate.
@@ -321,6 +1146,42 @@ type GeminiCandidate struct {
 	FinishReason  string               `json:"finishReason"`
 	Index         int                  `json:"index"`
 	SafetyRatings []GeminiSafetyRating `json:"safetyRatings,omitempty"`
+	TokenCount    int                  `json:"tokenCount,omitempty"`
+
+	// GroundingMetadata lists the searches and sources behind a grounded
+	// answer.
+	GroundingMetadata *GeminiGroundingMetadata `json:"groundingMetadata,omitempty"`
+}
+
+// GeminiGroundingMetadata describes how a candidate was grounded in Google
+// Search.
+type GeminiGroundingMetadata struct {
+	WebSearchQueries []string                `json:"webSearchQueries,omitempty"`
+	GroundingChunks  []GeminiGroundingChunk  `json:"groundingChunks,omitempty"`
+	SearchEntryPoint *GeminiSearchEntryPoint `json:"searchEntryPoint,omitempty"`
+}
+
+// GeminiGroundingChunk is a source a grounded answer draws on.
+type GeminiGroundingChunk struct {
+	Web *GeminiWebChunk `json:"web,omitempty"`
+}
+
+// GeminiWebChunk is a web page found by Google Search.
+type GeminiWebChunk struct {
+	URI   string `json:"uri"`
+	Title string `json:"title,omitempty"`
+}
+
+// GeminiSearchEntryPoint holds the Google Search suggestions that must be
+// shown with a grounded answer.
+type GeminiSearchEntryPoint struct {
+	RenderedContent string `json:"renderedContent,omitempty"`
+}
+
+// GeminiPromptFeedback contains the safety verdict on the prompt.
+type GeminiPromptFeedback struct {
+	BlockReason   string               `json:"blockReason,omitempty"`
+	SafetyRatings []GeminiSafetyRating `json:"safetyRatings,omitempty"`
 }
 
 // GeminiSafetyRating contains safety evaluation for a response.
@@ -334,6 +1195,54 @@ type GeminiUsageMetadata struct {
 	PromptTokenCount     int `json:"promptTokenCount"`
 	CandidatesTokenCount int `json:"candidatesTokenCount"`
 	TotalTokenCount      int `json:"totalTokenCount"`
+
+	// ThoughtsTokenCount is the number of thinking tokens, not included
+	// in CandidatesTokenCount.
+	ThoughtsTokenCount int `json:"thoughtsTokenCount,omitempty"`
+}
+
+// GeminiBatchEmbedRequest represents a Gemini batchEmbedContents request.
+type GeminiBatchEmbedRequest struct {
+	Requests []GeminiEmbedContentRequest `json:"requests"`
+}
+
+// GeminiEmbedContentRequest embeds a single content block.
+type GeminiEmbedContentRequest struct {
+	Model   string        `json:"model"`
+	Content GeminiContent `json:"content"`
+}
+
+// GeminiBatchEmbedResponse represents a Gemini batchEmbedContents response.
+type GeminiBatchEmbedResponse struct {
+	Embeddings []GeminiEmbedding `json:"embeddings"`
+}
+
+// GeminiEmbedding holds a single embedding vector.
+type GeminiEmbedding struct {
+	Values []float64 `json:"values"`
+}
+
+// GeminiCountTokensRequest represents a Gemini countTokens request.
+type GeminiCountTokensRequest struct {
+	Contents []GeminiContent `json:"contents"`
+}
+
+// GeminiCountTokensResponse represents a Gemini countTokens response.
+type GeminiCountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
+// GeminiModelList represents a page of the Gemini models list.
+type GeminiModelList struct {
+	Models        []GeminiModel `json:"models"`
+	NextPageToken string        `json:"nextPageToken,omitempty"`
+}
+
+// GeminiModel is a model in GeminiModelList. Name has the form
+// models/gemini-1.5-flash.
+type GeminiModel struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
 }
 
 // GeminiErrorResponse represents an error response from Gemini API.
@@ -1,8 +1,20 @@
 package adapter
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
 )
 
 func TestGeminiAdapter_mapToGeminiRequest(t *testing.T) {
@@ -107,6 +119,350 @@ func TestGeminiAdapter_mapToGeminiRequest(t *testing.T) {
 	}
 }
 
+func TestGeminiAdapter_mapSystemMessages(t *testing.T) {
+	tests := []struct {
+		name       string
+		sep        string
+		global     string
+		messages   []OpenAIMessage
+		wantSystem string
+		wantTurns  []string
+	}{
+		{
+			name: "two system messages merged",
+			messages: []OpenAIMessage{
+				{Role: "system", Content: "You are a helpful assistant."},
+				{Role: "system", Content: "Answer in French."},
+				{Role: "user", Content: "Hi"},
+			},
+			wantSystem: "You are a helpful assistant.\n\nAnswer in French.",
+			wantTurns:  []string{"Hi"},
+		},
+		{
+			name: "custom separator",
+			sep:  " | ",
+			messages: []OpenAIMessage{
+				{Role: "system", Content: "Be brief."},
+				{Role: "system", Content: "Be kind."},
+				{Role: "user", Content: "Hi"},
+			},
+			wantSystem: "Be brief. | Be kind.",
+			wantTurns:  []string{"Hi"},
+		},
+		{
+			name: "mid-conversation system message prepended to next user message",
+			messages: []OpenAIMessage{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Hi"},
+				{Role: "assistant", Content: "Hello!"},
+				{Role: "system", Content: "Now answer in French."},
+				{Role: "user", Content: "How are you?"},
+			},
+			wantSystem: "Be brief.",
+			wantTurns:  []string{"Hi", "Hello!", "[SYSTEM]: Now answer in French.\n\nHow are you?"},
+		},
+		{
+			name: "trailing system message becomes a user turn",
+			messages: []OpenAIMessage{
+				{Role: "user", Content: "Hi"},
+				{Role: "system", Content: "Wrap up."},
+			},
+			wantTurns: []string{"Hi", "[SYSTEM]: Wrap up."},
+		},
+		{
+			name: "empty system message ignored",
+			messages: []OpenAIMessage{
+				{Role: "system", Content: ""},
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Hi"},
+				{Role: "system", Content: "  "},
+				{Role: "user", Content: "Bye"},
+			},
+			wantSystem: "Be brief.",
+			wantTurns:  []string{"Hi", "Bye"},
+		},
+		{
+			name:   "global prompt without system message",
+			global: "You work for ACME Corp.",
+			messages: []OpenAIMessage{
+				{Role: "user", Content: "Hi"},
+			},
+			wantSystem: "You work for ACME Corp.",
+			wantTurns:  []string{"Hi"},
+		},
+		{
+			name:   "global prompt before client system message",
+			global: "You work for ACME Corp.",
+			messages: []OpenAIMessage{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Hi"},
+			},
+			wantSystem: "You work for ACME Corp.\n\nBe brief.",
+			wantTurns:  []string{"Hi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []GeminiAdapterOption
+			if tt.sep != "" {
+				opts = append(opts, WithSystemPromptSeparator(tt.sep))
+			}
+			if tt.global != "" {
+				opts = append(opts, WithGlobalSystemPrompt(tt.global))
+			}
+			req := NewGeminiAdapter("test-api-key", opts...).mapToGeminiRequest(OpenAIRequest{
+				Model:    "gpt-4",
+				Messages: tt.messages,
+			})
+
+			var gotSystem string
+			if req.SystemInstruction != nil {
+				gotSystem = req.SystemInstruction.Parts[0].Text
+			}
+			if gotSystem != tt.wantSystem {
+				t.Errorf("SystemInstruction = %q, want %q", gotSystem, tt.wantSystem)
+			}
+			var gotTurns []string
+			for _, c := range req.Contents {
+				gotTurns = append(gotTurns, c.Parts[0].Text)
+			}
+			if !reflect.DeepEqual(gotTurns, tt.wantTurns) {
+				t.Errorf("Contents = %q, want %q", gotTurns, tt.wantTurns)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_mapPenaltiesAndN(t *testing.T) {
+	tests := []struct {
+		name      string
+		presence  *float64
+		frequency *float64
+		n         *int
+		wantPres  *float64
+		wantFreq  *float64
+		wantCount *int
+		wantWarns int
+	}{
+		{name: "unset"},
+		{name: "zero is dropped", presence: ptrFloat(0), frequency: ptrFloat(0), n: ptrInt(1)},
+		{name: "in range", presence: ptrFloat(0.5), frequency: ptrFloat(1.5), wantPres: ptrFloat(0.5), wantFreq: ptrFloat(1.5)},
+		{name: "negative clamps to zero", presence: ptrFloat(-1), frequency: ptrFloat(-2), wantPres: ptrFloat(0), wantFreq: ptrFloat(0), wantWarns: 2},
+		{name: "above max clamps", frequency: ptrFloat(2.5), wantFreq: ptrFloat(2), wantWarns: 1},
+		{name: "n sets candidate count", n: ptrInt(3), wantCount: ptrInt(3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			adapter := NewGeminiAdapter("test-api-key", WithAdapterLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+			req := adapter.mapToGeminiRequest(OpenAIRequest{
+				Model:            "gpt-4",
+				Messages:         []OpenAIMessage{{Role: "user", Content: "hi"}},
+				PresencePenalty:  tt.presence,
+				FrequencyPenalty: tt.frequency,
+				N:                tt.n,
+			})
+			cfg := req.GenerationConfig
+
+			if !reflect.DeepEqual(cfg.PresencePenalty, tt.wantPres) {
+				t.Errorf("PresencePenalty = %v, want %v", deref(cfg.PresencePenalty), deref(tt.wantPres))
+			}
+			if !reflect.DeepEqual(cfg.FrequencyPenalty, tt.wantFreq) {
+				t.Errorf("FrequencyPenalty = %v, want %v", deref(cfg.FrequencyPenalty), deref(tt.wantFreq))
+			}
+			if !reflect.DeepEqual(cfg.CandidateCount, tt.wantCount) {
+				t.Errorf("CandidateCount = %v, want %v", deref(cfg.CandidateCount), deref(tt.wantCount))
+			}
+			if got := strings.Count(logs.String(), "level=WARN"); got != tt.wantWarns {
+				t.Errorf("clamp warnings = %d, want %d\n%s", got, tt.wantWarns, logs.String())
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_mapToolChoice(t *testing.T) {
+	const tools = `"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}},{"type":"function","function":{"name":"get_time"}}]`
+	tests := []struct {
+		name  string
+		extra string
+		want  string
+	}{
+		{"unset", ``, ``},
+		{"none", `,"tool_choice":"none"`, `{"functionCallingConfig":{"mode":"NONE"}}`},
+		{"auto", `,"tool_choice":"auto"`, `{"functionCallingConfig":{"mode":"AUTO"}}`},
+		{"required", `,"tool_choice":"required"`, `{"functionCallingConfig":{"mode":"ANY"}}`},
+		{
+			"function",
+			`,"tool_choice":{"type":"function","function":{"name":"get_time"}}`,
+			`{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_time"]}}`,
+		},
+		{
+			"no parallel calls",
+			`,"parallel_tool_calls":false`,
+			`{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_weather"]}}`,
+		},
+		{
+			"no parallel calls with function",
+			`,"tool_choice":{"type":"function","function":{"name":"get_time"}},"parallel_tool_calls":false`,
+			`{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_time"]}}`,
+		},
+		{"no parallel calls with none", `,"tool_choice":"none","parallel_tool_calls":false`, `{"functionCallingConfig":{"mode":"NONE"}}`},
+		{"parallel calls", `,"parallel_tool_calls":true`, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req OpenAIRequest
+			body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],` + tools + tt.extra + `}`
+			if err := json.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			data, err := json.Marshal(NewGeminiAdapter("test-api-key").mapToGeminiRequest(req))
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got struct {
+				Tools      []GeminiTool    `json:"tools"`
+				ToolConfig json.RawMessage `json:"toolConfig"`
+			}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			if string(got.ToolConfig) != tt.want {
+				t.Errorf("toolConfig = %s, want %s", got.ToolConfig, tt.want)
+			}
+			if len(got.Tools) != 1 || len(got.Tools[0].FunctionDeclarations) != 2 || got.Tools[0].FunctionDeclarations[0].Name != "get_weather" {
+				t.Errorf("tools = %+v, want both functions declared", got.Tools)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_ChatCompletion_MultipleCandidates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GeminiRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.GenerationConfig.CandidateCount == nil || *req.GenerationConfig.CandidateCount != 2 {
+			t.Errorf("candidateCount = %v, want 2", deref(req.GenerationConfig.CandidateCount))
+		}
+		w.Write([]byte(`{"candidates":[
+			{"content":{"parts":[{"text":"first"}],"role":"model"},"finishReason":"STOP","index":0},
+			{"content":{"parts":[{"text":"second"}],"role":"model"},"finishReason":"MAX_TOKENS","index":1}
+		]}`))
+	}))
+	defer server.Close()
+
+	adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+	resp, err := adapter.ChatCompletion(context.Background(), OpenAIRequest{
+		Model:    "gpt-4",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hello"}},
+		N:        ptrInt(2),
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion() error = %v", err)
+	}
+
+	if len(resp.Choices) != 2 {
+		t.Fatalf("len(Choices) = %d, want 2", len(resp.Choices))
+	}
+	for i, want := range []struct{ content, finish string }{{"first", "stop"}, {"second", "length"}} {
+		c := resp.Choices[i]
+		if c.Index != i || c.Message.Content != want.content || c.FinishReason != want.finish {
+			t.Errorf("Choices[%d] = {%d %q %q}, want {%d %q %q}", i, c.Index, c.Message.Content, c.FinishReason, i, want.content, want.finish)
+		}
+	}
+}
+
+func TestGeminiAdapter_ChatCompletion_Thinking(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GeminiRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if tc := req.GenerationConfig.ThinkingConfig; tc == nil || deref(tc.ThinkingBudget) != 1024 {
+			t.Errorf("thinkingConfig = %+v, want thinkingBudget 1024", tc)
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[
+			{"text":"The user greets me, so I greet back.","thought":true},
+			{"text":"Hello!"}
+		],"role":"model"},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"thoughtsTokenCount":9,"totalTokenCount":14}}`))
+	}))
+	defer server.Close()
+
+	adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL), WithDefaultThinkingBudget(1024))
+	resp, err := adapter.ChatCompletion(context.Background(), OpenAIRequest{
+		Model:    "gemini-2.0-flash-thinking-exp",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hello"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion() error = %v", err)
+	}
+
+	if got := resp.Choices[0].Message.Content; got != "Hello!" {
+		t.Errorf("Content = %q, want only the answer %q", got, "Hello!")
+	}
+	if resp.Usage.CompletionTokens != 11 || resp.Usage.TotalTokens != 14 {
+		t.Errorf("Usage = %+v, want 11 completion tokens including thoughts and 14 total", resp.Usage)
+	}
+}
+
+func TestGeminiAdapter_ChatCompletion_ResponseFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		format   *ResponseFormat
+		wantMime string
+		wantErr  bool
+	}{
+		{name: "no format", model: "gpt-4"},
+		{name: "text", model: "gpt-4", format: &ResponseFormat{Type: ResponseFormatText}},
+		{name: "json object", model: "gpt-4", format: &ResponseFormat{Type: ResponseFormatJSONObject}, wantMime: "application/json"},
+		{name: "json object on Gemini 1.0", model: "gemini-1.0-pro", format: &ResponseFormat{Type: ResponseFormatJSONObject}, wantErr: true},
+		{name: "unknown type", model: "gpt-4", format: &ResponseFormat{Type: "json_schema"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			var got GeminiRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				json.NewDecoder(r.Body).Decode(&got)
+				w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"{}"}],"role":"model"},"finishReason":"STOP"}]}`))
+			}))
+			defer server.Close()
+
+			adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+			_, err := adapter.ChatCompletion(context.Background(), OpenAIRequest{
+				Model:          tt.model,
+				Messages:       []OpenAIMessage{{Role: "user", Content: "hello"}},
+				ResponseFormat: tt.format,
+			})
+
+			if tt.wantErr {
+				var formatErr *ResponseFormatNotSupportedError
+				if !errors.As(err, &formatErr) {
+					t.Fatalf("ChatCompletion() error = %v, want *ResponseFormatNotSupportedError", err)
+				}
+				if calls != 0 {
+					t.Errorf("provider called %d times, want 0", calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+			if got.GenerationConfig.ResponseMimeType != tt.wantMime {
+				t.Errorf("responseMimeType = %q, want %q", got.GenerationConfig.ResponseMimeType, tt.wantMime)
+			}
+		})
+	}
+}
+
 func TestGeminiAdapter_mapToOpenAIResponse(t *testing.T) {
 	adapter := NewGeminiAdapter("test-api-key")
 
@@ -158,6 +514,120 @@ func TestGeminiAdapter_mapToOpenAIResponse(t *testing.T) {
 	}
 }
 
+func TestGeminiAdapter_mapToOpenAIResponse_CandidateTokenCounts(t *testing.T) {
+	result := NewGeminiAdapter("test-api-key").mapToOpenAIResponse(GeminiResponse{
+		Candidates: []GeminiCandidate{
+			{Content: GeminiContent{Parts: []GeminiPart{{Text: "a"}}}, FinishReason: "STOP", TokenCount: 3},
+			{Content: GeminiContent{Parts: []GeminiPart{{Text: "b"}}}, FinishReason: "STOP", TokenCount: 4},
+		},
+		UsageMetadata: &GeminiUsageMetadata{PromptTokenCount: 5},
+	}, "gpt-4")
+
+	if result.Usage.CompletionTokens != 7 {
+		t.Errorf("Usage.CompletionTokens = %d, want 7", result.Usage.CompletionTokens)
+	}
+	if result.Usage.TotalTokens != 12 {
+		t.Errorf("Usage.TotalTokens = %d, want 12", result.Usage.TotalTokens)
+	}
+}
+
+func TestGeminiAdapter_mapToOpenAIResponse_Blocked(t *testing.T) {
+	var geminiResp GeminiResponse
+	body := `{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"HIGH"}]}}`
+	if err := json.Unmarshal([]byte(body), &geminiResp); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	result := NewGeminiAdapter("test-api-key").mapToOpenAIResponse(geminiResp, "gpt-4")
+
+	if len(result.Choices) != 1 {
+		t.Fatalf("len(Choices) = %d, want 1", len(result.Choices))
+	}
+	choice := result.Choices[0]
+	if choice.FinishReason != "content_filter" {
+		t.Errorf("FinishReason = %s, want content_filter", choice.FinishReason)
+	}
+	if choice.Message.Role != "assistant" || choice.Message.Content != "" {
+		t.Errorf("Message = %+v, want an empty assistant message", choice.Message)
+	}
+	if !choice.Blocked {
+		t.Error("Blocked = false, want true")
+	}
+	if err := ValidateOpenAIResponse(result); err != nil {
+		t.Errorf("ValidateOpenAIResponse() error = %v", err)
+	}
+}
+
+func TestGeminiAdapter_mapToOpenAIResponse_FunctionCalls(t *testing.T) {
+	var geminiResp GeminiResponse
+	body := `{"candidates":[{"content":{"role":"model","parts":[
+		{"text":"Checking both cities."},
+		{"functionCall":{"name":"get_weather","args":{"city":"Hanoi","days":3}}},
+		{"functionCall":{"name":"get_time"}}
+	]},"finishReason":"STOP"}]}`
+	if err := json.Unmarshal([]byte(body), &geminiResp); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	result := NewGeminiAdapter("test-api-key").mapToOpenAIResponse(geminiResp, "gpt-4")
+
+	if len(result.Choices) != 1 {
+		t.Fatalf("len(Choices) = %d, want 1", len(result.Choices))
+	}
+	choice := result.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %s, want tool_calls", choice.FinishReason)
+	}
+	if choice.Message.Content != "Checking both cities." {
+		t.Errorf("Content = %q, want the text part", choice.Message.Content)
+	}
+
+	calls := choice.Message.ToolCalls
+	if len(calls) != 2 {
+		t.Fatalf("len(ToolCalls) = %d, want 2", len(calls))
+	}
+	want := []OpenAIFunctionCall{
+		{Name: "get_weather", Arguments: `{"city":"Hanoi","days":3}`},
+		{Name: "get_time", Arguments: "{}"},
+	}
+	for i, call := range calls {
+		if call.Type != "function" {
+			t.Errorf("ToolCalls[%d].Type = %s, want function", i, call.Type)
+		}
+		if !strings.HasPrefix(call.ID, "call_") {
+			t.Errorf("ToolCalls[%d].ID = %s, want a call_ prefix", i, call.ID)
+		}
+		if call.Function != want[i] {
+			t.Errorf("ToolCalls[%d].Function = %+v, want %+v", i, call.Function, want[i])
+		}
+	}
+	if calls[0].ID == calls[1].ID {
+		t.Errorf("ToolCalls IDs repeat: %s", calls[0].ID)
+	}
+
+	encoded, err := json.Marshal(choice.Message)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(encoded), `"tool_calls":[{"id":"call_`) {
+		t.Errorf("message JSON = %s, want tool_calls", encoded)
+	}
+}
+
+func TestGeminiAdapter_mapToOpenAIResponse_NullLogprobs(t *testing.T) {
+	result := NewGeminiAdapter("test-api-key").mapToOpenAIResponse(GeminiResponse{
+		Candidates: []GeminiCandidate{{Content: GeminiContent{Parts: []GeminiPart{{Text: "hi"}}}, FinishReason: "STOP"}},
+	}, "gpt-4")
+
+	encoded, err := json.Marshal(result.Choices[0])
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(encoded), `"logprobs":null`) {
+		t.Errorf("choice JSON = %s, want \"logprobs\":null", encoded)
+	}
+}
+
 func TestGeminiAdapter_mapModelName(t *testing.T) {
 	adapter := NewGeminiAdapter("test-api-key")
 
@@ -196,6 +666,7 @@ func TestGeminiAdapter_mapFinishReason(t *testing.T) {
 		{"MAX_TOKENS", "length"},
 		{"SAFETY", "content_filter"},
 		{"RECITATION", "content_filter"},
+		{"FUNCTION_CALL", "tool_calls"},
 		{"OTHER", "stop"},
 		{"UNKNOWN", "stop"}, // Default
 	}
@@ -230,11 +701,914 @@ func TestNewGeminiAdapter_Options(t *testing.T) {
 	}
 }
 
+func TestNewGeminiAdapter_WithTransport(t *testing.T) {
+	transport := &http.Transport{}
+	adapter := NewGeminiAdapter("test-api-key", WithTransport(transport))
+
+	if adapter.httpClient.Transport != transport {
+		t.Errorf("httpClient.Transport = %v, want the supplied transport", adapter.httpClient.Transport)
+	}
+	if adapter.httpClient.Timeout != DefaultTimeout {
+		t.Errorf("httpClient.Timeout = %v, want %v", adapter.httpClient.Timeout, DefaultTimeout)
+	}
+}
+
+func TestEmbeddingInput_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    EmbeddingInput
+		wantErr bool
+	}{
+		{"single string", `"hello"`, EmbeddingInput{"hello"}, false},
+		{"array", `["a","b"]`, EmbeddingInput{"a", "b"}, false},
+		{"number", `42`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got EmbeddingInput
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopSequences_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    StopSequences
+		wantErr bool
+	}{
+		{"single string", `"\n"`, StopSequences{"\n"}, false},
+		{"array", `["a","b"]`, StopSequences{"a", "b"}, false},
+		{"number", `42`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got StopSequences
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIMessage_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    OpenAIMessage
+		wantErr bool
+	}{
+		{"string", `{"role":"user","content":"hi"}`, OpenAIMessage{Role: "user", Content: "hi"}, false},
+		{"null", `{"role":"assistant","content":null}`, OpenAIMessage{Role: "assistant"}, false},
+		{"parts", `{"role":"user","content":[{"type":"text","text":"describe"},{"type":"file_uri","file_uri":"gs://b/v.mp4","mime_type":"video/mp4"},{"type":"text","text":"briefly"}]}`,
+			OpenAIMessage{Role: "user", Content: "describe\nbriefly", ContentParts: []OpenAIContentPart{
+				{Type: ContentPartText, Text: "describe"},
+				{Type: ContentPartFileURI, FileURI: "gs://b/v.mp4", MimeType: "video/mp4"},
+				{Type: ContentPartText, Text: "briefly"},
+			}}, false},
+		{"number", `{"role":"user","content":42}`, OpenAIMessage{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got OpenAIMessage
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var again OpenAIMessage
+			if err := json.Unmarshal(data, &again); err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("round trip = %+v (%v), want %+v", again, err, got)
+			}
+		})
+	}
+}
+
+func TestValidateContentParts(t *testing.T) {
+	tests := []struct {
+		name    string
+		part    OpenAIContentPart
+		wantErr bool
+	}{
+		{"text", OpenAIContentPart{Type: ContentPartText, Text: "hi"}, false},
+		{"gcs file", OpenAIContentPart{Type: ContentPartFileURI, FileURI: "gs://bucket/videos/clip.mp4", MimeType: "video/mp4"}, false},
+		{"https file", OpenAIContentPart{Type: ContentPartFileURI, FileURI: "https://example.com/clip.mp4", MimeType: "video/mp4"}, true},
+		{"bucket only", OpenAIContentPart{Type: ContentPartFileURI, FileURI: "gs://bucket/", MimeType: "video/mp4"}, true},
+		{"no mime type", OpenAIContentPart{Type: ContentPartFileURI, FileURI: "gs://bucket/clip.mp4"}, true},
+		{"image url", OpenAIContentPart{Type: ContentPartImageURL, ImageURL: "https://example.com/cat.png"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs := []OpenAIMessage{{Role: "user", ContentParts: []OpenAIContentPart{tt.part}}}
+			if err := ValidateContentParts(msgs); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateContentParts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_FileData(t *testing.T) {
+	g := NewGeminiAdapter("test-api-key")
+	var msg OpenAIMessage
+	if err := json.Unmarshal([]byte(`{"role":"user","content":[{"type":"text","text":"Summarize this video"},`+
+		`{"type":"file_uri","file_uri":"gs://media/talk.mp4","mime_type":"video/mp4"}]}`), &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := g.mapToGeminiRequest(OpenAIRequest{Model: "gemini-1.5-pro", Messages: []OpenAIMessage{msg}})
+	want := []GeminiContent{{Role: "user", Parts: []GeminiPart{
+		{Text: "Summarize this video"},
+		{FileData: &GeminiFileData{MimeType: "video/mp4", FileURI: "gs://media/talk.mp4"}},
+	}}}
+	if !reflect.DeepEqual(got.Contents, want) {
+		t.Errorf("contents = %+v, want %+v", got.Contents, want)
+	}
+	data, err := json.Marshal(got.Contents[0].Parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"fileData":{"mimeType":"video/mp4","fileUri":"gs://media/talk.mp4"}}` {
+		t.Errorf("part JSON = %s, want a fileData part", data)
+	}
+}
+
+func TestToolChoice_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    ToolChoice
+		wantErr bool
+	}{
+		{"none", `"none"`, ToolChoice{Mode: ToolChoiceNone}, false},
+		{"required", `"required"`, ToolChoice{Mode: ToolChoiceRequired}, false},
+		{"function", `{"type":"function","function":{"name":"fn"}}`, ToolChoice{Function: "fn"}, false},
+		{"unknown mode", `"always"`, ToolChoice{}, true},
+		{"function without name", `{"type":"function","function":{}}`, ToolChoice{}, true},
+		{"number", `1`, ToolChoice{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ToolChoice
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+			if data, err := json.Marshal(got); err != nil || string(data) != tt.input {
+				t.Errorf("Marshal() = %s, %v, want %s", data, err, tt.input)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_mapEmbeddingModelName(t *testing.T) {
+	adapter := NewGeminiAdapter("test-api-key")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", DefaultGeminiEmbeddingModel},
+		{"text-embedding-ada-002", DefaultGeminiEmbeddingModel},
+		{"text-embedding-3-small", DefaultGeminiEmbeddingModel},
+		{"text-embedding-3-large", DefaultGeminiEmbeddingModel},
+		{"embedding-001", "embedding-001"}, // Pass-through
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := adapter.mapEmbeddingModelName(tt.input)
+			if result != tt.expected {
+				t.Errorf("mapEmbeddingModelName(%s) = %s, want %s", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_Embeddings(t *testing.T) {
+	var gotPath string
+	var gotReq GeminiBatchEmbedRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		json.NewEncoder(w).Encode(GeminiBatchEmbedResponse{
+			Embeddings: []GeminiEmbedding{
+				{Values: []float64{0.1, 0.2}},
+				{Values: []float64{0.3, 0.4}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+	resp, err := adapter.Embeddings(context.Background(), OpenAIEmbeddingRequest{
+		Model: "text-embedding-3-small",
+		Input: EmbeddingInput{"first", "second"},
+	})
+	if err != nil {
+		t.Fatalf("Embeddings() error = %v", err)
+	}
+
+	if gotPath != "/models/"+DefaultGeminiEmbeddingModel+":batchEmbedContents" {
+		t.Errorf("path = %s, want batchEmbedContents on %s", gotPath, DefaultGeminiEmbeddingModel)
+	}
+	if len(gotReq.Requests) != 2 || gotReq.Requests[1].Content.Parts[0].Text != "second" {
+		t.Errorf("requests = %+v, want one per input in order", gotReq.Requests)
+	}
+	if resp.Object != "list" || resp.Model != "text-embedding-3-small" {
+		t.Errorf("Object/Model = %s/%s, want list/text-embedding-3-small", resp.Object, resp.Model)
+	}
+	if len(resp.Data) != 2 || resp.Data[1].Index != 1 || resp.Data[1].Embedding[0] != 0.3 {
+		t.Errorf("Data = %+v, want two indexed embeddings", resp.Data)
+	}
+}
+
+func TestGeminiAdapter_Embeddings_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(GeminiErrorResponse{
+			Error: GeminiErrorDetail{Code: 429, Message: "quota exhausted"},
+		})
+	}))
+	defer server.Close()
+
+	adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+	_, err := adapter.Embeddings(context.Background(), OpenAIEmbeddingRequest{Input: EmbeddingInput{"x"}})
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("Embeddings() error = %v, want 429 API error", err)
+	}
+}
+
+func TestGeminiAdapter_BaseURLProvider(t *testing.T) {
+	// newServer answers every chat completion with reply and counts calls.
+	newServer := func(reply string) (*httptest.Server, *int32) {
+		var calls int32
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			json.NewEncoder(w).Encode(GeminiResponse{Candidates: []GeminiCandidate{{
+				Content:      GeminiContent{Role: "model", Parts: []GeminiPart{{Text: reply}}},
+				FinishReason: "STOP",
+			}}})
+		}))
+		t.Cleanup(server.Close)
+		return server, &calls
+	}
+	first, firstCalls := newServer("first")
+	second, secondCalls := newServer("second")
+
+	registry := domain.NewProviderBaseURLRegistry(map[domain.ProviderType]string{domain.ProviderGoogle: first.URL})
+	// httptest TLS servers share one certificate, so either client trusts both.
+	a := NewGeminiAdapter("test-api-key",
+		WithHTTPClient(first.Client()),
+		WithBaseURLProvider(registry.For(domain.ProviderGoogle)),
+	)
+	req := OpenAIRequest{Model: "gpt-4", Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}}
+
+	complete := func() string {
+		t.Helper()
+		resp, err := a.ChatCompletion(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ChatCompletion() error = %v", err)
+		}
+		return resp.Choices[0].Message.Content
+	}
+
+	if got := complete(); got != "first" {
+		t.Errorf("reply before the change = %s, want first", got)
+	}
+	if _, err := registry.SetBaseURL(domain.ProviderGoogle, second.URL+"/"); err != nil {
+		t.Fatalf("SetBaseURL() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if got := complete(); got != "second" {
+			t.Errorf("reply after the change = %s, want second", got)
+		}
+	}
+	if got, want := atomic.LoadInt32(firstCalls), int32(1); got != want {
+		t.Errorf("first server calls = %d, want %d", got, want)
+	}
+	if got, want := atomic.LoadInt32(secondCalls), int32(2); got != want {
+		t.Errorf("second server calls = %d, want %d", got, want)
+	}
+}
+
+func TestValidateOpenAIResponse(t *testing.T) {
+	valid := func() OpenAIResponse {
+		return OpenAIResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "hi"}}},
+			Usage:   OpenAIUsage{TotalTokens: 3},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(*OpenAIResponse)
+		wantErr string
+	}{
+		{"valid", func(r *OpenAIResponse) {}, ""},
+		{"zero usage", func(r *OpenAIResponse) { r.Usage.TotalTokens = 0 }, ""},
+		{"no choices", func(r *OpenAIResponse) { r.Choices = nil }, "choices is empty"},
+		{"missing role", func(r *OpenAIResponse) { r.Choices[0].Message.Role = "" }, "choices[0].message.role is empty"},
+		{"negative usage", func(r *OpenAIResponse) { r.Usage.TotalTokens = -1 }, "usage.total_tokens is negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.mutate(&r)
+
+			err := ValidateOpenAIResponse(r)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateOpenAIResponse() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("ValidateOpenAIResponse() error = %v, want ErrInvalidResponse", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateOpenAIResponse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_ChatCompletion_MalformedResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"no candidates", `{"candidates":[]}`, "choices is empty"},
+		{"missing candidates", `{}`, "choices is empty"},
+		{
+			"negative usage",
+			`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}],"usageMetadata":{"totalTokenCount":-5}}`,
+			"usage.total_tokens is negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+			resp, err := adapter.ChatCompletion(context.Background(), OpenAIRequest{
+				Model:    "gpt-4",
+				Messages: []OpenAIMessage{{Role: "user", Content: "hello"}},
+			})
+			if err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+
+			err = ValidateOpenAIResponse(resp)
+			if !errors.Is(err, ErrInvalidResponse) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateOpenAIResponse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_ChatCompletion_NotModified(t *testing.T) {
+	var calls int
+	var ifNoneMatch []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == "gen-1" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}],"generation_id":"gen-1"}`))
+	}))
+	defer server.Close()
+
+	req := OpenAIRequest{
+		Model:    "gpt-4",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hello"}},
+	}
+
+	adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL), WithAdapterCache(10))
+
+	first, err := adapter.ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("first ChatCompletion() error = %v", err)
+	}
+	second, err := adapter.ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("second ChatCompletion() error = %v", err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("provider calls = %d, want 2", calls)
+	}
+	if ifNoneMatch[0] != "" || ifNoneMatch[1] != "gen-1" {
+		t.Errorf("If-None-Match = %q, want [\"\" \"gen-1\"]", ifNoneMatch)
+	}
+	// The response ID is stamped during mapping, so an equal ID shows the cached
+	// response was returned as-is rather than mapped again.
+	if !reflect.DeepEqual(second, first) {
+		t.Errorf("second response = %+v, want cached %+v", second, first)
+	}
+}
+
+func TestGeminiAdapter_ChatCompletion_NoCacheNoConditional(t *testing.T) {
+	var ifNoneMatch []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"}}],"generation_id":"gen-1"}`))
+	}))
+	defer server.Close()
+
+	req := OpenAIRequest{
+		Model:    "gpt-4",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hello"}},
+	}
+
+	adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+	for i := 0; i < 2; i++ {
+		if _, err := adapter.ChatCompletion(context.Background(), req); err != nil {
+			t.Fatalf("ChatCompletion() error = %v", err)
+		}
+	}
+
+	for i, v := range ifNoneMatch {
+		if v != "" {
+			t.Errorf("request %d If-None-Match = %q, want none without WithAdapterCache", i, v)
+		}
+	}
+}
+
+const benchGeminiBody = `{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`
+
+// BenchmarkGeminiAdapter_ColdStart gives every adapter its own transport, so
+// each request dials a new connection.
+func BenchmarkGeminiAdapter_ColdStart(b *testing.B) {
+	benchmarkGeminiAdapter(b, false)
+}
+
+// BenchmarkGeminiAdapter_KeepAlive shares one transport across adapters, so
+// connections are reused.
+func BenchmarkGeminiAdapter_KeepAlive(b *testing.B) {
+	benchmarkGeminiAdapter(b, true)
+}
+
+func benchmarkGeminiAdapter(b *testing.B, keepAlive bool) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(benchGeminiBody))
+	}))
+	defer server.Close()
+
+	shared := &http.Transport{MaxIdleConns: 100, MaxIdleConnsPerHost: 10}
+	defer shared.CloseIdleConnections()
+
+	req := OpenAIRequest{
+		Model:    "gpt-4",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hello"}},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		transport := shared
+		if !keepAlive {
+			transport = &http.Transport{}
+		}
+
+		adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL), WithTransport(transport))
+		if _, err := adapter.ChatCompletion(context.Background(), req); err != nil {
+			b.Fatalf("ChatCompletion() error = %v", err)
+		}
+
+		if !keepAlive {
+			transport.CloseIdleConnections()
+		}
+	}
+}
+
 // Helper functions
 func ptrFloat(f float64) *float64 {
 	return &f
 }
 
+// deref returns the pointed-to value, or nil, for readable failure messages.
+func deref[T any](p *T) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
 func ptrInt(i int) *int {
 	return &i
 }
+
+func TestGeminiAdapter_ChatCompletion_EscapesModel(t *testing.T) {
+	var gotPath, gotKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.URL.Query().Get("key")
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"ok"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	defer server.Close()
+
+	adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+	_, err := adapter.ChatCompletion(context.Background(), OpenAIRequest{
+		Model:    "../x?key=other",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion() error = %v", err)
+	}
+	if gotPath != "/models/../x?key=other:generateContent" {
+		t.Errorf("path = %q, want the model as a single escaped segment", gotPath)
+	}
+	if gotKey != "test-api-key" {
+		t.Errorf("key = %q, want test-api-key", gotKey)
+	}
+}
+
+func TestGeminiAdapter_ErrorsOmitAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		model   string
+	}{
+		{"invalid escape in model", "http://127.0.0.1:1", "%0X"},
+		{"connection refused", "http://127.0.0.1:1", "gemini-1.5-flash"},
+		{"invalid base URL", "http://[::1", "gemini-1.5-flash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := NewGeminiAdapter("AIzaSySecretKey1234567890", WithBaseURL(tt.baseURL))
+			_, err := adapter.ChatCompletion(context.Background(), OpenAIRequest{
+				Model:    tt.model,
+				Messages: []OpenAIMessage{{Role: "user", Content: "hi"}},
+			})
+			if err == nil {
+				t.Fatal("ChatCompletion() error = nil, want a request error")
+			}
+			if strings.Contains(err.Error(), "AIzaSySecretKey1234567890") {
+				t.Errorf("error exposes the API key: %v", err)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_CountTokens(t *testing.T) {
+	var gotPath string
+	var gotReq GeminiCountTokensRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		json.NewEncoder(w).Encode(GeminiCountTokensResponse{TotalTokens: 3})
+	}))
+	defer server.Close()
+
+	n, err := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL)).CountTokens(context.Background(), "gemini-1.5-flash", "hello")
+	if err != nil {
+		t.Fatalf("CountTokens() error = %v", err)
+	}
+	if n != 3 {
+		t.Errorf("CountTokens() = %d, want 3", n)
+	}
+	if gotPath != "/models/gemini-1.5-flash:countTokens" {
+		t.Errorf("path = %s, want countTokens on gemini-1.5-flash", gotPath)
+	}
+	if len(gotReq.Contents) != 1 || gotReq.Contents[0].Parts[0].Text != "hello" {
+		t.Errorf("contents = %+v, want the text as one user turn", gotReq.Contents)
+	}
+}
+
+func TestGeminiAdapter_HealthCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantStatus int
+	}{
+		{"ok", http.StatusOK, `{"models":[{"name":"models/gemini-1.5-flash"}]}`, 0},
+		{"invalid key", http.StatusUnauthorized, `{"error":{"code":401,"message":"API key not valid","status":"UNAUTHENTICATED"}}`, http.StatusUnauthorized},
+		{"rate limited", http.StatusTooManyRequests, `{"error":{"code":429,"message":"quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/models" {
+					t.Errorf("request = %s %s, want GET /models", r.Method, r.URL.Path)
+				}
+				if got := r.URL.Query().Get("key"); got != "test-api-key" {
+					t.Errorf("key = %q, want test-api-key", got)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			err := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL)).HealthCheck(context.Background())
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("HealthCheck() error = %v, want nil", err)
+				}
+				return
+			}
+			var adapterErr *AdapterError
+			if !errors.As(err, &adapterErr) {
+				t.Fatalf("HealthCheck() error = %v, want *AdapterError", err)
+			}
+			if adapterErr.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", adapterErr.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_ListModels(t *testing.T) {
+	pages := map[string]string{
+		"":       `{"models":[{"name":"models/gemini-1.5-pro"},{"name":"models/gemini-1.5-flash"}],"nextPageToken":"page-2"}`,
+		"page-2": `{"models":[{"name":"models/text-embedding-004"}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/models" || r.URL.Query().Get("key") != "test-api-key" {
+			t.Errorf("request = %s %s, want GET /models with the key", r.Method, r.URL)
+		}
+		w.Write([]byte(pages[r.URL.Query().Get("pageToken")]))
+	}))
+	defer server.Close()
+
+	ids, err := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL)).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if want := []string{"gemini-1.5-pro", "gemini-1.5-flash", "text-embedding-004"}; !slices.Equal(ids, want) {
+		t.Errorf("ListModels() = %v, want %v", ids, want)
+	}
+}
+
+func TestGeminiAdapter_ForwardUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		forward bool
+		user    string
+		want    string
+	}{
+		{"enabled", true, "user-42", "user-42"},
+		{"disabled", false, "user-42", ""},
+		{"control characters stripped", true, "user-42\r\nX-Injected: 1\x00", "user-42X-Injected: 1"},
+		{"nothing left", true, "\x01\x02", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Values(HeaderUserID)
+				w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+			}))
+			defer server.Close()
+
+			a := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL), WithForwardUser(tt.forward))
+			req := OpenAIRequest{Model: "gpt-4", Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}, User: tt.user}
+			if _, err := a.ChatCompletion(context.Background(), req); err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Errorf("%s = %q, want no header", HeaderUserID, got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("%s = %q, want %q", HeaderUserID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_GoogleSearchGrounding(t *testing.T) {
+	var got GeminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"Spain won Euro 2024."}],"role":"model"},"finishReason":"STOP",` +
+			`"groundingMetadata":{"webSearchQueries":["who won euro 2024"],` +
+			`"groundingChunks":[{"web":{"uri":"https://example.com/euro","title":"example.com"}}],` +
+			`"searchEntryPoint":{"renderedContent":"<div>suggestions</div>"}}}]}`))
+	}))
+	defer server.Close()
+
+	a := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL), WithGoogleSearchGrounding(true))
+	req := OpenAIRequest{Model: "gpt-4", Messages: []OpenAIMessage{{Role: "user", Content: "Who won Euro 2024?"}}}
+	resp, err := a.ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ChatCompletion() error = %v", err)
+	}
+
+	if len(got.Tools) != 1 || got.Tools[0].GoogleSearch == nil {
+		t.Errorf("tools = %+v, want the googleSearch tool", got.Tools)
+	}
+	if content := resp.Choices[0].Message.Content; content != "Spain won Euro 2024." {
+		t.Errorf("content = %q, want the full text", content)
+	}
+	want := &GroundingMetadata{
+		WebSearchQueries: []string{"who won euro 2024"},
+		Sources:          []GroundingSource{{URI: "https://example.com/euro", Title: "example.com"}},
+		SearchEntryPoint: "<div>suggestions</div>",
+	}
+	if !reflect.DeepEqual(resp.Choices[0].GroundingMetadata, want) {
+		t.Errorf("grounding metadata = %+v, want %+v", resp.Choices[0].GroundingMetadata, want)
+	}
+	data, err := json.Marshal(resp.Choices[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"grounding_metadata":{"web_search_queries":["who won euro 2024"]`) {
+		t.Errorf("choice JSON = %s, want grounding_metadata", data)
+	}
+}
+
+func TestGeminiAdapter_GoogleSearchGroundingOff(t *testing.T) {
+	g := NewGeminiAdapter("test-api-key")
+	req := OpenAIRequest{Model: "gpt-4", Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}}
+	if tools := g.mapToGeminiRequest(req).Tools; len(tools) != 0 {
+		t.Errorf("tools = %+v, want none", tools)
+	}
+}
+
+func TestSanitizeUserID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"  alice  ", "alice"},
+		{"ali\tce\n", "alice"},
+		{"ålice", "lice"},
+		{strings.Repeat("a", MaxUserIDLength+10), strings.Repeat("a", MaxUserIDLength)},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeUserID(tt.in); got != tt.want {
+			t.Errorf("SanitizeUserID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGeminiAdapter_mapMaxTokens(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	tests := []struct {
+		name          string
+		defaultTokens int
+		maxAllowed    int
+		maxTokens     *int
+		maxCompletion *int
+		want          *int
+	}{
+		{"no limit", 0, 0, nil, nil, nil},
+		{"default injected", 1024, 0, nil, nil, intPtr(1024)},
+		{"explicit passes through", 1024, 0, intPtr(50), nil, intPtr(50)},
+		{"max_completion_tokens wins", 1024, 0, intPtr(50), intPtr(70), intPtr(70)},
+		{"clamped above maximum", 0, 2048, intPtr(100000), nil, intPtr(2048)},
+		{"below maximum kept", 0, 2048, intPtr(2000), nil, intPtr(2000)},
+		{"default clamped", 4096, 2048, nil, nil, intPtr(2048)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			a := NewGeminiAdapter("test-api-key",
+				WithDefaultMaxTokens(tt.defaultTokens),
+				WithMaxAllowedTokens(tt.maxAllowed),
+				WithAdapterLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+			)
+			req := a.mapToGeminiRequest(OpenAIRequest{
+				Model:               "gpt-4",
+				Messages:            []OpenAIMessage{{Role: "user", Content: "Hi"}},
+				MaxTokens:           tt.maxTokens,
+				MaxCompletionTokens: tt.maxCompletion,
+			})
+
+			got := req.GenerationConfig.MaxOutputTokens
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Fatalf("MaxOutputTokens = %v, want %v", deref(got), deref(tt.want))
+			}
+			clamped := strings.Contains(logs.String(), "max_tokens above maximum")
+			if want := tt.maxAllowed > 0 && tt.want != nil && *tt.want == tt.maxAllowed; clamped != want {
+				t.Errorf("clamp warning logged = %v, want %v:\n%s", clamped, want, logs.String())
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_resolveMaxOutputTokens(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	a := NewGeminiAdapter("test-api-key", WithDefaultMaxTokens(4096), WithFlashDefaultMaxTokens(1024))
+	tests := []struct {
+		name      string
+		model     string
+		maxTokens *int
+		want      int
+	}{
+		{"flash default", "gpt-4o", nil, 1024},
+		{"flash 8b default", "gpt-4o-mini", nil, 1024},
+		{"pro default", "gpt-4", nil, 4096},
+		{"explicit on flash", "gemini-1.5-flash", intPtr(50), 50},
+		{"explicit on pro", "gemini-1.5-pro", intPtr(8000), 8000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := a.mapToGeminiRequest(OpenAIRequest{
+				Model:     tt.model,
+				Messages:  []OpenAIMessage{{Role: "user", Content: "Hi"}},
+				MaxTokens: tt.maxTokens,
+			})
+			if got := req.GenerationConfig.MaxOutputTokens; got == nil || *got != tt.want {
+				t.Errorf("MaxOutputTokens = %v, want %d", deref(got), tt.want)
+			}
+		})
+	}
+
+	// Without a Flash default, Flash models use the general one.
+	b := NewGeminiAdapter("test-api-key", WithDefaultMaxTokens(4096))
+	if got := b.resolveMaxOutputTokens(OpenAIRequest{}, "gemini-1.5-flash"); got == nil || *got != 4096 {
+		t.Errorf("resolveMaxOutputTokens() = %v, want 4096", deref(got))
+	}
+}
+
+func TestGeminiAdapter_WarmUp(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.Contains(r.URL.Path, "missing-model") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"message":"model not found","status":"NOT_FOUND"}}`))
+			return
+		}
+		w.Write([]byte(`{"totalTokens":1}`))
+	}))
+	defer server.Close()
+	a := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL))
+
+	if err := a.WarmUp(context.Background(), []string{"gemini-1.5-flash", "gemini-1.5-pro"}); err != nil {
+		t.Fatalf("WarmUp() error = %v", err)
+	}
+	want := []string{"/models/gemini-1.5-flash:countTokens", "/models/gemini-1.5-pro:countTokens"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("requests = %v, want %v", paths, want)
+	}
+
+	paths = nil
+	err := a.WarmUp(context.Background(), []string{"missing-model", "gemini-1.5-pro"})
+	var adapterErr *AdapterError
+	if !errors.As(err, &adapterErr) || adapterErr.StatusCode != http.StatusNotFound {
+		t.Errorf("WarmUp() error = %v, want the 404 answer", err)
+	}
+	if len(paths) != 1 {
+		t.Errorf("requests = %v, want to stop at the first error", paths)
+	}
+
+	paths = nil
+	if err := a.WarmUp(context.Background(), nil); err != nil || len(paths) != 1 || paths[0] != "/models" {
+		t.Errorf("WarmUp(nil) = %v with requests %v, want one health check", err, paths)
+	}
+}
@@ -0,0 +1,11 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/hpn/hpn-g-router/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
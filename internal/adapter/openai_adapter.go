@@ -0,0 +1,122 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// DefaultOpenAIBaseURL is the default OpenAI API endpoint.
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIAdapter talks to the OpenAI API. The router does not proxy requests
+// to OpenAI yet; the adapter checks that OpenAI keys work.
+type OpenAIAdapter struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// OpenAIAdapterOption is a functional option for configuring OpenAIAdapter.
+type OpenAIAdapterOption func(*OpenAIAdapter)
+
+// WithOpenAIBaseURL sets a custom base URL for the OpenAI API.
+func WithOpenAIBaseURL(url string) OpenAIAdapterOption {
+	return func(a *OpenAIAdapter) {
+		a.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithOpenAIHTTPClient sets the HTTP client requests are sent with.
+func WithOpenAIHTTPClient(client *http.Client) OpenAIAdapterOption {
+	return func(a *OpenAIAdapter) {
+		a.httpClient = client
+	}
+}
+
+// NewOpenAIAdapter creates a new OpenAIAdapter with the given API key.
+func NewOpenAIAdapter(apiKey string, opts ...OpenAIAdapterOption) *OpenAIAdapter {
+	a := &OpenAIAdapter{
+		apiKey:     apiKey,
+		baseURL:    DefaultOpenAIBaseURL,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Name returns the provider identifier.
+func (a *OpenAIAdapter) Name() string {
+	return "openai"
+}
+
+// HealthCheck lists the models the key can use and returns nil when OpenAI
+// answers 200. Other answers are returned as *AdapterError.
+func (a *OpenAIAdapter) HealthCheck(ctx context.Context) error {
+	_, err := a.ListModels(ctx)
+	return err
+}
+
+// WarmUp lists the models the key can use and returns an error when the
+// request fails or one of models is missing from the list.
+func (a *OpenAIAdapter) WarmUp(ctx context.Context, models []string) error {
+	ids, err := a.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+	for _, model := range models {
+		if !slices.Contains(ids, model) {
+			return fmt.Errorf("warm up %s: model not available to the key", model)
+		}
+	}
+	return nil
+}
+
+// ListModels returns the IDs of the models the key can use, from GET
+// /models. Non-200 responses are returned as *AdapterError.
+func (a *OpenAIAdapter) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+a.apiKey)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute openai request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read openai response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var openAIErr OpenAIError
+		if err := json.Unmarshal(body, &openAIErr); err == nil && openAIErr.Error.Message != "" {
+			var code string
+			if openAIErr.Error.Code != nil {
+				code = *openAIErr.Error.Code
+			}
+			return nil, newAdapterError(resp.StatusCode, code, openAIErr.Error.Message)
+		}
+		return nil, newAdapterError(resp.StatusCode, "", string(body))
+	}
+
+	var list OpenAIModelList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal openai response: %w", err)
+	}
+	ids := make([]string, len(list.Data))
+	for i, m := range list.Data {
+		ids[i] = m.ID
+	}
+	return ids, nil
+}
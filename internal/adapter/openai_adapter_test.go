@@ -0,0 +1,62 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIAdapter_ListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/models" {
+			t.Errorf("request = %s %s, want GET /v1/models", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got == "Bearer sk-bad" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`))
+			return
+		}
+		w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4","object":"model"},{"id":"gpt-4o","object":"model"}]}`))
+	}))
+	defer server.Close()
+
+	models, err := NewOpenAIAdapter("sk-good", WithOpenAIBaseURL(server.URL+"/v1/")).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if len(models) != 2 || models[0] != "gpt-4" {
+		t.Errorf("ListModels() = %v, want [gpt-4 gpt-4o]", models)
+	}
+
+	_, err = NewOpenAIAdapter("sk-bad", WithOpenAIBaseURL(server.URL+"/v1")).ListModels(context.Background())
+	var adapterErr *AdapterError
+	if !errors.As(err, &adapterErr) {
+		t.Fatalf("ListModels() error = %v, want *AdapterError", err)
+	}
+	if adapterErr.StatusCode != http.StatusUnauthorized || adapterErr.ProviderCode != "invalid_api_key" {
+		t.Errorf("error = %+v, want 401 invalid_api_key", adapterErr)
+	}
+}
+
+func TestOpenAIAdapter_HealthCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error"}}`))
+			return
+		}
+		w.Write([]byte(`{"object":"list","data":[]}`))
+	}))
+	defer server.Close()
+
+	if err := NewOpenAIAdapter("sk-good", WithOpenAIBaseURL(server.URL)).HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck() error = %v, want nil", err)
+	}
+	var adapterErr *AdapterError
+	err := NewOpenAIAdapter("sk-bad", WithOpenAIBaseURL(server.URL)).HealthCheck(context.Background())
+	if !errors.As(err, &adapterErr) || adapterErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("HealthCheck() error = %v, want a 401 *AdapterError", err)
+	}
+}
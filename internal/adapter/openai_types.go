@@ -1,6 +1,17 @@
 // Package adapter provides implementations for external AI provider integrations.
 package adapter
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidResponse indicates a provider returned a structurally invalid response.
+var ErrInvalidResponse = errors.New("invalid provider response")
+
 // OpenAI-compatible request/response types.
 // These types mirror the OpenAI API format for maximum compatibility.
 
@@ -18,6 +29,10 @@ type OpenAIRequest struct {
 	// MaxTokens limits the response length. Optional.
 	MaxTokens *int `json:"max_tokens,omitempty"`
 
+	// MaxCompletionTokens replaces MaxTokens in newer clients and takes
+	// precedence over it. Optional.
+	MaxCompletionTokens *int `json:"max_completion_tokens,omitempty"`
+
 	// TopP is nucleus sampling parameter. Optional.
 	TopP *float64 `json:"top_p,omitempty"`
 
@@ -28,7 +43,7 @@ type OpenAIRequest struct {
 	Stream bool `json:"stream,omitempty"`
 
 	// Stop sequences to halt generation. Optional.
-	Stop []string `json:"stop,omitempty"`
+	Stop StopSequences `json:"stop,omitempty"`
 
 	// PresencePenalty penalizes new tokens based on presence in text. Optional.
 	PresencePenalty *float64 `json:"presence_penalty,omitempty"`
@@ -38,21 +53,262 @@ type OpenAIRequest struct {
 
 	// User is a unique identifier for the end-user. Optional.
 	User string `json:"user,omitempty"`
+
+	// Logprobs asks for the log probability of each output token. Optional.
+	Logprobs bool `json:"logprobs,omitempty"`
+
+	// Tools lists the functions the model may call. Optional.
+	Tools []OpenAITool `json:"tools,omitempty"`
+
+	// ToolChoice controls whether and which function the model calls.
+	// Optional; providers default to auto.
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+
+	// ParallelToolCalls set to false limits the model to one function call
+	// per turn. Optional.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+
+	// ResponseFormat asks for a particular output format, such as JSON.
+	// Optional.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// Response format types.
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+)
+
+// ResponseFormat is the output format a chat completion asks for.
+type ResponseFormat struct {
+	// Type is "text" or "json_object".
+	Type string `json:"type"`
+}
+
+// OpenAITool describes a function the model may call.
+type OpenAITool struct {
+	// Type is always "function".
+	Type string `json:"type"`
+
+	// Function is the function's name, description and parameters.
+	Function OpenAIFunctionDefinition `json:"function"`
+}
+
+// Tool choice modes.
+const (
+	ToolChoiceNone     = "none"
+	ToolChoiceAuto     = "auto"
+	ToolChoiceRequired = "required"
+)
+
+// ToolChoice is a chat completion's tool_choice: the string "none", "auto"
+// or "required", or {"type":"function","function":{"name":"fn"}} to make
+// the model call fn.
+type ToolChoice struct {
+	// Mode is ToolChoiceNone, ToolChoiceAuto or ToolChoiceRequired; empty
+	// when Function is set.
+	Mode string `json:"-"`
+
+	// Function is the function the model must call.
+	Function string `json:"-"`
+}
+
+// toolChoiceFunction is the object form of tool_choice.
+type toolChoiceFunction struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"`
+}
+
+// UnmarshalJSON decodes a tool choice mode or function object.
+func (c *ToolChoice) UnmarshalJSON(data []byte) error {
+	var mode string
+	if err := json.Unmarshal(data, &mode); err == nil {
+		switch mode {
+		case ToolChoiceNone, ToolChoiceAuto, ToolChoiceRequired:
+			*c = ToolChoice{Mode: mode}
+			return nil
+		}
+		return fmt.Errorf("tool_choice %q must be none, auto or required", mode)
+	}
+
+	var fn toolChoiceFunction
+	if err := json.Unmarshal(data, &fn); err != nil || fn.Type != "function" || fn.Function.Name == "" {
+		return errors.New(`tool_choice must be none, auto, required or {"type":"function","function":{"name":...}}`)
+	}
+	*c = ToolChoice{Function: fn.Function.Name}
+	return nil
+}
+
+// MarshalJSON encodes c in the form it was sent in.
+func (c ToolChoice) MarshalJSON() ([]byte, error) {
+	if c.Function == "" {
+		return json.Marshal(c.Mode)
+	}
+	fn := toolChoiceFunction{Type: "function"}
+	fn.Function.Name = c.Function
+	return json.Marshal(fn)
+}
+
+// OpenAIFunctionDefinition describes a callable function.
+type OpenAIFunctionDefinition struct {
+	// Name is the function name the model calls it by.
+	Name string `json:"name"`
+
+	// Description tells the model when to call the function. Optional.
+	Description string `json:"description,omitempty"`
+
+	// Parameters is the JSON Schema of the function's arguments. Optional.
+	Parameters map[string]any `json:"parameters,omitempty"`
+}
+
+// StopSequences accepts either a single stop string or an array of strings.
+type StopSequences []string
+
+// UnmarshalJSON decodes a JSON string or array of strings.
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("stop must be a string or an array of strings")
+	}
+	*s = many
+	return nil
 }
 
 // OpenAIMessage represents a single message in the conversation.
 type OpenAIMessage struct {
-	// Role is one of: "system", "user", "assistant", "function".
+	// Role is one of: "system", "user", "assistant", "tool", "function".
 	Role string `json:"role"`
 
-	// Content is the message text content.
+	// Content is the message text content. For content sent as an array of
+	// parts it is the text of the text parts, joined by newlines.
 	Content string `json:"content"`
 
+	// ContentParts is the content when sent as an array of parts, such as
+	// text and files. It is nil for content sent as a string.
+	ContentParts []OpenAIContentPart `json:"-"`
+
 	// Name is an optional name for the participant. Optional.
 	Name string `json:"name,omitempty"`
 
 	// FunctionCall contains function call information if role is "assistant". Optional.
 	FunctionCall *OpenAIFunctionCall `json:"function_call,omitempty"`
+
+	// ToolCalls lists the functions the model asked to call, if role is
+	// "assistant". Optional.
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+
+	// ToolCallID is the tool call a "tool" message answers. Optional.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// UnmarshalJSON decodes a message whose content is either a string or an
+// array of content parts.
+func (m *OpenAIMessage) UnmarshalJSON(data []byte) error {
+	type message OpenAIMessage
+	var raw struct {
+		message
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = OpenAIMessage(raw.message)
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw.Content, &m.Content); err == nil {
+		return nil
+	}
+
+	var parts []OpenAIContentPart
+	if err := json.Unmarshal(raw.Content, &parts); err != nil {
+		return errors.New("content must be a string or an array of content parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == ContentPartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	m.Content = strings.Join(texts, "\n")
+	m.ContentParts = parts
+	return nil
+}
+
+// MarshalJSON encodes the content as an array when the message has
+// ContentParts, else as a string.
+func (m OpenAIMessage) MarshalJSON() ([]byte, error) {
+	type message OpenAIMessage
+	if len(m.ContentParts) == 0 {
+		return json.Marshal(message(m))
+	}
+	return json.Marshal(struct {
+		message
+		Content []OpenAIContentPart `json:"content"`
+	}{message(m), m.ContentParts})
+}
+
+// Content part types of OpenAIContentPart.
+const (
+	ContentPartText     = "text"
+	ContentPartImageURL = "image_url"
+	ContentPartFileURI  = "file_uri"
+)
+
+// OpenAIContentPart is one part of a message sent with array content.
+type OpenAIContentPart struct {
+	// Type is one of the ContentPart constants.
+	Type string `json:"type"`
+
+	// Text is the text of a "text" part.
+	Text string `json:"text,omitempty"`
+
+	// ImageURL is the image of an "image_url" part.
+	ImageURL string `json:"image_url,omitempty"`
+
+	// FileURI is the Cloud Storage URI (gs://bucket/object) of a "file_uri"
+	// part, such as a video, audio file or document.
+	FileURI string `json:"file_uri,omitempty"`
+
+	// MimeType is the media type of the file, e.g. "video/mp4".
+	MimeType string `json:"mime_type,omitempty"`
+}
+
+// ValidateContentParts checks the content parts of messages: only text and
+// file_uri parts are supported, and a file_uri part needs a Cloud Storage
+// URI and a media type.
+func ValidateContentParts(messages []OpenAIMessage) error {
+	for i, msg := range messages {
+		for j, part := range msg.ContentParts {
+			switch part.Type {
+			case ContentPartText:
+			case ContentPartFileURI:
+				if !isGCSURI(part.FileURI) {
+					return fmt.Errorf("messages[%d].content[%d].file_uri must be a Cloud Storage URI such as gs://bucket/object", i, j)
+				}
+				if part.MimeType == "" {
+					return fmt.Errorf("messages[%d].content[%d].mime_type is required", i, j)
+				}
+			default:
+				return fmt.Errorf("messages[%d].content[%d].type %q is not supported; use text or file_uri", i, j, part.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// isGCSURI reports whether uri names an object in a Cloud Storage bucket.
+func isGCSURI(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && u.Scheme == "gs" && u.Host != "" && strings.Trim(u.Path, "/") != ""
 }
 
 // OpenAIFunctionCall represents a function call made by the model.
@@ -64,6 +320,18 @@ type OpenAIFunctionCall struct {
 	Arguments string `json:"arguments"`
 }
 
+// OpenAIToolCall represents a tool call made by the model.
+type OpenAIToolCall struct {
+	// ID identifies the call, for the tool message answering it.
+	ID string `json:"id"`
+
+	// Type is always "function".
+	Type string `json:"type"`
+
+	// Function is the function to call and its arguments.
+	Function OpenAIFunctionCall `json:"function"`
+}
+
 // OpenAIResponse represents an OpenAI chat completion response.
 type OpenAIResponse struct {
 	// ID is the unique identifier for this completion.
@@ -84,8 +352,33 @@ type OpenAIResponse struct {
 	// Usage contains token usage statistics.
 	Usage OpenAIUsage `json:"usage"`
 
-	// SystemFingerprint is the backend configuration fingerprint. Optional.
+	// SystemFingerprint identifies the provider, provider model and router
+	// version that produced the response. It changes when a model is mapped
+	// to a different backend.
 	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+
+	// InternalModel is the provider model the request was sent to, such as
+	// "gemini-1.5-pro" for "gpt-4". It is not sent in the body; the
+	// handler returns it in X-Actual-Model.
+	InternalModel string `json:"-"`
+}
+
+// ValidateOpenAIResponse checks that a response is structurally sound before it
+// reaches the client: at least one choice, every choice has a role, and token
+// usage is not negative. Errors wrap ErrInvalidResponse.
+func ValidateOpenAIResponse(r OpenAIResponse) error {
+	if len(r.Choices) == 0 {
+		return fmt.Errorf("%w: choices is empty", ErrInvalidResponse)
+	}
+	for i, c := range r.Choices {
+		if c.Message.Role == "" {
+			return fmt.Errorf("%w: choices[%d].message.role is empty", ErrInvalidResponse, i)
+		}
+	}
+	if r.Usage.TotalTokens < 0 {
+		return fmt.Errorf("%w: usage.total_tokens is negative (%d)", ErrInvalidResponse, r.Usage.TotalTokens)
+	}
+	return nil
 }
 
 // OpenAIChoice represents a single completion choice.
@@ -97,11 +390,123 @@ type OpenAIChoice struct {
 	Message OpenAIMessage `json:"message"`
 
 	// FinishReason indicates why the model stopped generating.
-	// Values: "stop", "length", "function_call", "content_filter", null.
+	// Values: "stop", "length", "function_call", "tool_calls", "content_filter", null.
 	FinishReason string `json:"finish_reason"`
 
-	// Logprobs contains log probability information. Optional.
-	Logprobs interface{} `json:"logprobs,omitempty"`
+	// Logprobs contains log probability information. It is null unless the
+	// request set logprobs and the provider reports them.
+	Logprobs *OpenAILogprobs `json:"logprobs"`
+
+	// Blocked is set when the provider's safety filter blocked the prompt.
+	// It is not sent to clients.
+	Blocked bool `json:"-"`
+
+	// GroundingMetadata lists the web searches and sources behind an answer
+	// grounded in Google Search. It is a vendor extension, omitted for
+	// answers that were not grounded.
+	GroundingMetadata *GroundingMetadata `json:"grounding_metadata,omitempty"`
+}
+
+// GroundingMetadata describes how a choice was grounded in search results.
+type GroundingMetadata struct {
+	// WebSearchQueries are the searches the model ran.
+	WebSearchQueries []string `json:"web_search_queries,omitempty"`
+
+	// Sources are the web pages the answer draws on.
+	Sources []GroundingSource `json:"sources,omitempty"`
+
+	// SearchEntryPoint is HTML with the search suggestions Google requires
+	// to be shown next to a grounded answer.
+	SearchEntryPoint string `json:"search_entry_point,omitempty"`
+}
+
+// GroundingSource is a web page a grounded answer draws on.
+type GroundingSource struct {
+	URI   string `json:"uri"`
+	Title string `json:"title,omitempty"`
+}
+
+// OpenAIChatCompletionChunk is one server-sent event of a streamed chat
+// completion.
+type OpenAIChatCompletionChunk struct {
+	// ID is the same for every chunk of a completion.
+	ID string `json:"id"`
+
+	// Object is always "chat.completion.chunk".
+	Object string `json:"object"`
+
+	// Created is the Unix timestamp of when the completion was created.
+	Created int64 `json:"created"`
+
+	// Model is the model used for completion.
+	Model string `json:"model"`
+
+	// Choices holds the part of each choice this chunk adds.
+	Choices []OpenAIChunkChoice `json:"choices"`
+
+	// SystemFingerprint is the response's SystemFingerprint.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+}
+
+// OpenAIChunkChoice is the part of one choice carried by a chunk.
+type OpenAIChunkChoice struct {
+	// Index is the position of the choice in the list.
+	Index int `json:"index"`
+
+	// Delta is the message text and tool calls added by this chunk.
+	Delta OpenAIMessageDelta `json:"delta"`
+
+	// FinishReason is set on the choice's last chunk and null before it.
+	FinishReason *string `json:"finish_reason"`
+
+	// GroundingMetadata is the choice's GroundingMetadata, sent with its
+	// last chunk.
+	GroundingMetadata *GroundingMetadata `json:"grounding_metadata,omitempty"`
+}
+
+// OpenAIMessageDelta is the part of a message carried by a chunk.
+type OpenAIMessageDelta struct {
+	// Role is set on the choice's first chunk.
+	Role string `json:"role,omitempty"`
+
+	// Content is the text added by the chunk.
+	Content string `json:"content,omitempty"`
+
+	// ToolCalls lists the functions the model asked to call.
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+}
+
+// OpenAILogprobs holds the log probabilities of a choice's tokens.
+type OpenAILogprobs struct {
+	// Content lists the output tokens in order.
+	Content []OpenAITokenLogprob `json:"content"`
+}
+
+// OpenAITokenLogprob is the log probability of one output token.
+type OpenAITokenLogprob struct {
+	// Token is the token text.
+	Token string `json:"token"`
+
+	// Logprob is the log probability of the token.
+	Logprob float64 `json:"logprob"`
+
+	// Bytes is the UTF-8 encoding of the token, null if it has none.
+	Bytes []int `json:"bytes"`
+
+	// TopLogprobs lists the most likely tokens at this position.
+	TopLogprobs []OpenAITopLogprob `json:"top_logprobs"`
+}
+
+// OpenAITopLogprob is one of the most likely tokens at a position.
+type OpenAITopLogprob struct {
+	// Token is the token text.
+	Token string `json:"token"`
+
+	// Logprob is the log probability of the token.
+	Logprob float64 `json:"logprob"`
+
+	// Bytes is the UTF-8 encoding of the token, null if it has none.
+	Bytes []int `json:"bytes"`
 }
 
 // OpenAIUsage contains token usage statistics.
@@ -129,9 +534,121 @@ type OpenAIErrorDetail struct {
 	// Type categorizes the error (e.g., "invalid_request_error").
 	Type string `json:"type"`
 
-	// Param is the parameter that caused the error. Optional.
-	Param string `json:"param,omitempty"`
+	// Param is the parameter that caused the error. Serialized as null when unset.
+	Param *string `json:"param"`
+
+	// Code is the error code. Serialized as null when unset.
+	Code *string `json:"code"`
+
+	// Details describes how the router tried to serve the request, a
+	// non-standard extension for debugging. Serialized as null unless the
+	// router is set to report it.
+	Details *OpenAIErrorDetails `json:"details"`
+}
+
+// OpenAIErrorDetails describes the key attempts behind a failed request.
+type OpenAIErrorDetails struct {
+	// Attempts is the number of provider calls made.
+	Attempts int `json:"attempts"`
+
+	// KeysTried is the number of distinct keys those calls used.
+	KeysTried int `json:"keys_tried"`
+
+	// LastErrorType is the category of the last error, such as
+	// "rate_limit".
+	LastErrorType string `json:"last_error_type"`
+}
+
+// OpenAIModelList represents the response of the models listing endpoint.
+type OpenAIModelList struct {
+	// Object is always "list".
+	Object string `json:"object"`
+
+	// Data contains the available models.
+	Data []OpenAIModel `json:"data"`
+}
+
+// OpenAIModel describes a single model available through the router.
+type OpenAIModel struct {
+	// ID is the model identifier clients pass in requests.
+	ID string `json:"id"`
+
+	// Object is always "model".
+	Object string `json:"object"`
+
+	// Created is the Unix timestamp of when the model was published.
+	Created int64 `json:"created"`
+
+	// OwnedBy is the organization that owns the model.
+	OwnedBy string `json:"owned_by"`
+}
 
-	// Code is the error code. Optional.
-	Code string `json:"code,omitempty"`
+// OpenAIEmbeddingRequest represents an OpenAI embeddings request.
+type OpenAIEmbeddingRequest struct {
+	// Model specifies which embedding model to use (e.g., "text-embedding-3-small").
+	Model string `json:"model"`
+
+	// Input is the text to embed, either a single string or an array of strings.
+	Input EmbeddingInput `json:"input"`
+
+	// EncodingFormat is the format of the returned vectors. Only "float" is supported. Optional.
+	EncodingFormat string `json:"encoding_format,omitempty"`
+
+	// User is a unique identifier for the end-user. Optional.
+	User string `json:"user,omitempty"`
+}
+
+// EmbeddingInput accepts either a single string or an array of strings.
+type EmbeddingInput []string
+
+// UnmarshalJSON decodes a JSON string or array of strings.
+func (e *EmbeddingInput) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*e = EmbeddingInput{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("input must be a string or an array of strings")
+	}
+	*e = many
+	return nil
+}
+
+// OpenAIEmbeddingResponse represents an OpenAI embeddings response.
+type OpenAIEmbeddingResponse struct {
+	// Object is always "list".
+	Object string `json:"object"`
+
+	// Data contains one embedding per input, in input order.
+	Data []OpenAIEmbedding `json:"data"`
+
+	// Model is the model requested by the client.
+	Model string `json:"model"`
+
+	// Usage contains token usage statistics.
+	Usage OpenAIEmbeddingUsage `json:"usage"`
+}
+
+// OpenAIEmbedding is a single embedding vector.
+type OpenAIEmbedding struct {
+	// Object is always "embedding".
+	Object string `json:"object"`
+
+	// Index is the position of the corresponding input.
+	Index int `json:"index"`
+
+	// Embedding is the vector itself.
+	Embedding []float64 `json:"embedding"`
+}
+
+// OpenAIEmbeddingUsage contains token usage statistics for an embeddings request.
+type OpenAIEmbeddingUsage struct {
+	// PromptTokens is the number of tokens in the input.
+	PromptTokens int `json:"prompt_tokens"`
+
+	// TotalTokens equals PromptTokens for embeddings.
+	TotalTokens int `json:"total_tokens"`
 }
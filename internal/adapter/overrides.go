@@ -0,0 +1,90 @@
+package adapter
+
+import "context"
+
+// Gemini harm categories that safety thresholds apply to.
+var GeminiHarmCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+// Gemini safety thresholds, from most to least permissive.
+const (
+	SafetyBlockNone           = "BLOCK_NONE"
+	SafetyBlockOnlyHigh       = "BLOCK_ONLY_HIGH"
+	SafetyBlockMediumAndAbove = "BLOCK_MEDIUM_AND_ABOVE"
+	SafetyBlockLowAndAbove    = "BLOCK_LOW_AND_ABOVE"
+)
+
+// IsValidSafetyThreshold reports whether t is a Gemini safety threshold.
+func IsValidSafetyThreshold(t string) bool {
+	switch t {
+	case SafetyBlockNone, SafetyBlockOnlyHigh, SafetyBlockMediumAndAbove, SafetyBlockLowAndAbove:
+		return true
+	}
+	return false
+}
+
+// SafetySettingsFor returns one setting per harm category, all at threshold.
+func SafetySettingsFor(threshold string) []GeminiSafetySetting {
+	settings := make([]GeminiSafetySetting, len(GeminiHarmCategories))
+	for i, category := range GeminiHarmCategories {
+		settings[i] = GeminiSafetySetting{Category: category, Threshold: threshold}
+	}
+	return settings
+}
+
+// GenerationOverrides carries Gemini-specific settings for a single request
+// that have no OpenAI equivalent. Zero values leave the adapter defaults alone.
+type GenerationOverrides struct {
+	// TopK overrides GenerationConfig.TopK.
+	TopK *int
+
+	// SafetyThreshold applies one threshold to every harm category.
+	SafetyThreshold string
+
+	// ThinkingBudget sets GenerationConfig.ThinkingConfig.ThinkingBudget.
+	ThinkingBudget *int
+}
+
+type overridesKey struct{}
+
+// WithGenerationOverrides returns a context carrying per-request overrides for
+// GeminiAdapter.ChatCompletion.
+func WithGenerationOverrides(ctx context.Context, o GenerationOverrides) context.Context {
+	return context.WithValue(ctx, overridesKey{}, o)
+}
+
+// generationOverridesFrom returns the overrides stored in ctx, if any.
+func generationOverridesFrom(ctx context.Context) GenerationOverrides {
+	o, _ := ctx.Value(overridesKey{}).(GenerationOverrides)
+	return o
+}
+
+// applyOverrides sets the adapter defaults and then the per-request overrides on req.
+func (g *GeminiAdapter) applyOverrides(ctx context.Context, req *GeminiRequest) {
+	if g.defaultTopK > 0 {
+		k := g.defaultTopK
+		req.GenerationConfig.TopK = &k
+	}
+	if g.thinkingBudget != nil {
+		n := *g.thinkingBudget
+		req.GenerationConfig.ThinkingConfig = &GeminiThinkingConfig{ThinkingBudget: &n}
+	}
+	if len(g.safetySettings) > 0 {
+		req.SafetySettings = append([]GeminiSafetySetting(nil), g.safetySettings...)
+	}
+
+	o := generationOverridesFrom(ctx)
+	if o.TopK != nil {
+		req.GenerationConfig.TopK = o.TopK
+	}
+	if o.ThinkingBudget != nil {
+		req.GenerationConfig.ThinkingConfig = &GeminiThinkingConfig{ThinkingBudget: o.ThinkingBudget}
+	}
+	if o.SafetyThreshold != "" {
+		req.SafetySettings = SafetySettingsFor(o.SafetyThreshold)
+	}
+}
@@ -0,0 +1,138 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// captureGemini records the last GeminiRequest it received.
+func captureGemini(t *testing.T) (*httptest.Server, *GeminiRequest) {
+	t.Helper()
+
+	var got GeminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GeminiRequest{}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+func TestGeminiAdapter_ChatCompletion_Overrides(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultTopK int
+		defaults    []GeminiSafetySetting
+		overrides   *GenerationOverrides
+		wantTopK    *int
+		wantSafety  []GeminiSafetySetting
+	}{
+		{name: "no default, no override"},
+		{name: "server default", defaultTopK: 40, wantTopK: ptrInt(40)},
+		{name: "override wins", defaultTopK: 40, overrides: &GenerationOverrides{TopK: ptrInt(5)}, wantTopK: ptrInt(5)},
+		{name: "override without default", overrides: &GenerationOverrides{TopK: ptrInt(1)}, wantTopK: ptrInt(1)},
+		{
+			name:       "safety threshold",
+			overrides:  &GenerationOverrides{SafetyThreshold: SafetyBlockOnlyHigh},
+			wantSafety: SafetySettingsFor(SafetyBlockOnlyHigh),
+		},
+		{
+			name:       "safety defaults",
+			defaults:   SafetySettingsFor(SafetyBlockNone),
+			wantSafety: SafetySettingsFor(SafetyBlockNone),
+		},
+		{
+			name:       "safety override replaces defaults",
+			defaults:   SafetySettingsFor(SafetyBlockNone),
+			overrides:  &GenerationOverrides{SafetyThreshold: SafetyBlockLowAndAbove},
+			wantSafety: SafetySettingsFor(SafetyBlockLowAndAbove),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, got := captureGemini(t)
+			adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL), WithDefaultTopK(tt.defaultTopK), WithSafetySettings(tt.defaults))
+
+			ctx := context.Background()
+			if tt.overrides != nil {
+				ctx = WithGenerationOverrides(ctx, *tt.overrides)
+			}
+			_, err := adapter.ChatCompletion(ctx, OpenAIRequest{
+				Model:    "gpt-4",
+				Messages: []OpenAIMessage{{Role: "user", Content: "hello"}},
+			})
+			if err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got.GenerationConfig.TopK, tt.wantTopK) {
+				t.Errorf("TopK = %v, want %v", deref(got.GenerationConfig.TopK), deref(tt.wantTopK))
+			}
+			if !reflect.DeepEqual(got.SafetySettings, tt.wantSafety) {
+				t.Errorf("SafetySettings = %v, want %v", got.SafetySettings, tt.wantSafety)
+			}
+		})
+	}
+}
+
+func TestGeminiAdapter_ChatCompletion_ThinkingBudget(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultBudget int
+		overrides     *GenerationOverrides
+		want          *int
+	}{
+		{name: "no default", defaultBudget: -1},
+		{name: "server default", defaultBudget: 2048, want: ptrInt(2048)},
+		{name: "default off", defaultBudget: 0, want: ptrInt(0)},
+		{name: "default capped", defaultBudget: MaxGeminiThinkingBudget + 1, want: ptrInt(MaxGeminiThinkingBudget)},
+		{name: "override wins", defaultBudget: 2048, overrides: &GenerationOverrides{ThinkingBudget: ptrInt(0)}, want: ptrInt(0)},
+		{name: "override without default", defaultBudget: -1, overrides: &GenerationOverrides{ThinkingBudget: ptrInt(512)}, want: ptrInt(512)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, got := captureGemini(t)
+			adapter := NewGeminiAdapter("test-api-key", WithBaseURL(server.URL), WithDefaultThinkingBudget(tt.defaultBudget))
+
+			ctx := context.Background()
+			if tt.overrides != nil {
+				ctx = WithGenerationOverrides(ctx, *tt.overrides)
+			}
+			_, err := adapter.ChatCompletion(ctx, OpenAIRequest{
+				Model:    "gpt-4",
+				Messages: []OpenAIMessage{{Role: "user", Content: "hello"}},
+			})
+			if err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+
+			var budget *int
+			if tc := got.GenerationConfig.ThinkingConfig; tc != nil {
+				budget = tc.ThinkingBudget
+			}
+			if !reflect.DeepEqual(budget, tt.want) {
+				t.Errorf("ThinkingBudget = %v, want %v", deref(budget), deref(tt.want))
+			}
+		})
+	}
+}
+
+func TestSafetySettingsFor(t *testing.T) {
+	settings := SafetySettingsFor(SafetyBlockNone)
+
+	if len(settings) != len(GeminiHarmCategories) {
+		t.Fatalf("len(settings) = %d, want %d", len(settings), len(GeminiHarmCategories))
+	}
+	for i, s := range settings {
+		if s.Category != GeminiHarmCategories[i] || s.Threshold != SafetyBlockNone {
+			t.Errorf("settings[%d] = %+v, want {%s %s}", i, s, GeminiHarmCategories[i], SafetyBlockNone)
+		}
+	}
+}
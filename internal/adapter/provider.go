@@ -16,4 +16,17 @@ type AIProvider interface {
 
 	// Name returns the provider's identifier string.
 	Name() string
+
+	// HealthCheck reports whether the provider accepts the adapter's key,
+	// without spending quota on a completion. Provider rejections are
+	// returned as *AdapterError.
+	HealthCheck(ctx context.Context) error
+
+	// WarmUp checks before serving that the key works for each of models
+	// and returns the first error. Without models it is HealthCheck.
+	WarmUp(ctx context.Context, models []string) error
+
+	// ListModels returns the IDs of the models the adapter's key can use.
+	// Provider rejections are returned as *AdapterError.
+	ListModels(ctx context.Context) ([]string, error)
 }
@@ -0,0 +1,87 @@
+package adapter
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// ResponseCache remembers the last mapped response for each distinct request an
+// adapter sent, together with the generation_id Gemini returned for it. The next
+// identical request is sent with If-None-Match so Gemini can answer 304.
+//
+// It belongs to a single API key, unlike the handler's FlashCache, which is
+// shared and keyed only by request body. Adapters created for the same key
+// can share one through WithResponseCache.
+type ResponseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List // front is most recently used
+	entries    map[string]*list.Element
+}
+
+type responseCacheEntry struct {
+	key          string
+	generationID string
+	response     OpenAIResponse
+}
+
+// NewResponseCache returns an empty cache keeping up to maxEntries responses.
+func NewResponseCache(maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// requestKey identifies a Gemini request by model and body.
+func requestKey(model string, req GeminiRequest) string {
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(append([]byte(model+"\n"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the entry for key and marks it most recently used.
+func (c *ResponseCache) get(key string) (responseCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return responseCacheEntry{}, false
+	}
+	c.order.MoveToFront(el)
+	return *el.Value.(*responseCacheEntry), true
+}
+
+// put stores a response, evicting the least recently used entry when full.
+func (c *ResponseCache) put(key, generationID string, resp OpenAIResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*responseCacheEntry)
+		entry.generationID = generationID
+		entry.response = resp
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&responseCacheEntry{key: key, generationID: generationID, response: resp})
+
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+}
+
+// len returns the number of cached entries.
+func (c *ResponseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,57 @@
+package adapter
+
+import "testing"
+
+func TestResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewResponseCache(2)
+
+	c.put("a", "gen-a", OpenAIResponse{ID: "a"})
+	c.put("b", "gen-b", OpenAIResponse{ID: "b"})
+	c.get("a") // a is now more recent than b
+	c.put("c", "gen-c", OpenAIResponse{ID: "c"})
+
+	if c.len() != 2 {
+		t.Fatalf("len() = %d, want 2", c.len())
+	}
+	if _, ok := c.get("b"); ok {
+		t.Error("b still cached, want it evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("%s evicted, want it cached", key)
+		}
+	}
+}
+
+func TestResponseCache_PutReplaces(t *testing.T) {
+	c := NewResponseCache(2)
+
+	c.put("a", "gen-1", OpenAIResponse{ID: "first"})
+	c.put("a", "gen-2", OpenAIResponse{ID: "second"})
+
+	entry, ok := c.get("a")
+	if !ok {
+		t.Fatal("a not cached")
+	}
+	if entry.generationID != "gen-2" || entry.response.ID != "second" {
+		t.Errorf("entry = %s/%s, want gen-2/second", entry.generationID, entry.response.ID)
+	}
+	if c.len() != 1 {
+		t.Errorf("len() = %d, want 1", c.len())
+	}
+}
+
+func TestRequestKey(t *testing.T) {
+	req := GeminiRequest{Contents: []GeminiContent{{Role: "user", Parts: []GeminiPart{{Text: "hi"}}}}}
+	other := GeminiRequest{Contents: []GeminiContent{{Role: "user", Parts: []GeminiPart{{Text: "bye"}}}}}
+
+	if requestKey("gemini-1.5-flash", req) != requestKey("gemini-1.5-flash", req) {
+		t.Error("requestKey() differs for identical requests")
+	}
+	if requestKey("gemini-1.5-flash", req) == requestKey("gemini-1.5-pro", req) {
+		t.Error("requestKey() ignores the model")
+	}
+	if requestKey("gemini-1.5-flash", req) == requestKey("gemini-1.5-flash", other) {
+		t.Error("requestKey() ignores the request body")
+	}
+}
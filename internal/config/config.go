@@ -3,10 +3,17 @@
 package config
 
 import (
+	"compress/gzip"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 	"sync"
 
+	"github.com/hpn/hpn-g-router/internal/adapter"
 	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/security"
+	"github.com/hpn/hpn-g-router/internal/ui"
 )
 
 // Configuration holds all application configuration values.
@@ -22,6 +29,42 @@ type Configuration struct {
 
 	// Logging configuration
 	Logging LoggingConfig `json:"logging" mapstructure:"logging"`
+
+	// Admin API configuration
+	Admin AdminConfig `json:"admin" mapstructure:"admin"`
+
+	// Proxy behaviour configuration
+	Proxy ProxyConfig `json:"proxy" mapstructure:"proxy"`
+
+	// Outbound HTTP client configuration
+	HTTP HTTPConfig `json:"http" mapstructure:"http"`
+
+	// Model name handling
+	Models ModelsConfig `json:"models" mapstructure:"models"`
+
+	// Provider-specific request settings
+	Provider ProviderConfig `json:"provider" mapstructure:"provider"`
+
+	// Provider routing
+	Routing RoutingConfig `json:"routing" mapstructure:"routing"`
+
+	// Key event notifications
+	Notifications NotificationsConfig `json:"notifications" mapstructure:"notifications"`
+
+	// Metrics export
+	Metrics MetricsConfig `json:"metrics" mapstructure:"metrics"`
+
+	// Token estimation for the cost estimator
+	CostEstimation CostEstimationConfig `json:"cost_estimation" mapstructure:"cost_estimation"`
+
+	// Key checks run before serving
+	StartupChecks StartupChecksConfig `json:"startup_checks" mapstructure:"startup_checks"`
+
+	// Handling of sensitive request data
+	Security SecurityConfig `json:"security" mapstructure:"security"`
+
+	// Development and testing aids
+	Dev DevConfig `json:"dev" mapstructure:"dev"`
 }
 
 // ServerConfig holds server-specific configuration.
@@ -40,21 +83,182 @@ type ServerConfig struct {
 
 	// ShutdownTimeout is the maximum duration to wait for active connections to finish.
 	ShutdownTimeoutSeconds int `json:"shutdown_timeout_seconds" mapstructure:"shutdown_timeout_seconds"`
+
+	// QueueMaxSize is how many requests may wait while every key is busy.
+	// Further requests get 429.
+	QueueMaxSize int `json:"queue_max_size" mapstructure:"queue_max_size"`
+
+	// QueueTimeoutSeconds is how long a queued request waits for a key.
+	QueueTimeoutSeconds int `json:"queue_timeout_seconds" mapstructure:"queue_timeout_seconds"`
+
+	// WorkerPoolSize bounds how many proxy requests are processed at once.
+	// As many again may wait for a worker; beyond that requests get 503.
+	// 0 disables the pool.
+	WorkerPoolSize int `json:"worker_pool_size" mapstructure:"worker_pool_size"`
+
+	// PProfEnabled serves net/http/pprof on PProfPort. It only takes effect
+	// when logging.level is debug.
+	PProfEnabled bool `json:"pprof_enabled" mapstructure:"pprof_enabled"`
+
+	// PProfPort is the port for the pprof listener, separate from Port.
+	PProfPort int `json:"pprof_port" mapstructure:"pprof_port"`
+
+	// RecordPath is an NDJSON file every request/response pair is appended to
+	// for replay with cmd/replay. Empty disables recording.
+	RecordPath string `json:"record_path" mapstructure:"record_path"`
+
+	// TLSEnabled serves HTTPS on Port, using TLSCertFile and TLSKeyFile or,
+	// with TLSAutoCert, certificates from Let's Encrypt.
+	TLSEnabled  bool   `json:"tls_enabled" mapstructure:"tls_enabled"`
+	TLSCertFile string `json:"tls_cert_file" mapstructure:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file" mapstructure:"tls_key_file"`
+
+	// TLSAutoCert obtains and renews certificates for TLSAutoCertDomains
+	// from Let's Encrypt, caching them in TLSCacheDir. The server must be
+	// reachable on port 443 of those domains for the TLS-ALPN challenge.
+	TLSAutoCert        bool     `json:"tls_auto_cert" mapstructure:"tls_auto_cert"`
+	TLSAutoCertDomains []string `json:"tls_auto_cert_domains" mapstructure:"tls_auto_cert_domains"`
+	TLSAutoCertEmail   string   `json:"tls_auto_cert_email" mapstructure:"tls_auto_cert_email"`
+	TLSCacheDir        string   `json:"tls_cache_dir" mapstructure:"tls_cache_dir"`
+
+	// RequestIDHeader is the header request IDs are read from and echoed
+	// in, for gateways that use e.g. X-Correlation-ID.
+	RequestIDHeader string `json:"request_id_header" mapstructure:"request_id_header"`
+
+	// TrustedProxies lists the IPs and CIDR ranges of proxies whose
+	// X-Real-IP and X-Forwarded-For headers are believed.
+	TrustedProxies []string `json:"trusted_proxies" mapstructure:"trusted_proxies"`
+
+	// TrustedProxyCount is how many proxies forward each request; the
+	// client IP is that many addresses from the right of X-Forwarded-For.
+	// 0 takes the leftmost public address instead.
+	TrustedProxyCount int `json:"trusted_proxy_count" mapstructure:"trusted_proxy_count"`
+
+	// TrustedProxyHeader is the header trusted proxies pass the client IP
+	// in, e.g. CF-Connecting-IP behind Cloudflare or X-Real-IP behind nginx.
+	TrustedProxyHeader string `json:"trusted_proxy_header" mapstructure:"trusted_proxy_header"`
+
+	// CompressionLevel is the gzip level responses are compressed with for
+	// clients that accept gzip, from -2 (Huffman only) and -1 (default) to
+	// 9 (best). 0 disables compression.
+	CompressionLevel int `json:"compression_level" mapstructure:"compression_level"`
+
+	// CompressionMinSize is the smallest response body compressed, in bytes.
+	CompressionMinSize int `json:"compression_min_size" mapstructure:"compression_min_size"`
+}
+
+// DefaultEndpointRetries are the route retry counts used unless
+// key_pool.endpoint_retries sets the route. Embedding failures are rarely
+// transient, so they are not retried.
+var DefaultEndpointRetries = map[string]int{
+	"/v1/embeddings": 1,
+}
+
+// DefaultMaxContextTokens are the context windows used unless
+// key_pool.max_context_tokens sets the model.
+var DefaultMaxContextTokens = map[string]int{
+	"gpt-4":          8192,
+	"gemini-1.5-pro": 1048576,
 }
 
 // KeyPoolConfig holds API key pool configuration.
 type KeyPoolConfig struct {
-	// Strategy defines how keys are rotated (round-robin, random, weighted, least-used).
+	// Strategy defines how keys are rotated (round-robin, random, weighted, least-used, priority).
 	Strategy domain.RotationStrategy `json:"strategy" mapstructure:"strategy"`
 
+	// SecureRandom draws random key selection and revival jitter from
+	// crypto/rand, so the key in use cannot be predicted. It is slower than
+	// the default math/rand source.
+	SecureRandom bool `json:"secure_random" mapstructure:"secure_random"`
+
 	// Keys is the list of API keys.
 	Keys []domain.APIKey `json:"keys" mapstructure:"keys"`
 
+	// KeyFile is a file of API keys, one per line or a JSON array, read
+	// with LoadAPIKeysFromFile. Its keys replace Keys; HPN_API_KEYS takes
+	// precedence over it. Empty reads no file.
+	KeyFile string `json:"key_file" mapstructure:"key_file"`
+
 	// RetryCount is the number of times to retry with a different key on failure.
 	RetryCount int `json:"retry_count" mapstructure:"retry_count"`
 
+	// EndpointRetries overrides RetryCount for the routes it lists, keyed by
+	// route path such as "/v1/embeddings". Routes in DefaultEndpointRetries
+	// keep their default unless listed.
+	EndpointRetries map[string]int `json:"endpoint_retries" mapstructure:"endpoint_retries"`
+
+	// RetryableStatusCodes lists provider status codes that rotate to another
+	// key even though they are not retried by default, such as 400.
+	RetryableStatusCodes []int `json:"retryable_status_codes" mapstructure:"retryable_status_codes"`
+
+	// NonRetryableStatusCodes lists provider status codes returned to the
+	// client without trying another key, such as 500. It takes precedence
+	// over RetryableStatusCodes.
+	NonRetryableStatusCodes []int `json:"non_retryable_status_codes" mapstructure:"non_retryable_status_codes"`
+
 	// CooldownSeconds is the duration to wait before retrying an exhausted key.
 	CooldownSeconds int `json:"cooldown_seconds" mapstructure:"cooldown_seconds"`
+
+	// ProviderCooldownSeconds overrides CooldownSeconds for the keys of a
+	// provider, e.g. {openai: 600}. Providers missing from it use
+	// CooldownSeconds.
+	ProviderCooldownSeconds map[domain.ProviderType]int `json:"provider_cooldown_seconds" mapstructure:"provider_cooldown_seconds"`
+
+	// DecayAlpha is the EWMA smoothing factor used by the least-used strategy.
+	DecayAlpha float64 `json:"decay_alpha" mapstructure:"decay_alpha"`
+
+	// MaxBatchConcurrency caps how many batch completion items run at once.
+	MaxBatchConcurrency int `json:"max_batch_concurrency" mapstructure:"max_batch_concurrency"`
+
+	// LatencyBasedSelection picks the active key with the lowest latency EWMA
+	// instead of following the rotation strategy.
+	LatencyBasedSelection bool `json:"latency_based_selection" mapstructure:"latency_based_selection"`
+
+	// RegionLatencySelection picks keys from the region whose base URL
+	// answers probes fastest, falling back to the strategy until a probe
+	// succeeds.
+	RegionLatencySelection bool `json:"region_latency_selection" mapstructure:"region_latency_selection"`
+
+	// RegionProbeIntervalSeconds is how often regional base URLs are probed.
+	RegionProbeIntervalSeconds int `json:"region_probe_interval_seconds" mapstructure:"region_probe_interval_seconds"`
+
+	// MaxConcurrentPerKey limits in-flight requests per key; 0 means no limit.
+	MaxConcurrentPerKey int `json:"max_concurrent_per_key" mapstructure:"max_concurrent_per_key"`
+
+	// MinActiveKeysThreshold logs a warning when a dead key leaves this many
+	// or fewer keys active; 0 disables the warning.
+	MinActiveKeysThreshold int `json:"min_active_keys_threshold" mapstructure:"min_active_keys_threshold"`
+
+	// MaxKeyAgeDays logs a warning for keys in the pool longer than this
+	// many days, so they can be rotated; 0 disables the warning. Old keys
+	// stay in rotation.
+	MaxKeyAgeDays int `json:"max_key_age_days" mapstructure:"max_key_age_days"`
+
+	// ProviderWeight spreads requests across providers in proportion to
+	// these weights. Providers without a weight only serve requests routed
+	// to them; empty disables balancing.
+	ProviderWeight map[domain.ProviderType]int `json:"provider_weight" mapstructure:"provider_weight"`
+
+	// CustomPrefixMap maps key prefixes to the provider of keys loaded from
+	// HPN_API_KEYS, e.g. {"mk-": "openai"}. It is checked before the
+	// built-in prefixes, longest prefix first. Prefixes read from the config
+	// file are lowercased.
+	CustomPrefixMap map[string]string `json:"custom_prefix_map" mapstructure:"custom_prefix_map"`
+
+	// RevivalStrategy is how dead keys return to rotation after their
+	// cooldown (immediate, gradual, staggered).
+	RevivalStrategy domain.RevivalStrategy `json:"revival_strategy" mapstructure:"revival_strategy"`
+
+	// MaxContextTokens is the context window of each model, in tokens.
+	// Chat completions whose estimated prompt exceeds 90% of it are
+	// rejected. Models in DefaultMaxContextTokens keep their default unless
+	// listed; other models are not checked.
+	MaxContextTokens map[string]int `json:"max_context_tokens" mapstructure:"max_context_tokens"`
+
+	// RetryOnEmptyResponse retries a chat completion answered with no
+	// candidates on the next key instead of returning no choices. The key
+	// is not marked dead.
+	RetryOnEmptyResponse bool `json:"retry_on_empty_response" mapstructure:"retry_on_empty_response"`
 }
 
 // LoggingConfig holds logging configuration.
@@ -67,6 +271,313 @@ type LoggingConfig struct {
 
 	// OutputPath is the file path for log output (empty for stdout).
 	OutputPath string `json:"output_path" mapstructure:"output_path"`
+
+	// MaxSizeMB is the size at which the log file is rotated.
+	MaxSizeMB int `json:"max_size_mb" mapstructure:"max_size_mb"`
+
+	// MaxBackups is the number of rotated log files kept (0 keeps all).
+	MaxBackups int `json:"max_backups" mapstructure:"max_backups"`
+
+	// MaxAgeDays is how long rotated log files are kept (0 keeps them forever).
+	MaxAgeDays int `json:"max_age_days" mapstructure:"max_age_days"`
+
+	// AlsoLogToStdout writes logs to stdout as well as OutputPath.
+	AlsoLogToStdout bool `json:"also_log_to_stdout" mapstructure:"also_log_to_stdout"`
+
+	// SlowRequestThresholdSeconds is the latency above which a request is
+	// logged as slow (0 disables).
+	SlowRequestThresholdSeconds int `json:"slow_request_threshold_seconds" mapstructure:"slow_request_threshold_seconds"`
+
+	// DebugSampleRate is the fraction of requests, from 0 to 1, whose
+	// debug-level logs are written.
+	DebugSampleRate float64 `json:"debug_sample_rate" mapstructure:"debug_sample_rate"`
+
+	// BodyHashing logs a 12-character SHA-256 prefix of every request body
+	// as request_body_hash and returns it in X-Request-Hash.
+	BodyHashing bool `json:"body_hashing" mapstructure:"body_hashing"`
+
+	// RedactMode is how secrets found in log output are hidden: "full"
+	// replaces them, "partial" keeps their first and last 4 characters.
+	RedactMode string `json:"redact_mode" mapstructure:"redact_mode"`
+
+	// UITheme is the style of the console output: "cyberpunk" (colors and
+	// emoji), "minimal" (plain ASCII) or "none" (no console output).
+	UITheme string `json:"ui_theme" mapstructure:"ui_theme"`
+
+	// RequestLogFields are the fields of the request completed entry, out
+	// of RequestLogFieldNames.
+	RequestLogFields []string `json:"request_log_fields" mapstructure:"request_log_fields"`
+}
+
+// RequestLogFieldNames lists the fields logging.request_log_fields can
+// select for the request completed entry.
+var RequestLogFieldNames = []string{
+	"method", "path", "query", "status", "latency", "attempts",
+	"client_ip", "user_agent", "user_id", "key_used", "request_id",
+	"model", "tokens", "request_bytes", "response_bytes", "ttft",
+}
+
+// DefaultRequestLogFields are the request log fields logged by default.
+var DefaultRequestLogFields = []string{"method", "path", "status", "latency", "attempts"}
+
+// SecurityConfig holds settings for sensitive request data.
+type SecurityConfig struct {
+	// RedactRequestBodies keeps prompts and anything derived from them out
+	// of logs and recordings: request bodies are recorded as
+	// [BODY_REDACTED], logging.body_hashing is ignored and the response
+	// cache is disabled.
+	RedactRequestBodies bool `json:"redact_request_bodies" mapstructure:"redact_request_bodies"`
+}
+
+// DevConfig holds settings for testing the router, not for production.
+type DevConfig struct {
+	// ChaosMode wraps every provider adapter in an adapter.ChaosAdapter
+	// injecting the failures of ChaosConfig, to test how clients and the
+	// key pool cope with a misbehaving provider.
+	ChaosMode bool `json:"chaos_mode" mapstructure:"chaos_mode"`
+
+	// ChaosConfig is the failure rate, error type and delay ChaosMode
+	// injects.
+	ChaosConfig adapter.ChaosConfig `json:"chaos_config" mapstructure:"chaos_config"`
+}
+
+// AdminConfig holds admin API configuration.
+type AdminConfig struct {
+	// Token is the shared secret clients send in the X-Admin-Token header.
+	// The admin API is disabled when empty.
+	Token string `json:"-" mapstructure:"token"`
+
+	// SnapshotPath is where POST /admin/snapshot writes the key pool state.
+	// When the file exists at startup its dead keys are restored.
+	SnapshotPath string `json:"snapshot_path" mapstructure:"snapshot_path"`
+
+	// StatePath is where the key pool state is saved on graceful shutdown
+	// and restored from at startup. POST /admin/snapshot also writes it when
+	// SnapshotPath is empty. Empty disables saving.
+	StatePath string `json:"state_path" mapstructure:"state_path"`
+
+	// StateMaxAgeSeconds is the oldest state file restored at startup; older
+	// files are ignored. Zero restores a state file of any age.
+	StateMaxAgeSeconds int `json:"state_max_age_seconds" mapstructure:"state_max_age_seconds"`
+
+	// DrainTimeoutSeconds is how long DELETE /admin/keys/:name waits for
+	// requests using the key to finish before giving up.
+	DrainTimeoutSeconds int `json:"drain_timeout_seconds" mapstructure:"drain_timeout_seconds"`
+
+	// LogLevelRevertSeconds is how long a level set with PUT
+	// /admin/log-level lasts before logging.level is restored. Zero keeps
+	// it until the next change.
+	LogLevelRevertSeconds int `json:"log_level_revert_seconds" mapstructure:"log_level_revert_seconds"`
+}
+
+// ProxyConfig holds request proxying configuration.
+type ProxyConfig struct {
+	// ValidateResponses rejects structurally invalid provider responses with 502.
+	ValidateResponses bool `json:"validate_responses" mapstructure:"validate_responses"`
+
+	// ExposeAttemptHeader sends X-Key-Attempt-Count, X-Provider and
+	// X-Provider-Attempts on proxied responses.
+	ExposeAttemptHeader bool `json:"expose_attempt_header" mapstructure:"expose_attempt_header"`
+}
+
+// HTTPConfig holds connection pool settings for the shared upstream transport.
+type HTTPConfig struct {
+	// MaxIdleConns is the maximum number of idle connections across all hosts.
+	MaxIdleConns int `json:"max_idle_conns" mapstructure:"max_idle_conns"`
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept per host.
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host" mapstructure:"max_idle_conns_per_host"`
+
+	// IdleConnTimeoutSeconds is how long an idle connection stays in the pool.
+	IdleConnTimeoutSeconds int `json:"idle_conn_timeout_seconds" mapstructure:"idle_conn_timeout_seconds"`
+
+	// TLSHandshakeTimeoutSeconds bounds the TLS handshake.
+	TLSHandshakeTimeoutSeconds int `json:"tls_handshake_timeout_seconds" mapstructure:"tls_handshake_timeout_seconds"`
+
+	// DisableCompression disables transparent gzip of responses.
+	DisableCompression bool `json:"disable_compression" mapstructure:"disable_compression"`
+}
+
+// ModelsConfig holds model name handling configuration.
+type ModelsConfig struct {
+	// NormalizationRules are "from=to" pairs, e.g. "gpt4=gpt-4", applied to
+	// request model names after lowercasing and suffix stripping.
+	NormalizationRules []string `json:"normalization_rules" mapstructure:"normalization_rules"`
+}
+
+// Aliases returns NormalizationRules as a map. Malformed rules are skipped;
+// Validate reports them.
+func (m ModelsConfig) Aliases() map[string]string {
+	aliases := make(map[string]string, len(m.NormalizationRules))
+	for _, rule := range m.NormalizationRules {
+		from, to, ok := strings.Cut(rule, "=")
+		if !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			continue
+		}
+		aliases[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return aliases
+}
+
+// ProviderConfig holds settings specific to each upstream provider.
+type ProviderConfig struct {
+	Google GoogleConfig `json:"google" mapstructure:"google"`
+
+	// GlobalSystemPrompt is put before the system messages of every chat
+	// completion, whatever the client sends. Empty adds nothing.
+	GlobalSystemPrompt string `json:"global_system_prompt" mapstructure:"global_system_prompt"`
+
+	// DefaultMaxTokens limits the output of chat completions that set no
+	// max_tokens. Zero leaves them unlimited.
+	DefaultMaxTokens int `json:"default_max_tokens" mapstructure:"default_max_tokens"`
+
+	// MaxAllowedTokens caps the output limit a chat completion may ask
+	// for; larger values are clamped. Zero allows any.
+	MaxAllowedTokens int `json:"max_allowed_tokens" mapstructure:"max_allowed_tokens"`
+
+	// RateLimitPerMinute caps the requests sent to each provider per
+	// minute, spaced evenly, before the provider answers with 429.
+	// Providers without a limit are not limited.
+	RateLimitPerMinute map[domain.ProviderType]int `json:"rate_limit_per_minute" mapstructure:"rate_limit_per_minute"`
+}
+
+// GoogleConfig holds Gemini request settings.
+type GoogleConfig struct {
+	// BaseURL is the Gemini API base URL requests are sent to, such as a
+	// mock provider in integration tests. The admin API can change it at
+	// runtime.
+	BaseURL string `json:"base_url" mapstructure:"base_url"`
+
+	// DefaultTopK is sent as generationConfig.topK unless X-Gemini-TopK overrides it.
+	// Zero leaves topK to Gemini's default.
+	DefaultTopK int `json:"default_top_k" mapstructure:"default_top_k"`
+
+	// SafetySettings are sent with every request unless a safety header overrides them.
+	SafetySettings []adapter.GeminiSafetySetting `json:"safety_settings" mapstructure:"safety_settings"`
+
+	// SafetyNoneAllowlist lists client IPs or CIDR ranges allowed to disable
+	// safety filtering per request.
+	SafetyNoneAllowlist []string `json:"safety_none_allowlist" mapstructure:"safety_none_allowlist"`
+
+	// SystemPromptSeparator joins multiple system messages into one
+	// systemInstruction.
+	SystemPromptSeparator string `json:"system_prompt_separator" mapstructure:"system_prompt_separator"`
+
+	// MaxCandidates is the largest n a chat completion may request, at most
+	// Gemini's limit of 8 candidates.
+	MaxCandidates int `json:"max_candidates" mapstructure:"max_candidates"`
+
+	// ForwardUserField sends the user field of chat completions, sanitized,
+	// to Gemini in the X-HPN-User-ID header and logs it. When false the
+	// field is dropped.
+	ForwardUserField bool `json:"forward_user_field" mapstructure:"forward_user_field"`
+
+	// SearchGrounding lets Gemini ground its answers in Google Search
+	// results. The searches and sources are returned with each choice.
+	SearchGrounding bool `json:"search_grounding" mapstructure:"search_grounding"`
+
+	// FlashDefaultMaxTokens limits the output of chat completions sent to a
+	// Gemini Flash model that set no max_tokens, in place of
+	// provider.default_max_tokens. Zero uses that default.
+	FlashDefaultMaxTokens int `json:"flash_default_max_tokens" mapstructure:"flash_default_max_tokens"`
+
+	// AdapterCacheEntries is how many chat completion responses are kept
+	// per key. A repeated request is sent with the generation_id Gemini
+	// returned, and the kept response is served when Gemini answers 304.
+	// Zero disables it.
+	AdapterCacheEntries int `json:"adapter_cache_entries" mapstructure:"adapter_cache_entries"`
+}
+
+// NotificationsConfig holds key event webhook configuration.
+type NotificationsConfig struct {
+	// WebhookURL receives a POST for every key_dead, key_revived and
+	// all_keys_dead event. Notifications are disabled when empty.
+	WebhookURL string `json:"webhook_url" mapstructure:"webhook_url"`
+
+	// WebhookRetryCount is how many times a failed delivery is retried.
+	WebhookRetryCount int `json:"webhook_retry_count" mapstructure:"webhook_retry_count"`
+
+	// HMACSecret signs payloads in the X-HPN-Signature header when set.
+	HMACSecret string `json:"-" mapstructure:"hmac_secret"`
+}
+
+// MetricsConfig holds metrics export configuration.
+type MetricsConfig struct {
+	// InfluxDB receives periodic key pool and usage points.
+	InfluxDB InfluxDBConfig `json:"influxdb" mapstructure:"influxdb"`
+
+	// LatencyWindow is how many request durations are kept per route for
+	// the percentiles of GET /admin/stats/latency.
+	LatencyWindow int `json:"latency_window" mapstructure:"latency_window"`
+}
+
+// InfluxDBConfig holds the InfluxDB v2 reporter configuration.
+type InfluxDBConfig struct {
+	// URL is the InfluxDB server, e.g. http://localhost:8086. Reporting is
+	// disabled when empty.
+	URL string `json:"url" mapstructure:"url"`
+
+	// Token is the API token with write access to Bucket.
+	Token string `json:"-" mapstructure:"token"`
+
+	// Bucket receives the points.
+	Bucket string `json:"bucket" mapstructure:"bucket"`
+
+	// Org owns Bucket.
+	Org string `json:"org" mapstructure:"org"`
+
+	// FlushIntervalSeconds is how often a point is written.
+	FlushIntervalSeconds int `json:"flush_interval_seconds" mapstructure:"flush_interval_seconds"`
+}
+
+// CostEstimationConfig holds cost estimator configuration.
+type CostEstimationConfig struct {
+	// UseAccurateTokenizer estimates the tokens of responses without usage
+	// data from GPT-4 tokenization patterns instead of the word count.
+	UseAccurateTokenizer bool `json:"use_accurate_tokenizer" mapstructure:"use_accurate_tokenizer"`
+
+	// AsyncBufferSize estimates requests without usage data on a background
+	// goroutine, queueing up to this many. 0 estimates before responding.
+	AsyncBufferSize int `json:"async_buffer_size" mapstructure:"async_buffer_size"`
+}
+
+// StartupChecksConfig holds the checks run with the --warm-up flag.
+type StartupChecksConfig struct {
+	// WarmUpModels are the models every key must be able to count tokens
+	// for. Empty only checks that the provider accepts the key.
+	WarmUpModels []string `json:"warm_up_models" mapstructure:"warm_up_models"`
+}
+
+// RoutingConfig holds provider routing configuration.
+type RoutingConfig struct {
+	// Costs lists per-provider model prices. When a model has prices for more
+	// than one provider with active keys, the cheapest provider serves it.
+	Costs []ModelCost `json:"costs" mapstructure:"costs"`
+
+	// FallbackToFirst routes models without cost data to the first provider
+	// with active keys instead of rotating over all keys.
+	FallbackToFirst bool `json:"fallback_to_first" mapstructure:"fallback_to_first"`
+
+	// Rules send matching requests to tagged keys, highest priority first.
+	// Requests matching no rule use the routing above.
+	Rules []domain.RoutingRule `json:"rules" mapstructure:"rules"`
+}
+
+// ModelCost is the price of a model at one provider.
+type ModelCost struct {
+	Provider domain.ProviderType `json:"provider" mapstructure:"provider"`
+	Model    string              `json:"model" mapstructure:"model"`
+
+	domain.ProviderCost `mapstructure:",squash"`
+}
+
+// CostTable returns Costs keyed by domain.CostKey.
+func (r RoutingConfig) CostTable() map[string]domain.ProviderCost {
+	table := make(map[string]domain.ProviderCost, len(r.Costs))
+	for _, c := range r.Costs {
+		table[domain.CostKey(c.Provider, c.Model)] = c.ProviderCost
+	}
+	return table
 }
 
 // configInstance holds the singleton configuration instance.
@@ -116,64 +627,367 @@ func ResetConfig() {
 	configErr = nil
 }
 
-// Validate validates the configuration and returns an error if required fields are missing.
+// Validate validates the configuration and returns a *ValidationError listing
+// every invalid field.
 func (c *Configuration) Validate() error {
-	var validationErrors []string
+	verr := &ValidationError{}
 
 	// Validate server configuration
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
-		validationErrors = append(validationErrors, "server.port must be between 1 and 65535")
+		verr.add("server.port", ErrorCodeOutOfRange, c.Server.Port, "must be between 1 and 65535")
+	}
+	if !isValidHeaderName(c.Server.RequestIDHeader) {
+		verr.add("server.request_id_header", ErrorCodeInvalidFormat, c.Server.RequestIDHeader, "must be a valid HTTP header name")
+	}
+	if _, err := security.ParseIPAllowlist(c.Server.TrustedProxies); err != nil {
+		verr.add("server.trusted_proxies", ErrorCodeInvalidFormat, strings.Join(c.Server.TrustedProxies, ","), "is invalid: "+err.Error())
+	}
+	if c.Server.TrustedProxyCount < 0 {
+		verr.add("server.trusted_proxy_count", ErrorCodeOutOfRange, c.Server.TrustedProxyCount, "must not be negative")
+	}
+	if !isValidHeaderName(c.Server.TrustedProxyHeader) {
+		verr.add("server.trusted_proxy_header", ErrorCodeInvalidFormat, c.Server.TrustedProxyHeader, "must be a valid HTTP header name")
+	}
+
+	if c.Server.CompressionLevel < gzip.HuffmanOnly || c.Server.CompressionLevel > gzip.BestCompression {
+		verr.add("server.compression_level", ErrorCodeOutOfRange, c.Server.CompressionLevel, "must be between -2 and 9")
+	}
+	if c.Server.CompressionMinSize < 0 {
+		verr.add("server.compression_min_size", ErrorCodeOutOfRange, c.Server.CompressionMinSize, "must not be negative")
+	}
+	if c.Server.WorkerPoolSize < 0 {
+		verr.add("server.worker_pool_size", ErrorCodeOutOfRange, c.Server.WorkerPoolSize, "must not be negative")
+	}
+	if c.CostEstimation.AsyncBufferSize < 0 {
+		verr.add("cost_estimation.async_buffer_size", ErrorCodeOutOfRange, c.CostEstimation.AsyncBufferSize, "must not be negative")
+	}
+	for i, model := range c.StartupChecks.WarmUpModels {
+		if strings.TrimSpace(model) == "" {
+			verr.add(fmt.Sprintf("startup_checks.warm_up_models[%d]", i), ErrorCodeRequired, model, "must not be empty")
+		}
+	}
+
+	if c.Server.PProfEnabled {
+		if c.Server.PProfPort <= 0 || c.Server.PProfPort > 65535 {
+			verr.add("server.pprof_port", ErrorCodeOutOfRange, c.Server.PProfPort, "must be between 1 and 65535")
+		} else if c.Server.PProfPort == c.Server.Port {
+			verr.add("server.pprof_port", ErrorCodeDuplicate, c.Server.PProfPort, "must differ from server.port")
+		}
+	}
+
+	switch {
+	case c.Server.TLSAutoCert && !c.Server.TLSEnabled:
+		verr.add("server.tls_auto_cert", ErrorCodeMissingDependency, true, "requires server.tls_enabled")
+	case c.Server.TLSAutoCert:
+		if len(c.Server.TLSAutoCertDomains) == 0 {
+			verr.add("server.tls_auto_cert_domains", ErrorCodeMissingDependency, "", "is required with server.tls_auto_cert")
+		}
+		if c.Server.TLSCacheDir == "" {
+			verr.add("server.tls_cache_dir", ErrorCodeMissingDependency, "", "is required with server.tls_auto_cert")
+		}
+	case c.Server.TLSEnabled:
+		if c.Server.TLSCertFile == "" {
+			verr.add("server.tls_cert_file", ErrorCodeMissingDependency, "", "is required with server.tls_enabled")
+		}
+		if c.Server.TLSKeyFile == "" {
+			verr.add("server.tls_key_file", ErrorCodeMissingDependency, "", "is required with server.tls_enabled")
+		}
 	}
 
 	// Validate key pool configuration
 	if c.KeyPool.Strategy == "" {
-		validationErrors = append(validationErrors, "key_pool.strategy is required")
+		verr.add("key_pool.strategy", ErrorCodeRequired, "", "is required")
+	} else if !isValidStrategy(c.KeyPool.Strategy) {
+		verr.add("key_pool.strategy", ErrorCodeInvalidEnum, c.KeyPool.Strategy, fmt.Sprintf(
+			"'%s' is invalid, must be one of: round-robin, random, weighted, least-used, priority",
+			c.KeyPool.Strategy,
+		))
 	}
 
-	if !isValidStrategy(c.KeyPool.Strategy) {
-		validationErrors = append(validationErrors, fmt.Sprintf(
-			"key_pool.strategy '%s' is invalid, must be one of: round-robin, random, weighted, least-used",
-			c.KeyPool.Strategy,
+	if !isValidRevivalStrategy(c.KeyPool.RevivalStrategy) {
+		verr.add("key_pool.revival_strategy", ErrorCodeInvalidEnum, c.KeyPool.RevivalStrategy, fmt.Sprintf(
+			"'%s' is invalid, must be one of: immediate, gradual, staggered",
+			c.KeyPool.RevivalStrategy,
 		))
 	}
 
 	if len(c.KeyPool.Keys) == 0 {
-		validationErrors = append(validationErrors, "key_pool.keys cannot be empty, at least one API key is required")
+		verr.add("key_pool.keys", ErrorCodeRequired, "", "cannot be empty, at least one API key is required")
 	}
 
-	// Validate each API key
+	// Validate each API key; key values are never echoed back.
 	for i, key := range c.KeyPool.Keys {
+		field := fmt.Sprintf("key_pool.keys[%d]", i)
 		if key.Key == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("key_pool.keys[%d].key is required", i))
+			verr.add(field+".key", ErrorCodeRequired, "", "is required")
 		}
 		if key.Provider == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("key_pool.keys[%d].provider is required", i))
+			verr.add(field+".provider", ErrorCodeRequired, "", "is required")
+		}
+		if key.DailyTokenLimit < 0 {
+			verr.add(field+".daily_token_limit", ErrorCodeOutOfRange, key.DailyTokenLimit, "must be non-negative")
+		}
+		if key.MonthlyTokenLimit < 0 {
+			verr.add(field+".monthly_token_limit", ErrorCodeOutOfRange, key.MonthlyTokenLimit, "must be non-negative")
+		}
+		if key.TokensPerMinute < 0 {
+			verr.add(field+".tokens_per_minute", ErrorCodeOutOfRange, key.TokensPerMinute, "must be non-negative")
+		}
+		if key.Priority < 0 {
+			verr.add(field+".priority", ErrorCodeOutOfRange, key.Priority, "must be non-negative")
+		}
+		// Like PUT /admin/providers/{type}/base-url, a key's own endpoint
+		// must use TLS: the key is sent with every request.
+		if key.BaseURL != "" {
+			if u, err := url.Parse(key.BaseURL); err != nil || u.Scheme != "https" || u.Host == "" {
+				verr.add(field+".base_url", ErrorCodeInvalidFormat, key.BaseURL, "must be an absolute https URL")
+			}
 		}
 	}
 
+	for path, n := range c.KeyPool.EndpointRetries {
+		if n < 1 {
+			verr.add("key_pool.endpoint_retries."+path, ErrorCodeOutOfRange, n, "must be at least 1")
+		}
+	}
+
+	for model, n := range c.KeyPool.MaxContextTokens {
+		if n < 1 {
+			verr.add("key_pool.max_context_tokens."+model, ErrorCodeOutOfRange, n, "must be at least 1")
+		}
+	}
+
+	for i, code := range c.KeyPool.RetryableStatusCodes {
+		if code < 400 || code > 599 {
+			verr.add(fmt.Sprintf("key_pool.retryable_status_codes[%d]", i), ErrorCodeOutOfRange, code, "must be between 400 and 599")
+		}
+	}
+	for i, code := range c.KeyPool.NonRetryableStatusCodes {
+		if code < 400 || code > 599 {
+			verr.add(fmt.Sprintf("key_pool.non_retryable_status_codes[%d]", i), ErrorCodeOutOfRange, code, "must be between 400 and 599")
+		}
+	}
+
+	for provider, seconds := range c.KeyPool.ProviderCooldownSeconds {
+		if seconds < 0 {
+			verr.add("key_pool.provider_cooldown_seconds."+string(provider), ErrorCodeOutOfRange, seconds, "must be non-negative")
+		}
+	}
+	for provider, weight := range c.KeyPool.ProviderWeight {
+		if weight < 0 {
+			verr.add("key_pool.provider_weight."+string(provider), ErrorCodeOutOfRange, weight, "must be non-negative")
+		}
+	}
+	for prefix, provider := range c.KeyPool.CustomPrefixMap {
+		if prefix == "" {
+			verr.add("key_pool.custom_prefix_map", ErrorCodeRequired, provider, "prefix must not be empty")
+		} else if provider == "" {
+			verr.add("key_pool.custom_prefix_map."+prefix, ErrorCodeRequired, provider, "must not be empty")
+		}
+	}
+
+	if c.KeyPool.MaxConcurrentPerKey < 0 {
+		verr.add("key_pool.max_concurrent_per_key", ErrorCodeOutOfRange, c.KeyPool.MaxConcurrentPerKey, "must be non-negative")
+	}
+	if c.KeyPool.MinActiveKeysThreshold < 0 {
+		verr.add("key_pool.min_active_keys_threshold", ErrorCodeOutOfRange, c.KeyPool.MinActiveKeysThreshold, "must be non-negative")
+	}
+	if c.KeyPool.RegionProbeIntervalSeconds < 1 {
+		verr.add("key_pool.region_probe_interval_seconds", ErrorCodeOutOfRange, c.KeyPool.RegionProbeIntervalSeconds, "must be at least 1")
+	}
+	if c.KeyPool.MaxKeyAgeDays < 0 {
+		verr.add("key_pool.max_key_age_days", ErrorCodeOutOfRange, c.KeyPool.MaxKeyAgeDays, "must be non-negative")
+	}
+	if c.Server.QueueMaxSize < 0 {
+		verr.add("server.queue_max_size", ErrorCodeOutOfRange, c.Server.QueueMaxSize, "must be non-negative")
+	}
+	if c.Server.QueueTimeoutSeconds < 1 {
+		verr.add("server.queue_timeout_seconds", ErrorCodeOutOfRange, c.Server.QueueTimeoutSeconds, "must be at least 1")
+	}
+	if c.Admin.DrainTimeoutSeconds < 1 {
+		verr.add("admin.drain_timeout_seconds", ErrorCodeOutOfRange, c.Admin.DrainTimeoutSeconds, "must be at least 1")
+	}
+	if c.Admin.StateMaxAgeSeconds < 0 {
+		verr.add("admin.state_max_age_seconds", ErrorCodeOutOfRange, c.Admin.StateMaxAgeSeconds, "must not be negative")
+	}
+	if c.Admin.LogLevelRevertSeconds < 0 {
+		verr.add("admin.log_level_revert_seconds", ErrorCodeOutOfRange, c.Admin.LogLevelRevertSeconds, "must not be negative")
+	}
+
+	if _, err := domain.NewRoutingRuleEngine(c.Routing.Rules); err != nil {
+		verr.add("routing.rules", ErrorCodeInvalidFormat, "", "is invalid: "+err.Error())
+	}
+
 	// Validate providers if specified
 	for i, provider := range c.Providers {
+		field := fmt.Sprintf("providers[%d]", i)
 		if provider.Name == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("providers[%d].name is required", i))
+			verr.add(field+".name", ErrorCodeRequired, "", "is required")
 		}
 		if provider.Type == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("providers[%d].type is required", i))
+			verr.add(field+".type", ErrorCodeRequired, "", "is required")
 		}
 		if provider.BaseURL == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("providers[%d].base_url is required", i))
+			verr.add(field+".base_url", ErrorCodeRequired, "", "is required")
 		}
 	}
 
 	// Validate logging configuration
 	if c.Logging.Level != "" && !isValidLogLevel(c.Logging.Level) {
-		validationErrors = append(validationErrors, fmt.Sprintf(
-			"logging.level '%s' is invalid, must be one of: debug, info, warn, error",
+		verr.add("logging.level", ErrorCodeInvalidEnum, c.Logging.Level, fmt.Sprintf(
+			"'%s' is invalid, must be one of: debug, info, warn, error",
 			c.Logging.Level,
 		))
 	}
+	if c.Logging.MaxSizeMB < 1 {
+		verr.add("logging.max_size_mb", ErrorCodeOutOfRange, c.Logging.MaxSizeMB, "must be at least 1")
+	}
+	if c.Logging.MaxBackups < 0 {
+		verr.add("logging.max_backups", ErrorCodeOutOfRange, c.Logging.MaxBackups, "must not be negative")
+	}
+	if c.Logging.MaxAgeDays < 0 {
+		verr.add("logging.max_age_days", ErrorCodeOutOfRange, c.Logging.MaxAgeDays, "must not be negative")
+	}
+	if c.Logging.SlowRequestThresholdSeconds < 0 {
+		verr.add("logging.slow_request_threshold_seconds", ErrorCodeOutOfRange, c.Logging.SlowRequestThresholdSeconds, "must not be negative")
+	}
+	if c.Logging.DebugSampleRate < 0 || c.Logging.DebugSampleRate > 1 {
+		verr.add("logging.debug_sample_rate", ErrorCodeOutOfRange, c.Logging.DebugSampleRate, "must be between 0 and 1")
+	}
+	if _, err := security.ParseRedactMode(c.Logging.RedactMode); err != nil {
+		verr.add("logging.redact_mode", ErrorCodeInvalidEnum, c.Logging.RedactMode, "must be one of: full, partial")
+	}
+	if ui.NewTheme(c.Logging.UITheme) == nil {
+		verr.add("logging.ui_theme", ErrorCodeInvalidEnum, c.Logging.UITheme, "must be one of: cyberpunk, minimal, none")
+	}
+	for i, field := range c.Logging.RequestLogFields {
+		if !slices.Contains(RequestLogFieldNames, field) {
+			verr.add(fmt.Sprintf("logging.request_log_fields[%d]", i), ErrorCodeInvalidEnum, field,
+				"must be one of: "+strings.Join(RequestLogFieldNames, ", "))
+		}
+	}
 
-	if len(validationErrors) > 0 {
-		return &ValidationError{Errors: validationErrors}
+	if c.KeyPool.DecayAlpha <= 0 || c.KeyPool.DecayAlpha > 1 {
+		verr.add("key_pool.decay_alpha", ErrorCodeOutOfRange, c.KeyPool.DecayAlpha, "must be greater than 0 and at most 1")
+	}
+
+	if c.Provider.DefaultMaxTokens < 0 {
+		verr.add("provider.default_max_tokens", ErrorCodeOutOfRange, c.Provider.DefaultMaxTokens, "must not be negative")
+	}
+	for provider, limit := range c.Provider.RateLimitPerMinute {
+		if limit < 0 {
+			verr.add("provider.rate_limit_per_minute."+string(provider), ErrorCodeOutOfRange, limit, "must not be negative")
+		}
+	}
+	if c.Provider.MaxAllowedTokens < 0 {
+		verr.add("provider.max_allowed_tokens", ErrorCodeOutOfRange, c.Provider.MaxAllowedTokens, "must not be negative")
+	}
+	if c.Provider.MaxAllowedTokens > 0 && c.Provider.DefaultMaxTokens > c.Provider.MaxAllowedTokens {
+		verr.add("provider.default_max_tokens", ErrorCodeOutOfRange, c.Provider.DefaultMaxTokens,
+			fmt.Sprintf("must not exceed provider.max_allowed_tokens (%d)", c.Provider.MaxAllowedTokens))
+	}
+	if c.Provider.Google.AdapterCacheEntries < 0 {
+		verr.add("provider.google.adapter_cache_entries", ErrorCodeOutOfRange, c.Provider.Google.AdapterCacheEntries, "must not be negative")
+	}
+	if c.Provider.Google.FlashDefaultMaxTokens < 0 {
+		verr.add("provider.google.flash_default_max_tokens", ErrorCodeOutOfRange, c.Provider.Google.FlashDefaultMaxTokens, "must not be negative")
+	}
+	if c.Provider.MaxAllowedTokens > 0 && c.Provider.Google.FlashDefaultMaxTokens > c.Provider.MaxAllowedTokens {
+		verr.add("provider.google.flash_default_max_tokens", ErrorCodeOutOfRange, c.Provider.Google.FlashDefaultMaxTokens,
+			fmt.Sprintf("must not exceed provider.max_allowed_tokens (%d)", c.Provider.MaxAllowedTokens))
+	}
+
+	if u, err := url.Parse(c.Provider.Google.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		verr.add("provider.google.base_url", ErrorCodeInvalidFormat, c.Provider.Google.BaseURL, "must be an absolute http or https URL")
+	}
+	if c.Provider.Google.DefaultTopK < 0 {
+		verr.add("provider.google.default_top_k", ErrorCodeOutOfRange, c.Provider.Google.DefaultTopK, "must not be negative")
+	}
+	if c.Provider.Google.MaxCandidates < 1 || c.Provider.Google.MaxCandidates > adapter.MaxGeminiCandidates {
+		verr.add("provider.google.max_candidates", ErrorCodeOutOfRange, c.Provider.Google.MaxCandidates,
+			fmt.Sprintf("must be between 1 and %d", adapter.MaxGeminiCandidates))
+	}
+
+	for i, setting := range c.Provider.Google.SafetySettings {
+		field := fmt.Sprintf("provider.google.safety_settings[%d]", i)
+		if setting.Category == "" {
+			verr.add(field+".category", ErrorCodeRequired, "", "is required")
+		}
+		if !adapter.IsValidSafetyThreshold(setting.Threshold) {
+			verr.add(field+".threshold", ErrorCodeInvalidEnum, setting.Threshold, fmt.Sprintf("'%s' is invalid", setting.Threshold))
+		}
+	}
+	if _, err := security.ParseIPAllowlist(c.Provider.Google.SafetyNoneAllowlist); err != nil {
+		verr.add("provider.google.safety_none_allowlist", ErrorCodeInvalidFormat, strings.Join(c.Provider.Google.SafetyNoneAllowlist, ","),
+			"is invalid: "+err.Error())
+	}
+
+	// Validate model normalization rules
+	for i, rule := range c.Models.NormalizationRules {
+		from, to, ok := strings.Cut(rule, "=")
+		if !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			verr.add(fmt.Sprintf("models.normalization_rules[%d]", i), ErrorCodeInvalidFormat, rule, fmt.Sprintf(
+				"'%s' is invalid, must be from=to", rule,
+			))
+		}
+	}
+
+	// Validate notifications
+	if url := c.Notifications.WebhookURL; url != "" && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		verr.add("notifications.webhook_url", ErrorCodeInvalidFormat, url, "must be an http or https URL")
+	}
+	if c.Notifications.WebhookRetryCount < 0 {
+		verr.add("notifications.webhook_retry_count", ErrorCodeOutOfRange, c.Notifications.WebhookRetryCount, "must be non-negative")
+	}
+
+	// Validate metrics export
+	if c.Metrics.LatencyWindow < 1 {
+		verr.add("metrics.latency_window", ErrorCodeOutOfRange, c.Metrics.LatencyWindow, "must be at least 1")
+	}
+	if influx := c.Metrics.InfluxDB; influx.URL != "" {
+		if !strings.HasPrefix(influx.URL, "http://") && !strings.HasPrefix(influx.URL, "https://") {
+			verr.add("metrics.influxdb.url", ErrorCodeInvalidFormat, influx.URL, "must be an http or https URL")
+		}
+		if influx.Bucket == "" {
+			verr.add("metrics.influxdb.bucket", ErrorCodeMissingDependency, "", "is required with metrics.influxdb.url")
+		}
+		if influx.Org == "" {
+			verr.add("metrics.influxdb.org", ErrorCodeMissingDependency, "", "is required with metrics.influxdb.url")
+		}
+		if influx.FlushIntervalSeconds < 1 {
+			verr.add("metrics.influxdb.flush_interval_seconds", ErrorCodeOutOfRange, influx.FlushIntervalSeconds, "must be at least 1")
+		}
+	}
+
+	// Validate chaos mode
+	if chaos := c.Dev.ChaosConfig; c.Dev.ChaosMode {
+		if chaos.FailureRate < 0 || chaos.FailureRate > 1 {
+			verr.add("dev.chaos_config.failure_rate", ErrorCodeOutOfRange, chaos.FailureRate, "must be between 0 and 1")
+		}
+		// An empty error type injects server errors.
+		if chaos.ErrorType != "" && !slices.Contains(adapter.ChaosErrorTypes, chaos.ErrorType) {
+			verr.add("dev.chaos_config.error_type", ErrorCodeInvalidEnum, chaos.ErrorType,
+				"must be empty or one of "+strings.Join(adapter.ChaosErrorTypes, ", "))
+		}
+		if lo, hi := chaos.DelayRange[0], chaos.DelayRange[1]; lo < 0 || hi < lo {
+			verr.add("dev.chaos_config.delay_range", ErrorCodeOutOfRange, fmt.Sprintf("[%s, %s]", lo, hi),
+				"must be a non-negative minimum and a maximum no smaller")
+		}
+	}
+
+	// Validate routing costs
+	for i, cost := range c.Routing.Costs {
+		field := fmt.Sprintf("routing.costs[%d]", i)
+		if cost.Provider == "" || cost.Model == "" {
+			verr.add(field, ErrorCodeRequired, "", "requires provider and model")
+		}
+		if cost.InputPerMillion < 0 || cost.OutputPerMillion < 0 {
+			verr.add(field, ErrorCodeOutOfRange, "", "prices must be non-negative")
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
 	}
 
 	return nil
@@ -182,13 +996,39 @@ func (c *Configuration) Validate() error {
 // isValidStrategy checks if the rotation strategy is valid.
 func isValidStrategy(strategy domain.RotationStrategy) bool {
 	switch strategy {
-	case domain.StrategyRoundRobin, domain.StrategyRandom, domain.StrategyWeighted, domain.StrategyLeastUsed:
+	case domain.StrategyRoundRobin, domain.StrategyRandom, domain.StrategyWeighted, domain.StrategyLeastUsed,
+		domain.StrategyPriority:
+		return true
+	default:
+		return false
+	}
+}
+
+// isValidRevivalStrategy checks if the dead key revival strategy is valid.
+func isValidRevivalStrategy(strategy domain.RevivalStrategy) bool {
+	switch strategy {
+	case domain.RevivalImmediate, domain.RevivalGradual, domain.RevivalStaggered:
 		return true
 	default:
 		return false
 	}
 }
 
+// isValidHeaderName checks that name is a non-empty HTTP header field name.
+func isValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		isAlnum := ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(ch)) {
+			return false
+		}
+	}
+	return true
+}
+
 // isValidLogLevel checks if the log level is valid.
 func isValidLogLevel(level string) bool {
 	switch level {
@@ -199,6 +1039,19 @@ func isValidLogLevel(level string) bool {
 	}
 }
 
+// Redacted returns a copy of c that is safe to show operators: API keys are
+// masked, and the admin token and other secrets are left out of its JSON
+// as always.
+func (c *Configuration) Redacted() Configuration {
+	out := *c
+	out.KeyPool.Keys = make([]domain.APIKey, len(c.KeyPool.Keys))
+	for i, key := range c.KeyPool.Keys {
+		key.Key = security.MaskKey(key.Key)
+		out.KeyPool.Keys[i] = key
+	}
+	return out
+}
+
 // GetActiveKeys returns all enabled API keys.
 func (c *Configuration) GetActiveKeys() []domain.APIKey {
 	activeKeys := make([]domain.APIKey, 0)
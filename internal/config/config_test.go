@@ -0,0 +1,1205 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// validConfig is a small valid configuration file.
+const validConfig = "testdata/config_valid.yaml"
+
+// writeConfig writes a YAML config to a temporary file and returns its path.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig_ValidationErrors(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+
+	path := writeConfig(t, `
+server:
+  port: 70000
+key_pool:
+  strategy: fastest
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+
+	_, err := loadConfig(path)
+	if !IsValidationError(err) {
+		t.Fatalf("loadConfig() error = %v, want a ValidationError", err)
+	}
+	var verr *ValidationError
+	errors.As(err, &verr)
+
+	if len(verr.Errors) != 2 {
+		t.Fatalf("len(Errors) = %d, want 2: %v", len(verr.Errors), verr.Errors)
+	}
+	want := []ValidationFieldError{
+		{Field: "server.port", Value: "70000"},
+		{Field: "key_pool.strategy", Value: "fastest"},
+	}
+	for i, w := range want {
+		got := verr.Errors[i]
+		if got.Field != w.Field || got.Value != w.Value {
+			t.Errorf("Errors[%d] = %s=%q, want %s=%q", i, got.Field, got.Value, w.Field, w.Value)
+		}
+		if got.Message == "" {
+			t.Errorf("Errors[%d] has no message", i)
+		}
+	}
+
+	if !strings.Contains(err.Error(), "with 2 errors") || !strings.Contains(err.Error(), "server.port must be between 1 and 65535") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestLoadConfig_ValidFixture(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+
+	cfg, err := loadConfig(validConfig)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if cfg.Server.Host != "127.0.0.1" || cfg.Server.Port != 9090 {
+		t.Errorf("Server = %s:%d, want 127.0.0.1:9090", cfg.Server.Host, cfg.Server.Port)
+	}
+	if len(cfg.KeyPool.Keys) != 3 || cfg.KeyPool.Keys[0].Name != "primary" || cfg.KeyPool.Keys[0].Weight != 2 {
+		t.Errorf("Keys = %+v, want primary, secondary and backup", cfg.KeyPool.Keys)
+	}
+	if got := len(cfg.GetActiveKeys()); got != 2 {
+		t.Errorf("active keys = %d, want 2", got)
+	}
+	if cfg.Logging.Level != "debug" || cfg.Logging.Format != "text" {
+		t.Errorf("Logging = %s/%s, want debug/text", cfg.Logging.Level, cfg.Logging.Format)
+	}
+}
+
+func TestValidationError_Helpers(t *testing.T) {
+	verr := &ValidationError{}
+	verr.add("key_pool.keys[0].key", ErrorCodeRequired, "", "is required")
+	verr.add("key_pool.keys[0].key", ErrorCodeInvalidFormat, "", "must not be a placeholder")
+	verr.add("server.port", ErrorCodeOutOfRange, 0, "must be between 1 and 65535")
+
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"server.port", true},
+		{"key_pool.keys", true},
+		{"key_pool.keys[0].key", true},
+		{"key_pool", true},
+		{"server.host", false},
+		{"server.po", false},
+	}
+	for _, tt := range tests {
+		if got := verr.HasError(tt.field); got != tt.want {
+			t.Errorf("HasError(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+
+	m := verr.AsMap()
+	if got := m["key_pool.keys[0].key"]; len(got) != 2 {
+		t.Errorf("AsMap()[key_pool.keys[0].key] = %v, want 2 messages", got)
+	}
+
+	data, err := json.Marshal(verr)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded struct {
+		Error  string                 `json:"error"`
+		Errors []ValidationFieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(decoded.Errors) != 3 || decoded.Errors[2].Value != "0" || decoded.Errors[2].Code != ErrorCodeOutOfRange {
+		t.Errorf("JSON = %s", data)
+	}
+
+	if got := verr.FilterByCode(ErrorCodeRequired); len(got) != 1 || got[0].Message != "is required" {
+		t.Errorf("FilterByCode(required) = %v, want the missing key", got)
+	}
+	if got := verr.FilterByCode(ErrorCodeDuplicate); got != nil {
+		t.Errorf("FilterByCode(duplicate) = %v, want none", got)
+	}
+
+	var problem struct {
+		Type   string                 `json:"type"`
+		Title  string                 `json:"title"`
+		Status int                    `json:"status"`
+		Detail string                 `json:"detail"`
+		Errors []ValidationFieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(verr.AsProblemsJSON(), &problem); err != nil {
+		t.Fatalf("AsProblemsJSON() is not JSON: %v", err)
+	}
+	if problem.Type != ProblemType || problem.Title == "" || problem.Status != 422 ||
+		problem.Detail != "3 configuration fields are invalid" || len(problem.Errors) != 3 {
+		t.Errorf("AsProblemsJSON() = %s", verr.AsProblemsJSON())
+	}
+
+	if !IsValidationError(fmt.Errorf("startup: %w", verr)) {
+		t.Error("IsValidationError() = false for a wrapped ValidationError")
+	}
+}
+
+func TestValidate_ErrorCodes(t *testing.T) {
+	const keys = `
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`
+	tests := []struct {
+		name  string
+		yaml  string
+		field string
+		code  string
+	}{
+		{"no keys", "server:\n  port: 8080\n", "key_pool.keys", ErrorCodeRequired},
+		{"port", "server:\n  port: 70000\n" + keys, "server.port", ErrorCodeOutOfRange},
+		{"strategy", keys + "  strategy: fastest\n", "key_pool.strategy", ErrorCodeInvalidEnum},
+		{"log level", "logging:\n  level: verbose\n" + keys, "logging.level", ErrorCodeInvalidEnum},
+		{"negative limit", keys + "  max_concurrent_per_key: -1\n", "key_pool.max_concurrent_per_key", ErrorCodeOutOfRange},
+		{"compression level", "server:\n  compression_level: 10\n" + keys, "server.compression_level", ErrorCodeOutOfRange},
+		{"header name", "server:\n  request_id_header: \"X Request\"\n" + keys, "server.request_id_header", ErrorCodeInvalidFormat},
+		{"proxy count", "server:\n  trusted_proxy_count: -1\n" + keys, "server.trusted_proxy_count", ErrorCodeOutOfRange},
+		{"proxy header", "server:\n  trusted_proxy_header: \"CF Connecting IP\"\n" + keys, "server.trusted_proxy_header", ErrorCodeInvalidFormat},
+		{"pprof port", "server:\n  port: 8080\n  pprof_enabled: true\n  pprof_port: 8080\n" + keys, "server.pprof_port", ErrorCodeDuplicate},
+		{"tls files", "server:\n  tls_enabled: true\n" + keys, "server.tls_cert_file", ErrorCodeMissingDependency},
+		{"latency window", "metrics:\n  latency_window: 0\n" + keys, "metrics.latency_window", ErrorCodeOutOfRange},
+		{"influxdb bucket", "metrics:\n  influxdb:\n    url: http://influx:8086\n    org: hpn\n" + keys, "metrics.influxdb.bucket", ErrorCodeMissingDependency},
+		{"chaos failure rate", "dev:\n  chaos_mode: true\n  chaos_config:\n    failure_rate: 1.5\n" + keys, "dev.chaos_config.failure_rate", ErrorCodeOutOfRange},
+		{"chaos error type", "dev:\n  chaos_mode: true\n  chaos_config:\n    error_type: crash\n" + keys, "dev.chaos_config.error_type", ErrorCodeInvalidEnum},
+		{"adapter cache entries", "provider:\n  google:\n    adapter_cache_entries: -1\n" + keys, "provider.google.adapter_cache_entries", ErrorCodeOutOfRange},
+		{"flash max tokens", "provider:\n  max_allowed_tokens: 2048\n  google:\n    flash_default_max_tokens: 4096\n" + keys, "provider.google.flash_default_max_tokens", ErrorCodeOutOfRange},
+		{"chaos delay range", "dev:\n  chaos_mode: true\n  chaos_config:\n    delay_range: [1s, 10ms]\n" + keys, "dev.chaos_config.delay_range", ErrorCodeOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			_, err := loadConfig(writeConfig(t, tt.yaml))
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("loadConfig() error = %v, want a ValidationError", err)
+			}
+			for _, fe := range verr.Errors {
+				if fe.Field == tt.field {
+					if fe.Code != tt.code {
+						t.Errorf("%s code = %q, want %q", tt.field, fe.Code, tt.code)
+					}
+					return
+				}
+			}
+			t.Errorf("errors = %v, want one for %s", verr.Errors, tt.field)
+		})
+	}
+}
+
+func TestLoadConfig_TLSValidation(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+
+	tests := []struct {
+		name   string
+		server string
+		want   []string
+	}{
+		{"files", "tls_enabled: true\n  tls_cert_file: a.crt\n  tls_key_file: a.key", nil},
+		{"missing files", "tls_enabled: true", []string{"server.tls_cert_file", "server.tls_key_file"}},
+		{"auto cert", "tls_enabled: true\n  tls_auto_cert: true\n  tls_auto_cert_domains: [router.example.com]", nil},
+		{"auto cert without domains", "tls_enabled: true\n  tls_auto_cert: true", []string{"server.tls_auto_cert_domains"}},
+		{"auto cert without tls", "tls_auto_cert: true", []string{"server.tls_auto_cert"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, fmt.Sprintf(`
+server:
+  %s
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`, tt.server))
+
+			_, err := loadConfig(path)
+			var verr *ValidationError
+			errors.As(err, &verr)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("loadConfig() error = %v", err)
+				}
+				return
+			}
+			if verr == nil || len(verr.Errors) != len(tt.want) {
+				t.Fatalf("loadConfig() error = %v, want errors for %v", err, tt.want)
+			}
+			for _, field := range tt.want {
+				if !verr.HasError(field) {
+					t.Errorf("no error for %s in %v", field, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig_EndpointRetries(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+
+	path := writeConfig(t, `
+key_pool:
+  endpoint_retries:
+    /v1/chat/completions/batch: 2
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	want := map[string]int{"/v1/embeddings": 1, "/v1/chat/completions/batch": 2}
+	for p, n := range want {
+		if got := cfg.KeyPool.EndpointRetries[p]; got != n {
+			t.Errorf("EndpointRetries[%s] = %d, want %d (all: %v)", p, got, n, cfg.KeyPool.EndpointRetries)
+		}
+	}
+}
+
+func TestLoadConfig_MaxContextTokens(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+
+	path := writeConfig(t, `
+key_pool:
+  max_context_tokens:
+    gpt-4: 32768
+    gemini-1.5-flash: 1000000
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	want := map[string]int{"gpt-4": 32768, "gemini-1.5-pro": 1048576, "gemini-1.5-flash": 1000000}
+	for model, n := range want {
+		if got := cfg.KeyPool.MaxContextTokens[model]; got != n {
+			t.Errorf("MaxContextTokens[%s] = %d, want %d (all: %v)", model, got, n, cfg.KeyPool.MaxContextTokens)
+		}
+	}
+}
+
+func TestLoadConfig_RetryOnEmptyResponse(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+
+	tests := []struct {
+		name string
+		yaml string
+		want bool
+	}{
+		{"default", "", true},
+		{"disabled", "  retry_on_empty_response: false\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, "key_pool:\n"+tt.yaml+`  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			cfg, err := loadConfig(path)
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if got := cfg.KeyPool.RetryOnEmptyResponse; got != tt.want {
+				t.Errorf("RetryOnEmptyResponse = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_DuplicateEnvKeys(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "AIzaSyEnvKey0001, AIzaSyEnvKey0002,AIzaSyEnvKey0001")
+
+	cfg, err := loadConfig(validConfig)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	var names []string
+	for _, k := range cfg.KeyPool.Keys {
+		names = append(names, k.Name)
+	}
+	if got := strings.Join(names, ","); got != "env_key_0,env_key_1" {
+		t.Errorf("key names = %s, want env_key_0,env_key_1", got)
+	}
+}
+
+func TestDetectProviderFromKey(t *testing.T) {
+	custom := map[string]string{"mk-": "openai", "gsk_live_": "anthropic"}
+	tests := []struct {
+		key    string
+		want   domain.ProviderType
+		wantOK bool
+	}{
+		{"sk-proj-abc", domain.ProviderOpenAI, true},
+		{"sk-ant-api03-abc", domain.ProviderAnthropic, true},
+		{"AIzaSyAbc", domain.ProviderGoogle, true},
+		{"gsk_abc", domain.ProviderGroq, true},
+		{"pk-abc", domain.ProviderCohere, true},
+		{"hf_abc", domain.ProviderHuggingFace, true},
+		{"xai-abc", domain.ProviderXAI, true},
+		{"mk-abc", domain.ProviderOpenAI, true},
+		{"gsk_live_abc", domain.ProviderAnthropic, true},
+		{"unknown-abc", domain.ProviderGoogle, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := detectProviderFromKey(tt.key, custom)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("detectProviderFromKey(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_CustomPrefixMap(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "mk-EnvKey0001,hf_EnvKey0002")
+	path := writeConfig(t, `
+key_pool:
+  custom_prefix_map:
+    "mk-": openai
+`)
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	var providers []string
+	for _, k := range cfg.KeyPool.Keys {
+		providers = append(providers, string(k.Provider))
+	}
+	if got := strings.Join(providers, ","); got != "openai,huggingface" {
+		t.Errorf("providers = %s, want openai,huggingface", got)
+	}
+}
+
+func TestLoadConfig_DebugSampleRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    string
+		wantErr bool
+	}{
+		{"disabled", "0", false},
+		{"tenth", "0.1", false},
+		{"all", "1", false},
+		{"negative", "-0.5", true},
+		{"above one", "1.5", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+logging:
+  debug_sample_rate: `+tt.rate+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "logging.debug_sample_rate") {
+				t.Errorf("error = %v, want it to name logging.debug_sample_rate", err)
+			}
+		})
+	}
+}
+
+func TestValidate_RedactMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{"full", false},
+		{"partial", false},
+		{"none", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+logging:
+  redact_mode: `+tt.mode+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "logging.redact_mode") {
+				t.Errorf("error = %v, want it to name logging.redact_mode", err)
+			}
+		})
+	}
+}
+
+func TestValidate_ProviderCooldownSeconds(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+	path := writeConfig(t, `
+key_pool:
+  cooldown_seconds: 60
+  provider_cooldown_seconds:
+    google: 30
+    openai: 600
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	want := map[domain.ProviderType]int{domain.ProviderGoogle: 30, domain.ProviderOpenAI: 600}
+	if !maps.Equal(cfg.KeyPool.ProviderCooldownSeconds, want) {
+		t.Errorf("ProviderCooldownSeconds = %v, want %v", cfg.KeyPool.ProviderCooldownSeconds, want)
+	}
+
+	path = writeConfig(t, `
+key_pool:
+  provider_cooldown_seconds:
+    openai: -1
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "key_pool.provider_cooldown_seconds.openai") {
+		t.Errorf("loadConfig() error = %v, want one naming key_pool.provider_cooldown_seconds.openai", err)
+	}
+}
+
+func TestValidate_UITheme(t *testing.T) {
+	tests := []struct {
+		theme   string
+		wantErr bool
+	}{
+		{"cyberpunk", false},
+		{"minimal", false},
+		{"none", false},
+		{"neon", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.theme, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+logging:
+  ui_theme: `+tt.theme+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "logging.ui_theme") {
+				t.Errorf("error = %v, want it to name logging.ui_theme", err)
+			}
+		})
+	}
+}
+
+func TestValidate_RevivalStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		wantErr  bool
+	}{
+		{"immediate", false},
+		{"gradual", false},
+		{"staggered", false},
+		{"lazy", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+key_pool:
+  revival_strategy: `+tt.strategy+`
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "key_pool.revival_strategy") {
+				t.Errorf("error = %v, want it to name key_pool.revival_strategy", err)
+			}
+		})
+	}
+}
+
+func TestValidate_RequestIDHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{"default", `"X-Request-ID"`, false},
+		{"custom", `"X-Correlation-ID"`, false},
+		{"empty", `""`, true},
+		{"space", `"X Request ID"`, true},
+		{"colon", `"X-Request-ID:"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+server:
+  request_id_header: `+tt.header+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "server.request_id_header") {
+				t.Errorf("error = %v, want it to name server.request_id_header", err)
+			}
+		})
+	}
+}
+
+func TestValidate_TrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies string
+		wantErr bool
+	}{
+		{"empty", `[]`, false},
+		{"ips and ranges", `["10.0.0.1", "172.16.0.0/12", "::1"]`, false},
+		{"bad ip", `["10.0.0.300"]`, true},
+		{"bad range", `["10.0.0.0/40"]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+server:
+  trusted_proxies: `+tt.proxies+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "server.trusted_proxies") {
+				t.Errorf("error = %v, want it to name server.trusted_proxies", err)
+			}
+		})
+	}
+}
+
+func TestValidate_RoutingRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{"none", `[]`, false},
+		{"valid", `[{name: premium, priority: 1, condition: 'user_tag == "premium"', target: {key_tags: [premium]}}]`, false},
+		{"bad condition", `[{condition: 'tier == "gold"', target: {key_tags: [premium]}}]`, true},
+		{"no key tags", `[{condition: 'model == "gpt-4"'}]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+routing:
+  rules: `+tt.rules+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+      tags: [premium]
+`)
+			cfg, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "routing.rules") {
+					t.Errorf("error = %v, want it to name routing.rules", err)
+				}
+				return
+			}
+			if got := cfg.KeyPool.Keys[0].Tags; len(got) != 1 || got[0] != "premium" {
+				t.Errorf("Tags = %v, want [premium]", got)
+			}
+		})
+	}
+}
+
+func TestValidate_RetryStatusCodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		retryable string
+		never     string
+		wantField string
+	}{
+		{"empty", `[]`, `[]`, ""},
+		{"valid", `[400]`, `[500, 501]`, ""},
+		{"success code", `[200]`, `[]`, "key_pool.retryable_status_codes[0]"},
+		{"out of range", `[]`, `[500, 600]`, "key_pool.non_retryable_status_codes[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+key_pool:
+  retryable_status_codes: `+tt.retryable+`
+  non_retryable_status_codes: `+tt.never+`
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != (tt.wantField != "") {
+				t.Fatalf("loadConfig() error = %v, want field %q", err, tt.wantField)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantField) {
+				t.Errorf("error = %v, want it to name %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestValidate_GoogleBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		wantErr bool
+	}{
+		{"https", "https://generativelanguage.googleapis.com/v1beta", false},
+		{"http mock", "http://mock-provider:8081/v1beta", false},
+		{"no scheme", "mock-provider:8081", true},
+		{"ftp", "ftp://example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+provider:
+  google:
+    base_url: "`+tt.baseURL+`"
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "provider.google.base_url") {
+				t.Errorf("error = %v, want it to name provider.google.base_url", err)
+			}
+		})
+	}
+}
+
+func TestValidate_StateMaxAge(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxAge  string
+		wantErr bool
+	}{
+		{"one hour", "3600", false},
+		{"any age", "0", false},
+		{"negative", "-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+admin:
+  state_path: "/var/lib/hpn-router/state.json"
+  state_max_age_seconds: `+tt.maxAge+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "admin.state_max_age_seconds") {
+				t.Errorf("error = %v, want it to name admin.state_max_age_seconds", err)
+			}
+		})
+	}
+}
+
+func TestValidate_LogLevelRevert(t *testing.T) {
+	tests := []struct {
+		name    string
+		revert  string
+		want    int
+		wantErr bool
+	}{
+		{"default", "", 300, false},
+		{"never", "0", 0, false},
+		{"negative", "-1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			admin := ""
+			if tt.revert != "" {
+				admin = "admin:\n  log_level_revert_seconds: " + tt.revert + "\n"
+			}
+			path := writeConfig(t, admin+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			cfg, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "admin.log_level_revert_seconds") {
+					t.Errorf("error = %v, want it to name admin.log_level_revert_seconds", err)
+				}
+				return
+			}
+			if cfg.Admin.LogLevelRevertSeconds != tt.want {
+				t.Errorf("LogLevelRevertSeconds = %d, want %d", cfg.Admin.LogLevelRevertSeconds, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_MaxKeyAgeDays(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    string
+		wantErr bool
+	}{
+		{"ninety days", "90", false},
+		{"disabled", "0", false},
+		{"negative", "-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+key_pool:
+  max_key_age_days: `+tt.days+`
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "key_pool.max_key_age_days") {
+				t.Errorf("error = %v, want it to name key_pool.max_key_age_days", err)
+			}
+		})
+	}
+}
+
+func TestValidate_KeyRegions(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseURL  string
+		interval string
+		field    string
+	}{
+		{"regional key", "https://europe-west1-generativelanguage.example.com/v1beta", "30", ""},
+		{"no base url", "", "30", ""},
+		{"relative base url", "europe-west1/v1beta", "30", "key_pool.keys[0].base_url"},
+		{"http base url", "http://europe-west1-generativelanguage.example.com/v1beta", "30", "key_pool.keys[0].base_url"},
+		{"zero interval", "", "0", "key_pool.region_probe_interval_seconds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+key_pool:
+  region_latency_selection: true
+  region_probe_interval_seconds: `+tt.interval+`
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+      region: europe-west1
+      base_url: "`+tt.baseURL+`"
+`)
+			cfg, err := loadConfig(path)
+			if (err != nil) != (tt.field != "") {
+				t.Fatalf("loadConfig() error = %v, want error naming %q", err, tt.field)
+			}
+			if tt.field != "" {
+				if !strings.Contains(err.Error(), tt.field) {
+					t.Errorf("error = %v, want it to name %s", err, tt.field)
+				}
+				return
+			}
+			if got := cfg.KeyPool.Keys[0].Region; got != "europe-west1" {
+				t.Errorf("Region = %q, want europe-west1", got)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_RequestLogFields(t *testing.T) {
+	const keys = `
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`
+	tests := []struct {
+		name  string
+		yaml  string
+		want  []string
+		field string
+	}{
+		{"default", keys, DefaultRequestLogFields, ""},
+		{"selected", "logging:\n  request_log_fields: [status, model]\n" + keys, []string{"status", "model"}, ""},
+		{"empty", "logging:\n  request_log_fields: []\n" + keys, []string{}, ""},
+		{"unknown", "logging:\n  request_log_fields: [status, body]\n" + keys, nil, "logging.request_log_fields[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			cfg, err := loadConfig(writeConfig(t, tt.yaml))
+			if tt.field != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.field) {
+					t.Errorf("loadConfig() error = %v, want it to name %s", err, tt.field)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if got := cfg.Logging.RequestLogFields; !slices.Equal(got, tt.want) {
+				t.Errorf("RequestLogFields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ChaosMode(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+	cfg, err := loadConfig(writeConfig(t, `
+dev:
+  chaos_mode: true
+  chaos_config:
+    failure_rate: 0.5
+    error_type: rate_limit
+    delay_range: ["10ms", "250ms"]
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`))
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	want := adapter.ChaosConfig{
+		FailureRate: 0.5,
+		ErrorType:   adapter.ChaosErrorRateLimit,
+		DelayRange:  [2]time.Duration{10 * time.Millisecond, 250 * time.Millisecond},
+	}
+	if !cfg.Dev.ChaosMode || cfg.Dev.ChaosConfig != want {
+		t.Errorf("Dev = %+v, want chaos mode with %+v", cfg.Dev, want)
+	}
+}
+
+func TestLoadConfig_ChaosModeEmptyErrorType(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+	cfg, err := loadConfig(writeConfig(t, `
+dev:
+  chaos_mode: true
+  chaos_config:
+    failure_rate: 1
+    error_type: ""
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`))
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v, want an empty error_type accepted", err)
+	}
+	if cfg.Dev.ChaosConfig.ErrorType != "" {
+		t.Errorf("ErrorType = %q, want empty", cfg.Dev.ChaosConfig.ErrorType)
+	}
+}
+
+func TestLoadConfig_KeyExpiresAt(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+	cfg, err := loadConfig(writeConfig(t, `
+key_pool:
+  keys:
+    - key: "AIzaSyTrialKey00000001"
+      provider: google
+      enabled: true
+      expires_at: "2025-12-31T23:59:59Z"
+    - key: "AIzaSyPaidKey000000002"
+      provider: google
+      enabled: true
+`))
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	want := time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC)
+	if got := cfg.KeyPool.Keys[0].ExpiresAt; got == nil || !got.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", got, want)
+	}
+	if got := cfg.KeyPool.Keys[1].ExpiresAt; got != nil {
+		t.Errorf("ExpiresAt = %v, want nil without expires_at", got)
+	}
+
+	_, err = loadConfig(writeConfig(t, `
+key_pool:
+  keys:
+    - key: "AIzaSyTrialKey00000001"
+      provider: google
+      enabled: true
+      expires_at: "end of the year"
+`))
+	if err == nil {
+		t.Error("loadConfig() accepted an expires_at that is not RFC 3339")
+	}
+}
+
+func TestValidate_KeyPriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority string
+		wantErr  bool
+	}{
+		{"highest", "0", false},
+		{"fallback", "2", false},
+		{"negative", "-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+key_pool:
+  strategy: priority
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+      priority: `+tt.priority+`
+`)
+			cfg, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "key_pool.keys[0].priority") {
+					t.Errorf("error = %v, want it to name key_pool.keys[0].priority", err)
+				}
+				return
+			}
+			if got := cfg.KeyPool.Strategy; got != domain.StrategyPriority {
+				t.Errorf("Strategy = %q, want priority", got)
+			}
+		})
+	}
+}
+
+func TestValidate_MaxTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultMax int
+		maxAllowed int
+		wantField  string
+	}{
+		{"unset", 0, 0, ""},
+		{"default below maximum", 1024, 4096, ""},
+		{"negative default", -1, 0, "provider.default_max_tokens"},
+		{"negative maximum", 0, -1, "provider.max_allowed_tokens"},
+		{"default above maximum", 8192, 4096, "provider.default_max_tokens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, fmt.Sprintf(`
+provider:
+  default_max_tokens: %d
+  max_allowed_tokens: %d
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`, tt.defaultMax, tt.maxAllowed))
+			_, err := loadConfig(path)
+			if (err != nil) != (tt.wantField != "") {
+				t.Fatalf("loadConfig() error = %v, want error naming %q", err, tt.wantField)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantField) {
+				t.Errorf("error = %v, want it to name %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestValidate_ProviderRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  string
+		wantErr bool
+	}{
+		{"none", "{}", false},
+		{"google", "{google: 60}", false},
+		{"negative", "{google: -1}", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+provider:
+  rate_limit_per_minute: `+tt.limits+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			cfg, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "provider.rate_limit_per_minute.google") {
+					t.Errorf("error = %v, want it to name provider.rate_limit_per_minute.google", err)
+				}
+				return
+			}
+			if tt.name == "google" && cfg.Provider.RateLimitPerMinute[domain.ProviderGoogle] != 60 {
+				t.Errorf("RateLimitPerMinute = %v, want google: 60", cfg.Provider.RateLimitPerMinute)
+			}
+		})
+	}
+}
+
+func TestValidate_WarmUpModels(t *testing.T) {
+	tests := []struct {
+		name    string
+		models  string
+		wantErr bool
+	}{
+		{"none", "[]", false},
+		{"models", `["gemini-1.5-flash", "gemini-1.5-pro"]`, false},
+		{"empty name", `["gemini-1.5-flash", " "]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeys, "")
+			path := writeConfig(t, `
+startup_checks:
+  warm_up_models: `+tt.models+`
+key_pool:
+  keys:
+    - key: "AIzaSyTestKey1234567890"
+      provider: google
+      enabled: true
+`)
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "startup_checks.warm_up_models[1]") {
+				t.Errorf("error = %v, want it to name startup_checks.warm_up_models[1]", err)
+			}
+		})
+	}
+}
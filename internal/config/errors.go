@@ -2,7 +2,10 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 )
 
@@ -20,29 +23,160 @@ func (e *ConfigError) Unwrap() error {
 	return e.Err
 }
 
+// Codes of ValidationFieldError, classifying what is wrong with a field.
+const (
+	// ErrorCodeRequired is a missing or empty field.
+	ErrorCodeRequired = "required"
+
+	// ErrorCodeOutOfRange is a number outside its allowed range.
+	ErrorCodeOutOfRange = "out_of_range"
+
+	// ErrorCodeInvalidEnum is a value not among the allowed ones.
+	ErrorCodeInvalidEnum = "invalid_enum"
+
+	// ErrorCodeInvalidFormat is a value that does not parse, such as a
+	// malformed URL or header name.
+	ErrorCodeInvalidFormat = "invalid_format"
+
+	// ErrorCodeDuplicate is a value that must differ from another one.
+	ErrorCodeDuplicate = "duplicate"
+
+	// ErrorCodeMissingDependency is a field that needs another field set,
+	// or that another field's setting makes required.
+	ErrorCodeMissingDependency = "missing_dependency"
+)
+
+// ValidationFieldError is a single invalid configuration field.
+type ValidationFieldError struct {
+	// Field is the dotted config path, such as "server.port" or "key_pool.keys[0].key".
+	Field string `json:"field"`
+
+	// Code is one of the ErrorCode constants.
+	Code string `json:"code"`
+
+	// Message says what is wrong, written to follow the field name.
+	Message string `json:"message"`
+
+	// Value is the offending value, empty when missing or secret.
+	Value string `json:"value,omitempty"`
+}
+
+func (e ValidationFieldError) String() string {
+	return e.Field + " " + e.Message
+}
+
 // ValidationError represents configuration validation errors.
 type ValidationError struct {
-	Errors []string
+	Errors []ValidationFieldError
+}
+
+// add records an invalid field with its error code. A nil or empty value
+// is left out.
+func (e *ValidationError) add(field, code string, value interface{}, message string) {
+	v := ""
+	if value != nil {
+		v = fmt.Sprint(value)
+	}
+	e.Errors = append(e.Errors, ValidationFieldError{Field: field, Code: code, Message: message, Value: v})
 }
 
 func (e *ValidationError) Error() string {
 	if len(e.Errors) == 1 {
 		return fmt.Sprintf("configuration validation failed: %s", e.Errors[0])
 	}
+	lines := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		lines[i] = fe.String()
+	}
 	return fmt.Sprintf("configuration validation failed with %d errors:\n  - %s",
-		len(e.Errors), strings.Join(e.Errors, "\n  - "))
+		len(e.Errors), strings.Join(lines, "\n  - "))
 }
 
-// HasError checks if a specific field has a validation error.
+// HasError checks if field, or a field nested under it, has a validation
+// error. HasError("key_pool.keys") matches "key_pool.keys[0].key".
 func (e *ValidationError) HasError(field string) bool {
-	for _, err := range e.Errors {
-		if strings.Contains(err, field) {
+	for _, fe := range e.Errors {
+		if fe.Field == field ||
+			strings.HasPrefix(fe.Field, field+".") ||
+			strings.HasPrefix(fe.Field, field+"[") {
 			return true
 		}
 	}
 	return false
 }
 
+// FilterByCode returns the field errors with code, in order.
+func (e *ValidationError) FilterByCode(code string) []ValidationFieldError {
+	var errs []ValidationFieldError
+	for _, fe := range e.Errors {
+		if fe.Code == code {
+			errs = append(errs, fe)
+		}
+	}
+	return errs
+}
+
+// AsMap returns the messages of each invalid field, keyed by field.
+func (e *ValidationError) AsMap() map[string][]string {
+	m := make(map[string][]string, len(e.Errors))
+	for _, fe := range e.Errors {
+		m[fe.Field] = append(m[fe.Field], fe.Message)
+	}
+	return m
+}
+
+// MarshalJSON renders the error as {"error": "...", "errors": [...]} so it can
+// be returned by an API as is.
+func (e *ValidationError) MarshalJSON() ([]byte, error) {
+	errs := e.Errors
+	if errs == nil {
+		errs = []ValidationFieldError{}
+	}
+	return json.Marshal(struct {
+		Error  string                 `json:"error"`
+		Errors []ValidationFieldError `json:"errors"`
+	}{
+		Error:  "configuration validation failed",
+		Errors: errs,
+	})
+}
+
+// ProblemType identifies configuration validation problems in
+// AsProblemsJSON.
+const ProblemType = "urn:hpn-router:problem:config-validation"
+
+// AsProblemsJSON renders the error as an RFC 9457 Problem Details object,
+// with the field errors in an "errors" extension member:
+//
+//	{"type": "urn:hpn-router:problem:config-validation",
+//	 "title": "Configuration validation failed", "status": 422,
+//	 "detail": "2 configuration fields are invalid", "errors": [...]}
+func (e *ValidationError) AsProblemsJSON() []byte {
+	errs := e.Errors
+	if errs == nil {
+		errs = []ValidationFieldError{}
+	}
+	detail := fmt.Sprintf("%d configuration fields are invalid", len(errs))
+	if len(errs) == 1 {
+		detail = errs[0].String()
+	}
+	// A struct of strings, an int and string fields always marshals.
+	b, _ := json.Marshal(struct {
+		Type   string                 `json:"type"`
+		Title  string                 `json:"title"`
+		Status int                    `json:"status"`
+		Detail string                 `json:"detail"`
+		Errors []ValidationFieldError `json:"errors"`
+	}{
+		Type:   ProblemType,
+		Title:  "Configuration validation failed",
+		Status: http.StatusUnprocessableEntity,
+		Detail: detail,
+		Errors: errs,
+	})
+	return b
+}
+
 // MissingKeyError represents a missing required configuration key error.
 type MissingKeyError struct {
 	Key string
@@ -67,10 +201,10 @@ func (e *InvalidValueError) Error() string {
 	return fmt.Sprintf("invalid value '%v' for key '%s'", e.Value, e.Key)
 }
 
-// IsValidationError checks if an error is a ValidationError.
+// IsValidationError checks if err is or wraps a ValidationError.
 func IsValidationError(err error) bool {
-	_, ok := err.(*ValidationError)
-	return ok
+	var verr *ValidationError
+	return errors.As(err, &verr)
 }
 
 // IsConfigError checks if an error is a ConfigError.
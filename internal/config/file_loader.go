@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// LoadAPIKeysFromFile reads API keys from the file at path, such as a
+// Kubernetes secret mounted as a volume. The file holds one key per line,
+// skipping empty lines and lines starting with #, or a JSON array of keys
+// when it starts with [. Each key's provider is detected from its prefix
+// and keys listed more than once are loaded once. Keys are named
+// file_key_<n>, counting from 0.
+func LoadAPIKeysFromFile(path string) ([]domain.APIKey, error) {
+	return loadAPIKeysFromFile(path, nil)
+}
+
+// loadAPIKeysFromFile is LoadAPIKeysFromFile, also detecting the prefixes
+// in custom.
+func loadAPIKeysFromFile(path string, custom map[string]string) ([]domain.APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var raw []string
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("key file %s: invalid JSON array of keys: %w", path, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			raw = append(raw, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("key file %s: %w", path, err)
+		}
+	}
+
+	keys := make([]domain.APIKey, 0, len(raw))
+	seen := make(map[string]struct{}, len(raw))
+	for _, key := range raw {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		fp := domain.KeyFingerprint(key)
+		if _, ok := seen[fp]; ok {
+			continue
+		}
+		seen[fp] = struct{}{}
+
+		provider, _ := detectProviderFromKey(key, custom)
+		keys = append(keys, domain.APIKey{
+			Key:      key,
+			Name:     fmt.Sprintf("file_key_%d", len(keys)),
+			Provider: provider,
+			Enabled:  true,
+			Weight:   1,
+		})
+	}
+	return keys, nil
+}
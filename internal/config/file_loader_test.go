@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// writeKeyFile writes content to a key file in a temporary directory.
+func writeKeyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestLoadAPIKeysFromFile(t *testing.T) {
+	want := []domain.APIKey{
+		{Key: "AIzaSyFileKey0001", Name: "file_key_0", Provider: domain.ProviderGoogle, Enabled: true, Weight: 1},
+		{Key: "sk-proj-filekey", Name: "file_key_1", Provider: domain.ProviderOpenAI, Enabled: true, Weight: 1},
+		{Key: "gsk_filekey", Name: "file_key_2", Provider: domain.ProviderGroq, Enabled: true, Weight: 1},
+	}
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"flat", "# production keys\nAIzaSyFileKey0001\n\n  sk-proj-filekey  \r\n# rotated 2026-01\ngsk_filekey\nAIzaSyFileKey0001\n"},
+		{"json", "\n[\"AIzaSyFileKey0001\", \"sk-proj-filekey\", \"\", \"gsk_filekey\", \"AIzaSyFileKey0001\"]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadAPIKeysFromFile(writeKeyFile(t, tt.content))
+			if err != nil {
+				t.Fatalf("LoadAPIKeysFromFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadAPIKeysFromFile() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeysFromFile_Errors(t *testing.T) {
+	if _, err := LoadAPIKeysFromFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file: error = nil")
+	}
+	if _, err := LoadAPIKeysFromFile(writeKeyFile(t, `["AIzaSyFileKey0001",`)); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("invalid JSON: error = %v, want it to mention JSON", err)
+	}
+}
+
+func TestLoadConfig_KeyFile(t *testing.T) {
+	keyFile := writeKeyFile(t, "AIzaSyFileKey0001\nmk-filekey\n")
+	path := writeConfig(t, `
+key_pool:
+  key_file: "`+keyFile+`"
+  custom_prefix_map:
+    "mk-": openai
+  keys:
+    - key: "AIzaSyConfigKey01"
+      provider: google
+      enabled: true
+`)
+
+	t.Setenv(EnvAPIKeys, "")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	var got []string
+	for _, k := range cfg.KeyPool.Keys {
+		got = append(got, k.Name+"="+k.Key+"/"+string(k.Provider))
+	}
+	if want := "file_key_0=AIzaSyFileKey0001/google,file_key_1=mk-filekey/openai"; strings.Join(got, ",") != want {
+		t.Errorf("keys = %s, want %s", strings.Join(got, ","), want)
+	}
+
+	// HPN_API_KEYS wins over the key file.
+	t.Setenv(EnvAPIKeys, "AIzaSyEnvKey0001")
+	if cfg, err = loadConfig(path); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if len(cfg.KeyPool.Keys) != 1 || cfg.KeyPool.Keys[0].Name != "env_key_0" {
+		t.Errorf("keys = %+v, want only env_key_0", cfg.KeyPool.Keys)
+	}
+
+	// A key file that cannot be read fails the load.
+	t.Setenv(EnvAPIKeys, "")
+	missing := writeConfig(t, "key_pool:\n  key_file: "+filepath.Join(t.TempDir(), "missing")+"\n")
+	if _, err := loadConfig(missing); err == nil || !strings.Contains(err.Error(), "key file") {
+		t.Errorf("missing key file: error = %v, want a key file error", err)
+	}
+}
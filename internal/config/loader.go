@@ -2,11 +2,17 @@
 package config
 
 import (
+	"compress/gzip"
 	"fmt"
+	"log/slog"
 	"os"
+	"reflect"
 	"strings"
+	"time"
 
+	"github.com/hpn/hpn-g-router/internal/adapter"
 	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -23,9 +29,10 @@ const (
 // loadConfig loads the configuration from environment variables and files.
 // Priority order (ZERO-TRUST - highest to lowest):
 // 1. HPN_API_KEYS env var (comma-separated) - PRIMARY SOURCE
-// 2. Environment variables (prefixed with HPN_ROUTER_)
-// 3. config.yaml - FALLBACK for local development ONLY
-// 4. Default values
+// 2. key_pool.key_file, replacing the keys of config.yaml
+// 3. Environment variables (prefixed with HPN_ROUTER_)
+// 4. config.yaml - FALLBACK for local development ONLY
+// 5. Default values
 func loadConfig(configPath string) (*Configuration, error) {
 	v := viper.New()
 
@@ -68,13 +75,36 @@ func loadConfig(configPath string) (*Configuration, error) {
 
 	// Unmarshal configuration
 	var cfg Configuration
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToTimeHookFunc(time.RFC3339),
+		mapstructure.StringToSliceHookFunc(","),
+		joinDottedKeys,
+	))); err != nil {
 		return nil, &ConfigError{
 			Op:  "unmarshal",
 			Err: fmt.Errorf("failed to unmarshal config: %w", err),
 		}
 	}
 
+	// Viper replaces default maps wholesale, so merge route defaults here.
+	if cfg.KeyPool.EndpointRetries == nil {
+		cfg.KeyPool.EndpointRetries = make(map[string]int)
+	}
+	for path, n := range DefaultEndpointRetries {
+		if _, ok := cfg.KeyPool.EndpointRetries[path]; !ok {
+			cfg.KeyPool.EndpointRetries[path] = n
+		}
+	}
+	if cfg.KeyPool.MaxContextTokens == nil {
+		cfg.KeyPool.MaxContextTokens = make(map[string]int)
+	}
+	for model, n := range DefaultMaxContextTokens {
+		if _, ok := cfg.KeyPool.MaxContextTokens[model]; !ok {
+			cfg.KeyPool.MaxContextTokens[model] = n
+		}
+	}
+
 	// PRIORITY: Load API keys from HPN_API_KEYS env var first
 	envKeysLoaded, err := loadAPIKeysFromPrimaryEnv(&cfg)
 	if err != nil {
@@ -88,6 +118,18 @@ func loadConfig(configPath string) (*Configuration, error) {
 	if envKeysLoaded {
 		fmt.Fprintf(os.Stderr, "[SECURITY] Using HPN_API_KEYS env var (file config keys ignored)\n")
 	} else {
+		// Next: a key file, such as a mounted secret, replaces the config keys
+		if cfg.KeyPool.KeyFile != "" {
+			keys, err := loadAPIKeysFromFile(cfg.KeyPool.KeyFile, cfg.KeyPool.CustomPrefixMap)
+			if err != nil {
+				return nil, &ConfigError{
+					Op:  "load_key_file",
+					Err: err,
+				}
+			}
+			cfg.KeyPool.Keys = keys
+		}
+
 		// Fallback: Load API keys from legacy HPN_ROUTER_API_KEY_* format
 		if err := loadAPIKeysFromLegacyEnv(&cfg); err != nil {
 			return nil, &ConfigError{
@@ -113,16 +155,119 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.read_timeout_seconds", 30)
 	v.SetDefault("server.write_timeout_seconds", 30)
 	v.SetDefault("server.shutdown_timeout_seconds", 15)
+	v.SetDefault("server.queue_max_size", 100)
+	v.SetDefault("server.queue_timeout_seconds", 30)
+	v.SetDefault("server.worker_pool_size", 0)
+	v.SetDefault("server.pprof_enabled", false)
+	v.SetDefault("server.pprof_port", 6060)
+	v.SetDefault("server.record_path", "")
+	v.SetDefault("server.tls_enabled", false)
+	v.SetDefault("server.tls_cert_file", "")
+	v.SetDefault("server.tls_key_file", "")
+	v.SetDefault("server.tls_auto_cert", false)
+	v.SetDefault("server.tls_auto_cert_domains", []string{})
+	v.SetDefault("server.tls_auto_cert_email", "")
+	v.SetDefault("server.tls_cache_dir", "certs")
+	v.SetDefault("server.request_id_header", "X-Request-ID")
+	v.SetDefault("server.trusted_proxies", []string{})
+	v.SetDefault("server.trusted_proxy_count", 1)
+	v.SetDefault("server.trusted_proxy_header", "X-Forwarded-For")
+	v.SetDefault("server.compression_level", gzip.DefaultCompression)
+	v.SetDefault("server.compression_min_size", 1024)
 
 	// Key pool defaults
 	v.SetDefault("key_pool.strategy", "round-robin")
+	v.SetDefault("key_pool.secure_random", false)
+	v.SetDefault("key_pool.key_file", "")
 	v.SetDefault("key_pool.retry_count", 3)
 	v.SetDefault("key_pool.cooldown_seconds", 60)
+	v.SetDefault("key_pool.decay_alpha", 0.1)
+	v.SetDefault("key_pool.max_batch_concurrency", 10)
+	v.SetDefault("key_pool.latency_based_selection", false)
+	v.SetDefault("key_pool.region_latency_selection", false)
+	v.SetDefault("key_pool.region_probe_interval_seconds", 30)
+	v.SetDefault("key_pool.max_concurrent_per_key", 0)
+	v.SetDefault("key_pool.min_active_keys_threshold", 1)
+	v.SetDefault("key_pool.max_key_age_days", 0)
+	v.SetDefault("key_pool.revival_strategy", "immediate")
+	v.SetDefault("key_pool.retry_on_empty_response", true)
 
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
 	v.SetDefault("logging.format", "json")
 	v.SetDefault("logging.output_path", "")
+	v.SetDefault("logging.max_size_mb", 100)
+	v.SetDefault("logging.max_backups", 3)
+	v.SetDefault("logging.max_age_days", 28)
+	v.SetDefault("logging.also_log_to_stdout", false)
+	v.SetDefault("logging.slow_request_threshold_seconds", 30)
+	v.SetDefault("logging.debug_sample_rate", 1.0)
+	v.SetDefault("logging.body_hashing", false)
+	v.SetDefault("logging.redact_mode", "full")
+	v.SetDefault("logging.ui_theme", "cyberpunk")
+	v.SetDefault("logging.request_log_fields", DefaultRequestLogFields)
+
+	// Proxy defaults
+	v.SetDefault("proxy.validate_responses", true)
+	v.SetDefault("proxy.expose_attempt_header", true)
+
+	// Outbound HTTP connection pool defaults
+	v.SetDefault("http.max_idle_conns", 100)
+	v.SetDefault("http.max_idle_conns_per_host", 10)
+	v.SetDefault("http.idle_conn_timeout_seconds", 90)
+	v.SetDefault("http.tls_handshake_timeout_seconds", 10)
+	v.SetDefault("http.disable_compression", false)
+
+	// Provider defaults
+	v.SetDefault("provider.global_system_prompt", "")
+	v.SetDefault("provider.default_max_tokens", 0)
+	v.SetDefault("provider.max_allowed_tokens", 0)
+	v.SetDefault("provider.google.base_url", adapter.DefaultGeminiBaseURL)
+	v.SetDefault("provider.google.default_top_k", 0)
+	v.SetDefault("provider.google.system_prompt_separator", adapter.DefaultSystemPromptSeparator)
+	v.SetDefault("provider.google.max_candidates", adapter.MaxGeminiCandidates)
+	v.SetDefault("provider.google.forward_user_field", false)
+	v.SetDefault("provider.google.search_grounding", false)
+	v.SetDefault("provider.google.flash_default_max_tokens", 0)
+	v.SetDefault("provider.google.adapter_cache_entries", 0)
+	v.SetDefault("routing.fallback_to_first", false)
+	v.SetDefault("notifications.webhook_url", "")
+	v.SetDefault("notifications.webhook_retry_count", 3)
+	v.SetDefault("notifications.hmac_secret", "")
+	v.SetDefault("metrics.influxdb.url", "")
+	v.SetDefault("metrics.influxdb.token", "")
+	v.SetDefault("metrics.influxdb.bucket", "")
+	v.SetDefault("metrics.influxdb.org", "")
+	v.SetDefault("metrics.influxdb.flush_interval_seconds", 10)
+	v.SetDefault("metrics.latency_window", 10000)
+	v.SetDefault("cost_estimation.use_accurate_tokenizer", false)
+	v.SetDefault("cost_estimation.async_buffer_size", 0)
+	v.SetDefault("startup_checks.warm_up_models", []string{})
+
+	// Security defaults
+	v.SetDefault("security.redact_request_bodies", false)
+
+	// Development defaults
+	v.SetDefault("dev.chaos_mode", false)
+	v.SetDefault("dev.chaos_config.failure_rate", 0.1)
+	v.SetDefault("dev.chaos_config.error_type", adapter.ChaosErrorServerError)
+	v.SetDefault("dev.chaos_config.delay_range", []string{"0s", "0s"})
+	v.SetDefault("provider.google.safety_none_allowlist", []string{"127.0.0.1", "::1"})
+
+	// Research default: no safety blocking in any category
+	safety := make([]map[string]string, len(adapter.GeminiHarmCategories))
+	for i, category := range adapter.GeminiHarmCategories {
+		safety[i] = map[string]string{"category": category, "threshold": adapter.SafetyBlockNone}
+	}
+	v.SetDefault("provider.google.safety_settings", safety)
+
+	// Admin defaults (empty token disables the admin API)
+	v.SetDefault("admin.token", "")
+	v.SetDefault("admin.snapshot_path", "")
+	v.SetDefault("admin.drain_timeout_seconds", 30)
+	v.SetDefault("admin.state_path", "")
+	v.SetDefault("admin.state_max_age_seconds", 3600)
+	v.SetDefault("admin.log_level_revert_seconds", 300)
 }
 
 // loadAPIKeysFromPrimaryEnv loads API keys from the HPN_API_KEYS environment variable.
@@ -143,6 +288,7 @@ func loadAPIKeysFromPrimaryEnv(cfg *Configuration) (bool, error) {
 
 	// Clear existing keys from file config (env takes priority)
 	cfg.KeyPool.Keys = make([]domain.APIKey, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
 
 	for i, key := range keys {
 		key = strings.TrimSpace(key)
@@ -150,8 +296,21 @@ func loadAPIKeysFromPrimaryEnv(cfg *Configuration) (bool, error) {
 			continue
 		}
 
+		// Skip keys listed more than once
+		fp := domain.KeyFingerprint(key)
+		if _, ok := seen[fp]; ok {
+			continue
+		}
+		seen[fp] = struct{}{}
+
 		// Auto-detect provider from key prefix
-		provider := detectProviderFromKey(key)
+		provider, ok := detectProviderFromKey(key, cfg.KeyPool.CustomPrefixMap)
+		if !ok {
+			slog.Debug("unknown key prefix, defaulting provider",
+				slog.String("fingerprint", fp),
+				slog.String("provider", string(provider)),
+			)
+		}
 
 		cfg.KeyPool.Keys = append(cfg.KeyPool.Keys, domain.APIKey{
 			Key:      key,
@@ -165,19 +324,46 @@ func loadAPIKeysFromPrimaryEnv(cfg *Configuration) (bool, error) {
 	return len(cfg.KeyPool.Keys) > 0, nil
 }
 
+// keyPrefixes maps the key prefixes of known providers to their provider.
+var keyPrefixes = map[string]domain.ProviderType{
+	"sk-ant-": domain.ProviderAnthropic,
+	"sk-":     domain.ProviderOpenAI,
+	"AIza":    domain.ProviderGoogle,
+	"gsk_":    domain.ProviderGroq,
+	"pk-":     domain.ProviderCohere,
+	"hf_":     domain.ProviderHuggingFace,
+	"xai-":    domain.ProviderXAI,
+}
+
 // detectProviderFromKey attempts to identify the provider from key format.
-func detectProviderFromKey(key string) domain.ProviderType {
-	switch {
-	case strings.HasPrefix(key, "sk-"):
-		return domain.ProviderType("openai")
-	case strings.HasPrefix(key, "sk-ant-"):
-		return domain.ProviderType("anthropic")
-	case strings.HasPrefix(key, "AIza"):
-		return domain.ProviderType("google")
-	default:
-		// Default to google since we're routing to Gemini
-		return domain.ProviderType("google")
+// Prefixes in custom are checked before the built-in ones and the longest
+// matching prefix wins, so "sk-ant-" keys are not taken for OpenAI keys.
+// It reports false for an unknown format, which defaults to google since
+// we're routing to Gemini.
+func detectProviderFromKey(key string, custom map[string]string) (domain.ProviderType, bool) {
+	if provider, ok := longestPrefixMatch(key, custom); ok {
+		return domain.ProviderType(provider), true
 	}
+	if provider, ok := longestPrefixMatch(key, keyPrefixes); ok {
+		return provider, true
+	}
+	return domain.ProviderGoogle, false
+}
+
+// longestPrefixMatch returns the value of the longest key of prefixes that
+// key starts with.
+func longestPrefixMatch[V any](key string, prefixes map[string]V) (V, bool) {
+	var (
+		match V
+		found bool
+		best  int
+	)
+	for prefix, v := range prefixes {
+		if len(prefix) > best && strings.HasPrefix(key, prefix) {
+			match, found, best = v, true, len(prefix)
+		}
+	}
+	return match, found
 }
 
 // loadAPIKeysFromLegacyEnv loads API keys from legacy HPN_ROUTER_API_KEY_* format.
@@ -186,6 +372,11 @@ func loadAPIKeysFromLegacyEnv(cfg *Configuration) error {
 	envKeys := os.Environ()
 	prefix := envPrefix + "_API_KEY_"
 
+	seen := make(map[string]struct{}, len(cfg.KeyPool.Keys))
+	for _, existingKey := range cfg.KeyPool.Keys {
+		seen[domain.KeyFingerprint(existingKey.Key)] = struct{}{}
+	}
+
 	for _, env := range envKeys {
 		if !strings.HasPrefix(env, prefix) {
 			continue
@@ -210,17 +401,11 @@ func loadAPIKeysFromLegacyEnv(cfg *Configuration) error {
 		}
 
 		providerName := strings.ToLower(providerParts[0])
-		keyExists := false
 
 		// Check if key already exists in config
-		for _, existingKey := range cfg.KeyPool.Keys {
-			if existingKey.Key == keyValue {
-				keyExists = true
-				break
-			}
-		}
-
-		if !keyExists {
+		fp := domain.KeyFingerprint(keyValue)
+		if _, keyExists := seen[fp]; !keyExists {
+			seen[fp] = struct{}{}
 			cfg.KeyPool.Keys = append(cfg.KeyPool.Keys, domain.APIKey{
 				Key:      keyValue,
 				Name:     fmt.Sprintf("env_%s", keyName),
@@ -233,3 +418,26 @@ func loadAPIKeysFromLegacyEnv(cfg *Configuration) error {
 
 	return nil
 }
+
+// joinDottedKeys is a decode hook that undoes Viper splitting map keys on
+// its "." delimiter, as in model names like gemini-1.5-pro: nested maps
+// decoded into a map[string]int are flattened back into dotted keys.
+func joinDottedKeys(_, to reflect.Type, data interface{}) (interface{}, error) {
+	m, ok := data.(map[string]interface{})
+	if !ok || to != reflect.TypeOf(map[string]int{}) {
+		return data, nil
+	}
+	flat := make(map[string]interface{}, len(m))
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if nested, ok := v.(map[string]interface{}); ok {
+				walk(prefix+k+".", nested)
+				continue
+			}
+			flat[prefix+k] = v
+		}
+	}
+	walk("", m)
+	return flat, nil
+}
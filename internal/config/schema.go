@@ -0,0 +1,209 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/ui"
+)
+
+// SchemaDialect is the JSON Schema version Schema follows.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// configSource is the source of config.go, whose field comments become the
+// descriptions in Schema.
+//
+//go:embed config.go
+var configSource []byte
+
+// typeEnums lists the values allowed for string types used in the
+// configuration.
+var typeEnums = map[reflect.Type][]string{
+	reflect.TypeOf(domain.RotationStrategy("")): {
+		string(domain.StrategyRoundRobin), string(domain.StrategyRandom),
+		string(domain.StrategyWeighted), string(domain.StrategyLeastUsed),
+		string(domain.StrategyPriority),
+	},
+	reflect.TypeOf(domain.RevivalStrategy("")): {
+		string(domain.RevivalImmediate), string(domain.RevivalGradual), string(domain.RevivalStaggered),
+	},
+	reflect.TypeOf(domain.ProviderType("")): {
+		string(domain.ProviderOpenAI), string(domain.ProviderAnthropic),
+		string(domain.ProviderGoogle), string(domain.ProviderAzure),
+		string(domain.ProviderGroq), string(domain.ProviderCohere),
+		string(domain.ProviderHuggingFace), string(domain.ProviderXAI),
+	},
+}
+
+// fieldEnums lists the values allowed for plain string fields, keyed by
+// type and field name.
+var fieldEnums = map[string][]string{
+	"LoggingConfig.Level":      {"debug", "info", "warn", "error"},
+	"LoggingConfig.Format":     {"json", "text"},
+	"LoggingConfig.RedactMode": {"full", "partial"},
+	"LoggingConfig.UITheme":    {ui.ThemeCyberpunk, ui.ThemeMinimal, ui.ThemeNone},
+
+	// An empty chaos error type injects server errors.
+	"ChaosConfig.ErrorType": append([]string{""}, adapter.ChaosErrorTypes...),
+
+	// An empty rule strategy uses the pool's strategy.
+	"RoutingTarget.Strategy": {
+		"", string(domain.StrategyRoundRobin), string(domain.StrategyRandom),
+		string(domain.StrategyWeighted), string(domain.StrategyLeastUsed),
+		string(domain.StrategyPriority),
+	},
+}
+
+// requiredFields lists, by type, the keys Validate requires that have no
+// default.
+var requiredFields = map[reflect.Type][]string{
+	reflect.TypeOf(domain.APIKey{}):               {"key", "provider"},
+	reflect.TypeOf(domain.Provider{}):             {"name", "type", "base_url"},
+	reflect.TypeOf(ModelCost{}):                   {"provider", "model"},
+	reflect.TypeOf(adapter.GeminiSafetySetting{}): {"category", "threshold"},
+}
+
+// Schema returns a JSON Schema describing the configuration file. Its
+// properties are the keys config.yaml uses and the descriptions are the
+// field comments of this package. Fields holding secrets are writeOnly.
+func Schema() (map[string]any, error) {
+	docs, err := fieldDocs()
+	if err != nil {
+		return nil, err
+	}
+	s := reflectSchema(reflect.TypeOf(Configuration{}), docs)
+	s["$schema"] = SchemaDialect
+	s["title"] = "HPN-G-Router configuration"
+	return s, nil
+}
+
+// fieldDocs returns the comments of the struct fields in config.go, keyed by
+// type and field name, e.g. "ServerConfig.Port".
+func fieldDocs() (map[string]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "config.go", configSource, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config source: %w", err)
+	}
+
+	docs := make(map[string]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		if st, ok := spec.Type.(*ast.StructType); ok {
+			for _, field := range st.Fields.List {
+				if field.Doc == nil {
+					continue
+				}
+				text := strings.Join(strings.Fields(field.Doc.Text()), " ")
+				for _, name := range field.Names {
+					docs[spec.Name.Name+"."+name.Name] = text
+				}
+			}
+		}
+		return false
+	})
+	return docs, nil
+}
+
+// reflectSchema returns the schema of values of type t as decoded from the
+// configuration file. Lists and maps may be null, as a nil slice or map is
+// marshalled.
+func reflectSchema(t reflect.Type, docs map[string]string) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if values, ok := typeEnums[t]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		// Files hold Go durations such as "500ms"; the loaded configuration
+		// marshals them as nanoseconds.
+		return map[string]any{"type": []string{"string", "integer"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{
+			"type":  []string{"array", "null"},
+			"items": reflectSchema(t.Elem(), docs),
+		}
+	case reflect.Map:
+		s := map[string]any{
+			"type":                 []string{"object", "null"},
+			"additionalProperties": reflectSchema(t.Elem(), docs),
+		}
+		if values, ok := typeEnums[t.Key()]; ok {
+			s["propertyNames"] = map[string]any{"enum": values}
+		}
+		return s
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		props := make(map[string]any)
+		addProperties(props, t, docs)
+		s := map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		if required := requiredFields[t]; len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	default:
+		return map[string]any{}
+	}
+}
+
+// addProperties adds the schema of every exported field of struct type t to
+// props under its mapstructure key. Squashed fields add their own fields.
+func addProperties(props map[string]any, t reflect.Type, docs map[string]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if strings.Contains(opts, "squash") {
+			addProperties(props, f.Type, docs)
+			continue
+		}
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			// mapstructure matches untagged fields by name, ignoring case.
+			name = strings.ToLower(f.Name)
+		}
+
+		s := reflectSchema(f.Type, docs)
+		key := t.Name() + "." + f.Name
+		if values, ok := fieldEnums[key]; ok {
+			s["enum"] = values
+		}
+		if doc := docs[key]; doc != "" {
+			s["description"] = doc
+		}
+		if f.Tag.Get("json") == "-" {
+			s["writeOnly"] = true
+		}
+		props[name] = s
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// compileSchema compiles Schema for validating documents.
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+	s, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("config.schema.json", bytes.NewReader(data)); err != nil {
+		t.Fatalf("AddResource() error = %v", err)
+	}
+	schema, err := compiler.Compile("config.schema.json")
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	return schema
+}
+
+// toDocument returns v as the generic JSON value a validator expects.
+func toDocument(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	return doc
+}
+
+func TestSchema_ValidatesConfiguration(t *testing.T) {
+	t.Setenv(EnvAPIKeys, "")
+	schema := compileSchema(t)
+
+	cfg, err := loadConfig("../../configs/config.yaml")
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if err := schema.Validate(toDocument(t, cfg)); err != nil {
+		t.Errorf("loaded configuration does not match the schema: %v", err)
+	}
+
+	raw, err := os.ReadFile("../../configs/config.yaml")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var file map[string]any
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	if err := schema.Validate(toDocument(t, file)); err != nil {
+		t.Errorf("configs/config.yaml does not match the schema: %v", err)
+	}
+}
+
+func TestSchema_RejectsInvalidConfig(t *testing.T) {
+	schema := compileSchema(t)
+
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"unknown strategy", "key_pool:\n  strategy: fastest\n"},
+		{"unknown provider", "key_pool:\n  keys:\n    - key: k\n      provider: mistral\n"},
+		{"key without provider", "key_pool:\n  keys:\n    - key: k\n"},
+		{"unknown key", "server:\n  prot: 8080\n"},
+		{"wrong type", "server:\n  port: eighty\n"},
+		{"unknown log level", "logging:\n  level: verbose\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file map[string]any
+			if err := yaml.Unmarshal([]byte(tt.yaml), &file); err != nil {
+				t.Fatalf("yaml.Unmarshal() error = %v", err)
+			}
+			if err := schema.Validate(toDocument(t, file)); err == nil {
+				t.Errorf("Validate(%q) = nil, want an error", tt.yaml)
+			}
+		})
+	}
+}
+
+func TestSchema_Annotations(t *testing.T) {
+	s, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var doc struct {
+		Schema     string `json:"$schema"`
+		Properties map[string]struct {
+			Properties map[string]struct {
+				Description string   `json:"description"`
+				Enum        []string `json:"enum"`
+				WriteOnly   bool     `json:"writeOnly"`
+				Items       struct {
+					Required []string `json:"required"`
+				} `json:"items"`
+			} `json:"properties"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if doc.Schema != SchemaDialect {
+		t.Errorf("$schema = %q, want %q", doc.Schema, SchemaDialect)
+	}
+	if got := doc.Properties["server"].Properties["port"].Description; got != "Port is the server port number." {
+		t.Errorf("server.port description = %q, want the field comment", got)
+	}
+	if got := doc.Properties["key_pool"].Properties["strategy"].Enum; strings.Join(got, ",") != "round-robin,random,weighted,least-used,priority" {
+		t.Errorf("key_pool.strategy enum = %v, want the rotation strategies", got)
+	}
+	if got := doc.Properties["logging"].Properties["level"].Enum; strings.Join(got, ",") != "debug,info,warn,error" {
+		t.Errorf("logging.level enum = %v, want the log levels", got)
+	}
+	if got := doc.Properties["key_pool"].Properties["keys"].Items.Required; strings.Join(got, ",") != "key,provider" {
+		t.Errorf("key_pool.keys required = %v, want [key provider]", got)
+	}
+	if !doc.Properties["admin"].Properties["token"].WriteOnly {
+		t.Error("admin.token is not writeOnly")
+	}
+}
+
+func TestConfiguration_Redacted(t *testing.T) {
+	const secret = "AIzaSyTestKey1234567890"
+	cfg := &Configuration{
+		KeyPool: KeyPoolConfig{Keys: []domain.APIKey{{Key: secret, Name: "primary"}}},
+		Admin:   AdminConfig{Token: "admin-secret"},
+	}
+
+	redacted := cfg.Redacted()
+	if cfg.KeyPool.Keys[0].Key != secret {
+		t.Errorf("Redacted() changed the original key to %q", cfg.KeyPool.Keys[0].Key)
+	}
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, s := range []string{secret, "admin-secret"} {
+		if bytes.Contains(data, []byte(s)) {
+			t.Errorf("redacted JSON contains %q: %s", s, data)
+		}
+	}
+	if got := redacted.KeyPool.Keys[0]; got.Key != "AIzaSyTe...7890" || got.Name != "primary" {
+		t.Errorf("redacted key = %+v, want masked key named primary", got)
+	}
+}
@@ -0,0 +1,65 @@
+package domain
+
+// ProviderCost is a provider's price for a model, in USD per million tokens.
+type ProviderCost struct {
+	InputPerMillion  float64 `json:"input_per_million" mapstructure:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million" mapstructure:"output_per_million"`
+}
+
+// CostKey returns the cost table key for model served by provider.
+func CostKey(provider ProviderType, model string) string {
+	return string(provider) + "/" + model
+}
+
+// CostRouter picks the cheapest provider for a model from a cost table keyed
+// by CostKey.
+type CostRouter struct {
+	costs           map[string]ProviderCost
+	fallbackToFirst bool
+}
+
+// CostRouterOption configures a CostRouter.
+type CostRouterOption func(*CostRouter)
+
+// WithFallbackToFirst makes SelectProvider return the first candidate when no
+// candidate has cost data for the model, instead of no provider.
+func WithFallbackToFirst(enabled bool) CostRouterOption {
+	return func(r *CostRouter) { r.fallbackToFirst = enabled }
+}
+
+// NewCostRouter returns a CostRouter over costs.
+func NewCostRouter(costs map[string]ProviderCost, opts ...CostRouterOption) *CostRouter {
+	r := &CostRouter{costs: make(map[string]ProviderCost, len(costs))}
+	for k, c := range costs {
+		r.costs[k] = c
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// SelectProvider returns the provider in providers with the lowest estimated
+// cost for model. The estimate weighs input and output tokens equally.
+// Providers without cost data are skipped; ties go to the earlier provider.
+// With no cost data at all it returns "" or, with WithFallbackToFirst, the
+// first provider.
+func (r *CostRouter) SelectProvider(model string, providers []ProviderType) ProviderType {
+	var best ProviderType
+	bestCost := 0.0
+
+	for _, p := range providers {
+		c, ok := r.costs[CostKey(p, model)]
+		if !ok {
+			continue
+		}
+		if cost := c.InputPerMillion + c.OutputPerMillion; best == "" || cost < bestCost {
+			best, bestCost = p, cost
+		}
+	}
+
+	if best == "" && r.fallbackToFirst && len(providers) > 0 {
+		return providers[0]
+	}
+	return best
+}
@@ -0,0 +1,65 @@
+package domain
+
+import "testing"
+
+func TestCostRouter_SelectProvider(t *testing.T) {
+	costs := map[string]ProviderCost{
+		CostKey(ProviderGoogle, "gpt-4o"):         {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+		CostKey(ProviderOpenAI, "gpt-4o"):         {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+		CostKey(ProviderOpenAI, "gpt-4o-mini"):    {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+		CostKey(ProviderGoogle, "gpt-4o-mini"):    {InputPerMillion: 0.50, OutputPerMillion: 1.50},
+		CostKey(ProviderAnthropic, "gpt-4o-mini"): {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	}
+	both := []ProviderType{ProviderOpenAI, ProviderGoogle}
+
+	tests := []struct {
+		name      string
+		model     string
+		providers []ProviderType
+		fallback  bool
+		want      ProviderType
+	}{
+		{"google cheaper", "gpt-4o", both, false, ProviderGoogle},
+		{"openai cheaper", "gpt-4o-mini", both, false, ProviderOpenAI},
+		{"cheapest without keys is skipped", "gpt-4o", []ProviderType{ProviderOpenAI}, false, ProviderOpenAI},
+		{"tie goes to earlier provider", "gpt-4o-mini", []ProviderType{ProviderAnthropic, ProviderOpenAI}, false, ProviderAnthropic},
+		{"unpriced provider is skipped", "gpt-4o", []ProviderType{ProviderAzure, ProviderOpenAI}, false, ProviderOpenAI},
+		{"no cost data", "gemini-pro", both, false, ""},
+		{"no cost data, fallback", "gemini-pro", both, true, ProviderOpenAI},
+		{"no providers, fallback", "gpt-4o", nil, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewCostRouter(costs, WithFallbackToFirst(tt.fallback))
+			if got := r.SelectProvider(tt.model, tt.providers); got != tt.want {
+				t.Errorf("SelectProvider(%q, %v) = %q, want %q", tt.model, tt.providers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCostRouter_PicksCheaperPartition(t *testing.T) {
+	km := NewKeyManager([]string{"g1", "o1"}, 0, WithKeyProviders(map[string]ProviderType{
+		"g1": ProviderGoogle,
+		"o1": ProviderOpenAI,
+	}))
+	r := NewCostRouter(map[string]ProviderCost{
+		CostKey(ProviderGoogle, "gpt-4o"): {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+		CostKey(ProviderOpenAI, "gpt-4o"): {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+	})
+
+	for i := 0; i < 3; i++ {
+		key, err := km.GetNextKeyByProvider(r.SelectProvider("gpt-4o", km.ActiveProviders()))
+		if err != nil || key != "g1" {
+			t.Errorf("key = %s, %v; want g1 from the cheaper provider", key, err)
+		}
+	}
+
+	// Once the cheaper provider has no keys, the other one serves the model.
+	km.MarkAsDead("g1", "")
+	key, err := km.GetNextKeyByProvider(r.SelectProvider("gpt-4o", km.ActiveProviders()))
+	if err != nil || key != "o1" {
+		t.Errorf("key = %s, %v; want o1 while google has no keys", key, err)
+	}
+}
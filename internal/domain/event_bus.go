@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// DefaultEventBufferSize is how many events each subscriber can fall behind
+// before further events for it are dropped.
+const DefaultEventBufferSize = 64
+
+// EventBus fans key pool events out to subscribers. Each subscriber has its
+// own buffered queue drained by its own goroutine, so a slow subscriber
+// neither delays Publish nor holds up the others; when its queue is full,
+// events for that subscriber are dropped and logged.
+type EventBus struct {
+	mu         sync.RWMutex
+	subs       []*subscriber
+	closed     bool
+	bufferSize int
+	logger     *slog.Logger
+	wg         sync.WaitGroup
+}
+
+type subscriber struct {
+	events  chan KeyEvent
+	handler func(KeyEvent)
+}
+
+// EventBusOption configures an EventBus.
+type EventBusOption func(*EventBus)
+
+// WithEventBufferSize sets the per-subscriber queue length.
+func WithEventBufferSize(n int) EventBusOption {
+	return func(b *EventBus) {
+		if n > 0 {
+			b.bufferSize = n
+		}
+	}
+}
+
+// WithEventBusLogger sets the logger used to report dropped events.
+func WithEventBusLogger(logger *slog.Logger) EventBusOption {
+	return func(b *EventBus) {
+		if logger != nil {
+			b.logger = logger
+		}
+	}
+}
+
+// NewEventBus returns an EventBus with no subscribers.
+func NewEventBus(opts ...EventBusOption) *EventBus {
+	b := &EventBus{
+		bufferSize: DefaultEventBufferSize,
+		logger:     slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Subscribe registers handler to receive every event published from now on,
+// in publish order. Subscribing after Close has no effect.
+func (b *EventBus) Subscribe(handler func(KeyEvent)) {
+	s := &subscriber{
+		events:  make(chan KeyEvent, b.bufferSize),
+		handler: handler,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.subs = append(b.subs, s)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for e := range s.events {
+			s.handler(e)
+		}
+	}()
+}
+
+// Publish queues e for every subscriber without blocking. Events published
+// after Close are discarded.
+func (b *EventBus) Publish(e KeyEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, s := range b.subs {
+		select {
+		case s.events <- e:
+		default:
+			b.logger.Warn("event subscriber queue full, event dropped",
+				slog.String("event", string(e.Type)),
+			)
+		}
+	}
+}
+
+// Close stops accepting events and waits until subscribers have handled the
+// ones already queued.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, s := range b.subs {
+			close(s.events)
+		}
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
@@ -0,0 +1,125 @@
+package domain
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestEventBus_AllSubscribersReceive(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	bus := NewEventBus()
+	var mu sync.Mutex
+	got := make([][]KeyEvent, 3)
+	for i := range got {
+		i := i
+		bus.Subscribe(func(e KeyEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			got[i] = append(got[i], e)
+		})
+	}
+
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithEventBus(bus))
+	km.MarkAsDead("key1", "")
+	km.ReviveKey("key1")
+	bus.Close()
+
+	want := []struct {
+		typ    KeyEventType
+		reason string
+	}{
+		{KeyEventDead, ReasonMarkedDead},
+		{KeyEventRevived, ReasonRevived},
+	}
+	for i, events := range got {
+		if len(events) != len(want) {
+			t.Fatalf("subscriber %d got %d events, want %d", i, len(events), len(want))
+		}
+		for j, w := range want {
+			e := events[j]
+			if e.Type != w.typ || e.Key != "key1" || e.Reason != w.reason {
+				t.Errorf("subscriber %d event %d = %+v, want %s key1 %q", i, j, e, w.typ, w.reason)
+			}
+			if e.Timestamp.IsZero() {
+				t.Errorf("subscriber %d event %d has no timestamp", i, j)
+			}
+		}
+	}
+}
+
+func TestEventBus_SlowSubscriberDoesNotBlock(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// Drops are expected here; keep their warnings out of the test output.
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus := NewEventBus(WithEventBufferSize(2), WithEventBusLogger(logger))
+	release := make(chan struct{})
+	bus.Subscribe(func(KeyEvent) { <-release })
+
+	var fast atomic.Int64
+	bus.Subscribe(func(KeyEvent) { fast.Add(1) })
+
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithEventBus(bus))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			km.MarkAsDead("key1", "")
+			km.ReviveKey("key1")
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("KeyManager blocked on a slow subscriber")
+	}
+
+	close(release)
+	bus.Close()
+	if fast.Load() == 0 {
+		t.Error("fast subscriber received no events")
+	}
+}
+
+func TestEventBus_ReviveExpiredReason(t *testing.T) {
+	bus := NewEventBus()
+	events := make(chan KeyEvent, 4)
+	bus.Subscribe(func(e KeyEvent) { events <- e })
+
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithEventBus(bus))
+	km.MarkAsDeadUntil("key1", time.Now().Add(-time.Second))
+	km.ReviveExpired()
+	bus.Close()
+	close(events)
+
+	var reasons []string
+	for e := range events {
+		reasons = append(reasons, e.Reason)
+	}
+	want := []string{ReasonUnavailable, ReasonCooldownExpired}
+	if len(reasons) != len(want) || reasons[0] != want[0] || reasons[1] != want[1] {
+		t.Errorf("reasons = %q, want %q", reasons, want)
+	}
+}
+
+func TestEventBus_PublishAfterClose(t *testing.T) {
+	bus := NewEventBus()
+	calls := 0
+	bus.Subscribe(func(KeyEvent) { calls++ })
+	bus.Close()
+	bus.Close()
+
+	bus.Publish(KeyEvent{Type: KeyEventDead, Key: "key1"})
+	bus.Subscribe(func(KeyEvent) { calls++ })
+	if calls != 0 {
+		t.Errorf("calls = %d, want 0", calls)
+	}
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+// DefaultKeyAgeCheckInterval is how often StartKeyAgeChecks looks for keys
+// past their maximum age.
+const DefaultKeyAgeCheckInterval = time.Hour
+
+// WithMaxKeyAge sets the age past which CheckKeyAges warns about a key, for
+// mandatory rotation policies. Zero disables the check.
+func WithMaxKeyAge(d time.Duration) KeyManagerOption {
+	return func(km *KeyManager) {
+		if d > 0 {
+			km.maxKeyAge = d
+		}
+	}
+}
+
+// WithKeyAgeClock sets the time source key ages are measured with, for tests.
+func WithKeyAgeClock(now func() time.Time) KeyManagerOption {
+	return func(km *KeyManager) { km.now = now }
+}
+
+// KeyStats returns key's usage state and when it joined the pool. It is the
+// zero KeyStats for keys km does not manage.
+func (km *KeyManager) KeyStats(key string) KeyStats {
+	km.mu.RLock()
+	added, ok := km.addedAt[key]
+	km.mu.RUnlock()
+	if !ok {
+		return KeyStats{}
+	}
+	return KeyStats{Usage: km.Usage(key), AddedAt: added}
+}
+
+// KeyAge returns how long key has been in the pool, or zero for keys km does
+// not manage.
+func (km *KeyManager) KeyAge(key string) time.Duration {
+	km.mu.RLock()
+	added, ok := km.addedAt[key]
+	km.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return km.now().Sub(added)
+}
+
+// CheckKeyAges logs a warning for every key older than the maximum age and
+// returns those keys, sorted. Keys are only reported, never removed.
+func (km *KeyManager) CheckKeyAges() []string {
+	if km.maxKeyAge <= 0 {
+		return nil
+	}
+	now := km.now()
+
+	km.mu.RLock()
+	var expired []string
+	for k, added := range km.addedAt {
+		if now.Sub(added) > km.maxKeyAge {
+			expired = append(expired, k)
+		}
+	}
+	sort.Strings(expired)
+	for _, k := range expired {
+		km.logger.Warn("key exceeds maximum age, rotate it",
+			slog.String("key", security.MaskKey(k)),
+			slog.String("name", km.names[k]),
+			slog.Duration("age", now.Sub(km.addedAt[k]).Round(time.Second)),
+			slog.Duration("max_age", km.maxKeyAge),
+		)
+	}
+	km.mu.RUnlock()
+	return expired
+}
+
+// StartKeyAgeChecks calls CheckKeyAges every interval from a background
+// goroutine until StopKeyAgeChecks is called. It does nothing without a
+// maximum key age.
+func (km *KeyManager) StartKeyAgeChecks(interval time.Duration) {
+	if km.maxKeyAge <= 0 {
+		close(km.ageDone)
+		return
+	}
+	go func() {
+		defer close(km.ageDone)
+		km.CheckKeyAges()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				km.CheckKeyAges()
+			case <-km.ageStop:
+				return
+			}
+		}
+	}()
+}
+
+// StopKeyAgeChecks ends the checks started by StartKeyAgeChecks.
+func (km *KeyManager) StopKeyAgeChecks() {
+	km.ageStopOnce.Do(func() { close(km.ageStop) })
+	<-km.ageDone
+}
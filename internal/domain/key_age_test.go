@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyManager_KeyAge(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var logs bytes.Buffer
+	km := NewKeyManager([]string{"AIzaSyOriginalKey0001"}, 0,
+		WithKeyAgeClock(clock.Now),
+		WithMaxKeyAge(90*24*time.Hour),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+
+	clock.Set(clock.Now().Add(30 * 24 * time.Hour))
+	if err := km.AddKey("AIzaSyRotatedKey00002", "", ""); err != nil {
+		t.Fatalf("AddKey() error = %v", err)
+	}
+
+	clock.Set(clock.Now().Add(61 * 24 * time.Hour))
+	if got, want := km.KeyAge("AIzaSyOriginalKey0001"), 91*24*time.Hour; got != want {
+		t.Errorf("KeyAge(original) = %v, want %v", got, want)
+	}
+	if got, want := km.KeyAge("AIzaSyRotatedKey00002"), 61*24*time.Hour; got != want {
+		t.Errorf("KeyAge(rotated) = %v, want %v", got, want)
+	}
+	if got := km.KeyAge("unknown"); got != 0 {
+		t.Errorf("KeyAge(unknown) = %v, want 0", got)
+	}
+
+	expired := km.CheckKeyAges()
+	if len(expired) != 1 || expired[0] != "AIzaSyOriginalKey0001" {
+		t.Fatalf("CheckKeyAges() = %v, want only the original key", expired)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "key exceeds maximum age") {
+		t.Errorf("logs = %q, want a warning for the old key", out)
+	}
+	if strings.Contains(out, "AIzaSyOriginalKey0001") {
+		t.Errorf("logs = %q, want the key masked", out)
+	}
+	if km.TotalKeyCount() != 2 {
+		t.Errorf("TotalKeyCount() = %d, want 2 with old keys kept", km.TotalKeyCount())
+	}
+}
+
+func TestKeyManager_StartKeyAgeChecks(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var logs bytes.Buffer
+	km := NewKeyManager([]string{"AIzaSyOriginalKey0001"}, 0,
+		WithKeyAgeClock(clock.Now),
+		WithMaxKeyAge(24*time.Hour),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	clock.Set(clock.Now().Add(25 * time.Hour))
+
+	km.StartKeyAgeChecks(time.Hour)
+	km.StopKeyAgeChecks()
+	if !strings.Contains(logs.String(), "key exceeds maximum age") {
+		t.Errorf("logs = %q, want the first check to run at start", logs.String())
+	}
+}
+
+func TestKeyManager_CheckKeyAgesDisabled(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	km := NewKeyManager([]string{"key1"}, 0, WithKeyAgeClock(clock.Now))
+	clock.Set(clock.Now().Add(10 * 365 * 24 * time.Hour))
+
+	if got := km.CheckKeyAges(); len(got) != 0 {
+		t.Errorf("CheckKeyAges() = %v without a maximum age, want none", got)
+	}
+	km.StartKeyAgeChecks(time.Millisecond)
+	km.StopKeyAgeChecks()
+}
+
+func TestKeyStats_AgeSeconds(t *testing.T) {
+	s := KeyStats{AddedAt: time.Now().Add(-90 * time.Second)}
+	if got := s.AgeSeconds(); got < 90 || got > 91 {
+		t.Errorf("AgeSeconds() = %d, want 90", got)
+	}
+}
+
+func TestKeyManager_RestoreKeepsKeyAge(t *testing.T) {
+	added := time.Now().Add(-48 * time.Hour).UTC()
+	s := KeyPoolSnapshot{
+		ActiveKeys: []string{"key1"},
+		UsageStats: map[string]KeyStats{"key1": {AddedAt: added}},
+	}
+	km := NewKeyManagerFromSnapshot(s, time.Hour)
+	if got := km.KeyStats("key1").AddedAt; !got.Equal(added) {
+		t.Errorf("AddedAt = %v, want %v from the snapshot", got, added)
+	}
+}
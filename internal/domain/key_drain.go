@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// drainPollInterval is how often DrainAndRemove checks a key's in-flight count.
+const drainPollInterval = 10 * time.Millisecond
+
+// DrainAndRemove takes key out of rotation, waits until every request using
+// it has released its concurrency slot, then removes it like RemoveKey.
+// While draining, the key is never selected or acquired and is not marked
+// dead or revived.
+//
+// If ctx ends first, the key is returned to its previous state and ctx.Err()
+// is returned, e.g. context.DeadlineExceeded. In-flight requests are counted
+// whether or not a concurrency limit is set.
+func (km *KeyManager) DrainAndRemove(ctx context.Context, key string) error {
+	km.mu.Lock()
+	if _, ok := km.originalKeys[key]; !ok {
+		km.mu.Unlock()
+		return ErrKeyNotFound
+	}
+	km.inFlightMu.Lock()
+	if km.draining[key] {
+		km.inFlightMu.Unlock()
+		km.mu.Unlock()
+		return ErrKeyDraining
+	}
+	km.draining[key] = true
+	km.inFlightMu.Unlock()
+
+	wasActive := false
+	filtered := km.keys[:0]
+	for _, k := range km.keys {
+		if k == key {
+			wasActive = true
+			continue
+		}
+		filtered = append(filtered, k)
+	}
+	km.keys = filtered
+	km.removeFromPartition(key)
+	km.mu.Unlock()
+
+	if err := km.waitIdle(ctx, key); err != nil {
+		km.cancelDrain(key, wasActive)
+		return err
+	}
+	km.RemoveKey(key)
+	return nil
+}
+
+// waitIdle blocks until key has no requests in flight or ctx ends.
+func (km *KeyManager) waitIdle(ctx context.Context, key string) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for km.InFlight(key) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// cancelDrain ends the drain of key, putting it back in rotation if it was
+// active when the drain started.
+func (km *KeyManager) cancelDrain(key string, wasActive bool) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	km.inFlightMu.Lock()
+	delete(km.draining, key)
+	km.inFlightMu.Unlock()
+
+	if _, ok := km.originalKeys[key]; ok && wasActive {
+		km.keys = append(km.keys, key)
+		km.addToPartition(key)
+	}
+}
+
+// isDraining reports whether DrainAndRemove is removing key.
+func (km *KeyManager) isDraining(key string) bool {
+	km.inFlightMu.Lock()
+	defer km.inFlightMu.Unlock()
+	return km.draining[key]
+}
@@ -0,0 +1,153 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyManager_DrainAndRemove_WaitsForInFlight(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithMaxConcurrentPerKey(4))
+
+	// Two requests are using key1 when the drain starts.
+	var completed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		if !km.AcquireKey("key1") {
+			t.Fatal("AcquireKey(key1) = false")
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(50 * time.Millisecond)
+			completed.Add(1)
+			km.ReleaseKey("key1")
+		}()
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- km.DrainAndRemove(context.Background(), "key1") }()
+	for !km.isDraining("key1") {
+		time.Sleep(time.Millisecond)
+	}
+
+	// While draining, key1 is never handed out.
+	deadline := time.Now().Add(30 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		key, err := km.GetNextKey()
+		if err != nil {
+			t.Fatalf("GetNextKey() error = %v", err)
+		}
+		if key == "key1" {
+			t.Fatal("GetNextKey() returned a draining key")
+		}
+		km.ReleaseKey(key)
+	}
+	if km.AcquireKey("key1") {
+		t.Error("AcquireKey() succeeded on a draining key")
+	}
+
+	if err := <-drained; err != nil {
+		t.Fatalf("DrainAndRemove() error = %v", err)
+	}
+	if got := completed.Load(); got != 2 {
+		t.Errorf("completed requests = %d at removal, want 2", got)
+	}
+	if got := km.TotalKeyCount(); got != 1 {
+		t.Errorf("TotalKeyCount() = %d, want 1", got)
+	}
+	wg.Wait()
+}
+
+func TestKeyManager_DrainAndRemove_WithoutConcurrencyLimit(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0)
+
+	// A request selected key1 through the rotation before the drain.
+	if key, err := km.GetNextKey(); err != nil || key != "key1" {
+		t.Fatalf("GetNextKey() = %s, %v, want key1", key, err)
+	}
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(released)
+		km.ReleaseKey("key1")
+	}()
+
+	if err := km.DrainAndRemove(context.Background(), "key1"); err != nil {
+		t.Fatalf("DrainAndRemove() error = %v", err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Error("key removed while its request was still in flight")
+	}
+	if got := km.TotalKeyCount(); got != 1 {
+		t.Errorf("TotalKeyCount() = %d, want 1", got)
+	}
+}
+
+func TestKeyManager_DrainAndRemove_Timeout(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithMaxConcurrentPerKey(1))
+	km.AcquireKey("key1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := km.DrainAndRemove(ctx, "key1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DrainAndRemove() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if got := km.TotalKeyCount(); got != 2 {
+		t.Errorf("TotalKeyCount() = %d, want 2", got)
+	}
+	if got := km.ActiveKeyCount(); got != 2 {
+		t.Errorf("ActiveKeyCount() = %d, want 2 after a cancelled drain", got)
+	}
+	km.ReleaseKey("key1")
+	if !km.AcquireKey("key1") {
+		t.Error("AcquireKey(key1) = false after a cancelled drain")
+	}
+}
+
+func TestKeyManager_DrainAndRemove_DeadKey(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0)
+	km.MarkAsDead("key1", "")
+
+	if err := km.DrainAndRemove(context.Background(), "key1"); err != nil {
+		t.Fatalf("DrainAndRemove() error = %v", err)
+	}
+	if km.IsKeyDead("key1") || km.TotalKeyCount() != 1 || km.DeadKeyCount() != 0 {
+		t.Errorf("dead key not removed: total %d, dead %d", km.TotalKeyCount(), km.DeadKeyCount())
+	}
+}
+
+func TestKeyManager_DrainAndRemove_Errors(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithMaxConcurrentPerKey(1))
+
+	if err := km.DrainAndRemove(context.Background(), "unknown"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("DrainAndRemove(unknown) error = %v, want %v", err, ErrKeyNotFound)
+	}
+
+	km.AcquireKey("key1")
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() { first <- km.DrainAndRemove(ctx, "key1") }()
+	for !km.isDraining("key1") {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := km.DrainAndRemove(context.Background(), "key1"); !errors.Is(err, ErrKeyDraining) {
+		t.Errorf("second DrainAndRemove() error = %v, want %v", err, ErrKeyDraining)
+	}
+	km.MarkAsDead("key1", "")
+	if km.IsKeyDead("key1") {
+		t.Error("MarkAsDead() marked a draining key dead")
+	}
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("DrainAndRemove() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,46 @@
+package domain
+
+import "errors"
+
+// ProviderError is a failed provider call that knows what it means for the
+// key that made it. *adapter.AdapterError implements it.
+type ProviderError interface {
+	error
+
+	// ShouldRetry reports whether the request may succeed with another key.
+	ShouldRetry() bool
+
+	// ShouldMarkDead reports whether the key should leave rotation until
+	// its cooldown passes.
+	ShouldMarkDead() bool
+}
+
+// HandleError records that a request on key failed with err and reports
+// whether the caller should retry with another key. When err is a
+// ProviderError that asks for it, such as a rate limit or a provider
+// server error, the key is marked dead with err as its last error. Other
+// errors are neither retried nor held against the key.
+func (km *KeyManager) HandleError(key string, err error) bool {
+	km.RecordError(key)
+	km.usageMu.Lock()
+	if _, ok := km.ewmaUsage[key]; ok {
+		km.errorCount[key]++
+	}
+	km.usageMu.Unlock()
+
+	retry, markDead := errorVerdict(err)
+	if markDead {
+		km.MarkAsDead(key, err.Error())
+	}
+	return retry
+}
+
+// errorVerdict returns whether a request that failed with err should be
+// retried and whether its key should be marked dead.
+func errorVerdict(err error) (retry, markDead bool) {
+	var providerErr ProviderError
+	if !errors.As(err, &providerErr) {
+		return false, false
+	}
+	return providerErr.ShouldRetry(), providerErr.ShouldMarkDead()
+}
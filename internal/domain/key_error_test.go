@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testProviderError is a ProviderError with a fixed verdict.
+type testProviderError struct {
+	retry, markDead bool
+}
+
+func (e testProviderError) Error() string        { return "provider failed" }
+func (e testProviderError) ShouldRetry() bool    { return e.retry }
+func (e testProviderError) ShouldMarkDead() bool { return e.markDead }
+
+func TestKeyManager_HandleError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantRetry bool
+		wantDead  bool
+	}{
+		{"rate limit", testProviderError{retry: true, markDead: true}, true, true},
+		{"timeout", testProviderError{retry: true}, true, false},
+		{"rejected", testProviderError{}, false, false},
+		{"wrapped", fmt.Errorf("call: %w", testProviderError{retry: true, markDead: true}), true, true},
+		{"unknown", errors.New("connection reset"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := NewKeyManager([]string{"key-a", "key-b"}, time.Minute)
+			if got := km.HandleError("key-a", tt.err); got != tt.wantRetry {
+				t.Errorf("HandleError() = %v, want %v", got, tt.wantRetry)
+			}
+			if got := km.IsKeyDead("key-a"); got != tt.wantDead {
+				t.Errorf("IsKeyDead() = %v, want %v", got, tt.wantDead)
+			}
+			s, _ := km.GetKeyState("key-a")
+			if s.ErrorCount != 1 || s.LastUsedAt == nil {
+				t.Errorf("state = %+v, want 1 error and a last use", s)
+			}
+			if tt.wantDead && s.LastErrorMessage == "" {
+				t.Error("LastErrorMessage is empty, want the error")
+			}
+		})
+	}
+}
+
+func TestKeyManager_HandleError_UnknownKey(t *testing.T) {
+	km := NewKeyManager([]string{"key-a"}, time.Minute)
+	km.HandleError("missing", testProviderError{retry: true, markDead: true})
+	if km.IsKeyDead("missing") || km.TotalKeyCount() != 1 {
+		t.Error("HandleError on an unknown key changed the pool")
+	}
+}
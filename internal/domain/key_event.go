@@ -0,0 +1,66 @@
+package domain
+
+import "time"
+
+// KeyEventType names a change in a key's availability.
+type KeyEventType string
+
+const (
+	// KeyEventDead is emitted when a key is taken out of rotation.
+	KeyEventDead KeyEventType = "key_dead"
+
+	// KeyEventRevived is emitted when a dead key returns to rotation.
+	KeyEventRevived KeyEventType = "key_revived"
+
+	// KeyEventAllDead replaces KeyEventDead when the death of Key leaves no
+	// active keys. It is emitted once until a key is revived.
+	KeyEventAllDead KeyEventType = "all_keys_dead"
+
+	// KeyEventKeysAdded is emitted once for a batch of keys added by
+	// AddKeys; Count says how many.
+	KeyEventKeysAdded KeyEventType = "keys_added"
+
+	// KeyEventKeysRemoved is emitted once for a batch of keys removed by
+	// RemoveKeys; Count says how many.
+	KeyEventKeysRemoved KeyEventType = "keys_removed"
+)
+
+// Reasons attached to key events.
+const (
+	ReasonMarkedDead      = "marked dead"
+	ReasonUnavailable     = "unavailable until retry time"
+	ReasonRevived         = "revived"
+	ReasonCooldownExpired = "cooldown expired"
+	ReasonAddedByAdmin    = "added by admin"
+	ReasonRemovedByAdmin  = "removed by admin"
+)
+
+// KeyEvent describes a change in the key pool. Key is the unmasked key; it
+// is empty for batch events, which set Count instead.
+type KeyEvent struct {
+	Type      KeyEventType
+	Key       string
+	Count     int
+	Timestamp time.Time
+	Reason    string
+}
+
+// WithEventBus sets the bus that key pool events are published to. Events
+// are published outside of any KeyManager lock.
+func WithEventBus(bus *EventBus) KeyManagerOption {
+	return func(km *KeyManager) { km.events = bus }
+}
+
+// emit publishes an event to the bus, if one is set.
+func (km *KeyManager) emit(t KeyEventType, key, reason string) {
+	if km.events != nil {
+		km.events.Publish(KeyEvent{Type: t, Key: key, Timestamp: time.Now(), Reason: reason})
+	}
+}
+
+// emitCount publishes a batch event covering count keys, if a bus is set.
+func (km *KeyManager) emitCount(t KeyEventType, count int, reason string) {
+	if km.events != nil {
+		km.events.Publish(KeyEvent{Type: t, Count: count, Timestamp: time.Now(), Reason: reason})
+	}
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+// WithKeyExpiries sets when keys expire, keyed by the key itself, such as
+// trial keys valid until a set date. Keys missing from the map, including
+// keys added at runtime, never expire.
+func WithKeyExpiries(expiries map[string]time.Time) KeyManagerOption {
+	return func(km *KeyManager) {
+		for k, t := range expiries {
+			km.expiresAt[k] = t
+		}
+	}
+}
+
+// isExpired reports whether key is past its expiry at now. Caller must hold
+// km.mu.
+func (km *KeyManager) isExpired(key string, now time.Time) bool {
+	t, ok := km.expiresAt[key]
+	return ok && now.After(t)
+}
+
+// retireExpired takes the keys in rotation that are past their expiry out of
+// it for good, logging a warning the first time each is found. Unlike dead
+// keys they are never revived.
+func (km *KeyManager) retireExpired() {
+	now := km.now()
+
+	km.mu.RLock()
+	found := false
+	for _, k := range km.keys {
+		if km.isExpired(k, now) {
+			found = true
+			break
+		}
+	}
+	km.mu.RUnlock()
+	if !found {
+		return
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	filtered := km.keys[:0]
+	for _, k := range km.keys {
+		if !km.isExpired(k, now) {
+			filtered = append(filtered, k)
+			continue
+		}
+		km.removeFromPartition(k)
+		if _, warned := km.expired[k]; warned {
+			continue
+		}
+		km.expired[k] = struct{}{}
+		km.logger.Warn("key expired, removed from rotation",
+			slog.String("key", security.MaskKey(k)),
+			slog.String("name", km.names[k]),
+			slog.Time("expires_at", km.expiresAt[k]),
+		)
+	}
+	km.keys = filtered
+}
+
+// GetExpiredKeys returns the managed keys past their expiry, soonest expired
+// first, with their name, provider and expiry.
+func (km *KeyManager) GetExpiredKeys() []APIKey {
+	now := km.now()
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	var keys []APIKey
+	for k, t := range km.expiresAt {
+		if _, ok := km.originalKeys[k]; !ok || !now.After(t) {
+			continue
+		}
+		expiresAt := t
+		keys = append(keys, APIKey{
+			Key:       k,
+			Name:      km.names[k],
+			Provider:  km.providers[k],
+			Enabled:   true,
+			ExpiresAt: &expiresAt,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].ExpiresAt.Equal(*keys[j].ExpiresAt) {
+			return keys[i].ExpiresAt.Before(*keys[j].ExpiresAt)
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
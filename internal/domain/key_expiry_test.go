@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKey_IsAvailable_Expired(t *testing.T) {
+	past, future := time.Now().Add(-time.Millisecond), time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      bool
+	}{
+		{"no expiry", nil, true},
+		{"expires later", &future, true},
+		{"expired", &past, false},
+	}
+	for _, tt := range tests {
+		k := APIKey{Key: "AIzaSyTrialKey00000001", Provider: ProviderGoogle, Enabled: true, ExpiresAt: tt.expiresAt}
+		if got := k.IsAvailable(); got != tt.want {
+			t.Errorf("%s: IsAvailable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeyManager_KeyExpiry(t *testing.T) {
+	const trial, paid = "AIzaSyTrialKey00000001", "AIzaSyPaidKey000000002"
+	expiresAt := time.Now().Add(-time.Millisecond)
+	var logs bytes.Buffer
+	km := NewKeyManager([]string{trial, paid}, time.Minute,
+		WithKeyNames(map[string]string{trial: "trial"}),
+		WithKeyProviders(map[string]ProviderType{trial: ProviderGoogle, paid: ProviderGoogle}),
+		WithKeyExpiries(map[string]time.Time{trial: expiresAt}),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+
+	for i := 0; i < 4; i++ {
+		if key, err := km.GetNextKey(); err != nil || key != paid {
+			t.Fatalf("GetNextKey() = %q, %v, want the unexpired key", key, err)
+		}
+	}
+	if key, err := km.GetNextKeyByProvider(ProviderGoogle); err != nil || key != paid {
+		t.Errorf("GetNextKeyByProvider() = %q, %v, want the unexpired key", key, err)
+	}
+	if got := km.ActiveKeyCount(); got != 1 {
+		t.Errorf("ActiveKeyCount() = %d, want 1", got)
+	}
+
+	// A revival does not bring an expired key back, nor warn again.
+	km.MarkAsDead(trial, "rate limited")
+	km.ReviveKey(trial)
+	if key, _ := km.GetNextKey(); key != paid {
+		t.Errorf("GetNextKey() after a revival = %q, want the unexpired key", key)
+	}
+	if n := strings.Count(logs.String(), "key expired"); n != 1 {
+		t.Errorf("logs = %q, want one expiry warning, got %d", logs.String(), n)
+	}
+	if strings.Contains(logs.String(), trial) {
+		t.Errorf("logs = %q, want the key masked", logs.String())
+	}
+
+	expired := km.GetExpiredKeys()
+	if len(expired) != 1 || expired[0].Key != trial || expired[0].Name != "trial" ||
+		expired[0].ExpiresAt == nil || !expired[0].ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("GetExpiredKeys() = %+v, want the trial key", expired)
+	}
+	if s, _ := km.GetKeyState(trial); s.Status != KeyStatusExpired || s.ExpiresAt == nil {
+		t.Errorf("state = %+v, want status expired with its expiry", s)
+	}
+	if s, _ := km.GetKeyState(paid); s.Status != KeyStatusActive || s.ExpiresAt != nil {
+		t.Errorf("state of the paid key = %+v, want active without expiry", s)
+	}
+}
+
+func TestKeyManager_KeyExpiry_AllExpired(t *testing.T) {
+	km := NewKeyManager([]string{"AIzaSyTrialKey00000001"}, time.Minute,
+		WithKeyExpiries(map[string]time.Time{"AIzaSyTrialKey00000001": time.Now().Add(-time.Millisecond)}),
+	)
+	if key, err := km.GetNextKey(); err != ErrNoKeysAvailable {
+		t.Errorf("GetNextKey() = %q, %v, want ErrNoKeysAvailable", key, err)
+	}
+}
@@ -0,0 +1,14 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// KeyFingerprint identifies key without revealing it: the first 16 hex
+// digits of its SHA-256 hash. Duplicate keys are detected and logged by
+// fingerprint so the key itself never reaches the logs.
+func KeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyFingerprint(t *testing.T) {
+	fp := KeyFingerprint("AIzaSyFingerprintKey")
+	if len(fp) != 16 || fp != KeyFingerprint("AIzaSyFingerprintKey") {
+		t.Errorf("KeyFingerprint() = %q, want 16 stable hex characters", fp)
+	}
+	if fp == KeyFingerprint("AIzaSyOtherKey") {
+		t.Error("different keys have the same fingerprint")
+	}
+}
+
+func TestKeyPool_AddKey_Duplicate(t *testing.T) {
+	const key = "AIzaSyPoolDuplicateKey"
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	p := NewKeyPool(StrategyRoundRobin)
+	if !p.AddKey(&APIKey{Key: key, Name: "first"}) {
+		t.Fatal("AddKey(first) = false, want true")
+	}
+	if p.AddKey(&APIKey{Key: key, Name: "second"}) {
+		t.Error("AddKey(duplicate) = true, want false")
+	}
+	if len(p.Keys) != 1 || !p.HasKey(key) || p.HasKey("AIzaSyMissing") {
+		t.Errorf("Keys = %d, HasKey = %v, want one key found by HasKey", len(p.Keys), p.HasKey(key))
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, "fingerprint="+KeyFingerprint(key)) || strings.Contains(out, key) {
+		t.Errorf("log = %q, want the fingerprint and not the key", out)
+	}
+}
+
+func TestKeyManager_DuplicateKeys(t *testing.T) {
+	const key = "AIzaSyManagerDuplicateKey"
+	var logs bytes.Buffer
+	km := NewKeyManager([]string{key, key}, time.Minute,
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	if got := km.ActiveKeyCount(); got != 1 {
+		t.Errorf("active keys = %d, want 1", got)
+	}
+	if !km.HasKey(key) || km.HasKey("AIzaSyMissing") {
+		t.Error("HasKey() does not match the managed keys")
+	}
+	if err := km.AddKey(key, "", ""); err != ErrKeyExists {
+		t.Errorf("AddKey(duplicate) error = %v, want ErrKeyExists", err)
+	}
+	if _, dups, _ := km.AddKeys([]APIKey{{Key: "AIzaSyNew"}, {Key: "AIzaSyNew"}}); dups != 1 {
+		t.Errorf("AddKeys() duplicates = %d, want 1", dups)
+	}
+
+	out := logs.String()
+	if strings.Count(out, "duplicate key") != 3 || strings.Contains(out, key) {
+		t.Errorf("log = %q, want three duplicates logged by fingerprint only", out)
+	}
+
+	km.RemoveKey(key)
+	if km.HasKey(key) {
+		t.Error("HasKey() = true after RemoveKey")
+	}
+}
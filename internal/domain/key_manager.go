@@ -1,115 +1,848 @@
 package domain
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/hpn/hpn-g-router/internal/security"
 )
 
 var ErrNoKeysAvailable = errors.New("no keys available")
 
+// ErrKeysBusy is returned when keys are active but all of them are at the
+// per-key concurrency limit.
+var ErrKeysBusy = errors.New("all keys are at their concurrency limit")
+
+// ErrEmptyKey is returned by AddKey for an empty key.
+var ErrEmptyKey = errors.New("key is empty")
+
+// ErrKeyExists is returned by AddKey when the key is already managed.
+var ErrKeyExists = errors.New("key already exists")
+
+// ErrKeyNameTaken is returned by AddKey when another key has the same name.
+var ErrKeyNameTaken = errors.New("key name already in use")
+
+// ErrKeyNotFound is returned by DrainAndRemove, PauseKey and ResumeKey for a
+// key that is not managed.
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrKeyDraining is returned by DrainAndRemove when the key is already
+// being drained.
+var ErrKeyDraining = errors.New("key is already draining")
+
+// The default random sources of StrategyRandom, staggered revival jitter
+// and the provider balancer. Tests replace them with seeded ones.
+var (
+	randIntN   = rand.IntN
+	randInt64N = rand.Int64N
+)
+
+// DefaultDecayAlpha is the EWMA smoothing factor for key usage.
+const DefaultDecayAlpha = 0.1
+
 // KeyManager manages a pool of API keys with round-robin rotation and
 // circuit-breaker style dead key tracking.
+//
+// The set of managed keys, their names and providers can change at runtime
+// through AddKey and RemoveKey and are guarded by mu.
 type KeyManager struct {
 	keys         []string
 	deadKeys     map[string]time.Time
+	deadUntil    map[string]time.Time
 	originalKeys map[string]struct{}
+	names        map[string]string
 	index        int64
-	cooldown     time.Duration
 	mu           sync.RWMutex
 	deadMu       sync.RWMutex
+
+	// cooldown is how long, as a time.Duration, a dead key waits before it
+	// is revived; SetCooldown changes it at runtime. cooldowns overrides it
+	// for the keys of a provider and does not change after construction.
+	cooldown  atomic.Int64
+	cooldowns map[ProviderType]time.Duration
+
+	// fingerprints holds the KeyFingerprint of every managed key and is
+	// guarded by mu. Duplicates are detected by fingerprint so they can be
+	// logged without the key.
+	fingerprints map[string]struct{}
+
+	// strategy holds the RotationStrategy; SetStrategy changes it at runtime.
+	strategy   atomic.Value
+	decayAlpha float64
+	ewmaUsage  map[string]float64
+	usageMu    sync.RWMutex
+
+	// lastUsed records each key's last request and errorCount its failed
+	// requests; both are guarded by usageMu. deathCount and lastError count the times each key was marked dead
+	// and keep the redacted reason of the last one; both are guarded by
+	// deadMu and survive revival.
+	lastUsed   map[string]time.Time
+	errorCount map[string]int
+	deathCount map[string]int
+	lastError  map[string]string
+
+	// providers maps keys to their provider; partitions holds the active keys
+	// of each provider and is guarded by mu together with keys.
+	providers  map[string]ProviderType
+	partitions map[ProviderType]*keyPartition
+
+	// tags maps keys to the tags routing rules select them by. tagIndex
+	// holds a rotation counter per tag set, keyed by tagSetKey.
+	tags     map[string][]string
+	tagIndex sync.Map
+
+	// priorities maps keys to their StrategyPriority priority, guarded by
+	// mu. priorityIndex rotates the keys within each priority level.
+	priorities    map[string]int
+	priorityIndex int64
+
+	// weights maps keys to their StrategyWeighted weight, guarded by mu.
+	weights map[string]int
+
+	// baseURLs and regions map keys to their regional endpoint, guarded by
+	// mu. regionProbe ranks the endpoints for
+	// GetNextKeyByLowestRegionLatency, keys without a base URL using
+	// defaultBaseURL; regionIndex rotates the keys of the fastest region.
+	baseURLs       map[string]string
+	regions        map[string]string
+	regionProbe    *RegionLatencyProbe
+	defaultBaseURL string
+	regionIndex    int64
+
+	events *EventBus
+
+	maxConcurrent int
+	inFlight      map[string]int
+	inFlightMu    sync.Mutex
+
+	// draining marks keys DrainAndRemove is taking out of the pool. It is
+	// guarded by inFlightMu so AcquireKey can refuse them.
+	draining map[string]bool
+
+	minActiveKeys  int
+	lowKeyWarnings atomic.Int64
+	logger         *slog.Logger
+
+	quota     *QuotaTracker
+	tokenRate *TokenRateLimiter
+
+	// revival is how expired dead keys return to rotation. Under
+	// RevivalStaggered, revivalJitter holds the extra cooldown drawn for
+	// each dead key; it is guarded by deadMu.
+	revival       RevivalStrategy
+	jitter        func(max time.Duration) time.Duration
+	revivalJitter map[string]time.Duration
+
+	// intN and int64N are the random sources of StrategyRandom, the default
+	// revival jitter and the provider balancer; WithSecureRandom replaces
+	// them with crypto/rand.
+	intN   func(n int) int
+	int64N func(n int64) int64
+
+	// statePath is where ForceStateSave writes the key pool state.
+	statePath string
+
+	// addedAt records when each key joined the pool and is guarded by mu.
+	// Keys older than maxKeyAge are reported by CheckKeyAges.
+	addedAt     map[string]time.Time
+	maxKeyAge   time.Duration
+	now         func() time.Time
+	ageStop     chan struct{}
+	ageDone     chan struct{}
+	ageStopOnce sync.Once
+
+	// expiresAt maps keys to the time they stop being valid, and expired
+	// holds the keys retireExpired took out of rotation; both are guarded
+	// by mu.
+	expiresAt map[string]time.Time
+	expired   map[string]struct{}
+
+	// pausedKeys holds the keys PauseKey took out of rotation until
+	// ResumeKey. They are neither active nor dead. Guarded by mu.
+	pausedKeys map[string]struct{}
+}
+
+// keyPartition is the rotation of a single provider's active keys.
+type keyPartition struct {
+	keys  []string
+	index int64
+}
+
+// KeyManagerOption configures a KeyManager.
+type KeyManagerOption func(*KeyManager)
+
+// WithStrategy sets the selection strategy. StrategyLeastUsed picks the key with
+// the lowest usage EWMA, StrategyPriority the key with the lowest priority
+// set by WithKeyPriorities and StrategyWeighted a random key in proportion
+// to its weight set by WithKeyWeights; any other value uses round-robin.
+func WithStrategy(s RotationStrategy) KeyManagerOption {
+	return func(km *KeyManager) { km.strategy.Store(s) }
+}
+
+// WithDecayAlpha sets the EWMA smoothing factor in (0, 1]. Higher values weigh
+// recent requests more and forget old usage faster.
+func WithDecayAlpha(a float64) KeyManagerOption {
+	return func(km *KeyManager) {
+		if a > 0 && a <= 1 {
+			km.decayAlpha = a
+		}
+	}
+}
+
+// WithKeyProviders assigns keys to providers so they can be selected per
+// provider with GetNextKeyByProvider. Keys missing from the map only take part
+// in the mixed rotation of GetNextKey.
+func WithKeyProviders(providers map[string]ProviderType) KeyManagerOption {
+	return func(km *KeyManager) {
+		for k, p := range providers {
+			km.providers[k] = p
+		}
+	}
+}
+
+// WithProviderCooldowns sets how long dead keys of a provider wait before
+// they are revived, overriding the cooldown for them. Keys are matched to
+// providers through WithKeyProviders or AddKey.
+func WithProviderCooldowns(cooldowns map[ProviderType]time.Duration) KeyManagerOption {
+	return func(km *KeyManager) {
+		for p, d := range cooldowns {
+			km.cooldowns[p] = d
+		}
+	}
+}
+
+// WithKeyTags tags keys so routing rules can select them with
+// GetNextKeyByTags.
+func WithKeyTags(tags map[string][]string) KeyManagerOption {
+	return func(km *KeyManager) {
+		for k, t := range tags {
+			if len(t) > 0 {
+				km.tags[k] = slices.Clone(t)
+			}
+		}
+	}
+}
+
+// WithStatePath sets the file ForceStateSave writes the key pool state to.
+func WithStatePath(path string) KeyManagerOption {
+	return func(km *KeyManager) { km.statePath = path }
+}
+
+// WithMaxConcurrentPerKey limits how many requests may use a key at once.
+// Keys returned by GetNextKey and GetNextKeyByProvider hold a slot until
+// ReleaseKey, also without a limit, so DrainAndRemove can wait for them.
+// Zero, the default, means no limit.
+func WithMaxConcurrentPerKey(n int) KeyManagerOption {
+	return func(km *KeyManager) {
+		if n > 0 {
+			km.maxConcurrent = n
+		}
+	}
+}
+
+// WithKeyNames sets human-readable names for keys, keyed by the key itself,
+// so operators can refer to keys without exposing them.
+func WithKeyNames(names map[string]string) KeyManagerOption {
+	return func(km *KeyManager) {
+		for k, n := range names {
+			if n != "" {
+				km.names[k] = n
+			}
+		}
+	}
+}
+
+// WithMinActiveKeys sets the low key threshold: when a key dies and at most n
+// keys remain active, a warning is logged and counted. Zero, the default,
+// disables the warning.
+func WithMinActiveKeys(n int) KeyManagerOption {
+	return func(km *KeyManager) {
+		if n > 0 {
+			km.minActiveKeys = n
+		}
+	}
+}
+
+// WithQuotaTracker skips keys that q reports over their token quota.
+func WithQuotaTracker(q *QuotaTracker) KeyManagerOption {
+	return func(km *KeyManager) { km.quota = q }
+}
+
+// WithTokenRateLimiter skips keys that l reports over their tokens-per-minute
+// limit.
+func WithTokenRateLimiter(l *TokenRateLimiter) KeyManagerOption {
+	return func(km *KeyManager) { km.tokenRate = l }
+}
+
+// WithLogger sets the logger used for low key warnings and strategy changes.
+func WithLogger(l *slog.Logger) KeyManagerOption {
+	return func(km *KeyManager) { km.logger = l }
 }
 
 // NewKeyManager returns a KeyManager with the given keys. Dead keys auto-revive
 // after cooldown; pass 0 to disable auto-revival.
-func NewKeyManager(keys []string, cooldown time.Duration) *KeyManager {
+func NewKeyManager(keys []string, cooldown time.Duration, opts ...KeyManagerOption) *KeyManager {
 	km := &KeyManager{
 		keys:         make([]string, 0, len(keys)),
 		deadKeys:     make(map[string]time.Time),
+		deadUntil:    make(map[string]time.Time),
 		originalKeys: make(map[string]struct{}),
-		cooldown:     cooldown,
+		fingerprints: make(map[string]struct{}),
+		names:        make(map[string]string),
+		decayAlpha:   DefaultDecayAlpha,
+		ewmaUsage:    make(map[string]float64),
+		lastUsed:     make(map[string]time.Time),
+		errorCount:   make(map[string]int),
+		deathCount:   make(map[string]int),
+		lastError:    make(map[string]string),
+		providers:    make(map[string]ProviderType),
+		cooldowns:    make(map[ProviderType]time.Duration),
+		partitions:   make(map[ProviderType]*keyPartition),
+		tags:         make(map[string][]string),
+		priorities:   make(map[string]int),
+		weights:      make(map[string]int),
+		baseURLs:     make(map[string]string),
+		regions:      make(map[string]string),
+		inFlight:     make(map[string]int),
+		draining:     make(map[string]bool),
+		logger:       slog.Default(),
+
+		revival:       RevivalImmediate,
+		revivalJitter: make(map[string]time.Duration),
+		intN:          randIntN,
+		int64N:        randInt64N,
+
+		addedAt: make(map[string]time.Time),
+		now:     time.Now,
+		ageStop: make(chan struct{}),
+		ageDone: make(chan struct{}),
+
+		expiresAt: make(map[string]time.Time),
+		expired:   make(map[string]struct{}),
+
+		pausedKeys: make(map[string]struct{}),
+	}
+	km.cooldown.Store(int64(cooldown))
+	km.strategy.Store(StrategyRoundRobin)
+	for _, opt := range opts {
+		opt(km)
+	}
+	if km.jitter == nil {
+		km.jitter = km.randomJitter
 	}
 
-	seen := make(map[string]struct{})
 	for _, k := range keys {
-		if k == "" {
-			continue
-		}
-		if _, dup := seen[k]; dup {
+		if k == "" || km.isDuplicateLocked(k) {
 			continue
 		}
-		seen[k] = struct{}{}
+		km.fingerprints[KeyFingerprint(k)] = struct{}{}
 		km.keys = append(km.keys, k)
 		km.originalKeys[k] = struct{}{}
+		km.addedAt[k] = km.now()
+		km.addToPartition(k)
 	}
 
 	return km
 }
 
-// GetNextKey returns the next key via atomic round-robin. Revives expired dead
-// keys before selection.
+// GetNextKey returns the next key via atomic round-robin, or the least used key
+// under StrategyLeastUsed. Revives expired dead keys and retires keys past
+// their expiry before selection. With a
+// concurrency limit, busy keys are skipped and ErrKeysBusy is returned when
+// every active key is busy. With a quota tracker or token rate limiter, keys
+// over their quota or tokens-per-minute limit are skipped, and
+// ErrQuotaExceeded or ErrTokenRateExceeded is returned when none is left.
 func (km *KeyManager) GetNextKey() (string, error) {
-	km.reviveExpired()
+	km.ReviveExpired()
 
 	km.mu.RLock()
+	defer km.mu.RUnlock()
+
 	n := len(km.keys)
 	if n == 0 {
-		km.mu.RUnlock()
 		return "", ErrNoKeysAvailable
 	}
 
 	// atomic increment; returns new value, so use (new-1) % n
 	idx := int((atomic.AddInt64(&km.index, 1) - 1) % int64(n))
-	key := km.keys[idx]
-	km.mu.RUnlock()
+	return km.pick(km.keys, idx, km.GetStrategy())
+}
 
-	return key, nil
+// GetNextKeyContext is GetNextKey for a request that may be gone: it
+// returns ctx's error without selecting a key once ctx is done, so a
+// cancelled or timed out request uses no more keys.
+func (km *KeyManager) GetNextKeyContext(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return km.GetNextKey()
 }
 
-// MarkAsDead removes a key from rotation for the cooldown period.
-func (km *KeyManager) MarkAsDead(key string) {
-	if key == "" {
+// GetNextKeyExcluding is GetNextKeyContext skipping the keys in exclude, such
+// as those a request has already tried. Excluded keys stay in the pool for
+// other requests. It returns ErrNoKeysAvailable when every active key is
+// excluded.
+func (km *KeyManager) GetNextKeyExcluding(ctx context.Context, exclude map[string]struct{}) (string, error) {
+	if len(exclude) == 0 {
+		return km.GetNextKeyContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	km.ReviveExpired()
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	keys := without(km.keys, exclude)
+	n := len(keys)
+	if n == 0 {
+		return "", ErrNoKeysAvailable
+	}
+
+	idx := int((atomic.AddInt64(&km.index, 1) - 1) % int64(n))
+	return km.pick(keys, idx, km.GetStrategy())
+}
+
+// without returns keys minus those in exclude, or keys itself when exclude
+// is empty.
+func without(keys []string, exclude map[string]struct{}) []string {
+	if len(exclude) == 0 {
+		return keys
+	}
+	kept := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if _, skip := exclude[k]; !skip {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+// GetNextKeyByProvider is GetNextKey restricted to the keys of provider. Each
+// provider rotates with its own counter, so traffic to one provider does not
+// skew the rotation of another.
+func (km *KeyManager) GetNextKeyByProvider(provider ProviderType) (string, error) {
+	return km.GetNextKeyByProviderExcluding(context.Background(), provider, nil)
+}
+
+// GetNextKeyByProviderExcluding is GetNextKeyByProvider skipping the keys in
+// exclude, as GetNextKeyExcluding does, and returning ctx's error once ctx
+// is done.
+func (km *KeyManager) GetNextKeyByProviderExcluding(ctx context.Context, provider ProviderType, exclude map[string]struct{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	km.ReviveExpired()
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	part := km.partitions[provider]
+	if part == nil {
+		return "", ErrNoKeysAvailable
+	}
+	keys := without(part.keys, exclude)
+	n := len(keys)
+	if n == 0 {
+		return "", ErrNoKeysAvailable
+	}
+
+	idx := int((atomic.AddInt64(&part.index, 1) - 1) % int64(n))
+	return km.pick(keys, idx, km.GetStrategy())
+}
+
+// GetNextKeyByTags is GetNextKey restricted to the keys carrying every one of
+// tags, rotated with strategy, or the pool's strategy when it is empty.
+// StrategyRandom starts the scan at a random key. Each tag set rotates with
+// its own counter.
+func (km *KeyManager) GetNextKeyByTags(tags []string, strategy RotationStrategy) (string, error) {
+	return km.GetNextKeyByTagsExcluding(context.Background(), tags, strategy, nil)
+}
+
+// GetNextKeyByTagsExcluding is GetNextKeyByTags skipping the keys in
+// exclude, as GetNextKeyExcluding does, and returning ctx's error once ctx
+// is done.
+func (km *KeyManager) GetNextKeyByTagsExcluding(ctx context.Context, tags []string, strategy RotationStrategy, exclude map[string]struct{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	km.ReviveExpired()
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	var keys []string
+	for _, k := range without(km.keys, exclude) {
+		if km.hasTags(k, tags) {
+			keys = append(keys, k)
+		}
+	}
+	n := len(keys)
+	if n == 0 {
+		return "", ErrNoKeysAvailable
+	}
+	if strategy == "" {
+		strategy = km.GetStrategy()
+	}
+
+	var idx int
+	if strategy == StrategyRandom {
+		idx = km.intN(n)
+	} else {
+		v, _ := km.tagIndex.LoadOrStore(tagSetKey(tags), new(int64))
+		idx = int((atomic.AddInt64(v.(*int64), 1) - 1) % int64(n))
+	}
+	return km.pick(keys, idx, strategy)
+}
+
+// hasTags reports whether key carries all of tags. Caller must hold km.mu.
+func (km *KeyManager) hasTags(key string, tags []string) bool {
+	for _, t := range tags {
+		if !slices.Contains(km.tags[key], t) {
+			return false
+		}
+	}
+	return true
+}
+
+// tagSetKey returns the same key for tag sets in any order.
+func tagSetKey(tags []string) string {
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// pick selects a key from keys under strategy, starting at the round-robin
+// position start, skipping keys over quota or their token rate, and claims a
+// concurrency slot on it when a limit is set. StrategyPriority ignores start
+// and tries keys in priority order. Caller must hold km.mu.
+func (km *KeyManager) pick(keys []string, start int, strategy RotationStrategy) (string, error) {
+	switch strategy {
+	case StrategyPriority:
+		keys, start = km.byPriority(keys), 0
+	case StrategyWeighted:
+		start = km.weightedStart(keys)
+	}
+	if km.maxConcurrent == 0 && km.quota == nil && km.tokenRate == nil {
+		key := keys[start]
+		if strategy == StrategyLeastUsed {
+			key = km.leastUsed(keys, start)
+		}
+		// Without a limit this only counts the request; draining keys are
+		// out of rotation and never in keys.
+		km.AcquireKey(key)
+		return key, nil
+	}
+
+	n := len(keys)
+	order := make([]string, n)
+	for i := range order {
+		order[i] = keys[(start+i)%n]
+	}
+	if strategy == StrategyLeastUsed {
+		km.usageMu.RLock()
+		sort.SliceStable(order, func(i, j int) bool { return km.ewmaUsage[order[i]] < km.ewmaUsage[order[j]] })
+		km.usageMu.RUnlock()
+	}
+
+	overQuota, overRate := 0, 0
+	for _, k := range order {
+		if km.IsOverQuota(k) {
+			overQuota++
+			continue
+		}
+		if km.IsOverTokenRate(k) {
+			overRate++
+			continue
+		}
+		if km.AcquireKey(k) {
+			return k, nil
+		}
+	}
+	switch {
+	case overRate > 0 && overQuota+overRate == n:
+		return "", ErrTokenRateExceeded
+	case overQuota == n:
+		return "", ErrQuotaExceeded
+	}
+	return "", ErrKeysBusy
+}
+
+// IsOverTokenRate reports whether key has used its tokens-per-minute budget.
+// It is always false without a token rate limiter.
+func (km *KeyManager) IsOverTokenRate(key string) bool {
+	return km.tokenRate != nil && km.tokenRate.IsOverLimit(key)
+}
+
+// IsOverQuota reports whether key has used up its token quota. It is always
+// false without a quota tracker.
+func (km *KeyManager) IsOverQuota(key string) bool {
+	return km.quota != nil && km.quota.IsOverQuota(key)
+}
+
+// AcquireKey claims a concurrency slot on key for callers that choose keys
+// themselves. It reports false when the key is draining or at the limit.
+// Requests are counted in InFlight with or without a limit.
+func (km *KeyManager) AcquireKey(key string) bool {
+	km.inFlightMu.Lock()
+	defer km.inFlightMu.Unlock()
+	if km.draining[key] || (km.maxConcurrent > 0 && km.inFlight[key] >= km.maxConcurrent) {
+		return false
+	}
+	km.inFlight[key]++
+	return true
+}
+
+// ReleaseKey frees the concurrency slot claimed when key was selected.
+func (km *KeyManager) ReleaseKey(key string) {
+	km.inFlightMu.Lock()
+	defer km.inFlightMu.Unlock()
+	if km.inFlight[key] > 1 {
+		km.inFlight[key]--
+	} else {
+		delete(km.inFlight, key)
+	}
+}
+
+// InFlight returns how many selected requests have not released key yet.
+func (km *KeyManager) InFlight(key string) int {
+	km.inFlightMu.Lock()
+	defer km.inFlightMu.Unlock()
+	return km.inFlight[key]
+}
+
+// ProviderKeyCount returns the active keys of provider.
+func (km *KeyManager) ProviderKeyCount(provider ProviderType) int {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	if part := km.partitions[provider]; part != nil {
+		return len(part.keys)
+	}
+	return 0
+}
+
+// ActiveProviders returns the providers that have active keys, sorted by name.
+func (km *KeyManager) ActiveProviders() []ProviderType {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	providers := make([]ProviderType, 0, len(km.partitions))
+	for p, part := range km.partitions {
+		if len(part.keys) > 0 {
+			providers = append(providers, p)
+		}
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+	return providers
+}
+
+// addToPartition appends key to its provider's partition, if it has one.
+// Caller must hold km.mu for writing.
+func (km *KeyManager) addToPartition(key string) {
+	p, ok := km.providers[key]
+	if !ok {
 		return
 	}
+	part := km.partitions[p]
+	if part == nil {
+		part = &keyPartition{}
+		km.partitions[p] = part
+	}
+	part.keys = append(part.keys, key)
+}
+
+// removeFromPartition drops key from its provider's partition. Caller must
+// hold km.mu for writing.
+func (km *KeyManager) removeFromPartition(key string) {
+	part := km.partitions[km.providers[key]]
+	if part == nil {
+		return
+	}
+	filtered := part.keys[:0]
+	for _, k := range part.keys {
+		if k != key {
+			filtered = append(filtered, k)
+		}
+	}
+	part.keys = filtered
+}
+
+// leastUsed returns the key in keys with the lowest usage EWMA. Scanning starts
+// at the round-robin position so ties rotate instead of always picking the
+// first key. Caller must hold km.mu.
+func (km *KeyManager) leastUsed(keys []string, start int) string {
+	km.usageMu.RLock()
+	defer km.usageMu.RUnlock()
+
+	n := len(keys)
+	best := keys[start]
+	for i := 1; i < n; i++ {
+		k := keys[(start+i)%n]
+		if km.ewmaUsage[k] < km.ewmaUsage[best] {
+			best = k
+		}
+	}
+	return best
+}
+
+// RecordSuccess records a completed request on key for usage tracking.
+func (km *KeyManager) RecordSuccess(key string) {
+	km.recordUsage(key)
+}
+
+// RecordError records a failed request on key. A failed call still consumed
+// the key's quota, so it counts as usage like a success.
+func (km *KeyManager) RecordError(key string) {
+	km.recordUsage(key)
+}
+
+// recordUsage advances every key's EWMA by one request:
+// ewma = alpha*used + (1-alpha)*ewma, where used is 1 for key and 0 for the rest.
+// Usage therefore decays as the pool serves traffic with other keys.
+func (km *KeyManager) recordUsage(key string) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
 	if _, ok := km.originalKeys[key]; !ok {
 		return
 	}
 
+	km.usageMu.Lock()
+	defer km.usageMu.Unlock()
+
+	for k := range km.originalKeys {
+		km.ewmaUsage[k] *= 1 - km.decayAlpha
+	}
+	km.ewmaUsage[key] += km.decayAlpha
+	km.lastUsed[key] = km.now()
+}
+
+// Usage returns the current usage EWMA of key, between 0 and 1.
+func (km *KeyManager) Usage(key string) float64 {
+	km.usageMu.RLock()
+	defer km.usageMu.RUnlock()
+	return km.ewmaUsage[key]
+}
+
+// MarkAsDead removes a key from rotation for the cooldown period. A
+// non-empty reason, usually the error that killed the key, is kept redacted
+// as the key's last error.
+func (km *KeyManager) MarkAsDead(key, reason string) {
+	km.markDead(key, time.Time{}, reason)
+}
+
+// MarkAsDeadUntil removes a key from rotation until the given time, ignoring
+// the cooldown. A far-future time keeps the key dead until ReviveKey.
+func (km *KeyManager) MarkAsDeadUntil(key string, until time.Time) {
+	km.markDead(key, until, "")
+}
+
+// markDead takes key out of rotation, keeping cause as its last error. A
+// zero until uses the cooldown.
+func (km *KeyManager) markDead(key string, until time.Time, cause string) {
+	if key == "" {
+		return
+	}
+
+	// Hold mu across both maps so a concurrent ReviveKey cannot leave the key
+	// neither active nor dead.
+	km.mu.Lock()
+	if _, ok := km.originalKeys[key]; !ok || km.isDraining(key) || km.isPausedLocked(key) {
+		km.mu.Unlock()
+		return
+	}
 	km.deadMu.Lock()
 	km.deadKeys[key] = time.Now()
+	km.deathCount[key]++
+	if cause != "" {
+		km.lastError[key] = security.Redact(cause)
+	}
+	if until.IsZero() {
+		delete(km.deadUntil, key)
+	} else {
+		km.deadUntil[key] = until
+	}
+	if km.revival == RevivalStaggered && until.IsZero() {
+		km.revivalJitter[key] = km.jitter(MaxRevivalJitter)
+	} else {
+		delete(km.revivalJitter, key)
+	}
+	dead := len(km.deadKeys)
 	km.deadMu.Unlock()
 
-	km.mu.Lock()
+	removed := false
 	filtered := km.keys[:0]
 	for _, k := range km.keys {
 		if k != key {
 			filtered = append(filtered, k)
+		} else {
+			removed = true
 		}
 	}
 	km.keys = filtered
+	km.removeFromPartition(key)
+	remaining := len(km.keys)
 	km.mu.Unlock()
+
+	reason := ReasonMarkedDead
+	if !until.IsZero() {
+		reason = ReasonUnavailable
+	}
+	switch {
+	case !removed:
+	case remaining == 0:
+		km.emit(KeyEventAllDead, key, reason)
+	default:
+		km.emit(KeyEventDead, key, reason)
+	}
+	if removed && km.minActiveKeys > 0 && remaining <= km.minActiveKeys {
+		km.lowKeyWarnings.Add(1)
+		km.logger.Warn("active keys at or below threshold",
+			slog.Int("active_keys", remaining),
+			slog.Int("dead_keys", dead),
+			slog.Int("threshold", km.minActiveKeys),
+		)
+	}
 }
 
 // ReviveKey manually restores a dead key to rotation.
 func (km *KeyManager) ReviveKey(key string) {
+	km.revive(key, ReasonRevived)
+}
+
+// revive returns a dead key to rotation, giving reason in the event.
+func (km *KeyManager) revive(key, reason string) {
 	if key == "" {
 		return
 	}
-	if _, ok := km.originalKeys[key]; !ok {
+
+	km.mu.Lock()
+	if _, ok := km.originalKeys[key]; !ok || km.isDraining(key) || km.isPausedLocked(key) {
+		km.mu.Unlock()
 		return
 	}
-
 	km.deadMu.Lock()
 	_, wasDead := km.deadKeys[key]
 	delete(km.deadKeys, key)
+	delete(km.deadUntil, key)
+	delete(km.revivalJitter, key)
 	km.deadMu.Unlock()
 
 	if !wasDead {
+		km.mu.Unlock()
 		return
 	}
 
-	km.mu.Lock()
 	for _, k := range km.keys {
 		if k == key {
 			km.mu.Unlock()
@@ -117,28 +850,10 @@ func (km *KeyManager) ReviveKey(key string) {
 		}
 	}
 	km.keys = append(km.keys, key)
+	km.addToPartition(key)
 	km.mu.Unlock()
-}
-
-func (km *KeyManager) reviveExpired() {
-	if km.cooldown == 0 {
-		return
-	}
-
-	now := time.Now()
-	var revive []string
 
-	km.deadMu.RLock()
-	for k, t := range km.deadKeys {
-		if now.Sub(t) >= km.cooldown {
-			revive = append(revive, k)
-		}
-	}
-	km.deadMu.RUnlock()
-
-	for _, k := range revive {
-		km.ReviveKey(k)
-	}
+	km.emit(KeyEventRevived, key, reason)
 }
 
 // ActiveKeyCount returns keys currently in rotation.
@@ -155,8 +870,22 @@ func (km *KeyManager) DeadKeyCount() int {
 	return len(km.deadKeys)
 }
 
-// TotalKeyCount returns total managed keys (active + dead).
+// LowOnKeys reports whether the active keys are at or below the threshold set
+// with WithMinActiveKeys.
+func (km *KeyManager) LowOnKeys() bool {
+	return km.minActiveKeys > 0 && km.ActiveKeyCount() <= km.minActiveKeys
+}
+
+// LowKeyWarnings returns how many times a dead key left the pool at or below
+// the threshold set with WithMinActiveKeys.
+func (km *KeyManager) LowKeyWarnings() int64 {
+	return km.lowKeyWarnings.Load()
+}
+
+// TotalKeyCount returns total managed keys (active + dead + paused).
 func (km *KeyManager) TotalKeyCount() int {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
 	return len(km.originalKeys)
 }
 
@@ -182,6 +911,247 @@ func (km *KeyManager) GetDeadKeys() map[string]time.Time {
 	return res
 }
 
+// KeyByName returns the key registered under name with WithKeyNames.
+func (km *KeyManager) KeyByName(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	for k, n := range km.names {
+		if _, ok := km.originalKeys[k]; ok && n == name {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// KeyName returns the name of key, or "" if it has none.
+func (km *KeyManager) KeyName(key string) string {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.names[key]
+}
+
+// KeyProvider returns the provider of key, or "" if it has none.
+func (km *KeyManager) KeyProvider(key string) ProviderType {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.providers[key]
+}
+
+// AddKey adds key to the pool at runtime and puts it in rotation. Keys added
+// this way are lost on restart unless they are also added to the config.
+func (km *KeyManager) AddKey(key string, provider ProviderType, name string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	if km.isDuplicateLocked(key) {
+		return ErrKeyExists
+	}
+	if name != "" {
+		for k, n := range km.names {
+			if _, ok := km.originalKeys[k]; ok && n == name {
+				return ErrKeyNameTaken
+			}
+		}
+		km.names[key] = name
+	}
+	if provider != "" {
+		km.providers[key] = provider
+	}
+	km.originalKeys[key] = struct{}{}
+	km.fingerprints[KeyFingerprint(key)] = struct{}{}
+	km.addedAt[key] = km.now()
+	km.keys = append(km.keys, key)
+	km.addToPartition(key)
+	return nil
+}
+
+// HasKey reports whether key is managed, active or dead, comparing
+// fingerprints.
+func (km *KeyManager) HasKey(key string) bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	_, ok := km.fingerprints[KeyFingerprint(key)]
+	return ok
+}
+
+// isDuplicateLocked reports whether key is already managed, logging its
+// fingerprint if so. km.mu must be held.
+func (km *KeyManager) isDuplicateLocked(key string) bool {
+	fp := KeyFingerprint(key)
+	if _, dup := km.fingerprints[fp]; !dup {
+		return false
+	}
+	km.logger.Warn("duplicate key", slog.String("fingerprint", fp))
+	return true
+}
+
+// RemoveKey removes key from the pool, whether active or dead, and forgets
+// its state. It reports whether the key was managed. Requests already using
+// the key are not interrupted.
+func (km *KeyManager) RemoveKey(key string) bool {
+	km.mu.Lock()
+	if _, ok := km.originalKeys[key]; !ok {
+		km.mu.Unlock()
+		return false
+	}
+	km.removeKeyLocked(key)
+	km.mu.Unlock()
+
+	km.forgetInFlight(key)
+	return true
+}
+
+// AddKeys adds a batch of keys to the pool under a single lock, using each
+// key's Key, Provider and Name, and emits one KeyEventKeysAdded. Keys
+// already in the pool or repeated in the batch are skipped and counted as
+// duplicates. If any key is empty or its name is used by another key,
+// nothing is added and the error wraps ErrEmptyKey or ErrKeyNameTaken.
+func (km *KeyManager) AddKeys(keys []APIKey) (added, duplicates int, err error) {
+	km.mu.Lock()
+
+	names := make(map[string]string, len(km.names))
+	for k, n := range km.names {
+		if _, ok := km.originalKeys[k]; ok && n != "" {
+			names[n] = k
+		}
+	}
+	var batch []APIKey
+	seen := make(map[string]struct{}, len(keys))
+	for i, k := range keys {
+		if k.Key == "" {
+			km.mu.Unlock()
+			return 0, 0, fmt.Errorf("keys[%d]: %w", i, ErrEmptyKey)
+		}
+		fp := KeyFingerprint(k.Key)
+		if _, repeated := seen[fp]; repeated {
+			km.logger.Warn("duplicate key", slog.String("fingerprint", fp))
+			duplicates++
+			continue
+		}
+		if km.isDuplicateLocked(k.Key) {
+			duplicates++
+			continue
+		}
+		if k.Name != "" {
+			if owner, taken := names[k.Name]; taken && owner != k.Key {
+				km.mu.Unlock()
+				return 0, 0, fmt.Errorf("keys[%d] name %q: %w", i, k.Name, ErrKeyNameTaken)
+			}
+			names[k.Name] = k.Key
+		}
+		seen[fp] = struct{}{}
+		batch = append(batch, k)
+	}
+
+	now := km.now()
+	for _, k := range batch {
+		if k.Name != "" {
+			km.names[k.Key] = k.Name
+		}
+		if k.Provider != "" {
+			km.providers[k.Key] = k.Provider
+		}
+		km.originalKeys[k.Key] = struct{}{}
+		km.fingerprints[KeyFingerprint(k.Key)] = struct{}{}
+		km.addedAt[k.Key] = now
+		km.keys = append(km.keys, k.Key)
+		km.addToPartition(k.Key)
+	}
+	km.mu.Unlock()
+
+	if len(batch) > 0 {
+		km.emitCount(KeyEventKeysAdded, len(batch), ReasonAddedByAdmin)
+	}
+	return len(batch), duplicates, nil
+}
+
+// RemoveKeys removes the keys with the given names under a single lock, as
+// RemoveKey does, and emits one KeyEventKeysRemoved. Names no key has are
+// counted as not found.
+func (km *KeyManager) RemoveKeys(names []string) (removed, notFound int) {
+	km.mu.Lock()
+	byName := make(map[string]string, len(km.names))
+	for k, n := range km.names {
+		if _, ok := km.originalKeys[k]; ok && n != "" {
+			byName[n] = k
+		}
+	}
+	var keys []string
+	for _, name := range names {
+		key, ok := byName[name]
+		if !ok {
+			notFound++
+			continue
+		}
+		delete(byName, name)
+		km.removeKeyLocked(key)
+		keys = append(keys, key)
+	}
+	km.mu.Unlock()
+
+	for _, key := range keys {
+		km.forgetInFlight(key)
+	}
+	if len(keys) > 0 {
+		km.emitCount(KeyEventKeysRemoved, len(keys), ReasonRemovedByAdmin)
+	}
+	return len(keys), notFound
+}
+
+// removeKeyLocked takes key out of the pool and forgets its state, except
+// its in-flight count. km.mu must be held.
+func (km *KeyManager) removeKeyLocked(key string) {
+	filtered := km.keys[:0]
+	for _, k := range km.keys {
+		if k != key {
+			filtered = append(filtered, k)
+		}
+	}
+	km.keys = filtered
+	km.removeFromPartition(key)
+	delete(km.originalKeys, key)
+	delete(km.fingerprints, KeyFingerprint(key))
+	delete(km.names, key)
+	delete(km.providers, key)
+	delete(km.tags, key)
+	delete(km.weights, key)
+	delete(km.baseURLs, key)
+	delete(km.regions, key)
+	delete(km.addedAt, key)
+	delete(km.expiresAt, key)
+	delete(km.expired, key)
+	delete(km.pausedKeys, key)
+
+	km.deadMu.Lock()
+	delete(km.deadKeys, key)
+	delete(km.deadUntil, key)
+	delete(km.revivalJitter, key)
+	delete(km.deathCount, key)
+	delete(km.lastError, key)
+	km.deadMu.Unlock()
+
+	km.usageMu.Lock()
+	delete(km.ewmaUsage, key)
+	delete(km.lastUsed, key)
+	delete(km.errorCount, key)
+	km.usageMu.Unlock()
+}
+
+// forgetInFlight drops the in-flight count and drain state of a removed key.
+func (km *KeyManager) forgetInFlight(key string) {
+	km.inFlightMu.Lock()
+	delete(km.inFlight, key)
+	delete(km.draining, key)
+	km.inFlightMu.Unlock()
+}
+
 // IsKeyDead reports whether a key is currently marked dead.
 func (km *KeyManager) IsKeyDead(key string) bool {
 	km.deadMu.RLock()
@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Benchmarks for the KeyManager hot paths. testdata/bench_baseline.txt holds
+// the reference results CI compares against (see cmd/benchcheck); the ns/op
+// figures quoted below come from that file, measured on a single-core Xeon VM.
+// Regenerate it on the CI runner class after an intended change:
+//
+//	go test ./internal/domain -run '^$' -bench=. -benchtime=5s -count=3 > internal/domain/testdata/bench_baseline.txt
+//
+// Run with -race as well to see the locking overhead; expect several times
+// slower results, which are not compared against the baseline.
+
+func benchKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("AIzaSyBenchKey%06d", i)
+	}
+	return keys
+}
+
+// Baseline: ~130 ns/op.
+func BenchmarkGetNextKey_10Keys(b *testing.B) {
+	km := NewKeyManager(benchKeys(10), time.Hour)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		km.GetNextKey()
+	}
+}
+
+// Baseline: ~115 ns/op; selection is O(1) in the pool size.
+func BenchmarkGetNextKey_1000Keys(b *testing.B) {
+	km := NewKeyManager(benchKeys(1000), time.Hour)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		km.GetNextKey()
+	}
+}
+
+// Baseline: ~120 ns/op on one core; the shared index and read locks bound scaling.
+func BenchmarkGetNextKey_Parallel(b *testing.B) {
+	km := NewKeyManager(benchKeys(10), time.Hour)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			km.GetNextKey()
+		}
+	})
+}
+
+// Baseline: ~3.2 µs/op; removal rebuilds the active list of 1000 keys.
+func BenchmarkMarkAsDead(b *testing.B) {
+	keys := benchKeys(1000)
+	km := NewKeyManager(keys, time.Hour)
+	reviveAll := func() {
+		for _, k := range keys {
+			km.ReviveKey(k)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i > 0 && i%len(keys) == 0 {
+			b.StopTimer()
+			reviveAll()
+			b.StartTimer()
+		}
+		km.MarkAsDead(keys[i%len(keys)], "")
+	}
+}
+
+// Baseline: ~2.4 µs/op; revival scans the active list for duplicates.
+func BenchmarkReviveKey(b *testing.B) {
+	keys := benchKeys(1000)
+	km := NewKeyManager(keys, time.Hour)
+	killAll := func() {
+		for _, k := range keys {
+			km.MarkAsDead(k, "")
+		}
+	}
+	killAll()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i > 0 && i%len(keys) == 0 {
+			b.StopTimer()
+			killAll()
+			b.StartTimer()
+		}
+		km.ReviveKey(keys[i%len(keys)])
+	}
+}
+
+// Baseline: ~345 ns/op with 10 keys.
+func BenchmarkMarkAndReviveCycle(b *testing.B) {
+	keys := benchKeys(10)
+	km := NewKeyManager(keys, time.Hour)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := keys[i%len(keys)]
+		km.MarkAsDead(k, "")
+		km.ReviveKey(k)
+	}
+}
+
+// BenchmarkKeyManager_HighContention runs GetNextKey from 32 goroutines while
+// every 16th operation also kills and revives a key, so readers contend with
+// writers for the rotation lock. Baseline: ~430 ns/op.
+func BenchmarkKeyManager_HighContention(b *testing.B) {
+	const goroutines = 32
+	keys := benchKeys(100)
+	km := NewKeyManager(keys, time.Hour)
+
+	var wg sync.WaitGroup
+	per := b.N/goroutines + 1
+	b.ResetTimer()
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < per; i++ {
+				km.GetNextKey()
+				if i%16 == 0 {
+					k := keys[(g+i)%len(keys)]
+					km.MarkAsDead(k, "")
+					km.ReviveKey(k)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
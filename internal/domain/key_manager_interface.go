@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// KeyManagerInterface is the part of KeyManager the proxy handler uses, so
+// handlers can be tested against MockKeyManager instead of a real pool.
+type KeyManagerInterface interface {
+	// GetNextKey returns the next active key to use.
+	GetNextKey() (string, error)
+
+	// MarkAsDead takes key out of rotation until its cooldown passes,
+	// keeping reason as its last error.
+	MarkAsDead(key, reason string)
+
+	// ReviveKey puts a dead key back into rotation.
+	ReviveKey(key string)
+
+	// ActiveKeyCount returns the number of keys in rotation.
+	ActiveKeyCount() int
+
+	// DeadKeyCount returns the number of keys out of rotation.
+	DeadKeyCount() int
+
+	// TotalKeyCount returns the number of active and dead keys.
+	TotalKeyCount() int
+
+	// IsKeyDead reports whether key is out of rotation.
+	IsKeyDead(key string) bool
+
+	// Selection by request, provider, tags and region, skipping the keys a
+	// request already tried.
+	GetNextKeyExcluding(ctx context.Context, exclude map[string]struct{}) (string, error)
+	GetNextKeyByProviderExcluding(ctx context.Context, provider ProviderType, exclude map[string]struct{}) (string, error)
+	GetNextKeyByTagsExcluding(ctx context.Context, tags []string, strategy RotationStrategy, exclude map[string]struct{}) (string, error)
+	GetNextKeyByLowestRegionLatencyExcluding(ctx context.Context, exclude map[string]struct{}) (string, error)
+
+	// Concurrency, quota and health bookkeeping.
+	AcquireKey(key string) bool
+	ReleaseKey(key string)
+	IsOverQuota(key string) bool
+	IsOverTokenRate(key string) bool
+	RecordSuccess(key string)
+	RecordError(key string)
+	HandleError(key string, err error) bool
+	ReviveExpired()
+
+	// Pool inspection.
+	GetActiveKeys() []string
+	GetAllKeyStates() []KeyState
+	LowOnKeys() bool
+	ActiveProviders() []ProviderType
+	ProviderKeyCount(provider ProviderType) int
+	KeyProvider(key string) ProviderType
+	KeyBaseURL(key string) string
+	KeyName(key string) string
+	GetCooldown() time.Duration
+	EarliestRevivalTime() (time.Time, bool)
+}
+
+var _ KeyManagerInterface = (*KeyManager)(nil)
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"pgregory.net/rapid"
+)
+
+// Each property runs rapid's default 100 cases of propertySteps operations,
+// 10,000 steps per property in total. Run with -race.
+const propertySteps = 100
+
+// keyManagerModel is the expected state of a round-robin KeyManager whose
+// cooldown is long enough that no key revives on its own.
+type keyManagerModel struct {
+	active []string // rotation order: deaths keep it, revivals append
+	dead   []string
+	index  int
+}
+
+func (m *keyManagerModel) markDead(key string) {
+	i := slices.Index(m.active, key)
+	m.active = slices.Delete(m.active, i, i+1)
+	m.dead = append(m.dead, key)
+}
+
+func (m *keyManagerModel) revive(key string) {
+	i := slices.Index(m.dead, key)
+	m.dead = slices.Delete(m.dead, i, i+1)
+	m.active = append(m.active, key)
+}
+
+func genKeys(t *rapid.T) []string {
+	n := rapid.IntRange(1, 8).Draw(t, "keys")
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	return keys
+}
+
+func TestKeyManager_StateMachine(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		keys := genKeys(t)
+		km := NewKeyManager(keys, time.Hour)
+		m := &keyManagerModel{active: slices.Clone(keys)}
+
+		ops := []string{"GetNextKey", "MarkAsDead", "ReviveKey", "ReviveActiveKey"}
+		for step := 0; step < propertySteps; step++ {
+			switch rapid.SampledFrom(ops).Draw(t, "op") {
+			case "GetNextKey":
+				key, err := km.GetNextKey()
+				if len(m.active) == 0 {
+					if err != ErrNoKeysAvailable {
+						t.Fatalf("GetNextKey() error = %v with no active keys, want ErrNoKeysAvailable", err)
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("GetNextKey() error = %v", err)
+				}
+				if km.IsKeyDead(key) || slices.Contains(m.dead, key) {
+					t.Fatalf("GetNextKey() = %s, a dead key", key)
+				}
+				if want := m.active[m.index%len(m.active)]; key != want {
+					t.Fatalf("GetNextKey() = %s, want %s", key, want)
+				}
+				m.index++
+
+			case "MarkAsDead":
+				if len(m.active) == 0 {
+					break
+				}
+				key := rapid.SampledFrom(m.active).Draw(t, "active key")
+				km.MarkAsDead(key, "")
+				m.markDead(key)
+
+			case "ReviveKey":
+				if len(m.dead) == 0 {
+					break
+				}
+				key := rapid.SampledFrom(m.dead).Draw(t, "dead key")
+				km.ReviveKey(key)
+				m.revive(key)
+
+			case "ReviveActiveKey":
+				if len(m.active) == 0 {
+					break
+				}
+				key := rapid.SampledFrom(m.active).Draw(t, "active key")
+				before := km.ActiveKeyCount()
+				km.ReviveKey(key)
+				if got := km.ActiveKeyCount(); got != before {
+					t.Fatalf("ReviveKey(active %s) changed ActiveKeyCount from %d to %d", key, before, got)
+				}
+			}
+
+			checkKeyManagerInvariants(t, km)
+			if got := km.GetActiveKeys(); !slices.Equal(got, m.active) {
+				t.Fatalf("active keys = %v, want %v", got, m.active)
+			}
+			if got := km.DeadKeyCount(); got != len(m.dead) {
+				t.Fatalf("DeadKeyCount() = %d, want %d", got, len(m.dead))
+			}
+		}
+	})
+}
+
+// TestKeyManager_ConcurrentOperations runs random operations from several
+// goroutines at once; every key must end up either active or dead.
+func TestKeyManager_ConcurrentOperations(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		keys := genKeys(t)
+		km := NewKeyManager(keys, time.Hour)
+
+		const workers = 4
+		plans := make([][]int, workers)
+		targets := make([][]string, workers)
+		for w := range plans {
+			plans[w] = rapid.SliceOfN(rapid.IntRange(0, 2), propertySteps/workers, propertySteps/workers).Draw(t, fmt.Sprintf("ops %d", w))
+			targets[w] = rapid.SliceOfN(rapid.SampledFrom(keys), len(plans[w]), len(plans[w])).Draw(t, fmt.Sprintf("keys %d", w))
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan string, workers*propertySteps)
+		for w := range plans {
+			wg.Add(1)
+			go func(ops []int, keys []string) {
+				defer wg.Done()
+				for i, op := range ops {
+					switch op {
+					case 0:
+						key, err := km.GetNextKey()
+						if err == nil && key == "" {
+							errs <- "GetNextKey() returned an empty key"
+						}
+					case 1:
+						km.MarkAsDead(keys[i], "")
+					case 2:
+						km.ReviveKey(keys[i])
+					}
+				}
+			}(plans[w], targets[w])
+		}
+		wg.Wait()
+		close(errs)
+
+		for msg := range errs {
+			t.Fatal(msg)
+		}
+		checkKeyManagerInvariants(t, km)
+		for _, key := range keys {
+			if km.IsKeyDead(key) == slices.Contains(km.GetActiveKeys(), key) {
+				t.Fatalf("%s is active=%v and dead=%v, want exactly one", key, !km.IsKeyDead(key), km.IsKeyDead(key))
+			}
+		}
+	})
+}
+
+func checkKeyManagerInvariants(t *rapid.T, km *KeyManager) {
+	active, dead, total := km.ActiveKeyCount(), km.DeadKeyCount(), km.TotalKeyCount()
+	if active+dead != total {
+		t.Fatalf("ActiveKeyCount() + DeadKeyCount() = %d + %d, want TotalKeyCount() = %d", active, dead, total)
+	}
+}
@@ -1,6 +1,12 @@
 package domain
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -76,6 +82,58 @@ func TestGetNextKey_NoKeys(t *testing.T) {
 	}
 }
 
+func TestGetNextKeyContext(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0)
+
+	if key, err := km.GetNextKeyContext(context.Background()); err != nil || key != "key1" {
+		t.Fatalf("GetNextKeyContext() = %s, %v, want key1", key, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if _, err := km.GetNextKeyContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetNextKeyContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The expired call did not advance the rotation.
+	if key, _ := km.GetNextKey(); key != "key2" {
+		t.Errorf("GetNextKey() = %s, want key2", key)
+	}
+}
+
+func TestGetNextKeyExcluding(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2", "key3"}, 0)
+	exclude := map[string]struct{}{"key1": {}, "key3": {}}
+
+	// Round-robin alone would return key1 and key3 as well.
+	for i := 0; i < 6; i++ {
+		key, err := km.GetNextKeyExcluding(context.Background(), exclude)
+		if err != nil {
+			t.Fatalf("GetNextKeyExcluding() error = %v", err)
+		}
+		if key != "key2" {
+			t.Fatalf("GetNextKeyExcluding() = %s, want key2", key)
+		}
+	}
+
+	// Excluded keys stay in the pool.
+	if got := km.ActiveKeyCount(); got != 3 {
+		t.Errorf("ActiveKeyCount() = %d, want 3", got)
+	}
+
+	exclude["key2"] = struct{}{}
+	if _, err := km.GetNextKeyExcluding(context.Background(), exclude); !errors.Is(err, ErrNoKeysAvailable) {
+		t.Errorf("GetNextKeyExcluding() error = %v, want %v with every key excluded", err, ErrNoKeysAvailable)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := km.GetNextKeyExcluding(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetNextKeyExcluding() error = %v, want %v", err, context.Canceled)
+	}
+}
+
 func TestGetNextKey_Concurrent(t *testing.T) {
 	keys := []string{"key1", "key2", "key3", "key4", "key5"}
 	km := NewKeyManager(keys, 0)
@@ -130,7 +188,7 @@ func TestMarkAsDead(t *testing.T) {
 	km := NewKeyManager(keys, 0)
 
 	// Mark key2 as dead
-	km.MarkAsDead("key2")
+	km.MarkAsDead("key2", "")
 
 	if km.ActiveKeyCount() != 2 {
 		t.Errorf("ActiveKeyCount() = %d, want 2", km.ActiveKeyCount())
@@ -160,8 +218,8 @@ func TestMarkAsDead_AllKeys(t *testing.T) {
 	keys := []string{"key1", "key2"}
 	km := NewKeyManager(keys, 0) // No auto-revival
 
-	km.MarkAsDead("key1")
-	km.MarkAsDead("key2")
+	km.MarkAsDead("key1", "")
+	km.MarkAsDead("key2", "")
 
 	_, err := km.GetNextKey()
 	if err != ErrNoKeysAvailable {
@@ -174,7 +232,7 @@ func TestReviveKey(t *testing.T) {
 	km := NewKeyManager(keys, 0)
 
 	// Mark and then revive
-	km.MarkAsDead("key2")
+	km.MarkAsDead("key2", "")
 	if km.ActiveKeyCount() != 2 {
 		t.Errorf("After MarkAsDead: ActiveKeyCount() = %d, want 2", km.ActiveKeyCount())
 	}
@@ -194,7 +252,7 @@ func TestAutoRevival(t *testing.T) {
 	cooldown := 50 * time.Millisecond
 	km := NewKeyManager(keys, cooldown)
 
-	km.MarkAsDead("key1")
+	km.MarkAsDead("key1", "")
 
 	// Key should be dead immediately
 	if !km.IsKeyDead("key1") {
@@ -217,7 +275,7 @@ func TestMarkAsDead_UnknownKey(t *testing.T) {
 	km := NewKeyManager(keys, 0)
 
 	// Marking unknown key should be a no-op
-	km.MarkAsDead("unknown_key")
+	km.MarkAsDead("unknown_key", "")
 
 	if km.ActiveKeyCount() != 2 {
 		t.Errorf("ActiveKeyCount() = %d after marking unknown key, want 2", km.ActiveKeyCount())
@@ -228,7 +286,7 @@ func TestGetActiveKeys(t *testing.T) {
 	keys := []string{"key1", "key2", "key3"}
 	km := NewKeyManager(keys, 0)
 
-	km.MarkAsDead("key2")
+	km.MarkAsDead("key2", "")
 
 	activeKeys := km.GetActiveKeys()
 	if len(activeKeys) != 2 {
@@ -247,7 +305,7 @@ func TestGetDeadKeys(t *testing.T) {
 	keys := []string{"key1", "key2", "key3"}
 	km := NewKeyManager(keys, 0)
 
-	km.MarkAsDead("key2")
+	km.MarkAsDead("key2", "")
 
 	deadKeys := km.GetDeadKeys()
 	if len(deadKeys) != 1 {
@@ -263,11 +321,569 @@ func TestTotalKeyCount(t *testing.T) {
 	keys := []string{"key1", "key2", "key3"}
 	km := NewKeyManager(keys, 0)
 
-	km.MarkAsDead("key1")
-	km.MarkAsDead("key2")
+	km.MarkAsDead("key1", "")
+	km.MarkAsDead("key2", "")
 
 	// Total should remain constant
 	if km.TotalKeyCount() != 3 {
 		t.Errorf("TotalKeyCount() = %d, want 3", km.TotalKeyCount())
 	}
 }
+
+func TestRecordUsage_EWMA(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithDecayAlpha(0.5))
+
+	km.RecordSuccess("key1")
+	if got := km.Usage("key1"); got != 0.5 {
+		t.Errorf("Usage(key1) = %v, want 0.5", got)
+	}
+
+	km.RecordError("key1")
+	if got := km.Usage("key1"); got != 0.75 {
+		t.Errorf("Usage(key1) = %v, want 0.75", got)
+	}
+
+	// A request on another key decays key1.
+	km.RecordSuccess("key2")
+	if got := km.Usage("key1"); got != 0.375 {
+		t.Errorf("Usage(key1) = %v, want 0.375", got)
+	}
+	if got := km.Usage("key2"); got != 0.5 {
+		t.Errorf("Usage(key2) = %v, want 0.5", got)
+	}
+
+	km.RecordSuccess("unknown")
+	if got := km.Usage("unknown"); got != 0 {
+		t.Errorf("Usage(unknown) = %v, want 0", got)
+	}
+}
+
+func TestRecordUsage_Decay(t *testing.T) {
+	km := NewKeyManager([]string{"heavy", "light"}, 0)
+
+	for i := 0; i < 50; i++ {
+		km.RecordSuccess("heavy")
+	}
+	if km.Usage("heavy") <= km.Usage("light") {
+		t.Fatalf("after heavy use: heavy = %v, light = %v, want heavy higher", km.Usage("heavy"), km.Usage("light"))
+	}
+
+	// Time passes while traffic moves to the other key; heavy's old usage fades.
+	for i := 0; i < 10; i++ {
+		km.RecordSuccess("light")
+	}
+	if km.Usage("heavy") >= km.Usage("light") {
+		t.Errorf("after decay: heavy = %v, light = %v, want heavy lower", km.Usage("heavy"), km.Usage("light"))
+	}
+}
+
+func TestGetNextKey_LeastUsed(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2", "key3"}, 0, WithStrategy(StrategyLeastUsed))
+
+	km.RecordSuccess("key1")
+	km.RecordSuccess("key1")
+	km.RecordSuccess("key3")
+
+	for i := 0; i < 5; i++ {
+		key, err := km.GetNextKey()
+		if err != nil {
+			t.Fatalf("GetNextKey() error = %v", err)
+		}
+		if key != "key2" {
+			t.Errorf("GetNextKey() = %s, want key2 (least used)", key)
+		}
+	}
+
+	// Selection follows usage as it is recorded.
+	for i := 0; i < 5; i++ {
+		km.RecordSuccess("key2")
+	}
+	if key, _ := km.GetNextKey(); key != "key3" {
+		t.Errorf("GetNextKey() = %s, want key3", key)
+	}
+}
+
+func TestGetNextKey_LeastUsedTiesRotate(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2", "key3"}, 0, WithStrategy(StrategyLeastUsed))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		key, _ := km.GetNextKey()
+		seen[key] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("unused keys selected = %v, want all three while tied", seen)
+	}
+}
+
+func TestGetNextKey_LeastUsedSkipsDead(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithStrategy(StrategyLeastUsed))
+	km.RecordSuccess("key1")
+	km.MarkAsDead("key2", "")
+
+	if key, _ := km.GetNextKey(); key != "key1" {
+		t.Errorf("GetNextKey() = %s, want key1 (key2 is dead)", key)
+	}
+}
+
+// newPartitionedKeyManager returns a KeyManager with two Google and two OpenAI keys.
+func newPartitionedKeyManager() *KeyManager {
+	return NewKeyManager([]string{"g1", "o1", "g2", "o2"}, 0, WithKeyProviders(map[string]ProviderType{
+		"g1": ProviderGoogle,
+		"g2": ProviderGoogle,
+		"o1": ProviderOpenAI,
+		"o2": ProviderOpenAI,
+	}))
+}
+
+func TestGetNextKeyByProvider(t *testing.T) {
+	km := newPartitionedKeyManager()
+
+	want := []string{"g1", "g2", "g1"}
+	for i, w := range want {
+		key, err := km.GetNextKeyByProvider(ProviderGoogle)
+		if err != nil {
+			t.Fatalf("GetNextKeyByProvider() error = %v", err)
+		}
+		if key != w {
+			t.Errorf("call %d: GetNextKeyByProvider(google) = %s, want %s", i, key, w)
+		}
+	}
+
+	if got := km.ProviderKeyCount(ProviderGoogle); got != 2 {
+		t.Errorf("ProviderKeyCount(google) = %d, want 2", got)
+	}
+	if got := km.ProviderKeyCount(ProviderAnthropic); got != 0 {
+		t.Errorf("ProviderKeyCount(anthropic) = %d, want 0", got)
+	}
+}
+
+func TestGetNextKeyByProviderExcluding(t *testing.T) {
+	km := newPartitionedKeyManager()
+
+	tried := map[string]struct{}{"g1": {}}
+	for i := 0; i < 3; i++ {
+		if key, err := km.GetNextKeyByProviderExcluding(context.Background(), ProviderGoogle, tried); err != nil || key != "g2" {
+			t.Fatalf("GetNextKeyByProviderExcluding(google, g1) = %s, %v, want g2", key, err)
+		}
+	}
+	tried["g2"] = struct{}{}
+	if _, err := km.GetNextKeyByProviderExcluding(context.Background(), ProviderGoogle, tried); !errors.Is(err, ErrNoKeysAvailable) {
+		t.Errorf("error = %v, want ErrNoKeysAvailable with every google key tried", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := km.GetNextKeyByProviderExcluding(ctx, ProviderGoogle, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
+
+func TestGetNextKeyByProvider_PartitionsAreIndependent(t *testing.T) {
+	km := newPartitionedKeyManager()
+
+	if key, _ := km.GetNextKeyByProvider(ProviderOpenAI); key != "o1" {
+		t.Fatalf("GetNextKeyByProvider(openai) = %s, want o1", key)
+	}
+
+	// Google traffic and a dead Google key leave the OpenAI counter alone.
+	km.GetNextKeyByProvider(ProviderGoogle)
+	km.GetNextKeyByProvider(ProviderGoogle)
+	km.MarkAsDead("g1", "")
+
+	if key, _ := km.GetNextKeyByProvider(ProviderOpenAI); key != "o2" {
+		t.Errorf("GetNextKeyByProvider(openai) = %s, want o2", key)
+	}
+	if got := km.ProviderKeyCount(ProviderOpenAI); got != 2 {
+		t.Errorf("ProviderKeyCount(openai) = %d, want 2", got)
+	}
+	if got := km.ProviderKeyCount(ProviderGoogle); got != 1 {
+		t.Errorf("ProviderKeyCount(google) = %d, want 1", got)
+	}
+	for i := 0; i < 3; i++ {
+		if key, _ := km.GetNextKeyByProvider(ProviderGoogle); key != "g2" {
+			t.Errorf("GetNextKeyByProvider(google) = %s, want g2 (g1 is dead)", key)
+		}
+	}
+}
+
+func TestGetNextKeyByProvider_Empty(t *testing.T) {
+	km := newPartitionedKeyManager()
+	km.MarkAsDead("g1", "")
+	km.MarkAsDead("g2", "")
+
+	if _, err := km.GetNextKeyByProvider(ProviderGoogle); err != ErrNoKeysAvailable {
+		t.Errorf("GetNextKeyByProvider(google) error = %v, want ErrNoKeysAvailable", err)
+	}
+	if _, err := km.GetNextKeyByProvider(ProviderAzure); err != ErrNoKeysAvailable {
+		t.Errorf("GetNextKeyByProvider(azure) error = %v, want ErrNoKeysAvailable", err)
+	}
+	if _, err := km.GetNextKeyByProvider(ProviderOpenAI); err != nil {
+		t.Errorf("GetNextKeyByProvider(openai) error = %v, want nil", err)
+	}
+
+	km.ReviveKey("g2")
+	if key, err := km.GetNextKeyByProvider(ProviderGoogle); err != nil || key != "g2" {
+		t.Errorf("GetNextKeyByProvider(google) = %s, %v; want g2 after revival", key, err)
+	}
+}
+
+func TestMarkAsDeadUntil(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, time.Nanosecond)
+
+	km.MarkAsDeadUntil("key1", time.Now().Add(time.Hour))
+	km.MarkAsDead("key2", "")
+	time.Sleep(time.Millisecond)
+	km.ReviveExpired()
+
+	if !km.IsKeyDead("key1") {
+		t.Error("key1 revived before its deadline")
+	}
+	if km.IsKeyDead("key2") {
+		t.Error("key2 not revived after its cooldown")
+	}
+
+	km.MarkAsDeadUntil("key2", time.Now().Add(-time.Second))
+	km.ReviveExpired()
+	if km.IsKeyDead("key2") {
+		t.Error("key2 not revived after its deadline passed")
+	}
+
+	km.ReviveKey("key1")
+	if km.IsKeyDead("key1") {
+		t.Error("ReviveKey did not override the deadline")
+	}
+}
+
+func TestKeyByName(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithKeyNames(map[string]string{
+		"key1": "primary",
+		"key3": "not-in-pool",
+	}))
+
+	tests := []struct {
+		name    string
+		wantKey string
+		wantOK  bool
+	}{
+		{"primary", "key1", true},
+		{"not-in-pool", "", false},
+		{"key2", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		if key, ok := km.KeyByName(tt.name); key != tt.wantKey || ok != tt.wantOK {
+			t.Errorf("KeyByName(%q) = %q, %v; want %q, %v", tt.name, key, ok, tt.wantKey, tt.wantOK)
+		}
+	}
+	if got := km.KeyName("key1"); got != "primary" {
+		t.Errorf("KeyName(key1) = %q, want primary", got)
+	}
+}
+
+func TestMaxConcurrentPerKey(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithMaxConcurrentPerKey(1))
+
+	a, err := km.GetNextKey()
+	if err != nil {
+		t.Fatalf("GetNextKey() error = %v", err)
+	}
+	b, err := km.GetNextKey()
+	if err != nil {
+		t.Fatalf("GetNextKey() error = %v", err)
+	}
+	if a == b {
+		t.Errorf("both requests got %s, want a different key while it is busy", a)
+	}
+
+	if _, err := km.GetNextKey(); err != ErrKeysBusy {
+		t.Errorf("GetNextKey() error = %v, want ErrKeysBusy", err)
+	}
+
+	km.ReleaseKey(b)
+	if key, err := km.GetNextKey(); err != nil || key != b {
+		t.Errorf("GetNextKey() = %s, %v; want released %s", key, err, b)
+	}
+}
+
+func TestMaxConcurrentPerKey_Unlimited(t *testing.T) {
+	km := NewKeyManager([]string{"key1"}, 0)
+
+	for i := 0; i < 5; i++ {
+		if _, err := km.GetNextKey(); err != nil {
+			t.Fatalf("GetNextKey() error = %v, want no limit", err)
+		}
+	}
+	// Requests are still counted, so a drain can wait for them.
+	if got := km.InFlight("key1"); got != 5 {
+		t.Errorf("InFlight() = %d, want 5 without a limit", got)
+	}
+	for i := 0; i < 5; i++ {
+		km.ReleaseKey("key1")
+	}
+	if got := km.InFlight("key1"); got != 0 {
+		t.Errorf("InFlight() = %d after every release, want 0", got)
+	}
+}
+
+func TestMinActiveKeys_Warning(t *testing.T) {
+	var logs bytes.Buffer
+	km := NewKeyManager([]string{"key1", "key2", "key3"}, 0,
+		WithMinActiveKeys(1),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+
+	km.MarkAsDead("key1", "")
+	if logs.Len() != 0 || km.LowKeyWarnings() != 0 || km.LowOnKeys() {
+		t.Fatalf("warned with 2 active keys: logs = %q", logs.String())
+	}
+
+	km.MarkAsDead("key2", "")
+	if got := km.LowKeyWarnings(); got != 1 {
+		t.Errorf("LowKeyWarnings() = %d, want 1", got)
+	}
+	if !km.LowOnKeys() {
+		t.Error("LowOnKeys() = false, want true with 1 active key")
+	}
+	for _, want := range []string{"level=WARN", "active_keys=1", "dead_keys=2", "threshold=1"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs = %q, want %q", logs.String(), want)
+		}
+	}
+
+	km.MarkAsDead("key2", "") // already dead: no new warning
+	if got := km.LowKeyWarnings(); got != 1 {
+		t.Errorf("LowKeyWarnings() = %d after a repeat, want 1", got)
+	}
+
+	km.ReviveKey("key1")
+	km.ReviveKey("key2")
+	if km.LowOnKeys() {
+		t.Error("LowOnKeys() = true after revival, want false")
+	}
+	km.MarkAsDead("key3", "")
+	if got := km.LowKeyWarnings(); got != 1 {
+		t.Errorf("LowKeyWarnings() = %d with 2 active keys, want 1", got)
+	}
+	km.MarkAsDead("key1", "")
+	if got := km.LowKeyWarnings(); got != 2 {
+		t.Errorf("LowKeyWarnings() = %d after crossing again, want 2", got)
+	}
+}
+
+func TestMinActiveKeys_Disabled(t *testing.T) {
+	var logs bytes.Buffer
+	km := NewKeyManager([]string{"key1"}, 0, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	km.MarkAsDead("key1", "")
+	if logs.Len() != 0 || km.LowKeyWarnings() != 0 || km.LowOnKeys() {
+		t.Errorf("warned without a threshold: logs = %q", logs.String())
+	}
+}
+
+func TestKeyManager_AddKey(t *testing.T) {
+	km := NewKeyManager([]string{"key1"}, 0,
+		WithKeyNames(map[string]string{"key1": "primary"}),
+		WithKeyProviders(map[string]ProviderType{"key1": ProviderGoogle}),
+	)
+
+	tests := []struct {
+		name    string
+		key     string
+		keyName string
+		wantErr error
+	}{
+		{"new key", "key2", "backup", nil},
+		{"duplicate key", "key1", "other", ErrKeyExists},
+		{"duplicate name", "key3", "primary", ErrKeyNameTaken},
+		{"empty key", "", "empty", ErrEmptyKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := km.AddKey(tt.key, ProviderGoogle, tt.keyName); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AddKey() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := km.TotalKeyCount(); got != 2 {
+		t.Errorf("TotalKeyCount() = %d, want 2", got)
+	}
+	if key, ok := km.KeyByName("backup"); !ok || key != "key2" {
+		t.Errorf("KeyByName(backup) = %q, %v, want key2", key, ok)
+	}
+	if got := km.ProviderKeyCount(ProviderGoogle); got != 2 {
+		t.Errorf("ProviderKeyCount(google) = %d, want 2", got)
+	}
+}
+
+func TestKeyManager_RemoveKey(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2", "key3"}, time.Hour,
+		WithKeyNames(map[string]string{"key2": "backup"}),
+	)
+	km.MarkAsDead("key2", "")
+
+	if !km.RemoveKey("key2") {
+		t.Fatal("RemoveKey(key2) = false, want true")
+	}
+	if km.RemoveKey("key2") {
+		t.Error("RemoveKey(key2) = true for a removed key")
+	}
+	if km.IsKeyDead("key2") || km.TotalKeyCount() != 2 {
+		t.Errorf("removed key still tracked: dead=%v total=%d", km.IsKeyDead("key2"), km.TotalKeyCount())
+	}
+	if _, ok := km.KeyByName("backup"); ok {
+		t.Error("KeyByName() still finds the removed key")
+	}
+
+	km.RemoveKey("key1")
+	for i := 0; i < 3; i++ {
+		if key, _ := km.GetNextKey(); key != "key3" {
+			t.Errorf("GetNextKey() = %q, want key3", key)
+		}
+	}
+
+	// A removed key can be added back.
+	if err := km.AddKey("key1", "", ""); err != nil {
+		t.Errorf("AddKey() after removal error = %v", err)
+	}
+}
+
+func TestKeyManager_AddKeys(t *testing.T) {
+	bus := NewEventBus()
+	var mu sync.Mutex
+	var events []KeyEvent
+	bus.Subscribe(func(e KeyEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	km := NewKeyManager([]string{"key1"}, 0,
+		WithKeyNames(map[string]string{"key1": "primary"}),
+		WithEventBus(bus),
+	)
+
+	added, duplicates, err := km.AddKeys([]APIKey{
+		{Key: "key2", Name: "second", Provider: ProviderGoogle},
+		{Key: "key1", Name: "primary"},
+		{Key: "key3", Name: "third", Provider: ProviderOpenAI},
+		{Key: "key2", Name: "second"},
+	})
+	if err != nil || added != 2 || duplicates != 2 {
+		t.Fatalf("AddKeys() = %d, %d, %v, want 2, 2, nil", added, duplicates, err)
+	}
+	if key, ok := km.KeyByName("third"); !ok || key != "key3" {
+		t.Errorf("KeyByName(third) = %q, %v, want key3", key, ok)
+	}
+	if got := km.KeyProvider("key3"); got != ProviderOpenAI {
+		t.Errorf("KeyProvider(key3) = %q, want %q", got, ProviderOpenAI)
+	}
+
+	// A failing batch adds nothing, not even the keys before the bad one.
+	failing := []struct {
+		name    string
+		keys    []APIKey
+		wantErr error
+	}{
+		{"empty key", []APIKey{{Key: "key4", Name: "fourth"}, {Key: "", Name: "empty"}}, ErrEmptyKey},
+		{"name of pool key", []APIKey{{Key: "key4", Name: "fourth"}, {Key: "key5", Name: "primary"}}, ErrKeyNameTaken},
+		{"name repeated in batch", []APIKey{{Key: "key4", Name: "fourth"}, {Key: "key5", Name: "fourth"}}, ErrKeyNameTaken},
+	}
+	for _, tt := range failing {
+		t.Run(tt.name, func(t *testing.T) {
+			added, duplicates, err := km.AddKeys(tt.keys)
+			if !errors.Is(err, tt.wantErr) || added != 0 || duplicates != 0 {
+				t.Errorf("AddKeys() = %d, %d, %v, want 0, 0, %v", added, duplicates, err, tt.wantErr)
+			}
+			if got := km.TotalKeyCount(); got != 3 {
+				t.Errorf("TotalKeyCount() = %d, want 3", got)
+			}
+			if _, ok := km.KeyByName("fourth"); ok {
+				t.Error("KeyByName(fourth) found a key from a failed batch")
+			}
+		})
+	}
+
+	if added, duplicates, err := km.AddKeys([]APIKey{{Key: "key1"}}); err != nil || added != 0 || duplicates != 1 {
+		t.Errorf("AddKeys(duplicate) = %d, %d, %v, want 0, 1, nil", added, duplicates, err)
+	}
+	bus.Close()
+
+	if len(events) != 1 || events[0].Type != KeyEventKeysAdded || events[0].Count != 2 || events[0].Key != "" {
+		t.Errorf("events = %+v, want one keys_added event with count 2", events)
+	}
+}
+
+func TestKeyManager_RemoveKeys(t *testing.T) {
+	bus := NewEventBus()
+	var mu sync.Mutex
+	var events []KeyEvent
+	bus.Subscribe(func(e KeyEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	km := NewKeyManager([]string{"key1", "key2", "key3"}, time.Hour,
+		WithKeyNames(map[string]string{"key1": "one", "key2": "two", "key3": "three"}),
+		WithEventBus(bus),
+	)
+	km.MarkAsDead("key2", "")
+
+	removed, notFound := km.RemoveKeys([]string{"two", "three", "missing", "two"})
+	if removed != 2 || notFound != 2 {
+		t.Errorf("RemoveKeys() = %d, %d, want 2, 2", removed, notFound)
+	}
+	if km.TotalKeyCount() != 1 || km.IsKeyDead("key2") {
+		t.Errorf("removed keys still tracked: total=%d dead=%v", km.TotalKeyCount(), km.IsKeyDead("key2"))
+	}
+	for i := 0; i < 3; i++ {
+		if key, _ := km.GetNextKey(); key != "key1" {
+			t.Errorf("GetNextKey() = %q, want key1", key)
+		}
+	}
+	bus.Close()
+
+	var batch []KeyEvent
+	for _, e := range events {
+		if e.Type == KeyEventKeysRemoved {
+			batch = append(batch, e)
+		}
+	}
+	if len(batch) != 1 || batch[0].Count != 2 {
+		t.Errorf("keys_removed events = %+v, want one with count 2", batch)
+	}
+}
+
+func TestKeyManager_AddRemoveConcurrent(t *testing.T) {
+	km := NewKeyManager([]string{"key1"}, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("extra%d", i)
+			for j := 0; j < 50; j++ {
+				_ = km.AddKey(key, ProviderGoogle, key)
+				km.RecordSuccess(key)
+				km.RemoveKey(key)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if key, err := km.GetNextKey(); err == nil {
+					km.RecordSuccess(key)
+					km.MarkAsDead(key, "")
+					km.ReviveKey(key)
+				}
+				_, _ = km.KeyByName("extra1")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := km.TotalKeyCount(); got != 1 {
+		t.Errorf("TotalKeyCount() = %d, want 1", got)
+	}
+}
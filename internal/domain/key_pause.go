@@ -0,0 +1,77 @@
+package domain
+
+import "errors"
+
+// ErrKeyNotPaused is returned by ResumeKey for a key that is not paused.
+var ErrKeyNotPaused = errors.New("key is not paused")
+
+// PauseKey takes key out of rotation until ResumeKey, for maintenance
+// windows or while waiting for a quota reset. Unlike a dead key, a paused
+// key has no cooldown and is never revived: pausing a dead key drops its
+// cooldown, and MarkAsDead and ReviveKey leave a paused key alone. Pausing a
+// paused key does nothing.
+//
+// It returns ErrKeyNotFound for a key km does not manage and ErrKeyDraining
+// for a key DrainAndRemove is removing.
+func (km *KeyManager) PauseKey(key string) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	if _, ok := km.originalKeys[key]; !ok {
+		return ErrKeyNotFound
+	}
+	if km.isDraining(key) {
+		return ErrKeyDraining
+	}
+	if km.isPausedLocked(key) {
+		return nil
+	}
+	km.pausedKeys[key] = struct{}{}
+
+	km.deadMu.Lock()
+	delete(km.deadKeys, key)
+	delete(km.deadUntil, key)
+	delete(km.revivalJitter, key)
+	km.deadMu.Unlock()
+
+	filtered := km.keys[:0]
+	for _, k := range km.keys {
+		if k != key {
+			filtered = append(filtered, k)
+		}
+	}
+	km.keys = filtered
+	km.removeFromPartition(key)
+	return nil
+}
+
+// ResumeKey returns a paused key to rotation. It returns ErrKeyNotFound for
+// a key km does not manage and ErrKeyNotPaused for a key that is not paused.
+func (km *KeyManager) ResumeKey(key string) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	if _, ok := km.originalKeys[key]; !ok {
+		return ErrKeyNotFound
+	}
+	if !km.isPausedLocked(key) {
+		return ErrKeyNotPaused
+	}
+	delete(km.pausedKeys, key)
+	km.keys = append(km.keys, key)
+	km.addToPartition(key)
+	return nil
+}
+
+// IsPaused reports whether key is paused.
+func (km *KeyManager) IsPaused(key string) bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.isPausedLocked(key)
+}
+
+// isPausedLocked reports whether key is paused. km.mu must be held.
+func (km *KeyManager) isPausedLocked(key string) bool {
+	_, ok := km.pausedKeys[key]
+	return ok
+}
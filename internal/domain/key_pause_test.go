@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyManager_PauseKey(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, time.Minute)
+
+	if err := km.PauseKey("key1"); err != nil {
+		t.Fatalf("PauseKey() error = %v", err)
+	}
+	if !km.IsPaused("key1") || km.IsPaused("key2") {
+		t.Fatalf("IsPaused(key1, key2) = %v, %v, want true, false", km.IsPaused("key1"), km.IsPaused("key2"))
+	}
+	for range 10 {
+		if key, err := km.GetNextKey(); err != nil || key != "key2" {
+			t.Fatalf("GetNextKey() = %q, %v, want key2", key, err)
+		}
+	}
+	if got := km.ActiveKeyCount(); got != 1 {
+		t.Errorf("ActiveKeyCount() = %d, want 1", got)
+	}
+	if got := km.DeadKeyCount(); got != 0 {
+		t.Errorf("DeadKeyCount() = %d, want 0", got)
+	}
+	if got := km.TotalKeyCount(); got != 2 {
+		t.Errorf("TotalKeyCount() = %d, want 2", got)
+	}
+	if s, _ := km.GetKeyState("key1"); s.Status != KeyStatusPaused {
+		t.Errorf("status = %q, want %q", s.Status, KeyStatusPaused)
+	}
+
+	if err := km.ResumeKey("key1"); err != nil {
+		t.Fatalf("ResumeKey() error = %v", err)
+	}
+	if km.IsPaused("key1") || km.ActiveKeyCount() != 2 {
+		t.Errorf("after ResumeKey: paused = %v, active = %d, want false, 2", km.IsPaused("key1"), km.ActiveKeyCount())
+	}
+}
+
+func TestKeyManager_PauseKey_SurvivesRevival(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2", "key3"}, time.Millisecond)
+
+	// key1 dies and is paused before its cooldown passes; key2 is paused
+	// while active, and a failure reported on it afterwards is ignored.
+	km.MarkAsDead("key1", "rate limited")
+	if err := km.PauseKey("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := km.PauseKey("key2"); err != nil {
+		t.Fatal(err)
+	}
+	km.MarkAsDead("key2", "rate limited")
+	km.ReviveKey("key2")
+
+	time.Sleep(5 * time.Millisecond)
+	km.ReviveExpired()
+
+	for _, key := range []string{"key1", "key2"} {
+		s, _ := km.GetKeyState(key)
+		if s.Status != KeyStatusPaused || s.DeadSince != nil {
+			t.Errorf("%s: status = %q, dead since %v, want paused and not dead", key, s.Status, s.DeadSince)
+		}
+	}
+	if active := km.GetActiveKeys(); len(active) != 1 || active[0] != "key3" {
+		t.Errorf("active keys = %v, want [key3]", active)
+	}
+	if got := km.DeadKeyCount(); got != 0 {
+		t.Errorf("DeadKeyCount() = %d, want 0", got)
+	}
+}
+
+func TestKeyManager_PauseKey_Errors(t *testing.T) {
+	km := NewKeyManager([]string{"key1"}, time.Minute)
+
+	if err := km.PauseKey("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("PauseKey(missing) error = %v, want ErrKeyNotFound", err)
+	}
+	if err := km.ResumeKey("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("ResumeKey(missing) error = %v, want ErrKeyNotFound", err)
+	}
+	if err := km.ResumeKey("key1"); !errors.Is(err, ErrKeyNotPaused) {
+		t.Errorf("ResumeKey(active key) error = %v, want ErrKeyNotPaused", err)
+	}
+
+	// Pausing twice is a no-op and one ResumeKey brings the key back.
+	for range 2 {
+		if err := km.PauseKey("key1"); err != nil {
+			t.Fatalf("PauseKey() error = %v", err)
+		}
+	}
+	if err := km.ResumeKey("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if active := km.GetActiveKeys(); len(active) != 1 {
+		t.Errorf("active keys = %v, want [key1] once", active)
+	}
+
+	// A removed key forgets that it was paused.
+	km.PauseKey("key1")
+	km.RemoveKey("key1")
+	if km.IsPaused("key1") {
+		t.Error("removed key still paused")
+	}
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// WithKeyPriorities sets the priority of keys for StrategyPriority, keyed
+// by the key itself. Lower values are tried first; keys missing from the
+// map, including keys added at runtime, have priority 0, the highest.
+func WithKeyPriorities(priorities map[string]int) KeyManagerOption {
+	return func(km *KeyManager) {
+		for k, p := range priorities {
+			km.priorities[k] = p
+		}
+	}
+}
+
+// byPriority returns keys ordered by ascending priority for StrategyPriority.
+// Each priority level is rotated by one step per call, so keys sharing the
+// highest priority take turns and lower levels follow as fallbacks. Caller
+// must hold km.mu.
+func (km *KeyManager) byPriority(keys []string) []string {
+	order := slices.Clone(keys)
+	slices.SortStableFunc(order, func(a, b string) int {
+		return km.priorities[a] - km.priorities[b]
+	})
+
+	turn := atomic.AddInt64(&km.priorityIndex, 1) - 1
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && km.priorities[order[end]] == km.priorities[order[start]] {
+			end++
+		}
+		level := order[start:end]
+		rotated := append(slices.Clone(level[turn%int64(len(level)):]), level[:turn%int64(len(level))]...)
+		copy(level, rotated)
+		start = end
+	}
+	return order
+}
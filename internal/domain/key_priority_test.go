@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeyManager_StrategyPriority(t *testing.T) {
+	km := NewKeyManager([]string{"second-a", "best", "second-b"}, 0,
+		WithStrategy(StrategyPriority),
+		WithKeyPriorities(map[string]int{"best": 1, "second-a": 2, "second-b": 2}),
+	)
+
+	for i := 0; i < 5; i++ {
+		if key, err := km.GetNextKey(); err != nil || key != "best" {
+			t.Fatalf("GetNextKey() = %s, %v, want best while it is active", key, err)
+		}
+	}
+
+	km.MarkAsDead("best", "")
+	var got []string
+	for i := 0; i < 4; i++ {
+		key, err := km.GetNextKey()
+		if err != nil {
+			t.Fatalf("GetNextKey() error = %v", err)
+		}
+		got = append(got, key)
+	}
+	if got[0] == got[1] || got[0] != got[2] || got[1] != got[3] {
+		t.Errorf("keys = %v, want second-a and second-b in turn", got)
+	}
+	for _, k := range got {
+		if k != "second-a" && k != "second-b" {
+			t.Errorf("keys = %v, want only priority 2 keys with best dead", got)
+		}
+	}
+
+	km.MarkAsDead("second-a", "")
+	km.MarkAsDead("second-b", "")
+	if _, err := km.GetNextKey(); !errors.Is(err, ErrNoKeysAvailable) {
+		t.Errorf("GetNextKey() error = %v, want %v with every key dead", err, ErrNoKeysAvailable)
+	}
+}
+
+func TestKeyManager_StrategyPriorityBusy(t *testing.T) {
+	km := NewKeyManager([]string{"best", "fallback"}, 0,
+		WithStrategy(StrategyPriority),
+		WithKeyPriorities(map[string]int{"best": 1, "fallback": 2}),
+		WithMaxConcurrentPerKey(1),
+	)
+
+	first, err := km.GetNextKey()
+	if err != nil || first != "best" {
+		t.Fatalf("GetNextKey() = %s, %v, want best", first, err)
+	}
+	if key, err := km.GetNextKey(); err != nil || key != "fallback" {
+		t.Errorf("GetNextKey() = %s, %v, want fallback while best is busy", key, err)
+	}
+	km.ReleaseKey(first)
+	km.ReleaseKey("fallback")
+	if key, err := km.GetNextKey(); err != nil || key != "best" {
+		t.Errorf("GetNextKey() = %s, %v, want best once released", key, err)
+	}
+}
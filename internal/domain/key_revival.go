@@ -0,0 +1,162 @@
+package domain
+
+import (
+	"container/heap"
+	"time"
+)
+
+// RevivalStrategy defines how dead keys return to rotation once their
+// cooldown has passed.
+type RevivalStrategy string
+
+const (
+	// RevivalImmediate revives every expired key at once.
+	RevivalImmediate RevivalStrategy = "immediate"
+
+	// RevivalGradual revives at most one expired key per selection, the one
+	// that died first, so keys that died together do not all return at once.
+	RevivalGradual RevivalStrategy = "gradual"
+
+	// RevivalStaggered adds a random jitter of up to MaxRevivalJitter to each
+	// key's cooldown.
+	RevivalStaggered RevivalStrategy = "staggered"
+)
+
+// MaxRevivalJitter is the largest jitter RevivalStaggered adds to a cooldown.
+const MaxRevivalJitter = 10 * time.Second
+
+// WithRevivalStrategy sets how dead keys are revived. The default is
+// RevivalImmediate.
+func WithRevivalStrategy(s RevivalStrategy) KeyManagerOption {
+	return func(km *KeyManager) { km.revival = s }
+}
+
+// WithRevivalJitter sets the source of RevivalStaggered jitter, returning a
+// duration in [0, max), for tests.
+func WithRevivalJitter(jitter func(max time.Duration) time.Duration) KeyManagerOption {
+	return func(km *KeyManager) { km.jitter = jitter }
+}
+
+// randomJitter returns a random duration in [0, max).
+func (km *KeyManager) randomJitter(max time.Duration) time.Duration {
+	return time.Duration(km.int64N(int64(max)))
+}
+
+// deadKey is an expired dead key waiting to be revived.
+type deadKey struct {
+	key    string
+	diedAt time.Time
+}
+
+// deadKeyQueue is a min-heap of dead keys ordered by when they died, so the
+// oldest dead key is revived first.
+type deadKeyQueue []deadKey
+
+func (q deadKeyQueue) Len() int { return len(q) }
+
+func (q deadKeyQueue) Less(i, j int) bool {
+	if !q[i].diedAt.Equal(q[j].diedAt) {
+		return q[i].diedAt.Before(q[j].diedAt)
+	}
+	return q[i].key < q[j].key
+}
+
+func (q deadKeyQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *deadKeyQueue) Push(x any) { *q = append(*q, x.(deadKey)) }
+
+func (q *deadKeyQueue) Pop() any {
+	old := *q
+	k := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return k
+}
+
+// SetCooldown changes how long dead keys wait before they are revived, for
+// example to stop retrying keys during a provider maintenance window. It
+// applies to every dead key without a provider cooldown from the next
+// ReviveExpired on; 0 disables auto-revival.
+func (km *KeyManager) SetCooldown(d time.Duration) {
+	km.cooldown.Store(int64(d))
+}
+
+// GetCooldown returns how long dead keys wait before they are revived.
+func (km *KeyManager) GetCooldown() time.Duration {
+	return time.Duration(km.cooldown.Load())
+}
+
+// cooldownFor returns how long key waits once dead: the cooldown of its
+// provider when WithProviderCooldowns set one, else the cooldown. Caller
+// must hold km.mu.
+func (km *KeyManager) cooldownFor(key string) time.Duration {
+	if d, ok := km.cooldowns[km.providers[key]]; ok {
+		return d
+	}
+	return km.GetCooldown()
+}
+
+// EarliestRevivalTime returns when the first dead key is due back in
+// rotation, by its MarkAsDeadUntil deadline or its cooldown. It returns
+// false when no dead key will be revived on its own.
+func (km *KeyManager) EarliestRevivalTime() (time.Time, bool) {
+	now := km.now()
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	km.deadMu.RLock()
+	defer km.deadMu.RUnlock()
+	var earliest time.Time
+	found := false
+	for k, diedAt := range km.deadKeys {
+		if km.isExpired(k, now) {
+			continue
+		}
+		until, ok := km.deadUntil[k]
+		if !ok {
+			cooldown := km.cooldownFor(k)
+			if cooldown <= 0 {
+				continue
+			}
+			until = diedAt.Add(cooldown + km.revivalJitter[k])
+		}
+		if !found || until.Before(earliest) {
+			earliest, found = until, true
+		}
+	}
+	return earliest, found
+}
+
+// ReviveExpired returns dead keys whose cooldown or MarkAsDeadUntil deadline
+// has passed to rotation, oldest first. Under RevivalGradual at most one key
+// is revived per call. Keys past their WithKeyExpiries expiry are then taken
+// out of rotation, revived ones included.
+func (km *KeyManager) ReviveExpired() {
+	defer km.retireExpired()
+	now := time.Now()
+	var expired deadKeyQueue
+
+	km.mu.RLock()
+	km.deadMu.RLock()
+	for k, t := range km.deadKeys {
+		if until, ok := km.deadUntil[k]; ok {
+			if !now.Before(until) {
+				expired = append(expired, deadKey{key: k, diedAt: t})
+			}
+			continue
+		}
+		if cooldown := km.cooldownFor(k); cooldown > 0 && now.Sub(t) >= cooldown+km.revivalJitter[k] {
+			expired = append(expired, deadKey{key: k, diedAt: t})
+		}
+	}
+	km.deadMu.RUnlock()
+	km.mu.RUnlock()
+
+	heap.Init(&expired)
+	for expired.Len() > 0 {
+		k := heap.Pop(&expired).(deadKey)
+		km.revive(k.key, ReasonCooldownExpired)
+		if km.revival == RevivalGradual {
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+// killAll marks keys dead in order and waits for their cooldown to pass.
+func killAll(km *KeyManager, keys []string, cooldown time.Duration) {
+	for _, k := range keys {
+		km.MarkAsDead(k, "")
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(cooldown + 10*time.Millisecond)
+}
+
+func TestReviveExpired_Gradual(t *testing.T) {
+	keys := []string{"key1", "key2", "key3", "key4", "key5"}
+	cooldown := 20 * time.Millisecond
+	km := NewKeyManager(append([]string{"live"}, keys...), cooldown,
+		WithRevivalStrategy(RevivalGradual))
+	killAll(km, keys, cooldown)
+
+	for i, want := range keys {
+		if _, err := km.GetNextKey(); err != nil {
+			t.Fatalf("GetNextKey() error = %v", err)
+		}
+		if got := km.DeadKeyCount(); got != len(keys)-i-1 {
+			t.Fatalf("after call %d DeadKeyCount() = %d, want %d", i+1, got, len(keys)-i-1)
+		}
+		if km.IsKeyDead(want) {
+			t.Fatalf("after call %d %s still dead, want the oldest dead key revived first", i+1, want)
+		}
+	}
+}
+
+func TestReviveExpired_Immediate(t *testing.T) {
+	keys := []string{"key1", "key2", "key3", "key4", "key5"}
+	cooldown := 20 * time.Millisecond
+	km := NewKeyManager(append([]string{"live"}, keys...), cooldown)
+	killAll(km, keys, cooldown)
+
+	if _, err := km.GetNextKey(); err != nil {
+		t.Fatalf("GetNextKey() error = %v", err)
+	}
+	if got := km.DeadKeyCount(); got != 0 {
+		t.Errorf("DeadKeyCount() = %d, want 0", got)
+	}
+}
+
+func TestReviveExpired_Staggered(t *testing.T) {
+	cooldown := 20 * time.Millisecond
+	jitters := map[int]time.Duration{0: 0, 1: time.Hour}
+	calls := 0
+	km := NewKeyManager([]string{"key1", "key2"}, cooldown,
+		WithRevivalStrategy(RevivalStaggered),
+		WithRevivalJitter(func(max time.Duration) time.Duration {
+			if max != MaxRevivalJitter {
+				t.Errorf("jitter max = %v, want %v", max, MaxRevivalJitter)
+			}
+			j := jitters[calls]
+			calls++
+			return j
+		}),
+	)
+	killAll(km, []string{"key1", "key2"}, cooldown)
+
+	km.ReviveExpired()
+	if km.IsKeyDead("key1") {
+		t.Error("key1 still dead after its cooldown")
+	}
+	if !km.IsKeyDead("key2") {
+		t.Error("key2 revived before its cooldown plus jitter")
+	}
+}
+
+func TestKeyManager_SetCooldown(t *testing.T) {
+	km := NewKeyManager([]string{"live", "key1"}, 20*time.Millisecond)
+	km.MarkAsDead("key1", "")
+
+	// A longer cooldown keeps the already dead key out of rotation.
+	km.SetCooldown(time.Hour)
+	if got := km.GetCooldown(); got != time.Hour {
+		t.Fatalf("GetCooldown() = %v, want 1h", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	km.ReviveExpired()
+	if !km.IsKeyDead("key1") {
+		t.Fatal("key1 revived after the original cooldown, want it dead under the longer one")
+	}
+
+	// Shortening it again makes the key eligible on the next check.
+	km.SetCooldown(10 * time.Millisecond)
+	km.ReviveExpired()
+	if km.IsKeyDead("key1") {
+		t.Error("key1 still dead after the cooldown was shortened")
+	}
+}
+
+func TestKeyManager_ProviderCooldowns(t *testing.T) {
+	km := NewKeyManager([]string{"google-key", "openai-key", "other-key"}, 20*time.Millisecond,
+		WithKeyProviders(map[string]ProviderType{"google-key": ProviderGoogle, "openai-key": ProviderOpenAI}),
+		WithProviderCooldowns(map[ProviderType]time.Duration{ProviderOpenAI: 10 * time.Minute}),
+	)
+	for _, k := range []string{"google-key", "openai-key", "other-key"} {
+		km.MarkAsDead(k, "")
+	}
+
+	if s, _ := km.GetKeyState("openai-key"); s.CooldownRemainingSeconds < 599 || s.CooldownRemainingSeconds > 600 {
+		t.Errorf("openai-key CooldownRemainingSeconds = %d, want 600", s.CooldownRemainingSeconds)
+	}
+	if s, _ := km.GetKeyState("google-key"); s.CooldownRemainingSeconds != 1 {
+		t.Errorf("google-key CooldownRemainingSeconds = %d, want 1 under the default cooldown", s.CooldownRemainingSeconds)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	km.ReviveExpired()
+	if km.IsKeyDead("google-key") || km.IsKeyDead("other-key") {
+		t.Error("keys without a provider cooldown still dead after the default cooldown")
+	}
+	if !km.IsKeyDead("openai-key") {
+		t.Error("openai-key revived after the default cooldown, want it dead for 10m")
+	}
+}
+
+func TestEarliestRevivalTime(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2", "key3"}, time.Hour)
+	if _, ok := km.EarliestRevivalTime(); ok {
+		t.Error("EarliestRevivalTime() ok = true without dead keys, want false")
+	}
+
+	soon := time.Now().Add(5 * time.Minute)
+	before := time.Now()
+	km.MarkAsDead("key1", "")
+	km.MarkAsDeadUntil("key2", soon)
+	km.MarkAsDeadUntil("key3", soon.Add(time.Minute))
+	got, ok := km.EarliestRevivalTime()
+	if !ok || !got.Equal(soon) {
+		t.Errorf("EarliestRevivalTime() = %v, %v, want the deadline %v", got, ok, soon)
+	}
+
+	// Without deadlines the cooldown decides.
+	km.ReviveKey("key2")
+	km.ReviveKey("key3")
+	got, ok = km.EarliestRevivalTime()
+	if !ok || got.Before(before.Add(time.Hour)) || got.After(time.Now().Add(time.Hour)) {
+		t.Errorf("EarliestRevivalTime() = %v, %v, want an hour after key1 died", got, ok)
+	}
+}
@@ -0,0 +1,219 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrNoStatePath is returned by ForceStateSave when the KeyManager has no
+// state path.
+var ErrNoStatePath = errors.New("no state path configured")
+
+// ErrStateExpired is returned by ReadStateFile for a state file older than
+// the allowed age.
+var ErrStateExpired = errors.New("state file expired")
+
+// KeyStats is the usage state of a single key kept in a snapshot.
+type KeyStats struct {
+	// Usage is the key's usage EWMA, between 0 and 1.
+	Usage float64 `json:"usage"`
+
+	// AddedAt is when the key joined the pool. Restoring a snapshot keeps
+	// it, so key ages survive restarts.
+	AddedAt time.Time `json:"added_at"`
+}
+
+// AgeSeconds returns how many seconds ago the key joined the pool.
+func (s KeyStats) AgeSeconds() int64 {
+	return int64(time.Since(s.AddedAt) / time.Second)
+}
+
+// KeyPoolSnapshot is the serializable state of a KeyManager, used to carry
+// dead keys and usage over to a new instance during a rolling deployment.
+// It holds raw keys and must be stored like any other secret.
+type KeyPoolSnapshot struct {
+	// CreatedAt is when the snapshot was taken.
+	CreatedAt time.Time `json:"created_at"`
+
+	// ActiveKeys lists the keys in rotation, in rotation order.
+	ActiveKeys []string `json:"active_keys"`
+
+	// DeadKeys maps dead keys to when they were marked dead.
+	DeadKeys map[string]time.Time `json:"dead_keys"`
+
+	// DeadUntil holds the revival deadline of keys marked dead with
+	// MarkAsDeadUntil. Other dead keys revive after the cooldown.
+	DeadUntil map[string]time.Time `json:"dead_until,omitempty"`
+
+	// UsageStats maps every key to its usage state.
+	UsageStats map[string]KeyStats `json:"usage_stats"`
+}
+
+// Snapshot returns the current key pool state.
+func (km *KeyManager) Snapshot() KeyPoolSnapshot {
+	s := KeyPoolSnapshot{
+		CreatedAt:  time.Now().UTC(),
+		ActiveKeys: km.GetActiveKeys(),
+		DeadKeys:   make(map[string]time.Time),
+		DeadUntil:  make(map[string]time.Time),
+		UsageStats: make(map[string]KeyStats),
+	}
+
+	km.deadMu.RLock()
+	for k, t := range km.deadKeys {
+		s.DeadKeys[k] = t
+	}
+	for k, t := range km.deadUntil {
+		s.DeadUntil[k] = t
+	}
+	km.deadMu.RUnlock()
+
+	km.mu.RLock()
+	km.usageMu.RLock()
+	for k := range km.originalKeys {
+		s.UsageStats[k] = KeyStats{Usage: km.ewmaUsage[k], AddedAt: km.addedAt[k]}
+	}
+	km.usageMu.RUnlock()
+	km.mu.RUnlock()
+
+	return s
+}
+
+// NewKeyManagerFromSnapshot returns a KeyManager managing the keys of s, with
+// its dead keys and usage restored. Dead keys revive at the same time they
+// would have in the instance that took the snapshot.
+func NewKeyManagerFromSnapshot(s KeyPoolSnapshot, cooldown time.Duration, opts ...KeyManagerOption) *KeyManager {
+	dead := make([]string, 0, len(s.DeadKeys))
+	for k := range s.DeadKeys {
+		dead = append(dead, k)
+	}
+	sort.Strings(dead)
+
+	km := NewKeyManager(append(append([]string{}, s.ActiveKeys...), dead...), cooldown, opts...)
+	km.Restore(s)
+	return km
+}
+
+// Restore applies the dead keys and usage of s to the keys km manages and
+// returns how many keys it marked dead. Keys km does not manage are ignored,
+// so a snapshot stays usable after keys are added to or removed from the
+// config. No key events are emitted for restored keys.
+func (km *KeyManager) Restore(s KeyPoolSnapshot) int {
+	restored := 0
+
+	km.mu.Lock()
+	km.deadMu.Lock()
+	for k, t := range s.DeadKeys {
+		if _, ok := km.originalKeys[k]; !ok {
+			continue
+		}
+		km.deadKeys[k] = t
+		if until, ok := s.DeadUntil[k]; ok {
+			km.deadUntil[k] = until
+		} else {
+			delete(km.deadUntil, k)
+		}
+		restored++
+	}
+
+	filtered := km.keys[:0]
+	for _, k := range km.keys {
+		if _, dead := km.deadKeys[k]; dead {
+			km.removeFromPartition(k)
+			continue
+		}
+		filtered = append(filtered, k)
+	}
+	km.keys = filtered
+	km.deadMu.Unlock()
+
+	km.usageMu.Lock()
+	for k, st := range s.UsageStats {
+		if _, ok := km.originalKeys[k]; ok {
+			km.ewmaUsage[k] = st.Usage
+			if !st.AddedAt.IsZero() {
+				km.addedAt[k] = st.AddedAt
+			}
+		}
+	}
+	km.usageMu.Unlock()
+	km.mu.Unlock()
+
+	return restored
+}
+
+// WriteSnapshotFile writes s to path as JSON. The file is replaced atomically
+// and readable only by its owner.
+func WriteSnapshotFile(path string, s KeyPoolSnapshot) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadSnapshotFile reads a snapshot written by WriteSnapshotFile.
+func ReadSnapshotFile(path string) (KeyPoolSnapshot, error) {
+	var s KeyPoolSnapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+// SaveState writes the current key pool state to path, replacing the file
+// atomically.
+func (km *KeyManager) SaveState(path string) error {
+	return WriteSnapshotFile(path, km.Snapshot())
+}
+
+// StatePath returns the file ForceStateSave writes to, empty when unset.
+func (km *KeyManager) StatePath() string {
+	return km.statePath
+}
+
+// ForceStateSave writes the current key pool state to the state path set
+// with WithStatePath and returns what it wrote.
+func (km *KeyManager) ForceStateSave() (KeyPoolSnapshot, error) {
+	if km.statePath == "" {
+		return KeyPoolSnapshot{}, ErrNoStatePath
+	}
+	s := km.Snapshot()
+	return s, WriteSnapshotFile(km.statePath, s)
+}
+
+// ReadStateFile reads a state file written by SaveState. It returns
+// ErrStateExpired when the state was saved more than maxAge ago, so dead keys
+// from a long stopped instance are not restored. A maxAge of zero accepts
+// any age.
+func ReadStateFile(path string, maxAge time.Duration) (KeyPoolSnapshot, error) {
+	s, err := ReadSnapshotFile(path)
+	if err != nil {
+		return s, err
+	}
+	if age := time.Since(s.CreatedAt); maxAge > 0 && age > maxAge {
+		return s, fmt.Errorf("%w: saved %s ago", ErrStateExpired, age.Round(time.Second))
+	}
+	return s, nil
+}
@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyManager_SnapshotRestore(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2", "key3", "key4"}, time.Hour)
+	km.RecordSuccess("key1")
+	km.MarkAsDead("key2", "")
+	until := time.Now().Add(30 * time.Minute).UTC()
+	km.MarkAsDeadUntil("key3", until)
+	diedAt := km.GetDeadKeys()["key2"]
+
+	s := km.Snapshot()
+
+	// Changes after the snapshot must not leak into it.
+	km.ReviveKey("key2")
+	km.MarkAsDead("key4", "")
+	if _, ok := s.DeadKeys["key4"]; ok {
+		t.Fatal("snapshot shares state with the key manager")
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded KeyPoolSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	restored := NewKeyManagerFromSnapshot(decoded, time.Hour)
+
+	if got := restored.TotalKeyCount(); got != 4 {
+		t.Errorf("TotalKeyCount() = %d, want 4", got)
+	}
+	dead := restored.GetDeadKeys()
+	if len(dead) != 2 {
+		t.Fatalf("dead keys = %v, want key2 and key3", dead)
+	}
+	if !dead["key2"].Equal(diedAt) {
+		t.Errorf("key2 died at %v, want %v so it revives on the original schedule", dead["key2"], diedAt)
+	}
+	if !restored.deadUntil["key3"].Equal(until) {
+		t.Errorf("key3 dead until %v, want %v", restored.deadUntil["key3"], until)
+	}
+	for i := 0; i < 4; i++ {
+		key, err := restored.GetNextKey()
+		if err != nil {
+			t.Fatalf("GetNextKey() error = %v", err)
+		}
+		if key == "key2" || key == "key3" {
+			t.Errorf("GetNextKey() = %s, a restored dead key", key)
+		}
+	}
+	if got, want := restored.Usage("key1"), km.Usage("key1"); got != want {
+		t.Errorf("Usage(key1) = %v, want %v", got, want)
+	}
+}
+
+func TestKeyManager_RestoreRevivesExpiredKeys(t *testing.T) {
+	s := KeyPoolSnapshot{
+		ActiveKeys: []string{"key1"},
+		DeadKeys:   map[string]time.Time{"key2": time.Now().Add(-2 * time.Minute)},
+	}
+	km := NewKeyManagerFromSnapshot(s, time.Minute)
+
+	km.ReviveExpired()
+	if km.IsKeyDead("key2") {
+		t.Error("key2 still dead after its cooldown passed")
+	}
+}
+
+func TestKeyManager_RestoreIgnoresUnknownKeys(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, time.Hour)
+	s := KeyPoolSnapshot{
+		DeadKeys: map[string]time.Time{
+			"key2":    time.Now(),
+			"removed": time.Now(),
+		},
+		UsageStats: map[string]KeyStats{"removed": {Usage: 0.5}},
+	}
+
+	if got := km.Restore(s); got != 1 {
+		t.Errorf("Restore() = %d, want 1", got)
+	}
+	if got := km.GetActiveKeys(); len(got) != 1 || got[0] != "key1" {
+		t.Errorf("GetActiveKeys() = %v, want [key1]", got)
+	}
+	if km.IsKeyDead("removed") || km.Usage("removed") != 0 {
+		t.Error("Restore() added a key the manager does not manage")
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	km := NewKeyManager([]string{"key1", "key2"}, time.Hour)
+	km.MarkAsDead("key1", "")
+
+	if err := WriteSnapshotFile(path, km.Snapshot()); err != nil {
+		t.Fatalf("WriteSnapshotFile() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("file mode = %o, want 600", perm)
+	}
+
+	s, err := ReadSnapshotFile(path)
+	if err != nil {
+		t.Fatalf("ReadSnapshotFile() error = %v", err)
+	}
+	if _, ok := s.DeadKeys["key1"]; !ok || len(s.ActiveKeys) != 1 {
+		t.Errorf("snapshot = %+v, want key1 dead and key2 active", s)
+	}
+}
+
+func TestKeyManager_SaveStateSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	km := NewKeyManager([]string{"key1", "key2"}, time.Minute, WithStatePath(path))
+	until := time.Now().Add(time.Hour).UTC()
+	km.MarkAsDeadUntil("key2", until)
+
+	if _, err := km.ForceStateSave(); err != nil {
+		t.Fatalf("ForceStateSave() error = %v", err)
+	}
+	s, err := ReadStateFile(path, time.Hour)
+	if err != nil {
+		t.Fatalf("ReadStateFile() error = %v", err)
+	}
+	if !s.DeadUntil["key2"].Equal(until) {
+		t.Errorf("saved key2 dead until %v, want %v", s.DeadUntil["key2"], until)
+	}
+
+	// The restarted manager is past key2's cooldown but not its revival time.
+	restarted := NewKeyManagerFromSnapshot(s, time.Nanosecond)
+	restarted.ReviveExpired()
+	if !restarted.IsKeyDead("key2") {
+		t.Error("key2 revived after restart, want it dead until its revival time")
+	}
+	for i := 0; i < 2; i++ {
+		if key, err := restarted.GetNextKey(); err != nil || key != "key1" {
+			t.Errorf("GetNextKey() = %s, %v, want key1", key, err)
+		}
+	}
+}
+
+func TestReadStateFile_MaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s := NewKeyManager([]string{"key1"}, time.Hour).Snapshot()
+	s.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := WriteSnapshotFile(path, s); err != nil {
+		t.Fatalf("WriteSnapshotFile() error = %v", err)
+	}
+
+	tests := []struct {
+		maxAge  time.Duration
+		wantErr error
+	}{
+		{time.Hour, ErrStateExpired},
+		{3 * time.Hour, nil},
+		{0, nil},
+	}
+	for _, tt := range tests {
+		if _, err := ReadStateFile(path, tt.maxAge); !errors.Is(err, tt.wantErr) {
+			t.Errorf("ReadStateFile(%v) error = %v, want %v", tt.maxAge, err, tt.wantErr)
+		}
+	}
+}
+
+func TestKeyManager_ForceStateSaveWithoutPath(t *testing.T) {
+	km := NewKeyManager([]string{"key1"}, time.Hour)
+	if _, err := km.ForceStateSave(); !errors.Is(err, ErrNoStatePath) {
+		t.Errorf("ForceStateSave() error = %v, want %v", err, ErrNoStatePath)
+	}
+}
@@ -0,0 +1,230 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// Key statuses reported in KeyState.
+const (
+	// KeyStatusActive is a key in rotation.
+	KeyStatusActive = "active"
+
+	// KeyStatusDead is a key out of rotation whose cooldown or
+	// MarkAsDeadUntil deadline has not passed, or that waits for ReviveKey.
+	KeyStatusDead = "dead"
+
+	// KeyStatusHalfOpen is a dead key whose cooldown has passed; the next
+	// selection or ReviveExpired returns it to rotation.
+	KeyStatusHalfOpen = "half_open"
+
+	// KeyStatusDraining is a key DrainAndRemove is taking out of the pool.
+	KeyStatusDraining = "draining"
+
+	// KeyStatusOverQuota is a key in rotation that selection skips because
+	// it is over its quota or tokens-per-minute limit.
+	KeyStatusOverQuota = "over_quota"
+
+	// KeyStatusExpired is a key past its expiry. It never returns to
+	// rotation.
+	KeyStatusExpired = "expired"
+
+	// KeyStatusPaused is a key PauseKey took out of rotation until
+	// ResumeKey.
+	KeyStatusPaused = "paused"
+)
+
+// KeyState is the full state of a managed key, for debugging.
+type KeyState struct {
+	// Key is the raw key; mask it before showing it.
+	Key  string `json:"key"`
+	Name string `json:"name,omitempty"`
+
+	// Status is one of the KeyStatus values.
+	Status string `json:"status"`
+
+	AddedAt time.Time `json:"added_at"`
+
+	// LastUsedAt is when the key last served a request, nil if never.
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	// DeathCount is how many times the key was marked dead.
+	DeathCount int `json:"death_count"`
+
+	// ErrorCount is how many requests on the key failed, as reported
+	// through HandleError.
+	ErrorCount int `json:"error_count"`
+
+	// DeadSince is when a dead or half-open key was marked dead, nil for
+	// keys in rotation.
+	DeadSince *time.Time `json:"dead_since,omitempty"`
+
+	// EWMA is the key's usage EWMA, between 0 and 1.
+	EWMA float64 `json:"ewma"`
+
+	// CooldownRemainingSeconds is how long a dead key stays out of
+	// rotation, rounded up; 0 for other statuses and keys dead until
+	// ReviveKey.
+	CooldownRemainingSeconds int64 `json:"cooldown_remaining_seconds"`
+
+	// LastErrorMessage is the redacted reason the key was last marked dead.
+	LastErrorMessage string `json:"last_error_message,omitempty"`
+
+	// ExpiresAt is when the key stops or stopped being valid, nil if it
+	// never expires.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// GetKeyState returns the state of key, or false for keys km does not
+// manage.
+func (km *KeyManager) GetKeyState(key string) (KeyState, bool) {
+	km.mu.RLock()
+	km.deadMu.RLock()
+	_, ok := km.originalKeys[key]
+	var s KeyState
+	if ok {
+		s = km.keyStateLocked(key)
+	}
+	km.deadMu.RUnlock()
+	km.mu.RUnlock()
+	if !ok {
+		return KeyState{}, false
+	}
+
+	km.addUsageState(&s)
+	return s, true
+}
+
+// GetAllKeyStates returns the state of every managed key from one
+// consistent snapshot: mu and deadMu are held together, in the order
+// markDead and revive take them, so no key dies or is revived between
+// reading the active and the dead keys. Keys in rotation come first, in
+// rotation order, then the others, longest dead first.
+func (km *KeyManager) GetAllKeyStates() []KeyState {
+	km.mu.RLock()
+	km.deadMu.RLock()
+	states := make([]KeyState, 0, len(km.originalKeys))
+	active := make(map[string]struct{}, len(km.keys))
+	for _, k := range km.keys {
+		active[k] = struct{}{}
+		states = append(states, km.keyStateLocked(k))
+	}
+	rest := len(states)
+	for k := range km.originalKeys {
+		if _, ok := active[k]; !ok {
+			states = append(states, km.keyStateLocked(k))
+		}
+	}
+	km.deadMu.RUnlock()
+	km.mu.RUnlock()
+
+	others := states[rest:]
+	sort.Slice(others, func(i, j int) bool {
+		a, b := others[i].DeadSince, others[j].DeadSince
+		switch {
+		case a != nil && b != nil && !a.Equal(*b):
+			return a.Before(*b)
+		case (a == nil) != (b == nil):
+			return a != nil
+		}
+		return others[i].Key < others[j].Key
+	})
+	for i := range states {
+		km.addUsageState(&states[i])
+	}
+	return states
+}
+
+// keyStateLocked returns the state of key without its usage. km.mu and
+// km.deadMu must be held.
+func (km *KeyManager) keyStateLocked(key string) KeyState {
+	s := KeyState{
+		Key:              key,
+		Name:             km.names[key],
+		Status:           KeyStatusActive,
+		AddedAt:          km.addedAt[key],
+		DeathCount:       km.deathCount[key],
+		LastErrorMessage: km.lastError[key],
+	}
+	diedAt, dead := km.deadKeys[key]
+	if dead {
+		s.DeadSince = &diedAt
+	}
+	if t, ok := km.expiresAt[key]; ok {
+		s.ExpiresAt = &t
+	}
+
+	switch {
+	case km.isDraining(key):
+		s.Status = KeyStatusDraining
+	case km.isExpired(key, km.now()):
+		s.Status = KeyStatusExpired
+	case km.isPausedLocked(key):
+		s.Status = KeyStatusPaused
+	case dead:
+		s.Status = KeyStatusDead
+		until, hasUntil := km.deadUntil[key]
+		if !hasUntil {
+			cooldown := km.cooldownFor(key)
+			if cooldown <= 0 {
+				break
+			}
+			until = diedAt.Add(cooldown + km.revivalJitter[key])
+		}
+		remaining := time.Until(until)
+		if remaining <= 0 {
+			s.Status = KeyStatusHalfOpen
+			break
+		}
+		s.CooldownRemainingSeconds = int64((remaining + time.Second - 1) / time.Second)
+	}
+	return s
+}
+
+// addUsageState sets the usage of s.Key on s and marks an active key over
+// its quota or tokens-per-minute limit as over quota.
+func (km *KeyManager) addUsageState(s *KeyState) {
+	km.usageMu.RLock()
+	s.EWMA = km.ewmaUsage[s.Key]
+	s.ErrorCount = km.errorCount[s.Key]
+	if t, used := km.lastUsed[s.Key]; used {
+		s.LastUsedAt = &t
+	}
+	km.usageMu.RUnlock()
+
+	if s.Status == KeyStatusActive && (km.IsOverQuota(s.Key) || km.IsOverTokenRate(s.Key)) {
+		s.Status = KeyStatusOverQuota
+	}
+}
+
+// CountKeyStates returns how many of states are in rotation, over-quota
+// keys included, and how many are dead or half-open. Draining and paused
+// keys count as neither.
+func CountKeyStates(states []KeyState) (active, dead int) {
+	for _, s := range states {
+		switch s.Status {
+		case KeyStatusActive, KeyStatusOverQuota:
+			active++
+		case KeyStatusDead, KeyStatusHalfOpen:
+			dead++
+		}
+	}
+	return active, dead
+}
+
+// GetKeyStates returns the state of every managed key, sorted by status,
+// then name, then key.
+func (km *KeyManager) GetKeyStates() []KeyState {
+	states := km.GetAllKeyStates()
+	sort.Slice(states, func(i, j int) bool {
+		a, b := states[i], states[j]
+		if a.Status != b.Status {
+			return a.Status < b.Status
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Key < b.Key
+	})
+	return states
+}
@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyManager_GetKeyState_Transitions(t *testing.T) {
+	const key = "AIzaSyStateKey0000000000000000000001"
+	cooldown := 30 * time.Millisecond
+	km := NewKeyManager([]string{key, "other"}, cooldown,
+		WithKeyNames(map[string]string{key: "primary"}))
+
+	state := func(want string) KeyState {
+		t.Helper()
+		s, ok := km.GetKeyState(key)
+		if !ok {
+			t.Fatalf("GetKeyState(%s) ok = false", key)
+		}
+		if s.Status != want {
+			t.Fatalf("Status = %q, want %q (%+v)", s.Status, want, s)
+		}
+		return s
+	}
+
+	s := state(KeyStatusActive)
+	if s.Name != "primary" || s.AddedAt.IsZero() || s.LastUsedAt != nil || s.DeathCount != 0 {
+		t.Errorf("initial state = %+v, want named, added, never used or dead", s)
+	}
+	km.RecordSuccess(key)
+	if s = state(KeyStatusActive); s.LastUsedAt == nil || s.EWMA <= 0 {
+		t.Errorf("after use LastUsedAt = %v, EWMA = %v, want both set", s.LastUsedAt, s.EWMA)
+	}
+
+	km.MarkAsDead(key, "upstream rejected key="+key)
+	s = state(KeyStatusDead)
+	if s.DeathCount != 1 || s.CooldownRemainingSeconds != 1 {
+		t.Errorf("dead DeathCount = %d, CooldownRemainingSeconds = %d, want 1 and 1", s.DeathCount, s.CooldownRemainingSeconds)
+	}
+	if strings.Contains(s.LastErrorMessage, key) || !strings.HasPrefix(s.LastErrorMessage, "upstream rejected") {
+		t.Errorf("LastErrorMessage = %q, want the reason with the key redacted", s.LastErrorMessage)
+	}
+
+	time.Sleep(cooldown + 10*time.Millisecond)
+	if s = state(KeyStatusHalfOpen); s.CooldownRemainingSeconds != 0 {
+		t.Errorf("half-open CooldownRemainingSeconds = %d, want 0", s.CooldownRemainingSeconds)
+	}
+
+	km.ReviveExpired()
+	s = state(KeyStatusActive)
+	if s.DeathCount != 1 || s.LastErrorMessage == "" {
+		t.Errorf("revived state = %+v, want the death count and last error kept", s)
+	}
+
+	if _, ok := km.GetKeyState("missing"); ok {
+		t.Error("GetKeyState(missing) ok = true, want false")
+	}
+}
+
+func TestKeyManager_GetKeyState_DeadUntilRevived(t *testing.T) {
+	km := NewKeyManager([]string{"key1"}, 0)
+	km.MarkAsDead("key1", "")
+
+	s, _ := km.GetKeyState("key1")
+	if s.Status != KeyStatusDead || s.CooldownRemainingSeconds != 0 || s.LastErrorMessage != "" {
+		t.Errorf("state = %+v, want dead without cooldown or error", s)
+	}
+}
+
+func TestKeyManager_GetKeyState_Draining(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithMaxConcurrentPerKey(1))
+	if !km.AcquireKey("key1") {
+		t.Fatal("AcquireKey(key1) = false")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan error, 1)
+	go func() { drained <- km.DrainAndRemove(ctx, "key1") }()
+	for !km.isDraining("key1") {
+		time.Sleep(time.Millisecond)
+	}
+
+	if s, _ := km.GetKeyState("key1"); s.Status != KeyStatusDraining {
+		t.Errorf("Status = %q, want %q", s.Status, KeyStatusDraining)
+	}
+	cancel()
+	<-drained
+}
+
+func TestKeyManager_GetKeyStates(t *testing.T) {
+	km := NewKeyManager([]string{"k1", "k2", "k3", "k4"}, time.Hour, WithKeyNames(map[string]string{
+		"k1": "delta", "k2": "alpha", "k3": "charlie", "k4": "bravo",
+	}))
+	km.MarkAsDead("k1", "")
+	km.MarkAsDead("k2", "")
+
+	var got []string
+	for _, s := range km.GetKeyStates() {
+		got = append(got, s.Status+"/"+s.Name)
+	}
+	want := "active/bravo active/charlie dead/alpha dead/delta"
+	if strings.Join(got, " ") != want {
+		t.Errorf("GetKeyStates() = %v, want %s", got, want)
+	}
+}
+
+func TestKeyManager_GetAllKeyStates(t *testing.T) {
+	km := NewKeyManager([]string{"k1", "k2", "k3"}, time.Hour)
+	km.MarkAsDead("k3", "")
+	km.MarkAsDead("k1", "")
+
+	var got []string
+	for _, s := range km.GetAllKeyStates() {
+		got = append(got, s.Key+"/"+s.Status)
+		if dead := s.Status == KeyStatusDead; dead != (s.DeadSince != nil) {
+			t.Errorf("%s DeadSince = %v with status %q", s.Key, s.DeadSince, s.Status)
+		}
+	}
+	want := "k2/active k3/dead k1/dead"
+	if strings.Join(got, " ") != want {
+		t.Errorf("GetAllKeyStates() = %v, want %s", got, want)
+	}
+}
+
+func TestKeyManager_GetAllKeyStates_Consistent(t *testing.T) {
+	keys := []string{"k1", "k2", "k3", "k4", "k5", "k6"}
+	km := NewKeyManager(keys, time.Hour)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			k := keys[i%len(keys)]
+			km.MarkAsDead(k, "")
+			km.ReviveKey(k)
+		}
+	}()
+
+	for i := 0; i < 2000; i++ {
+		states := km.GetAllKeyStates()
+		active, dead := CountKeyStates(states)
+		if len(states) != len(keys) || active+dead != len(states) {
+			t.Fatalf("snapshot %d: %d active + %d dead, %d total, want %d", i, active, dead, len(states), len(keys))
+		}
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownStrategy is returned by SetStrategy for a strategy that is not
+// one of the RotationStrategy constants.
+var ErrUnknownStrategy = errors.New("unknown rotation strategy")
+
+// SetStrategy switches how keys are selected, for example from round-robin
+// to weighted during a canary deployment, without a restart. Selections
+// already under way finish with the previous strategy. Switching to
+// StrategyLeastUsed clears the usage EWMA, so usage under the previous
+// strategy does not steer the new one. Setting the current strategy does
+// nothing.
+//
+// It returns ErrUnknownStrategy for an unknown strategy.
+func (km *KeyManager) SetStrategy(strategy RotationStrategy) error {
+	switch strategy {
+	case StrategyRoundRobin, StrategyRandom, StrategyWeighted, StrategyLeastUsed, StrategyPriority:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownStrategy, strategy)
+	}
+
+	previous := km.strategy.Swap(strategy).(RotationStrategy)
+	if previous == strategy {
+		return nil
+	}
+	if strategy == StrategyLeastUsed {
+		km.usageMu.Lock()
+		for k := range km.ewmaUsage {
+			km.ewmaUsage[k] = 0
+		}
+		km.usageMu.Unlock()
+	}
+	return nil
+}
+
+// GetStrategy returns how keys are selected.
+func (km *KeyManager) GetStrategy() RotationStrategy {
+	return km.strategy.Load().(RotationStrategy)
+}
@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestKeyManager_SetStrategy(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "best", "key3"}, 0,
+		WithKeyPriorities(map[string]int{"best": 1, "key1": 2, "key3": 2}),
+	)
+	if got := km.GetStrategy(); got != StrategyRoundRobin {
+		t.Fatalf("GetStrategy() = %q, want %q", got, StrategyRoundRobin)
+	}
+
+	// Requests keep selecting keys while the strategy changes under them.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key, err := km.GetNextKey()
+				if err != nil {
+					t.Errorf("GetNextKey() error = %v", err)
+					return
+				}
+				km.RecordSuccess(key)
+			}
+		}()
+	}
+	for _, s := range []RotationStrategy{StrategyLeastUsed, StrategyWeighted, StrategyRandom, StrategyPriority} {
+		if err := km.SetStrategy(s); err != nil {
+			t.Fatalf("SetStrategy(%q) error = %v", s, err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if got := km.GetStrategy(); got != StrategyPriority {
+		t.Errorf("GetStrategy() = %q, want %q", got, StrategyPriority)
+	}
+	for range 5 {
+		if key, err := km.GetNextKey(); err != nil || key != "best" {
+			t.Fatalf("GetNextKey() = %s, %v, want best under the priority strategy", key, err)
+		}
+	}
+
+	// Back to round-robin, every key takes its turn again.
+	if err := km.SetStrategy(StrategyRoundRobin); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for range 3 {
+		key, _ := km.GetNextKey()
+		seen[key] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("keys = %v, want all three under round-robin", seen)
+	}
+}
+
+func TestKeyManager_SetStrategy_LeastUsedResetsUsage(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, 0)
+	for range 5 {
+		km.RecordSuccess("key1")
+	}
+
+	if err := km.SetStrategy(StrategyLeastUsed); err != nil {
+		t.Fatal(err)
+	}
+	if u := km.Usage("key1"); u != 0 {
+		t.Errorf("Usage(key1) = %v after switching to least-used, want 0", u)
+	}
+
+	// Staying on least-used keeps the usage gathered under it.
+	km.RecordSuccess("key1")
+	if err := km.SetStrategy(StrategyLeastUsed); err != nil {
+		t.Fatal(err)
+	}
+	if km.Usage("key1") == 0 {
+		t.Error("Usage(key1) cleared by setting the current strategy")
+	}
+	if key, _ := km.GetNextKey(); key != "key2" {
+		t.Errorf("GetNextKey() = %s, want the less used key2", key)
+	}
+}
+
+func TestKeyManager_SetStrategy_Unknown(t *testing.T) {
+	km := NewKeyManager([]string{"key1"}, 0, WithStrategy(StrategyLeastUsed))
+
+	for _, s := range []RotationStrategy{"", "fastest"} {
+		if err := km.SetStrategy(s); !errors.Is(err, ErrUnknownStrategy) {
+			t.Errorf("SetStrategy(%q) error = %v, want ErrUnknownStrategy", s, err)
+		}
+	}
+	if got := km.GetStrategy(); got != StrategyLeastUsed {
+		t.Errorf("GetStrategy() = %q after a rejected change, want %q", got, StrategyLeastUsed)
+	}
+}
@@ -0,0 +1,40 @@
+package domain
+
+// WithKeyWeights sets the weight of keys for StrategyWeighted, keyed by the
+// key itself. Keys missing from the map, including keys added at runtime,
+// and keys with a non-positive weight have weight 1.
+func WithKeyWeights(weights map[string]int) KeyManagerOption {
+	return func(km *KeyManager) {
+		for k, w := range weights {
+			if w > 0 {
+				km.weights[k] = w
+			}
+		}
+	}
+}
+
+// weight returns the StrategyWeighted weight of key. Caller must hold km.mu.
+func (km *KeyManager) weight(key string) int {
+	if w, ok := km.weights[key]; ok {
+		return w
+	}
+	return 1
+}
+
+// weightedStart returns the index of keys to try first under
+// StrategyWeighted, drawn at random in proportion to the weights. Caller
+// must hold km.mu.
+func (km *KeyManager) weightedStart(keys []string) int {
+	total := 0
+	for _, k := range keys {
+		total += km.weight(k)
+	}
+	n := km.intN(total)
+	for i, k := range keys {
+		n -= km.weight(k)
+		if n < 0 {
+			return i
+		}
+	}
+	return len(keys) - 1
+}
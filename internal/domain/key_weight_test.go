@@ -0,0 +1,46 @@
+package domain
+
+import "testing"
+
+func TestKeyManager_StrategyWeighted(t *testing.T) {
+	km := NewKeyManager([]string{"light", "heavy", "unweighted"}, 0,
+		WithStrategy(StrategyWeighted),
+		WithKeyWeights(map[string]int{"light": 1, "heavy": 6, "unweighted": 0}),
+	)
+	km.intN = seededRand()
+
+	const n = 8000
+	counts := make(map[string]int)
+	for range n {
+		key, err := km.GetNextKey()
+		if err != nil {
+			t.Fatalf("GetNextKey() error = %v", err)
+		}
+		km.ReleaseKey(key)
+		counts[key]++
+	}
+
+	// heavy has 6 of 8 shares; light and the unweighted key 1 each.
+	for key, want := range map[string]int{"heavy": n * 6 / 8, "light": n / 8, "unweighted": n / 8} {
+		if got := counts[key]; got < want*9/10 || got > want*11/10 {
+			t.Errorf("%s selected %d times, want about %d", key, got, want)
+		}
+	}
+}
+
+func TestKeyManager_StrategyWeightedBusy(t *testing.T) {
+	km := NewKeyManager([]string{"heavy", "light"}, 0,
+		WithStrategy(StrategyWeighted),
+		WithKeyWeights(map[string]int{"heavy": 1000}),
+		WithMaxConcurrentPerKey(1),
+	)
+	km.intN = seededRand()
+
+	first, err := km.GetNextKey()
+	if err != nil || first != "heavy" {
+		t.Fatalf("GetNextKey() = %s, %v, want heavy", first, err)
+	}
+	if key, err := km.GetNextKey(); err != nil || key != "light" {
+		t.Errorf("GetNextKey() = %s, %v, want light while heavy is busy", key, err)
+	}
+}
@@ -2,6 +2,7 @@
 package domain
 
 import (
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -21,6 +22,10 @@ const (
 
 	// StrategyLeastUsed selects the key with the fewest recent uses.
 	StrategyLeastUsed RotationStrategy = "least-used"
+
+	// StrategyPriority selects the active key with the lowest Priority,
+	// rotating round-robin among keys of equal priority.
+	StrategyPriority RotationStrategy = "priority"
 )
 
 // APIKey represents a single API key with its metadata.
@@ -37,12 +42,39 @@ type APIKey struct {
 	// Weight is used for weighted rotation strategy (higher = more likely to be selected).
 	Weight int `json:"weight" mapstructure:"weight"`
 
+	// Priority orders keys for the priority rotation strategy (lower = tried first, 0 = highest).
+	Priority int `json:"priority" mapstructure:"priority"`
+
 	// Enabled indicates whether this key is active.
 	Enabled bool `json:"enabled" mapstructure:"enabled"`
 
 	// RateLimitPerMinute overrides the provider's rate limit for this specific key.
 	RateLimitPerMinute int `json:"rate_limit_per_minute" mapstructure:"rate_limit_per_minute"`
 
+	// DailyTokenLimit caps the tokens this key may use per UTC day; 0 is unlimited.
+	DailyTokenLimit int64 `json:"daily_token_limit" mapstructure:"daily_token_limit"`
+
+	// MonthlyTokenLimit caps the tokens this key may use per UTC month; 0 is unlimited.
+	MonthlyTokenLimit int64 `json:"monthly_token_limit" mapstructure:"monthly_token_limit"`
+
+	// TokensPerMinute caps the tokens this key may use in any 60 seconds; 0 is unlimited.
+	TokensPerMinute int64 `json:"tokens_per_minute" mapstructure:"tokens_per_minute"`
+
+	// Tags label this key for routing rules, such as "premium".
+	Tags []string `json:"tags" mapstructure:"tags"`
+
+	// Region names the regional endpoint this key is served from, such as
+	// "europe-west1".
+	Region string `json:"region" mapstructure:"region"`
+
+	// BaseURL overrides the provider's base URL for this key, pointing it
+	// at a regional endpoint.
+	BaseURL string `json:"base_url" mapstructure:"base_url"`
+
+	// ExpiresAt is when this key stops being valid, such as the end of a
+	// trial; nil never expires.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" mapstructure:"expires_at"`
+
 	// UsageCount tracks how many times this key has been used (runtime only).
 	UsageCount int64 `json:"-" mapstructure:"-"`
 
@@ -61,11 +93,14 @@ func (k *APIKey) IsValid() bool {
 	return k.Key != "" && k.Provider != ""
 }
 
-// IsAvailable checks if the key is enabled and not exhausted.
+// IsAvailable checks if the key is enabled, not expired and not exhausted.
 func (k *APIKey) IsAvailable() bool {
 	if !k.Enabled {
 		return false
 	}
+	if k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt) {
+		return false
+	}
 	if k.IsExhausted && time.Now().Before(k.ExhaustedUntil) {
 		return false
 	}
@@ -87,6 +122,9 @@ type KeyPool struct {
 	// currentIndex is used for round-robin rotation (runtime only).
 	currentIndex int
 
+	// fingerprints holds the KeyFingerprint of every key in Keys.
+	fingerprints map[string]struct{}
+
 	// mu protects concurrent access to the pool.
 	mu sync.RWMutex
 }
@@ -97,14 +135,35 @@ func NewKeyPool(strategy RotationStrategy) *KeyPool {
 		Keys:         make([]*APIKey, 0),
 		Strategy:     strategy,
 		currentIndex: 0,
+		fingerprints: make(map[string]struct{}),
 	}
 }
 
-// AddKey adds an API key to the pool.
-func (p *KeyPool) AddKey(key *APIKey) {
+// AddKey adds an API key to the pool and reports whether it was added. A
+// key already in the pool is skipped and logged by its fingerprint.
+func (p *KeyPool) AddKey(key *APIKey) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+
+	fp := KeyFingerprint(key.Key)
+	if _, dup := p.fingerprints[fp]; dup {
+		slog.Warn("duplicate key", slog.String("fingerprint", fp))
+		return false
+	}
+	if p.fingerprints == nil {
+		p.fingerprints = make(map[string]struct{})
+	}
+	p.fingerprints[fp] = struct{}{}
 	p.Keys = append(p.Keys, key)
+	return true
+}
+
+// HasKey reports whether key was added to the pool with AddKey.
+func (p *KeyPool) HasKey(key string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.fingerprints[KeyFingerprint(key)]
+	return ok
 }
 
 // GetAvailableKeys returns all keys that are currently available.
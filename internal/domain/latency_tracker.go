@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultLatencyAlpha is the EWMA smoothing factor for key latency.
+const DefaultLatencyAlpha = 0.2
+
+// LatencyTracker keeps an in-memory EWMA of upstream latency per key.
+type LatencyTracker struct {
+	mu      sync.RWMutex
+	alpha   float64
+	ewma    map[string]time.Duration
+	samples map[string]int
+}
+
+// KeyLatency is a key's latency EWMA and how many requests it is based on.
+type KeyLatency struct {
+	EWMA    time.Duration
+	Samples int
+}
+
+// NewLatencyTracker returns a LatencyTracker with smoothing factor alpha in
+// (0, 1]. Out-of-range values use DefaultLatencyAlpha.
+func NewLatencyTracker(alpha float64) *LatencyTracker {
+	if alpha <= 0 || alpha > 1 {
+		alpha = DefaultLatencyAlpha
+	}
+	return &LatencyTracker{
+		alpha:   alpha,
+		ewma:    make(map[string]time.Duration),
+		samples: make(map[string]int),
+	}
+}
+
+// RecordLatency folds d into key's EWMA. The first sample sets it directly.
+func (t *LatencyTracker) RecordLatency(key string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.samples[key] == 0 {
+		t.ewma[key] = d
+	} else {
+		t.ewma[key] = time.Duration(t.alpha*float64(d) + (1-t.alpha)*float64(t.ewma[key]))
+	}
+	t.samples[key]++
+}
+
+// GetFastestKey returns the key in keys with the lowest latency EWMA. Keys
+// without samples are returned first so every key gets measured. Ties go to
+// the earlier key; an empty list returns "".
+func (t *LatencyTracker) GetFastestKey(keys []string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var best string
+	for _, k := range keys {
+		if t.samples[k] == 0 {
+			return k
+		}
+		if best == "" || t.ewma[k] < t.ewma[best] {
+			best = k
+		}
+	}
+	return best
+}
+
+// Snapshot returns a copy of the latency table.
+func (t *LatencyTracker) Snapshot() map[string]KeyLatency {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	res := make(map[string]KeyLatency, len(t.ewma))
+	for k, d := range t.ewma {
+		res[k] = KeyLatency{EWMA: d, Samples: t.samples[k]}
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker_RecordLatency(t *testing.T) {
+	lt := NewLatencyTracker(0.5)
+
+	lt.RecordLatency("key1", 100*time.Millisecond)
+	if got := lt.Snapshot()["key1"]; got.EWMA != 100*time.Millisecond || got.Samples != 1 {
+		t.Errorf("after first sample = %+v, want {100ms 1}", got)
+	}
+
+	lt.RecordLatency("key1", 200*time.Millisecond)
+	if got := lt.Snapshot()["key1"]; got.EWMA != 150*time.Millisecond || got.Samples != 2 {
+		t.Errorf("after second sample = %+v, want {150ms 2}", got)
+	}
+}
+
+func TestLatencyTracker_GetFastestKey(t *testing.T) {
+	lt := NewLatencyTracker(DefaultLatencyAlpha)
+	lt.RecordLatency("slow", 300*time.Millisecond)
+	lt.RecordLatency("fast", 50*time.Millisecond)
+	lt.RecordLatency("medium", 100*time.Millisecond)
+
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{"fastest wins", []string{"slow", "medium", "fast"}, "fast"},
+		{"fastest among candidates", []string{"slow", "medium"}, "medium"},
+		{"unmeasured key first", []string{"fast", "new"}, "new"},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lt.GetFastestKey(tt.keys); got != tt.want {
+				t.Errorf("GetFastestKey(%v) = %q, want %q", tt.keys, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencyTracker_AdaptsToSlowdown(t *testing.T) {
+	lt := NewLatencyTracker(0.5)
+	lt.RecordLatency("key1", 10*time.Millisecond)
+	lt.RecordLatency("key2", 50*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		lt.RecordLatency("key1", 200*time.Millisecond)
+	}
+	if got := lt.GetFastestKey([]string{"key1", "key2"}); got != "key2" {
+		t.Errorf("GetFastestKey() = %s, want key2 after key1 slowed down", got)
+	}
+}
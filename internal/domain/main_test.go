@@ -0,0 +1,13 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/hpn/hpn-g-router/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	r := testutil.Rand()
+	randIntN, randInt64N = r.IntN, r.Int64N
+	testutil.Main(m)
+}
@@ -0,0 +1,250 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MockKeyManager is a KeyManagerInterface for handler tests. Every selection
+// method returns ReturnKey, or ReturnError when it is set, and the keys the
+// handler marks dead are recorded in MarkDeadCalled. A key marked dead is
+// not returned again until it is revived, so retries run out of keys the way
+// they do with a one-key pool.
+type MockKeyManager struct {
+	// ReturnKey is the key every selection returns.
+	ReturnKey string
+
+	// ReturnError, when set, is returned by every selection instead of a key.
+	ReturnError error
+
+	// Keys is the pool the counts report. When empty, the pool is ReturnKey.
+	Keys []string
+
+	mu sync.Mutex
+
+	// MarkDeadCalled lists the keys passed to MarkAsDead, in order.
+	MarkDeadCalled []string
+
+	// SuccessCalled and ErrorCalled list the keys passed to RecordSuccess
+	// and RecordError, in order.
+	SuccessCalled []string
+	ErrorCalled   []string
+
+	dead map[string]struct{}
+}
+
+var _ KeyManagerInterface = (*MockKeyManager)(nil)
+
+// NewMockKeyManager returns a MockKeyManager that always selects key.
+func NewMockKeyManager(key string) *MockKeyManager {
+	return &MockKeyManager{ReturnKey: key}
+}
+
+func (m *MockKeyManager) pool() []string {
+	if len(m.Keys) > 0 {
+		return m.Keys
+	}
+	if m.ReturnKey != "" {
+		return []string{m.ReturnKey}
+	}
+	return nil
+}
+
+// GetNextKey returns ReturnKey, ReturnError, or ErrNoKeysAvailable when
+// ReturnKey was marked dead.
+func (m *MockKeyManager) GetNextKey() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ReturnError != nil {
+		return "", m.ReturnError
+	}
+	if _, dead := m.dead[m.ReturnKey]; dead || m.ReturnKey == "" {
+		return "", ErrNoKeysAvailable
+	}
+	return m.ReturnKey, nil
+}
+
+// GetNextKeyExcluding is GetNextKey, returning ErrNoKeysAvailable when
+// ReturnKey is excluded and ctx's error once ctx is done.
+func (m *MockKeyManager) GetNextKeyExcluding(ctx context.Context, exclude map[string]struct{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	key, err := m.GetNextKey()
+	if err != nil {
+		return "", err
+	}
+	if _, skip := exclude[key]; skip {
+		return "", ErrNoKeysAvailable
+	}
+	return key, nil
+}
+
+// GetNextKeyByProvider is GetNextKey.
+func (m *MockKeyManager) GetNextKeyByProvider(ProviderType) (string, error) {
+	return m.GetNextKey()
+}
+
+// GetNextKeyByTags is GetNextKey.
+func (m *MockKeyManager) GetNextKeyByTags([]string, RotationStrategy) (string, error) {
+	return m.GetNextKey()
+}
+
+// GetNextKeyByLowestRegionLatency is GetNextKey.
+func (m *MockKeyManager) GetNextKeyByLowestRegionLatency() (string, error) {
+	return m.GetNextKey()
+}
+
+// GetNextKeyByProviderExcluding is GetNextKeyExcluding.
+func (m *MockKeyManager) GetNextKeyByProviderExcluding(ctx context.Context, _ ProviderType, exclude map[string]struct{}) (string, error) {
+	return m.GetNextKeyExcluding(ctx, exclude)
+}
+
+// GetNextKeyByTagsExcluding is GetNextKeyExcluding.
+func (m *MockKeyManager) GetNextKeyByTagsExcluding(ctx context.Context, _ []string, _ RotationStrategy, exclude map[string]struct{}) (string, error) {
+	return m.GetNextKeyExcluding(ctx, exclude)
+}
+
+// GetNextKeyByLowestRegionLatencyExcluding is GetNextKeyExcluding.
+func (m *MockKeyManager) GetNextKeyByLowestRegionLatencyExcluding(ctx context.Context, exclude map[string]struct{}) (string, error) {
+	return m.GetNextKeyExcluding(ctx, exclude)
+}
+
+// MarkAsDead records key in MarkDeadCalled and takes it out of the pool.
+// The reason is ignored.
+func (m *MockKeyManager) MarkAsDead(key, _ string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.MarkDeadCalled = append(m.MarkDeadCalled, key)
+	if m.dead == nil {
+		m.dead = make(map[string]struct{})
+	}
+	m.dead[key] = struct{}{}
+}
+
+// ReviveKey puts a key marked dead back into the pool.
+func (m *MockKeyManager) ReviveKey(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.dead, key)
+}
+
+// IsKeyDead reports whether key was marked dead and not revived.
+func (m *MockKeyManager) IsKeyDead(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, dead := m.dead[key]
+	return dead
+}
+
+// ActiveKeyCount returns the keys of the pool not marked dead.
+func (m *MockKeyManager) ActiveKeyCount() int {
+	return len(m.GetActiveKeys())
+}
+
+// DeadKeyCount returns the keys of the pool marked dead.
+func (m *MockKeyManager) DeadKeyCount() int {
+	return m.TotalKeyCount() - m.ActiveKeyCount()
+}
+
+// TotalKeyCount returns the size of the pool.
+func (m *MockKeyManager) TotalKeyCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.pool())
+}
+
+// GetActiveKeys returns the keys of the pool not marked dead.
+func (m *MockKeyManager) GetActiveKeys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var active []string
+	for _, k := range m.pool() {
+		if _, dead := m.dead[k]; !dead {
+			active = append(active, k)
+		}
+	}
+	return active
+}
+
+// GetAllKeyStates returns the keys of the pool as active or dead, from one
+// snapshot.
+func (m *MockKeyManager) GetAllKeyStates() []KeyState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pool := m.pool()
+	states := make([]KeyState, len(pool))
+	for i, k := range pool {
+		states[i] = KeyState{Key: k, Status: KeyStatusActive}
+		if _, dead := m.dead[k]; dead {
+			states[i].Status = KeyStatusDead
+		}
+	}
+	return states
+}
+
+// RecordSuccess records key in SuccessCalled.
+func (m *MockKeyManager) RecordSuccess(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.SuccessCalled = append(m.SuccessCalled, key)
+}
+
+// RecordError records key in ErrorCalled.
+func (m *MockKeyManager) RecordError(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ErrorCalled = append(m.ErrorCalled, key)
+}
+
+// HandleError records key in ErrorCalled and marks it dead when err asks
+// for it, deciding the retry the way KeyManager.HandleError does.
+func (m *MockKeyManager) HandleError(key string, err error) bool {
+	m.RecordError(key)
+	retry, markDead := errorVerdict(err)
+	if markDead {
+		m.MarkAsDead(key, err.Error())
+	}
+	return retry
+}
+
+// AcquireKey always succeeds; the mock has no concurrency limit.
+func (m *MockKeyManager) AcquireKey(string) bool { return true }
+
+// ReleaseKey does nothing.
+func (m *MockKeyManager) ReleaseKey(string) {}
+
+// IsOverQuota reports false; the mock has no quotas.
+func (m *MockKeyManager) IsOverQuota(string) bool { return false }
+
+// IsOverTokenRate reports false; the mock has no token rate limit.
+func (m *MockKeyManager) IsOverTokenRate(string) bool { return false }
+
+// ReviveExpired does nothing; dead keys stay dead until ReviveKey.
+func (m *MockKeyManager) ReviveExpired() {}
+
+// LowOnKeys reports false; the mock has no minimum.
+func (m *MockKeyManager) LowOnKeys() bool { return false }
+
+// ActiveProviders returns nil; the mock's keys have no provider.
+func (m *MockKeyManager) ActiveProviders() []ProviderType { return nil }
+
+// ProviderKeyCount returns 0; the mock's keys have no provider.
+func (m *MockKeyManager) ProviderKeyCount(ProviderType) int { return 0 }
+
+// KeyProvider returns ""; the mock's keys have no provider.
+func (m *MockKeyManager) KeyProvider(string) ProviderType { return "" }
+
+// KeyBaseURL returns ""; the mock's keys use the provider's base URL.
+func (m *MockKeyManager) KeyBaseURL(string) string { return "" }
+
+// KeyName returns ""; the mock's keys have no name.
+func (m *MockKeyManager) KeyName(string) string { return "" }
+
+// GetCooldown returns 0; mock keys are only revived by ReviveKey.
+func (m *MockKeyManager) GetCooldown() time.Duration { return 0 }
+
+// EarliestRevivalTime reports false; mock keys are only revived by
+// ReviveKey.
+func (m *MockKeyManager) EarliestRevivalTime() (time.Time, bool) { return time.Time{}, false }
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMockKeyManager(t *testing.T) {
+	m := NewMockKeyManager("key1")
+	m.Keys = []string{"key1", "key2"}
+
+	if key, err := m.GetNextKey(); err != nil || key != "key1" {
+		t.Fatalf("GetNextKey() = %s, %v, want key1", key, err)
+	}
+	if _, err := m.GetNextKeyExcluding(context.Background(), map[string]struct{}{"key1": {}}); !errors.Is(err, ErrNoKeysAvailable) {
+		t.Errorf("GetNextKeyExcluding(key1) error = %v, want %v", err, ErrNoKeysAvailable)
+	}
+
+	m.MarkAsDead("key1", "")
+	if _, err := m.GetNextKey(); !errors.Is(err, ErrNoKeysAvailable) {
+		t.Errorf("GetNextKey() after MarkAsDead error = %v, want %v", err, ErrNoKeysAvailable)
+	}
+	if len(m.MarkDeadCalled) != 1 || m.MarkDeadCalled[0] != "key1" {
+		t.Errorf("MarkDeadCalled = %v, want [key1]", m.MarkDeadCalled)
+	}
+	if got, want := [3]int{m.ActiveKeyCount(), m.DeadKeyCount(), m.TotalKeyCount()}, [3]int{1, 1, 2}; got != want {
+		t.Errorf("active, dead, total = %v, want %v", got, want)
+	}
+
+	m.ReviveKey("key1")
+	if m.IsKeyDead("key1") {
+		t.Error("IsKeyDead(key1) = true after ReviveKey")
+	}
+
+	m.ReturnError = ErrKeysBusy
+	if _, err := m.GetNextKeyByProvider(ProviderGoogle); !errors.Is(err, ErrKeysBusy) {
+		t.Errorf("GetNextKeyByProvider() error = %v, want %v", err, ErrKeysBusy)
+	}
+}
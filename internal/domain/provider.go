@@ -6,10 +6,14 @@ package domain
 type ProviderType string
 
 const (
-	ProviderOpenAI    ProviderType = "openai"
-	ProviderAnthropic ProviderType = "anthropic"
-	ProviderGoogle    ProviderType = "google"
-	ProviderAzure     ProviderType = "azure"
+	ProviderOpenAI      ProviderType = "openai"
+	ProviderAnthropic   ProviderType = "anthropic"
+	ProviderGoogle      ProviderType = "google"
+	ProviderAzure       ProviderType = "azure"
+	ProviderGroq        ProviderType = "groq"
+	ProviderCohere      ProviderType = "cohere"
+	ProviderHuggingFace ProviderType = "huggingface"
+	ProviderXAI         ProviderType = "xai"
 )
 
 // Provider represents an API provider with its configuration.
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"sort"
+)
+
+// ProviderBalancer spreads requests across providers in proportion to their
+// weights. Only providers with a positive weight and at least one active key
+// take part, so traffic shifts to the others while a provider's keys are dead.
+type ProviderBalancer struct {
+	km      *KeyManager
+	weights map[ProviderType]int
+	intN    func(n int) int
+}
+
+// ProviderBalancerOption configures a ProviderBalancer.
+type ProviderBalancerOption func(*ProviderBalancer)
+
+// WithBalancerRand sets the source of random numbers in [0, n), for tests.
+func WithBalancerRand(intN func(n int) int) ProviderBalancerOption {
+	return func(b *ProviderBalancer) { b.intN = intN }
+}
+
+// NewProviderBalancer returns a balancer over the providers in weights,
+// checking km for active keys.
+func NewProviderBalancer(km *KeyManager, weights map[ProviderType]int, opts ...ProviderBalancerOption) *ProviderBalancer {
+	b := &ProviderBalancer{
+		km:      km,
+		weights: make(map[ProviderType]int, len(weights)),
+		intN:    km.intN,
+	}
+	for p, w := range weights {
+		if w > 0 {
+			b.weights[p] = w
+		}
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Weight returns the configured weight of provider, 0 when it has none.
+func (b *ProviderBalancer) Weight(provider ProviderType) int {
+	return b.weights[provider]
+}
+
+// SelectProvider picks a weighted provider with active keys at random, each
+// with probability weight/total; equal weights give a uniform choice. It
+// returns "" when no weighted provider has active keys.
+func (b *ProviderBalancer) SelectProvider() ProviderType {
+	// ActiveProviders is sorted, keeping the draw independent of map order.
+	var candidates []ProviderType
+	total := 0
+	for _, p := range b.km.ActiveProviders() {
+		if w := b.weights[p]; w > 0 {
+			candidates = append(candidates, p)
+			total += w
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	n := b.intN(total)
+	for _, p := range candidates {
+		n -= b.weights[p]
+		if n < 0 {
+			return p
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// Providers returns the weighted providers, sorted by name.
+func (b *ProviderBalancer) Providers() []ProviderType {
+	providers := make([]ProviderType, 0, len(b.weights))
+	for p := range b.weights {
+		providers = append(providers, p)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+	return providers
+}
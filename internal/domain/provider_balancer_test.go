@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// newBalancerKeyManager returns a key manager with one key per provider.
+func newBalancerKeyManager(providers ...ProviderType) *KeyManager {
+	keys := make([]string, len(providers))
+	byKey := make(map[string]ProviderType, len(providers))
+	for i, p := range providers {
+		keys[i] = string(p) + "-key"
+		byKey[keys[i]] = p
+	}
+	return NewKeyManager(keys, 0, WithKeyProviders(byKey))
+}
+
+// seededRand returns a deterministic WithBalancerRand source.
+func seededRand() func(int) int {
+	return rand.New(rand.NewPCG(1, 2)).IntN
+}
+
+func TestProviderBalancer_WeightedDistribution(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[ProviderType]int
+		want    map[ProviderType]float64
+	}{
+		{
+			name:    "3 to 1",
+			weights: map[ProviderType]int{ProviderGoogle: 3, ProviderOpenAI: 1},
+			want:    map[ProviderType]float64{ProviderGoogle: 0.75, ProviderOpenAI: 0.25},
+		},
+		{
+			name:    "equal weights",
+			weights: map[ProviderType]int{ProviderGoogle: 2, ProviderOpenAI: 2},
+			want:    map[ProviderType]float64{ProviderGoogle: 0.5, ProviderOpenAI: 0.5},
+		},
+		{
+			name:    "zero weight excluded",
+			weights: map[ProviderType]int{ProviderGoogle: 1, ProviderOpenAI: 0},
+			want:    map[ProviderType]float64{ProviderGoogle: 1},
+		},
+	}
+
+	const calls = 10000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := newBalancerKeyManager(ProviderGoogle, ProviderOpenAI)
+			b := NewProviderBalancer(km, tt.weights, WithBalancerRand(seededRand()))
+
+			counts := make(map[ProviderType]int)
+			for i := 0; i < calls; i++ {
+				counts[b.SelectProvider()]++
+			}
+			for p, want := range tt.want {
+				got := float64(counts[p]) / calls
+				if math.Abs(got-want) > 0.02 {
+					t.Errorf("%s share = %.3f, want %.2f ± 0.02", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProviderBalancer_SkipsProvidersWithoutActiveKeys(t *testing.T) {
+	km := newBalancerKeyManager(ProviderGoogle, ProviderOpenAI)
+	b := NewProviderBalancer(km, map[ProviderType]int{ProviderGoogle: 3, ProviderOpenAI: 1},
+		WithBalancerRand(seededRand()))
+
+	km.MarkAsDead("google-key", "")
+	for i := 0; i < 100; i++ {
+		if got := b.SelectProvider(); got != ProviderOpenAI {
+			t.Fatalf("SelectProvider() = %q, want %q", got, ProviderOpenAI)
+		}
+	}
+
+	km.MarkAsDead("openai-key", "")
+	if got := b.SelectProvider(); got != "" {
+		t.Errorf("SelectProvider() with no active keys = %q, want \"\"", got)
+	}
+}
+
+func TestProviderBalancer_UnweightedProvidersIgnored(t *testing.T) {
+	km := newBalancerKeyManager(ProviderGoogle, ProviderAnthropic)
+	b := NewProviderBalancer(km, map[ProviderType]int{ProviderGoogle: 1})
+
+	for i := 0; i < 100; i++ {
+		if got := b.SelectProvider(); got != ProviderGoogle {
+			t.Fatalf("SelectProvider() = %q, want %q", got, ProviderGoogle)
+		}
+	}
+	if got := b.Weight(ProviderAnthropic); got != 0 {
+		t.Errorf("Weight(anthropic) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrProviderRateLimited is returned when a request ends while waiting for
+// its provider's requests-per-minute limit. Other keys of the provider share
+// the limit, so it is not retried.
+var ErrProviderRateLimited = errors.New("provider rate limit reached")
+
+// ProviderRateLimiter keeps requests to each provider under the provider's
+// RateLimitPerMinute, client side, before the provider answers with 429. It
+// is a token bucket per provider with a burst of one, so requests are spaced
+// evenly across the minute.
+type ProviderRateLimiter struct {
+	limiters map[ProviderType]*rate.Limiter
+}
+
+// NewProviderRateLimiter returns a limiter enforcing the RateLimitPerMinute
+// of providers. Providers without a positive limit are never limited.
+func NewProviderRateLimiter(providers []Provider) *ProviderRateLimiter {
+	l := &ProviderRateLimiter{limiters: make(map[ProviderType]*rate.Limiter)}
+	for _, p := range providers {
+		if p.RateLimitPerMinute > 0 {
+			l.limiters[p.Type] = rate.NewLimiter(rate.Every(time.Minute/time.Duration(p.RateLimitPerMinute)), 1)
+		}
+	}
+	return l
+}
+
+// Wait blocks until a request to provider fits its limit. It returns
+// ErrProviderRateLimited when ctx is done first, or right away when ctx's
+// deadline would pass before then. A nil limiter never waits.
+func (l *ProviderRateLimiter) Wait(ctx context.Context, provider ProviderType) error {
+	if l == nil {
+		return nil
+	}
+	lim, ok := l.limiters[provider]
+	if !ok {
+		return nil
+	}
+	if err := lim.Wait(ctx); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrProviderRateLimited, provider, err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProviderRateLimiter_Wait(t *testing.T) {
+	l := NewProviderRateLimiter([]Provider{
+		{Type: ProviderGoogle, RateLimitPerMinute: 1},
+		{Type: ProviderOpenAI},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx, ProviderGoogle); err != nil {
+		t.Fatalf("first Wait(google) error = %v, want nil", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx, ProviderOpenAI); err != nil {
+			t.Fatalf("Wait(openai) error = %v, want nil for a provider without a limit", err)
+		}
+	}
+
+	start := time.Now()
+	err := l.Wait(ctx, ProviderGoogle)
+	if !errors.Is(err, ErrProviderRateLimited) {
+		t.Errorf("second Wait(google) error = %v, want ErrProviderRateLimited", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Wait took %v, want it to fail at once when the deadline is too close", elapsed)
+	}
+}
+
+func TestProviderRateLimiter_Nil(t *testing.T) {
+	var l *ProviderRateLimiter
+	if err := l.Wait(context.Background(), ProviderGoogle); err != nil {
+		t.Errorf("nil Wait() error = %v, want nil", err)
+	}
+}
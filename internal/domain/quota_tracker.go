@@ -0,0 +1,168 @@
+package domain
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned when keys are active but every one of them
+// has used up its daily or monthly token quota.
+var ErrQuotaExceeded = errors.New("all keys are over their token quota")
+
+// DefaultQuotaResetInterval is how often the tracker checks for a new day or month.
+const DefaultQuotaResetInterval = time.Minute
+
+// QuotaLimits are a key's token limits; zero means unlimited.
+type QuotaLimits struct {
+	Daily   int64
+	Monthly int64
+}
+
+// QuotaUsage is a key's token usage in the current day and month (UTC).
+type QuotaUsage struct {
+	Daily   int64
+	Monthly int64
+}
+
+// QuotaTracker counts tokens per key against daily and monthly limits. Daily
+// counters reset at midnight UTC and monthly counters on the first of the
+// month, checked by a background ticker started with Start.
+type QuotaTracker struct {
+	mu      sync.RWMutex
+	limits  map[string]QuotaLimits
+	daily   map[string]int64
+	monthly map[string]int64
+	day     time.Time
+	month   time.Time
+
+	interval time.Duration
+	now      func() time.Time
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// QuotaTrackerOption configures a QuotaTracker.
+type QuotaTrackerOption func(*QuotaTracker)
+
+// WithQuotaResetInterval sets how often Start checks for a new period.
+func WithQuotaResetInterval(d time.Duration) QuotaTrackerOption {
+	return func(t *QuotaTracker) {
+		if d > 0 {
+			t.interval = d
+		}
+	}
+}
+
+// WithQuotaClock sets the time source, for tests.
+func WithQuotaClock(now func() time.Time) QuotaTrackerOption {
+	return func(t *QuotaTracker) { t.now = now }
+}
+
+// NewQuotaTracker returns a tracker enforcing limits, keyed by API key. Keys
+// without limits are never over quota.
+func NewQuotaTracker(limits map[string]QuotaLimits, opts ...QuotaTrackerOption) *QuotaTracker {
+	t := &QuotaTracker{
+		limits:   make(map[string]QuotaLimits, len(limits)),
+		daily:    make(map[string]int64),
+		monthly:  make(map[string]int64),
+		interval: DefaultQuotaResetInterval,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for k, l := range limits {
+		t.limits[k] = l
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.day, t.month = periods(t.now())
+	return t
+}
+
+// periods returns the start of the UTC day and month containing now.
+func periods(now time.Time) (day, month time.Time) {
+	now = now.UTC()
+	day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return day, month
+}
+
+// RecordUsage adds tokens to key's daily and monthly usage.
+func (t *QuotaTracker) RecordUsage(key string, tokens int64) {
+	if tokens <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.daily[key] += tokens
+	t.monthly[key] += tokens
+}
+
+// IsOverQuota reports whether key has used all of its daily or monthly
+// tokens, so the next request would exceed the quota.
+func (t *QuotaTracker) IsOverQuota(key string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	l := t.limits[key]
+	return (l.Daily > 0 && t.daily[key] >= l.Daily) ||
+		(l.Monthly > 0 && t.monthly[key] >= l.Monthly)
+}
+
+// Usage returns key's token usage in the current day and month.
+func (t *QuotaTracker) Usage(key string) QuotaUsage {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return QuotaUsage{Daily: t.daily[key], Monthly: t.monthly[key]}
+}
+
+// Limits returns key's configured limits.
+func (t *QuotaTracker) Limits(key string) QuotaLimits {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.limits[key]
+}
+
+// Reset clears the counters whose period has ended at the current time.
+func (t *QuotaTracker) Reset() {
+	day, month := periods(t.now())
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if day.After(t.day) {
+		t.daily = make(map[string]int64)
+		t.day = day
+	}
+	if month.After(t.month) {
+		t.monthly = make(map[string]int64)
+		t.month = month
+	}
+}
+
+// Start calls Reset every reset interval from a background goroutine until
+// Stop is called.
+func (t *QuotaTracker) Start() {
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.Reset()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background resets started by Start.
+func (t *QuotaTracker) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+}
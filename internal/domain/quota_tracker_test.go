@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for QuotaTracker tests.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func TestQuotaTracker_IsOverQuota(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits QuotaLimits
+		used   int64
+		want   bool
+	}{
+		{"unlimited", QuotaLimits{}, 1_000_000, false},
+		{"under daily", QuotaLimits{Daily: 100}, 99, false},
+		{"at daily", QuotaLimits{Daily: 100}, 100, true},
+		{"under monthly", QuotaLimits{Monthly: 500}, 499, false},
+		{"over monthly", QuotaLimits{Daily: 1000, Monthly: 500}, 600, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQuotaTracker(map[string]QuotaLimits{"key1": tt.limits})
+			q.RecordUsage("key1", tt.used)
+
+			if got := q.IsOverQuota("key1"); got != tt.want {
+				t.Errorf("IsOverQuota() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaTracker_Reset(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)}
+	q := NewQuotaTracker(map[string]QuotaLimits{"key1": {Daily: 100, Monthly: 1000}},
+		WithQuotaClock(clock.Now))
+	q.RecordUsage("key1", 100)
+
+	q.Reset()
+	if got := q.Usage("key1"); got != (QuotaUsage{Daily: 100, Monthly: 100}) {
+		t.Fatalf("Usage() = %+v before midnight, want unchanged", got)
+	}
+
+	clock.Set(time.Date(2026, 2, 1, 0, 0, 1, 0, time.UTC))
+	q.Reset()
+	if got := q.Usage("key1"); got != (QuotaUsage{}) {
+		t.Errorf("Usage() = %+v in a new month, want zero", got)
+	}
+	if q.IsOverQuota("key1") {
+		t.Error("IsOverQuota() = true after reset, want false")
+	}
+
+	q.RecordUsage("key1", 50)
+	clock.Set(time.Date(2026, 2, 2, 0, 0, 1, 0, time.UTC))
+	q.Reset()
+	if got := q.Usage("key1"); got != (QuotaUsage{Daily: 0, Monthly: 50}) {
+		t.Errorf("Usage() = %+v in a new day, want monthly kept", got)
+	}
+}
+
+func TestQuotaTracker_StartStop(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 23, 59, 0, 0, time.UTC)}
+	q := NewQuotaTracker(map[string]QuotaLimits{"key1": {Daily: 10}},
+		WithQuotaClock(clock.Now), WithQuotaResetInterval(time.Millisecond))
+	q.RecordUsage("key1", 10)
+
+	q.Start()
+	defer q.Stop()
+
+	clock.Set(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC))
+	deadline := time.Now().Add(time.Second)
+	for q.IsOverQuota("key1") {
+		if time.Now().After(deadline) {
+			t.Fatal("background reset never cleared the daily counter")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKeyManager_SkipsOverQuotaKeys(t *testing.T) {
+	q := NewQuotaTracker(map[string]QuotaLimits{"key1": {Daily: 100}})
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithQuotaTracker(q))
+
+	q.RecordUsage("key1", 100)
+	for i := 0; i < 4; i++ {
+		key, err := km.GetNextKey()
+		if err != nil {
+			t.Fatalf("GetNextKey() error = %v", err)
+		}
+		if key != "key2" {
+			t.Errorf("GetNextKey() = %q, want key2 while key1 is over quota", key)
+		}
+	}
+	if !km.IsOverQuota("key1") || km.IsOverQuota("key2") {
+		t.Error("IsOverQuota() reports the wrong keys")
+	}
+}
+
+func TestKeyManager_AllKeysOverQuota(t *testing.T) {
+	q := NewQuotaTracker(map[string]QuotaLimits{
+		"key1": {Daily: 10},
+		"key2": {Monthly: 10},
+	})
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithQuotaTracker(q))
+	q.RecordUsage("key1", 10)
+	q.RecordUsage("key2", 10)
+
+	if _, err := km.GetNextKey(); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("GetNextKey() error = %v, want ErrQuotaExceeded", err)
+	}
+}
@@ -0,0 +1,289 @@
+package domain
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultRegionProbeInterval is how often a RegionLatencyProbe measures
+	// its endpoints.
+	DefaultRegionProbeInterval = 30 * time.Second
+
+	// DefaultRegionProbeTimeout bounds a single probe request.
+	DefaultRegionProbeTimeout = 5 * time.Second
+)
+
+// RegionLatencyProbe measures the round-trip latency of regional provider
+// endpoints with HEAD requests, so keys can be served from the fastest
+// region. Any HTTP response counts as a round trip; an endpoint that cannot
+// be reached has no latency until it answers again.
+type RegionLatencyProbe struct {
+	urls     []string
+	client   *http.Client
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu      sync.RWMutex
+	latency map[string]time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// RegionLatencyProbeOption configures a RegionLatencyProbe.
+type RegionLatencyProbeOption func(*RegionLatencyProbe)
+
+// WithProbeInterval sets how often Start probes the endpoints.
+func WithProbeInterval(d time.Duration) RegionLatencyProbeOption {
+	return func(p *RegionLatencyProbe) {
+		if d > 0 {
+			p.interval = d
+		}
+	}
+}
+
+// WithProbeClient sets the HTTP client probes are sent with.
+func WithProbeClient(c *http.Client) RegionLatencyProbeOption {
+	return func(p *RegionLatencyProbe) { p.client = c }
+}
+
+// WithProbeLogger sets the logger unreachable endpoints are reported to.
+func WithProbeLogger(l *slog.Logger) RegionLatencyProbeOption {
+	return func(p *RegionLatencyProbe) { p.logger = l }
+}
+
+// NewRegionLatencyProbe returns a probe for the given base URLs. Duplicates
+// and trailing slashes are ignored.
+func NewRegionLatencyProbe(urls []string, opts ...RegionLatencyProbeOption) *RegionLatencyProbe {
+	p := &RegionLatencyProbe{
+		client:   &http.Client{Timeout: DefaultRegionProbeTimeout},
+		interval: DefaultRegionProbeInterval,
+		logger:   slog.Default(),
+		latency:  make(map[string]time.Duration),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	seen := make(map[string]struct{})
+	for _, u := range urls {
+		u = strings.TrimSuffix(u, "/")
+		if _, dup := seen[u]; u == "" || dup {
+			continue
+		}
+		seen[u] = struct{}{}
+		p.urls = append(p.urls, u)
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// URLs returns the endpoints the probe measures.
+func (p *RegionLatencyProbe) URLs() []string {
+	return append([]string(nil), p.urls...)
+}
+
+// Latency returns the last measured round trip to url, or false when url
+// was never reached or its last probe failed.
+func (p *RegionLatencyProbe) Latency(url string) (time.Duration, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	d, ok := p.latency[strings.TrimSuffix(url, "/")]
+	return d, ok
+}
+
+// ProbeAll measures every endpoint once, concurrently, and returns when all
+// probes finished.
+func (p *RegionLatencyProbe) ProbeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, u := range p.urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			p.probe(ctx, u)
+		}(u)
+	}
+	wg.Wait()
+}
+
+func (p *RegionLatencyProbe) probe(ctx context.Context, url string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err == nil {
+		start := time.Now()
+		var resp *http.Response
+		if resp, err = p.client.Do(req); err == nil {
+			resp.Body.Close()
+			rtt := time.Since(start)
+			p.mu.Lock()
+			p.latency[url] = rtt
+			p.mu.Unlock()
+			return
+		}
+	}
+
+	p.mu.Lock()
+	_, known := p.latency[url]
+	delete(p.latency, url)
+	p.mu.Unlock()
+	if known {
+		p.logger.Warn("region endpoint unreachable",
+			slog.String("url", url),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// Start probes every endpoint at once and then every interval from a
+// background goroutine until Stop is called.
+func (p *RegionLatencyProbe) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+	go func() {
+		defer close(p.done)
+		p.ProbeAll(ctx)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.ProbeAll(ctx)
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the probes started by Start.
+func (p *RegionLatencyProbe) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.done
+}
+
+// KeyRegion is the regional endpoint a key is served from.
+type KeyRegion struct {
+	// Region names the region, such as "europe-west1", for logs.
+	Region string
+
+	// BaseURL is the region's API base URL.
+	BaseURL string
+}
+
+// WithKeyRegions points keys at regional endpoints. Keys without a region
+// use the provider's base URL.
+func WithKeyRegions(regions map[string]KeyRegion) KeyManagerOption {
+	return func(km *KeyManager) {
+		for k, r := range regions {
+			if r.BaseURL != "" {
+				km.baseURLs[k] = strings.TrimSuffix(r.BaseURL, "/")
+			}
+			if r.Region != "" {
+				km.regions[k] = r.Region
+			}
+		}
+	}
+}
+
+// WithRegionProbe ranks keys for GetNextKeyByLowestRegionLatency by the
+// latency p measured to their base URL. Keys without a regional base URL
+// are ranked by defaultBaseURL.
+func WithRegionProbe(p *RegionLatencyProbe, defaultBaseURL string) KeyManagerOption {
+	return func(km *KeyManager) {
+		km.regionProbe = p
+		km.defaultBaseURL = strings.TrimSuffix(defaultBaseURL, "/")
+	}
+}
+
+// KeyBaseURL returns key's regional base URL, or "" when it uses the
+// provider's.
+func (km *KeyManager) KeyBaseURL(key string) string {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.baseURLs[key]
+}
+
+// KeyRegion returns the region key is served from, or "" when it has none.
+func (km *KeyManager) KeyRegion(key string) string {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.regions[key]
+}
+
+// GetNextKeyByLowestRegionLatency returns an active key from the region
+// with the lowest probed latency, rotating among that region's keys. Keys
+// of slower regions are used when the faster ones are busy or over quota,
+// and keys whose endpoint has no latency come last. Without a probe, or
+// before any endpoint answered, it falls back to GetNextKey.
+func (km *KeyManager) GetNextKeyByLowestRegionLatency() (string, error) {
+	return km.GetNextKeyByLowestRegionLatencyExcluding(context.Background(), nil)
+}
+
+// GetNextKeyByLowestRegionLatencyExcluding is GetNextKeyByLowestRegionLatency
+// skipping the keys in exclude, as GetNextKeyExcluding does, and returning
+// ctx's error once ctx is done.
+func (km *KeyManager) GetNextKeyByLowestRegionLatencyExcluding(ctx context.Context, exclude map[string]struct{}) (string, error) {
+	if km.regionProbe == nil {
+		return km.GetNextKeyExcluding(ctx, exclude)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	km.ReviveExpired()
+
+	km.mu.RLock()
+	type ranked struct {
+		key     string
+		latency time.Duration
+		probed  bool
+	}
+	keys := make([]ranked, 0, len(km.keys))
+	anyProbed := false
+	for _, k := range without(km.keys, exclude) {
+		u := km.baseURLs[k]
+		if u == "" {
+			u = km.defaultBaseURL
+		}
+		d, ok := km.regionProbe.Latency(u)
+		keys = append(keys, ranked{key: k, latency: d, probed: ok})
+		anyProbed = anyProbed || ok
+	}
+	if !anyProbed {
+		km.mu.RUnlock()
+		return km.GetNextKeyExcluding(ctx, exclude)
+	}
+	defer km.mu.RUnlock()
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].probed != keys[j].probed {
+			return keys[i].probed
+		}
+		return keys[i].latency < keys[j].latency
+	})
+
+	// Rotate the keys sharing the lowest latency so one key does not take
+	// all of the fastest region's traffic.
+	fastest := 1
+	for fastest < len(keys) && keys[fastest].probed && keys[fastest].latency == keys[0].latency {
+		fastest++
+	}
+	start := int((atomic.AddInt64(&km.regionIndex, 1) - 1) % int64(fastest))
+	order := make([]string, 0, len(keys))
+	for i := range fastest {
+		order = append(order, keys[(start+i)%fastest].key)
+	}
+	for _, r := range keys[fastest:] {
+		order = append(order, r.key)
+	}
+	return km.pick(order, 0, StrategyRoundRobin)
+}
@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newRegionServer returns an endpoint answering after delay.
+func newRegionServer(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("probe method = %s, want HEAD", r.Method)
+		}
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRegionLatencyProbe_ProbeAll(t *testing.T) {
+	fast := newRegionServer(t, 0)
+	slow := newRegionServer(t, 50*time.Millisecond)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	p := NewRegionLatencyProbe([]string{fast.URL, slow.URL + "/", slow.URL, down.URL})
+	if got := len(p.URLs()); got != 3 {
+		t.Errorf("len(URLs()) = %d, want 3 without duplicates", got)
+	}
+	if _, ok := p.Latency(fast.URL); ok {
+		t.Error("Latency() available before probing")
+	}
+
+	p.ProbeAll(context.Background())
+	fastRTT, ok := p.Latency(fast.URL)
+	if !ok {
+		t.Fatal("fast endpoint has no latency")
+	}
+	slowRTT, ok := p.Latency(slow.URL)
+	if !ok {
+		t.Fatal("slow endpoint has no latency")
+	}
+	if slowRTT < 50*time.Millisecond || fastRTT >= slowRTT {
+		t.Errorf("latency fast = %v, slow = %v, want fast < slow >= 50ms", fastRTT, slowRTT)
+	}
+	if _, ok := p.Latency(down.URL); ok {
+		t.Error("unreachable endpoint has a latency")
+	}
+}
+
+func TestKeyManager_GetNextKeyByLowestRegionLatency(t *testing.T) {
+	us := newRegionServer(t, 40*time.Millisecond)
+	eu := newRegionServer(t, 0)
+
+	probe := NewRegionLatencyProbe([]string{us.URL, eu.URL})
+	km := NewKeyManager([]string{"us1", "eu1", "us2", "eu2"}, time.Minute,
+		WithKeyRegions(map[string]KeyRegion{
+			"us1": {Region: "us-central1", BaseURL: us.URL},
+			"us2": {Region: "us-central1", BaseURL: us.URL},
+			"eu1": {Region: "europe-west1", BaseURL: eu.URL},
+			"eu2": {Region: "europe-west1", BaseURL: eu.URL},
+		}),
+		WithRegionProbe(probe, ""),
+	)
+
+	// Before any probe answered the rotation is used.
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		key, err := km.GetNextKeyByLowestRegionLatency()
+		if err != nil {
+			t.Fatalf("GetNextKeyByLowestRegionLatency() error = %v", err)
+		}
+		seen[key]++
+	}
+	if len(seen) != 4 {
+		t.Errorf("keys before probing = %v, want round-robin over all keys", seen)
+	}
+
+	probe.ProbeAll(context.Background())
+	seen = make(map[string]int)
+	for i := 0; i < 10; i++ {
+		key, err := km.GetNextKeyByLowestRegionLatency()
+		if err != nil {
+			t.Fatalf("GetNextKeyByLowestRegionLatency() error = %v", err)
+		}
+		if km.KeyRegion(key) != "europe-west1" {
+			t.Fatalf("GetNextKeyByLowestRegionLatency() = %s, want a key of the faster region", key)
+		}
+		seen[key]++
+	}
+	if seen["eu1"] != 5 || seen["eu2"] != 5 {
+		t.Errorf("keys = %v, want the faster region's keys rotated", seen)
+	}
+
+	// Keys a request already tried are skipped.
+	tried := map[string]struct{}{"eu1": {}}
+	for i := 0; i < 3; i++ {
+		if key, err := km.GetNextKeyByLowestRegionLatencyExcluding(context.Background(), tried); err != nil || key != "eu2" {
+			t.Fatalf("GetNextKeyByLowestRegionLatencyExcluding(eu1) = %s, %v, want eu2", key, err)
+		}
+	}
+
+	km.MarkAsDead("eu1", "")
+	km.MarkAsDead("eu2", "")
+	if key, err := km.GetNextKeyByLowestRegionLatency(); err != nil || km.KeyRegion(key) != "us-central1" {
+		t.Errorf("GetNextKeyByLowestRegionLatency() = %s, %v, want the slower region with the faster one dead", key, err)
+	}
+}
+
+func TestKeyManager_RegionLatencyWithoutProbe(t *testing.T) {
+	km := NewKeyManager([]string{"key1", "key2"}, time.Minute)
+	for _, want := range []string{"key1", "key2"} {
+		if key, err := km.GetNextKeyByLowestRegionLatency(); err != nil || key != want {
+			t.Errorf("GetNextKeyByLowestRegionLatency() = %s, %v, want %s", key, err, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ErrUnknownProvider is returned for a provider the registry has no URL for.
+	ErrUnknownProvider = errors.New("unknown provider")
+
+	// ErrInvalidBaseURL is returned for a base URL that is not an absolute
+	// https URL.
+	ErrInvalidBaseURL = errors.New("base URL must be an absolute https URL")
+)
+
+// ProviderBaseURLRegistry holds the API base URL of each provider. A URL can
+// be replaced while the router runs, e.g. to route through a corporate
+// proxy, and readers see the change on their next request.
+type ProviderBaseURLRegistry struct {
+	// urls is fixed after construction; only the pointed-to URLs change.
+	urls map[ProviderType]*atomic.Pointer[string]
+}
+
+// NewProviderBaseURLRegistry returns a registry serving the providers in
+// defaults, starting from the given base URLs.
+func NewProviderBaseURLRegistry(defaults map[ProviderType]string) *ProviderBaseURLRegistry {
+	r := &ProviderBaseURLRegistry{urls: make(map[ProviderType]*atomic.Pointer[string], len(defaults))}
+	for p, u := range defaults {
+		u = strings.TrimSuffix(u, "/")
+		r.urls[p] = new(atomic.Pointer[string])
+		r.urls[p].Store(&u)
+	}
+	return r
+}
+
+// BaseURL returns provider's current base URL, or "" for an unknown provider.
+func (r *ProviderBaseURLRegistry) BaseURL(provider ProviderType) string {
+	p, ok := r.urls[provider]
+	if !ok {
+		return ""
+	}
+	return *p.Load()
+}
+
+// SetBaseURL replaces provider's base URL with rawURL, which must be an
+// absolute https URL, and returns the URL it replaced.
+func (r *ProviderBaseURLRegistry) SetBaseURL(provider ProviderType, rawURL string) (previous string, err error) {
+	p, ok := r.urls[provider]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", ErrInvalidBaseURL
+	}
+	next := strings.TrimSuffix(rawURL, "/")
+	return *p.Swap(&next), nil
+}
+
+// For returns a view of provider's base URL that reads the registry on
+// every call, for adapters that must follow runtime changes.
+func (r *ProviderBaseURLRegistry) For(provider ProviderType) ProviderBaseURL {
+	return ProviderBaseURL{registry: r, provider: provider}
+}
+
+// ProviderBaseURL is one provider's entry in a ProviderBaseURLRegistry.
+type ProviderBaseURL struct {
+	registry *ProviderBaseURLRegistry
+	provider ProviderType
+}
+
+// BaseURL returns the provider's current base URL.
+func (b ProviderBaseURL) BaseURL() string {
+	return b.registry.BaseURL(b.provider)
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestProviderBaseURLRegistry_SetBaseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderType
+		url      string
+		wantErr  error
+		want     string
+	}{
+		{"https", ProviderGoogle, "https://proxy.corp.example/gemini/v1beta", nil, "https://proxy.corp.example/gemini/v1beta"},
+		{"trailing slash trimmed", ProviderGoogle, "https://proxy.corp.example/", nil, "https://proxy.corp.example"},
+		{"http rejected", ProviderGoogle, "http://proxy.corp.example", ErrInvalidBaseURL, ""},
+		{"relative rejected", ProviderGoogle, "/v1beta", ErrInvalidBaseURL, ""},
+		{"unparseable", ProviderGoogle, "https://proxy corp\x7f", ErrInvalidBaseURL, ""},
+		{"unknown provider", ProviderOpenAI, "https://api.example", ErrUnknownProvider, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const initial = "https://generativelanguage.googleapis.com/v1beta"
+			r := NewProviderBaseURLRegistry(map[ProviderType]string{ProviderGoogle: initial})
+
+			previous, err := r.SetBaseURL(tt.provider, tt.url)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetBaseURL() error = %v, want %v", err, tt.wantErr)
+			}
+			want := tt.want
+			if err != nil {
+				want = initial
+			} else if previous != initial {
+				t.Errorf("SetBaseURL() previous = %s, want %s", previous, initial)
+			}
+			if got := r.BaseURL(ProviderGoogle); got != want {
+				t.Errorf("BaseURL() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestProviderBaseURLRegistry_For(t *testing.T) {
+	r := NewProviderBaseURLRegistry(map[ProviderType]string{ProviderGoogle: "https://a.example/"})
+	view := r.For(ProviderGoogle)
+
+	if got := view.BaseURL(); got != "https://a.example" {
+		t.Errorf("BaseURL() = %s, want https://a.example", got)
+	}
+	if _, err := r.SetBaseURL(ProviderGoogle, "https://b.example"); err != nil {
+		t.Fatalf("SetBaseURL() error = %v", err)
+	}
+	if got := view.BaseURL(); got != "https://b.example" {
+		t.Errorf("BaseURL() after change = %s, want https://b.example", got)
+	}
+	if got := r.For(ProviderOpenAI).BaseURL(); got != "" {
+		t.Errorf("BaseURL() of unknown provider = %s, want \"\"", got)
+	}
+}
+
+func TestProviderBaseURLRegistry_Concurrent(t *testing.T) {
+	r := NewProviderBaseURLRegistry(map[ProviderType]string{ProviderGoogle: "https://a.example"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = r.SetBaseURL(ProviderGoogle, "https://b.example")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if u := r.BaseURL(ProviderGoogle); u != "https://a.example" && u != "https://b.example" {
+					t.Errorf("BaseURL() = %q, want a complete URL", u)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
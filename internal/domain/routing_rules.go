@@ -0,0 +1,207 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCondition is returned for a routing rule condition that does not
+// parse.
+var ErrInvalidCondition = errors.New("invalid routing condition")
+
+// RoutingRule sends requests matching Condition to the keys of Target.
+//
+// A condition is one or more clauses joined by "&&", each of them one of:
+//
+//	model == "gpt-4"          model != "gpt-4"
+//	user_tag == "premium"     user_tag != "premium"
+//	time_of_day < "18:00"     (also <=, >, >=, == and !=)
+//	request_has_image         !request_has_image
+//
+// time_of_day is the server's local time as "HH:MM".
+type RoutingRule struct {
+	// Name identifies the rule in logs.
+	Name string `json:"name" mapstructure:"name"`
+
+	// Priority orders the rules: higher priorities are evaluated first, and
+	// rules with equal priority keep their configured order.
+	Priority int `json:"priority" mapstructure:"priority"`
+
+	// Condition is the expression a request must satisfy.
+	Condition string `json:"condition" mapstructure:"condition"`
+
+	// Target is where matching requests are sent.
+	Target RoutingTarget `json:"target" mapstructure:"target"`
+}
+
+// RoutingTarget is the set of keys a matching request is served from.
+type RoutingTarget struct {
+	// KeyTags lists the tags a key must all carry to serve the request.
+	KeyTags []string `json:"key_tags" mapstructure:"key_tags"`
+
+	// Strategy is how the tagged keys rotate; empty uses the pool's strategy.
+	Strategy RotationStrategy `json:"strategy" mapstructure:"strategy"`
+}
+
+// RouteRequest is what routing rules know about a request.
+type RouteRequest struct {
+	Model    string
+	UserTag  string
+	HasImage bool
+	Time     time.Time
+}
+
+// condition reports whether a request satisfies one clause.
+type condition func(RouteRequest) bool
+
+// compiledRule is a RoutingRule with its condition parsed.
+type compiledRule struct {
+	RoutingRule
+	clauses []condition
+}
+
+// RoutingRuleEngine selects key targets for requests from an ordered list of
+// rules.
+type RoutingRuleEngine struct {
+	rules []compiledRule
+}
+
+// NewRoutingRuleEngine parses rules and orders them by priority. It fails on
+// the first rule with an invalid condition, no key tags or an unknown
+// strategy.
+func NewRoutingRuleEngine(rules []RoutingRule) (*RoutingRuleEngine, error) {
+	e := &RoutingRuleEngine{rules: make([]compiledRule, 0, len(rules))}
+	for i, r := range rules {
+		clauses, err := parseCondition(r.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if len(r.Target.KeyTags) == 0 {
+			return nil, fmt.Errorf("rule %d: target.key_tags is required", i)
+		}
+		switch r.Target.Strategy {
+		case "", StrategyRoundRobin, StrategyRandom, StrategyLeastUsed, StrategyPriority:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown target.strategy %q", i, r.Target.Strategy)
+		}
+		e.rules = append(e.rules, compiledRule{RoutingRule: r, clauses: clauses})
+	}
+	sort.SliceStable(e.rules, func(i, j int) bool { return e.rules[i].Priority > e.rules[j].Priority })
+	return e, nil
+}
+
+// Match returns the first rule req satisfies, or false when no rule matches.
+func (e *RoutingRuleEngine) Match(req RouteRequest) (RoutingRule, bool) {
+	for _, r := range e.rules {
+		if r.matches(req) {
+			return r.RoutingRule, true
+		}
+	}
+	return RoutingRule{}, false
+}
+
+// Len returns the number of rules.
+func (e *RoutingRuleEngine) Len() int {
+	return len(e.rules)
+}
+
+func (r compiledRule) matches(req RouteRequest) bool {
+	for _, c := range r.clauses {
+		if !c(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// comparisonOps lists the operators a clause may use, two-character ones
+// first so "<=" is not read as "<".
+var comparisonOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseCondition parses a condition into its clauses.
+func parseCondition(expr string) ([]condition, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("%w: condition is required", ErrInvalidCondition)
+	}
+	var clauses []condition
+	for _, part := range strings.Split(expr, "&&") {
+		c, err := parseClause(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, c)
+	}
+	return clauses, nil
+}
+
+func parseClause(clause string) (condition, error) {
+	switch clause {
+	case "request_has_image":
+		return func(r RouteRequest) bool { return r.HasImage }, nil
+	case "!request_has_image":
+		return func(r RouteRequest) bool { return !r.HasImage }, nil
+	case "":
+		return nil, fmt.Errorf("%w: empty clause", ErrInvalidCondition)
+	}
+
+	// The first operator in the clause splits it, so operators inside the
+	// quoted value are left alone.
+	at, op := -1, ""
+	for _, o := range comparisonOps {
+		if i := strings.Index(clause, o); i >= 0 && (at < 0 || i < at) {
+			at, op = i, o
+		}
+	}
+	if at < 0 {
+		return nil, fmt.Errorf("%w: %q: expected a comparison or request_has_image", ErrInvalidCondition, clause)
+	}
+	field := strings.TrimSpace(clause[:at])
+	value, err := strconv.Unquote(strings.TrimSpace(clause[at+len(op):]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: value must be a quoted string", ErrInvalidCondition, clause)
+	}
+	return newComparison(clause, field, op, value)
+}
+
+// newComparison returns the clause comparing field to value with op.
+func newComparison(clause, field, op, value string) (condition, error) {
+	var get func(RouteRequest) string
+	switch field {
+	case "model":
+		get = func(r RouteRequest) string { return r.Model }
+	case "user_tag":
+		get = func(r RouteRequest) string { return r.UserTag }
+	case "time_of_day":
+		if _, err := time.Parse("15:04", value); err != nil || len(value) != len("15:04") {
+			return nil, fmt.Errorf("%w: %q: time must be HH:MM", ErrInvalidCondition, clause)
+		}
+		// Zero-padded HH:MM strings order the same way as the times.
+		get = func(r RouteRequest) string { return r.Time.Format("15:04") }
+	default:
+		return nil, fmt.Errorf("%w: %q: unknown field %q", ErrInvalidCondition, clause, field)
+	}
+
+	switch op {
+	case "==":
+		return func(r RouteRequest) bool { return get(r) == value }, nil
+	case "!=":
+		return func(r RouteRequest) bool { return get(r) != value }, nil
+	}
+	if field != "time_of_day" {
+		return nil, fmt.Errorf("%w: %q: %s only supports == and !=", ErrInvalidCondition, clause, field)
+	}
+	switch op {
+	case "<":
+		return func(r RouteRequest) bool { return get(r) < value }, nil
+	case "<=":
+		return func(r RouteRequest) bool { return get(r) <= value }, nil
+	case ">":
+		return func(r RouteRequest) bool { return get(r) > value }, nil
+	default:
+		return func(r RouteRequest) bool { return get(r) >= value }, nil
+	}
+}
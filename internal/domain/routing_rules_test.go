@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRoutingRuleEngine_Match(t *testing.T) {
+	e, err := NewRoutingRuleEngine([]RoutingRule{
+		{Name: "gpt4", Condition: `model == "gpt-4"`, Target: RoutingTarget{KeyTags: []string{"gpt4"}}},
+		{Name: "premium-gpt4", Priority: 10, Condition: `model == "gpt-4" && user_tag == "premium"`, Target: RoutingTarget{KeyTags: []string{"premium"}}},
+		{Name: "evening", Condition: `time_of_day >= "18:00"`, Target: RoutingTarget{KeyTags: []string{"batch"}}},
+		{Name: "images", Priority: 10, Condition: `request_has_image`, Target: RoutingTarget{KeyTags: []string{"vision"}}},
+	})
+	if err != nil {
+		t.Fatalf("NewRoutingRuleEngine() error = %v", err)
+	}
+
+	noon := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	evening := time.Date(2026, 3, 1, 18, 30, 0, 0, time.Local)
+	tests := []struct {
+		name string
+		req  RouteRequest
+		want string
+	}{
+		{"model match", RouteRequest{Model: "gpt-4", Time: noon}, "gpt4"},
+		{"higher priority first", RouteRequest{Model: "gpt-4", UserTag: "premium", Time: noon}, "premium-gpt4"},
+		{"equal priority keeps order", RouteRequest{Model: "gpt-4", Time: evening}, "gpt4"},
+		{"time of day", RouteRequest{Model: "gemini-pro", Time: evening}, "evening"},
+		{"image", RouteRequest{Model: "gpt-4", HasImage: true, Time: noon}, "images"},
+		{"no match", RouteRequest{Model: "gemini-pro", UserTag: "premium", Time: noon}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := e.Match(tt.req)
+			if ok != (tt.want != "") || rule.Name != tt.want {
+				t.Errorf("Match() = %q, %v, want %q", rule.Name, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingRuleEngine_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule RoutingRule
+	}{
+		{"empty condition", RoutingRule{}},
+		{"unknown field", RoutingRule{Condition: `region == "eu"`}},
+		{"unquoted value", RoutingRule{Condition: `model == gpt-4`}},
+		{"ordering on model", RoutingRule{Condition: `model < "gpt-4"`}},
+		{"bad time", RoutingRule{Condition: `time_of_day < "6pm"`}},
+		{"unpadded time", RoutingRule{Condition: `time_of_day < "9:00"`}},
+		{"empty clause", RoutingRule{Condition: `model == "gpt-4" &&`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Target.KeyTags = []string{"premium"}
+			if _, err := NewRoutingRuleEngine([]RoutingRule{tt.rule}); !errors.Is(err, ErrInvalidCondition) {
+				t.Errorf("NewRoutingRuleEngine() error = %v, want %v", err, ErrInvalidCondition)
+			}
+		})
+	}
+
+	for _, target := range []RoutingTarget{{}, {KeyTags: []string{"premium"}, Strategy: "fastest"}} {
+		rule := RoutingRule{Condition: `model == "gpt-4"`, Target: target}
+		if _, err := NewRoutingRuleEngine([]RoutingRule{rule}); err == nil {
+			t.Errorf("NewRoutingRuleEngine(%+v) error = nil, want an invalid target", target)
+		}
+	}
+}
+
+func TestRoutingRuleEngine_OperatorInValue(t *testing.T) {
+	e, err := NewRoutingRuleEngine([]RoutingRule{
+		{Condition: `user_tag != "a==b"`, Target: RoutingTarget{KeyTags: []string{"t"}}},
+	})
+	if err != nil {
+		t.Fatalf("NewRoutingRuleEngine() error = %v", err)
+	}
+	if _, ok := e.Match(RouteRequest{UserTag: "a==b"}); ok {
+		t.Error("Match() = true for the excluded tag")
+	}
+	if _, ok := e.Match(RouteRequest{UserTag: "premium"}); !ok {
+		t.Error("Match() = false for another tag")
+	}
+}
+
+func TestKeyManager_GetNextKeyByTags(t *testing.T) {
+	km := NewKeyManager([]string{"free", "paid1", "paid2"}, 0, WithKeyTags(map[string][]string{
+		"paid1": {"premium", "gpt4"},
+		"paid2": {"premium"},
+	}))
+
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		key, err := km.GetNextKeyByTags([]string{"premium"}, "")
+		if err != nil {
+			t.Fatalf("GetNextKeyByTags() error = %v", err)
+		}
+		seen[key]++
+	}
+	if seen["paid1"] != 2 || seen["paid2"] != 2 {
+		t.Errorf("keys = %v, want the premium keys in rotation", seen)
+	}
+
+	for i := 0; i < 3; i++ {
+		if key, err := km.GetNextKeyByTags([]string{"gpt4", "premium"}, StrategyRandom); err != nil || key != "paid1" {
+			t.Fatalf("GetNextKeyByTags(gpt4, premium) = %s, %v, want paid1", key, err)
+		}
+	}
+
+	tried := map[string]struct{}{"paid1": {}}
+	for i := 0; i < 3; i++ {
+		if key, err := km.GetNextKeyByTagsExcluding(context.Background(), []string{"premium"}, StrategyPriority, tried); err != nil || key != "paid2" {
+			t.Fatalf("GetNextKeyByTagsExcluding(premium, paid1) = %s, %v, want paid2", key, err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := km.GetNextKeyByTagsExcluding(ctx, []string{"premium"}, "", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetNextKeyByTagsExcluding() error = %v, want context.Canceled", err)
+	}
+
+	km.MarkAsDead("paid1", "")
+	if _, err := km.GetNextKeyByTags([]string{"gpt4"}, ""); !errors.Is(err, ErrNoKeysAvailable) {
+		t.Errorf("GetNextKeyByTags() error = %v, want %v with the tagged key dead", err, ErrNoKeysAvailable)
+	}
+}
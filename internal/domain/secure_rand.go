@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// WithSecureRandom draws the StrategyRandom start key, the staggered
+// revival jitter and the provider balancer's choice from crypto/rand instead
+// of math/rand/v2, so the key a request uses cannot be predicted from
+// earlier selections. Each draw costs about a microsecond; see
+// BenchmarkSelectKey_CryptoRand. A jitter set with WithRevivalJitter is
+// still used.
+func WithSecureRandom(enabled bool) KeyManagerOption {
+	return func(km *KeyManager) {
+		if enabled {
+			km.intN, km.int64N = secureIntN, secureInt64N
+		}
+	}
+}
+
+// WeightedRandomKey picks one of keys at random with crypto/rand, each with
+// probability weight/total. Keys with a weight below 1 count as 1. It
+// returns ErrNoKeysAvailable for no keys.
+func WeightedRandomKey(keys []APIKey) (string, error) {
+	if len(keys) == 0 {
+		return "", ErrNoKeysAvailable
+	}
+	var total int64
+	for _, k := range keys {
+		total += int64(max(k.Weight, 1))
+	}
+	n, err := cryptoInt64N(total)
+	if err != nil {
+		return "", err
+	}
+	for _, k := range keys {
+		if n -= int64(max(k.Weight, 1)); n < 0 {
+			return k.Key, nil
+		}
+	}
+	return keys[len(keys)-1].Key, nil
+}
+
+// SelectKeySecure picks one of keys uniformly at random with crypto/rand.
+// It returns ErrNoKeysAvailable for no keys.
+func SelectKeySecure(keys []string) (string, error) {
+	weighted := make([]APIKey, len(keys))
+	for i, k := range keys {
+		weighted[i] = APIKey{Key: k, Weight: 1}
+	}
+	return WeightedRandomKey(weighted)
+}
+
+// cryptoInt64N returns a uniform random number in [0, n) from crypto/rand.
+func cryptoInt64N(n int64) (int64, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, fmt.Errorf("read crypto/rand: %w", err)
+	}
+	return v.Int64(), nil
+}
+
+// secureIntN and secureInt64N are randIntN and randInt64N drawn from
+// crypto/rand. They panic when the system random source fails, which leaves
+// no safe way to select keys.
+func secureIntN(n int) int {
+	return int(secureInt64N(int64(n)))
+}
+
+func secureInt64N(n int64) int64 {
+	v, err := cryptoInt64N(n)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+// chiSquared returns Pearson's chi-squared statistic of counts against the
+// expected counts.
+func chiSquared(counts map[string]int, expected map[string]float64) float64 {
+	var x2 float64
+	for k, e := range expected {
+		d := float64(counts[k]) - e
+		x2 += d * d / e
+	}
+	return x2
+}
+
+func TestSelectKeySecure_Uniform(t *testing.T) {
+	keys := benchKeys(10)
+	const samples = 100000
+
+	counts := make(map[string]int)
+	for i := 0; i < samples; i++ {
+		k, err := SelectKeySecure(keys)
+		if err != nil {
+			t.Fatalf("SelectKeySecure() error = %v", err)
+		}
+		counts[k]++
+	}
+
+	expected := make(map[string]float64)
+	for _, k := range keys {
+		expected[k] = samples / float64(len(keys))
+	}
+	// 33.72 is the chi-squared critical value for 9 degrees of freedom at
+	// p = 0.0001, so a uniform source fails about once in 10,000 runs.
+	if x2 := chiSquared(counts, expected); x2 > 33.72 {
+		t.Errorf("chi-squared = %.2f over %v, want at most 33.72 for a uniform choice", x2, counts)
+	}
+}
+
+func TestWeightedRandomKey_Distribution(t *testing.T) {
+	keys := []APIKey{
+		{Key: "a", Weight: 1},
+		{Key: "b", Weight: 3},
+		{Key: "c", Weight: 6},
+		{Key: "d"},
+	}
+	const samples = 100000
+
+	counts := make(map[string]int)
+	for i := 0; i < samples; i++ {
+		k, err := WeightedRandomKey(keys)
+		if err != nil {
+			t.Fatalf("WeightedRandomKey() error = %v", err)
+		}
+		counts[k]++
+	}
+
+	// d has no weight and counts as 1, for a total of 11.
+	expected := map[string]float64{
+		"a": samples * 1 / 11.0,
+		"b": samples * 3 / 11.0,
+		"c": samples * 6 / 11.0,
+		"d": samples * 1 / 11.0,
+	}
+	// 21.11 is the critical value for 3 degrees of freedom at p = 0.0001.
+	if x2 := chiSquared(counts, expected); x2 > 21.11 {
+		t.Errorf("chi-squared = %.2f over %v, want at most 21.11 for weights 1:3:6:1", x2, counts)
+	}
+}
+
+func TestWeightedRandomKey_NoKeys(t *testing.T) {
+	if _, err := WeightedRandomKey(nil); !errors.Is(err, ErrNoKeysAvailable) {
+		t.Errorf("WeightedRandomKey(nil) error = %v, want ErrNoKeysAvailable", err)
+	}
+	if _, err := SelectKeySecure(nil); !errors.Is(err, ErrNoKeysAvailable) {
+		t.Errorf("SelectKeySecure(nil) error = %v, want ErrNoKeysAvailable", err)
+	}
+}
+
+func TestKeyManager_WithSecureRandom(t *testing.T) {
+	keys := []string{"k1", "k2", "k3"}
+	km := NewKeyManager(keys, 0,
+		WithSecureRandom(true),
+		WithKeyTags(map[string][]string{"k1": {"x"}, "k2": {"x"}, "k3": {"x"}}),
+	)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 300; i++ {
+		k, err := km.GetNextKeyByTags([]string{"x"}, StrategyRandom)
+		if err != nil {
+			t.Fatalf("GetNextKeyByTags() error = %v", err)
+		}
+		seen[k] = true
+	}
+	if len(seen) != len(keys) {
+		t.Errorf("selected %v, want every key of %v", seen, keys)
+	}
+
+	if d := km.jitter(MaxRevivalJitter); d < 0 || d >= MaxRevivalJitter {
+		t.Errorf("jitter = %v, want within [0, %v)", d, MaxRevivalJitter)
+	}
+}
+
+// ~10 ns/op. math/rand/v2 is the default: fast, but its sequence can be
+// predicted from enough observed selections.
+func BenchmarkSelectKey_MathRand(b *testing.B) {
+	keys := benchKeys(10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = keys[rand.IntN(len(keys))]
+	}
+}
+
+// ~1 µs/op with 4 allocations: crypto/rand reads the system source and
+// allocates big.Ints. Still negligible next to the upstream call it selects
+// a key for, so use it wherever the key in use must not be predictable.
+func BenchmarkSelectKey_CryptoRand(b *testing.B) {
+	keys := benchKeys(10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := SelectKeySecure(keys); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTokenRateExceeded is returned when keys are active but every one of
+// them is skipped for its token quota, and at least one for its
+// tokens-per-minute limit, which frees up first.
+var ErrTokenRateExceeded = errors.New("all keys are over their tokens-per-minute limit")
+
+// tokenWindowSeconds is the length of the sliding window, one bucket per second.
+const tokenWindowSeconds = 60
+
+// tokenBucket holds the tokens used during one second.
+type tokenBucket struct {
+	second int64
+	tokens int64
+}
+
+// TokenRateLimiter enforces per-key tokens-per-minute limits over a sliding
+// window of the last 60 seconds, kept as a ring of one-second buckets.
+type TokenRateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]int64
+	windows map[string]*[tokenWindowSeconds]tokenBucket
+	now     func() time.Time
+}
+
+// TokenRateLimiterOption configures a TokenRateLimiter.
+type TokenRateLimiterOption func(*TokenRateLimiter)
+
+// WithTokenRateClock sets the time source, for tests.
+func WithTokenRateClock(now func() time.Time) TokenRateLimiterOption {
+	return func(l *TokenRateLimiter) { l.now = now }
+}
+
+// NewTokenRateLimiter returns a limiter enforcing limits, in tokens per
+// minute keyed by API key. Keys without a positive limit are never limited.
+func NewTokenRateLimiter(limits map[string]int64, opts ...TokenRateLimiterOption) *TokenRateLimiter {
+	l := &TokenRateLimiter{
+		limits:  make(map[string]int64, len(limits)),
+		windows: make(map[string]*[tokenWindowSeconds]tokenBucket),
+		now:     time.Now,
+	}
+	for k, n := range limits {
+		if n > 0 {
+			l.limits[k] = n
+			l.windows[k] = new([tokenWindowSeconds]tokenBucket)
+		}
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// RecordTokens adds tokens to key's bucket for the current second.
+func (l *TokenRateLimiter) RecordTokens(key string, tokens int64) {
+	if tokens <= 0 {
+		return
+	}
+	sec := l.now().Unix()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.windows[key]
+	if !ok {
+		return
+	}
+	b := &w[sec%tokenWindowSeconds]
+	if b.second != sec {
+		*b = tokenBucket{second: sec}
+	}
+	b.tokens += tokens
+}
+
+// used returns the tokens key used in the window ending now. Caller must
+// hold l.mu.
+func (l *TokenRateLimiter) used(key string, now int64) int64 {
+	w, ok := l.windows[key]
+	if !ok {
+		return 0
+	}
+	var sum int64
+	for _, b := range w {
+		if now-b.second < tokenWindowSeconds && b.second <= now {
+			sum += b.tokens
+		}
+	}
+	return sum
+}
+
+// IsOverLimit reports whether key has used its whole tokens-per-minute
+// budget in the last 60 seconds.
+func (l *TokenRateLimiter) IsOverLimit(key string) bool {
+	return l.TokensRemainingInWindow(key) == 0
+}
+
+// TokensRemainingInWindow returns how many tokens key may still use in the
+// current window, or -1 when the key has no limit.
+func (l *TokenRateLimiter) TokensRemainingInWindow(key string) int64 {
+	now := l.now().Unix()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, ok := l.limits[key]
+	if !ok {
+		return -1
+	}
+	return max(limit-l.used(key, now), 0)
+}
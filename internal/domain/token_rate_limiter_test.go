@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenRateLimiter_SlidingWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewTokenRateLimiter(map[string]int64{"key1": 100}, WithTokenRateClock(clock.Now))
+
+	l.RecordTokens("key1", 40)
+	clock.Set(clock.Now().Add(30 * time.Second))
+	l.RecordTokens("key1", 50)
+
+	if got := l.TokensRemainingInWindow("key1"); got != 10 {
+		t.Errorf("TokensRemainingInWindow() = %d, want 10", got)
+	}
+	if l.IsOverLimit("key1") {
+		t.Error("IsOverLimit() = true below the limit")
+	}
+
+	l.RecordTokens("key1", 20)
+	if got := l.TokensRemainingInWindow("key1"); got != 0 {
+		t.Errorf("TokensRemainingInWindow() = %d, want 0", got)
+	}
+	if !l.IsOverLimit("key1") {
+		t.Error("IsOverLimit() = false at the limit")
+	}
+
+	// The first 40 tokens leave the window 60 seconds after they were used.
+	clock.Set(clock.Now().Add(29 * time.Second))
+	if !l.IsOverLimit("key1") {
+		t.Error("IsOverLimit() = false before the oldest bucket expired")
+	}
+	clock.Set(clock.Now().Add(time.Second))
+	if got := l.TokensRemainingInWindow("key1"); got != 30 {
+		t.Errorf("TokensRemainingInWindow() = %d, want 30", got)
+	}
+}
+
+func TestTokenRateLimiter_UnlimitedKey(t *testing.T) {
+	l := NewTokenRateLimiter(map[string]int64{"key1": 10, "key2": 0})
+	l.RecordTokens("key2", 1000)
+	l.RecordTokens("other", 1000)
+
+	for _, k := range []string{"key2", "other"} {
+		if l.IsOverLimit(k) {
+			t.Errorf("IsOverLimit(%s) = true for a key without a limit", k)
+		}
+		if got := l.TokensRemainingInWindow(k); got != -1 {
+			t.Errorf("TokensRemainingInWindow(%s) = %d, want -1", k, got)
+		}
+	}
+}
+
+func TestKeyManager_SkipsKeysOverTokenRate(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewTokenRateLimiter(map[string]int64{"key1": 100, "key2": 100}, WithTokenRateClock(clock.Now))
+	km := NewKeyManager([]string{"key1", "key2"}, 0, WithTokenRateLimiter(l))
+
+	// Fill key1's window 59 seconds ago.
+	l.RecordTokens("key1", 100)
+	clock.Set(clock.Now().Add(59 * time.Second))
+	for i := 0; i < 4; i++ {
+		key, err := km.GetNextKey()
+		if err != nil {
+			t.Fatalf("GetNextKey() error = %v", err)
+		}
+		if key != "key2" {
+			t.Fatalf("GetNextKey() = %s, want key2 while key1 is over its rate", key)
+		}
+	}
+
+	l.RecordTokens("key2", 100)
+	if _, err := km.GetNextKey(); !errors.Is(err, ErrTokenRateExceeded) {
+		t.Fatalf("GetNextKey() error = %v, want %v", err, ErrTokenRateExceeded)
+	}
+
+	// One second later key1's tokens have left the window.
+	clock.Set(clock.Now().Add(time.Second))
+	key, err := km.GetNextKey()
+	if err != nil || key != "key1" {
+		t.Errorf("GetNextKey() = %s, %v, want key1", key, err)
+	}
+}
@@ -0,0 +1,1192 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/config"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+// AdminTokenHeader carries the shared secret that authorizes /admin requests.
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminHandler serves the operator API for inspecting and managing the key pool.
+type AdminHandler struct {
+	km      *domain.KeyManager
+	latency *domain.LatencyTracker
+	logger  *slog.Logger
+
+	snapshotPath string
+	drainTimeout time.Duration
+	tokenRate    *domain.TokenRateLimiter
+	users        *UserUsageTracker
+	baseURLs     *domain.ProviderBaseURLRegistry
+	cache        *FlashCache
+	config       *config.Configuration
+	logLevel     *LogLevel
+}
+
+// AdminHandlerOption configures an AdminHandler.
+type AdminHandlerOption func(*AdminHandler)
+
+// WithAdminLogger sets the logger.
+func WithAdminLogger(l *slog.Logger) AdminHandlerOption {
+	return func(h *AdminHandler) { h.logger = l }
+}
+
+// WithAdminLatencyTracker sets the tracker reported by GET /admin/keys/latency.
+func WithAdminLatencyTracker(t *domain.LatencyTracker) AdminHandlerOption {
+	return func(h *AdminHandler) { h.latency = t }
+}
+
+// WithAdminSnapshotPath sets the file POST /admin/snapshot writes to.
+func WithAdminSnapshotPath(path string) AdminHandlerOption {
+	return func(h *AdminHandler) { h.snapshotPath = path }
+}
+
+// WithAdminDrainTimeout bounds how long DELETE /admin/keys/:name waits for
+// requests using the key to finish.
+func WithAdminDrainTimeout(d time.Duration) AdminHandlerOption {
+	return func(h *AdminHandler) { h.drainTimeout = d }
+}
+
+// WithAdminTokenRateLimiter reports each key's remaining tokens-per-minute
+// budget from l in GET /admin/usage.
+func WithAdminTokenRateLimiter(l *domain.TokenRateLimiter) AdminHandlerOption {
+	return func(h *AdminHandler) { h.tokenRate = l }
+}
+
+// WithAdminUserUsageTracker sets the tracker served by /admin/usage/users.
+func WithAdminUserUsageTracker(t *UserUsageTracker) AdminHandlerOption {
+	return func(h *AdminHandler) { h.users = t }
+}
+
+// WithAdminBaseURLRegistry sets the registry PUT
+// /admin/providers/:type/base-url updates.
+func WithAdminBaseURLRegistry(r *domain.ProviderBaseURLRegistry) AdminHandlerOption {
+	return func(h *AdminHandler) { h.baseURLs = r }
+}
+
+// WithAdminCache sets the cache listed by GET /admin/cache/entries.
+func WithAdminCache(cache *FlashCache) AdminHandlerOption {
+	return func(h *AdminHandler) { h.cache = cache }
+}
+
+// WithAdminConfig sets the configuration served by GET /admin/config/current.
+func WithAdminConfig(cfg *config.Configuration) AdminHandlerOption {
+	return func(h *AdminHandler) { h.config = cfg }
+}
+
+// WithAdminLogLevel lets GET and PUT /admin/log-level read and change the
+// log level through l.
+func WithAdminLogLevel(l *LogLevel) AdminHandlerOption {
+	return func(h *AdminHandler) { h.logLevel = l }
+}
+
+// NewAdminHandler creates an AdminHandler for the given key manager.
+func NewAdminHandler(km *domain.KeyManager, opts ...AdminHandlerOption) *AdminHandler {
+	h := &AdminHandler{
+		km:           km,
+		logger:       slog.Default(),
+		drainTimeout: DefaultDrainTimeout,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// KeyStatus describes a single key in the pool. The key itself is always masked.
+type KeyStatus struct {
+	// Key is the masked API key.
+	Key string `json:"key"`
+
+	// Name is the configured key name, used to address the key in admin routes.
+	Name string `json:"name,omitempty"`
+
+	// Status is "active", "over_quota" for an active key that has used up its
+	// token quota, "dead", "paused" for a key paused by an admin, or
+	// "expired" for a key past its expires_at.
+	Status string `json:"status"`
+
+	// DeadSince is when the key was marked dead. Omitted for active keys.
+	DeadSince *time.Time `json:"dead_since,omitempty"`
+
+	// ExpiresAt is the key's configured expiry. Omitted for keys that never
+	// expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// AgeSeconds is how long the key has been in the pool, for rotation
+	// policies.
+	AgeSeconds int64 `json:"age_seconds"`
+}
+
+// KeyListResponse is the body returned by GET /admin/keys.
+type KeyListResponse struct {
+	// Object is always "list".
+	Object string `json:"object"`
+
+	// Data lists active keys in rotation order, then dead and expired keys
+	// oldest first.
+	Data []KeyStatus `json:"data"`
+}
+
+// HandleListKeys serves GET /admin/keys.
+func (h *AdminHandler) HandleListKeys(c *gin.Context) {
+	states := h.km.GetAllKeyStates()
+
+	resp := KeyListResponse{
+		Object: "list",
+		Data:   make([]KeyStatus, 0, len(states)),
+	}
+	for _, s := range states {
+		ks := KeyStatus{
+			Key:        security.MaskKey(s.Key),
+			Name:       s.Name,
+			Status:     "active",
+			ExpiresAt:  s.ExpiresAt,
+			AgeSeconds: h.km.KeyStats(s.Key).AgeSeconds(),
+		}
+		switch s.Status {
+		case domain.KeyStatusDraining:
+			continue
+		case domain.KeyStatusExpired, domain.KeyStatusPaused:
+			ks.Status = s.Status
+		case domain.KeyStatusDead, domain.KeyStatusHalfOpen:
+			ks.Status = "dead"
+			ks.DeadSince = s.DeadSince
+		default:
+			if h.km.IsOverQuota(s.Key) {
+				ks.Status = "over_quota"
+			}
+		}
+		resp.Data = append(resp.Data, ks)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// killDuration keeps a killed key dead until it is revived by hand.
+const killDuration = 100 * 365 * 24 * time.Hour
+
+// KeyActionResponse is the body returned by the key revive, kill, pause,
+// resume and remove routes.
+type KeyActionResponse struct {
+	// Status is the key's status after the action, "active", "dead",
+	// "paused" or "removed".
+	Status string `json:"status"`
+
+	// ActiveCount is the number of keys in rotation.
+	ActiveCount int `json:"active_count"`
+
+	// DeadCount is the number of dead keys.
+	DeadCount int `json:"dead_count"`
+}
+
+// HandleReviveKey serves POST /admin/keys/:name/revive, returning a dead key
+// to rotation without waiting for its cooldown.
+func (h *AdminHandler) HandleReviveKey(c *gin.Context) {
+	key, ok := h.keyFromPath(c)
+	if !ok {
+		return
+	}
+	h.km.ReviveKey(key)
+	h.logger.Info("key revived by admin", slog.String("name", c.Param("name")))
+	h.sendKeyStatus(c, key)
+}
+
+// HandleKillKey serves POST /admin/keys/:name/kill, taking a key out of
+// rotation until it is revived by hand.
+func (h *AdminHandler) HandleKillKey(c *gin.Context) {
+	key, ok := h.keyFromPath(c)
+	if !ok {
+		return
+	}
+	h.km.MarkAsDeadUntil(key, time.Now().Add(killDuration))
+	h.logger.Info("key killed by admin", slog.String("name", c.Param("name")))
+	h.sendKeyStatus(c, key)
+}
+
+// HandlePauseKey serves POST /admin/keys/:name/pause, taking a key out of
+// rotation until it is resumed. Unlike a killed key, a paused key is not
+// dead and is never revived.
+func (h *AdminHandler) HandlePauseKey(c *gin.Context) {
+	key, ok := h.keyFromPath(c)
+	if !ok {
+		return
+	}
+	if err := h.km.PauseKey(key); err != nil {
+		h.sendKeyConflict(c, err)
+		return
+	}
+	h.logger.Info("key paused by admin", slog.String("name", c.Param("name")))
+	h.sendKeyStatus(c, key)
+}
+
+// HandleResumeKey serves POST /admin/keys/:name/resume, returning a paused
+// key to rotation.
+func (h *AdminHandler) HandleResumeKey(c *gin.Context) {
+	key, ok := h.keyFromPath(c)
+	if !ok {
+		return
+	}
+	if err := h.km.ResumeKey(key); err != nil {
+		h.sendKeyConflict(c, err)
+		return
+	}
+	h.logger.Info("key resumed by admin", slog.String("name", c.Param("name")))
+	h.sendKeyStatus(c, key)
+}
+
+// AddKeyRequest is the body of POST /admin/keys.
+type AddKeyRequest struct {
+	// Key is the raw API key.
+	Key string `json:"key"`
+
+	// Provider is the provider the key belongs to, such as "google".
+	Provider string `json:"provider"`
+
+	// Name addresses the key in admin routes and must be unique.
+	Name string `json:"name"`
+}
+
+// HandleAddKey serves POST /admin/keys, adding a key to rotation. The key is
+// not written to the config and is lost on restart.
+func (h *AdminHandler) HandleAddKey(c *gin.Context) {
+	var req AddKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Key == "" || req.Provider == "" || req.Name == "" {
+		c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "key, provider and name are required",
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	err := h.km.AddKey(req.Key, domain.ProviderType(req.Provider), req.Name)
+	if errors.Is(err, domain.ErrKeyExists) || errors.Is(err, domain.ErrKeyNameTaken) {
+		c.JSON(http.StatusConflict, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: err.Error(),
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: err.Error(),
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	h.logger.Info("key added by admin",
+		slog.String("name", req.Name),
+		slog.String("provider", req.Provider),
+	)
+	c.JSON(http.StatusCreated, KeyStatus{Key: security.MaskKey(req.Key), Name: req.Name, Status: "active"})
+}
+
+// AddKeysRequest is the body of POST /admin/keys/batch.
+type AddKeysRequest struct {
+	// Keys are the keys to add; each needs key, provider and name.
+	Keys []AddKeyRequest `json:"keys"`
+}
+
+// RemoveKeysRequest is the body of DELETE /admin/keys/batch.
+type RemoveKeysRequest struct {
+	// Names are the names of the keys to remove.
+	Names []string `json:"names"`
+}
+
+// BatchKeysResponse is returned by the /admin/keys/batch routes.
+type BatchKeysResponse struct {
+	// Added is the number of keys added; set by POST.
+	Added int `json:"added"`
+
+	// Duplicates is the number of keys skipped because they were already in
+	// the pool or repeated in the batch; set by POST.
+	Duplicates int `json:"duplicates"`
+
+	// Removed is the number of keys removed; set by DELETE.
+	Removed int `json:"removed"`
+
+	// NotFound is the number of names no key has; set by DELETE.
+	NotFound int `json:"not_found"`
+
+	// ActiveCount is the number of keys in rotation afterwards.
+	ActiveCount int `json:"active_count"`
+
+	// DeadCount is the number of keys out of rotation afterwards.
+	DeadCount int `json:"dead_count"`
+}
+
+// HandleAddKeys serves POST /admin/keys/batch, adding several keys to
+// rotation at once. Keys already in the pool are skipped. If any key lacks
+// a field or has a name in use, no key is added. The keys are not written
+// to the config and are lost on restart.
+func (h *AdminHandler) HandleAddKeys(c *gin.Context) {
+	var req AddKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Keys) == 0 {
+		h.sendAdminError(c, http.StatusBadRequest, "invalid_request_error", "keys is required")
+		return
+	}
+	keys := make([]domain.APIKey, len(req.Keys))
+	for i, k := range req.Keys {
+		if k.Key == "" || k.Provider == "" || k.Name == "" {
+			h.sendAdminError(c, http.StatusBadRequest, "invalid_request_error",
+				fmt.Sprintf("keys[%d]: key, provider and name are required", i))
+			return
+		}
+		keys[i] = domain.APIKey{Key: k.Key, Provider: domain.ProviderType(k.Provider), Name: k.Name}
+	}
+
+	added, duplicates, err := h.km.AddKeys(keys)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, domain.ErrKeyNameTaken) {
+			status = http.StatusConflict
+		}
+		h.sendAdminError(c, status, "invalid_request_error", err.Error())
+		return
+	}
+
+	h.logger.Info("keys added by admin",
+		slog.Int("added", added),
+		slog.Int("duplicates", duplicates),
+	)
+	c.JSON(http.StatusOK, BatchKeysResponse{
+		Added:       added,
+		Duplicates:  duplicates,
+		ActiveCount: h.km.ActiveKeyCount(),
+		DeadCount:   h.km.DeadKeyCount(),
+	})
+}
+
+// HandleRemoveKeys serves DELETE /admin/keys/batch, removing the named keys
+// at once. Unlike DELETE /admin/keys/:name it does not wait for requests
+// using the keys to finish.
+func (h *AdminHandler) HandleRemoveKeys(c *gin.Context) {
+	var req RemoveKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Names) == 0 {
+		h.sendAdminError(c, http.StatusBadRequest, "invalid_request_error", "names is required")
+		return
+	}
+
+	removed, notFound := h.km.RemoveKeys(req.Names)
+	h.logger.Info("keys removed by admin",
+		slog.Int("removed", removed),
+		slog.Int("not_found", notFound),
+	)
+	c.JSON(http.StatusOK, BatchKeysResponse{
+		Removed:     removed,
+		NotFound:    notFound,
+		ActiveCount: h.km.ActiveKeyCount(),
+		DeadCount:   h.km.DeadKeyCount(),
+	})
+}
+
+// sendAdminError answers with an OpenAI-style error.
+func (h *AdminHandler) sendAdminError(c *gin.Context, status int, errType, msg string) {
+	c.JSON(status, adapter.OpenAIError{
+		Error: adapter.OpenAIErrorDetail{
+			Message: msg,
+			Type:    errType,
+		},
+	})
+}
+
+// DefaultDrainTimeout bounds key removal when WithAdminDrainTimeout is not set.
+const DefaultDrainTimeout = 30 * time.Second
+
+// HandleRemoveKey serves DELETE /admin/keys/:name, draining a key and then
+// removing it from the pool until it is added again or the router restarts.
+// If requests using the key outlast the drain timeout, the key is kept and
+// 504 is returned.
+func (h *AdminHandler) HandleRemoveKey(c *gin.Context) {
+	key, ok := h.keyFromPath(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.drainTimeout)
+	defer cancel()
+	if err := h.km.DrainAndRemove(ctx, key); err != nil {
+		status, errType := http.StatusInternalServerError, "server_error"
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			status = http.StatusGatewayTimeout
+		case errors.Is(err, domain.ErrKeyDraining):
+			status, errType = http.StatusConflict, "invalid_request_error"
+		case errors.Is(err, domain.ErrKeyNotFound):
+			status, errType = http.StatusNotFound, "not_found_error"
+		}
+		h.logger.Warn("key removal failed",
+			slog.String("name", c.Param("name")),
+			slog.String("error", err.Error()),
+		)
+		c.JSON(status, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "remove key " + c.Param("name") + ": " + err.Error(),
+				Type:    errType,
+			},
+		})
+		return
+	}
+	h.logger.Info("key removed by admin", slog.String("name", c.Param("name")))
+	c.JSON(http.StatusOK, KeyActionResponse{
+		Status:      "removed",
+		ActiveCount: h.km.ActiveKeyCount(),
+		DeadCount:   h.km.DeadKeyCount(),
+	})
+}
+
+// keyFromPath resolves the :name route parameter, sending a 404 when no key
+// has that name.
+func (h *AdminHandler) keyFromPath(c *gin.Context) (string, bool) {
+	key, ok := h.km.KeyByName(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "no key named " + c.Param("name"),
+				Type:    "not_found_error",
+			},
+		})
+	}
+	return key, ok
+}
+
+func (h *AdminHandler) sendKeyStatus(c *gin.Context, key string) {
+	status := "active"
+	switch {
+	case h.km.IsPaused(key):
+		status = domain.KeyStatusPaused
+	case h.km.IsKeyDead(key):
+		status = "dead"
+	}
+	c.JSON(http.StatusOK, KeyActionResponse{
+		Status:      status,
+		ActiveCount: h.km.ActiveKeyCount(),
+		DeadCount:   h.km.DeadKeyCount(),
+	})
+}
+
+// sendKeyConflict answers a key action the key's state does not allow, such
+// as resuming a key that is not paused, or a key removed meanwhile.
+func (h *AdminHandler) sendKeyConflict(c *gin.Context, err error) {
+	status := http.StatusConflict
+	errType := "invalid_request_error"
+	if errors.Is(err, domain.ErrKeyNotFound) {
+		status, errType = http.StatusNotFound, "not_found_error"
+	}
+	c.JSON(status, adapter.OpenAIError{
+		Error: adapter.OpenAIErrorDetail{Message: err.Error(), Type: errType},
+	})
+}
+
+// KeyLatencyStatus is a key's upstream latency as seen by the router.
+type KeyLatencyStatus struct {
+	// Key is the masked API key.
+	Key string `json:"key"`
+
+	// LatencyMS is the latency EWMA in milliseconds.
+	LatencyMS float64 `json:"latency_ms"`
+
+	// Samples is the number of requests the EWMA is based on.
+	Samples int `json:"samples"`
+}
+
+// KeyLatencyResponse is the body returned by GET /admin/keys/latency.
+type KeyLatencyResponse struct {
+	// Object is always "list".
+	Object string `json:"object"`
+
+	// Data lists measured keys, fastest first.
+	Data []KeyLatencyStatus `json:"data"`
+}
+
+// HandleKeyLatency serves GET /admin/keys/latency.
+func (h *AdminHandler) HandleKeyLatency(c *gin.Context) {
+	resp := KeyLatencyResponse{Object: "list", Data: []KeyLatencyStatus{}}
+	if h.latency != nil {
+		for k, l := range h.latency.Snapshot() {
+			resp.Data = append(resp.Data, KeyLatencyStatus{
+				Key:       security.MaskKey(k),
+				LatencyMS: float64(l.EWMA) / float64(time.Millisecond),
+				Samples:   l.Samples,
+			})
+		}
+	}
+	sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].LatencyMS < resp.Data[j].LatencyMS })
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// KeyStateListResponse is the body returned by GET /admin/keys/state.
+type KeyStateListResponse struct {
+	// Object is always "list".
+	Object string `json:"object"`
+
+	// Data lists the state of every key, with masked keys, sorted by
+	// status, then name.
+	Data []domain.KeyState `json:"data"`
+}
+
+// HandleKeyStates serves GET /admin/keys/state.
+func (h *AdminHandler) HandleKeyStates(c *gin.Context) {
+	states := h.km.GetKeyStates()
+	for i := range states {
+		states[i].Key = security.MaskKey(states[i].Key)
+	}
+	c.JSON(http.StatusOK, KeyStateListResponse{Object: "list", Data: states})
+}
+
+// HandleKeyState serves GET /admin/keys/:name/state with the full state of
+// a key, its key masked.
+func (h *AdminHandler) HandleKeyState(c *gin.Context) {
+	key, ok := h.keyFromPath(c)
+	if !ok {
+		return
+	}
+	state, ok := h.km.GetKeyState(key)
+	if !ok {
+		// Removed since the name was resolved.
+		h.sendAdminError(c, http.StatusNotFound, "not_found_error", "no key named "+c.Param("name"))
+		return
+	}
+	state.Key = security.MaskKey(state.Key)
+	c.JSON(http.StatusOK, state)
+}
+
+// AdminAuthMiddleware rejects requests whose X-Admin-Token header does not match token.
+func AdminAuthMiddleware(token string, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(AdminTokenHeader)
+		if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			logger.Warn("admin request rejected",
+				slog.String("path", c.Request.URL.Path),
+				slog.String("client_ip", clientIP(c)),
+			)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, adapter.OpenAIError{
+				Error: adapter.OpenAIErrorDetail{
+					Message: "invalid or missing " + AdminTokenHeader + " header",
+					Type:    "authentication_error",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// SnapshotResponse is the body returned by POST /admin/snapshot.
+type SnapshotResponse struct {
+	// Path is the file the snapshot was written to.
+	Path string `json:"path"`
+
+	// CreatedAt is when the snapshot was taken.
+	CreatedAt time.Time `json:"created_at"`
+
+	// ActiveCount is the number of keys in rotation in the snapshot.
+	ActiveCount int `json:"active_count"`
+
+	// DeadCount is the number of dead keys in the snapshot.
+	DeadCount int `json:"dead_count"`
+}
+
+// HandleSnapshot serves POST /admin/snapshot, writing the key pool state to
+// the snapshot path so a new instance can restore it at startup. Without a
+// snapshot path it forces a save to the key manager's state path.
+func (h *AdminHandler) HandleSnapshot(c *gin.Context) {
+	var s domain.KeyPoolSnapshot
+	var err error
+	path := h.snapshotPath
+	if path != "" {
+		s = h.km.Snapshot()
+		err = domain.WriteSnapshotFile(path, s)
+	} else {
+		path = h.km.StatePath()
+		s, err = h.km.ForceStateSave()
+	}
+
+	if errors.Is(err, domain.ErrNoStatePath) {
+		c.JSON(http.StatusNotFound, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "no snapshot path configured",
+				Type:    "not_found_error",
+			},
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to write key pool snapshot",
+			slog.String("path", path),
+			slog.String("error", err.Error()),
+		)
+		c.JSON(http.StatusInternalServerError, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "failed to write snapshot",
+				Type:    "server_error",
+			},
+		})
+		return
+	}
+
+	h.logger.Info("key pool snapshot written",
+		slog.String("path", path),
+		slog.Int("dead_keys", len(s.DeadKeys)),
+	)
+	c.JSON(http.StatusOK, SnapshotResponse{
+		Path:        path,
+		CreatedAt:   s.CreatedAt,
+		ActiveCount: len(s.ActiveKeys),
+		DeadCount:   len(s.DeadKeys),
+	})
+}
+
+// KeyUsage is a key's share of recent traffic.
+type KeyUsage struct {
+	// Key is the masked API key.
+	Key string `json:"key"`
+
+	// Name is the configured key name.
+	Name string `json:"name,omitempty"`
+
+	// Usage is the key's usage EWMA, between 0 and 1.
+	Usage float64 `json:"usage"`
+
+	// InFlight is the number of requests currently using the key.
+	InFlight int `json:"in_flight"`
+
+	// TokensRemainingInWindow is how many tokens the key may still use in
+	// the current minute. It is omitted for keys without a tokens-per-minute
+	// limit.
+	TokensRemainingInWindow *int64 `json:"tokens_remaining_in_window,omitempty"`
+}
+
+// UsageResponse is the body returned by GET /admin/usage.
+type UsageResponse struct {
+	// Requests is the number of completed requests since startup.
+	Requests int64 `json:"requests"`
+
+	// InputTokens and OutputTokens are estimated token totals since startup.
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+
+	// CostUSD is the estimated cost of those tokens.
+	CostUSD float64 `json:"cost_usd"`
+
+	// SlowRequests is the number of requests since startup that took longer
+	// than the slow request threshold.
+	SlowRequests int64 `json:"slow_requests"`
+
+	// Keys lists active keys, most used first.
+	Keys []KeyUsage `json:"keys"`
+}
+
+// HandleUsage serves GET /admin/usage.
+func (h *AdminHandler) HandleUsage(c *gin.Context) {
+	totals := GetCostTotals()
+	resp := UsageResponse{
+		Requests:     totals.Requests,
+		InputTokens:  totals.InputTokens,
+		OutputTokens: totals.OutputTokens,
+		CostUSD:      totals.CostUSD,
+		SlowRequests: SlowRequestCount(),
+		Keys:         []KeyUsage{},
+	}
+	for _, k := range h.km.GetActiveKeys() {
+		u := KeyUsage{
+			Key:      security.MaskKey(k),
+			Name:     h.km.KeyName(k),
+			Usage:    h.km.Usage(k),
+			InFlight: h.km.InFlight(k),
+		}
+		if h.tokenRate != nil {
+			if n := h.tokenRate.TokensRemainingInWindow(k); n >= 0 {
+				u.TokensRemainingInWindow = &n
+			}
+		}
+		resp.Keys = append(resp.Keys, u)
+	}
+	sort.SliceStable(resp.Keys, func(i, j int) bool { return resp.Keys[i].Usage > resp.Keys[j].Usage })
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UsageProjectionResponse is the body returned by GET /admin/usage/projection.
+type UsageProjectionResponse struct {
+	// CurrentRPS is the request rate over the last minute.
+	CurrentRPS float64 `json:"current_rps"`
+
+	// AvgInputTokens and AvgOutputTokens are the estimated tokens per
+	// request since startup.
+	AvgInputTokens  float64 `json:"avg_input_tokens"`
+	AvgOutputTokens float64 `json:"avg_output_tokens"`
+
+	// ProjectedMonthlyCostUSD is the cost of 30 days at the current rate
+	// and average token counts.
+	ProjectedMonthlyCostUSD float64 `json:"projected_monthly_cost_usd"`
+}
+
+// HandleUsageProjection serves GET /admin/usage/projection.
+func (h *AdminHandler) HandleUsageProjection(c *gin.Context) {
+	totals := GetCostTotals()
+	resp := UsageProjectionResponse{CurrentRPS: globalCostEstimator.CurrentRPS()}
+	if totals.Requests > 0 {
+		resp.AvgInputTokens = float64(totals.InputTokens) / float64(totals.Requests)
+		resp.AvgOutputTokens = float64(totals.OutputTokens) / float64(totals.Requests)
+	}
+	resp.ProjectedMonthlyCostUSD = globalCostEstimator.ProjectedMonthlyCost(resp.CurrentRPS, resp.AvgInputTokens, resp.AvgOutputTokens)
+	c.JSON(http.StatusOK, resp)
+}
+
+// UserUsageResponse is the body returned by GET /admin/usage/users.
+type UserUsageResponse struct {
+	// Users lists the users with the most tokens, most first.
+	Users []UserUsageEntry `json:"users"`
+}
+
+// HandleUserUsage serves GET /admin/usage/users, listing the top users by
+// token count. The optional limit query parameter sets how many, default
+// DefaultTopUsers.
+func (h *AdminHandler) HandleUserUsage(c *gin.Context) {
+	limit := DefaultTopUsers
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+				Error: adapter.OpenAIErrorDetail{
+					Message: "limit must be a positive integer",
+					Type:    "invalid_request_error",
+				},
+			})
+			return
+		}
+		limit = n
+	}
+
+	resp := UserUsageResponse{Users: []UserUsageEntry{}}
+	if h.users != nil {
+		resp.Users = h.users.TopUsers(limit)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleResetUserUsage serves DELETE /admin/usage/users/:id, clearing a
+// user's counters and returning the values they held.
+func (h *AdminHandler) HandleResetUserUsage(c *gin.Context) {
+	id := c.Param("id")
+	var (
+		usage UserUsage
+		found bool
+	)
+	if h.users != nil {
+		usage, found = h.users.Reset(id)
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "no usage recorded for user " + id,
+				Type:    "not_found_error",
+			},
+		})
+		return
+	}
+	h.logger.Info("user usage reset by admin", slog.String("user_id", security.Redact(id)))
+	c.JSON(http.StatusOK, UserUsageEntry{UserID: id, UserUsage: usage})
+}
+
+// SetBaseURLRequest is the body accepted by PUT /admin/providers/:type/base-url.
+type SetBaseURLRequest struct {
+	// BaseURL is the new API base URL; it must be an absolute https URL.
+	BaseURL string `json:"base_url"`
+}
+
+// ProviderBaseURLResponse is the body returned by PUT
+// /admin/providers/:type/base-url.
+type ProviderBaseURLResponse struct {
+	// Provider is the provider type, such as "google".
+	Provider string `json:"provider"`
+
+	// BaseURL is the base URL now in use.
+	BaseURL string `json:"base_url"`
+
+	// PreviousBaseURL is the base URL it replaced.
+	PreviousBaseURL string `json:"previous_base_url"`
+}
+
+// HandleSetProviderBaseURL serves PUT /admin/providers/:type/base-url,
+// pointing a provider's requests at a new base URL without a restart. The
+// change is not written to the config and is lost on restart.
+func (h *AdminHandler) HandleSetProviderBaseURL(c *gin.Context) {
+	var req SetBaseURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.BaseURL == "" {
+		c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "base_url is required",
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	provider := domain.ProviderType(c.Param("type"))
+	err := domain.ErrUnknownProvider
+	var previous string
+	if h.baseURLs != nil {
+		previous, err = h.baseURLs.SetBaseURL(provider, req.BaseURL)
+	}
+	if err != nil {
+		status, errType := http.StatusBadRequest, "invalid_request_error"
+		if errors.Is(err, domain.ErrUnknownProvider) {
+			status, errType = http.StatusNotFound, "not_found_error"
+		}
+		c.JSON(status, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "set base URL of " + string(provider) + ": " + err.Error(),
+				Type:    errType,
+			},
+		})
+		return
+	}
+
+	current := h.baseURLs.BaseURL(provider)
+	h.logger.Warn("provider base URL changed by admin",
+		slog.String("provider", string(provider)),
+		slog.String("previous_base_url", previous),
+		slog.String("base_url", current),
+	)
+	c.JSON(http.StatusOK, ProviderBaseURLResponse{
+		Provider:        string(provider),
+		BaseURL:         current,
+		PreviousBaseURL: previous,
+	})
+}
+
+// SetCooldownRequest is the body accepted by PUT /admin/config/cooldown.
+type SetCooldownRequest struct {
+	// CooldownSeconds is how long dead keys wait before they are revived;
+	// 0 disables auto-revival.
+	CooldownSeconds *int64 `json:"cooldown_seconds"`
+}
+
+// CooldownResponse is the body returned by PUT /admin/config/cooldown.
+type CooldownResponse struct {
+	// CooldownSeconds is the cooldown now in use.
+	CooldownSeconds int64 `json:"cooldown_seconds"`
+
+	// PreviousCooldownSeconds is the cooldown it replaced.
+	PreviousCooldownSeconds int64 `json:"previous_cooldown_seconds"`
+}
+
+// HandleSetCooldown serves PUT /admin/config/cooldown, changing how long dead
+// keys wait before they are revived, e.g. during a provider maintenance
+// window. It applies to keys already dead from the next revival check on.
+// The change is not written to the config and is lost on restart.
+func (h *AdminHandler) HandleSetCooldown(c *gin.Context) {
+	var req SetCooldownRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.CooldownSeconds == nil || *req.CooldownSeconds < 0 || *req.CooldownSeconds > math.MaxInt64/int64(time.Second) {
+		c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "cooldown_seconds must be a non-negative number of seconds",
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	previous := h.km.GetCooldown()
+	h.km.SetCooldown(time.Duration(*req.CooldownSeconds) * time.Second)
+	h.logger.Warn("key cooldown changed by admin",
+		slog.Duration("previous_cooldown", previous),
+		slog.Duration("cooldown", h.km.GetCooldown()),
+	)
+	c.JSON(http.StatusOK, CooldownResponse{
+		CooldownSeconds:         *req.CooldownSeconds,
+		PreviousCooldownSeconds: int64(previous / time.Second),
+	})
+}
+
+// SetStrategyRequest is the body accepted by PUT /admin/config/strategy.
+type SetStrategyRequest struct {
+	// Strategy is the key rotation strategy to switch to.
+	Strategy string `json:"strategy"`
+}
+
+// StrategyResponse is the body returned by PUT /admin/config/strategy.
+type StrategyResponse struct {
+	// Strategy is the strategy now in use.
+	Strategy string `json:"strategy"`
+
+	// PreviousStrategy is the strategy it replaced.
+	PreviousStrategy string `json:"previous_strategy"`
+}
+
+// HandleSetStrategy serves PUT /admin/config/strategy, switching the key
+// rotation strategy, e.g. from round-robin to weighted during a canary
+// deployment. Requests selecting a key from then on use the new strategy.
+// The change is not written to the config and is lost on restart.
+func (h *AdminHandler) HandleSetStrategy(c *gin.Context) {
+	var req SetStrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "request body must be a JSON object with a strategy",
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	previous := h.km.GetStrategy()
+	if err := h.km.SetStrategy(domain.RotationStrategy(req.Strategy)); err != nil {
+		c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: fmt.Sprintf("strategy %q is invalid, must be one of: round-robin, random, weighted, least-used, priority", req.Strategy),
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	h.logger.Warn("key rotation strategy changed by admin",
+		slog.String("previous_strategy", string(previous)),
+		slog.String("strategy", req.Strategy),
+	)
+	c.JSON(http.StatusOK, StrategyResponse{
+		Strategy:         req.Strategy,
+		PreviousStrategy: string(previous),
+	})
+}
+
+// DefaultCacheEntriesLimit is how many entries GET /admin/cache/entries
+// lists without a limit query parameter.
+const DefaultCacheEntriesLimit = 100
+
+// CacheEntryStatus describes one response cache entry. The cache key is
+// truncated; the response body is not included.
+type CacheEntryStatus struct {
+	KeyPrefix      string    `json:"key_prefix"`
+	SizeBytes      int       `json:"size_bytes"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastAccessedAt time.Time `json:"last_accessed_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	IdleTimeMs     int64     `json:"idle_time_ms"`
+}
+
+// CacheEntriesResponse is the body returned by GET /admin/cache/entries.
+type CacheEntriesResponse struct {
+	// Entries is the requested page of entries, ordered by cache key.
+	Entries []CacheEntryStatus `json:"entries"`
+
+	// Total is the number of entries in the cache.
+	Total int `json:"total"`
+}
+
+// HandleCacheEntries serves GET /admin/cache/entries, listing the response
+// cache entries with their age and idle time. The optional offset and limit
+// query parameters page through the entries, default 0 and
+// DefaultCacheEntriesLimit.
+func (h *AdminHandler) HandleCacheEntries(c *gin.Context) {
+	offset, ok := queryInt(c, "offset", 0, 0)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", DefaultCacheEntriesLimit, 1)
+	if !ok {
+		return
+	}
+
+	resp := CacheEntriesResponse{Entries: []CacheEntryStatus{}}
+	if h.cache == nil {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	keys := h.cache.Keys()
+	resp.Total = len(keys)
+	for _, key := range keys[min(offset, len(keys)):min(offset+limit, len(keys))] {
+		e, found := h.cache.GetEntry(key)
+		if !found {
+			continue
+		}
+		resp.Entries = append(resp.Entries, CacheEntryStatus{
+			KeyPrefix:      key[:min(12, len(key))],
+			SizeBytes:      len(e.Response),
+			CreatedAt:      e.CreatedAt,
+			LastAccessedAt: e.LastAccessedAt,
+			ExpiresAt:      e.ExpireAt,
+			IdleTimeMs:     e.IdleTime().Milliseconds(),
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleConfigSchema serves GET /admin/config/schema, the JSON Schema of
+// the configuration file.
+func (h *AdminHandler) HandleConfigSchema(c *gin.Context) {
+	schema, err := config.Schema()
+	if err != nil {
+		h.logger.Error("failed to build config schema", slog.String("error", err.Error()))
+		h.sendAdminError(c, http.StatusInternalServerError, "server_error", "failed to build config schema")
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+// HandleConfigCurrent serves GET /admin/config/current, the running
+// configuration with API keys masked and secrets left out.
+func (h *AdminHandler) HandleConfigCurrent(c *gin.Context) {
+	if h.config == nil {
+		h.sendAdminError(c, http.StatusNotFound, "invalid_request_error", "configuration is not available")
+		return
+	}
+	c.JSON(http.StatusOK, h.config.Redacted())
+}
+
+// queryInt reads the integer query parameter name, returning def when it
+// is absent. A value that is not an integer of at least minValue is
+// answered with 400 and ok false.
+func queryInt(c *gin.Context, name string, def, minValue int) (n int, ok bool) {
+	s := c.Query(name)
+	if s == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < minValue {
+		c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: fmt.Sprintf("%s must be an integer of at least %d", name, minValue),
+				Type:    "invalid_request_error",
+			},
+		})
+		return 0, false
+	}
+	return n, true
+}
+
+// SetLogLevelRequest is the body of PUT /admin/log-level.
+type SetLogLevelRequest struct {
+	// Level is the new level: debug, info, warn or error.
+	Level string `json:"level"`
+}
+
+// LogLevelResponse is the body returned by GET and PUT /admin/log-level.
+type LogLevelResponse struct {
+	// Level is the level in use.
+	Level string `json:"level"`
+
+	// ConfiguredLevel is the level from logging.level, restored at RevertAt.
+	ConfiguredLevel string `json:"configured_level"`
+
+	// RevertAt is when ConfiguredLevel is restored; omitted when Level is
+	// the configured level or levels do not revert.
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// HandleGetLogLevel serves GET /admin/log-level.
+func (h *AdminHandler) HandleGetLogLevel(c *gin.Context) {
+	if !h.requireLogLevel(c) {
+		return
+	}
+	level, revertAt := h.logLevel.Level()
+	c.JSON(http.StatusOK, h.logLevelResponse(level, revertAt))
+}
+
+// HandleSetLogLevel serves PUT /admin/log-level, changing the log level
+// without a restart, e.g. to debug a live issue. The configured level is
+// restored after admin.log_level_revert_seconds.
+func (h *AdminHandler) HandleSetLogLevel(c *gin.Context) {
+	if !h.requireLogLevel(c) {
+		return
+	}
+	var req SetLogLevelRequest
+	err := c.ShouldBindJSON(&req)
+	level, ok := parseLogLevel(req.Level)
+	if err != nil || !ok {
+		c.JSON(http.StatusBadRequest, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: "level must be one of debug, info, warn, error",
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	previous, _ := h.logLevel.Level()
+	revertAt := h.logLevel.Set(level)
+	attrs := []any{
+		slog.String("previous_level", logLevelName(previous)),
+		slog.String("level", logLevelName(level)),
+	}
+	if !revertAt.IsZero() {
+		attrs = append(attrs, slog.Time("revert_at", revertAt))
+	}
+	h.logger.Warn("log level changed by admin", attrs...)
+	c.JSON(http.StatusOK, h.logLevelResponse(level, revertAt))
+}
+
+// requireLogLevel answers 404 when the log level cannot be changed.
+func (h *AdminHandler) requireLogLevel(c *gin.Context) bool {
+	if h.logLevel != nil {
+		return true
+	}
+	c.JSON(http.StatusNotFound, adapter.OpenAIError{
+		Error: adapter.OpenAIErrorDetail{
+			Message: "the log level cannot be changed at runtime",
+			Type:    "not_found_error",
+		},
+	})
+	return false
+}
+
+func (h *AdminHandler) logLevelResponse(level slog.Level, revertAt time.Time) LogLevelResponse {
+	resp := LogLevelResponse{
+		Level:           logLevelName(level),
+		ConfiguredLevel: logLevelName(h.logLevel.Configured()),
+	}
+	if !revertAt.IsZero() {
+		resp.RevertAt = &revertAt
+	}
+	return resp
+}
+
+// parseLogLevel returns the level called name, spelled as in logging.level.
+func parseLogLevel(name string) (slog.Level, bool) {
+	switch name {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return 0, false
+}
+
+// logLevelName spells level as in logging.level.
+func logLevelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
@@ -0,0 +1,1127 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/config"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+const testAdminToken = "s3cret-admin-token"
+
+func newAdminRouter(km *domain.KeyManager, opts ...AdminHandlerOption) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewAdminHandler(km, append([]AdminHandlerOption{WithAdminLogger(logger)}, opts...)...)
+
+	r := gin.New()
+	admin := r.Group("/admin", AdminAuthMiddleware(testAdminToken, logger))
+	admin.GET("/keys", h.HandleListKeys)
+	admin.POST("/keys", h.HandleAddKey)
+	admin.POST("/keys/batch", h.HandleAddKeys)
+	admin.DELETE("/keys/batch", h.HandleRemoveKeys)
+	admin.DELETE("/keys/:name", h.HandleRemoveKey)
+	admin.GET("/usage", h.HandleUsage)
+	admin.GET("/usage/projection", h.HandleUsageProjection)
+	admin.GET("/usage/users", h.HandleUserUsage)
+	admin.DELETE("/usage/users/:id", h.HandleResetUserUsage)
+	admin.POST("/keys/:name/revive", h.HandleReviveKey)
+	admin.POST("/keys/:name/kill", h.HandleKillKey)
+	admin.POST("/keys/:name/pause", h.HandlePauseKey)
+	admin.POST("/keys/:name/resume", h.HandleResumeKey)
+	admin.GET("/keys/state", h.HandleKeyStates)
+	admin.GET("/keys/:name/state", h.HandleKeyState)
+	admin.PUT("/providers/:type/base-url", h.HandleSetProviderBaseURL)
+	admin.PUT("/config/cooldown", h.HandleSetCooldown)
+	admin.PUT("/config/strategy", h.HandleSetStrategy)
+	admin.GET("/cache/entries", h.HandleCacheEntries)
+	admin.GET("/config/schema", h.HandleConfigSchema)
+	admin.GET("/config/current", h.HandleConfigCurrent)
+	admin.GET("/log-level", h.HandleGetLogLevel)
+	admin.PUT("/log-level", h.HandleSetLogLevel)
+	return r
+}
+
+// postKeyAction calls an authorized key action route and decodes its response.
+func postKeyAction(t *testing.T, r *gin.Engine, path string) (int, KeyActionResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp KeyActionResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	r := newAdminRouter(domain.NewKeyManager([]string{"AIzaSyTestKey1234567890"}, 0))
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "guess", http.StatusUnauthorized},
+		{"valid token", testAdminToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+			if tt.token != "" {
+				req.Header.Set(AdminTokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_ListKeys(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002", "AIzaSyThirdKey000000003"}
+	km := domain.NewKeyManager(keys, time.Minute)
+	km.MarkAsDead(keys[1], "")
+
+	r := newAdminRouter(km)
+	req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var resp KeyListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Data) != 3 {
+		t.Fatalf("len(Data) = %d, want 3", len(resp.Data))
+	}
+
+	want := []struct {
+		key    string
+		status string
+	}{
+		{security.MaskKey(keys[0]), "active"},
+		{security.MaskKey(keys[2]), "active"},
+		{security.MaskKey(keys[1]), "dead"},
+	}
+	for i, w := range want {
+		got := resp.Data[i]
+		if got.Key != w.key || got.Status != w.status {
+			t.Errorf("Data[%d] = %s/%s, want %s/%s", i, got.Key, got.Status, w.key, w.status)
+		}
+	}
+	if resp.Data[0].DeadSince != nil {
+		t.Error("active key has dead_since")
+	}
+	if resp.Data[2].DeadSince == nil {
+		t.Error("dead key missing dead_since")
+	}
+
+	for _, k := range keys {
+		if strings.Contains(w.Body.String(), k) {
+			t.Errorf("response leaks raw key %s", k)
+		}
+	}
+}
+
+func TestAdminHandler_ListKeysAge(t *testing.T) {
+	added := time.Now().Add(-2 * time.Hour)
+	km := domain.NewKeyManager([]string{"AIzaSyFirstKey000000001"}, time.Minute,
+		domain.WithKeyAgeClock(func() time.Time { return added }))
+
+	r := newAdminRouter(km)
+	req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp KeyListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("len(Data) = %d, want 1", len(resp.Data))
+	}
+	if got := resp.Data[0].AgeSeconds; got < 7200 || got > 7201 {
+		t.Errorf("age_seconds = %d, want 7200", got)
+	}
+}
+
+func TestAdminHandler_ListKeysExpired(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	expiresAt := time.Now().Add(-time.Millisecond).UTC()
+	km := domain.NewKeyManager(keys, time.Minute, domain.WithKeyExpiries(map[string]time.Time{keys[1]: expiresAt}))
+	km.MarkAsDead(keys[0], "")
+
+	r := newAdminRouter(km)
+	req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp KeyListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	statuses := make(map[string]KeyStatus, len(resp.Data))
+	for _, ks := range resp.Data {
+		statuses[ks.Key] = ks
+	}
+	if ks := statuses[security.MaskKey(keys[0])]; ks.Status != "dead" || ks.ExpiresAt != nil {
+		t.Errorf("dead key = %+v, want status dead without expires_at", ks)
+	}
+	if ks := statuses[security.MaskKey(keys[1])]; ks.Status != domain.KeyStatusExpired || ks.ExpiresAt == nil || !ks.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expired key = %+v, want status expired with expires_at %v", ks, expiresAt)
+	}
+}
+
+func TestAdminHandler_ListKeysOverQuota(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	quota := domain.NewQuotaTracker(map[string]domain.QuotaLimits{keys[0]: {Daily: 100}})
+	quota.RecordUsage(keys[0], 100)
+	km := domain.NewKeyManager(keys, time.Minute, domain.WithQuotaTracker(quota))
+
+	r := newAdminRouter(km)
+	req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp KeyListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, k := range resp.Data {
+		statuses[k.Key] = k.Status
+	}
+	if got := statuses[security.MaskKey(keys[0])]; got != "over_quota" {
+		t.Errorf("status of exhausted key = %q, want over_quota", got)
+	}
+	if got := statuses[security.MaskKey(keys[1])]; got != "active" {
+		t.Errorf("status of unlimited key = %q, want active", got)
+	}
+}
+
+func TestAdminHandler_KeyLatency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	latency := domain.NewLatencyTracker(domain.DefaultLatencyAlpha)
+	latency.RecordLatency("AIzaSySlowKey000000000", 250*time.Millisecond)
+	latency.RecordLatency("AIzaSyFastKey000000000", 40*time.Millisecond)
+
+	h := NewAdminHandler(domain.NewKeyManager(nil, 0), WithAdminLatencyTracker(latency))
+	r := gin.New()
+	r.GET("/admin/keys/latency", h.HandleKeyLatency)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/keys/latency", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp KeyLatencyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("len(data) = %d, want 2", len(resp.Data))
+	}
+	if resp.Data[0].LatencyMS != 40 || resp.Data[1].LatencyMS != 250 {
+		t.Errorf("latencies = %v, %v; want 40, 250 (fastest first)", resp.Data[0].LatencyMS, resp.Data[1].LatencyMS)
+	}
+	for _, d := range resp.Data {
+		if strings.Contains(d.Key, "000000000") {
+			t.Errorf("key %s is not masked", d.Key)
+		}
+	}
+}
+
+func TestAdminHandler_KillAndRevive(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	km := domain.NewKeyManager(keys, time.Nanosecond, domain.WithKeyNames(map[string]string{
+		keys[0]: "primary",
+		keys[1]: "backup",
+	}))
+	r := newAdminRouter(km)
+
+	contains := func(list []string, key string) bool {
+		for _, k := range list {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	code, resp := postKeyAction(t, r, "/admin/keys/backup/kill")
+	if code != http.StatusOK {
+		t.Fatalf("kill status = %d, want 200", code)
+	}
+	if resp != (KeyActionResponse{Status: "dead", ActiveCount: 1, DeadCount: 1}) {
+		t.Errorf("kill response = %+v, want {dead 1 1}", resp)
+	}
+
+	// The cooldown has long passed, but a killed key stays dead.
+	time.Sleep(time.Millisecond)
+	km.GetNextKey()
+	if contains(km.GetActiveKeys(), keys[1]) {
+		t.Error("killed key is back in GetActiveKeys()")
+	}
+
+	code, resp = postKeyAction(t, r, "/admin/keys/backup/revive")
+	if code != http.StatusOK {
+		t.Fatalf("revive status = %d, want 200", code)
+	}
+	if resp != (KeyActionResponse{Status: "active", ActiveCount: 2, DeadCount: 0}) {
+		t.Errorf("revive response = %+v, want {active 2 0}", resp)
+	}
+	if !contains(km.GetActiveKeys(), keys[1]) {
+		t.Error("revived key missing from GetActiveKeys()")
+	}
+}
+
+func TestAdminHandler_PauseAndResume(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	km := domain.NewKeyManager(keys, time.Nanosecond, domain.WithKeyNames(map[string]string{
+		keys[0]: "primary",
+		keys[1]: "backup",
+	}))
+	r := newAdminRouter(km)
+
+	code, resp := postKeyAction(t, r, "/admin/keys/backup/pause")
+	if code != http.StatusOK {
+		t.Fatalf("pause status = %d, want 200", code)
+	}
+	if resp != (KeyActionResponse{Status: "paused", ActiveCount: 1, DeadCount: 0}) {
+		t.Errorf("pause response = %+v, want {paused 1 0}", resp)
+	}
+	km.ReviveExpired()
+	if !km.IsPaused(keys[1]) || km.ActiveKeyCount() != 1 {
+		t.Error("paused key returned to rotation without resume")
+	}
+
+	code, resp = postKeyAction(t, r, "/admin/keys/backup/resume")
+	if code != http.StatusOK {
+		t.Fatalf("resume status = %d, want 200", code)
+	}
+	if resp != (KeyActionResponse{Status: "active", ActiveCount: 2, DeadCount: 0}) {
+		t.Errorf("resume response = %+v, want {active 2 0}", resp)
+	}
+
+	if code, _ := postKeyAction(t, r, "/admin/keys/backup/resume"); code != http.StatusConflict {
+		t.Errorf("resume of an active key status = %d, want 409", code)
+	}
+	if code, _ := postKeyAction(t, r, "/admin/keys/missing/pause"); code != http.StatusNotFound {
+		t.Errorf("pause of an unknown key status = %d, want 404", code)
+	}
+}
+
+func TestAdminHandler_KeyState(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	km := domain.NewKeyManager(keys, time.Hour, domain.WithKeyNames(map[string]string{
+		keys[0]: "primary",
+		keys[1]: "backup",
+	}))
+	km.MarkAsDead(keys[1], "403 for key="+keys[1])
+	r := newAdminRouter(km)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(AdminTokenHeader, testAdminToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/admin/keys/backup/state")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), keys[1]) {
+		t.Errorf("state exposes the raw key: %s", w.Body.String())
+	}
+	var state domain.KeyState
+	if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if state.Status != domain.KeyStatusDead || state.Name != "backup" || state.DeathCount != 1 || state.CooldownRemainingSeconds <= 0 {
+		t.Errorf("state = %+v, want backup dead once with a cooldown left", state)
+	}
+
+	w = get("/admin/keys/state")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %d, want 200", w.Code)
+	}
+	var list KeyStateListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(list.Data) != 2 || list.Data[0].Name != "primary" || list.Data[1].Name != "backup" {
+		t.Errorf("list = %+v, want primary (active) then backup (dead)", list.Data)
+	}
+	for _, s := range list.Data {
+		if strings.Contains(s.Key, "000000") {
+			t.Errorf("key %s is not masked", s.Key)
+		}
+	}
+
+	if w := get("/admin/keys/missing/state"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown name status = %d, want 404", w.Code)
+	}
+}
+
+func TestAdminHandler_KeyActionErrors(t *testing.T) {
+	km := domain.NewKeyManager([]string{"AIzaSyFirstKey000000001"}, 0, domain.WithKeyNames(map[string]string{
+		"AIzaSyFirstKey000000001": "primary",
+		"AIzaSyNotInPool00000009": "stale",
+	}))
+	r := newAdminRouter(km)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"unknown name", "/admin/keys/missing/kill", testAdminToken, http.StatusNotFound},
+		{"name of a key outside the pool", "/admin/keys/stale/revive", testAdminToken, http.StatusNotFound},
+		{"raw key is not a name", "/admin/keys/AIzaSyFirstKey000000001/kill", testAdminToken, http.StatusNotFound},
+		{"missing token", "/admin/keys/primary/kill", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set(AdminTokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if km.ActiveKeyCount() != 1 {
+				t.Error("rejected request changed the key pool")
+			}
+		})
+	}
+}
+
+func TestAdminHandler_Snapshot(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot.json")
+	statePath := filepath.Join(dir, "state.json")
+
+	tests := []struct {
+		name      string
+		path      string
+		statePath string
+		want      string
+		status    int
+	}{
+		{"writes snapshot", path, statePath, path, http.StatusOK},
+		{"falls back to state path", "", statePath, statePath, http.StatusOK},
+		{"no path configured", "", "", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := domain.NewKeyManager(keys, time.Minute, domain.WithStatePath(tt.statePath))
+			km.MarkAsDead(keys[1], "")
+
+			gin.SetMode(gin.TestMode)
+			h := NewAdminHandler(km,
+				WithAdminLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+				WithAdminSnapshotPath(tt.path),
+			)
+			r := gin.New()
+			r.POST("/admin/snapshot", h.HandleSnapshot)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var resp SnapshotResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if resp.Path != tt.want {
+				t.Errorf("path = %q, want %q", resp.Path, tt.want)
+			}
+			if resp.ActiveCount != 1 || resp.DeadCount != 1 {
+				t.Errorf("counts = %d active/%d dead, want 1/1", resp.ActiveCount, resp.DeadCount)
+			}
+			for _, k := range keys {
+				if strings.Contains(w.Body.String(), k) {
+					t.Errorf("response leaks raw key %s", k)
+				}
+			}
+
+			s, err := domain.ReadSnapshotFile(tt.want)
+			if err != nil {
+				t.Fatalf("ReadSnapshotFile() error = %v", err)
+			}
+			if _, ok := s.DeadKeys[keys[1]]; !ok {
+				t.Error("snapshot file is missing the dead key")
+			}
+		})
+	}
+}
+
+func TestAdminHandler_AddKey(t *testing.T) {
+	km := domain.NewKeyManager([]string{"AIzaSyFirstKey000000001"}, 0,
+		domain.WithKeyNames(map[string]string{"AIzaSyFirstKey000000001": "primary"}))
+	r := newAdminRouter(km)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"added", `{"key":"AIzaSyExtraKey00000003","provider":"google","name":"extra"}`, http.StatusCreated},
+		{"duplicate key", `{"key":"AIzaSyExtraKey00000003","provider":"google","name":"other"}`, http.StatusConflict},
+		{"duplicate name", `{"key":"AIzaSyOtherKey00000004","provider":"google","name":"primary"}`, http.StatusConflict},
+		{"missing name", `{"key":"AIzaSyOtherKey00000004","provider":"google"}`, http.StatusBadRequest},
+		{"invalid JSON", `{`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/keys", strings.NewReader(tt.body))
+			req.Header.Set(AdminTokenHeader, testAdminToken)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body = %s", w.Code, tt.status, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "AIzaSyExtraKey00000003") {
+				t.Error("response leaks the raw key")
+			}
+		})
+	}
+
+	if key, ok := km.KeyByName("extra"); !ok || key != "AIzaSyExtraKey00000003" {
+		t.Errorf("KeyByName(extra) = %q, %v", key, ok)
+	}
+	if got := km.ActiveKeyCount(); got != 2 {
+		t.Errorf("ActiveKeyCount() = %d, want 2", got)
+	}
+}
+
+func TestAdminHandler_BatchKeys(t *testing.T) {
+	km := domain.NewKeyManager([]string{"AIzaSyFirstKey000000001"}, 0,
+		domain.WithKeyNames(map[string]string{"AIzaSyFirstKey000000001": "primary"}))
+	r := newAdminRouter(km)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		want   BatchKeysResponse
+	}{
+		{"missing field", http.MethodPost,
+			`{"keys":[{"key":"AIzaSyExtraKey00000003","provider":"google","name":"extra"},{"key":"AIzaSyOtherKey00000004","provider":"google"}]}`,
+			http.StatusBadRequest, BatchKeysResponse{}},
+		{"name taken", http.MethodPost,
+			`{"keys":[{"key":"AIzaSyExtraKey00000003","provider":"google","name":"extra"},{"key":"AIzaSyOtherKey00000004","provider":"google","name":"primary"}]}`,
+			http.StatusConflict, BatchKeysResponse{}},
+		{"empty batch", http.MethodPost, `{"keys":[]}`, http.StatusBadRequest, BatchKeysResponse{}},
+		{"no names", http.MethodDelete, `{}`, http.StatusBadRequest, BatchKeysResponse{}},
+		{"added", http.MethodPost,
+			`{"keys":[{"key":"AIzaSyExtraKey00000003","provider":"google","name":"extra"},{"key":"AIzaSyOtherKey00000004","provider":"google","name":"other"},{"key":"AIzaSyFirstKey000000001","provider":"google","name":"primary"}]}`,
+			http.StatusOK, BatchKeysResponse{Added: 2, Duplicates: 1, ActiveCount: 3}},
+		{"removed", http.MethodDelete, `{"names":["extra","missing"]}`,
+			http.StatusOK, BatchKeysResponse{Removed: 1, NotFound: 1, ActiveCount: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/keys/batch", strings.NewReader(tt.body))
+			req.Header.Set(AdminTokenHeader, testAdminToken)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body = %s", w.Code, tt.status, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "AIzaSyExtraKey00000003") {
+				t.Error("response leaks the raw key")
+			}
+			if w.Code != http.StatusOK {
+				if got := km.TotalKeyCount(); got != 1 {
+					t.Errorf("TotalKeyCount() = %d after a rejected batch, want 1", got)
+				}
+				return
+			}
+			var resp BatchKeysResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if resp != tt.want {
+				t.Errorf("response = %+v, want %+v", resp, tt.want)
+			}
+		})
+	}
+
+	if key, ok := km.KeyByName("other"); !ok || key != "AIzaSyOtherKey00000004" {
+		t.Errorf("KeyByName(other) = %q, %v", key, ok)
+	}
+}
+
+func TestAdminHandler_RemoveKey(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	km := domain.NewKeyManager(keys, 0,
+		domain.WithKeyNames(map[string]string{keys[0]: "primary", keys[1]: "backup"}))
+	r := newAdminRouter(km)
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/keys/backup", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp KeyActionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.Status != "removed" || resp.ActiveCount != 1 {
+		t.Errorf("response = %+v, want removed with 1 active key", resp)
+	}
+	if got := km.TotalKeyCount(); got != 1 {
+		t.Errorf("TotalKeyCount() = %d, want 1", got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want 404", w.Code)
+	}
+}
+
+func TestAdminHandler_RemoveKeyDrainTimeout(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	km := domain.NewKeyManager(keys, 0,
+		domain.WithKeyNames(map[string]string{keys[0]: "primary", keys[1]: "backup"}),
+		domain.WithMaxConcurrentPerKey(1))
+	r := newAdminRouter(km, WithAdminDrainTimeout(20*time.Millisecond))
+
+	// A request is still using the key when removal is asked for.
+	km.AcquireKey(keys[1])
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/keys/backup", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	if got := km.ActiveKeyCount(); got != 2 {
+		t.Errorf("ActiveKeyCount() = %d, want 2", got)
+	}
+
+	km.ReleaseKey(keys[1])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("status after release = %d, want 200", w.Code)
+	}
+}
+
+func TestAdminHandler_Usage(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	km := domain.NewKeyManager(keys, 0)
+	km.RecordSuccess(keys[1])
+	r := newAdminRouter(km)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp UsageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Keys) != 2 {
+		t.Fatalf("len(Keys) = %d, want 2", len(resp.Keys))
+	}
+	if resp.Keys[0].Key != security.MaskKey(keys[1]) || resp.Keys[0].Usage <= 0 {
+		t.Errorf("Keys[0] = %+v, want the used key first", resp.Keys[0])
+	}
+	for _, k := range keys {
+		if strings.Contains(w.Body.String(), k) {
+			t.Errorf("response leaks raw key %s", k)
+		}
+	}
+}
+
+func TestAdminHandler_UsageProjection(t *testing.T) {
+	ResetSavings()
+	t.Cleanup(ResetSavings)
+	for i := 0; i < 10; i++ {
+		CalculateRequestCost(100, 50, "", "")
+	}
+	r := newAdminRouter(domain.NewKeyManager([]string{"AIzaSyFirstKey000000001"}, 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/usage/projection", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp UsageProjectionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	// The requests took well under a second, which is the shortest span
+	// the rate is taken over.
+	if math.Abs(resp.CurrentRPS-10) > 0.5 {
+		t.Errorf("current_rps = %v, want about 10", resp.CurrentRPS)
+	}
+	if resp.AvgInputTokens != 100 || resp.AvgOutputTokens != 50 {
+		t.Errorf("averages = %v/%v, want 100/50", resp.AvgInputTokens, resp.AvgOutputTokens)
+	}
+	want := resp.CurrentRPS * 3600 * 24 * 30 * CalculateCost(100, 50)
+	if math.Abs(resp.ProjectedMonthlyCostUSD-want) > 1e-6 {
+		t.Errorf("projected_monthly_cost_usd = %v, want %v", resp.ProjectedMonthlyCostUSD, want)
+	}
+}
+
+func TestAdminHandler_UsageTokensRemaining(t *testing.T) {
+	keys := []string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}
+	limiter := domain.NewTokenRateLimiter(map[string]int64{keys[0]: 1000})
+	km := domain.NewKeyManager(keys, 0, domain.WithTokenRateLimiter(limiter))
+	limiter.RecordTokens(keys[0], 250)
+	r := newAdminRouter(km, WithAdminTokenRateLimiter(limiter))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp UsageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	remaining := make(map[string]*int64)
+	for _, k := range resp.Keys {
+		remaining[k.Key] = k.TokensRemainingInWindow
+	}
+	if got := remaining[security.MaskKey(keys[0])]; got == nil || *got != 750 {
+		t.Errorf("limited key tokens_remaining_in_window = %v, want 750", got)
+	}
+	if got := remaining[security.MaskKey(keys[1])]; got != nil {
+		t.Errorf("unlimited key tokens_remaining_in_window = %d, want omitted", *got)
+	}
+}
+
+func TestAdminHandler_SetProviderBaseURL(t *testing.T) {
+	const initial = "https://generativelanguage.googleapis.com/v1beta"
+
+	tests := []struct {
+		name     string
+		provider string
+		body     string
+		status   int
+		want     string
+	}{
+		{"updated", "google", `{"base_url":"https://proxy.corp.example/gemini/"}`, http.StatusOK, "https://proxy.corp.example/gemini"},
+		{"http rejected", "google", `{"base_url":"http://proxy.corp.example"}`, http.StatusBadRequest, initial},
+		{"missing base_url", "google", `{}`, http.StatusBadRequest, initial},
+		{"unknown provider", "openai", `{"base_url":"https://api.example"}`, http.StatusNotFound, initial},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := domain.NewProviderBaseURLRegistry(map[domain.ProviderType]string{domain.ProviderGoogle: initial})
+			r := newAdminRouter(domain.NewKeyManager([]string{"AIzaSyTestKey1234567890"}, 0),
+				WithAdminBaseURLRegistry(registry))
+
+			req := httptest.NewRequest(http.MethodPut, "/admin/providers/"+tt.provider+"/base-url", strings.NewReader(tt.body))
+			req.Header.Set(AdminTokenHeader, testAdminToken)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if got := registry.BaseURL(domain.ProviderGoogle); got != tt.want {
+				t.Errorf("BaseURL() = %s, want %s", got, tt.want)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp ProviderBaseURLResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			want := ProviderBaseURLResponse{Provider: "google", BaseURL: tt.want, PreviousBaseURL: initial}
+			if resp != want {
+				t.Errorf("response = %+v, want %+v", resp, want)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_SetCooldown(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   time.Duration
+	}{
+		{"updated", `{"cooldown_seconds":300}`, http.StatusOK, 300 * time.Second},
+		{"disabled", `{"cooldown_seconds":0}`, http.StatusOK, 0},
+		{"negative", `{"cooldown_seconds":-1}`, http.StatusBadRequest, time.Minute},
+		{"missing", `{}`, http.StatusBadRequest, time.Minute},
+		{"overflow", `{"cooldown_seconds":9223372036854775807}`, http.StatusBadRequest, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := domain.NewKeyManager([]string{"AIzaSyTestKey1234567890"}, time.Minute)
+			r := newAdminRouter(km)
+
+			req := httptest.NewRequest(http.MethodPut, "/admin/config/cooldown", strings.NewReader(tt.body))
+			req.Header.Set(AdminTokenHeader, testAdminToken)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if got := km.GetCooldown(); got != tt.want {
+				t.Errorf("GetCooldown() = %v, want %v", got, tt.want)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp CooldownResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			want := CooldownResponse{CooldownSeconds: int64(tt.want / time.Second), PreviousCooldownSeconds: 60}
+			if resp != want {
+				t.Errorf("response = %+v, want %+v", resp, want)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_SetStrategy(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   domain.RotationStrategy
+	}{
+		{"updated", `{"strategy":"weighted"}`, http.StatusOK, domain.StrategyWeighted},
+		{"unchanged", `{"strategy":"round-robin"}`, http.StatusOK, domain.StrategyRoundRobin},
+		{"unknown", `{"strategy":"fastest"}`, http.StatusBadRequest, domain.StrategyRoundRobin},
+		{"missing", `{}`, http.StatusBadRequest, domain.StrategyRoundRobin},
+		{"invalid JSON", `{"strategy":`, http.StatusBadRequest, domain.StrategyRoundRobin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := domain.NewKeyManager([]string{"AIzaSyTestKey1234567890"}, time.Minute)
+			r := newAdminRouter(km)
+
+			req := httptest.NewRequest(http.MethodPut, "/admin/config/strategy", strings.NewReader(tt.body))
+			req.Header.Set(AdminTokenHeader, testAdminToken)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if got := km.GetStrategy(); got != tt.want {
+				t.Errorf("GetStrategy() = %q, want %q", got, tt.want)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp StrategyResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			want := StrategyResponse{Strategy: string(tt.want), PreviousStrategy: "round-robin"}
+			if resp != want {
+				t.Errorf("response = %+v, want %+v", resp, want)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_CacheEntries(t *testing.T) {
+	cache := NewFlashCache(testCacheContext(t))
+	keys := []string{HashRequest([]byte("a")), HashRequest([]byte("b")), HashRequest([]byte("c"))}
+	for _, k := range keys {
+		cache.Set(k, []byte(`{"id":"`+k+`"}`))
+	}
+	cache.Get(keys[0])
+	sort.Strings(keys)
+	r := newAdminRouter(domain.NewKeyManager(nil, 0), WithAdminCache(cache))
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantKeys   []string
+	}{
+		{"", http.StatusOK, keys},
+		{"?limit=2", http.StatusOK, keys[:2]},
+		{"?offset=2&limit=2", http.StatusOK, keys[2:]},
+		{"?offset=5", http.StatusOK, nil},
+		{"?limit=0", http.StatusBadRequest, nil},
+		{"?offset=-1", http.StatusBadRequest, nil},
+		{"?offset=x", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/cache/entries"+tt.query, nil)
+			req.Header.Set(AdminTokenHeader, testAdminToken)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp CacheEntriesResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if resp.Total != len(keys) {
+				t.Errorf("Total = %d, want %d", resp.Total, len(keys))
+			}
+			if len(resp.Entries) != len(tt.wantKeys) {
+				t.Fatalf("len(Entries) = %d, want %d", len(resp.Entries), len(tt.wantKeys))
+			}
+			for i, e := range resp.Entries {
+				if e.KeyPrefix != tt.wantKeys[i][:12] {
+					t.Errorf("Entries[%d].KeyPrefix = %q, want %q", i, e.KeyPrefix, tt.wantKeys[i][:12])
+				}
+				if want := len(`{"id":""}`) + len(tt.wantKeys[i]); e.SizeBytes != want {
+					t.Errorf("Entries[%d].SizeBytes = %d, want %d", i, e.SizeBytes, want)
+				}
+				if e.LastAccessedAt.Before(e.CreatedAt) || !e.ExpiresAt.After(e.CreatedAt) {
+					t.Errorf("Entries[%d] times = %+v, want created <= last accessed < expires", i, e)
+				}
+			}
+			if strings.Contains(w.Body.String(), keys[0]) {
+				t.Error("response leaks a full cache key")
+			}
+		})
+	}
+}
+
+func TestHandleConfig(t *testing.T) {
+	const secret = "AIzaSyConfigKey1234567890"
+	cfg := &config.Configuration{
+		Server:  config.ServerConfig{Port: 8080},
+		KeyPool: config.KeyPoolConfig{Keys: []domain.APIKey{{Key: secret, Provider: domain.ProviderGoogle}}},
+		Admin:   config.AdminConfig{Token: testAdminToken},
+	}
+	km := domain.NewKeyManager([]string{secret}, 0)
+
+	tests := []struct {
+		name       string
+		path       string
+		opts       []AdminHandlerOption
+		wantStatus int
+	}{
+		{"schema", "/admin/config/schema", nil, http.StatusOK},
+		{"current", "/admin/config/current", []AdminHandlerOption{WithAdminConfig(cfg)}, http.StatusOK},
+		{"current without config", "/admin/config/current", nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newAdminRouter(km, tt.opts...)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status without token = %d, want 401", w.Code)
+			}
+
+			req = httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(AdminTokenHeader, testAdminToken)
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			for _, s := range []string{secret, testAdminToken} {
+				if strings.Contains(w.Body.String(), s) {
+					t.Errorf("body contains %q: %s", s, w.Body.String())
+				}
+			}
+
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			switch tt.name {
+			case "schema":
+				if body["$schema"] != config.SchemaDialect {
+					t.Errorf("$schema = %v, want %s", body["$schema"], config.SchemaDialect)
+				}
+			case "current":
+				server, _ := body["server"].(map[string]any)
+				if server["port"] != float64(8080) {
+					t.Errorf("server.port = %v, want 8080", server["port"])
+				}
+			}
+		})
+	}
+}
+
+// logLevelRequest calls an authorized /admin/log-level route and decodes its
+// response.
+func logLevelRequest(t *testing.T, r *gin.Engine, method, body string) (int, LogLevelResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body))
+	req.Header.Set(AdminTokenHeader, testAdminToken)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp LogLevelResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestAdminHandler_LogLevel(t *testing.T) {
+	level := new(slog.LevelVar)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level}))
+	km := domain.NewKeyManager([]string{"AIzaSyTestKey1234567890"}, time.Minute)
+	r := newAdminRouter(km, WithAdminLogLevel(NewLogLevel(level, time.Minute)))
+
+	logger.Debug("before")
+	if status, resp := logLevelRequest(t, r, http.MethodGet, ""); status != http.StatusOK || resp.Level != "info" || resp.RevertAt != nil {
+		t.Fatalf("GET = %d %+v, want 200 info without revert_at", status, resp)
+	}
+
+	status, resp := logLevelRequest(t, r, http.MethodPut, `{"level":"debug"}`)
+	if status != http.StatusOK || resp.Level != "debug" || resp.ConfiguredLevel != "info" || resp.RevertAt == nil {
+		t.Fatalf("PUT = %d %+v, want 200 debug reverting to info", status, resp)
+	}
+	logger.Debug("after")
+	if got := buf.String(); strings.Contains(got, `"msg":"before"`) || !strings.Contains(got, `"msg":"after"`) {
+		t.Errorf("logs = %s, want only the debug record written after the change", got)
+	}
+	if _, resp := logLevelRequest(t, r, http.MethodGet, ""); resp.Level != "debug" {
+		t.Errorf("GET level = %q, want debug", resp.Level)
+	}
+
+	for _, body := range []string{`{"level":"verbose"}`, `{}`, `not json`} {
+		if status, _ := logLevelRequest(t, r, http.MethodPut, body); status != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want 400", body, status)
+		}
+	}
+	if got := level.Level(); got != slog.LevelDebug {
+		t.Errorf("level = %v after rejected changes, want DEBUG", got)
+	}
+
+	if status, resp := logLevelRequest(t, r, http.MethodPut, `{"level":"info"}`); status != http.StatusOK || resp.RevertAt != nil {
+		t.Errorf("PUT info = %d %+v, want 200 without revert_at", status, resp)
+	}
+}
+
+func TestAdminHandler_LogLevelNotConfigured(t *testing.T) {
+	r := newAdminRouter(domain.NewKeyManager([]string{"AIzaSyTestKey1234567890"}, time.Minute))
+	if status, _ := logLevelRequest(t, r, http.MethodGet, ""); status != http.StatusNotFound {
+		t.Errorf("GET status = %d, want 404", status)
+	}
+}
+
+func TestLogLevel_Revert(t *testing.T) {
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+	ll := NewLogLevel(level, 20*time.Millisecond)
+
+	if revertAt := ll.Set(slog.LevelDebug); revertAt.IsZero() {
+		t.Fatal("Set(DEBUG) revert time is zero, want one")
+	}
+	deadline := time.Now().Add(time.Second)
+	for level.Level() != slog.LevelWarn {
+		if time.Now().After(deadline) {
+			t.Fatalf("level = %v, want WARN restored", level.Level())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, revertAt := ll.Level(); !revertAt.IsZero() {
+		t.Errorf("revert time = %v after the revert, want zero", revertAt)
+	}
+
+	ll = NewLogLevel(level, 0)
+	if revertAt := ll.Set(slog.LevelDebug); !revertAt.IsZero() {
+		t.Errorf("revert time = %v with reverting off, want zero", revertAt)
+	}
+}
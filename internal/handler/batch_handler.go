@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// DefaultMaxBatchConcurrency caps how many batch items are in flight at once.
+const DefaultMaxBatchConcurrency = 10
+
+// BatchCompletionRequest is the body of POST /v1/chat/completions/batch.
+type BatchCompletionRequest struct {
+	// Requests are processed independently; each goes through key rotation on its own.
+	Requests []adapter.OpenAIRequest `json:"requests"`
+
+	// MaxConcurrency limits parallel requests. Zero or values above the server cap use the cap.
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+}
+
+// BatchCompletionResponse holds one result per request, in request order.
+type BatchCompletionResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome of a single batch item. Exactly one of Response
+// and Error is set.
+type BatchResult struct {
+	// ID is "batch-<index>", the item's position in the request.
+	ID       string                  `json:"id"`
+	Response *adapter.OpenAIResponse `json:"response,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+// WithMaxBatchConcurrency sets the server-side cap on batch concurrency.
+func WithMaxBatchConcurrency(n int) ProxyHandlerOption {
+	return func(h *ProxyHandler) {
+		if n > 0 {
+			h.maxBatchConcurrency = n
+		}
+	}
+}
+
+// HandleBatchCompletion proxies /v1/chat/completions/batch. Items run
+// concurrently up to the effective limit; failed items are reported in their
+// result instead of failing the whole batch.
+func (h *ProxyHandler) HandleBatchCompletion(c *gin.Context) {
+	var req BatchCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+		return
+	}
+
+	if len(req.Requests) == 0 {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", "requests array is required")
+		return
+	}
+
+	if !h.applyGeminiOverrides(c) {
+		return
+	}
+
+	limit := h.maxBatchConcurrency
+	if req.MaxConcurrency > 0 && req.MaxConcurrency < limit {
+		limit = req.MaxConcurrency
+	}
+
+	results := make([]BatchResult, len(req.Requests))
+	var g errgroup.Group
+	g.SetLimit(limit)
+
+	for i, item := range req.Requests {
+		i, item := i, item
+		results[i].ID = fmt.Sprintf("batch-%d", i)
+
+		if len(item.Messages) == 0 {
+			results[i].Error = "messages array is required"
+			continue
+		}
+		if msg := h.checkCandidateCount(item.N); msg != "" {
+			results[i].Error = msg
+			continue
+		}
+		if err := adapter.ValidateContentParts(item.Messages); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if item.Logprobs {
+			results[i].Error = errLogprobs.Error()
+			continue
+		}
+
+		g.Go(func() error {
+			resp, attempts, err := h.executeWithRetry(c, item)
+			if err != nil {
+				h.logger.Error("batch item failed",
+					slog.String("id", results[i].ID),
+					slog.String("error", err.Error()),
+					slog.Int("attempts", attempts),
+				)
+				_, results[i].Error = upstreamError(err)
+				return nil
+			}
+			results[i].Response = &resp
+			return nil
+		})
+	}
+	// Item errors are recorded in results, so Wait never reports one.
+	_ = g.Wait()
+
+	// Exact counts are only used when every successful item reported them.
+	var input, output strings.Builder
+	inputExact, outputExact, allExact := 0, 0, true
+	for i, r := range results {
+		if r.Response == nil {
+			continue
+		}
+		inputExact += r.Response.Usage.PromptTokens
+		outputExact += r.Response.Usage.CompletionTokens
+		allExact = allExact && r.Response.Usage.PromptTokens > 0
+		input.WriteString(chatInputText(req.Requests[i].Messages))
+		if len(r.Response.Choices) > 0 {
+			output.WriteString(choicesText(r.Response.Choices))
+			output.WriteString(" ")
+		}
+	}
+	if !allExact {
+		inputExact, outputExact = 0, 0
+	}
+	h.recordRequestCost(c, "", inputExact, outputExact, input.String(), output.String())
+
+	c.JSON(http.StatusOK, BatchCompletionResponse{Results: results})
+}
+
+// upstreamError maps a failed provider call to the status and client-facing
+// message sent for it. Raw errors may carry request URLs, so they are not exposed.
+func upstreamError(err error) (int, string) {
+	var logprobsErr *adapter.LogprobsNotSupportedError
+	var formatErr *adapter.ResponseFormatNotSupportedError
+	var toolsErr *adapter.ToolsNotSupportedError
+	var emptyErr *adapter.EmptyResponseError
+	var timeoutErr *adapter.ProviderTimeoutError
+	switch {
+	case errors.As(err, &logprobsErr):
+		return http.StatusNotImplemented, logprobsErr.Error()
+	case errors.As(err, &formatErr):
+		return http.StatusNotImplemented, formatErr.Error()
+	case errors.As(err, &toolsErr):
+		return http.StatusNotImplemented, toolsErr.Error()
+	case errors.As(err, &emptyErr):
+		return http.StatusBadGateway, "upstream provider returned an empty response"
+	case errors.As(err, &timeoutErr):
+		return http.StatusGatewayTimeout, "upstream provider timed out"
+	case errors.Is(err, adapter.ErrInvalidResponse):
+		return http.StatusBadGateway, "upstream provider returned an invalid response"
+	case errors.Is(err, ErrQueueFull), errors.Is(err, ErrQueueTimeout), errors.Is(err, domain.ErrKeysBusy):
+		return http.StatusTooManyRequests, "all keys are busy, retry later"
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return http.StatusTooManyRequests, "all keys have used up their token quota"
+	case errors.Is(err, domain.ErrTokenRateExceeded):
+		return http.StatusTooManyRequests, "all keys are over their tokens-per-minute limit, retry later"
+	case errors.Is(err, domain.ErrProviderRateLimited):
+		return http.StatusTooManyRequests, "provider rate limit reached, retry later"
+	}
+	return http.StatusServiceUnavailable, "service temporarily unavailable"
+}
+
+// chatInputText joins message contents for token estimation.
+func chatInputText(messages []adapter.OpenAIMessage) string {
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString(m.Content)
+		b.WriteString(" ")
+	}
+	return b.String()
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// newEchoGemini answers every generateContent call with "echo: <prompt>" and
+// records the highest number of requests it saw in flight at once.
+func newEchoGemini(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+
+		var req adapter.GeminiRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt := req.Contents[0].Parts[0].Text
+
+		json.NewEncoder(w).Encode(adapter.GeminiResponse{
+			Candidates: []adapter.GeminiCandidate{{
+				Content:      adapter.GeminiContent{Role: "model", Parts: []adapter.GeminiPart{{Text: "echo: " + prompt}}},
+				FinishReason: "STOP",
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &peak
+}
+
+func postBatch(h *ProxyHandler, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/chat/completions/batch", h.HandleBatchCompletion)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func batchBody(prompts []string, maxConcurrency int) string {
+	req := BatchCompletionRequest{MaxConcurrency: maxConcurrency}
+	for _, p := range prompts {
+		var msgs []adapter.OpenAIMessage
+		if p != "" {
+			msgs = []adapter.OpenAIMessage{{Role: "user", Content: p}}
+		}
+		req.Requests = append(req.Requests, adapter.OpenAIRequest{Model: "gpt-4", Messages: msgs})
+	}
+	b, _ := json.Marshal(req)
+	return string(b)
+}
+
+func newBatchHandler(baseURL string, opts ...ProxyHandlerOption) *ProxyHandler {
+	km := domain.NewKeyManager([]string{"AIzaSyTestKey1234567890", "AIzaSyTestKey0987654321"}, 0)
+	opts = append([]ProxyHandlerOption{
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(baseURL)),
+	}, opts...)
+	return NewProxyHandler(km, nil, opts...)
+}
+
+func TestHandleBatchCompletion(t *testing.T) {
+	server, _ := newEchoGemini(t)
+	h := newBatchHandler(server.URL)
+
+	prompts := []string{"one", "two", "three", "four", "five"}
+	w := postBatch(h, batchBody(prompts, 3))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body.String())
+	}
+
+	var resp BatchCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Results) != len(prompts) {
+		t.Fatalf("len(results) = %d, want %d", len(resp.Results), len(prompts))
+	}
+
+	for i, r := range resp.Results {
+		wantID := fmt.Sprintf("batch-%d", i)
+		if r.ID != wantID {
+			t.Errorf("results[%d].ID = %s, want %s", i, r.ID, wantID)
+		}
+		if r.Error != "" || r.Response == nil {
+			t.Errorf("results[%d] error = %q, want a response", i, r.Error)
+			continue
+		}
+		if got, want := r.Response.Choices[0].Message.Content, "echo: "+prompts[i]; got != want {
+			t.Errorf("results[%d] content = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestHandleBatchCompletion_PartialFailure(t *testing.T) {
+	server, _ := newEchoGemini(t)
+	h := newBatchHandler(server.URL)
+
+	w := postBatch(h, batchBody([]string{"ok", "", "also ok"}, 0))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp BatchCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if resp.Results[1].Error == "" || resp.Results[1].Response != nil {
+		t.Errorf("results[1] = %+v, want an error and no response", resp.Results[1])
+	}
+	for _, i := range []int{0, 2} {
+		if resp.Results[i].Response == nil {
+			t.Errorf("results[%d] error = %q, want a response", i, resp.Results[i].Error)
+		}
+	}
+}
+
+func TestHandleBatchCompletion_ConcurrencyCap(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested int
+		serverCap int
+		wantMax   int32
+	}{
+		{"client limit below cap", 2, 10, 2},
+		{"client limit above cap", 50, 3, 3},
+		{"no client limit", 0, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, peak := newEchoGemini(t)
+			h := newBatchHandler(server.URL, WithMaxBatchConcurrency(tt.serverCap))
+
+			prompts := make([]string, 12)
+			for i := range prompts {
+				prompts[i] = "p"
+			}
+			if w := postBatch(h, batchBody(prompts, tt.requested)); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+
+			if got := atomic.LoadInt32(peak); got > tt.wantMax {
+				t.Errorf("peak concurrency = %d, want <= %d", got, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestHandleBatchCompletion_EmptyBatch(t *testing.T) {
+	h := newBatchHandler("http://unused.invalid")
+
+	w := postBatch(h, `{"requests":[]}`)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestProxyHandler_BatchRejectsInvalidN(t *testing.T) {
+	server, _ := newEchoGemini(t)
+	h := NewProxyHandler(domain.NewMockKeyManager(testProxyKey), nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(server.URL)),
+	)
+
+	w := postBatch(h, `{"requests":[
+		{"model":"gpt-4","messages":[{"role":"user","content":"a"}],"n":9},
+		{"model":"gpt-4","messages":[{"role":"user","content":"b"}]}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp BatchCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response JSON: %v", err)
+	}
+	if got := resp.Results[0].Error; got != "n must be between 1 and 8" {
+		t.Errorf("results[0].error = %q, want the allowed range", got)
+	}
+	if resp.Results[1].Response == nil {
+		t.Errorf("results[1] = %+v, want a response", resp.Results[1])
+	}
+}
+
+func TestProxyHandler_BatchRejectsLogprobs(t *testing.T) {
+	server, calls := newMockGemini(t, `{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`)
+	h := NewProxyHandler(domain.NewMockKeyManager(testProxyKey), nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(server.URL)),
+	)
+
+	w := postBatch(h, `{"requests":[
+		{"model":"gpt-4","messages":[{"role":"user","content":"a"}],"logprobs":true},
+		{"model":"gpt-4","messages":[{"role":"user","content":"b"}]}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp BatchCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response JSON: %v", err)
+	}
+	if got := resp.Results[0].Error; got != "logprobs not supported by Gemini provider" {
+		t.Errorf("results[0].error = %q, want the logprobs error", got)
+	}
+	if resp.Results[1].Response == nil {
+		t.Errorf("results[1] = %+v, want a response", resp.Results[1])
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("upstream calls = %d, want 1 for the valid item only", got)
+	}
+}
@@ -2,17 +2,27 @@
 package handler
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hpn/hpn-g-router/internal/ui"
+	"github.com/hpn/hpn-g-router/internal/util"
 )
 
 // ══════════════════════════════════════════════════════════════════════════════
@@ -26,19 +36,40 @@ import (
 //
 // ══════════════════════════════════════════════════════════════════════════════
 
+// Response headers describing how the response cache served a request.
+const (
+	// CacheStatusHeader is HIT, MISS or BYPASS.
+	CacheStatusHeader = "X-Cache-Status"
+
+	// CacheAgeHeader is the seconds since the cached response was stored;
+	// 0 on a MISS that stores the response.
+	CacheAgeHeader = "X-Cache-Age"
+
+	// CacheExpiresInHeader is the seconds until the cached response expires.
+	CacheExpiresInHeader = "X-Cache-Expires-In"
+)
+
+// Values of CacheStatusHeader.
+const (
+	CacheStatusHit    = "HIT"
+	CacheStatusMiss   = "MISS"
+	CacheStatusBypass = "BYPASS"
+)
+
 const (
 	// DefaultCacheTTL is the default time-to-live for cache entries.
 	DefaultCacheTTL = 5 * time.Minute
 
-	// CleanupInterval is how often the cache cleaner runs.
-	CleanupInterval = 1 * time.Minute
+	// DefaultCleanupInterval is how often the cache cleaner runs by default.
+	DefaultCleanupInterval = 1 * time.Minute
 )
 
 // CacheEntry represents a cached response with expiration time.
 type CacheEntry struct {
-	Response  []byte    // Serialized JSON response
-	ExpireAt  time.Time // When this entry expires
-	CreatedAt time.Time // When this entry was created
+	Response       []byte    // Serialized JSON response
+	ExpireAt       time.Time // When this entry expires
+	CreatedAt      time.Time // When this entry was created
+	LastAccessedAt time.Time // When Get last returned this entry
 }
 
 // IsExpired returns true if the cache entry has expired.
@@ -46,6 +77,17 @@ func (e *CacheEntry) IsExpired() bool {
 	return time.Now().After(e.ExpireAt)
 }
 
+// Age returns how long ago the entry was created.
+func (e *CacheEntry) Age() time.Duration {
+	return time.Since(e.CreatedAt)
+}
+
+// IdleTime returns how long ago the entry was last read, or created when it
+// was never read.
+func (e *CacheEntry) IdleTime() time.Duration {
+	return time.Since(e.LastAccessedAt)
+}
+
 // FlashCache is a thread-safe in-memory cache for API responses.
 type FlashCache struct {
 	mu      sync.RWMutex
@@ -53,9 +95,22 @@ type FlashCache struct {
 	ttl     time.Duration
 	logger  *slog.Logger
 
+	// cleanupInterval is how often expired entries are removed.
+	cleanupInterval time.Duration
+
+	// cleanupFunc is the pass run on each tick, replaced in tests.
+	cleanupFunc func()
+
+	// restartDelay is how long the cleanup goroutine waits after a panic.
+	restartDelay time.Duration
+
 	// Stats
-	hits   int64
-	misses int64
+	hits         int64
+	misses       int64
+	cleanupCount int64
+
+	// panicCount is how many cleanup goroutine panics were recovered.
+	panicCount atomic.Int64
 }
 
 // FlashCacheOption is a functional option for configuring FlashCache.
@@ -75,21 +130,35 @@ func WithCacheLogger(logger *slog.Logger) FlashCacheOption {
 	}
 }
 
+// WithCleanupInterval sets how often expired entries are removed.
+func WithCleanupInterval(d time.Duration) FlashCacheOption {
+	return func(c *FlashCache) {
+		c.cleanupInterval = d
+	}
+}
+
 // NewFlashCache creates a new FlashCache instance.
-// It starts a background goroutine for TTL cleanup.
-func NewFlashCache(opts ...FlashCacheOption) *FlashCache {
+// It starts a background goroutine for TTL cleanup, which runs until ctx
+// is cancelled.
+func NewFlashCache(ctx context.Context, opts ...FlashCacheOption) *FlashCache {
 	c := &FlashCache{
-		entries: make(map[string]*CacheEntry),
-		ttl:     DefaultCacheTTL,
-		logger:  slog.Default(),
+		entries:         make(map[string]*CacheEntry),
+		ttl:             DefaultCacheTTL,
+		logger:          slog.Default(),
+		cleanupInterval: DefaultCleanupInterval,
+		restartDelay:    util.DefaultRestartDelay,
 	}
+	c.cleanupFunc = c.cleanup
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
-	// Start background cleanup goroutine
-	go c.startCleanup()
+	// Start background cleanup goroutine, restarted if it panics
+	util.SafeGo(func() { c.startCleanup(ctx) }, c.logger,
+		util.WithRestartDelay(c.restartDelay),
+		util.WithOnPanic(func(any) { c.panicCount.Add(1) }),
+	)
 
 	return c
 }
@@ -104,6 +173,36 @@ func HashRequest(body []byte) string {
 // Get retrieves a cached response by key.
 // Returns the response bytes and a boolean indicating if the entry was found and valid.
 func (c *FlashCache) Get(key string) ([]byte, bool) {
+	entry, found := c.lookup(key)
+	if !found {
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+// GetWithContext is Get for a request that may be cancelled: it returns
+// ctx.Err() without touching the cache when ctx is already done.
+func (c *FlashCache) GetWithContext(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, found, err := c.lookupWithContext(ctx, key)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return entry.Response, true, nil
+}
+
+// lookupWithContext is lookup, returning ctx.Err() instead when ctx is
+// already done.
+func (c *FlashCache) lookupWithContext(ctx context.Context, key string) (*CacheEntry, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	entry, found := c.lookup(key)
+	return entry, found, nil
+}
+
+// lookup is Get returning a copy of the whole entry, as it is after the
+// access is recorded.
+func (c *FlashCache) lookup(key string) (*CacheEntry, bool) {
 	c.mu.RLock()
 	entry, exists := c.entries[key]
 	c.mu.RUnlock()
@@ -126,9 +225,39 @@ func (c *FlashCache) Get(key string) ([]byte, bool) {
 
 	c.mu.Lock()
 	c.hits++
+	entry.LastAccessedAt = time.Now()
+	e := *entry
 	c.mu.Unlock()
 
-	return entry.Response, true
+	return &e, true
+}
+
+// GetEntry returns a copy of the entry stored under key for inspection.
+// Unlike Get it does not count a hit or miss or update LastAccessedAt.
+// Expired entries are not returned.
+func (c *FlashCache) GetEntry(key string) (*CacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists := c.entries[key]
+	if !exists || entry.IsExpired() {
+		return nil, false
+	}
+	e := *entry
+	return &e, true
+}
+
+// Keys returns the keys of the cached entries, sorted.
+func (c *FlashCache) Keys() []string {
+	c.mu.RLock()
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	c.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
 }
 
 // Set stores a response in the cache with the configured TTL.
@@ -136,20 +265,66 @@ func (c *FlashCache) Set(key string, response []byte) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.set(key, response)
+}
+
+// SetWithTTL stores a response in the cache for ttl instead of the
+// configured TTL.
+func (c *FlashCache) SetWithTTL(key string, response []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setWithTTL(key, response, ttl)
+}
+
+// set stores response under key. The caller holds the write lock.
+func (c *FlashCache) set(key string, response []byte) {
+	c.setWithTTL(key, response, c.ttl)
+}
+
+// setWithTTL stores response under key for ttl. The caller holds the write
+// lock.
+func (c *FlashCache) setWithTTL(key string, response []byte, ttl time.Duration) {
+	now := time.Now()
 	c.entries[key] = &CacheEntry{
-		Response:  response,
-		ExpireAt:  time.Now().Add(c.ttl),
-		CreatedAt: time.Now(),
+		Response:       response,
+		ExpireAt:       now.Add(ttl),
+		CreatedAt:      now,
+		LastAccessedAt: now,
 	}
 }
 
-// startCleanup runs a background goroutine that periodically removes expired entries.
-func (c *FlashCache) startCleanup() {
-	ticker := time.NewTicker(CleanupInterval)
+// SetWithContext is Set for a request that may be cancelled: it stores
+// nothing and returns ctx.Err() when ctx is done before or while it waits
+// for the lock.
+func (c *FlashCache) SetWithContext(ctx context.Context, key string, response []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.set(key, response)
+	return nil
+}
+
+// startCleanup runs a background goroutine that periodically removes expired
+// entries until ctx is cancelled.
+func (c *FlashCache) startCleanup(ctx context.Context) {
+	ticker := time.NewTicker(c.cleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		c.cleanup()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.cleanupFunc()
+		}
 	}
 }
 
@@ -160,6 +335,7 @@ func (c *FlashCache) cleanup() {
 
 	now := time.Now()
 	expired := 0
+	c.cleanupCount++
 
 	for key, entry := range c.entries {
 		if now.After(entry.ExpireAt) {
@@ -176,11 +352,12 @@ func (c *FlashCache) cleanup() {
 	}
 }
 
-// Stats returns cache hit/miss statistics.
-func (c *FlashCache) Stats() (hits, misses int64, size int) {
+// Stats returns cache hit/miss statistics, how many cleanup passes have run
+// and how many cleanup goroutine panics were recovered.
+func (c *FlashCache) Stats() (hits, misses int64, size int, cleanups, panics int64) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.hits, c.misses, len(c.entries)
+	return c.hits, c.misses, len(c.entries), c.cleanupCount, c.panicCount.Load()
 }
 
 // ══════════════════════════════════════════════════════════════════════════════
@@ -192,11 +369,24 @@ func (c *FlashCache) Stats() (hits, misses int64, size int) {
 //  1. Hash the request body (SHA256)
 //  2. Check cache: HIT → Return immediately with ⚡ CACHE HIT log
 //  3. MISS → Continue to handler, cache the response
+//
+// Chat completion responses carry X-Cache-Status: HIT, MISS, or BYPASS when
+// the request could not be cached or asked for a streamed response. A HIT also carries X-Cache-Age and
+// X-Cache-Expires-In in seconds; a MISS that is stored carries
+// X-Cache-Age: 0 and the full TTL. WebSocket upgrades pass through untouched.
 func CacheMiddleware(cache *FlashCache, logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Only cache POST requests to chat completions
-		if c.Request.Method != "POST" || 
-			(c.Request.URL.Path != "/v1/chat/completions" && c.Request.URL.Path != "/chat/completions") {
+		// Only chat completions are cached
+		if c.Request.URL.Path != "/v1/chat/completions" && c.Request.URL.Path != "/chat/completions" {
+			c.Next()
+			return
+		}
+		if isWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+		if c.Request.Method != "POST" {
+			c.Header(CacheStatusHeader, CacheStatusBypass)
 			c.Next()
 			return
 		}
@@ -204,6 +394,7 @@ func CacheMiddleware(cache *FlashCache, logger *slog.Logger) gin.HandlerFunc {
 		// Read request body
 		bodyBytes, err := io.ReadAll(c.Request.Body)
 		if err != nil {
+			c.Header(CacheStatusHeader, CacheStatusBypass)
 			c.Next()
 			return
 		}
@@ -211,11 +402,25 @@ func CacheMiddleware(cache *FlashCache, logger *slog.Logger) gin.HandlerFunc {
 		// Restore body for downstream handlers
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
+		// Streamed responses are neither served from nor stored in the cache
+		if wantsEventStream(c) || requestsStream(bodyBytes) {
+			c.Header(CacheStatusHeader, CacheStatusBypass)
+			c.Next()
+			return
+		}
+
 		// Generate cache key
 		cacheKey := HashRequest(bodyBytes)
+		c.Set(cacheKeyKey, cacheKey)
 
-		// Check cache
-		if cachedResponse, found := cache.Get(cacheKey); found {
+		// Check cache; a request already cancelled goes on without it
+		entry, found, err := cache.lookupWithContext(c.Request.Context(), cacheKey)
+		if err != nil {
+			c.Header(CacheStatusHeader, CacheStatusBypass)
+			c.Next()
+			return
+		}
+		if found {
 			// ⚡ CACHE HIT!
 			start := time.Now()
 			latency := time.Since(start) // ~0ms
@@ -235,16 +440,21 @@ func CacheMiddleware(cache *FlashCache, logger *slog.Logger) gin.HandlerFunc {
 			c.Set("cache_hit", true)
 
 			// Return cached response directly
-			c.Data(http.StatusOK, "application/json", cachedResponse)
+			c.Header(CacheStatusHeader, CacheStatusHit)
+			c.Header(CacheAgeHeader, formatSeconds(entry.Age()))
+			c.Header(CacheExpiresInHeader, formatSeconds(time.Until(entry.ExpireAt)))
+			c.Data(http.StatusOK, "application/json", entry.Response)
 			c.Abort()
 			return
 		}
 
 		// CACHE MISS - Continue to handler
 		// Use a response writer wrapper to capture the response
+		c.Header(CacheStatusHeader, CacheStatusMiss)
 		writer := &responseWriter{
 			ResponseWriter: c.Writer,
 			body:           &bytes.Buffer{},
+			ttl:            cache.ttl,
 		}
 		c.Writer = writer
 
@@ -252,11 +462,20 @@ func CacheMiddleware(cache *FlashCache, logger *slog.Logger) gin.HandlerFunc {
 		c.Next()
 
 		// Only cache successful responses (200 OK)
-		if c.Writer.Status() == http.StatusOK {
-			cache.Set(cacheKey, writer.body.Bytes())
+		if writer.Status() == http.StatusOK && !writer.hijacked {
+			// A client that went away does not get its response cached
+			if err := cache.SetWithContext(c.Request.Context(), cacheKey, writer.body.Bytes()); err != nil {
+				if logger != nil {
+					requestLogger(c, logger).Debug("response not cached",
+						slog.String("cache_key", cacheKey[:12]+"..."),
+						slog.String("error", err.Error()),
+					)
+				}
+				return
+			}
 
 			if logger != nil {
-				logger.Debug("response cached",
+				requestLogger(c, logger).Debug("response cached",
 					slog.String("cache_key", cacheKey[:12]+"..."),
 					slog.Int("size_bytes", writer.body.Len()),
 				)
@@ -265,14 +484,122 @@ func CacheMiddleware(cache *FlashCache, logger *slog.Logger) gin.HandlerFunc {
 	}
 }
 
-// responseWriter wraps gin.ResponseWriter to capture the response body.
+// isWebSocketUpgrade reports whether r asks to switch the connection to the
+// WebSocket protocol.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// requestsStream reports whether a chat completion body sets stream.
+func requestsStream(body []byte) bool {
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	return json.Unmarshal(body, &req) == nil && req.Stream
+}
+
+// responseWriter wraps gin.ResponseWriter to capture the response status
+// and body.
 type responseWriter struct {
 	gin.ResponseWriter
 	body *bytes.Buffer
+
+	// status is the status code the response is sent with, set by the
+	// first WriteHeader before the body is written.
+	status int
+
+	// ttl is the lifetime of the entry a 200 response is stored as,
+	// announced in the cache headers before the body is written.
+	ttl        time.Duration
+	headerDone bool
+
+	// hijacked is set once a handler took over the connection; nothing
+	// written since is a response that can be cached.
+	hijacked bool
+}
+
+// errNotHijacker is returned by Hijack when the connection under the
+// response writer cannot be taken over, as with httptest.ResponseRecorder.
+var errNotHijacker = errors.New("response writer does not implement http.Hijacker")
+
+// Hijack lets a handler take over the connection, such as for a WebSocket
+// upgrade. gin's writer panics when the writer under it cannot be hijacked,
+// so that is checked first.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !canHijack(w.ResponseWriter) {
+		return nil, nil, errNotHijacker
+	}
+	conn, rw, err := w.ResponseWriter.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// canHijack reports whether the innermost writer under w, found through
+// Unwrap methods, implements http.Hijacker.
+func canHijack(w http.ResponseWriter) bool {
+	for {
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			_, ok := w.(http.Hijacker)
+			return ok
+		}
+		w = u.Unwrap()
+	}
+}
+
+// WriteHeader adds the cache age headers to a 200 response, which will be
+// stored, before passing the status on.
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.ResponseWriter.Written() {
+		w.status = code
+	}
+	w.setCacheHeaders(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Status returns the status code stored by WriteHeader, falling back to the
+// original writer's.
+func (w *responseWriter) Status() int {
+	if w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
 }
 
 // Write captures the response body while writing to the original writer.
 func (w *responseWriter) Write(b []byte) (int, error) {
+	w.setCacheHeaders(w.Status())
 	w.body.Write(b)
 	return w.ResponseWriter.Write(b)
 }
+
+// WriteString captures the response body while writing to the original
+// writer, which would otherwise bypass Write.
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.setCacheHeaders(w.Status())
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseWriter) setCacheHeaders(code int) {
+	if w.headerDone || w.ResponseWriter.Written() {
+		return
+	}
+	w.headerDone = true
+	if code == http.StatusOK {
+		w.Header().Set(CacheAgeHeader, "0")
+		w.Header().Set(CacheExpiresInHeader, formatSeconds(w.ttl))
+	}
+}
+
+// formatSeconds formats d as seconds with millisecond precision.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(max(d, 0).Seconds(), 'f', 3, 64)
+}
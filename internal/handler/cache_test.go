@@ -2,10 +2,39 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/goleak"
 )
 
+// testCacheContext returns a context cancelled when t ends, stopping the
+// cache's cleanup goroutine.
+func testCacheContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return ctx
+}
+
 // ============================================================================
 // FLASH CACHE UNIT TESTS
 // ============================================================================
@@ -43,7 +72,7 @@ func TestHashRequest(t *testing.T) {
 func TestFlashCacheGetSet(t *testing.T) {
 	t.Log("=== TEST: Flash Cache Get/Set ===")
 
-	cache := NewFlashCache()
+	cache := NewFlashCache(testCacheContext(t))
 
 	key := "test-key-123"
 	value := []byte(`{"id":"chatcmpl-123","object":"chat.completion"}`)
@@ -77,12 +106,56 @@ func TestFlashCacheGetSet(t *testing.T) {
 	t.Log("=== TEST PASSED: Flash Cache Get/Set ===")
 }
 
+// TestFlashCacheLastAccessedAt verifies that every Get advances
+// LastAccessedAt and that GetEntry does not.
+func TestFlashCacheLastAccessedAt(t *testing.T) {
+	cache := NewFlashCache(testCacheContext(t))
+	cache.Set("key", []byte(`{}`))
+
+	entry, found := cache.GetEntry("key")
+	if !found {
+		t.Fatal("GetEntry() found = false, want true")
+	}
+	if !entry.LastAccessedAt.Equal(entry.CreatedAt) {
+		t.Errorf("LastAccessedAt = %v, want CreatedAt %v before any Get", entry.LastAccessedAt, entry.CreatedAt)
+	}
+
+	last := entry.LastAccessedAt
+	for i := 0; i < 3; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if _, found := cache.Get("key"); !found {
+			t.Fatalf("Get() #%d found = false, want true", i+1)
+		}
+		entry, _ = cache.GetEntry("key")
+		if !entry.LastAccessedAt.After(last) {
+			t.Errorf("Get() #%d: LastAccessedAt = %v, want after %v", i+1, entry.LastAccessedAt, last)
+		}
+		last = entry.LastAccessedAt
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	entry, _ = cache.GetEntry("key")
+	if !entry.LastAccessedAt.Equal(last) {
+		t.Errorf("GetEntry() moved LastAccessedAt to %v, want %v", entry.LastAccessedAt, last)
+	}
+	if entry.IdleTime() < 5*time.Millisecond || entry.Age() < entry.IdleTime() {
+		t.Errorf("Age() = %v, IdleTime() = %v, want Age >= IdleTime >= 5ms", entry.Age(), entry.IdleTime())
+	}
+	if hits, misses, _, _, _ := cache.Stats(); hits != 3 || misses != 0 {
+		t.Errorf("Stats() hits, misses = %d, %d, want 3, 0", hits, misses)
+	}
+
+	if _, found := cache.GetEntry("missing"); found {
+		t.Error("GetEntry(missing) found = true, want false")
+	}
+}
+
 // TestFlashCacheExpiration tests that cache entries expire after TTL.
 func TestFlashCacheExpiration(t *testing.T) {
 	t.Log("=== TEST: Flash Cache Expiration ===")
 
 	// Use very short TTL for testing (100ms)
-	cache := NewFlashCache(WithCacheTTL(100 * time.Millisecond))
+	cache := NewFlashCache(testCacheContext(t), WithCacheTTL(100*time.Millisecond))
 
 	key := "expiring-key"
 	value := []byte(`{"expires":"soon"}`)
@@ -116,17 +189,17 @@ func TestFlashCacheExpiration(t *testing.T) {
 func TestFlashCacheStats(t *testing.T) {
 	t.Log("=== TEST: Flash Cache Stats ===")
 
-	cache := NewFlashCache()
+	cache := NewFlashCache(testCacheContext(t))
 
 	// Initial stats
-	hits, misses, size := cache.Stats()
+	hits, misses, size, _, _ := cache.Stats()
 	if hits != 0 || misses != 0 || size != 0 {
 		t.Errorf("Expected empty stats, got hits=%d misses=%d size=%d", hits, misses, size)
 	}
 
 	// One miss
 	cache.Get("nonexistent")
-	hits, misses, size = cache.Stats()
+	hits, misses, size, _, _ = cache.Stats()
 	if misses != 1 {
 		t.Errorf("Expected 1 miss, got %d", misses)
 	}
@@ -134,7 +207,7 @@ func TestFlashCacheStats(t *testing.T) {
 	// Set and hit
 	cache.Set("key1", []byte("value1"))
 	cache.Get("key1")
-	hits, misses, size = cache.Stats()
+	hits, misses, size, _, _ = cache.Stats()
 	if hits != 1 {
 		t.Errorf("Expected 1 hit, got %d", hits)
 	}
@@ -150,7 +223,7 @@ func TestFlashCacheStats(t *testing.T) {
 func TestFlashCacheConcurrency(t *testing.T) {
 	t.Log("=== TEST: Flash Cache Concurrency ===")
 
-	cache := NewFlashCache()
+	cache := NewFlashCache(testCacheContext(t))
 
 	// Run 100 concurrent goroutines
 	done := make(chan bool, 100)
@@ -178,3 +251,355 @@ func TestFlashCacheConcurrency(t *testing.T) {
 	t.Log("✓ No race conditions (run with -race to verify)")
 	t.Log("=== TEST PASSED: Flash Cache Concurrency ===")
 }
+
+// TestFlashCacheCleanupStops verifies the cleanup goroutine runs on its
+// interval and exits when the context is cancelled.
+func TestFlashCacheCleanupStops(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := NewFlashCache(ctx,
+		WithCacheTTL(time.Millisecond),
+		WithCleanupInterval(5*time.Millisecond),
+	)
+	cache.Set("key1", []byte("value1"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, _, size, cleanups, _ := cache.Stats()
+		if cleanups > 0 && size == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cleanup did not run: cleanups=%d size=%d", cleanups, size)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+}
+
+// TestFlashCacheCleanupRecoversPanic verifies a panicking cleanup pass is
+// counted and the cleanup goroutine is restarted.
+func TestFlashCacheCleanupRecoversPanic(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls atomic.Int32
+	cache := NewFlashCache(ctx,
+		WithCacheLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithCleanupInterval(time.Millisecond),
+		func(c *FlashCache) {
+			c.restartDelay = time.Millisecond
+			c.cleanupFunc = func() {
+				if calls.Add(1) == 1 {
+					panic("cleanup bug")
+				}
+			}
+		},
+	)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for calls.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("cleanup not restarted: calls = %d", calls.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, _, _, panics := cache.Stats(); panics != 1 {
+		t.Errorf("panics = %d, want 1", panics)
+	}
+
+	cancel()
+}
+
+// TestCacheMiddlewareHeaders verifies the cache status and age headers of a
+// miss, a hit 100ms later, an uncached error and a bypassed request.
+func TestCacheMiddlewareHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := NewFlashCache(testCacheContext(t), WithCacheTTL(time.Minute))
+	r := gin.New()
+	r.Use(CacheMiddleware(cache, nil))
+	r.Any("/v1/chat/completions", func(c *gin.Context) {
+		if strings.Contains(c.GetHeader("X-Test"), "fail") {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "upstream"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": "chatcmpl-1"})
+	})
+
+	do := func(method, body, test string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("X-Test", test)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	seconds := func(t *testing.T, w *httptest.ResponseRecorder, header string) time.Duration {
+		t.Helper()
+		f, err := strconv.ParseFloat(w.Header().Get(header), 64)
+		if err != nil {
+			t.Fatalf("%s = %q, want seconds", header, w.Header().Get(header))
+		}
+		return time.Duration(f * float64(time.Second))
+	}
+
+	miss := do(http.MethodPost, `{"n":1}`, "")
+	if got := miss.Header().Get(CacheStatusHeader); got != CacheStatusMiss {
+		t.Errorf("miss %s = %q, want %q", CacheStatusHeader, got, CacheStatusMiss)
+	}
+	if got := miss.Header().Get(CacheAgeHeader); got != "0" {
+		t.Errorf("miss %s = %q, want 0", CacheAgeHeader, got)
+	}
+	if got := seconds(t, miss, CacheExpiresInHeader); got != time.Minute {
+		t.Errorf("miss %s = %v, want %v", CacheExpiresInHeader, got, time.Minute)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	hit := do(http.MethodPost, `{"n":1}`, "")
+	if got := hit.Header().Get(CacheStatusHeader); got != CacheStatusHit {
+		t.Errorf("hit %s = %q, want %q", CacheStatusHeader, got, CacheStatusHit)
+	}
+	if age := seconds(t, hit, CacheAgeHeader); age < 50*time.Millisecond || age > 150*time.Millisecond {
+		t.Errorf("hit %s = %v, want about 100ms", CacheAgeHeader, age)
+	}
+	if expiresIn := seconds(t, hit, CacheExpiresInHeader); expiresIn > time.Minute-50*time.Millisecond || expiresIn < time.Minute-time.Second {
+		t.Errorf("hit %s = %v, want about %v", CacheExpiresInHeader, expiresIn, time.Minute-100*time.Millisecond)
+	}
+
+	failed := do(http.MethodPost, `{"n":2}`, "fail")
+	if got := failed.Header().Get(CacheStatusHeader); got != CacheStatusMiss {
+		t.Errorf("failed %s = %q, want %q", CacheStatusHeader, got, CacheStatusMiss)
+	}
+	if got := failed.Header().Get(CacheAgeHeader); got != "" {
+		t.Errorf("failed %s = %q, want none for a response that is not cached", CacheAgeHeader, got)
+	}
+
+	bypass := do(http.MethodGet, "", "")
+	if got := bypass.Header().Get(CacheStatusHeader); got != CacheStatusBypass {
+		t.Errorf("GET %s = %q, want %q", CacheStatusHeader, got, CacheStatusBypass)
+	}
+
+	for i := 0; i < 2; i++ {
+		streamed := do(http.MethodPost, `{"n":3,"stream":true}`, "")
+		if got := streamed.Header().Get(CacheStatusHeader); got != CacheStatusBypass {
+			t.Errorf("streamed request #%d %s = %q, want %q", i+1, CacheStatusHeader, got, CacheStatusBypass)
+		}
+	}
+	if _, _, size, _, _ := cache.Stats(); size != 1 {
+		t.Errorf("cache size = %d, want 1; streamed responses must not be stored", size)
+	}
+}
+
+// TestFlashCacheWithContext verifies that the context-aware variants leave
+// the cache alone for a cancelled context.
+func TestFlashCacheWithContext(t *testing.T) {
+	cache := NewFlashCache(testCacheContext(t))
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := cache.SetWithContext(cancelled, "k", []byte("v")); !errors.Is(err, context.Canceled) {
+		t.Errorf("SetWithContext(cancelled) error = %v, want context.Canceled", err)
+	}
+	if _, _, size, _, _ := cache.Stats(); size != 0 {
+		t.Errorf("cache size = %d after a cancelled SetWithContext, want 0", size)
+	}
+
+	if err := cache.SetWithContext(context.Background(), "k", []byte("v")); err != nil {
+		t.Fatalf("SetWithContext() error = %v", err)
+	}
+	if _, found, err := cache.GetWithContext(cancelled, "k"); !errors.Is(err, context.Canceled) || found {
+		t.Errorf("GetWithContext(cancelled) = found %v, error %v; want not found, context.Canceled", found, err)
+	}
+	if hits, misses, _, _, _ := cache.Stats(); hits != 0 || misses != 0 {
+		t.Errorf("hits, misses = %d, %d after a cancelled GetWithContext, want 0, 0", hits, misses)
+	}
+
+	got, found, err := cache.GetWithContext(context.Background(), "k")
+	if err != nil || !found || string(got) != "v" {
+		t.Errorf("GetWithContext() = %q, %v, %v; want \"v\", true, nil", got, found, err)
+	}
+}
+
+// TestCacheMiddlewareClientGone verifies that the response to a request
+// whose client disconnected is not cached.
+func TestCacheMiddlewareClientGone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := NewFlashCache(testCacheContext(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	r := gin.New()
+	r.Use(CacheMiddleware(cache, nil))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		cancel()
+		c.JSON(http.StatusOK, gin.H{"id": "chatcmpl-1"})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"n":1}`)).WithContext(ctx)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if _, _, size, _, _ := cache.Stats(); size != 0 {
+		t.Errorf("cache size = %d, want 0 for a disconnected client", size)
+	}
+}
+
+// TestCacheMiddlewareWriteString verifies that responses written with
+// WriteString, as c.String does, are stored with their status and body.
+func TestCacheMiddlewareWriteString(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := NewFlashCache(testCacheContext(t))
+	r := gin.New()
+	r.Use(CacheMiddleware(cache, nil))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		switch c.GetHeader("X-Test") {
+		case "raw":
+			c.Status(http.StatusOK)
+			c.Writer.WriteString("hello raw")
+		case "fail":
+			c.Status(http.StatusTeapot)
+			c.Writer.WriteString("teapot")
+		default:
+			c.String(http.StatusOK, "hello")
+		}
+	})
+
+	do := func(body, test string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("X-Test", test)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(`{"n":1}`, ""); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("miss = %d %q, want 200 \"hello\"", w.Code, w.Body.String())
+	}
+	stored, found := cache.Get(HashRequest([]byte(`{"n":1}`)))
+	if !found || string(stored) != "hello" {
+		t.Errorf("cached body = %q, %v; want \"hello\", true", stored, found)
+	}
+	if w := do(`{"n":1}`, ""); w.Header().Get(CacheStatusHeader) != CacheStatusHit || w.Body.String() != "hello" {
+		t.Errorf("hit = %s %q, want a cache hit with \"hello\"", w.Header().Get(CacheStatusHeader), w.Body.String())
+	}
+
+	do(`{"n":2}`, "raw")
+	if stored, found := cache.Get(HashRequest([]byte(`{"n":2}`))); !found || string(stored) != "hello raw" {
+		t.Errorf("cached raw body = %q, %v; want \"hello raw\", true", stored, found)
+	}
+
+	if w := do(`{"n":3}`, "fail"); w.Code != http.StatusTeapot {
+		t.Errorf("failed status = %d, want %d", w.Code, http.StatusTeapot)
+	}
+	if _, _, size, _, _ := cache.Stats(); size != 2 {
+		t.Errorf("cache size = %d, want 2; a 418 response must not be stored", size)
+	}
+}
+
+// ============================================================================
+// WebSocket upgrades
+// ============================================================================
+
+const testWebSocketKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// webSocketAccept returns the Sec-WebSocket-Accept value for key (RFC 6455).
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// webSocketEcho completes a WebSocket handshake on a hijacked connection,
+// then echoes one line.
+func webSocketEcho(c *gin.Context) {
+	conn, rw, err := c.Writer.Hijack()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		webSocketAccept(c.GetHeader("Sec-WebSocket-Key")))
+	rw.Flush()
+	line, _ := rw.ReadString('\n')
+	rw.WriteString(line)
+	rw.Flush()
+}
+
+// dialWebSocket upgrades a connection to rawURL, checks the handshake and
+// checks that a line sent over it comes back.
+func dialWebSocket(t *testing.T, rawURL string) *http.Response {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\nAccept-Encoding: gzip\r\n\r\n", u.Path, u.Host, testWebSocketKey)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status = %d, want 101: %s", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != webSocketAccept(testWebSocketKey) {
+		t.Errorf("Sec-WebSocket-Accept = %q, want %q", got, webSocketAccept(testWebSocketKey))
+	}
+
+	io.WriteString(conn, "ping\n")
+	if line, err := br.ReadString('\n'); err != nil || line != "ping\n" {
+		t.Errorf("echo = %q, %v, want ping", line, err)
+	}
+	return resp
+}
+
+func TestResponseWriter_Hijack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Writer = &responseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Next()
+	})
+	r.GET("/ws", webSocketEcho)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	dialWebSocket(t, server.URL+"/ws")
+
+	// A writer that cannot be hijacked is an error, not a panic.
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	rw := &responseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+	if _, _, err := rw.Hijack(); !errors.Is(err, errNotHijacker) {
+		t.Errorf("Hijack() error = %v, want errNotHijacker", err)
+	}
+}
+
+func TestCacheMiddleware_WebSocketUpgrade(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := NewFlashCache(testCacheContext(t))
+	r := gin.New()
+	r.Use(CompressionMiddleware(gzip.DefaultCompression, WithCompressionCache(cache)))
+	r.Use(CacheMiddleware(cache, nil))
+	r.GET("/v1/chat/completions", webSocketEcho)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp := dialWebSocket(t, server.URL+"/v1/chat/completions")
+	if got := resp.Header.Get(CacheStatusHeader); got != "" {
+		t.Errorf("%s = %q on an upgrade, want none", CacheStatusHeader, got)
+	}
+	if keys := cache.Keys(); len(keys) != 0 {
+		t.Errorf("cache holds %d entries after an upgrade, want 0", len(keys))
+	}
+}
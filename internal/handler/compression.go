@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCompressionMinSize is the smallest response body, in bytes,
+// CompressionMiddleware compresses. Smaller bodies gain little and cost a
+// gzip header.
+const DefaultCompressionMinSize = 1024
+
+// gzipCacheSuffix is appended to a FlashCache key to store the gzip
+// encoding of the response cached under it.
+const gzipCacheSuffix = "_gzip"
+
+// cacheKeyKey is the gin context key holding the FlashCache key of a chat
+// completion, set by CacheMiddleware.
+const cacheKeyKey = "cache_key"
+
+// CompressionOption configures CompressionMiddleware.
+type CompressionOption func(*compressionConfig)
+
+type compressionConfig struct {
+	minSize int
+	cache   *FlashCache
+}
+
+// WithCompressionMinSize sets the smallest response body compressed, in
+// bytes. The default is DefaultCompressionMinSize.
+func WithCompressionMinSize(n int) CompressionOption {
+	return func(cfg *compressionConfig) { cfg.minSize = n }
+}
+
+// WithCompressionCache keeps the gzip encoding of responses cache holds
+// next to them, under their key with a _gzip suffix, so cache hits are not
+// compressed again.
+func WithCompressionCache(cache *FlashCache) CompressionOption {
+	return func(cfg *compressionConfig) { cfg.cache = cache }
+}
+
+// CompressionMiddleware gzips response bodies at level, from
+// gzip.HuffmanOnly to gzip.BestCompression, for clients that send
+// Accept-Encoding: gzip. Bodies smaller than the minimum size, already
+// encoded responses, streamed responses and WebSocket upgrades are sent as
+// they are. The body is buffered until the handlers return; a handler that
+// flushes switches the response to unbuffered and uncompressed.
+func CompressionMiddleware(level int, opts ...CompressionOption) gin.HandlerFunc {
+	cfg := compressionConfig{minSize: DefaultCompressionMinSize}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(c *gin.Context) {
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) || wantsEventStream(c) || isWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+		if w.passthrough {
+			return
+		}
+
+		body := w.buf.Bytes()
+		status := w.Status()
+		h := w.Header()
+		if len(body) < cfg.minSize || h.Get("Content-Encoding") != "" ||
+			strings.HasPrefix(h.Get("Content-Type"), ContentTypeEventStream) {
+			w.flushBuffered()
+			return
+		}
+
+		compressed, ok := cachedGzip(c, cfg.cache, status)
+		if !ok {
+			var err error
+			if compressed, err = gzipBytes(body, level); err != nil {
+				w.flushBuffered()
+				return
+			}
+			storeGzip(c, cfg.cache, status, compressed)
+		}
+		h.Set("Content-Encoding", "gzip")
+		h.Add("Vary", "Accept-Encoding")
+		h.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(status)
+		w.ResponseWriter.Write(compressed)
+	}
+}
+
+// cachedGzip returns the stored gzip encoding of a response cache served.
+func cachedGzip(c *gin.Context, cache *FlashCache, status int) ([]byte, bool) {
+	key := c.GetString(cacheKeyKey)
+	if cache == nil || key == "" || status != http.StatusOK ||
+		c.Writer.Header().Get(CacheStatusHeader) != CacheStatusHit {
+		return nil, false
+	}
+	return cache.Get(key + gzipCacheSuffix)
+}
+
+// storeGzip keeps compressed next to the cached response it encodes, for as
+// long as that response is cached.
+func storeGzip(c *gin.Context, cache *FlashCache, status int, compressed []byte) {
+	key := c.GetString(cacheKeyKey)
+	if cache == nil || key == "" || status != http.StatusOK {
+		return
+	}
+	if entry, ok := cache.GetEntry(key); ok {
+		cache.SetWithTTL(key+gzipCacheSuffix, compressed, time.Until(entry.ExpireAt))
+	}
+}
+
+// gzipBytes returns b compressed at level.
+func gzipBytes(b []byte, level int) ([]byte, error) {
+	var out bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&out, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// acceptsGzip reports whether an Accept-Encoding header lists gzip, or *,
+// without q=0.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || (coding != "gzip" && coding != "*") {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter buffers the response so CompressionMiddleware can decide
+// how to send it once the handlers return.
+type compressWriter struct {
+	gin.ResponseWriter
+	buf    bytes.Buffer
+	status int
+
+	// passthrough is set once the handler flushed; everything since went
+	// straight to the client.
+	passthrough bool
+}
+
+// WriteHeader keeps the status until the response is sent.
+func (w *compressWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+// WriteHeaderNow does nothing until the response is sent.
+func (w *compressWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Write buffers b.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// WriteString buffers s.
+func (w *compressWriter) WriteString(s string) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.buf.WriteString(s)
+}
+
+// Status returns the status kept by WriteHeader.
+func (w *compressWriter) Status() int {
+	if w.status != 0 && !w.passthrough {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+// Written reports whether a status or body was written.
+func (w *compressWriter) Written() bool {
+	return w.status != 0 || w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Size returns the bytes written so far.
+func (w *compressWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	if w.buf.Len() == 0 && w.status == 0 {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+// Flush sends what is buffered uncompressed and stops buffering, for
+// handlers that stream.
+func (w *compressWriter) Flush() {
+	if !w.passthrough {
+		w.flushBuffered()
+		w.passthrough = true
+	}
+	w.ResponseWriter.Flush()
+}
+
+// flushBuffered sends the kept status and buffered body as they are.
+func (w *compressWriter) flushBuffered() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	} else {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
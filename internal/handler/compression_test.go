@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// largeCompletion is a chat completion well over DefaultCompressionMinSize.
+var largeCompletion = gin.H{
+	"id":      "chatcmpl-1",
+	"object":  "chat.completion",
+	"choices": []gin.H{{"index": 0, "message": gin.H{"role": "assistant", "content": strings.Repeat("func main() {}\n", 200)}}},
+}
+
+func newCompressionRouter(opts ...CompressionOption) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CompressionMiddleware(gzip.DefaultCompression, opts...))
+	r.GET("/large", func(c *gin.Context) { c.JSON(http.StatusOK, largeCompletion) })
+	r.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", ContentTypeEventStream)
+		c.String(http.StatusOK, "data: %s\n\n", strings.Repeat("x", 2048))
+		c.Writer.Flush()
+		c.String(http.StatusOK, "data: [DONE]\n\n")
+	})
+	return r
+}
+
+func getWith(r http.Handler, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func gunzip(t *testing.T, b []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzip body: %v", err)
+	}
+	return out
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	r := newCompressionRouter()
+
+	plain := getWith(r, "/large", "")
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("Content-Encoding = %q without Accept-Encoding, want none", plain.Header().Get("Content-Encoding"))
+	}
+
+	w := getWith(r, "/large", "br, gzip;q=0.8")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("status = %d, Content-Encoding = %q, want 200 and gzip", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+	}
+	if w.Body.Len() >= plain.Body.Len() {
+		t.Errorf("compressed body is %d bytes, want fewer than the %d uncompressed", w.Body.Len(), plain.Body.Len())
+	}
+	var got, want any
+	if err := json.Unmarshal(gunzip(t, w.Body.Bytes()), &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(plain.Body.Bytes(), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("decompressed body differs from the uncompressed response")
+	}
+}
+
+func TestCompressionMiddleware_Skipped(t *testing.T) {
+	tests := []struct {
+		name, path, acceptEncoding string
+		opts                       []CompressionOption
+	}{
+		{"small response", "/small", "gzip", nil},
+		{"below configured minimum", "/large", "gzip", []CompressionOption{WithCompressionMinSize(1 << 20)}},
+		{"gzip refused", "/large", "gzip;q=0", nil},
+		{"streamed response", "/stream", "gzip", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getWith(newCompressionRouter(tt.opts...), tt.path, tt.acceptEncoding)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if !json.Valid(w.Body.Bytes()) && !strings.HasPrefix(w.Body.String(), "data: ") {
+				t.Errorf("body = %.40q, want it uncompressed", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompressionMiddleware_Cache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := NewFlashCache(ctx)
+
+	calls := 0
+	r := gin.New()
+	r.Use(CompressionMiddleware(gzip.BestSpeed, WithCompressionCache(cache)))
+	r.Use(CacheMiddleware(cache, nil))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, largeCompletion)
+	})
+
+	const body = `{"model":"gpt-4","messages":[{"role":"user","content":"write code"}]}`
+	post := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	miss := post("gzip")
+	key := HashRequest([]byte(body))
+	plain, ok := cache.Get(key)
+	if !ok {
+		t.Fatal("uncompressed response not cached")
+	}
+	compressed, ok := cache.Get(key + gzipCacheSuffix)
+	if !ok || !bytes.Equal(compressed, miss.Body.Bytes()) {
+		t.Fatal("compressed response not cached under the _gzip key")
+	}
+	if !bytes.Equal(gunzip(t, compressed), plain) {
+		t.Error("cached compressed response does not decode to the cached response")
+	}
+
+	hit := post("gzip")
+	if hit.Header().Get(CacheStatusHeader) != CacheStatusHit || !bytes.Equal(hit.Body.Bytes(), compressed) {
+		t.Errorf("cache hit status = %q, want HIT with the cached compressed body", hit.Header().Get(CacheStatusHeader))
+	}
+	if identity := post(""); !bytes.Equal(identity.Body.Bytes(), plain) {
+		t.Error("cache hit without Accept-Encoding is not the uncompressed response")
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+)
+
+// Response formats negotiated by ContentNegotiationMiddleware.
+const (
+	ContentTypeJSON        = "application/json"
+	ContentTypeEventStream = "text/event-stream"
+)
+
+// responseFormatKey is the gin context key holding the negotiated response
+// content type.
+const responseFormatKey = "response_format"
+
+// streamingRequestedKey is the gin context key holding the request's stream
+// field, set by HandleChatCompletion.
+const streamingRequestedKey = "streaming_requested"
+
+// ContentNegotiationMiddleware reads the Accept header and stores the
+// response format under response_format: ContentTypeEventStream when the
+// client accepts text/event-stream, ContentTypeJSON otherwise.
+func ContentNegotiationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(responseFormatKey, negotiateFormat(c.GetHeader("Accept")))
+		c.Next()
+	}
+}
+
+// negotiateFormat returns ContentTypeEventStream when accept lists
+// text/event-stream without q=0, and ContentTypeJSON otherwise.
+func negotiateFormat(accept string) string {
+	for _, r := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil || mediaType != ContentTypeEventStream {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return ContentTypeEventStream
+	}
+	return ContentTypeJSON
+}
+
+// wantsEventStream reports whether the response to c should be sent as
+// server-sent events, because the request body set stream or the client
+// negotiated text/event-stream.
+func wantsEventStream(c *gin.Context) bool {
+	if c.GetBool(streamingRequestedKey) {
+		return true
+	}
+	if format, ok := c.Get(responseFormatKey); ok {
+		return format == ContentTypeEventStream
+	}
+	return negotiateFormat(c.GetHeader("Accept")) == ContentTypeEventStream
+}
+
+// sendEventStream writes resp as an OpenAI chat completion stream: a chunk
+// with each choice's role and content, a chunk with each choice's finish
+// reason, then data: [DONE]. The router receives the whole completion
+// before the first chunk is sent.
+func sendEventStream(c *gin.Context, resp adapter.OpenAIResponse) {
+	c.Header("Content-Type", ContentTypeEventStream)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	chunk := adapter.OpenAIChatCompletionChunk{
+		ID:                resp.ID,
+		Object:            "chat.completion.chunk",
+		Created:           resp.Created,
+		Model:             resp.Model,
+		SystemFingerprint: resp.SystemFingerprint,
+	}
+
+	content := make([]adapter.OpenAIChunkChoice, len(resp.Choices))
+	finish := make([]adapter.OpenAIChunkChoice, len(resp.Choices))
+	for i, ch := range resp.Choices {
+		content[i] = adapter.OpenAIChunkChoice{
+			Index: ch.Index,
+			Delta: adapter.OpenAIMessageDelta{
+				Role:      ch.Message.Role,
+				Content:   ch.Message.Content,
+				ToolCalls: ch.Message.ToolCalls,
+			},
+		}
+		reason := ch.FinishReason
+		finish[i] = adapter.OpenAIChunkChoice{Index: ch.Index, FinishReason: &reason, GroundingMetadata: ch.GroundingMetadata}
+	}
+
+	for _, choices := range [][]adapter.OpenAIChunkChoice{content, finish} {
+		chunk.Choices = choices
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ContentTypeJSON},
+		{"application/json", ContentTypeJSON},
+		{"*/*", ContentTypeJSON},
+		{"text/event-stream", ContentTypeEventStream},
+		{"application/json, text/event-stream;q=0.5", ContentTypeEventStream},
+		{"Text/Event-Stream", ContentTypeEventStream},
+		{"text/event-stream;q=0", ContentTypeJSON},
+		{"text/event-stream;q=0.0, application/json", ContentTypeJSON},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateFormat(tt.accept); got != tt.want {
+			t.Errorf("negotiateFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestHandleChatCompletion_EventStream(t *testing.T) {
+	server, _ := newMockGemini(t, `{"candidates":[{"content":{"parts":[{"text":"hi there"}],"role":"model"},"finishReason":"STOP"}]}`)
+
+	tests := []struct {
+		name       string
+		accept     string
+		body       string
+		wantStream bool
+	}{
+		{"accept header", ContentTypeEventStream, `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`, true},
+		{"stream field", "", `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`, true},
+		{"json", "application/json", `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewProxyHandler(domain.NewMockKeyManager(testProxyKey), nil,
+				WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+				WithAdapterOptions(adapter.WithBaseURL(server.URL)),
+			)
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(ContentNegotiationMiddleware())
+			r.POST("/v1/chat/completions", h.HandleChatCompletion)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body.String())
+			}
+			if !tt.wantStream {
+				if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, ContentTypeJSON) {
+					t.Errorf("Content-Type = %q, want %s", ct, ContentTypeJSON)
+				}
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentTypeEventStream {
+				t.Errorf("Content-Type = %q, want %s", ct, ContentTypeEventStream)
+			}
+
+			events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+			if len(events) != 3 || events[2] != "data: [DONE]" {
+				t.Fatalf("events = %q, want two chunks and data: [DONE]", events)
+			}
+			var chunks [2]adapter.OpenAIChatCompletionChunk
+			for i := range chunks {
+				data, ok := strings.CutPrefix(events[i], "data: ")
+				if !ok {
+					t.Fatalf("event %d = %q, want a data line", i, events[i])
+				}
+				if err := json.Unmarshal([]byte(data), &chunks[i]); err != nil {
+					t.Fatalf("event %d is not JSON: %v", i, err)
+				}
+				if chunks[i].Object != "chat.completion.chunk" || len(chunks[i].Choices) != 1 {
+					t.Fatalf("event %d = %+v, want a chat.completion.chunk with one choice", i, chunks[i])
+				}
+			}
+			if d := chunks[0].Choices[0].Delta; d.Role != "assistant" || d.Content != "hi there" {
+				t.Errorf("first delta = %+v, want assistant \"hi there\"", d)
+			}
+			if fr := chunks[0].Choices[0].FinishReason; fr != nil {
+				t.Errorf("first finish_reason = %q, want null", *fr)
+			}
+			if fr := chunks[1].Choices[0].FinishReason; fr == nil || *fr != "stop" {
+				t.Errorf("last finish_reason = %v, want stop", fr)
+			}
+		})
+	}
+}
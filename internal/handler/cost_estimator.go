@@ -3,8 +3,10 @@ package handler
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 )
 
@@ -18,15 +20,45 @@ const (
 	TokensPerWord = 1.3
 )
 
+const (
+	// requestTimestampBuffer is how many recent request times CostEstimator
+	// keeps to measure the request rate.
+	requestTimestampBuffer = 1000
+
+	// rpsWindow is the span CurrentRPS averages over.
+	rpsWindow = 60 * time.Second
+
+	// secondsPerMonth is a 30-day month, the span ProjectedMonthlyCost
+	// projects over.
+	secondsPerMonth = 3600 * 24 * 30
+)
+
 // CostEstimator tracks token usage and calculates money saved.
 // It uses a global counter that persists across requests.
 type CostEstimator struct {
-	mu         sync.RWMutex
-	totalSaved float64
+	mu           sync.RWMutex
+	totalSaved   float64
+	requests     int64
+	inputTokens  int64
+	outputTokens int64
+
+	// requestTimestamps is a circular buffer of the times of the latest
+	// requests; next is where the next one goes.
+	requestTimestamps []time.Time
+	next              int
+	now               func() time.Time
+}
+
+// CostTotals are the cumulative counters kept across all requests.
+type CostTotals struct {
+	Requests     int64
+	InputTokens  int64
+	OutputTokens int64
+	CostUSD      float64
 }
 
 // globalCostEstimator is the singleton instance for tracking total savings.
-var globalCostEstimator = &CostEstimator{}
+var globalCostEstimator = &CostEstimator{now: time.Now}
 
 // GetTotalSaved returns the total money saved across all requests.
 func GetTotalSaved() float64 {
@@ -35,19 +67,90 @@ func GetTotalSaved() float64 {
 	return globalCostEstimator.totalSaved
 }
 
+// GetCostTotals returns the requests, estimated tokens and cost counted so far.
+func GetCostTotals() CostTotals {
+	globalCostEstimator.mu.RLock()
+	defer globalCostEstimator.mu.RUnlock()
+	return CostTotals{
+		Requests:     globalCostEstimator.requests,
+		InputTokens:  globalCostEstimator.inputTokens,
+		OutputTokens: globalCostEstimator.outputTokens,
+		CostUSD:      globalCostEstimator.totalSaved,
+	}
+}
+
+// addUsage counts one request and its estimated tokens.
+func addUsage(inputTokens, outputTokens int) {
+	globalCostEstimator.mu.Lock()
+	defer globalCostEstimator.mu.Unlock()
+	globalCostEstimator.requests++
+	globalCostEstimator.inputTokens += int64(inputTokens)
+	globalCostEstimator.outputTokens += int64(outputTokens)
+}
+
 // AddSavings adds to the total savings counter (thread-safe).
 func AddSavings(amount float64) float64 {
 	globalCostEstimator.mu.Lock()
 	defer globalCostEstimator.mu.Unlock()
 	globalCostEstimator.totalSaved += amount
+	globalCostEstimator.addTimestampLocked()
 	return globalCostEstimator.totalSaved
 }
 
-// ResetSavings resets the total savings counter (useful for testing).
+// addTimestampLocked records a request at the current time, overwriting the
+// oldest one once the buffer is full. e.mu must be held.
+func (e *CostEstimator) addTimestampLocked() {
+	now := e.now()
+	if len(e.requestTimestamps) < requestTimestampBuffer {
+		e.requestTimestamps = append(e.requestTimestamps, now)
+		return
+	}
+	e.requestTimestamps[e.next] = now
+	e.next = (e.next + 1) % requestTimestampBuffer
+}
+
+// CurrentRPS returns the requests per second over the last minute. Until
+// the router has seen a minute of requests, or when the buffer holds less
+// than a minute of them, the rate is taken over the span the buffer covers,
+// but at least one second.
+func (e *CostEstimator) CurrentRPS() float64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.requestTimestamps) == 0 {
+		return 0
+	}
+
+	now := e.now()
+	count := 0
+	oldest := now
+	for _, t := range e.requestTimestamps {
+		if now.Sub(t) <= rpsWindow {
+			count++
+		}
+		if t.Before(oldest) {
+			oldest = t
+		}
+	}
+	span := min(max(now.Sub(oldest), time.Second), rpsWindow)
+	return float64(count) / span.Seconds()
+}
+
+// ProjectedMonthlyCost returns the cost in USD of 30 days of requests at
+// rps, each with the given average token counts.
+func (e *CostEstimator) ProjectedMonthlyCost(rps, avgInputTokens, avgOutputTokens float64) float64 {
+	return rps * secondsPerMonth * tokenCost(avgInputTokens, avgOutputTokens)
+}
+
+// ResetSavings resets the savings, request and token counters (useful for testing).
 func ResetSavings() {
 	globalCostEstimator.mu.Lock()
 	defer globalCostEstimator.mu.Unlock()
 	globalCostEstimator.totalSaved = 0
+	globalCostEstimator.requests = 0
+	globalCostEstimator.inputTokens = 0
+	globalCostEstimator.outputTokens = 0
+	globalCostEstimator.requestTimestamps = nil
+	globalCostEstimator.next = 0
 }
 
 // EstimateTokens estimates the number of tokens in a text string.
@@ -82,13 +185,157 @@ func EstimateTokens(text string) int {
 	return tokens
 }
 
+// EstimateTokensAccurate estimates the number of tokens in text as a GPT-4
+// tokenizer would count them, without its vocabulary. The text is split the
+// way the tokenizer splits it before byte-pair encoding, and each piece is
+// priced from common patterns: an English word is 1 token unless it is long,
+// the 't of a word with an apostrophe is another, numbers are 1 token per 3
+// digits, punctuation about 1 per 2 characters, URLs 1 per 10 characters and
+// other non-ASCII letters 1.5 each.
+func EstimateTokensAccurate(text string) int {
+	runes := []rune(text)
+	var tokens float64
+	for i := 0; i < len(runes); {
+		n, t := nextPretoken(runes[i:])
+		tokens += t
+		i += n
+	}
+	return int(math.Ceil(tokens))
+}
+
+// contractionSuffixes are the endings the tokenizer splits off a word after
+// an apostrophe.
+var contractionSuffixes = []string{"s", "t", "re", "ve", "m", "ll", "d"}
+
+// nextPretoken returns the length in runes of the piece the tokenizer
+// splits off the start of r, and its estimated token count.
+func nextPretoken(r []rune) (int, float64) {
+	if hasURLPrefix(r) {
+		n := 0
+		for n < len(r) && !unicode.IsSpace(r[n]) {
+			n++
+		}
+		return n, math.Ceil(float64(n) / 10)
+	}
+
+	if r[0] == '\'' {
+		for _, suffix := range contractionSuffixes {
+			if hasPrefixFold(r[1:], suffix) {
+				return 1 + len(suffix), 1
+			}
+		}
+	}
+
+	// A word, with one leading space or punctuation character
+	start := 0
+	if len(r) > 1 && !unicode.IsLetter(r[0]) && !unicode.IsNumber(r[0]) && r[0] != '\r' && r[0] != '\n' && unicode.IsLetter(r[1]) {
+		start = 1
+	}
+	if end := countWhile(r[start:], unicode.IsLetter); end > 0 {
+		return start + end, wordTokens(r[start : start+end])
+	}
+
+	if unicode.IsNumber(r[0]) {
+		return min(countWhile(r, unicode.IsNumber), 3), 1
+	}
+
+	// Punctuation, with one leading space and any trailing line breaks
+	start = 0
+	if r[0] == ' ' {
+		start = 1
+	}
+	if punct := countWhile(r[start:], isPunct); punct > 0 {
+		n := start + punct
+		n += countWhile(r[n:], isLineBreak)
+		return n, float64((punct + 1) / 2)
+	}
+
+	// Whitespace: a run ending in line breaks, or spaces leaving the last
+	// one to the word that follows
+	ws := countWhile(r, unicode.IsSpace)
+	for i := ws - 1; i >= 0; i-- {
+		if isLineBreak(r[i]) {
+			return i + 1, 1
+		}
+	}
+	if ws > 1 && ws < len(r) {
+		return ws - 1, 1
+	}
+	return max(ws, 1), 1
+}
+
+// wordTokens estimates the tokens of a run of letters. Common English words
+// up to 10 letters are single tokens; longer ones split about every 7.
+func wordTokens(letters []rune) float64 {
+	ascii, other := 0, 0
+	for _, l := range letters {
+		if l <= unicode.MaxASCII {
+			ascii++
+		} else {
+			other++
+		}
+	}
+
+	tokens := 1.5 * float64(other)
+	switch {
+	case ascii > 10:
+		tokens += float64(1 + (ascii-7)/7)
+	case ascii > 0:
+		tokens++
+	}
+	return tokens
+}
+
+// hasURLPrefix reports whether r starts with an http or https URL.
+func hasURLPrefix(r []rune) bool {
+	return hasPrefixFold(r, "http://") || hasPrefixFold(r, "https://")
+}
+
+// hasPrefixFold reports whether r starts with the ASCII string prefix,
+// ignoring case.
+func hasPrefixFold(r []rune, prefix string) bool {
+	if len(r) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		if unicode.ToLower(r[i]) != rune(prefix[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// countWhile returns how many runes at the start of r satisfy f.
+func countWhile(r []rune, f func(rune) bool) int {
+	n := 0
+	for n < len(r) && f(r[n]) {
+		n++
+	}
+	return n
+}
+
+// isPunct reports whether ch is neither a letter, a number nor whitespace.
+func isPunct(ch rune) bool {
+	return !unicode.IsLetter(ch) && !unicode.IsNumber(ch) && !unicode.IsSpace(ch)
+}
+
+// isLineBreak reports whether ch is a carriage return or line feed.
+func isLineBreak(ch rune) bool {
+	return ch == '\r' || ch == '\n'
+}
+
 // CalculateCost calculates the equivalent OpenAI API cost in USD.
 // Returns the cost based on OpenAI's pricing:
 // - Input: $0.50 per million tokens
 // - Output: $1.50 per million tokens
 func CalculateCost(inputTokens, outputTokens int) float64 {
-	inputCost := (float64(inputTokens) / 1_000_000) * InputPricePerMillion
-	outputCost := (float64(outputTokens) / 1_000_000) * OutputPricePerMillion
+	return tokenCost(float64(inputTokens), float64(outputTokens))
+}
+
+// tokenCost is CalculateCost for fractional token counts, such as averages.
+func tokenCost(inputTokens, outputTokens float64) float64 {
+	inputCost := (inputTokens / 1_000_000) * InputPricePerMillion
+	outputCost := (outputTokens / 1_000_000) * OutputPricePerMillion
 	return inputCost + outputCost
 }
 
@@ -131,13 +378,36 @@ type CostMetrics struct {
 	OutputTokens int
 	MoneySaved   float64
 	TotalSaved   float64
+
+	// ExactTokensUsed reports whether the token counts came from the
+	// provider's usage data rather than the word-count estimate.
+	ExactTokensUsed bool
 }
 
 // CalculateRequestCost calculates cost metrics for a request/response pair.
-func CalculateRequestCost(inputText, outputText string) CostMetrics {
-	inputTokens := EstimateTokens(inputText)
-	outputTokens := EstimateTokens(outputText)
+// When the provider reported usage, inputExact is positive and the exact
+// counts are used; otherwise tokens are estimated from inputText and outputText.
+func CalculateRequestCost(inputExact, outputExact int, inputText, outputText string) CostMetrics {
+	return calculateRequestCost(EstimateTokens, inputExact, outputExact, inputText, outputText)
+}
+
+// calculateRequestCost is CalculateRequestCost estimating tokens with
+// estimate.
+func calculateRequestCost(estimate func(string) int, inputExact, outputExact int, inputText, outputText string) CostMetrics {
+	exact := inputExact > 0
+	inputTokens, outputTokens := inputExact, outputExact
+	if !exact {
+		inputTokens = estimate(inputText)
+		outputTokens = estimate(outputText)
+	}
+	return recordCost(inputTokens, outputTokens, exact)
+}
+
+// recordCost adds a request with the given token counts to the totals and
+// returns its cost metrics.
+func recordCost(inputTokens, outputTokens int, exact bool) CostMetrics {
 	moneySaved := CalculateCost(inputTokens, outputTokens)
+	addUsage(inputTokens, outputTokens)
 	totalSaved := AddSavings(moneySaved)
 
 	return CostMetrics{
@@ -145,5 +415,7 @@ func CalculateRequestCost(inputText, outputText string) CostMetrics {
 		OutputTokens: outputTokens,
 		MoneySaved:   moneySaved,
 		TotalSaved:   totalSaved,
+
+		ExactTokensUsed: exact,
 	}
 }
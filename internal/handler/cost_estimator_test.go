@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGetCostTotals(t *testing.T) {
+	ResetSavings()
+	t.Cleanup(ResetSavings)
+
+	first := CalculateRequestCost(0, 0, "one two three", "four five")
+	second := CalculateRequestCost(0, 0, "six", "seven eight nine ten")
+
+	got := GetCostTotals()
+	if got.Requests != 2 {
+		t.Errorf("Requests = %d, want 2", got.Requests)
+	}
+	if want := int64(first.InputTokens + second.InputTokens); got.InputTokens != want {
+		t.Errorf("InputTokens = %d, want %d", got.InputTokens, want)
+	}
+	if want := int64(first.OutputTokens + second.OutputTokens); got.OutputTokens != want {
+		t.Errorf("OutputTokens = %d, want %d", got.OutputTokens, want)
+	}
+	if got.CostUSD != second.TotalSaved {
+		t.Errorf("CostUSD = %v, want %v", got.CostUSD, second.TotalSaved)
+	}
+
+	ResetSavings()
+	if got := GetCostTotals(); got != (CostTotals{}) {
+		t.Errorf("GetCostTotals() after reset = %+v, want zero", got)
+	}
+}
+
+func TestCostEstimator_CurrentRPS(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	e := &CostEstimator{now: func() time.Time { return now }}
+
+	if got := e.CurrentRPS(); got != 0 {
+		t.Errorf("CurrentRPS() without requests = %v, want 0", got)
+	}
+
+	// 10 requests within one second
+	for i := 0; i < 10; i++ {
+		now = start.Add(time.Duration(i) * 100 * time.Millisecond)
+		e.addTimestampLocked()
+	}
+	now = start.Add(time.Second)
+	if got := e.CurrentRPS(); math.Abs(got-10) > 0.5 {
+		t.Errorf("CurrentRPS() = %v, want about 10", got)
+	}
+
+	now = start.Add(30 * time.Second)
+	if got, want := e.CurrentRPS(), 10.0/30; math.Abs(got-want) > 0.01 {
+		t.Errorf("CurrentRPS() after 30s = %v, want %v", got, want)
+	}
+
+	now = start.Add(2 * time.Minute)
+	if got := e.CurrentRPS(); got != 0 {
+		t.Errorf("CurrentRPS() after 2 minutes = %v, want 0", got)
+	}
+
+	// More requests than the buffer holds: the rate is taken over the
+	// span the buffer still covers.
+	for i := 0; i < 1500; i++ {
+		now = now.Add(10 * time.Millisecond)
+		e.addTimestampLocked()
+	}
+	if got := e.CurrentRPS(); math.Abs(got-100) > 1 {
+		t.Errorf("CurrentRPS() with a full buffer = %v, want about 100", got)
+	}
+}
+
+func TestCostEstimator_ProjectedMonthlyCost(t *testing.T) {
+	e := &CostEstimator{}
+	if got := e.ProjectedMonthlyCost(0, 100, 100); got != 0 {
+		t.Errorf("ProjectedMonthlyCost(0, ...) = %v, want 0", got)
+	}
+	// One request a second for 30 days, each a million input tokens.
+	want := 3600 * 24 * 30 * InputPricePerMillion
+	if got := e.ProjectedMonthlyCost(1, 1_000_000, 0); math.Abs(got-want) > 1e-6 {
+		t.Errorf("ProjectedMonthlyCost(1, 1e6, 0) = %v, want %v", got, want)
+	}
+	// Averages need not be whole tokens.
+	want = 2 * 3600 * 24 * 30 * CalculateCost(3, 1) / 2
+	if got := e.ProjectedMonthlyCost(2, 1.5, 0.5); math.Abs(got-want) > 1e-9 {
+		t.Errorf("ProjectedMonthlyCost(2, 1.5, 0.5) = %v, want %v", got, want)
+	}
+}
+
+func TestCalculateRequestCost_ExactTokens(t *testing.T) {
+	ResetSavings()
+	t.Cleanup(ResetSavings)
+
+	input, output := "one two three", "four five"
+	tests := []struct {
+		name                    string
+		inputExact, outputExact int
+		wantIn, wantOut         int
+		wantExact               bool
+	}{
+		{"exact counts used", 1200, 300, 1200, 300, true},
+		{"zero completion tokens still exact", 40, 0, 40, 0, true},
+		{"no usage falls back to estimate", 0, 0, EstimateTokens(input), EstimateTokens(output), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CalculateRequestCost(tt.inputExact, tt.outputExact, input, output)
+			if got.InputTokens != tt.wantIn || got.OutputTokens != tt.wantOut {
+				t.Errorf("tokens = %d/%d, want %d/%d", got.InputTokens, got.OutputTokens, tt.wantIn, tt.wantOut)
+			}
+			if got.ExactTokensUsed != tt.wantExact {
+				t.Errorf("ExactTokensUsed = %v, want %v", got.ExactTokensUsed, tt.wantExact)
+			}
+			if want := CalculateCost(tt.wantIn, tt.wantOut); got.MoneySaved != want {
+				t.Errorf("MoneySaved = %v, want %v", got.MoneySaved, want)
+			}
+		})
+	}
+}
+
+// gpt4TokenSamples are prompts with their GPT-4 (cl100k_base) token counts.
+var gpt4TokenSamples = []struct {
+	text   string
+	tokens int
+}{
+	{"Hello, world!", 4},
+	{"The quick brown fox jumps over the lazy dog.", 10},
+	{"I don't know what you're talking about.", 10},
+	{"Please summarize the following article in three bullet points.", 10},
+	{"The meeting is scheduled for 10:30 on March 15, 2024.", 18},
+	{"Write a short poem about the ocean at night, focusing on the sound of the waves.", 18},
+	{"Can you explain how photosynthesis works in simple terms?", 12},
+	{"for i := 0; i < 10; i++ {", 14},
+	{`{"name": "Alice", "age": 30}`, 12},
+	{"## Summary\n\n- First item\n- Second item", 10},
+}
+
+func TestEstimateTokensAccurate(t *testing.T) {
+	for _, tt := range gpt4TokenSamples {
+		got := EstimateTokensAccurate(tt.text)
+		if diff := got - tt.tokens; diff*10 > tt.tokens || -diff*10 > tt.tokens {
+			t.Errorf("EstimateTokensAccurate(%q) = %d, want %d ± 10%%", tt.text, got, tt.tokens)
+		}
+	}
+}
+
+func TestEstimateTokensAccurate_Patterns(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"don't", 2},
+		{"123456789", 3},
+		{"https://example.com/a/b", 3},
+		{"日本語", 5},
+	}
+
+	for _, tt := range tests {
+		if got := EstimateTokensAccurate(tt.text); got != tt.want {
+			t.Errorf("EstimateTokensAccurate(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWithAccurateTokenEstimation(t *testing.T) {
+	const text = "I don't know what you're talking about."
+	tests := []struct {
+		opts []ProxyHandlerOption
+		want int
+	}{
+		{nil, EstimateTokens(text)},
+		{[]ProxyHandlerOption{WithAccurateTokenEstimation(true)}, EstimateTokensAccurate(text)},
+		{[]ProxyHandlerOption{WithAccurateTokenEstimation(false)}, EstimateTokens(text)},
+	}
+
+	for i, tt := range tests {
+		h := NewProxyHandler(nil, nil, tt.opts...)
+		if got := h.estimateTokens(text); got != tt.want {
+			t.Errorf("case %d: estimateTokens() = %d, want %d", i, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkEstimateTokens(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, s := range gpt4TokenSamples {
+			EstimateTokens(s.text)
+		}
+	}
+}
+
+func BenchmarkEstimateTokensAccurate(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, s := range gpt4TokenSamples {
+			EstimateTokensAccurate(s.text)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// costJob is a served request whose prompt tokens CostWorker estimates off
+// the response path.
+type costJob struct {
+	model        string
+	keyName      string
+	inputText    string
+	outputTokens int
+}
+
+// costEstimationDropped counts the cost jobs estimated on the request
+// goroutine because the CostWorker queue was full.
+var costEstimationDropped atomic.Int64
+
+// CostEstimationDroppedCount returns how many requests had their cost
+// estimated synchronously because the async queue was full.
+func CostEstimationDroppedCount() int64 {
+	return costEstimationDropped.Load()
+}
+
+// CostWorker estimates the tokens and cost of queued requests on a single
+// background goroutine and adds them to the global cost totals.
+type CostWorker struct {
+	costJobs chan costJob
+	estimate func(string) int
+	logger   *slog.Logger
+	wg       sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newCostWorker starts a CostWorker queueing up to bufferSize jobs.
+func newCostWorker(bufferSize int, estimate func(string) int, logger *slog.Logger) *CostWorker {
+	w := &CostWorker{
+		costJobs: make(chan costJob, bufferSize),
+		estimate: estimate,
+		logger:   logger,
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+func (w *CostWorker) run() {
+	defer w.wg.Done()
+	for job := range w.costJobs {
+		w.record(job)
+	}
+}
+
+// submit queues job and reports whether it was accepted. It returns false
+// when the queue is full or the worker is closed.
+func (w *CostWorker) submit(job costJob) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return false
+	}
+
+	select {
+	case w.costJobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// record estimates the prompt tokens of job and adds its cost to the totals.
+func (w *CostWorker) record(job costJob) {
+	m := recordCost(w.estimate(job.inputText), job.outputTokens, false)
+	w.logger.Debug("cost estimated",
+		slog.String("model", job.model),
+		slog.String("key_name", job.keyName),
+		slog.Int("input_tokens", m.InputTokens),
+		slog.Int("output_tokens", m.OutputTokens),
+	)
+}
+
+// Close stops accepting jobs, estimates the queued ones and waits for the
+// worker to exit.
+func (w *CostWorker) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.costJobs)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
+
+// recordRequestCost adds the cost of a served request to the totals and
+// stores its CostMetrics under cost_metrics. With async cost estimation,
+// requests without exact usage are estimated by the CostWorker instead and
+// no cost_metrics is set; when its queue is full they are estimated here.
+func (h *ProxyHandler) recordRequestCost(c *gin.Context, model string, inputExact, outputExact int, inputText, outputText string) {
+	if h.costs == nil || inputExact > 0 {
+		c.Set("cost_metrics", calculateRequestCost(h.estimateTokens, inputExact, outputExact, inputText, outputText))
+		return
+	}
+
+	job := costJob{
+		model:        model,
+		keyName:      h.km.KeyName(c.GetString("key_used")),
+		inputText:    inputText,
+		outputTokens: h.estimateTokens(outputText),
+	}
+	if h.costs.submit(job) {
+		return
+	}
+	costEstimationDropped.Add(1)
+	c.Set("cost_metrics", recordCost(h.estimateTokens(inputText), job.outputTokens, false))
+}
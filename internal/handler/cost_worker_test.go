@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestProxyHandler_AsyncCostEstimation(t *testing.T) {
+	ResetSavings()
+	t.Cleanup(ResetSavings)
+	dropped := CostEstimationDroppedCount()
+
+	server, _ := newMockGemini(t, `{"candidates":[{"content":{"parts":[{"text":"hi there"}],"role":"model"},"finishReason":"STOP"}]}`)
+	h := NewProxyHandler(domain.NewMockKeyManager(testProxyKey), nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(server.URL)),
+		WithAsyncCostEstimation(200),
+	)
+
+	const requests = 100
+	for i := 0; i < requests; i++ {
+		if w := postChat(h); w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i, w.Code)
+		}
+	}
+	h.Close()
+
+	if got := CostEstimationDroppedCount() - dropped; got != 0 {
+		t.Errorf("dropped cost jobs = %d, want 0", got)
+	}
+	in, out := EstimateTokens("hello"), EstimateTokens("hi there")
+	want := CostTotals{
+		Requests:     requests,
+		InputTokens:  int64(in * requests),
+		OutputTokens: int64(out * requests),
+		CostUSD:      CalculateCost(in, out) * requests,
+	}
+	got := GetCostTotals()
+	if got.Requests != want.Requests || got.InputTokens != want.InputTokens || got.OutputTokens != want.OutputTokens {
+		t.Errorf("GetCostTotals() = %+v, want %+v", got, want)
+	}
+	if diff := got.CostUSD - want.CostUSD; diff > 1e-12 || diff < -1e-12 {
+		t.Errorf("CostUSD = %v, want %v", got.CostUSD, want.CostUSD)
+	}
+}
+
+func TestCostWorker_FullQueueFallsBack(t *testing.T) {
+	ResetSavings()
+	t.Cleanup(ResetSavings)
+	dropped := CostEstimationDroppedCount()
+
+	server, _ := newMockGemini(t, `{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`)
+	h := NewProxyHandler(domain.NewMockKeyManager(testProxyKey), nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(server.URL)),
+		WithAsyncCostEstimation(1),
+	)
+	// The worker blocks on its first job, so at most one more fits the queue.
+	release := make(chan struct{})
+	h.costs.estimate = func(s string) int {
+		<-release
+		return EstimateTokens(s)
+	}
+
+	const requests = 4
+	for i := 0; i < requests; i++ {
+		if w := postChat(h); w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i, w.Code)
+		}
+	}
+	if got := CostEstimationDroppedCount() - dropped; got < requests-2 {
+		t.Errorf("dropped cost jobs = %d, want at least %d", got, requests-2)
+	}
+
+	close(release)
+	h.Close()
+	if got := GetCostTotals().Requests; got != requests {
+		t.Errorf("Requests = %d, want %d after draining", got, requests)
+	}
+}
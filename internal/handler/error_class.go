@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// Error categories of ErrorClass.
+const (
+	ErrorCategoryRateLimit      = "rate_limit"
+	ErrorCategoryAuth           = "auth"
+	ErrorCategoryQuota          = "quota"
+	ErrorCategoryServerError    = "server_error"
+	ErrorCategoryTimeout        = "timeout"
+	ErrorCategoryNetwork        = "network"
+	ErrorCategoryInvalidRequest = "invalid_request"
+)
+
+// ErrorClass describes a failed provider call: what went wrong, whether
+// another key may succeed and whether the key should leave rotation.
+type ErrorClass struct {
+	// Category is one of the ErrorCategory constants.
+	Category string
+
+	// IsRetryable reports whether the request may succeed with another key.
+	IsRetryable bool
+
+	// ShouldMarkDead reports whether the key that failed should be taken
+	// out of rotation until its cooldown passes.
+	ShouldMarkDead bool
+
+	// SuggestedAction tells an operator what to do about the error.
+	SuggestedAction string
+}
+
+// ClassifyError sorts err from a provider call into the error taxonomy.
+// Rate limits, exhausted quota and transient server errors are retried and
+// take the key out of rotation. Timeouts and empty answers are retried with
+// the key kept in rotation, as the key is likely fine. Authentication
+// failures, invalid requests, invalid responses, transport errors and
+// cancelled requests are not retried.
+func ClassifyError(err error) ErrorClass {
+	var adapterErr *adapter.AdapterError
+	var timeoutErr *adapter.ProviderTimeoutError
+	var emptyErr *adapter.EmptyResponseError
+	var logprobsErr *adapter.LogprobsNotSupportedError
+	var formatErr *adapter.ResponseFormatNotSupportedError
+	var toolsErr *adapter.ToolsNotSupportedError
+	switch {
+	case errors.As(err, &adapterErr):
+		return classifyAdapterError(adapterErr)
+	case errors.As(err, &timeoutErr):
+		return ErrorClass{Category: ErrorCategoryTimeout, IsRetryable: true,
+			SuggestedAction: "check provider latency or raise the provider timeout"}
+	case errors.As(err, &emptyErr):
+		return ErrorClass{Category: ErrorCategoryServerError, IsRetryable: true,
+			SuggestedAction: "none; the provider answered empty and the request moved to the next key"}
+	case errors.As(err, &logprobsErr), errors.As(err, &formatErr), errors.As(err, &toolsErr):
+		return ErrorClass{Category: ErrorCategoryInvalidRequest,
+			SuggestedAction: "remove the unsupported option from the request"}
+	case errors.Is(err, adapter.ErrInvalidResponse):
+		return ErrorClass{Category: ErrorCategoryServerError,
+			SuggestedAction: "check the provider's status; its response failed validation"}
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return ErrorClass{Category: ErrorCategoryQuota,
+			SuggestedAction: "raise the key token quotas or add keys"}
+	case errors.Is(err, domain.ErrTokenRateExceeded), errors.Is(err, domain.ErrProviderRateLimited),
+		errors.Is(err, domain.ErrKeysBusy), errors.Is(err, ErrQueueFull), errors.Is(err, ErrQueueTimeout):
+		return ErrorClass{Category: ErrorCategoryRateLimit,
+			SuggestedAction: "slow down clients or add keys"}
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClass{Category: ErrorCategoryTimeout,
+			SuggestedAction: "the request ran out of time; raise the client timeout"}
+	}
+	return ErrorClass{Category: ErrorCategoryNetwork,
+		SuggestedAction: "check connectivity to the provider"}
+}
+
+// classifyAdapterError classifies a provider's non-200 answer by its status
+// and provider code. Retryable answers take the key out of rotation.
+func classifyAdapterError(err *adapter.AdapterError) ErrorClass {
+	class := ErrorClass{IsRetryable: err.Retryable, ShouldMarkDead: err.Retryable}
+	switch {
+	case err.IsRateLimit() && strings.Contains(strings.ToLower(err.ProviderMessage), "quota"):
+		class.Category = ErrorCategoryQuota
+		class.SuggestedAction = "wait for the key's quota to reset or upgrade its plan"
+	case err.IsRateLimit():
+		class.Category = ErrorCategoryRateLimit
+		class.SuggestedAction = "lower the request rate or add keys"
+	case err.StatusCode == http.StatusUnauthorized || err.StatusCode == http.StatusForbidden:
+		class.Category = ErrorCategoryAuth
+		class.SuggestedAction = "check that the API key is valid and allowed to use the model"
+	case err.StatusCode == http.StatusRequestTimeout:
+		class.Category = ErrorCategoryTimeout
+		class.SuggestedAction = "check provider latency or retry later"
+	case err.StatusCode >= 500:
+		class.Category = ErrorCategoryServerError
+		class.SuggestedAction = "check the provider's status page"
+	default:
+		class.Category = ErrorCategoryInvalidRequest
+		class.SuggestedAction = "fix the request; the provider rejected it"
+	}
+	return class
+}
+
+// classifiedError is a failed provider call with the ErrorClass the handler
+// gave it, so KeyManager.HandleError follows the configured retry status
+// codes rather than the provider's own verdict.
+type classifiedError struct {
+	error
+	class ErrorClass
+}
+
+// Unwrap returns the provider error.
+func (e classifiedError) Unwrap() error { return e.error }
+
+// ShouldRetry implements domain.ProviderError.
+func (e classifiedError) ShouldRetry() bool { return e.class.IsRetryable }
+
+// ShouldMarkDead implements domain.ProviderError.
+func (e classifiedError) ShouldMarkDead() bool { return e.class.ShouldMarkDead }
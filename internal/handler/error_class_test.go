@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		category  string
+		retryable bool
+		markDead  bool
+	}{
+		{"rate limit", &adapter.AdapterError{StatusCode: 429, ProviderMessage: "slow down", Retryable: true}, ErrorCategoryRateLimit, true, true},
+		{"wrapped rate limit", &adapter.ProviderRateLimitError{Provider: "Gemini", Err: &adapter.AdapterError{StatusCode: 429, Retryable: true}}, ErrorCategoryRateLimit, true, true},
+		{"quota", &adapter.AdapterError{StatusCode: 429, ProviderCode: "RESOURCE_EXHAUSTED", ProviderMessage: "Quota exceeded for metric", Retryable: true}, ErrorCategoryQuota, true, true},
+		{"unauthorized", &adapter.AdapterError{StatusCode: 401, ProviderMessage: "API key not valid"}, ErrorCategoryAuth, false, false},
+		{"forbidden", &adapter.AdapterError{StatusCode: 403, ProviderMessage: "permission denied"}, ErrorCategoryAuth, false, false},
+		{"server error", &adapter.AdapterError{StatusCode: 503, ProviderMessage: "overloaded", Retryable: true}, ErrorCategoryServerError, true, true},
+		{"bad request", &adapter.AdapterError{StatusCode: 400, ProviderMessage: "invalid argument"}, ErrorCategoryInvalidRequest, false, false},
+		{"provider timeout", &adapter.ProviderTimeoutError{Provider: "Gemini", Err: context.DeadlineExceeded}, ErrorCategoryTimeout, true, false},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), ErrorCategoryTimeout, false, false},
+		{"empty response", &adapter.EmptyResponseError{Provider: "Gemini"}, ErrorCategoryServerError, true, false},
+		{"logprobs", &adapter.LogprobsNotSupportedError{}, ErrorCategoryInvalidRequest, false, false},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ErrorCategoryNetwork, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := ClassifyError(tt.err)
+			if class.Category != tt.category {
+				t.Errorf("Category = %q, want %q", class.Category, tt.category)
+			}
+			if class.IsRetryable != tt.retryable {
+				t.Errorf("IsRetryable = %v, want %v", class.IsRetryable, tt.retryable)
+			}
+			if class.ShouldMarkDead != tt.markDead {
+				t.Errorf("ShouldMarkDead = %v, want %v", class.ShouldMarkDead, tt.markDead)
+			}
+			if class.SuggestedAction == "" {
+				t.Error("SuggestedAction is empty")
+			}
+		})
+	}
+}
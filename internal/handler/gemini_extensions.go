@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+// Gemini extension headers. They expose Gemini generation settings that the
+// OpenAI request format has no field for. All are optional; a request without
+// them behaves exactly like a plain OpenAI request. An invalid value is
+// rejected with 400 rather than silently ignored.
+//
+//	X-Gemini-TopK: <int >= 1>
+//	    Sets generationConfig.topK, overriding the server default.
+//	X-Gemini-SafetyThreshold: BLOCK_NONE | BLOCK_ONLY_HIGH | BLOCK_MEDIUM_AND_ABOVE | BLOCK_LOW_AND_ABOVE
+//	    Applies the threshold to every harm category.
+//	X-Gemini-Safety-Level: strict | moderate | none
+//	    Shorthand for BLOCK_LOW_AND_ABOVE, BLOCK_MEDIUM_AND_ABOVE and BLOCK_NONE.
+//	    Cannot be combined with X-Gemini-SafetyThreshold.
+//	X-Gemini-Thinking-Budget: <int 0-24576>
+//	    Sets generationConfig.thinkingConfig.thinkingBudget; 0 turns thinking off.
+//	    The reasoning is not returned but its tokens count as completion tokens.
+//
+// Disabling safety filtering (BLOCK_NONE through either header) is only honored
+// for clients on the safety allowlist; others get 403.
+const (
+	HeaderGeminiTopK            = "X-Gemini-TopK"
+	HeaderGeminiSafetyThreshold = "X-Gemini-SafetyThreshold"
+	HeaderGeminiSafetyLevel     = "X-Gemini-Safety-Level"
+	HeaderGeminiThinkingBudget  = "X-Gemini-Thinking-Budget"
+)
+
+// safetyLevels maps X-Gemini-Safety-Level values to Gemini thresholds.
+var safetyLevels = map[string]string{
+	"strict":   adapter.SafetyBlockLowAndAbove,
+	"moderate": adapter.SafetyBlockMediumAndAbove,
+	"none":     adapter.SafetyBlockNone,
+}
+
+// WithSafetyAllowlist sets the clients allowed to disable safety filtering per request.
+func WithSafetyAllowlist(a *security.IPAllowlist) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.safetyAllowlist = a }
+}
+
+// parseGeminiOverrides reads the Gemini extension headers from r.
+func parseGeminiOverrides(r *http.Request) (adapter.GenerationOverrides, error) {
+	var o adapter.GenerationOverrides
+
+	if v := strings.TrimSpace(r.Header.Get(HeaderGeminiTopK)); v != "" {
+		k, err := strconv.Atoi(v)
+		if err != nil || k < 1 {
+			return o, fmt.Errorf("%s must be a positive integer", HeaderGeminiTopK)
+		}
+		o.TopK = &k
+	}
+
+	if v := strings.TrimSpace(r.Header.Get(HeaderGeminiSafetyThreshold)); v != "" {
+		threshold := strings.ToUpper(v)
+		if !adapter.IsValidSafetyThreshold(threshold) {
+			return o, fmt.Errorf("%s must be one of BLOCK_NONE, BLOCK_ONLY_HIGH, BLOCK_MEDIUM_AND_ABOVE, BLOCK_LOW_AND_ABOVE", HeaderGeminiSafetyThreshold)
+		}
+		o.SafetyThreshold = threshold
+	}
+
+	if v := strings.TrimSpace(r.Header.Get(HeaderGeminiSafetyLevel)); v != "" {
+		if o.SafetyThreshold != "" {
+			return o, fmt.Errorf("set only one of %s and %s", HeaderGeminiSafetyThreshold, HeaderGeminiSafetyLevel)
+		}
+		threshold, ok := safetyLevels[strings.ToLower(v)]
+		if !ok {
+			return o, fmt.Errorf("%s must be one of strict, moderate, none", HeaderGeminiSafetyLevel)
+		}
+		o.SafetyThreshold = threshold
+	}
+
+	if v := strings.TrimSpace(r.Header.Get(HeaderGeminiThinkingBudget)); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > adapter.MaxGeminiThinkingBudget {
+			return o, fmt.Errorf("%s must be an integer between 0 and %d", HeaderGeminiThinkingBudget, adapter.MaxGeminiThinkingBudget)
+		}
+		o.ThinkingBudget = &n
+	}
+
+	return o, nil
+}
+
+// applyGeminiOverrides attaches the extension header settings to the request
+// context so the adapter picks them up. It sends a 400 and returns false when
+// a header is invalid, or a 403 when a client off the allowlist asks to
+// disable safety filtering.
+func (h *ProxyHandler) applyGeminiOverrides(c *gin.Context) bool {
+	o, err := parseGeminiOverrides(c.Request)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return false
+	}
+
+	if o.SafetyThreshold == adapter.SafetyBlockNone && !h.safetyAllowlist.Allows(clientIP(c)) {
+		h.logger.Warn("safety override denied", slog.String("client_ip", clientIP(c)))
+		h.sendError(c, http.StatusForbidden, "permission_error", "disabling safety filtering is not allowed from this address")
+		return false
+	}
+	c.Request = c.Request.WithContext(adapter.WithGenerationOverrides(c.Request.Context(), o))
+	return true
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+// serveChatWithHeaders posts a chat completion with the given headers and
+// returns the response and the Gemini request the mock provider received, if any.
+// httptest requests come from 192.0.2.1.
+func serveChatWithHeaders(t *testing.T, headers map[string]string, opts ...ProxyHandlerOption) (*httptest.ResponseRecorder, *adapter.GeminiRequest) {
+	t.Helper()
+
+	var upstream *adapter.GeminiRequest
+	gemini := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = &adapter.GeminiRequest{}
+		json.NewDecoder(r.Body).Decode(upstream)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	defer gemini.Close()
+
+	gin.SetMode(gin.TestMode)
+	opts = append([]ProxyHandlerOption{
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(gemini.URL)),
+	}, opts...)
+	h := NewProxyHandler(domain.NewMockKeyManager(testProxyKey), nil, opts...)
+	r := gin.New()
+	r.POST("/v1/chat/completions", h.HandleChatCompletion)
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w, upstream
+}
+
+func TestGeminiExtensionHeaders_TopK(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantTopK *int
+	}{
+		{"no header", nil, nil},
+		{"topK", map[string]string{HeaderGeminiTopK: "7"}, intPtr(7)},
+		{"topK with spaces", map[string]string{HeaderGeminiTopK: " 12 "}, intPtr(12)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, upstream := serveChatWithHeaders(t, tt.headers)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body.String())
+			}
+			got := upstream.GenerationConfig.TopK
+			if (got == nil) != (tt.wantTopK == nil) || (got != nil && *got != *tt.wantTopK) {
+				t.Errorf("GenerationConfig.TopK = %v, want %v", got, tt.wantTopK)
+			}
+		})
+	}
+}
+
+func TestGeminiExtensionHeaders_SafetyThreshold(t *testing.T) {
+	w, upstream := serveChatWithHeaders(t, map[string]string{HeaderGeminiSafetyThreshold: "block_only_high"})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if len(upstream.SafetySettings) != len(adapter.GeminiHarmCategories) {
+		t.Fatalf("len(SafetySettings) = %d, want %d", len(upstream.SafetySettings), len(adapter.GeminiHarmCategories))
+	}
+	for _, s := range upstream.SafetySettings {
+		if s.Threshold != adapter.SafetyBlockOnlyHigh {
+			t.Errorf("%s threshold = %s, want %s", s.Category, s.Threshold, adapter.SafetyBlockOnlyHigh)
+		}
+	}
+}
+
+func TestGeminiExtensionHeaders_ThinkingBudget(t *testing.T) {
+	for _, budget := range []int{0, 1024, adapter.MaxGeminiThinkingBudget} {
+		w, upstream := serveChatWithHeaders(t, map[string]string{HeaderGeminiThinkingBudget: strconv.Itoa(budget)})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("budget %d: status = %d, want 200; body = %s", budget, w.Code, w.Body.String())
+		}
+		tc := upstream.GenerationConfig.ThinkingConfig
+		if tc == nil || tc.ThinkingBudget == nil || *tc.ThinkingBudget != budget {
+			t.Errorf("budget %d: ThinkingConfig = %+v, want thinkingBudget %d", budget, tc, budget)
+		}
+	}
+}
+
+func TestGeminiExtensionHeaders_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"topK not a number", map[string]string{HeaderGeminiTopK: "many"}},
+		{"topK zero", map[string]string{HeaderGeminiTopK: "0"}},
+		{"unknown threshold", map[string]string{HeaderGeminiSafetyThreshold: "BLOCK_SOME"}},
+		{"unknown safety level", map[string]string{HeaderGeminiSafetyLevel: "lenient"}},
+		{"thinking budget not a number", map[string]string{HeaderGeminiThinkingBudget: "lots"}},
+		{"thinking budget negative", map[string]string{HeaderGeminiThinkingBudget: "-1"}},
+		{"thinking budget too large", map[string]string{HeaderGeminiThinkingBudget: "24577"}},
+		{"both safety headers", map[string]string{
+			HeaderGeminiSafetyThreshold: "BLOCK_ONLY_HIGH",
+			HeaderGeminiSafetyLevel:     "strict",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, upstream := serveChatWithHeaders(t, tt.headers)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+			if upstream != nil {
+				t.Error("request reached the provider despite an invalid header")
+			}
+		})
+	}
+}
+
+func TestGeminiExtensionHeaders_SafetyLevel(t *testing.T) {
+	allowlist, err := security.ParseIPAllowlist([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("ParseIPAllowlist: %v", err)
+	}
+	defaults := adapter.SafetySettingsFor(adapter.SafetyBlockOnlyHigh)
+
+	tests := []struct {
+		level string
+		want  string
+	}{
+		{"", adapter.SafetyBlockOnlyHigh},
+		{"strict", adapter.SafetyBlockLowAndAbove},
+		{"moderate", adapter.SafetyBlockMediumAndAbove},
+		{"none", adapter.SafetyBlockNone},
+		{"Strict", adapter.SafetyBlockLowAndAbove},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.level != "" {
+				headers[HeaderGeminiSafetyLevel] = tt.level
+			}
+			w, upstream := serveChatWithHeaders(t, headers,
+				WithSafetyAllowlist(allowlist),
+				WithAdapterOptions(adapter.WithSafetySettings(defaults)),
+			)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body.String())
+			}
+			if len(upstream.SafetySettings) != len(adapter.GeminiHarmCategories) {
+				t.Fatalf("len(SafetySettings) = %d, want %d", len(upstream.SafetySettings), len(adapter.GeminiHarmCategories))
+			}
+			for _, s := range upstream.SafetySettings {
+				if s.Threshold != tt.want {
+					t.Errorf("%s threshold = %s, want %s", s.Category, s.Threshold, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGeminiExtensionHeaders_SafetyNoneRequiresAllowlist(t *testing.T) {
+	allowlist, err := security.ParseIPAllowlist([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("ParseIPAllowlist: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"safety level", map[string]string{HeaderGeminiSafetyLevel: "none"}},
+		{"safety threshold", map[string]string{HeaderGeminiSafetyThreshold: "BLOCK_NONE"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, upstream := serveChatWithHeaders(t, tt.headers, WithSafetyAllowlist(allowlist))
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+			if upstream != nil {
+				t.Error("request reached the provider from a client off the allowlist")
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int { return &i }
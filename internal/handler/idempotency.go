@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+)
+
+// Idempotency headers. A request carrying IdempotencyKeyHeader is answered
+// with the key echoed in IdempotencyKeyResponseHeader.
+const (
+	IdempotencyKeyHeader         = "Idempotency-Key"
+	IdempotencyKeyResponseHeader = "X-Idempotency-Key"
+)
+
+// DefaultIdempotencyTTL is how long a response is replayed for its
+// idempotency key.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyStore keeps the successful responses of requests sent with an
+// Idempotency-Key, so a retried request is answered without calling the
+// provider again. Responses live in a FlashCache of their own, separate
+// from the response cache, for DefaultIdempotencyTTL.
+type IdempotencyStore struct {
+	cache *FlashCache
+
+	mu       sync.Mutex
+	inFlight map[string]struct{}
+}
+
+// NewIdempotencyStore returns an empty store whose cache cleanup runs until
+// ctx is cancelled. opts configure the cache; its TTL defaults to
+// DefaultIdempotencyTTL.
+func NewIdempotencyStore(ctx context.Context, opts ...FlashCacheOption) *IdempotencyStore {
+	opts = append([]FlashCacheOption{WithCacheTTL(DefaultIdempotencyTTL)}, opts...)
+	return &IdempotencyStore{
+		cache:    NewFlashCache(ctx, opts...),
+		inFlight: make(map[string]struct{}),
+	}
+}
+
+// begin returns the stored response for key, or claims key for a request
+// about to be processed. It reports false for both when another request
+// holds key.
+func (s *IdempotencyStore) begin(key string) (response []byte, found, claimed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, busy := s.inFlight[key]; busy {
+		return nil, false, false
+	}
+	if response, found = s.cache.Get(key); found {
+		return response, true, false
+	}
+	s.inFlight[key] = struct{}{}
+	return nil, false, true
+}
+
+// finish releases key, storing response for it unless response is nil.
+func (s *IdempotencyStore) finish(key string, response []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if response != nil {
+		s.cache.Set(key, response)
+	}
+	delete(s.inFlight, key)
+}
+
+// IdempotencyMiddleware makes POST requests carrying an Idempotency-Key safe
+// to retry. The first request with a key is processed and, when it succeeds
+// with a JSON response, stored; later requests with the key get the stored
+// response without reaching the handler. A request whose key is still being
+// processed gets 409. Keys are scoped to the request path and Authorization
+// header, also once StripAuthHeadersMiddleware removed it, so clients cannot
+// read each other's responses.
+func IdempotencyMiddleware(store *IdempotencyStore, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		c.Header(IdempotencyKeyResponseHeader, key)
+
+		storeKey := HashRequest([]byte(authScope(c) + "\n" + c.Request.URL.Path + "\n" + key))
+		response, found, claimed := store.begin(storeKey)
+		switch {
+		case found:
+			if logger != nil {
+				requestLogger(c, logger).Info("idempotent replay", slog.String("idempotency_key", key))
+			}
+			c.Data(http.StatusOK, ContentTypeJSON, response)
+			c.Abort()
+			return
+		case !claimed:
+			c.AbortWithStatusJSON(http.StatusConflict, adapter.OpenAIError{
+				Error: adapter.OpenAIErrorDetail{
+					Message: "a request with this Idempotency-Key is still being processed",
+					Type:    "conflict_error",
+				},
+			})
+			return
+		}
+
+		writer := &idempotentWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		var stored []byte
+		defer func() { store.finish(storeKey, stored) }()
+
+		c.Next()
+
+		if writer.Status() == http.StatusOK && strings.HasPrefix(writer.Header().Get("Content-Type"), ContentTypeJSON) {
+			stored = writer.body.Bytes()
+		}
+	}
+}
+
+// idempotentWriter keeps a copy of the response body.
+type idempotentWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotentWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotentWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
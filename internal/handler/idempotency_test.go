@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func newIdempotentRouter(t *testing.T, baseURL string) *gin.Engine {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	h := NewProxyHandler(domain.NewMockKeyManager(testProxyKey), nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(baseURL)),
+	)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// Authorization headers are stripped before idempotency, as in main.go.
+	r.Use(StripAuthHeadersMiddleware())
+	r.Use(RequestIDMiddleware())
+	r.Use(ContentNegotiationMiddleware())
+	r.Use(IdempotencyMiddleware(NewIdempotencyStore(ctx), nil))
+	r.POST("/v1/chat/completions", h.HandleChatCompletion)
+	return r
+}
+
+func postIdempotent(r *gin.Engine, key, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddleware_Replay(t *testing.T) {
+	server, calls := newMockGemini(t, `{"candidates":[{"content":{"parts":[{"text":"hi there"}],"role":"model"},"finishReason":"STOP"}]}`)
+	r := newIdempotentRouter(t, server.URL)
+
+	const key = "6f1c2a9e-3b4d-4e5f-8a7b-9c0d1e2f3a4b"
+	first := postIdempotent(r, key, "")
+	second := postIdempotent(r, key, "")
+
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("status = %d, %d, want 200 twice", first.Code, second.Code)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("provider calls = %d, want 1", got)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("replayed body = %s, want %s", second.Body.String(), first.Body.String())
+	}
+	for i, w := range []*httptest.ResponseRecorder{first, second} {
+		if got := w.Header().Get(IdempotencyKeyResponseHeader); got != key {
+			t.Errorf("response %d %s = %q, want %q", i, IdempotencyKeyResponseHeader, got, key)
+		}
+	}
+
+	postIdempotent(r, "another-key", "")
+	postIdempotent(r, key, "Bearer another-client")
+	postIdempotent(r, "", "")
+	if got := atomic.LoadInt32(calls); got != 4 {
+		t.Errorf("provider calls = %d, want 4 after a new key, another client and no key", got)
+	}
+}
+
+func TestIdempotencyMiddleware_ScopedByStrippedAuth(t *testing.T) {
+	server, calls := newMockGemini(t, `{"candidates":[{"content":{"parts":[{"text":"hi there"}],"role":"model"},"finishReason":"STOP"}]}`)
+	r := newIdempotentRouter(t, server.URL)
+
+	const key = "shared-idempotency-key"
+	postIdempotent(r, key, "Bearer client-a")
+	if w := postIdempotent(r, key, "Bearer client-b"); w.Code != http.StatusOK {
+		t.Fatalf("client B status = %d, want 200", w.Code)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("provider calls = %d, want 2: client B must not get client A's stored response", got)
+	}
+	postIdempotent(r, key, "Bearer client-a")
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("provider calls = %d, want 2 after client A retried", got)
+	}
+}
+
+func TestIdempotencyMiddleware_FailureNotStored(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"bad request","status":"INVALID_ARGUMENT"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	t.Cleanup(server.Close)
+	r := newIdempotentRouter(t, server.URL)
+
+	if w := postIdempotent(r, "retry-me", ""); w.Code == http.StatusOK {
+		t.Fatalf("first status = 200, want the provider error")
+	}
+	if w := postIdempotent(r, "retry-me", ""); w.Code != http.StatusOK {
+		t.Fatalf("retry status = %d, want 200; body = %s", w.Code, w.Body.String())
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("provider calls = %d, want 2 since the failure was not stored", got)
+	}
+}
+
+func TestIdempotencyMiddleware_InFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	t.Cleanup(server.Close)
+	r := newIdempotentRouter(t, server.URL)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postIdempotent(r, "slow", "") }()
+	<-started
+
+	w := postIdempotent(r, "slow", "")
+	close(release)
+	if w.Code != http.StatusConflict {
+		t.Errorf("concurrent status = %d, want 409", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "conflict_error") {
+		t.Errorf("body = %s, want a conflict_error", w.Body.String())
+	}
+	if first := <-done; first.Code != http.StatusOK {
+		t.Errorf("first status = %d, want 200", first.Code)
+	}
+}
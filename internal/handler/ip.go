@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+// clientIPKey is the gin context key holding the client IP found by the
+// engine's RealIPExtractor.
+const clientIPKey = "client_ip"
+
+// RealIPExtractor finds the IP of the client behind any proxies. Forwarding
+// headers are only believed when the direct peer is a trusted proxy, so
+// clients cannot spoof their address by sending the headers.
+type RealIPExtractor struct {
+	trusted    *security.IPAllowlist
+	proxyCount int
+	header     string
+}
+
+// RealIPOption configures a RealIPExtractor.
+type RealIPOption func(*RealIPExtractor)
+
+// WithTrustedProxyCount sets how many proxies forward each request. The
+// client IP is then the nth address from the right of X-Forwarded-For, as
+// every proxy appends the address it was reached from; a shorter header
+// gives its leftmost address. With 0, the default, it is the leftmost
+// public address instead.
+func WithTrustedProxyCount(n int) RealIPOption {
+	return func(e *RealIPExtractor) {
+		e.proxyCount = n
+	}
+}
+
+// WithTrustedProxyHeader sets the only header the client IP is read from,
+// such as CF-Connecting-IP behind Cloudflare or X-Real-IP behind nginx.
+// Without it, X-Real-IP is tried before X-Forwarded-For.
+func WithTrustedProxyHeader(name string) RealIPOption {
+	return func(e *RealIPExtractor) {
+		e.header = name
+	}
+}
+
+// NewRealIPExtractor returns an extractor that believes forwarding headers
+// from peers in trustedProxies, a list of IPs and CIDR ranges. With none,
+// the headers are ignored.
+func NewRealIPExtractor(trustedProxies []string, opts ...RealIPOption) (*RealIPExtractor, error) {
+	trusted, err := security.ParseIPAllowlist(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	e := &RealIPExtractor{trusted: trusted}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e, nil
+}
+
+// ClientIP returns the client IP of r. From a trusted peer that is taken
+// from the configured header, by default X-Real-IP or else X-Forwarded-For;
+// from any other peer, and when the header does not help, it is the peer
+// address.
+func (e *RealIPExtractor) ClientIP(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if !e.trusted.Allows(peer) {
+		return peer
+	}
+
+	header := e.header
+	if header == "" {
+		if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return ip.Unmap().String()
+		}
+		header = "X-Forwarded-For"
+	}
+	if !strings.EqualFold(header, "X-Forwarded-For") {
+		if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(header))); err == nil {
+			return ip.Unmap().String()
+		}
+		return peer
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	if e.proxyCount > 0 {
+		hop := hops[max(len(hops)-e.proxyCount, 0)]
+		if ip, err := netip.ParseAddr(strings.TrimSpace(hop)); err == nil {
+			return ip.Unmap().String()
+		}
+		return peer
+	}
+	for _, hop := range hops {
+		ip, err := netip.ParseAddr(strings.TrimSpace(hop))
+		if err == nil && ip.Unmap().IsGlobalUnicast() && !ip.Unmap().IsPrivate() {
+			return ip.Unmap().String()
+		}
+	}
+	return peer
+}
+
+// WithIPExtractor makes e the engine's source of client IPs for logging,
+// usage tracking and allowlists. Gin's own forwarded-header handling is
+// turned off, so c.ClientIP() only ever returns the peer address.
+func WithIPExtractor(e *RealIPExtractor) gin.OptionFunc {
+	return func(engine *gin.Engine) {
+		engine.ForwardedByClientIP = false
+		engine.Use(func(c *gin.Context) {
+			c.Set(clientIPKey, e.ClientIP(c.Request))
+			c.Next()
+		})
+	}
+}
+
+// clientIP returns the client IP found by the engine's RealIPExtractor, or
+// Gin's when the engine has none.
+func clientIP(c *gin.Context) string {
+	if ip := c.GetString(clientIPKey); ip != "" {
+		return ip
+	}
+	return c.ClientIP()
+}
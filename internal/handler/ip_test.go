@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRealIPExtractor_ClientIP(t *testing.T) {
+	e, err := NewRealIPExtractor([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatalf("NewRealIPExtractor() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		peer    string
+		realIP  string
+		forward string
+		want    string
+	}{
+		{"untrusted peer, no headers", "198.51.100.4:5000", "", "", "198.51.100.4"},
+		{"untrusted peer spoofs X-Real-IP", "198.51.100.4:5000", "203.0.113.9", "", "198.51.100.4"},
+		{"untrusted peer spoofs X-Forwarded-For", "198.51.100.4:5000", "", "203.0.113.9", "198.51.100.4"},
+		{"trusted peer, X-Real-IP", "10.1.2.3:5000", "203.0.113.9", "198.51.100.1", "203.0.113.9"},
+		{"trusted peer, X-Forwarded-For", "10.1.2.3:5000", "", "203.0.113.9, 198.51.100.1", "203.0.113.9"},
+		{"private hops skipped", "10.1.2.3:5000", "", "192.168.1.5, 127.0.0.1, 203.0.113.9", "203.0.113.9"},
+		{"invalid X-Real-IP ignored", "10.1.2.3:5000", "not-an-ip", "203.0.113.9", "203.0.113.9"},
+		{"only private hops", "10.1.2.3:5000", "", "192.168.1.5, 10.0.0.7", "10.1.2.3"},
+		{"trusted peer, no headers", "10.1.2.3:5000", "", "", "10.1.2.3"},
+		{"trusted IPv6 peer", "[::1]:5000", "", "fd00::1, 2001:db8::7", "2001:db8::7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			req.RemoteAddr = tt.peer
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forward != "" {
+				req.Header.Set("X-Forwarded-For", tt.forward)
+			}
+			if got := e.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealIPExtractor_TrustedProxyCount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// The client reaches the router through a CDN, a load balancer and an
+	// ingress at 10.1.2.3; a spoofed address comes first.
+	const forward = "192.0.2.66, 203.0.113.9, 198.51.100.20, 10.0.0.7"
+	tests := []struct {
+		count   int
+		forward string
+		want    string
+	}{
+		{0, forward, "192.0.2.66"},
+		{1, forward, "10.0.0.7"},
+		{2, forward, "198.51.100.20"},
+		{3, forward, "203.0.113.9"},
+		{4, forward, "192.0.2.66"},
+		{9, forward, "192.0.2.66"},
+		{1, "203.0.113.9, garbage", "10.1.2.3"},
+		{1, "", "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		e, err := NewRealIPExtractor([]string{"10.0.0.0/8"}, WithTrustedProxyCount(tt.count))
+		if err != nil {
+			t.Fatalf("NewRealIPExtractor() error = %v", err)
+		}
+		var seen string
+		r := gin.New(WithIPExtractor(e))
+		r.GET("/health", func(c *gin.Context) {
+			seen = clientIP(c)
+			c.Status(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = "10.1.2.3:5000"
+		if tt.forward != "" {
+			req.Header.Set("X-Forwarded-For", tt.forward)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if seen != tt.want {
+			t.Errorf("count %d, X-Forwarded-For %q: clientIP() = %s, want %s", tt.count, tt.forward, seen, tt.want)
+		}
+	}
+
+	// Hops split over several X-Forwarded-For lines count as one list.
+	e, _ := NewRealIPExtractor([]string{"10.0.0.0/8"}, WithTrustedProxyCount(2))
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "10.1.2.3:5000"
+	req.Header.Add("X-Forwarded-For", "192.0.2.66, 203.0.113.9")
+	req.Header.Add("X-Forwarded-For", "198.51.100.20")
+	if got := e.ClientIP(req); got != "203.0.113.9" {
+		t.Errorf("ClientIP() over two header lines = %s, want 203.0.113.9", got)
+	}
+}
+
+func TestRealIPExtractor_TrustedProxyHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		peer   string
+		want   string
+	}{
+		{"CF-Connecting-IP", "10.1.2.3:5000", "203.0.113.9"},
+		{"x-real-ip", "10.1.2.3:5000", "198.51.100.20"},
+		{"X-Forwarded-For", "10.1.2.3:5000", "192.0.2.66"},
+		{"X-Client-IP", "10.1.2.3:5000", "10.1.2.3"},
+		{"CF-Connecting-IP", "198.51.100.4:5000", "198.51.100.4"},
+	}
+
+	for _, tt := range tests {
+		e, err := NewRealIPExtractor([]string{"10.0.0.0/8"}, WithTrustedProxyHeader(tt.header), WithTrustedProxyCount(1))
+		if err != nil {
+			t.Fatalf("NewRealIPExtractor() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = tt.peer
+		req.Header.Set("CF-Connecting-IP", "203.0.113.9")
+		req.Header.Set("X-Real-IP", "198.51.100.20")
+		req.Header.Set("X-Forwarded-For", "192.0.2.66")
+		if got := e.ClientIP(req); got != tt.want {
+			t.Errorf("header %s from %s: ClientIP() = %s, want %s", tt.header, tt.peer, got, tt.want)
+		}
+	}
+}
+
+func TestNewRealIPExtractor_Invalid(t *testing.T) {
+	if _, err := NewRealIPExtractor([]string{"10.0.0.0/99"}); err == nil {
+		t.Error("NewRealIPExtractor() error = nil, want error")
+	}
+}
+
+func TestWithIPExtractor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e, err := NewRealIPExtractor([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewRealIPExtractor() error = %v", err)
+	}
+
+	var seen, ginSeen string
+	r := gin.New(WithIPExtractor(e))
+	r.GET("/health", func(c *gin.Context) {
+		seen, ginSeen = clientIP(c), c.ClientIP()
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		peer string
+		want string
+	}{
+		{"10.1.2.3:5000", "203.0.113.9"},
+		{"198.51.100.4:5000", "198.51.100.4"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = tt.peer
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		if seen != tt.want {
+			t.Errorf("clientIP() from %s = %s, want %s", tt.peer, seen, tt.want)
+		}
+		// Gin's own extraction no longer believes the header either.
+		if want, _, _ := strings.Cut(tt.peer, ":"); ginSeen != want {
+			t.Errorf("c.ClientIP() from %s = %s, want %s", tt.peer, ginSeen, want)
+		}
+	}
+}
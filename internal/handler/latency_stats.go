@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultLatencyWindow is how many request durations LatencyStats keeps per
+// route.
+const DefaultLatencyWindow = 10000
+
+// Stats keeps the durations of the last requests in a ring buffer. Unlike a
+// histogram it keeps every data point, so its percentiles are exact over
+// the window.
+type Stats struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	next      int
+	full      bool
+}
+
+// NewStats returns a window of the last size durations, at least one.
+func NewStats(size int) *Stats {
+	return &Stats{durations: make([]time.Duration, max(size, 1))}
+}
+
+// Add records d, replacing the oldest duration once the window is full.
+func (s *Stats) Add(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.durations[s.next] = d
+	s.next++
+	if s.next == len(s.durations) {
+		s.next = 0
+		s.full = true
+	}
+}
+
+// Len returns the number of durations in the window.
+func (s *Stats) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.full {
+		return len(s.durations)
+	}
+	return s.next
+}
+
+// Percentile returns the p-th percentile, from 0 to 100, of the durations
+// in the window, or 0 when it is empty.
+func (s *Stats) Percentile(p float64) time.Duration {
+	return percentile(s.snapshot(), p)
+}
+
+// snapshot returns a copy of the durations in the window.
+func (s *Stats) snapshot() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.full {
+		return append([]time.Duration(nil), s.durations...)
+	}
+	return append([]time.Duration(nil), s.durations[:s.next]...)
+}
+
+// percentile returns the nearest-rank p-th percentile of d, reordering d.
+func percentile(d []time.Duration, p float64) time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+	// The epsilon keeps ranks such as 99.9% of 1000 from rounding up past
+	// 999 on float error.
+	k := int(math.Ceil(p/100*float64(len(d))-1e-9)) - 1
+	return quickselect(d, min(max(k, 0), len(d)-1))
+}
+
+// quickselect returns the k-th smallest duration of d, reordering d so that
+// it sits at index k. It runs in linear time on average.
+func quickselect(d []time.Duration, k int) time.Duration {
+	lo, hi := 0, len(d)-1
+	for lo < hi {
+		// Median-of-three keeps sorted and reversed windows linear.
+		mid := lo + (hi-lo)/2
+		if d[mid] < d[lo] {
+			d[mid], d[lo] = d[lo], d[mid]
+		}
+		if d[hi] < d[lo] {
+			d[hi], d[lo] = d[lo], d[hi]
+		}
+		if d[hi] < d[mid] {
+			d[hi], d[mid] = d[mid], d[hi]
+		}
+		pivot := d[mid]
+
+		i, j := lo, hi
+		for i <= j {
+			for d[i] < pivot {
+				i++
+			}
+			for d[j] > pivot {
+				j--
+			}
+			if i <= j {
+				d[i], d[j] = d[j], d[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case k <= j:
+			hi = j
+		case k >= i:
+			lo = i
+		default:
+			return d[k]
+		}
+	}
+	return d[k]
+}
+
+// LatencyStats keeps a Stats window for every route.
+type LatencyStats struct {
+	size int
+
+	mu     sync.RWMutex
+	routes map[string]*Stats
+}
+
+// NewLatencyStats returns per-route windows of the last windowSize request
+// durations.
+func NewLatencyStats(windowSize int) *LatencyStats {
+	return &LatencyStats{size: windowSize, routes: make(map[string]*Stats)}
+}
+
+// Add records a request to route that took d.
+func (l *LatencyStats) Add(route string, d time.Duration) {
+	l.mu.RLock()
+	s, ok := l.routes[route]
+	l.mu.RUnlock()
+	if !ok {
+		l.mu.Lock()
+		if s, ok = l.routes[route]; !ok {
+			s = NewStats(l.size)
+			l.routes[route] = s
+		}
+		l.mu.Unlock()
+	}
+	s.Add(d)
+}
+
+// Stats returns the window of route, or nil when no request to it was
+// recorded.
+func (l *LatencyStats) Stats(route string) *Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.routes[route]
+}
+
+// StatsMiddleware records how long every request took in stats, under its
+// route pattern such as /admin/keys/:name. Requests that match no route are
+// not recorded.
+func StatsMiddleware(stats *LatencyStats) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		if route := c.FullPath(); route != "" {
+			stats.Add(route, time.Since(start))
+		}
+	}
+}
+
+// LatencyPercentiles are the percentiles of a route's window in
+// milliseconds.
+type LatencyPercentiles struct {
+	// Count is the number of requests in the window.
+	Count int `json:"count"`
+
+	P50  float64 `json:"p50"`
+	P75  float64 `json:"p75"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p999"`
+}
+
+// LatencyStatsResponse is the body returned by GET /admin/stats/latency.
+type LatencyStatsResponse struct {
+	// Routes maps each route pattern to its percentiles.
+	Routes map[string]LatencyPercentiles `json:"routes"`
+}
+
+// Percentiles returns the percentiles of every route's window.
+func (l *LatencyStats) Percentiles() map[string]LatencyPercentiles {
+	l.mu.RLock()
+	routes := make(map[string]*Stats, len(l.routes))
+	for route, s := range l.routes {
+		routes[route] = s
+	}
+	l.mu.RUnlock()
+
+	ms := func(d []time.Duration, p float64) float64 {
+		return float64(percentile(d, p)) / float64(time.Millisecond)
+	}
+	out := make(map[string]LatencyPercentiles, len(routes))
+	for route, s := range routes {
+		d := s.snapshot()
+		out[route] = LatencyPercentiles{
+			Count: len(d),
+			P50:   ms(d, 50),
+			P75:   ms(d, 75),
+			P90:   ms(d, 90),
+			P95:   ms(d, 95),
+			P99:   ms(d, 99),
+			P999:  ms(d, 99.9),
+		}
+	}
+	return out
+}
+
+// HandleLatency serves GET /admin/stats/latency.
+func (l *LatencyStats) HandleLatency(c *gin.Context) {
+	c.JSON(http.StatusOK, LatencyStatsResponse{Routes: l.Percentiles()})
+}
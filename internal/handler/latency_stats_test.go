@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStats_Percentile(t *testing.T) {
+	s := NewStats(DefaultLatencyWindow)
+	if got := s.Percentile(50); got != 0 {
+		t.Errorf("Percentile(50) of an empty window = %v, want 0", got)
+	}
+
+	// 1000 durations spread uniformly over 0-1s, in random order.
+	rng := rand.New(rand.NewSource(1))
+	durations := make([]time.Duration, 1000)
+	for i := range durations {
+		durations[i] = time.Duration(rng.Int63n(int64(time.Second)))
+		s.Add(durations[i])
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	if got, want := s.Percentile(50), durations[499]; got != want {
+		t.Errorf("Percentile(50) = %v, want the median %v", got, want)
+	}
+	if got := s.Percentile(50); got < 450*time.Millisecond || got > 550*time.Millisecond {
+		t.Errorf("Percentile(50) = %v, want about 500ms", got)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, durations[0]},
+		{90, durations[899]},
+		{99, durations[989]},
+		{99.9, durations[998]},
+		{100, durations[999]},
+	} {
+		if got := s.Percentile(tt.p); got != tt.want {
+			t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestStats_Window(t *testing.T) {
+	s := NewStats(4)
+	for _, ms := range []time.Duration{100, 100, 100, 100, 1, 2, 3} {
+		s.Add(ms * time.Millisecond)
+	}
+	// The window holds 100, 1, 2 and 3; the first three 100s slid out.
+	if got := s.Len(); got != 4 {
+		t.Errorf("Len() = %d, want 4", got)
+	}
+	if got := s.Percentile(50); got != 2*time.Millisecond {
+		t.Errorf("Percentile(50) = %v, want 2ms", got)
+	}
+	if got := s.Percentile(100); got != 100*time.Millisecond {
+		t.Errorf("Percentile(100) = %v, want 100ms", got)
+	}
+}
+
+func TestQuickselect(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for n := 1; n <= 50; n++ {
+		d := make([]time.Duration, n)
+		for i := range d {
+			// Few distinct values, so pivots meet duplicates.
+			d[i] = time.Duration(rng.Intn(5))
+		}
+		sorted := append([]time.Duration(nil), d...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		for k := 0; k < n; k++ {
+			if got := quickselect(append([]time.Duration(nil), d...), k); got != sorted[k] {
+				t.Fatalf("quickselect(%v, %d) = %v, want %v", d, k, got, sorted[k])
+			}
+		}
+	}
+}
+
+func TestStatsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stats := NewLatencyStats(DefaultLatencyWindow)
+	r := gin.New()
+	r.Use(StatsMiddleware(stats))
+	r.GET("/keys/:name", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(20 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	r.GET("/admin/stats/latency", stats.HandleLatency)
+
+	for _, path := range []string{"/keys/a", "/keys/b", "/slow", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Paths share their route's window; unknown routes are not recorded.
+	if s := stats.Stats("/keys/:name"); s == nil || s.Len() != 2 {
+		t.Errorf("window of /keys/:name = %v, want 2 requests", s)
+	}
+	if s := stats.Stats("/missing"); s != nil {
+		t.Errorf("window of /missing = %v, want none", s)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/stats/latency", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp LatencyStatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	slow, ok := resp.Routes["/slow"]
+	if !ok || slow.Count != 1 || slow.P50 < 20 || slow.P999 != slow.P50 {
+		t.Errorf("routes[/slow] = %+v, want one request of at least 20ms", slow)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultLogLevelRevert is how long a log level set through the admin API
+// lasts before the configured level is restored.
+const DefaultLogLevelRevert = 5 * time.Minute
+
+// LogLevel changes the level of a running logger. A changed level goes back
+// to the configured one after the revert delay, so debug logging turned on
+// for an investigation is not left on by accident.
+type LogLevel struct {
+	level      *slog.LevelVar
+	configured slog.Level
+	revert     time.Duration
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	revertAt time.Time
+}
+
+// NewLogLevel controls level, whose current value is taken as the
+// configured level. A revert of 0 keeps changed levels until the next
+// change.
+func NewLogLevel(level *slog.LevelVar, revert time.Duration) *LogLevel {
+	return &LogLevel{level: level, configured: level.Level(), revert: revert}
+}
+
+// Set changes the level to l and returns when the configured level will be
+// restored, or the zero time when it will not: l is the configured level or
+// levels do not revert.
+func (ll *LogLevel) Set(l slog.Level) time.Time {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	if ll.timer != nil {
+		ll.timer.Stop()
+		ll.timer = nil
+	}
+	ll.level.Set(l)
+	ll.revertAt = time.Time{}
+	if l == ll.configured || ll.revert <= 0 {
+		return ll.revertAt
+	}
+
+	ll.revertAt = time.Now().Add(ll.revert)
+	var timer *time.Timer
+	timer = time.AfterFunc(ll.revert, func() {
+		ll.mu.Lock()
+		defer ll.mu.Unlock()
+		// A later Set replaced this timer; its level stands.
+		if ll.timer != timer {
+			return
+		}
+		ll.level.Set(ll.configured)
+		ll.timer = nil
+		ll.revertAt = time.Time{}
+	})
+	ll.timer = timer
+	return ll.revertAt
+}
+
+// Level returns the current level and when the configured level will be
+// restored, the zero time when it will not.
+func (ll *LogLevel) Level() (slog.Level, time.Time) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	return ll.level.Level(), ll.revertAt
+}
+
+// Configured returns the level restored after a change.
+func (ll *LogLevel) Configured() slog.Level {
+	return ll.configured
+}
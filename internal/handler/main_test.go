@@ -0,0 +1,11 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/hpn/hpn-g-router/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// Stream timing defaults.
+const (
+	DefaultStreamInterval  = time.Second
+	DefaultStreamHeartbeat = 30 * time.Second
+)
+
+// MetricsEvent is the data of each "metrics" event on the metrics stream.
+type MetricsEvent struct {
+	ActiveKeys int `json:"active_keys"`
+	DeadKeys   int `json:"dead_keys"`
+
+	// RequestsPerSecond is averaged over the request rate window.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+
+	// CacheHitRate is the share of cache lookups that hit since startup, 0 to 1.
+	CacheHitRate float64 `json:"cache_hit_rate"`
+}
+
+// MetricsStream serves live key pool and traffic metrics as server-sent events.
+type MetricsStream struct {
+	km        *domain.KeyManager
+	cache     *FlashCache
+	rate      *RequestRate
+	interval  time.Duration
+	heartbeat time.Duration
+
+	subscribers atomic.Int64
+}
+
+// MetricsStreamOption configures a MetricsStream.
+type MetricsStreamOption func(*MetricsStream)
+
+// WithStreamCache reports the hit rate of cache.
+func WithStreamCache(cache *FlashCache) MetricsStreamOption {
+	return func(s *MetricsStream) { s.cache = cache }
+}
+
+// WithStreamRequestRate reports the request rate counted by r.
+func WithStreamRequestRate(r *RequestRate) MetricsStreamOption {
+	return func(s *MetricsStream) { s.rate = r }
+}
+
+// WithStreamInterval sets how often a metrics event is sent.
+func WithStreamInterval(d time.Duration) MetricsStreamOption {
+	return func(s *MetricsStream) {
+		if d > 0 {
+			s.interval = d
+		}
+	}
+}
+
+// WithStreamHeartbeat sets how often a keep-alive comment is sent.
+func WithStreamHeartbeat(d time.Duration) MetricsStreamOption {
+	return func(s *MetricsStream) {
+		if d > 0 {
+			s.heartbeat = d
+		}
+	}
+}
+
+// NewMetricsStream creates a MetricsStream reporting on km.
+func NewMetricsStream(km *domain.KeyManager, opts ...MetricsStreamOption) *MetricsStream {
+	s := &MetricsStream{
+		km:        km,
+		interval:  DefaultStreamInterval,
+		heartbeat: DefaultStreamHeartbeat,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// StreamSubscriberCount returns the number of connected stream clients.
+func (s *MetricsStream) StreamSubscriberCount() int {
+	return int(s.subscribers.Load())
+}
+
+// Snapshot returns the metrics sent in the next event.
+func (s *MetricsStream) Snapshot() MetricsEvent {
+	e := MetricsEvent{
+		ActiveKeys: s.km.ActiveKeyCount(),
+		DeadKeys:   s.km.DeadKeyCount(),
+	}
+	if s.rate != nil {
+		e.RequestsPerSecond = s.rate.Rate()
+	}
+	if s.cache != nil {
+		if hits, misses, _, _, _ := s.cache.Stats(); hits+misses > 0 {
+			e.CacheHitRate = float64(hits) / float64(hits+misses)
+		}
+	}
+	return e
+}
+
+// HandleStream serves GET /admin/metrics/stream. It sends a "metrics" event
+// every interval and a keep-alive comment every heartbeat until the client
+// disconnects.
+func (s *MetricsStream) HandleStream(c *gin.Context) {
+	s.subscribers.Add(1)
+	defer s.subscribers.Add(-1)
+
+	// The stream outlives the server's write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// Send the headers now so clients see the stream open before the first event.
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+
+	done := c.Request.Context().Done()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-done:
+			return false
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ":keep-alive\n\n")
+			return err == nil
+		case <-ticker.C:
+			c.SSEvent("metrics", s.Snapshot())
+			return true
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/goleak"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// openStream connects to the stream served by s and returns a reader over
+// the response body and a function that disconnects.
+func openStream(t *testing.T, s *MetricsStream) (*bufio.Reader, func(), *httptest.Server) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin/metrics/stream", s.HandleStream)
+	server := httptest.NewServer(r)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/admin/metrics/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		server.Close()
+		t.Fatalf("connect: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	disconnect := func() {
+		cancel()
+		resp.Body.Close()
+	}
+	return bufio.NewReader(resp.Body), disconnect, server
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMetricsStream_SendsEvents(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := NewFlashCache(ctx)
+
+	km := domain.NewKeyManager([]string{"key1", "key2", "key3"}, 0)
+	km.MarkAsDead("key3", "")
+	cache.Set("hit", []byte("{}"))
+	cache.Get("hit")
+	cache.Get("miss")
+	rate := NewRequestRate(DefaultRateWindow)
+	rate.Add()
+
+	s := NewMetricsStream(km,
+		WithStreamCache(cache),
+		WithStreamRequestRate(rate),
+		WithStreamInterval(10*time.Millisecond),
+	)
+	body, disconnect, server := openStream(t, s)
+	defer server.Close()
+
+	waitFor(t, "subscriber", func() bool { return s.StreamSubscriberCount() == 1 })
+
+	events := 0
+	for events < 3 {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read after %d events: %v", events, err)
+		}
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+		events++
+
+		var e MetricsEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("event data %q is not a MetricsEvent: %v", data, err)
+		}
+		if e.ActiveKeys != 2 || e.DeadKeys != 1 {
+			t.Errorf("keys = %d active/%d dead, want 2/1", e.ActiveKeys, e.DeadKeys)
+		}
+		if e.CacheHitRate != 0.5 {
+			t.Errorf("cache_hit_rate = %v, want 0.5", e.CacheHitRate)
+		}
+		if e.RequestsPerSecond <= 0 {
+			t.Errorf("requests_per_second = %v, want > 0", e.RequestsPerSecond)
+		}
+	}
+
+	disconnect()
+	waitFor(t, "disconnect", func() bool { return s.StreamSubscriberCount() == 0 })
+	server.Close()
+	http.DefaultClient.CloseIdleConnections()
+}
+
+func TestMetricsStream_Heartbeat(t *testing.T) {
+	s := NewMetricsStream(domain.NewKeyManager([]string{"key1"}, 0),
+		WithStreamInterval(time.Hour),
+		WithStreamHeartbeat(10*time.Millisecond),
+	)
+	body, disconnect, server := openStream(t, s)
+	defer server.Close()
+	defer disconnect()
+
+	line, err := body.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if strings.TrimSpace(line) != ":keep-alive" {
+		t.Errorf("first line = %q, want :keep-alive", line)
+	}
+}
+
+func TestProxyHandler_HealthStreamSubscribers(t *testing.T) {
+	km := domain.NewKeyManager([]string{testProxyKey}, 0)
+	s := NewMetricsStream(km, WithStreamInterval(time.Hour))
+	_, disconnect, server := openStream(t, s)
+	defer server.Close()
+	defer disconnect()
+	waitFor(t, "subscriber", func() bool { return s.StreamSubscriberCount() == 1 })
+
+	h := NewProxyHandler(km, nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithMetricsStream(s),
+	)
+	r := gin.New()
+	r.GET("/health", h.HandleHealth)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var resp HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.StreamSubscribers != 1 {
+		t.Errorf("stream_subscribers = %d, want 1", resp.StreamSubscribers)
+	}
+}
@@ -1,12 +1,23 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/security"
 	"github.com/hpn/hpn-g-router/internal/ui"
 )
 
@@ -15,7 +26,7 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Gemini-TopK, X-Gemini-SafetyThreshold, X-Gemini-Safety-Level, X-Gemini-Thinking-Budget, X-User-ID")
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -26,12 +37,156 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// LoggingOption configures LoggingMiddleware.
+type LoggingOption func(*loggingConfig)
+
+type loggingConfig struct {
+	users           *UserUsageTracker
+	slowThreshold   time.Duration
+	onSlow          func(model string)
+	debugSampleRate float64
+	bodyHashing     bool
+	redactBodies    bool
+	fields          map[string]bool
+}
+
+// slowRequests counts requests slower than the slow request threshold.
+var slowRequests atomic.Int64
+
+// SlowRequestCount returns how many requests took longer than the slow
+// request threshold since startup.
+func SlowRequestCount() int64 {
+	return slowRequests.Load()
+}
+
+// WithSlowRequestThreshold logs a warning for every request that takes
+// longer than d. Zero, the default, disables the check.
+func WithSlowRequestThreshold(d time.Duration) LoggingOption {
+	return func(cfg *loggingConfig) { cfg.slowThreshold = d }
+}
+
+// WithSlowRequestObserver calls fn with the requested model of every slow
+// request, e.g. to count them in Prometheus.
+func WithSlowRequestObserver(fn func(model string)) LoggingOption {
+	return func(cfg *loggingConfig) { cfg.onSlow = fn }
+}
+
+// WithUserUsageTracker records the tokens of every successful proxied
+// request in t, against the X-User-ID header or the client IP.
+func WithUserUsageTracker(t *UserUsageTracker) LoggingOption {
+	return func(cfg *loggingConfig) { cfg.users = t }
+}
+
+// WithDebugSampleRate keeps the debug-level logs of only a fraction r, from
+// 0 to 1, of requests. Entries about a sampled request carry
+// debug_sampled=true; the info-level completion log is always written. The
+// default of 1 keeps every debug log and adds no attribute.
+func WithDebugSampleRate(r float64) LoggingOption {
+	return func(cfg *loggingConfig) { cfg.debugSampleRate = r }
+}
+
+// WithBodyHashing logs request_body_hash, the first 12 hex characters of
+// the SHA-256 of the request body, and sends it in the X-Request-Hash
+// response header, so duplicate requests can be found. The body itself is
+// never logged.
+func WithBodyHashing(enabled bool) LoggingOption {
+	return func(cfg *loggingConfig) { cfg.bodyHashing = enabled }
+}
+
+// WithRequestBodyRedaction keeps every value derived from the request body
+// out of the log and the response headers, overriding WithBodyHashing.
+func WithRequestBodyRedaction(enabled bool) LoggingOption {
+	return func(cfg *loggingConfig) { cfg.redactBodies = enabled }
+}
+
+// WithRequestLogFields limits the request completed entry to the fields in
+// fields, such as "status" or "latency"; "tokens" also covers tokens_exact.
+// request_body_hash and forwarded_user follow their own options. A nil map,
+// the default, logs every field.
+func WithRequestLogFields(fields map[string]bool) LoggingOption {
+	return func(cfg *loggingConfig) { cfg.fields = fields }
+}
+
+// RequestHashHeader carries the request body hash when body hashing is on.
+const RequestHashHeader = "X-Request-Hash"
+
+// requestHashLen is how many hex characters of the body hash are logged
+// and sent.
+const requestHashLen = 12
+
+// requestBody returns the request body as the client sent it and restores
+// it for the handlers. It returns nil for a request without a body or one
+// that could not be read.
+func requestBody(c *gin.Context) []byte {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return nil
+	}
+	b, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// debugSampledKey holds whether a request's debug logs were sampled in. It
+// is only set while debug sampling is on.
+const debugSampledKey = "debug_sampled"
+
+// requestLogger returns l for logging about the request in c, applying the
+// request's debug sampling decision.
+func requestLogger(c *gin.Context, l *slog.Logger) *slog.Logger {
+	if sampled, ok := c.Get(debugSampledKey); ok {
+		if sampled.(bool) {
+			return l.With(slog.Bool(debugSampledKey, true))
+		}
+		return slog.New(noDebugHandler{l.Handler()})
+	}
+	return l
+}
+
+// noDebugHandler drops debug-level records.
+type noDebugHandler struct {
+	slog.Handler
+}
+
+// Enabled reports whether the handler handles records at level.
+func (h noDebugHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level > slog.LevelDebug && h.Handler.Enabled(ctx, level)
+}
+
+// WithAttrs returns a handler that keeps dropping debug records.
+func (h noDebugHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return noDebugHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a handler that keeps dropping debug records.
+func (h noDebugHandler) WithGroup(name string) slog.Handler {
+	return noDebugHandler{h.Handler.WithGroup(name)}
+}
+
 // LoggingMiddleware logs request details and cost savings.
-func LoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
+func LoggingMiddleware(logger *slog.Logger, opts ...LoggingOption) gin.HandlerFunc {
+	cfg := loggingConfig{debugSampleRate: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	return func(c *gin.Context) {
 		start := time.Now()
+		if cfg.debugSampleRate < 1 {
+			c.Set(debugSampledKey, rand.Float64() < cfg.debugSampleRate)
+		}
+		reqLogger := requestLogger(c, logger)
 		path := c.Request.URL.Path
 		query := c.Request.URL.RawQuery
+		var bodyHash string
+		if cfg.bodyHashing && !cfg.redactBodies {
+			if body := requestBody(c); len(body) > 0 {
+				bodyHash = HashRequest(body)[:requestHashLen]
+				c.Header(RequestHashHeader, bodyHash)
+			}
+		}
 
 		c.Next()
 
@@ -40,20 +195,98 @@ func LoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
 		keyName, _ := keyUsed.(string)
 		attempts, _ := c.Get("attempts")
 		attemptCount, _ := attempts.(int)
+		userID := requestUserID(c)
 
-		logger.Info("request completed",
-			slog.String("method", c.Request.Method),
-			slog.String("path", path),
-			slog.String("query", query),
-			slog.Int("status", c.Writer.Status()),
-			slog.Duration("latency", latency),
-			slog.String("client_ip", c.ClientIP()),
-			slog.String("key_used", maskKey(keyName)),
-			slog.Int("attempts", attemptCount),
-			slog.String("user_agent", c.Request.UserAgent()),
-		)
+		var attrs []any
+		logs := func(field string) bool { return cfg.fields == nil || cfg.fields[field] }
+		if logs("method") {
+			attrs = append(attrs, slog.String("method", c.Request.Method))
+		}
+		if logs("path") {
+			attrs = append(attrs, slog.String("path", path))
+		}
+		if logs("query") {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if logs("status") {
+			attrs = append(attrs, slog.Int("status", c.Writer.Status()))
+		}
+		if logs("latency") {
+			attrs = append(attrs, slog.Duration("latency", latency))
+		}
+		if logs("client_ip") {
+			attrs = append(attrs, slog.String("client_ip", clientIP(c)))
+		}
+		if logs("user_id") {
+			attrs = append(attrs, slog.String("user_id", security.Redact(userID)))
+		}
+		if logs("key_used") {
+			attrs = append(attrs, slog.String("key_used", security.MaskKey(keyName)))
+		}
+		if logs("attempts") {
+			attrs = append(attrs, slog.Int("attempts", attemptCount))
+		}
+		if logs("user_agent") {
+			attrs = append(attrs, slog.String("user_agent", c.Request.UserAgent()))
+		}
+		if id := c.GetString(requestIDKey); id != "" && logs("request_id") {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		if model := c.GetString("model"); model != "" && logs("model") {
+			attrs = append(attrs, slog.String("model", model))
+		}
+		if n, ok := c.Get(RequestBytesKey); ok {
+			if logs("request_bytes") {
+				attrs = append(attrs, slog.Int64("request_bytes", n.(int64)))
+			}
+			if logs("response_bytes") {
+				attrs = append(attrs, slog.Int64("response_bytes", c.GetInt64(ResponseBytesKey)))
+			}
+		}
+		ttft := requestTTFT(c)
+		if ttft > 0 && logs("ttft") {
+			attrs = append(attrs, slog.Duration("ttft", ttft))
+		}
+		if bodyHash != "" {
+			attrs = append(attrs, slog.String("request_body_hash", bodyHash))
+		}
+		if user := c.GetString(forwardedUserKey); user != "" {
+			attrs = append(attrs, slog.String("forwarded_user", security.Redact(user)))
+		}
+		if logs("tokens") {
+			if in, out, ok := requestTokens(c); ok {
+				attrs = append(attrs, slog.Int("tokens", in+out))
+			}
+			if m, ok := c.Get("cost_metrics"); ok {
+				if cm, ok := m.(CostMetrics); ok && cm.ExactTokensUsed {
+					attrs = append(attrs, slog.Bool("tokens_exact", true))
+				}
+			}
+		}
+		reqLogger.Info("request completed", attrs...)
 
-		ui.PrintRequest(c.Request.Method, path, c.Writer.Status(), latency, keyName)
+		if cfg.slowThreshold > 0 && latency > cfg.slowThreshold {
+			model := c.GetString("model")
+			slowRequests.Add(1)
+			reqLogger.Warn("slow request",
+				slog.Duration("latency", latency),
+				slog.String("path", path),
+				slog.String("model", model),
+				slog.String("key_masked", security.MaskKey(keyName)),
+				slog.Int("attempt_count", attemptCount),
+			)
+			if cfg.onSlow != nil {
+				cfg.onSlow(model)
+			}
+		}
+
+		if cfg.users != nil && c.Writer.Status() == http.StatusOK {
+			if in, out, ok := requestTokens(c); ok {
+				cfg.users.RecordRequest(userID, in, out)
+			}
+		}
+
+		ui.PrintRequest(c.Request.Method, path, c.Writer.Status(), latency, ttft, keyName)
 
 		if c.Writer.Status() == http.StatusOK {
 			if m, ok := c.Get("cost_metrics"); ok {
@@ -65,35 +298,105 @@ func LoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
 	}
 }
 
+// PanicReporter receives every panic RecoveryMiddleware recovers, e.g. to
+// forward it to an error tracker. stack is the unredacted stack trace.
+type PanicReporter interface {
+	Report(err any, stack []byte)
+}
+
+// RecoveryOption configures RecoveryMiddleware.
+type RecoveryOption func(*recoveryConfig)
+
+type recoveryConfig struct {
+	reporter     PanicReporter
+	onPanic      func()
+	stackInReply bool
+}
+
+// panicsRecovered counts the panics RecoveryMiddleware recovered.
+var panicsRecovered atomic.Int64
+
+// PanicsRecoveredCount returns how many panics were recovered since startup.
+func PanicsRecoveredCount() int64 {
+	return panicsRecovered.Load()
+}
+
+// WithPanicReporter passes every recovered panic and its stack trace to r.
+func WithPanicReporter(r PanicReporter) RecoveryOption {
+	return func(cfg *recoveryConfig) { cfg.reporter = r }
+}
+
+// WithPanicObserver calls fn for every recovered panic, e.g. to count them
+// in Prometheus.
+func WithPanicObserver(fn func()) RecoveryOption {
+	return func(cfg *recoveryConfig) { cfg.onPanic = fn }
+}
+
+// WithStackTraceInResponse adds the redacted stack trace to the 500
+// response as error.stack_trace. Only enable it with debug logging; the
+// stack reveals the router's internals to clients.
+func WithStackTraceInResponse(enabled bool) RecoveryOption {
+	return func(cfg *recoveryConfig) { cfg.stackInReply = enabled }
+}
+
 // RecoveryMiddleware recovers from panics and returns OpenAI-compatible errors.
-func RecoveryMiddleware(logger *slog.Logger) gin.HandlerFunc {
+// The panic is logged with its redacted stack trace; a nil logger logs to
+// slog.Default.
+func RecoveryMiddleware(logger *slog.Logger, opts ...RecoveryOption) gin.HandlerFunc {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	var cfg recoveryConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
+				stack := debug.Stack()
+				trace := security.Redact(string(stack))
+				panicsRecovered.Add(1)
+				if cfg.onPanic != nil {
+					cfg.onPanic()
+				}
 				logger.Error("panic recovered",
 					slog.Any("error", err),
 					slog.String("path", c.Request.URL.Path),
+					slog.String("stack_trace", trace),
 				)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-					"error": gin.H{
-						"message": "internal server error",
-						"type":    "server_error",
-						"code":    "internal_error",
-					},
-				})
+				if cfg.reporter != nil {
+					cfg.reporter.Report(err, stack)
+				}
+
+				body := gin.H{
+					"message": "internal server error",
+					"type":    "server_error",
+					"code":    "internal_error",
+				}
+				if cfg.stackInReply {
+					body["stack_trace"] = trace
+				}
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": body})
 			}
 		}()
 		c.Next()
 	}
 }
 
+// authScopeKey is the gin context key holding a hash of the client's
+// Authorization header, kept by StripAuthHeadersMiddleware.
+const authScopeKey = "auth_scope"
+
 // StripAuthHeadersMiddleware removes client auth headers; we inject our own keys.
 // SECURITY: This prevents clients from injecting fake Authorization headers.
+// A hash of the removed Authorization header stays available to authScope.
 func StripAuthHeadersMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Strip Authorization header - we use our own keys
 		if auth := c.GetHeader("Authorization"); auth != "" {
 			c.Set("original_auth", "***STRIPPED***")
+			c.Set(authScopeKey, HashRequest([]byte(auth)))
 			c.Request.Header.Del("Authorization") // CRITICAL: Actually remove the header
 		}
 
@@ -105,13 +408,116 @@ func StripAuthHeadersMiddleware() gin.HandlerFunc {
 	}
 }
 
+// authScope returns a hash of the client's Authorization header, whether
+// or not StripAuthHeadersMiddleware already removed it, or "" without one.
+func authScope(c *gin.Context) string {
+	if scope := c.GetString(authScopeKey); scope != "" {
+		return scope
+	}
+	if auth := c.GetHeader("Authorization"); auth != "" {
+		return HashRequest([]byte(auth))
+	}
+	return ""
+}
 
-func maskKey(key string) string {
-	if key == "" {
-		return ""
+// MethodNotAllowedHandler answers with an OpenAI-compatible 405 error and an
+// Allow header naming the supported methods.
+func MethodNotAllowedHandler(allowed ...string) gin.HandlerFunc {
+	allow := strings.Join(allowed, ", ")
+	return func(c *gin.Context) {
+		c.Header("Allow", allow)
+		c.AbortWithStatusJSON(http.StatusMethodNotAllowed, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: fmt.Sprintf("method %s not allowed, use %s", c.Request.Method, allow),
+				Type:    "invalid_request_error",
+			},
+		})
 	}
-	if len(key) <= 12 {
-		return "***"
+}
+
+// NotFoundHandler answers requests for unknown routes with an
+// OpenAI-compatible 404 error instead of Gin's plain text.
+func NotFoundHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusNotFound, adapter.OpenAIError{
+			Error: adapter.OpenAIErrorDetail{
+				Message: fmt.Sprintf("unknown route %s %s", c.Request.Method, c.Request.URL.Path),
+				Type:    "invalid_request_error",
+			},
+		})
+	}
+}
+
+// modelSuffixes are stripped from model names before alias lookup.
+var modelSuffixes = []string{"-preview", "-latest"}
+
+// NormalizeModelName lowercases a model name, strips a trailing -preview or
+// -latest, and maps the result through aliases. Alias keys must already be normalized.
+func NormalizeModelName(model string, aliases map[string]string) string {
+	m := strings.ToLower(strings.TrimSpace(model))
+	for _, suffix := range modelSuffixes {
+		m = strings.TrimSuffix(m, suffix)
+	}
+	if to, ok := aliases[m]; ok {
+		return to
+	}
+	return m
+}
+
+// ModelNormalizationMiddleware rewrites the "model" field of JSON request bodies
+// to its normalized name (see NormalizeModelName) before handlers see it. Only
+// that field is touched; bodies without a string model pass through unchanged.
+// Each rewrite is logged to logger at debug level.
+func ModelNormalizationMiddleware(aliases map[string]string, logger *slog.Logger) gin.HandlerFunc {
+	table := make(map[string]string, len(aliases))
+	for from, to := range aliases {
+		table[NormalizeModelName(from, nil)] = to
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Next()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			c.Next()
+			return
+		}
+		var model string
+		if err := json.Unmarshal(fields["model"], &model); err != nil {
+			c.Next()
+			return
+		}
+
+		normalized := NormalizeModelName(model, table)
+		if normalized == model {
+			c.Next()
+			return
+		}
+
+		fields["model"], _ = json.Marshal(normalized)
+		rewritten, err := json.Marshal(fields)
+		if err != nil {
+			c.Next()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(rewritten))
+		c.Request.ContentLength = int64(len(rewritten))
+
+		requestLogger(c, logger).Debug("model normalized",
+			slog.String("from", model),
+			slog.String("to", normalized),
+			slog.String("path", c.Request.URL.Path),
+		)
+		c.Next()
 	}
-	return key[:8] + "..." + key[len(key)-4:]
 }
@@ -0,0 +1,528 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+func TestNormalizeModelName(t *testing.T) {
+	aliases := map[string]string{"gpt4": "gpt-4"}
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt4", "gpt-4"},
+		{"GPT4", "gpt-4"},
+		{"GPT-4", "gpt-4"},
+		{"gpt-4", "gpt-4"},
+		{"gpt4-latest", "gpt-4"},
+		{"gemini-1.5-pro-preview", "gemini-1.5-pro"},
+		{" Gemini-1.5-Flash-Latest ", "gemini-1.5-flash"},
+		{"claude-3-opus", "claude-3-opus"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := NormalizeModelName(tt.model, aliases); got != tt.want {
+				t.Errorf("NormalizeModelName(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+// serveNormalized runs body through ModelNormalizationMiddleware and returns
+// the body the handler received.
+func serveNormalized(t *testing.T, aliases map[string]string, body string) []byte {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var got []byte
+	r := gin.New()
+	r.Use(ModelNormalizationMiddleware(aliases, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		got, _ = io.ReadAll(c.Request.Body)
+		if c.Request.ContentLength != int64(len(got)) {
+			t.Errorf("ContentLength = %d, want %d", c.Request.ContentLength, len(got))
+		}
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return got
+}
+
+func TestModelNormalizationMiddleware(t *testing.T) {
+	// Alias keys are normalized too, so rules may be written in any case.
+	aliases := map[string]string{"GPT4": "gpt-4"}
+
+	for _, model := range []string{"gpt4", "GPT-4", "gpt4-preview"} {
+		t.Run(model, func(t *testing.T) {
+			body := `{"model":"` + model + `","messages":[{"role":"user","content":"gpt4 stays as is"}],"temperature":0.5}`
+			got := serveNormalized(t, aliases, body)
+
+			var req struct {
+				Model    string `json:"model"`
+				Messages []struct {
+					Content string `json:"content"`
+				} `json:"messages"`
+				Temperature float64 `json:"temperature"`
+			}
+			if err := json.Unmarshal(got, &req); err != nil {
+				t.Fatalf("handler received invalid JSON %s: %v", got, err)
+			}
+			if req.Model != "gpt-4" {
+				t.Errorf("model = %q, want gpt-4", req.Model)
+			}
+			if req.Messages[0].Content != "gpt4 stays as is" {
+				t.Errorf("message content = %q, want it untouched", req.Messages[0].Content)
+			}
+			if req.Temperature != 0.5 {
+				t.Errorf("temperature = %v, want 0.5", req.Temperature)
+			}
+		})
+	}
+}
+
+func TestModelNormalizationMiddleware_Logger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	r := gin.New()
+	r.Use(ModelNormalizationMiddleware(map[string]string{"gpt4": "gpt-4"}, logger))
+	r.POST("/v1/chat/completions", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt4"}`))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(logs.String(), `msg="model normalized" from=gpt4 to=gpt-4`) {
+		t.Errorf("logs = %q, want the rewrite logged to the given logger", logs.String())
+	}
+}
+
+func TestModelNormalizationMiddleware_PassThrough(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"already normalized", `{"model":"gpt-4","messages":[]}`},
+		{"no model", `{"messages":[]}`},
+		{"non-string model", `{"model":4}`},
+		{"not JSON", `model=gpt4`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveNormalized(t, map[string]string{"gpt4": "gpt-4"}, tt.body); string(got) != tt.body {
+				t.Errorf("body = %s, want unchanged %s", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddleware_SlowRequest(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	defer provider.Close()
+
+	km := domain.NewMockKeyManager(testProxyKey)
+	h := NewProxyHandler(km, nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(provider.URL)),
+	)
+
+	var logs bytes.Buffer
+	var observed []string
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil)),
+		WithSlowRequestThreshold(100*time.Millisecond),
+		WithSlowRequestObserver(func(model string) { observed = append(observed, model) }),
+	))
+	r.POST("/v1/chat/completions", h.HandleChatCompletion)
+
+	before := SlowRequestCount()
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body = %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var warning map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %v: %s", err, line)
+		}
+		if entry["msg"] == "slow request" {
+			warning = entry
+		}
+	}
+	if warning == nil {
+		t.Fatalf("no slow request warning logged:\n%s", logs.String())
+	}
+	if warning["level"] != "WARN" {
+		t.Errorf("level = %v, want WARN", warning["level"])
+	}
+	want := map[string]any{
+		"path":          "/v1/chat/completions",
+		"model":         "gpt-4",
+		"key_masked":    security.MaskKey(testProxyKey),
+		"attempt_count": float64(1),
+	}
+	for k, v := range want {
+		if warning[k] != v {
+			t.Errorf("%s = %v, want %v", k, warning[k], v)
+		}
+	}
+	if latency, _ := warning["latency"].(float64); time.Duration(latency) < 500*time.Millisecond {
+		t.Errorf("latency = %v, want at least 500ms", time.Duration(latency))
+	}
+	if got := SlowRequestCount() - before; got != 1 {
+		t.Errorf("SlowRequestCount() grew by %d, want 1", got)
+	}
+	if len(observed) != 1 || observed[0] != "gpt-4" {
+		t.Errorf("observed models = %v, want [gpt-4]", observed)
+	}
+}
+
+func TestLoggingMiddleware_FastRequestNotLogged(t *testing.T) {
+	var logs bytes.Buffer
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil)), WithSlowRequestThreshold(time.Second)))
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	if strings.Contains(logs.String(), "slow request") {
+		t.Errorf("fast request logged as slow:\n%s", logs.String())
+	}
+}
+
+// panicRecorder is a PanicReporter that keeps the last report.
+type panicRecorder struct {
+	err   any
+	stack []byte
+}
+
+func (p *panicRecorder) Report(err any, stack []byte) {
+	p.err, p.stack = err, stack
+}
+
+func TestRecoveryMiddleware_StackTrace(t *testing.T) {
+	tests := []struct {
+		name         string
+		stackInReply bool
+	}{
+		{"release mode", false},
+		{"debug mode", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			var reporter panicRecorder
+			observed := 0
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(RecoveryMiddleware(slog.New(slog.NewJSONHandler(&logs, nil)),
+				WithPanicReporter(&reporter),
+				WithPanicObserver(func() { observed++ }),
+				WithStackTraceInResponse(tt.stackInReply),
+			))
+			r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+			before := PanicsRecoveredCount()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+			}
+
+			var entry map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log line is not JSON: %v: %s", err, logs.String())
+			}
+			trace, _ := entry["stack_trace"].(string)
+			if !strings.Contains(trace, "goroutine") || !strings.Contains(trace, "middleware_test.go") {
+				t.Errorf("stack_trace = %q, want the panicking goroutine's stack", trace)
+			}
+
+			var resp struct {
+				Error map[string]any `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response is not JSON: %v: %s", err, w.Body.String())
+			}
+			if resp.Error["code"] != "internal_error" {
+				t.Errorf("error.code = %v, want internal_error", resp.Error["code"])
+			}
+			_, hasStack := resp.Error["stack_trace"]
+			if hasStack != tt.stackInReply {
+				t.Errorf("response has stack_trace = %v, want %v", hasStack, tt.stackInReply)
+			}
+
+			if reporter.err != "boom" || len(reporter.stack) == 0 {
+				t.Errorf("reported (%v, %d byte stack), want (boom, stack)", reporter.err, len(reporter.stack))
+			}
+			if observed != 1 {
+				t.Errorf("observer called %d times, want 1", observed)
+			}
+			if got := PanicsRecoveredCount() - before; got != 1 {
+				t.Errorf("PanicsRecoveredCount() grew by %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddleware_DebugSampling(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LoggingMiddleware(logger, WithDebugSampleRate(0.1)))
+	r.GET("/work", func(c *gin.Context) {
+		requestLogger(c, logger).Debug("working")
+		c.Status(http.StatusOK)
+	})
+
+	const requests = 1000
+	for i := 0; i < requests; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/work", nil))
+	}
+
+	var debug, completed, sampledCompleted int
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %v: %s", err, line)
+		}
+		switch entry["msg"] {
+		case "working":
+			debug++
+			if entry[debugSampledKey] != true {
+				t.Errorf("debug entry without debug_sampled=true: %s", line)
+			}
+		case "request completed":
+			completed++
+			if entry[debugSampledKey] == true {
+				sampledCompleted++
+			}
+		}
+	}
+
+	if completed != requests {
+		t.Errorf("completion logs = %d, want %d", completed, requests)
+	}
+	if debug < requests*5/100 || debug > requests*15/100 {
+		t.Errorf("debug logs = %d of %d requests, want between 5%% and 15%%", debug, requests)
+	}
+	if sampledCompleted != debug {
+		t.Errorf("sampled completion logs = %d, want %d to match the debug logs", sampledCompleted, debug)
+	}
+}
+
+func TestLoggingMiddleware_DebugSamplingDisabled(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LoggingMiddleware(logger))
+	r.GET("/work", func(c *gin.Context) {
+		requestLogger(c, logger).Debug("working")
+		c.Status(http.StatusOK)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/work", nil))
+
+	if !strings.Contains(logs.String(), `"msg":"working"`) {
+		t.Errorf("debug entry dropped without sampling:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), debugSampledKey) {
+		t.Errorf("debug_sampled added without sampling:\n%s", logs.String())
+	}
+}
+
+func TestLoggingMiddleware_BodyHashing(t *testing.T) {
+	var logs bytes.Buffer
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil)), WithBodyHashing(true)))
+	var received []string
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		b, _ := io.ReadAll(c.Request.Body)
+		received = append(received, string(b))
+		c.Status(http.StatusOK)
+	})
+
+	bodies := []string{
+		`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`,
+		`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`,
+		`{"model":"gpt-4","messages":[{"role":"user","content":"bye"}]}`,
+	}
+	var headers []string
+	for _, body := range bodies {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		headers = append(headers, w.Header().Get(RequestHashHeader))
+	}
+
+	var hashes []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %v: %s", err, line)
+		}
+		hash, _ := entry["request_body_hash"].(string)
+		hashes = append(hashes, hash)
+	}
+	if len(hashes) != len(bodies) {
+		t.Fatalf("got %d log entries, want %d", len(hashes), len(bodies))
+	}
+
+	if want := HashRequest([]byte(bodies[0]))[:12]; hashes[0] != want {
+		t.Errorf("request_body_hash = %q, want %q", hashes[0], want)
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("duplicate requests logged hashes %q and %q, want equal", hashes[0], hashes[1])
+	}
+	if hashes[0] == hashes[2] {
+		t.Errorf("different requests both logged hash %q", hashes[0])
+	}
+	for i := range bodies {
+		if headers[i] != hashes[i] {
+			t.Errorf("request %d %s = %q, want the logged %q", i, RequestHashHeader, headers[i], hashes[i])
+		}
+		if received[i] != bodies[i] {
+			t.Errorf("handler read body %q, want %q", received[i], bodies[i])
+		}
+	}
+	if strings.Contains(logs.String(), "hello") {
+		t.Errorf("request body logged:\n%s", logs.String())
+	}
+}
+
+func TestLoggingMiddleware_BodyHashingDisabled(t *testing.T) {
+	var logs bytes.Buffer
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil))))
+	r.POST("/v1/chat/completions", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+	if got := w.Header().Get(RequestHashHeader); got != "" {
+		t.Errorf("%s = %q, want none", RequestHashHeader, got)
+	}
+	if strings.Contains(logs.String(), "request_body_hash") {
+		t.Errorf("request_body_hash logged without body hashing:\n%s", logs.String())
+	}
+}
+
+func TestLoggingMiddleware_RequestBodyRedaction(t *testing.T) {
+	var logs bytes.Buffer
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil)),
+		WithBodyHashing(true),
+		WithRequestBodyRedaction(true),
+	))
+	r.POST("/v1/chat/completions", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"secret prompt"}]}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+	if got := w.Header().Get(RequestHashHeader); got != "" {
+		t.Errorf("%s = %q, want none with redaction", RequestHashHeader, got)
+	}
+	hash := HashRequest([]byte(body))
+	if out := logs.String(); strings.Contains(out, "secret prompt") || strings.Contains(out, hash[:requestHashLen]) || strings.Contains(out, "request_body_hash") {
+		t.Errorf("body-derived data logged with redaction:\n%s", out)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v: %s", err, logs.String())
+	}
+	if entry["msg"] != "request completed" || entry["path"] != "/v1/chat/completions" || entry["status"] != float64(http.StatusOK) {
+		t.Errorf("entry = %v, want the request completed fields kept", entry)
+	}
+}
+
+func TestLoggingMiddleware_RequestLogFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]bool
+		want   []string
+	}{
+		{"status only", map[string]bool{"status": true}, []string{"status"}},
+		{"model and tokens", map[string]bool{"model": true, "tokens": true}, []string{"model", "tokens"}},
+		{"none", map[string]bool{}, nil},
+		{"all by default", nil, []string{
+			"method", "path", "query", "status", "latency", "client_ip", "user_id",
+			"key_used", "attempts", "user_agent", "request_id", "model", "tokens",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(RequestIDMiddleware())
+			r.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil)), WithRequestLogFields(tt.fields)))
+			r.POST("/v1/chat/completions", func(c *gin.Context) {
+				c.Set("model", "gpt-4")
+				c.Set("key_used", "AIzaSyTestKey1234567890")
+				c.Set("attempts", 1)
+				c.Set("cost_metrics", CostMetrics{InputTokens: 10, OutputTokens: 5})
+				c.Status(http.StatusOK)
+			})
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+
+			var entry map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log line is not JSON: %v: %s", err, logs.String())
+			}
+			for _, k := range []string{"time", "level", "msg"} {
+				if _, ok := entry[k]; !ok {
+					t.Errorf("entry = %v, want %s", entry, k)
+				}
+				delete(entry, k)
+			}
+			got := slices.Sorted(maps.Keys(entry))
+			want := slices.Sorted(slices.Values(tt.want))
+			if !slices.Equal(got, want) {
+				t.Errorf("fields = %v, want %v", got, want)
+			}
+			if tt.fields["tokens"] && entry["tokens"] != float64(15) {
+				t.Errorf("tokens = %v, want 15", entry["tokens"])
+			}
+		})
+	}
+}
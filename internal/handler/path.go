@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// CanonicalPathHandler serves requests with next after rewriting their path
+// to its canonical form: percent-encoded characters decoded, repeated
+// slashes collapsed and dot segments resolved, so //v1//chat/completions
+// reaches /v1/chat/completions. A trailing slash is kept for the router to
+// redirect. The case of the path is kept; routes are case-sensitive.
+func CanonicalPathHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := canonicalPath(r.URL.Path)
+		if p == r.URL.Path && r.URL.RawPath == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// canonicalPath cleans the decoded path p, keeping its trailing slash.
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
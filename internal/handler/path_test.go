@@ -0,0 +1,27 @@
+package handler
+
+import "testing"
+
+func TestCanonicalPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"//", "/"},
+		{"/v1/chat/completions", "/v1/chat/completions"},
+		{"//v1//chat///completions", "/v1/chat/completions"},
+		{"/v1/chat/completions/", "/v1/chat/completions/"},
+		{"//v1//chat/completions//", "/v1/chat/completions/"},
+		{"/v1/models/../chat/./completions", "/v1/chat/completions"},
+		{"/../v1/models", "/v1/models"},
+		{"v1/models", "/v1/models"},
+		{"/V1/Chat/Completions", "/V1/Chat/Completions"},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalPath(tt.in); got != tt.want {
+			t.Errorf("canonicalPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
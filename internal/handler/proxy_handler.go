@@ -1,27 +1,112 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/hpn/hpn-g-router/internal/adapter"
 	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/security"
 	"github.com/hpn/hpn-g-router/internal/ui"
 )
 
 const DefaultMaxRetries = 3
 
+// Response headers describing how a request was served, sent when
+// WithExposeAttemptHeader is enabled.
+const (
+	// HeaderKeyAttemptCount is the number of keys tried for the request.
+	HeaderKeyAttemptCount = "X-Key-Attempt-Count"
+
+	// HeaderProvider is the adapter of the last key tried, such as gemini.
+	// Successful chat completions always carry it.
+	HeaderProvider = "X-Provider"
+
+	// HeaderProviderAttempts lists the adapters of every key tried, in
+	// order, such as gemini,openai after a failover.
+	HeaderProviderAttempts = "X-Provider-Attempts"
+)
+
+// providerAttemptsKey is the gin context key holding the names of the
+// adapters withKeyRotation tried, in order.
+const providerAttemptsKey = "provider_attempts"
+
+// keysTriedKey is the gin context key holding the number of distinct keys
+// withKeyRotation tried.
+const keysTriedKey = "keys_tried"
+
+// HeaderActualModel is the provider model a chat completion was served by,
+// such as gemini-1.5-pro for a request for gpt-4, whose body echoes the
+// requested model.
+const HeaderActualModel = "X-Actual-Model"
+
+// forwardedUserKey is the context key of the sanitized user field forwarded
+// to the provider, for the request log.
+const forwardedUserKey = "forwarded_user"
+
+// UserTagHeader carries the caller's tag, such as "premium", for the
+// user_tag condition of routing rules.
+const UserTagHeader = "X-User-Tag"
+
 // ProxyHandler proxies OpenAI-compatible requests with automatic key rotation.
 type ProxyHandler struct {
-	km         *domain.KeyManager
-	adapter    adapter.AIProvider
-	logger     *slog.Logger
-	maxRetries int
+	km                domain.KeyManagerInterface
+	adapter           adapter.AIProvider
+	logger            *slog.Logger
+	maxRetries        int
+	endpointRetries   map[string]int
+	retryStatus       []int
+	noRetryStatus     []int
+	validateResponses bool
+	exposeAttempts    bool
+	forwardUser       bool
+	errorDetails      bool
+	retryOnEmpty      bool
+	estimateTokens    func(string) int
+	costBuffer        int
+	costs             *CostWorker
+	contextLimits     map[string]int
+	adapterOpts       []adapter.GeminiAdapterOption
+	newAdapter        func(key string) adapter.AIProvider
+	wrapAdapter       func(key string, p adapter.AIProvider) adapter.AIProvider
+	adapterCacheSize  int
+	adapterCaches     sync.Map // key -> *adapter.ResponseCache
+
+	maxBatchConcurrency int
+	maxCandidates       int
+	safetyAllowlist     *security.IPAllowlist
+	routeProvider       ProviderRouter
+	rules               *domain.RoutingRuleEngine
+	balancer            *domain.ProviderBalancer
+	latency             *domain.LatencyTracker
+	latencySelection    bool
+	regionSelection     bool
+	queue               *RequestQueue
+	quota               *domain.QuotaTracker
+	tokenRate           *domain.TokenRateLimiter
+	providerRate        *domain.ProviderRateLimiter
+	onProviderError     func(errorClass string)
+	stream              *MetricsStream
+	modelCache          *FlashCache
+	build               BuildInfo
 }
 
+// ProviderRouter picks the provider whose keys should serve model. An empty
+// result falls back to the mixed rotation over all keys.
+type ProviderRouter func(model string) domain.ProviderType
+
 // ProxyHandlerOption configures a ProxyHandler.
 type ProxyHandlerOption func(*ProxyHandler)
 
@@ -34,27 +119,275 @@ func WithMaxRetries(n int) ProxyHandlerOption {
 	}
 }
 
+// WithEndpointRetries overrides the retry count for the routes in m, keyed by
+// route path such as "/v1/embeddings". Other routes use WithMaxRetries.
+func WithEndpointRetries(m map[string]int) ProxyHandlerOption {
+	return func(h *ProxyHandler) {
+		h.endpointRetries = make(map[string]int, len(m))
+		for path, n := range m {
+			if n > 0 {
+				h.endpointRetries[path] = n
+			}
+		}
+	}
+}
+
+// WithRetryableStatusCodes rotates to another key when the provider answers
+// with one of codes, in addition to the statuses retried by default.
+func WithRetryableStatusCodes(codes []int) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.retryStatus = slices.Clone(codes) }
+}
+
+// WithNonRetryableStatusCodes returns provider answers with one of codes to
+// the client without trying another key. It overrides both the default
+// statuses and WithRetryableStatusCodes.
+func WithNonRetryableStatusCodes(codes []int) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.noRetryStatus = slices.Clone(codes) }
+}
+
+// WithProviderErrorObserver calls fn with the ErrorClass category of every
+// failed provider call, e.g. to count them in Prometheus.
+func WithProviderErrorObserver(fn func(errorClass string)) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.onProviderError = fn }
+}
+
 // WithLogger sets the logger.
 func WithLogger(l *slog.Logger) ProxyHandlerOption {
 	return func(h *ProxyHandler) { h.logger = l }
 }
 
-// NewProxyHandler creates a configured ProxyHandler.
-func NewProxyHandler(km *domain.KeyManager, ai adapter.AIProvider, opts ...ProxyHandlerOption) *ProxyHandler {
+// WithResponseValidation enables structural validation of provider responses.
+// Invalid responses are not retried and are reported to the client as 502.
+func WithResponseValidation(enabled bool) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.validateResponses = enabled }
+}
+
+// WithExposeAttemptHeader sends the X-Key-Attempt-Count, X-Provider and
+// X-Provider-Attempts headers on chat completion and embedding responses,
+// failed ones included, so clients can see when a request failed over to
+// another key.
+func WithExposeAttemptHeader(enabled bool) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.exposeAttempts = enabled }
+}
+
+// WithAsyncCostEstimation estimates the tokens and cost of requests without
+// provider usage data on a background goroutine, queueing up to bufferSize
+// requests, instead of before the response is sent. Such requests then have
+// no per-request cost in the request log or per-user usage. When the queue
+// is full the request is estimated synchronously and counted in
+// CostEstimationDroppedCount. Zero, the default, estimates synchronously.
+// Close drains the queue.
+func WithAsyncCostEstimation(bufferSize int) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.costBuffer = bufferSize }
+}
+
+// WithErrorDetails adds the details extension to errors from failed
+// provider calls: the attempts made, the keys tried and the category of the
+// last error. It is meant for debugging; otherwise details is null.
+func WithErrorDetails(enabled bool) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.errorDetails = enabled }
+}
+
+// WithRetryOnEmptyResponse retries chat completions answered with no
+// choices on the next key, without marking the key dead, instead of
+// returning the empty response.
+func WithRetryOnEmptyResponse(enabled bool) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.retryOnEmpty = enabled }
+}
+
+// WithForwardUser sends the user field of chat completions to Gemini in the
+// X-HPN-User-ID header, sanitized, and logs it with the request. Off, the
+// field is dropped for privacy.
+func WithForwardUser(enabled bool) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.forwardUser = enabled }
+}
+
+// WithAccurateTokenEstimation estimates the tokens of responses without
+// usage data with EstimateTokensAccurate instead of EstimateTokens.
+func WithAccurateTokenEstimation(enabled bool) ProxyHandlerOption {
+	return func(h *ProxyHandler) {
+		if enabled {
+			h.estimateTokens = EstimateTokensAccurate
+		} else {
+			h.estimateTokens = EstimateTokens
+		}
+	}
+}
+
+// WithContextLimitMap sets the context window of each model, in tokens.
+// Chat completions whose estimated prompt exceeds 90% of their model's
+// window are rejected with 400; models not in m are not checked.
+func WithContextLimitMap(m map[string]int) ProxyHandlerOption {
+	return func(h *ProxyHandler) {
+		h.contextLimits = make(map[string]int, len(m))
+		for model, n := range m {
+			if n > 0 {
+				h.contextLimits[strings.ToLower(model)] = n
+			}
+		}
+	}
+}
+
+// WithAdapterOptions sets options applied to every per-request GeminiAdapter.
+func WithAdapterOptions(opts ...adapter.GeminiAdapterOption) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.adapterOpts = append(h.adapterOpts, opts...) }
+}
+
+// WithBaseURL points every per-request GeminiAdapter at url instead of the
+// Gemini API, e.g. a Gemini-compatible endpoint or a test server. Keys with
+// a regional base URL keep using it.
+func WithBaseURL(url string) ProxyHandlerOption {
+	return WithAdapterOptions(adapter.WithBaseURL(url))
+}
+
+// WithAdapterFactory creates the adapter for each attempt with factory
+// instead of a GeminiAdapter, ignoring the adapter options. Embeddings
+// requests fail unless the adapter also creates embeddings.
+func WithAdapterFactory(factory func(key string) adapter.AIProvider) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.newAdapter = factory }
+}
+
+// WithAdapterWrapper passes the adapter of each attempt through wrap, such
+// as to inject failures with adapter.ChaosAdapter.
+func WithAdapterWrapper(wrap func(key string, p adapter.AIProvider) adapter.AIProvider) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.wrapAdapter = wrap }
+}
+
+// WithAdapterCacheSize keeps up to maxEntries chat completion responses per
+// key across requests, so a repeated request is sent with the generation_id
+// Gemini returned and a 304 answer is served from the cache. Zero disables
+// it.
+func WithAdapterCacheSize(maxEntries int) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.adapterCacheSize = maxEntries }
+}
+
+// WithModelCache keeps the model lists HandleModels fetches from the
+// provider in cache for ModelListTTL. Without it every request lists them.
+func WithModelCache(cache *FlashCache) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.modelCache = cache }
+}
+
+// WithProviderRouter draws keys from the partition of the provider chosen by r
+// instead of from the mixed rotation.
+func WithProviderRouter(r ProviderRouter) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.routeProvider = r }
+}
+
+// WithRoutingRules serves requests matching one of e's rules from the keys
+// tagged for its target. Unmatched requests are served as before.
+func WithRoutingRules(e *domain.RoutingRuleEngine) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.rules = e }
+}
+
+// WithProviderBalancer draws keys from the partition of a provider picked by
+// b in proportion to its weight, for models the provider router leaves
+// unrouted.
+func WithProviderBalancer(b *domain.ProviderBalancer) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.balancer = b }
+}
+
+// WithMetricsStream reports the subscribers of s in the health response.
+func WithMetricsStream(s *MetricsStream) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.stream = s }
+}
+
+// WithMaxCandidates sets the largest n a chat completion may request, up to
+// adapter.MaxGeminiCandidates.
+func WithMaxCandidates(n int) ProxyHandlerOption {
+	return func(h *ProxyHandler) {
+		if n > 0 && n <= adapter.MaxGeminiCandidates {
+			h.maxCandidates = n
+		}
+	}
+}
+
+// WithBuildInfo sets the version reported by the health endpoint.
+func WithBuildInfo(b BuildInfo) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.build = b }
+}
+
+// WithLatencyTracker records per-key latency into t, so it can be shared with
+// the admin API.
+func WithLatencyTracker(t *domain.LatencyTracker) ProxyHandlerOption {
+	return func(h *ProxyHandler) {
+		if t != nil {
+			h.latency = t
+		}
+	}
+}
+
+// WithLatencyBasedSelection picks the active key with the lowest latency EWMA
+// instead of the next key in rotation.
+func WithLatencyBasedSelection() ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.latencySelection = true }
+}
+
+// WithRegionLatencySelection picks keys from the region with the lowest
+// probed latency, see KeyManager.GetNextKeyByLowestRegionLatency.
+func WithRegionLatencySelection() ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.regionSelection = true }
+}
+
+// WithRequestQueue queues requests that find every key at its concurrency
+// limit instead of rejecting them straight away.
+func WithRequestQueue(q *RequestQueue) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.queue = q }
+}
+
+// WithQuotaTracker records the tokens of every successful request against
+// the key that served it. Pass the tracker given to the KeyManager so keys
+// over quota are skipped.
+func WithQuotaTracker(q *domain.QuotaTracker) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.quota = q }
+}
+
+// WithTokenRateLimiter records the tokens of every successful request in l's
+// per-minute window for the key that served it. Pass the limiter given to the
+// KeyManager so keys over their rate are skipped.
+func WithTokenRateLimiter(l *domain.TokenRateLimiter) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.tokenRate = l }
+}
+
+// WithProviderRateLimiter waits for the provider's requests-per-minute limit
+// in l before every call to a key of that provider.
+func WithProviderRateLimiter(l *domain.ProviderRateLimiter) ProxyHandlerOption {
+	return func(h *ProxyHandler) { h.providerRate = l }
+}
+
+// NewProxyHandler creates a configured ProxyHandler. km is usually a
+// *domain.KeyManager; tests can pass a *domain.MockKeyManager.
+func NewProxyHandler(km domain.KeyManagerInterface, ai adapter.AIProvider, opts ...ProxyHandlerOption) *ProxyHandler {
 	h := &ProxyHandler{
 		km:         km,
 		adapter:    ai,
 		logger:     slog.Default(),
 		maxRetries: DefaultMaxRetries,
+
+		estimateTokens:      EstimateTokens,
+		maxBatchConcurrency: DefaultMaxBatchConcurrency,
+		maxCandidates:       adapter.MaxGeminiCandidates,
+		latency:             domain.NewLatencyTracker(domain.DefaultLatencyAlpha),
 	}
 	for _, opt := range opts {
 		opt(h)
 	}
+	if h.costBuffer > 0 {
+		h.costs = newCostWorker(h.costBuffer, h.estimateTokens, h.logger)
+	}
 	return h
 }
 
+// Close waits for the cost jobs queued with async cost estimation to be
+// accounted. Call it once the server stopped serving requests.
+func (h *ProxyHandler) Close() {
+	if h.costs != nil {
+		h.costs.Close()
+	}
+}
+
 // HandleChatCompletion proxies /v1/chat/completions with retry logic.
 func (h *ProxyHandler) HandleChatCompletion(c *gin.Context) {
+	start := time.Now()
 	var req adapter.OpenAIRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.sendError(c, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
@@ -66,68 +399,400 @@ func (h *ProxyHandler) HandleChatCompletion(c *gin.Context) {
 		return
 	}
 
-	var input strings.Builder
-	for _, m := range req.Messages {
-		input.WriteString(m.Content)
-		input.WriteString(" ")
+	if msg := h.checkCandidateCount(req.N); msg != "" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
+
+	if err := adapter.ValidateContentParts(req.Messages); err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	if req.Logprobs {
+		h.sendError(c, http.StatusNotImplemented, "invalid_request_error", errLogprobs.Error())
+		return
+	}
+
+	if msg := h.checkContextLength(req); msg != "" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
+
+	if !h.applyGeminiOverrides(c) {
+		return
+	}
+
+	if user := adapter.SanitizeUserID(req.User); h.forwardUser && user != "" {
+		c.Set(forwardedUserKey, user)
 	}
 
+	c.Set(streamingRequestedKey, req.Stream)
+
 	resp, attempts, err := h.executeWithRetry(c, req)
+	h.setAttemptHeaders(c, attempts)
+	if abortOnDisconnect(c, err) {
+		return
+	}
 	if err != nil {
-		h.logger.Error("retries exhausted",
+		logMsg := "retries exhausted"
+		if errors.Is(err, adapter.ErrInvalidResponse) {
+			logMsg = "invalid provider response"
+		}
+		h.logger.Error(logMsg,
 			slog.String("error", err.Error()),
+			slog.String("error_category", ClassifyError(err).Category),
 			slog.Int("attempts", attempts),
 		)
-		h.sendError(c, http.StatusServiceUnavailable, "server_error", "service temporarily unavailable")
+		h.sendUpstreamError(c, err, attempts)
 		return
 	}
 
 	c.Set("attempts", attempts)
+	if tried := c.GetStringSlice(providerAttemptsKey); len(tried) > 0 {
+		h.setProviderHeaders(c, tried[len(tried)-1], resp.InternalModel)
+	}
 
-	var output string
+	output := choicesText(resp.Choices)
 	if len(resp.Choices) > 0 {
-		output = resp.Choices[0].Message.Content
+		if resp.Choices[0].Blocked {
+			requestLogger(c, h.logger).Warn("response blocked by provider safety filter",
+				slog.String("model", req.Model),
+				slog.Int("attempts", attempts),
+			)
+		}
 	}
 
-	c.Set("cost_metrics", CalculateRequestCost(input.String(), output))
+	h.recordRequestCost(c, req.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens,
+		chatInputText(req.Messages), output)
+	if wantsEventStream(c) {
+		recordFirstToken(c, start)
+		sendEventStream(c, resp)
+		return
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
+// HandleEmbeddings proxies /v1/embeddings with retry logic.
+func (h *ProxyHandler) HandleEmbeddings(c *gin.Context) {
+	var req adapter.OpenAIEmbeddingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+		return
+	}
+
+	if len(req.Input) == 0 {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", "input is required")
+		return
+	}
+
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", "encoding_format must be float")
+		return
+	}
+
+	tokens := 0
+	for _, text := range req.Input {
+		tokens += h.estimateTokens(text)
+	}
+
+	var resp adapter.OpenAIEmbeddingResponse
+	attempts, err := h.withKeyRotation(c, req.Model, func(provider adapter.AIProvider) (int, error) {
+		embedder, ok := provider.(embeddingProvider)
+		if !ok {
+			return 0, fmt.Errorf("%s adapter does not support embeddings", provider.Name())
+		}
+		var err error
+		resp, err = embedder.Embeddings(c.Request.Context(), req)
+		return tokens, err
+	})
+	h.setAttemptHeaders(c, attempts)
+	if abortOnDisconnect(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("retries exhausted",
+			slog.String("error", err.Error()),
+			slog.String("error_category", ClassifyError(err).Category),
+			slog.Int("attempts", attempts),
+		)
+		h.sendUpstreamError(c, err, attempts)
+		return
+	}
+
+	c.Set("attempts", attempts)
+	c.Set("prompt_tokens", tokens)
+
+	resp.Usage = adapter.OpenAIEmbeddingUsage{PromptTokens: tokens, TotalTokens: tokens}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// errLogprobs rejects requests asking for logprobs before a key is used:
+// Gemini does not report per-token log probabilities.
+var errLogprobs = &adapter.LogprobsNotSupportedError{Provider: "Gemini"}
+
+// checkCandidateCount returns why n is not an acceptable number of choices,
+// or "" when it is or is unset.
+func (h *ProxyHandler) checkCandidateCount(n *int) string {
+	if n == nil || (*n >= 1 && *n <= h.maxCandidates) {
+		return ""
+	}
+	return fmt.Sprintf("n must be between 1 and %d", h.maxCandidates)
+}
+
+// contextSafetyMargin is the share of a model's context window a prompt may
+// fill, leaving room for the estimate's error and the completion.
+const contextSafetyMargin = 0.9
+
+// checkContextLength returns an error message when the estimated prompt of
+// req exceeds the safety margin of its model's context window.
+func (h *ProxyHandler) checkContextLength(req adapter.OpenAIRequest) string {
+	limit, ok := h.contextLimits[strings.ToLower(req.Model)]
+	if !ok {
+		return ""
+	}
+	estimated := h.estimateTokens(chatInputText(req.Messages))
+	if float64(estimated) <= float64(limit)*contextSafetyMargin {
+		return ""
+	}
+	return fmt.Sprintf("Context too long: estimated %d tokens exceeds model limit %d", estimated, limit)
+}
+
+// choicesText returns the content of every choice, for token estimates.
+func choicesText(choices []adapter.OpenAIChoice) string {
+	parts := make([]string, len(choices))
+	for i, ch := range choices {
+		parts[i] = ch.Message.Content
+	}
+	return strings.Join(parts, " ")
+}
+
+// executeWithRetry runs a chat completion with key rotation. A response
+// blocked by the provider's safety filter counts as a success and is not
+// retried: another key would get the same verdict.
 func (h *ProxyHandler) executeWithRetry(c *gin.Context, req adapter.OpenAIRequest) (adapter.OpenAIResponse, int, error) {
+	var resp adapter.OpenAIResponse
+	attempts, err := h.withKeyRotation(c, req.Model, func(provider adapter.AIProvider) (int, error) {
+		var err error
+		resp, err = provider.ChatCompletion(c.Request.Context(), req)
+		if err == nil && h.retryOnEmpty && len(resp.Choices) == 0 {
+			err = &adapter.EmptyResponseError{Provider: "Gemini"}
+		}
+		if err == nil && h.validateResponses {
+			err = adapter.ValidateOpenAIResponse(resp)
+		}
+		return resp.Usage.PromptTokens + resp.Usage.CompletionTokens, err
+	})
+	return resp, attempts, err
+}
+
+// setAttemptHeaders sends the attempt count and the adapters of the keys
+// tried, when enabled. Batch items run concurrently on one context, so only
+// the single-request handlers call it.
+func (h *ProxyHandler) setAttemptHeaders(c *gin.Context, attempts int) {
+	if !h.exposeAttempts {
+		return
+	}
+	c.Header(HeaderKeyAttemptCount, strconv.Itoa(attempts))
+	if tried := c.GetStringSlice(providerAttemptsKey); len(tried) > 0 {
+		c.Header(HeaderProvider, tried[len(tried)-1])
+		c.Header(HeaderProviderAttempts, strings.Join(tried, ","))
+	}
+}
+
+// setProviderHeaders tells the client which adapter served a successful
+// chat completion and, when it maps models, the provider model it used.
+func (h *ProxyHandler) setProviderHeaders(c *gin.Context, adapterName, model string) {
+	c.Header(HeaderProvider, adapterName)
+	if model != "" {
+		c.Header(HeaderActualModel, model)
+	}
+}
+
+// retriesFor returns the retry count for the route serving c.
+func (h *ProxyHandler) retriesFor(c *gin.Context) int {
+	if n, ok := h.endpointRetries[c.FullPath()]; ok {
+		return n
+	}
+	return h.maxRetries
+}
+
+// providerTimeouts counts provider calls that timed out and were retried
+// with the next key.
+var providerTimeouts atomic.Int64
+
+// ProviderTimeoutCount returns how many provider calls timed out.
+func ProviderTimeoutCount() int64 {
+	return providerTimeouts.Load()
+}
+
+// clientDisconnects counts requests whose client went away before the
+// response was written.
+var clientDisconnects atomic.Int64
+
+// ClientDisconnectCount returns how many clients disconnected mid-request.
+func ClientDisconnectCount() int64 {
+	return clientDisconnects.Load()
+}
+
+// isClientDisconnect reports whether err comes from a request context
+// cancelled because the client went away. A request that ran out of time
+// fails with context.DeadlineExceeded instead and is not a disconnect.
+func isClientDisconnect(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// StatusClientClosedRequest is the status logged for a request whose client
+// disconnected, after nginx's convention.
+const StatusClientClosedRequest = 499
+
+// abortOnDisconnect counts and aborts a request whose client disconnected,
+// reporting whether it did. No body is written: there is no one to read it.
+func abortOnDisconnect(c *gin.Context, err error) bool {
+	if !isClientDisconnect(err) {
+		return false
+	}
+	clientDisconnects.Add(1)
+	c.AbortWithStatus(StatusClientClosedRequest)
+	return true
+}
+
+// withKeyRotation runs call against successive keys, marking a key dead and
+// rotating on retryable errors, until call succeeds or the route's retry
+// count is reached. A timed out key is skipped but stays in rotation, and
+// a client disconnect ends the rotation without counting against the key.
+// call returns the tokens a successful request used, for quota tracking.
+// Each call first waits for the key's provider rate limit. It returns the
+// number of keys tried.
+func (h *ProxyHandler) withKeyRotation(c *gin.Context, model string, call func(adapter.AIProvider) (int, error)) (int, error) {
 	var lastErr error
-	var used []string
+	var used, providers []string
+	tried := make(map[string]struct{})
+
+	c.Set("model", model)
+	maxRetries := h.retriesFor(c)
+	logger := requestLogger(c, h.logger)
+	logger.Debug("retry budget",
+		slog.String("path", c.FullPath()),
+		slog.Int("max_retries", maxRetries),
+	)
 
-	for attempt := 1; attempt <= h.maxRetries; attempt++ {
-		key, err := h.km.GetNextKey()
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		key, err := h.acquireKey(c, model, tried)
+		if isContextDone(err) {
+			logger.Info("request ended before retry", slog.Int("attempt", attempt), slog.String("error", err.Error()))
+			return attempt - 1, err
+		}
 		if err != nil {
 			h.logger.Warn("no keys available", slog.Int("attempt", attempt), slog.String("error", err.Error()))
-			return adapter.OpenAIResponse{}, attempt, err
+			// Every key answered empty or timed out: report that rather
+			// than the exhausted pool, as the keys are still alive
+			var emptyErr *adapter.EmptyResponseError
+			var timeoutErr *adapter.ProviderTimeoutError
+			if errors.As(lastErr, &emptyErr) || errors.As(lastErr, &timeoutErr) {
+				return attempt - 1, lastErr
+			}
+			return attempt - 1, err
 		}
 
 		used = append(used, key)
+		tried[key] = struct{}{}
 		c.Set("key_used", key)
+		c.Set(keysTriedKey, len(tried))
 
-		h.logger.Debug("trying request",
+		logger.Debug("trying request",
 			slog.Int("attempt", attempt),
-			slog.String("key", maskKey(key)),
-			slog.String("model", req.Model),
+			slog.String("key", security.MaskKey(key)),
+			slog.String("model", model),
 		)
 
-		gemini := adapter.NewGeminiAdapter(key)
-		resp, err := gemini.ChatCompletion(c.Request.Context(), req)
+		if err := h.providerRate.Wait(c.Request.Context(), h.km.KeyProvider(key)); err != nil {
+			h.releaseKey(key)
+			logger.Warn("provider rate limit wait ended", slog.Int("attempt", attempt), slog.String("error", err.Error()))
+			return attempt - 1, err
+		}
+
+		provider := h.adapterFor(key)
+		providers = append(providers, provider.Name())
+		// Clipped so later appends never write to the stored slice.
+		c.Set(providerAttemptsKey, slices.Clip(providers))
+
+		start := time.Now()
+		tokens, err := call(provider)
+		h.latency.RecordLatency(key, time.Since(start))
+		h.releaseKey(key)
 		if err == nil {
-			h.logger.Info("request ok", slog.Int("attempt", attempt), slog.String("model", resp.Model))
-			return resp, attempt, nil
+			h.km.RecordSuccess(key)
+			if h.quota != nil {
+				h.quota.RecordUsage(key, int64(tokens))
+			}
+			if h.tokenRate != nil {
+				h.tokenRate.RecordTokens(key, int64(tokens))
+			}
+			h.logger.Info("request ok", slog.Int("attempt", attempt), slog.String("model", model))
+			return attempt, nil
 		}
 
-		if h.isRetryable(err) {
-			h.logger.Warn("rotating key",
+		if isClientDisconnect(err) {
+			logger.Debug("client disconnected",
 				slog.Int("attempt", attempt),
-				slog.String("key", maskKey(key)),
+				slog.String("key", security.MaskKey(key)),
+			)
+			return attempt, err
+		}
+
+		class := h.classify(err)
+		if h.onProviderError != nil {
+			h.onProviderError(class.Category)
+		}
+		retry := h.km.HandleError(key, classifiedError{error: err, class: class})
+
+		// An empty answer is a provider hiccup, not a fault of the key
+		var emptyErr *adapter.EmptyResponseError
+		if errors.As(err, &emptyErr) {
+			logger.Warn("empty provider response, retrying with next key",
+				slog.Int("attempt", attempt),
+				slog.String("key", security.MaskKey(key)),
+				slog.String("key_name", h.km.KeyName(key)),
+				slog.String("error_category", class.Category),
+			)
+			lastErr = err
+			continue
+		}
+
+		// A slow provider is not a fault of the key either
+		var timeoutErr *adapter.ProviderTimeoutError
+		if errors.As(err, &timeoutErr) && c.Request.Context().Err() == nil {
+			providerTimeouts.Add(1)
+			logger.Warn("provider timeout, retrying with next key",
+				slog.Int("attempt", attempt),
+				slog.String("key", security.MaskKey(key)),
+				slog.String("key_name", h.km.KeyName(key)),
 				slog.String("error", err.Error()),
+				slog.String("error_category", class.Category),
 			)
-			ui.PrintDeadKey(key, err.Error())
-			h.km.MarkAsDead(key)
+			lastErr = err
+			continue
+		}
+
+		if retry {
+			if class.ShouldMarkDead {
+				h.logger.Warn("rotating key",
+					slog.Int("attempt", attempt),
+					slog.String("key", security.MaskKey(key)),
+					slog.String("error", err.Error()),
+					slog.String("error_category", class.Category),
+				)
+				ui.PrintDeadKey(key, err.Error())
+			} else {
+				h.logger.Warn("retrying with next key",
+					slog.Int("attempt", attempt),
+					slog.String("key", security.MaskKey(key)),
+					slog.String("error", err.Error()),
+					slog.String("error_category", class.Category),
+				)
+			}
 			lastErr = err
 			continue
 		}
@@ -135,46 +800,271 @@ func (h *ProxyHandler) executeWithRetry(c *gin.Context, req adapter.OpenAIReques
 		h.logger.Error("non-retryable error",
 			slog.Int("attempt", attempt),
 			slog.String("error", err.Error()),
+			slog.String("error_category", class.Category),
+			slog.String("suggested_action", class.SuggestedAction),
 		)
-		return adapter.OpenAIResponse{}, attempt, err
+		return attempt, err
 	}
 
 	h.logger.Error("max retries reached",
-		slog.Int("max", h.maxRetries),
+		slog.Int("max", maxRetries),
 		slog.Any("used_keys", h.maskAll(used)),
 	)
-	return adapter.OpenAIResponse{}, h.maxRetries, lastErr
+	return maxRetries, lastErr
 }
 
-func (h *ProxyHandler) isRetryable(err error) bool {
-	s := err.Error()
+// nextKey returns the next key for model, from the routed provider's partition
+// when a router is set, else from a provider picked by the balancer, else a
+// key of the fastest region under region selection, else the fastest active
+// key under latency-based selection, else the next key in rotation. Every
+// path skips the keys in exclude.
+func (h *ProxyHandler) nextKey(ctx context.Context, model string, exclude map[string]struct{}) (string, error) {
+	if h.routeProvider != nil {
+		if p := h.routeProvider(model); p != "" {
+			return h.km.GetNextKeyByProviderExcluding(ctx, p, exclude)
+		}
+	}
+	if h.balancer != nil {
+		if p := h.balancer.SelectProvider(); p != "" {
+			return h.km.GetNextKeyByProviderExcluding(ctx, p, exclude)
+		}
+	}
+	if h.regionSelection {
+		return h.km.GetNextKeyByLowestRegionLatencyExcluding(ctx, exclude)
+	}
+	if h.latencySelection {
+		return h.fastestKey(exclude)
+	}
+	return h.km.GetNextKeyExcluding(ctx, exclude)
+}
+
+// fixedBaseURL is a base URL that does not change, for keys pinned to a
+// regional endpoint.
+type fixedBaseURL string
+
+func (u fixedBaseURL) BaseURL() string { return string(u) }
+
+// embeddingProvider is an adapter that also creates embeddings.
+type embeddingProvider interface {
+	Embeddings(ctx context.Context, req adapter.OpenAIEmbeddingRequest) (adapter.OpenAIEmbeddingResponse, error)
+}
+
+// adapterFor returns an adapter calling the provider with key, at the key's
+// regional base URL when it has one, or the one WithAdapterFactory creates,
+// passed through the WithAdapterWrapper wrapper.
+func (h *ProxyHandler) adapterFor(key string) adapter.AIProvider {
+	p := h.newProvider(key)
+	if h.wrapAdapter != nil {
+		return h.wrapAdapter(key, p)
+	}
+	return p
+}
+
+// newProvider creates the adapter for key, before any wrapper.
+func (h *ProxyHandler) newProvider(key string) adapter.AIProvider {
+	if h.newAdapter != nil {
+		return h.newAdapter(key)
+	}
+	opts := h.adapterOpts
+	if u := h.km.KeyBaseURL(key); u != "" {
+		opts = append(slices.Clip(opts), adapter.WithBaseURLProvider(fixedBaseURL(u)))
+	}
+	if h.forwardUser {
+		opts = append(slices.Clip(opts), adapter.WithForwardUser(true))
+	}
+	if h.adapterCacheSize > 0 {
+		opts = append(slices.Clip(opts), adapter.WithResponseCache(h.responseCache(key)))
+	}
+	return adapter.NewGeminiAdapter(key, opts...)
+}
+
+// responseCache returns the response cache of key, shared by every adapter
+// created for it.
+func (h *ProxyHandler) responseCache(key string) *adapter.ResponseCache {
+	if c, ok := h.adapterCaches.Load(key); ok {
+		return c.(*adapter.ResponseCache)
+	}
+	c, _ := h.adapterCaches.LoadOrStore(key, adapter.NewResponseCache(h.adapterCacheSize))
+	return c.(*adapter.ResponseCache)
+}
+
+// fastestKey returns the active key not in exclude with the lowest latency
+// that is below its concurrency limit and has quota and token rate left.
+func (h *ProxyHandler) fastestKey(exclude map[string]struct{}) (string, error) {
+	h.km.ReviveExpired()
+	keys := slices.DeleteFunc(h.km.GetActiveKeys(), func(k string) bool {
+		_, skip := exclude[k]
+		return skip
+	})
+	if len(keys) == 0 {
+		return "", domain.ErrNoKeysAvailable
+	}
+
+	withQuota := keys[:0]
+	overRate := false
+	for _, k := range keys {
+		switch {
+		case h.km.IsOverQuota(k):
+		case h.km.IsOverTokenRate(k):
+			overRate = true
+		default:
+			withQuota = append(withQuota, k)
+		}
+	}
+	if len(withQuota) == 0 {
+		if overRate {
+			return "", domain.ErrTokenRateExceeded
+		}
+		return "", domain.ErrQuotaExceeded
+	}
+	keys = withQuota
+
+	for len(keys) > 0 {
+		key := h.latency.GetFastestKey(keys)
+		if h.km.AcquireKey(key) {
+			return key, nil
+		}
+		for i, k := range keys {
+			if k == key {
+				keys = append(keys[:i], keys[i+1:]...)
+				break
+			}
+		}
+	}
+	return "", domain.ErrKeysBusy
+}
+
+// acquireKey returns the next key for model, from the target of the first
+// routing rule the request matches when there is one, waiting in the request
+// queue while every key is busy. tried holds the keys the request already
+// used, which are skipped where the selection allows.
+func (h *ProxyHandler) acquireKey(c *gin.Context, model string, tried map[string]struct{}) (string, error) {
+	// A client that went away or ran out of time gets no more keys, whichever
+	// way they would be selected.
+	ctx := c.Request.Context()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	next := func() (string, error) { return h.nextKey(ctx, model, tried) }
+	if rule, ok := h.matchRule(c, model); ok {
+		next = func() (string, error) {
+			return h.km.GetNextKeyByTagsExcluding(ctx, rule.Target.KeyTags, rule.Target.Strategy, tried)
+		}
+	}
+	if h.queue == nil {
+		return next()
+	}
+	return h.queue.Acquire(ctx, next)
+}
 
-	// rate limiting
-	if strings.Contains(s, "429") || strings.Contains(s, "rate limit") {
-		return true
+// matchRule returns the routing rule the request matches, if any. Chat
+// messages are text only, so requests never have images.
+func (h *ProxyHandler) matchRule(c *gin.Context, model string) (domain.RoutingRule, bool) {
+	if h.rules == nil {
+		return domain.RoutingRule{}, false
 	}
+	rule, ok := h.rules.Match(domain.RouteRequest{
+		Model:   model,
+		UserTag: strings.TrimSpace(c.GetHeader(UserTagHeader)),
+		Time:    time.Now(),
+	})
+	if ok {
+		requestLogger(c, h.logger).Debug("routing rule matched",
+			slog.String("rule", rule.Name),
+			slog.Any("key_tags", rule.Target.KeyTags),
+		)
+	}
+	return rule, ok
+}
 
-	// server errors
-	if strings.Contains(s, "500") || strings.Contains(s, "502") ||
-		strings.Contains(s, "503") || strings.Contains(s, "504") {
-		return true
+// releaseKey frees the key's concurrency slot and wakes queued requests.
+func (h *ProxyHandler) releaseKey(key string) {
+	h.km.ReleaseKey(key)
+	if h.queue != nil {
+		h.queue.Release()
 	}
+}
 
-	// quota exhausted
-	if strings.Contains(s, "quota") || strings.Contains(s, "exhausted") {
-		return true
+// isRetryable reports whether err is a provider answer that another key may
+// get past, see classify.
+func (h *ProxyHandler) isRetryable(err error) bool {
+	return h.classify(err).IsRetryable
+}
+
+// classify is ClassifyError adjusted by the configured status codes,
+// non-retryable first: a provider answer with a retryable status is retried
+// and takes the key out of rotation, one with a non-retryable status is
+// neither. A cancelled or timed out request is never retried.
+func (h *ProxyHandler) classify(err error) ErrorClass {
+	class := ClassifyError(err)
+	if isContextDone(err) {
+		class.IsRetryable, class.ShouldMarkDead = false, false
+		return class
+	}
+	var adapterErr *adapter.AdapterError
+	if errors.As(err, &adapterErr) {
+		switch {
+		case slices.Contains(h.noRetryStatus, adapterErr.StatusCode):
+			class.IsRetryable, class.ShouldMarkDead = false, false
+		case slices.Contains(h.retryStatus, adapterErr.StatusCode):
+			class.IsRetryable, class.ShouldMarkDead = true, true
+		}
+	}
+	return class
+}
+
+// isContextDone reports whether err comes from a cancelled or expired
+// request context.
+func isContextDone(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// sendUpstreamError answers a provider call that failed after attempts with
+// the status from upstreamError. Busy responses carry Retry-After, as do
+// unavailable ones while every key is dead, until the first key is revived.
+func (h *ProxyHandler) sendUpstreamError(c *gin.Context, err error, attempts int) {
+	status, msg := upstreamError(err)
+	errType := "server_error"
+	switch status {
+	case http.StatusTooManyRequests:
+		c.Header("Retry-After", strconv.Itoa(RetryAfterSeconds))
+		errType = "rate_limit_error"
+	case http.StatusNotImplemented:
+		errType = "invalid_request_error"
+	case http.StatusServiceUnavailable:
+		if seconds, ok := h.revivalRetryAfter(); ok {
+			c.Header("Retry-After", strconv.Itoa(seconds))
+		}
+	}
+	detail := adapter.OpenAIErrorDetail{Message: msg, Type: errType}
+	if h.errorDetails {
+		detail.Details = &adapter.OpenAIErrorDetails{
+			Attempts:      attempts,
+			KeysTried:     c.GetInt(keysTriedKey),
+			LastErrorType: ClassifyError(err).Category,
+		}
 	}
+	c.JSON(status, adapter.OpenAIError{Error: detail})
+}
 
-	return false
+// revivalRetryAfter returns the whole seconds, at least one, until the first
+// dead key is revived, and false unless every key is dead and one will be.
+func (h *ProxyHandler) revivalRetryAfter() (int, bool) {
+	if h.km.ActiveKeyCount() > 0 {
+		return 0, false
+	}
+	until, ok := h.km.EarliestRevivalTime()
+	if !ok {
+		return 0, false
+	}
+	return max(int((time.Until(until)+time.Second-1)/time.Second), 1), true
 }
 
 func (h *ProxyHandler) sendError(c *gin.Context, status int, errType, msg string) {
-	c.JSON(status, gin.H{
-		"error": gin.H{
-			"message": msg,
-			"type":    errType,
-			"param":   nil,
-			"code":    nil,
+	c.JSON(status, adapter.OpenAIError{
+		Error: adapter.OpenAIErrorDetail{
+			Message: msg,
+			Type:    errType,
 		},
 	})
 }
@@ -182,39 +1072,203 @@ func (h *ProxyHandler) sendError(c *gin.Context, status int, errType, msg string
 func (h *ProxyHandler) maskAll(keys []string) []string {
 	res := make([]string, len(keys))
 	for i, k := range keys {
-		res[i] = maskKey(k)
+		res[i] = security.MaskKey(k)
 	}
 	return res
 }
 
-// HandleModels returns available models (OpenAI format).
+// BuildInfo identifies the router build, set through -ldflags at build time.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// HealthResponse is the body returned by the health endpoint.
+type HealthResponse struct {
+	// BuildInfo tells apart routers running different versions.
+	BuildInfo
+
+	// Status is "healthy" while at least one key is in rotation, "degraded" otherwise.
+	Status string `json:"status"`
+
+	ActiveKeys int `json:"active_keys"`
+	DeadKeys   int `json:"dead_keys"`
+	TotalKeys  int `json:"total_keys"`
+
+	// QueueDepth is the number of requests waiting for a busy key.
+	QueueDepth int `json:"queue_depth"`
+
+	// CooldownSeconds is how long dead keys wait before they are revived;
+	// 0 when auto-revival is disabled.
+	CooldownSeconds int64 `json:"cooldown_seconds"`
+
+	// LowKeyWarning is set while active keys are at or below the configured
+	// minimum. It does not change the status code, so probes don't flap.
+	LowKeyWarning bool `json:"low_key_warning,omitempty"`
+
+	// StreamSubscribers is the number of clients connected to the admin
+	// metrics stream.
+	StreamSubscribers int `json:"stream_subscribers"`
+
+	// ByProvider lists the providers with active keys or a balancing
+	// weight, sorted by name.
+	ByProvider []ProviderHealth `json:"by_provider"`
+}
+
+// ProviderHealth is a provider's share of the key pool in the health response.
+type ProviderHealth struct {
+	Provider   domain.ProviderType `json:"provider"`
+	ActiveKeys int                 `json:"active_keys"`
+
+	// Weight is the provider's balancing weight; 0 without a balancer.
+	Weight int `json:"weight"`
+}
+
+// ReadinessResponse is the body returned by the readiness endpoint.
+type ReadinessResponse struct {
+	// Status is "ready" while at least one key is in rotation, "not_ready" otherwise.
+	Status string `json:"status"`
+
+	ActiveKeys int `json:"active_keys"`
+}
+
+// HandleReady reports whether the router can serve requests, answering 503
+// when no key is in rotation so load balancers stop sending traffic.
+func (h *ProxyHandler) HandleReady(c *gin.Context) {
+	active := h.km.ActiveKeyCount()
+	if active == 0 {
+		c.JSON(http.StatusServiceUnavailable, ReadinessResponse{Status: "not_ready", ActiveKeys: active})
+		return
+	}
+	c.JSON(http.StatusOK, ReadinessResponse{Status: "ready", ActiveKeys: active})
+}
+
+// ModelListTTL is how long a provider's model list is cached.
+const ModelListTTL = 10 * time.Minute
+
+// modelCacheKeyPrefix prefixes the cache keys of provider model lists.
+const modelCacheKeyPrefix = "models:"
+
+// modelCreated is the creation time reported for every model.
+const modelCreated = 1687882411
+
+// staticModels are always listed: the OpenAI names the Gemini adapter maps
+// and the models they map to.
+var staticModels = []adapter.OpenAIModel{
+	{ID: "gpt-4", Object: "model", Created: modelCreated, OwnedBy: "openai"},
+	{ID: "gpt-4-turbo", Object: "model", Created: modelCreated, OwnedBy: "openai"},
+	{ID: "gpt-3.5-turbo", Object: "model", Created: modelCreated, OwnedBy: "openai"},
+	{ID: "gemini-1.5-pro", Object: "model", Created: modelCreated, OwnedBy: "google"},
+	{ID: "gemini-1.5-flash", Object: "model", Created: modelCreated, OwnedBy: "google"},
+}
+
+// HandleModels returns available models (OpenAI format): the static model
+// names followed by the models the provider lists for an active key.
 func (h *ProxyHandler) HandleModels(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"object": "list",
-		"data": []gin.H{
-			{"id": "gpt-4", "object": "model", "created": 1687882411, "owned_by": "openai"},
-			{"id": "gpt-4-turbo", "object": "model", "created": 1687882411, "owned_by": "openai"},
-			{"id": "gpt-3.5-turbo", "object": "model", "created": 1687882411, "owned_by": "openai"},
-			{"id": "gemini-1.5-pro", "object": "model", "created": 1687882411, "owned_by": "google"},
-			{"id": "gemini-1.5-flash", "object": "model", "created": 1687882411, "owned_by": "google"},
-		},
-	})
+	models := slices.Clone(staticModels)
+	provider, ids := h.providerModels(c.Request.Context())
+	for _, id := range ids {
+		if !slices.ContainsFunc(models, func(m adapter.OpenAIModel) bool { return m.ID == id }) {
+			models = append(models, adapter.OpenAIModel{ID: id, Object: "model", Created: modelCreated, OwnedBy: provider})
+		}
+	}
+	c.JSON(http.StatusOK, adapter.OpenAIModelList{Object: "list", Data: models})
+}
+
+// providerModels returns the provider of the first active key and the
+// models it lists for that key, cached when WithModelCache is set. When no
+// key is active or the listing fails it returns no models.
+func (h *ProxyHandler) providerModels(ctx context.Context) (string, []string) {
+	keys := h.km.GetActiveKeys()
+	if len(keys) == 0 {
+		return "", nil
+	}
+	key := keys[0]
+	// Keys without a provider are served by the Gemini adapter.
+	provider := h.km.KeyProvider(key)
+	if provider == "" {
+		provider = domain.ProviderGoogle
+	}
+
+	cacheKey := modelCacheKeyPrefix + string(provider)
+	if h.modelCache != nil {
+		if entry, ok := h.modelCache.GetEntry(cacheKey); ok {
+			var ids []string
+			if err := json.Unmarshal(entry.Response, &ids); err == nil {
+				return string(provider), ids
+			}
+		}
+	}
+
+	ids, err := h.adapterFor(key).ListModels(ctx)
+	if err != nil {
+		h.logger.Warn("failed to list provider models",
+			slog.String("provider", string(provider)),
+			slog.String("key", security.MaskKey(key)),
+			slog.String("error", err.Error()),
+		)
+		return string(provider), nil
+	}
+	if h.modelCache != nil {
+		if b, err := json.Marshal(ids); err == nil {
+			h.modelCache.SetWithTTL(cacheKey, b, ModelListTTL)
+		}
+	}
+	return string(provider), ids
 }
 
 // HandleHealth reports server health status.
 func (h *ProxyHandler) HandleHealth(c *gin.Context) {
-	active := h.km.ActiveKeyCount()
-	dead := h.km.DeadKeyCount()
+	states := h.km.GetAllKeyStates()
+	active, dead := domain.CountKeyStates(states)
 
 	status := "healthy"
 	if active == 0 {
 		status = "degraded"
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":      status,
-		"active_keys": active,
-		"dead_keys":   dead,
-		"total_keys":  h.km.TotalKeyCount(),
+	var queueDepth int
+	if h.queue != nil {
+		queueDepth = h.queue.Depth()
+	}
+	var subscribers int
+	if h.stream != nil {
+		subscribers = h.stream.StreamSubscriberCount()
+	}
+
+	c.JSON(http.StatusOK, HealthResponse{
+		BuildInfo:         h.build,
+		Status:            status,
+		ActiveKeys:        active,
+		DeadKeys:          dead,
+		TotalKeys:         len(states),
+		QueueDepth:        queueDepth,
+		CooldownSeconds:   int64(h.km.GetCooldown() / time.Second),
+		LowKeyWarning:     h.km.LowOnKeys(),
+		StreamSubscribers: subscribers,
+		ByProvider:        h.providerHealth(),
 	})
 }
+
+// providerHealth reports the active keys and weight of each provider.
+func (h *ProxyHandler) providerHealth() []ProviderHealth {
+	providers := h.km.ActiveProviders()
+	if h.balancer != nil {
+		for _, p := range h.balancer.Providers() {
+			if !slices.Contains(providers, p) {
+				providers = append(providers, p)
+			}
+		}
+		slices.Sort(providers)
+	}
+
+	res := make([]ProviderHealth, len(providers))
+	for i, p := range providers {
+		res[i] = ProviderHealth{Provider: p, ActiveKeys: h.km.ProviderKeyCount(p)}
+		if h.balancer != nil {
+			res[i].Weight = h.balancer.Weight(p)
+		}
+	}
+	return res
+}
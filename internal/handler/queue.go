@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// Request queue defaults.
+const (
+	DefaultQueueMaxSize = 100
+	DefaultQueueTimeout = 30 * time.Second
+)
+
+// RetryAfterSeconds is the Retry-After sent when a request is rejected because
+// every key is busy.
+const RetryAfterSeconds = 1
+
+var (
+	// ErrQueueFull is returned when every key is busy and the queue has no room.
+	ErrQueueFull = errors.New("request queue is full")
+
+	// ErrQueueTimeout is returned when no key was released within the queue timeout.
+	ErrQueueTimeout = errors.New("timed out waiting for a key")
+)
+
+// RequestQueue holds requests that find every key at its concurrency limit
+// until a key is released. pending has one slot per waiting request, so its
+// capacity is the queue size.
+type RequestQueue struct {
+	pending chan context.Context
+	timeout time.Duration
+
+	mu       sync.Mutex
+	released chan struct{} // closed and replaced on every Release
+}
+
+// NewRequestQueue returns a queue holding at most maxSize requests for at most timeout each.
+func NewRequestQueue(maxSize int, timeout time.Duration) *RequestQueue {
+	return &RequestQueue{
+		pending:  make(chan context.Context, maxSize),
+		timeout:  timeout,
+		released: make(chan struct{}),
+	}
+}
+
+// Acquire returns the key chosen by next. When next reports domain.ErrKeysBusy
+// the request joins the queue and next is retried after every Release, until
+// it yields a key, the timeout elapses or ctx is done. Other errors are
+// returned as they are.
+func (q *RequestQueue) Acquire(ctx context.Context, next func() (string, error)) (string, error) {
+	key, err := next()
+	if !errors.Is(err, domain.ErrKeysBusy) {
+		return key, err
+	}
+
+	select {
+	case q.pending <- ctx:
+	default:
+		return "", ErrQueueFull
+	}
+	defer func() { <-q.pending }()
+
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+
+	for {
+		// Take the signal channel before retrying so a release in between is not missed.
+		q.mu.Lock()
+		released := q.released
+		q.mu.Unlock()
+
+		key, err = next()
+		if !errors.Is(err, domain.ErrKeysBusy) {
+			return key, err
+		}
+
+		select {
+		case <-released:
+		case <-timer.C:
+			return "", ErrQueueTimeout
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Release wakes queued requests after a key slot was freed.
+func (q *RequestQueue) Release() {
+	q.mu.Lock()
+	close(q.released)
+	q.released = make(chan struct{})
+	q.mu.Unlock()
+}
+
+// Depth returns the number of queued requests.
+func (q *RequestQueue) Depth() int {
+	return len(q.pending)
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestRequestQueue_Acquire(t *testing.T) {
+	km := domain.NewKeyManager([]string{"key1"}, 0, domain.WithMaxConcurrentPerKey(1))
+	q := NewRequestQueue(1, time.Second)
+
+	first, err := q.Acquire(context.Background(), km.GetNextKey)
+	if err != nil || first != "key1" {
+		t.Fatalf("Acquire() = %q, %v; want key1", first, err)
+	}
+
+	got := make(chan error, 1)
+	go func() {
+		_, err := q.Acquire(context.Background(), km.GetNextKey)
+		got <- err
+	}()
+
+	waitForDepth(t, q, 1)
+	km.ReleaseKey(first)
+	q.Release()
+
+	if err := <-got; err != nil {
+		t.Errorf("queued Acquire() error = %v, want nil", err)
+	}
+	if q.Depth() != 0 {
+		t.Errorf("Depth() = %d, want 0", q.Depth())
+	}
+}
+
+func TestRequestQueue_Errors(t *testing.T) {
+	busy := func() (string, error) { return "", domain.ErrKeysBusy }
+
+	tests := []struct {
+		name    string
+		size    int
+		timeout time.Duration
+		ctx     func() context.Context
+		want    error
+	}{
+		{"no room", 0, time.Second, context.Background, ErrQueueFull},
+		{"timeout", 1, 10 * time.Millisecond, context.Background, ErrQueueTimeout},
+		{"canceled", 1, time.Second, func() context.Context {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx
+		}, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewRequestQueue(tt.size, tt.timeout)
+			if _, err := q.Acquire(tt.ctx(), busy); !errors.Is(err, tt.want) {
+				t.Errorf("Acquire() error = %v, want %v", err, tt.want)
+			}
+			if q.Depth() != 0 {
+				t.Errorf("Depth() = %d, want 0 after leaving the queue", q.Depth())
+			}
+		})
+	}
+}
+
+func TestRequestQueue_PassesOtherErrors(t *testing.T) {
+	q := NewRequestQueue(1, time.Second)
+	_, err := q.Acquire(context.Background(), func() (string, error) { return "", domain.ErrNoKeysAvailable })
+	if !errors.Is(err, domain.ErrNoKeysAvailable) {
+		t.Errorf("Acquire() error = %v, want ErrNoKeysAvailable without queueing", err)
+	}
+}
+
+func TestProxyHandler_QueuesWhenKeysBusy(t *testing.T) {
+	release := make(chan struct{})
+	var upstream sync.WaitGroup
+	gemini := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream.Done()
+		<-release
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	defer gemini.Close()
+
+	gin.SetMode(gin.TestMode)
+	km := domain.NewKeyManager([]string{testProxyKey, "AIzaSyTestKey0987654321"}, 0, domain.WithMaxConcurrentPerKey(1))
+	queue := NewRequestQueue(2, 5*time.Second)
+	h := NewProxyHandler(km, nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithAdapterOptions(adapter.WithBaseURL(gemini.URL)),
+		WithRequestQueue(queue),
+	)
+
+	// Saturate both keys.
+	upstream.Add(2)
+	first := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() { first <- postChat(h).Code }()
+	}
+	upstream.Wait()
+
+	// Two more requests fill the queue; a fifth is turned away.
+	upstream.Add(2)
+	queued := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() { queued <- postChat(h).Code }()
+	}
+	waitForDepth(t, queue, 2)
+
+	if got := healthQueueDepth(t, h); got != 2 {
+		t.Errorf("health queue_depth = %d, want 2", got)
+	}
+
+	w := postChat(h)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status with a full queue = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 response missing Retry-After")
+	}
+
+	// Finishing the first batch lets the queued requests through.
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-first; code != http.StatusOK {
+			t.Errorf("first batch status = %d, want 200", code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if code := <-queued; code != http.StatusOK {
+			t.Errorf("queued request status = %d, want 200", code)
+		}
+	}
+	if km.InFlight(testProxyKey) != 0 {
+		t.Errorf("InFlight = %d after all requests finished, want 0", km.InFlight(testProxyKey))
+	}
+}
+
+// waitForDepth waits until q holds want requests.
+func waitForDepth(t *testing.T, q *RequestQueue, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for q.Depth() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth = %d, want %d", q.Depth(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func healthQueueDepth(t *testing.T, h *ProxyHandler) int {
+	t.Helper()
+	r := gin.New()
+	r.GET("/health", h.HandleHealth)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", strings.NewReader("")))
+
+	var resp HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid health JSON: %v", err)
+	}
+	return resp.QueueDepth
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRequestIDHeader carries the request ID unless
+// WithRequestIDHeader names another header.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// MaxRequestIDLength is the longest incoming request ID kept, in bytes.
+const MaxRequestIDLength = 128
+
+// requestIDKey is the gin context key holding the request ID.
+const requestIDKey = "request_id"
+
+// RequestIDOption configures RequestIDMiddleware.
+type RequestIDOption func(*requestIDConfig)
+
+type requestIDConfig struct {
+	header string
+}
+
+// WithRequestIDHeader reads and echoes the request ID under name instead of
+// X-Request-ID, e.g. X-Correlation-ID set by an upstream gateway.
+func WithRequestIDHeader(name string) RequestIDOption {
+	return func(cfg *requestIDConfig) {
+		if name != "" {
+			cfg.header = name
+		}
+	}
+}
+
+// RequestIDMiddleware gives every request an ID: the one in the request ID
+// header when present, sanitized, or else a new random UUID. The ID is
+// echoed in the same response header and logged as request_id.
+func RequestIDMiddleware(opts ...RequestIDOption) gin.HandlerFunc {
+	cfg := requestIDConfig{header: DefaultRequestIDHeader}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(c *gin.Context) {
+		id := sanitizeRequestID(c.GetHeader(cfg.header))
+		if id == "" {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(cfg.header, id)
+		c.Next()
+	}
+}
+
+// sanitizeRequestID keeps only printable ASCII of a client-supplied ID and
+// truncates it to MaxRequestIDLength bytes, so it cannot forge log lines.
+func sanitizeRequestID(id string) string {
+	b := make([]byte, 0, min(len(id), MaxRequestIDLength))
+	for i := 0; i < len(id) && len(b) < MaxRequestIDLength; i++ {
+		if ch := id[i]; ch >= 0x20 && ch < 0x7f {
+			b = append(b, ch)
+		}
+	}
+	return string(b)
+}
+
+// newRequestID returns a random version 4 UUID.
+func newRequestID() string {
+	var u [16]byte
+	// crypto/rand.Read never returns an error.
+	_, _ = rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var uuidV4Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// serveRequestID sends a request with the given headers through
+// RequestIDMiddleware and returns the response and the ID the handler saw.
+func serveRequestID(t *testing.T, headers map[string]string, opts ...RequestIDOption) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var seen string
+	r := gin.New()
+	r.Use(RequestIDMiddleware(opts...))
+	r.GET("/health", func(c *gin.Context) {
+		seen = c.GetString(requestIDKey)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w, seen
+}
+
+func TestRequestIDMiddleware_Header(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []RequestIDOption
+		headers map[string]string
+		echoed  string
+		want    string
+	}{
+		{
+			name:    "default header",
+			headers: map[string]string{"X-Request-ID": "abc-123"},
+			echoed:  "X-Request-ID",
+			want:    "abc-123",
+		},
+		{
+			name:    "custom header",
+			opts:    []RequestIDOption{WithRequestIDHeader("X-Correlation-ID")},
+			headers: map[string]string{"X-Correlation-ID": "corr-42"},
+			echoed:  "X-Correlation-ID",
+			want:    "corr-42",
+		},
+		{
+			name:    "empty name keeps default",
+			opts:    []RequestIDOption{WithRequestIDHeader("")},
+			headers: map[string]string{"X-Request-ID": "abc-123"},
+			echoed:  "X-Request-ID",
+			want:    "abc-123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, seen := serveRequestID(t, tt.headers, tt.opts...)
+			if seen != tt.want {
+				t.Errorf("request_id = %q, want %q", seen, tt.want)
+			}
+			if got := w.Header().Get(tt.echoed); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.echoed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware_CustomHeaderIgnoresDefault(t *testing.T) {
+	w, seen := serveRequestID(t, map[string]string{"X-Request-ID": "abc-123"},
+		WithRequestIDHeader("X-Correlation-ID"))
+
+	if !uuidV4Pattern.MatchString(seen) {
+		t.Errorf("request_id = %q, want a generated UUID", seen)
+	}
+	if got := w.Header().Get("X-Request-ID"); got != "" {
+		t.Errorf("X-Request-ID = %q, want it unset", got)
+	}
+	if got := w.Header().Get("X-Correlation-ID"); got != seen {
+		t.Errorf("X-Correlation-ID = %q, want %q", got, seen)
+	}
+}
+
+func TestRequestIDMiddleware_GeneratesUUID(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"missing", nil},
+		{"only non-printable", map[string]string{"X-Request-ID": "\x01\x02\x7f"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, seen := serveRequestID(t, tt.headers)
+			if !uuidV4Pattern.MatchString(seen) {
+				t.Errorf("request_id = %q, want a UUID", seen)
+			}
+			if got := w.Header().Get("X-Request-ID"); got != seen {
+				t.Errorf("X-Request-ID = %q, want %q", got, seen)
+			}
+		})
+	}
+
+	_, first := serveRequestID(t, nil)
+	_, second := serveRequestID(t, nil)
+	if first == second {
+		t.Errorf("generated IDs repeat: %q", first)
+	}
+}
+
+func TestSanitizeRequestID(t *testing.T) {
+	long := strings.Repeat("a", MaxRequestIDLength+10)
+
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{"uuid", "0b6a3c9e-7f4d-4c1a-9e2b-5d8f1a6c3e70", "0b6a3c9e-7f4d-4c1a-9e2b-5d8f1a6c3e70"},
+		{"printable", "req:42/gw=edge 1", "req:42/gw=edge 1"},
+		{"control characters", "abc\r\ninjected\x00", "abcinjected"},
+		{"non-ascii", "id-é-✓", "id--"},
+		{"truncated", long, long[:MaxRequestIDLength]},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeRequestID(tt.id); got != tt.want {
+				t.Errorf("sanitizeRequestID(%q) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRateWindow is the span RequestRate averages over.
+const DefaultRateWindow = 10 * time.Second
+
+// RequestRate counts requests in one-second buckets over a sliding window.
+type RequestRate struct {
+	mu      sync.Mutex
+	counts  []int64
+	seconds []int64
+	now     func() time.Time
+}
+
+// NewRequestRate returns a counter averaging over window, rounded down to
+// whole seconds and at least one second.
+func NewRequestRate(window time.Duration) *RequestRate {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return &RequestRate{
+		counts:  make([]int64, n),
+		seconds: make([]int64, n),
+		now:     time.Now,
+	}
+}
+
+// Add counts one request at the current time.
+func (r *RequestRate) Add() {
+	sec := r.now().Unix()
+	i := int(sec % int64(len(r.counts)))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seconds[i] != sec {
+		r.seconds[i] = sec
+		r.counts[i] = 0
+	}
+	r.counts[i]++
+}
+
+// Rate returns the average requests per second over the window.
+func (r *RequestRate) Rate() float64 {
+	sec := r.now().Unix()
+	n := int64(len(r.counts))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total int64
+	for i, s := range r.seconds {
+		if sec-s < n {
+			total += r.counts[i]
+		}
+	}
+	return float64(total) / float64(n)
+}
+
+// Middleware counts every request that reaches it.
+func (r *RequestRate) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r.Add()
+		c.Next()
+	}
+}
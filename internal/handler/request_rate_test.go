@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestRate(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	r := NewRequestRate(10 * time.Second)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 20; i++ {
+		r.Add()
+	}
+	if got := r.Rate(); got != 2 {
+		t.Errorf("Rate() = %v, want 2", got)
+	}
+
+	now = now.Add(5 * time.Second)
+	for i := 0; i < 10; i++ {
+		r.Add()
+	}
+	if got := r.Rate(); got != 3 {
+		t.Errorf("Rate() = %v after 5s, want 3", got)
+	}
+
+	// The first second slides out of the window.
+	now = now.Add(5 * time.Second)
+	if got := r.Rate(); got != 1 {
+		t.Errorf("Rate() = %v after 10s, want 1", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := r.Rate(); got != 0 {
+		t.Errorf("Rate() = %v after a quiet minute, want 0", got)
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gin context keys holding the request and response sizes in bytes, as
+// int64, set by RequestSizeMiddleware.
+const (
+	RequestBytesKey  = "request_bytes"
+	ResponseBytesKey = "response_bytes"
+)
+
+// RequestSizeMiddleware stores the size of the request and response bodies
+// under request_bytes and response_bytes once the request is handled. The
+// request size is its Content-Length; without one, the bytes the handlers
+// read are counted. Middleware running before it, such as LoggingMiddleware
+// and the Prometheus middleware, can read both after c.Next.
+func RequestSizeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body *countingReader
+		if c.Request.ContentLength < 0 && c.Request.Body != nil {
+			body = &countingReader{ReadCloser: c.Request.Body}
+			c.Request.Body = body
+		}
+		w := &countingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		requestBytes := max(c.Request.ContentLength, 0)
+		if body != nil {
+			requestBytes = body.n
+		}
+		c.Set(RequestBytesKey, requestBytes)
+		c.Set(ResponseBytesKey, w.n)
+	}
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the response body bytes written through it.
+type countingWriter struct {
+	gin.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestSizeMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentLength bool
+	}{
+		{"content length", true},
+		{"counted body", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs strings.Builder
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil))), RequestSizeMiddleware())
+			r.POST("/echo", func(c *gin.Context) {
+				io.Copy(io.Discard, c.Request.Body)
+				c.String(http.StatusOK, strings.Repeat("x", 2000))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("a", 600)))
+			if !tt.contentLength {
+				req.ContentLength = -1
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry struct {
+				RequestBytes  int64 `json:"request_bytes"`
+				ResponseBytes int64 `json:"response_bytes"`
+			}
+			if err := json.Unmarshal([]byte(logs.String()), &entry); err != nil {
+				t.Fatalf("log is not JSON: %v: %s", err, logs.String())
+			}
+			if entry.RequestBytes != 600 || entry.ResponseBytes != 2000 {
+				t.Errorf("logged request_bytes = %d, response_bytes = %d, want 600 and 2000", entry.RequestBytes, entry.ResponseBytes)
+			}
+		})
+	}
+}
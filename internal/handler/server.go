@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/hpn/hpn-g-router/internal/config"
+)
+
+// NewServer returns the HTTP server for cfg serving h. With cfg.TLSEnabled it
+// is configured for HTTPS: start it with ListenAndServeTLS(cfg.TLSCertFile,
+// cfg.TLSKeyFile), or ListenAndServeTLS("", "") under cfg.TLSAutoCert, where
+// certificates come from Let's Encrypt and are renewed before they expire.
+func NewServer(cfg config.ServerConfig, h http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler:      h,
+		ReadTimeout:  time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+	}
+	if !cfg.TLSEnabled {
+		return srv
+	}
+
+	if cfg.TLSAutoCert {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutoCertDomains...),
+			Cache:      autocert.DirCache(cfg.TLSCacheDir),
+			Email:      cfg.TLSAutoCertEmail,
+		}
+		srv.TLSConfig = m.TLSConfig()
+	} else {
+		srv.TLSConfig = &tls.Config{}
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+	return srv
+}
+
+// ListenAndServe starts srv as NewServer configured it for cfg.
+func ListenAndServe(srv *http.Server, cfg config.ServerConfig) error {
+	switch {
+	case cfg.TLSEnabled && cfg.TLSAutoCert:
+		return srv.ListenAndServeTLS("", "")
+	case cfg.TLSEnabled:
+		return srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	default:
+		return srv.ListenAndServe()
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/hpn/hpn-g-router/internal/config"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key
+// to dir and returns their paths and the certificate.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hpn-router test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestNewServer_TLSFromFiles(t *testing.T) {
+	certFile, keyFile, cert := writeTestCert(t, t.TempDir())
+
+	// Reserve a free port for the server to listen on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	cfg := config.ServerConfig{
+		Host:        "127.0.0.1",
+		Port:        port,
+		TLSEnabled:  true,
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+	}
+	srv := NewServer(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	errc := make(chan error, 1)
+	go func() { errc <- ListenAndServe(srv, cfg) }()
+	defer func() {
+		srv.Close()
+		if err := <-errc; err != http.ErrServerClosed {
+			t.Errorf("ListenAndServe() error = %v, want %v", err, http.ErrServerClosed)
+		}
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+
+	var resp *http.Response
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		resp, err = client.Get("https://" + srv.Addr + "/")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET over TLS error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("response = %d %q, want 200 \"ok\"", resp.StatusCode, body)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("connection TLS state = %+v, want TLS 1.2 or later", resp.TLS)
+	}
+}
+
+func TestNewServer_Config(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.ServerConfig
+		wantTLS  bool
+		wantACME bool
+	}{
+		{"plain", config.ServerConfig{Port: 8080}, false, false},
+		{"files", config.ServerConfig{Port: 8443, TLSEnabled: true, TLSCertFile: "c", TLSKeyFile: "k"}, true, false},
+		{"auto cert", config.ServerConfig{
+			Port:               443,
+			TLSEnabled:         true,
+			TLSAutoCert:        true,
+			TLSAutoCertDomains: []string{"router.example.com"},
+			TLSCacheDir:        t.TempDir(),
+		}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(tt.cfg, http.NotFoundHandler())
+			if (srv.TLSConfig != nil) != tt.wantTLS {
+				t.Fatalf("TLSConfig = %v, want TLS %v", srv.TLSConfig, tt.wantTLS)
+			}
+			if !tt.wantTLS {
+				return
+			}
+			if srv.TLSConfig.MinVersion != tls.VersionTLS12 {
+				t.Errorf("MinVersion = %x, want TLS 1.2", srv.TLSConfig.MinVersion)
+			}
+			acmeReady := srv.TLSConfig.GetCertificate != nil && slices.Contains(srv.TLSConfig.NextProtos, acme.ALPNProto)
+			if acmeReady != tt.wantACME {
+				t.Errorf("answers ACME TLS-ALPN challenges = %v, want %v", acmeReady, tt.wantACME)
+			}
+		})
+	}
+}
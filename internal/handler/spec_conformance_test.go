@@ -0,0 +1,237 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/handler"
+	"github.com/hpn/hpn-g-router/internal/spec"
+)
+
+// assertMatchesSchema checks a real response body against a component schema of the published spec.
+func assertMatchesSchema(t *testing.T, body []byte, schema string) {
+	t.Helper()
+
+	built, err := spec.Build("test")
+	if err != nil {
+		t.Fatalf("spec.Build() error = %v", err)
+	}
+	// Load the document back so $refs between component schemas are resolved.
+	raw, err := json.Marshal(built)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	doc, err := openapi3.NewLoader().LoadFromData(raw)
+	if err != nil {
+		t.Fatalf("LoadFromData() error = %v", err)
+	}
+	ref, ok := doc.Components.Schemas[schema]
+	if !ok {
+		t.Fatalf("schema %s missing from spec", schema)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if err := ref.Value.VisitJSON(value); err != nil {
+		t.Errorf("response does not match %s schema: %v\nbody: %s", schema, err, body)
+	}
+}
+
+func newConformanceRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	km := domain.NewMockKeyManager("AIzaSyTestKey1234567890")
+	h := handler.NewProxyHandler(km, nil)
+
+	r := gin.New()
+	r.POST("/v1/chat/completions", h.HandleChatCompletion)
+	r.POST("/v1/chat/completions/batch", h.HandleBatchCompletion)
+	r.POST("/v1/embeddings", h.HandleEmbeddings)
+	r.GET("/v1/embeddings", handler.MethodNotAllowedHandler(http.MethodPost))
+	return r
+}
+
+func TestProxyHandler_ErrorMatchesSpec(t *testing.T) {
+	r := newConformanceRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"param":null`) || !strings.Contains(w.Body.String(), `"code":null`) {
+		t.Errorf("body = %s, want param and code serialized as null", w.Body.String())
+	}
+	assertMatchesSchema(t, w.Body.Bytes(), "OpenAIError")
+}
+
+func TestProxyHandler_ModelsMatchSpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gemini := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models":[{"name":"models/gemini-2.0-flash"}]}`))
+	}))
+	defer gemini.Close()
+	h := handler.NewProxyHandler(domain.NewMockKeyManager("AIzaSyTestKey1234567890"), nil,
+		handler.WithBaseURL(gemini.URL))
+	r := gin.New()
+	r.GET("/v1/models", h.HandleModels)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	assertMatchesSchema(t, w.Body.Bytes(), "OpenAIModelList")
+}
+
+func TestProxyHandler_HealthMatchesSpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	km := domain.NewMockKeyManager("AIzaSyTestKey1234567890")
+	h := handler.NewProxyHandler(km, nil)
+	r := gin.New()
+	r.GET("/health", h.HandleHealth)
+
+	for _, name := range []string{"healthy", "degraded"} {
+		t.Run(name, func(t *testing.T) {
+			if name == "degraded" {
+				km.MarkAsDead("AIzaSyTestKey1234567890", "")
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if !strings.Contains(w.Body.String(), `"status":"`+name+`"`) {
+				t.Errorf("body = %s, want status %s", w.Body.String(), name)
+			}
+			assertMatchesSchema(t, w.Body.Bytes(), "HealthResponse")
+		})
+	}
+}
+
+func TestProxyHandler_EmbeddingsErrorsMatchSpec(t *testing.T) {
+	r := newConformanceRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"missing input", http.MethodPost, `{"model":"text-embedding-3-small"}`, http.StatusBadRequest},
+		{"invalid input", http.MethodPost, `{"input":42}`, http.StatusBadRequest},
+		{"base64 format", http.MethodPost, `{"input":"hi","encoding_format":"base64"}`, http.StatusBadRequest},
+		{"GET", http.MethodGet, ``, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/v1/embeddings", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusMethodNotAllowed && w.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("Allow = %q, want POST", w.Header().Get("Allow"))
+			}
+			assertMatchesSchema(t, w.Body.Bytes(), "OpenAIError")
+		})
+	}
+}
+
+func TestAdminHandler_MatchesSpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	km := domain.NewKeyManager([]string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}, 0,
+		domain.WithKeyNames(map[string]string{"AIzaSyFirstKey000000001": "primary"}))
+	km.MarkAsDead("AIzaSySecondKey00000002", "")
+
+	latency := domain.NewLatencyTracker(domain.DefaultLatencyAlpha)
+	latency.RecordLatency("AIzaSyFirstKey000000001", 120*time.Millisecond)
+
+	h := handler.NewAdminHandler(km, handler.WithAdminLatencyTracker(latency))
+	r := gin.New()
+	admin := r.Group("/admin", handler.AdminAuthMiddleware("token", slog.Default()))
+	admin.GET("/keys", h.HandleListKeys)
+	admin.GET("/keys/latency", h.HandleKeyLatency)
+	admin.POST("/keys/:name/kill", h.HandleKillKey)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+		schema string
+	}{
+		{"authorized", "/admin/keys", "token", http.StatusOK, "KeyListResponse"},
+		{"unauthorized", "/admin/keys", "", http.StatusUnauthorized, "OpenAIError"},
+		{"latency", "/admin/keys/latency", "token", http.StatusOK, "KeyLatencyResponse"},
+		{"kill", "/admin/keys/primary/kill", "token", http.StatusOK, "KeyActionResponse"},
+		{"kill unknown", "/admin/keys/missing/kill", "token", http.StatusNotFound, "OpenAIError"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodGet
+			if strings.HasSuffix(tt.path, "/kill") {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			req.Header.Set(handler.AdminTokenHeader, tt.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			assertMatchesSchema(t, w.Body.Bytes(), tt.schema)
+		})
+	}
+}
+
+func TestProxyHandler_BatchMatchesSpec(t *testing.T) {
+	gemini := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	defer gemini.Close()
+
+	gin.SetMode(gin.TestMode)
+	km := domain.NewMockKeyManager("AIzaSyTestKey1234567890")
+	h := handler.NewProxyHandler(km, nil, handler.WithAdapterOptions(adapter.WithBaseURL(gemini.URL)))
+	r := gin.New()
+	r.POST("/v1/chat/completions/batch", h.HandleBatchCompletion)
+
+	// One item succeeds and one is rejected, so both result shapes are checked.
+	body := `{"requests":[{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]},{"model":"gpt-4","messages":[]}]}`
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	assertMatchesSchema(t, w.Body.Bytes(), "BatchCompletionResponse")
+}
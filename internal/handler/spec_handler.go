@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// specKeyOrder is the conventional order of top-level OpenAPI fields. kin-openapi
+// marshals the document through a map, which would otherwise sort them alphabetically.
+var specKeyOrder = []string{"openapi", "info", "servers", "tags", "paths", "components", "security", "externalDocs"}
+
+// SpecHandler serves the OpenAPI document in JSON and YAML form.
+// Both encodings are rendered once at construction time and share the same key order.
+type SpecHandler struct {
+	jsonDoc []byte
+	yamlDoc []byte
+}
+
+// NewSpecHandler renders the given OpenAPI document for serving.
+func NewSpecHandler(doc *openapi3.T) (*SpecHandler, error) {
+	jsonDoc, err := renderSpecJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	yamlDoc, err := renderSpecYAML(jsonDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SpecHandler{jsonDoc: jsonDoc, yamlDoc: yamlDoc}, nil
+}
+
+// JSON returns the rendered JSON document.
+func (h *SpecHandler) JSON() []byte {
+	return h.jsonDoc
+}
+
+// YAML returns the rendered YAML document.
+func (h *SpecHandler) YAML() []byte {
+	return h.yamlDoc
+}
+
+// HandleJSON serves GET /openapi.json.
+func (h *SpecHandler) HandleJSON(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", h.jsonDoc)
+}
+
+// HandleYAML serves GET /openapi.yaml.
+func (h *SpecHandler) HandleYAML(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", h.yamlDoc)
+}
+
+// renderSpecJSON encodes the document with its top-level fields in specKeyOrder.
+// Extension fields and anything unknown follow, sorted.
+func renderSpecJSON(doc *openapi3.T) ([]byte, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(fields))
+	for _, k := range specKeyOrder {
+		if _, ok := fields[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	var rest []string
+	for k := range fields {
+		if !contains(specKeyOrder, k) {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(k)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(fields[k])
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// renderSpecYAML re-encodes a JSON document as block-style YAML. Decoding into a
+// yaml.Node keeps mapping keys in document order, unlike a generic map.
+func renderSpecYAML(jsonDoc []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(jsonDoc, &node); err != nil {
+		return nil, err
+	}
+	clearStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// clearStyle drops the flow and quoting styles the JSON decoder recorded, so the
+// encoder falls back to block style and quotes scalars only where needed.
+func clearStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		clearStyle(child)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
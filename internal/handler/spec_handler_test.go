@@ -0,0 +1,143 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+
+	"github.com/hpn/hpn-g-router/internal/handler"
+	"github.com/hpn/hpn-g-router/internal/spec"
+)
+
+// requiredSpecPaths lists the routes every rendering of the spec must describe.
+var requiredSpecPaths = []string{
+	"/v1/chat/completions",
+	"/chat/completions",
+	"/v1/chat/completions/batch",
+	"/v1/embeddings",
+	"/v1/models",
+	"/health",
+	"/metrics",
+	"/admin/keys",
+	"/admin/keys/latency",
+	"/admin/keys/{name}/revive",
+	"/admin/keys/{name}/kill",
+	"/openapi.json",
+	"/openapi.yaml",
+}
+
+func newSpecRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	doc, err := spec.Build("test")
+	if err != nil {
+		t.Fatalf("spec.Build() error = %v", err)
+	}
+	h, err := handler.NewSpecHandler(doc)
+	if err != nil {
+		t.Fatalf("NewSpecHandler() error = %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/openapi.json", h.HandleJSON)
+	r.GET("/openapi.yaml", h.HandleYAML)
+	return r
+}
+
+func fetchSpec(t *testing.T, r *gin.Engine, path, contentType string) []byte {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", path, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, contentType) {
+		t.Errorf("GET %s Content-Type = %s, want %s", path, ct, contentType)
+	}
+	return w.Body.Bytes()
+}
+
+func TestSpecHandler_JSON(t *testing.T) {
+	body := fetchSpec(t, newSpecRouter(t), "/openapi.json", "application/json")
+
+	var doc struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.0") {
+		t.Errorf("openapi = %s, want 3.0.x", doc.OpenAPI)
+	}
+	for _, p := range requiredSpecPaths {
+		if _, ok := doc.Paths[p]; !ok {
+			t.Errorf("JSON paths missing %s", p)
+		}
+	}
+}
+
+func TestSpecHandler_YAML(t *testing.T) {
+	body := fetchSpec(t, newSpecRouter(t), "/openapi.yaml", "application/yaml")
+
+	var doc struct {
+		OpenAPI string                 `yaml:"openapi"`
+		Paths   map[string]interface{} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("response is not valid YAML: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.0") {
+		t.Errorf("openapi = %s, want 3.0.x", doc.OpenAPI)
+	}
+	for _, p := range requiredSpecPaths {
+		if _, ok := doc.Paths[p]; !ok {
+			t.Errorf("YAML paths missing %s", p)
+		}
+	}
+}
+
+func TestSpecHandler_KeyOrder(t *testing.T) {
+	r := newSpecRouter(t)
+	jsonBody := fetchSpec(t, r, "/openapi.json", "application/json")
+	yamlBody := fetchSpec(t, r, "/openapi.yaml", "application/yaml")
+
+	want := []string{"openapi", "info", "paths", "components"}
+
+	var jsonNode, yamlNode yaml.Node
+	if err := yaml.Unmarshal(jsonBody, &jsonNode); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if err := yaml.Unmarshal(yamlBody, &yamlNode); err != nil {
+		t.Fatalf("decode YAML: %v", err)
+	}
+
+	for name, node := range map[string]*yaml.Node{"JSON": &jsonNode, "YAML": &yamlNode} {
+		got := topLevelKeys(node)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s top-level keys = %v, want %v", name, got, want)
+		}
+	}
+
+	// Response codes are keys like "200"; they must stay strings in YAML.
+	if !strings.Contains(string(yamlBody), `"200":`) {
+		t.Error(`YAML response codes are not quoted, want "200":`)
+	}
+}
+
+func topLevelKeys(doc *yaml.Node) []string {
+	root := doc.Content[0]
+	keys := make([]string, 0, len(root.Content)/2)
+	for i := 0; i < len(root.Content); i += 2 {
+		keys = append(keys, root.Content[i].Value)
+	}
+	return keys
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TTFTKey is the gin context key holding a streamed response's time to
+// first token, as a time.Duration: from the start of HandleChatCompletion
+// until the first data: chunk was written. It is unset for JSON responses.
+const TTFTKey = "ttft"
+
+// firstTokenWriter stores the time from start until the first data: chunk
+// written through it under TTFTKey.
+type firstTokenWriter struct {
+	gin.ResponseWriter
+	c     *gin.Context
+	start time.Time
+	done  bool
+}
+
+// recordFirstToken wraps c.Writer to record the time to first token of the
+// event stream written next.
+func recordFirstToken(c *gin.Context, start time.Time) {
+	c.Writer = &firstTokenWriter{ResponseWriter: c.Writer, c: c, start: start}
+}
+
+func (w *firstTokenWriter) Write(b []byte) (int, error) {
+	w.observe(string(b))
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *firstTokenWriter) WriteString(s string) (int, error) {
+	w.observe(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *firstTokenWriter) observe(chunk string) {
+	if !w.done && strings.HasPrefix(chunk, "data:") {
+		w.done = true
+		w.c.Set(TTFTKey, time.Since(w.start))
+	}
+}
+
+// requestTTFT returns the time to first token stored under TTFTKey, or 0
+// when the response was not streamed.
+func requestTTFT(c *gin.Context) time.Duration {
+	if v, ok := c.Get(TTFTKey); ok {
+		if d, ok := v.(time.Duration); ok {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestHandleChatCompletion_TTFT(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hi"}],"role":"model"},"finishReason":"STOP"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantTTFT bool
+	}{
+		{"stream", `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`, true},
+		{"json", `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewProxyHandler(domain.NewMockKeyManager(testProxyKey), nil,
+				WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+				WithAdapterOptions(adapter.WithBaseURL(server.URL)),
+			)
+			var logs bytes.Buffer
+			var ttft any
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil))), func(c *gin.Context) {
+				c.Next()
+				ttft, _ = c.Get(TTFTKey)
+			})
+			r.POST("/v1/chat/completions", h.HandleChatCompletion)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body.String())
+			}
+
+			var entry map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log is not JSON: %v: %s", err, logs.String())
+			}
+			if !tt.wantTTFT {
+				if ttft != nil {
+					t.Errorf("ttft = %v, want unset for a JSON response", ttft)
+				}
+				if _, ok := entry["ttft"]; ok {
+					t.Errorf("log has ttft %v, want none for a JSON response", entry["ttft"])
+				}
+				return
+			}
+
+			d, ok := ttft.(time.Duration)
+			if !ok {
+				t.Fatalf("ttft = %#v, want a time.Duration", ttft)
+			}
+			if d < 40*time.Millisecond || d > 100*time.Millisecond {
+				t.Errorf("ttft = %v, want between 40ms and 100ms", d)
+			}
+			if logged, _ := entry["ttft"].(float64); time.Duration(logged) != d {
+				t.Errorf("logged ttft = %v, want %v", entry["ttft"], d)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserIDHeader names the end user a request is made for, for per-user
+// billing. Requests without it are attributed to the client IP.
+const UserIDHeader = "X-User-ID"
+
+// DefaultTopUsers is how many users GET /admin/usage/users lists when no
+// limit is given.
+const DefaultTopUsers = 10
+
+// DefaultMaxTrackedUsers is how many users a UserUsageTracker keeps counters
+// for. X-User-ID is chosen by the client, so the number of users seen is
+// otherwise unbounded.
+const DefaultMaxTrackedUsers = 10000
+
+// UserUsage is the usage counted for one end user since startup or the last reset.
+type UserUsage struct {
+	// TotalTokens is the estimated input plus output tokens.
+	TotalTokens int64 `json:"total_tokens"`
+
+	// TotalRequests is the number of successful proxied requests.
+	TotalRequests int64 `json:"total_requests"`
+
+	// TotalCostUSD is the estimated cost of those tokens.
+	TotalCostUSD float64 `json:"total_cost_usd"`
+}
+
+// UserUsageEntry is a user's usage as listed by GET /admin/usage/users.
+type UserUsageEntry struct {
+	// UserID is the X-User-ID the requests carried, or the client IP.
+	UserID string `json:"user_id"`
+
+	UserUsage
+}
+
+// UserUsageTracker counts tokens, requests and cost per end user.
+type UserUsageTracker struct {
+	mu       sync.Mutex
+	users    map[string]*UserUsage
+	maxUsers int
+}
+
+// UserUsageTrackerOption is a functional option for configuring UserUsageTracker.
+type UserUsageTrackerOption func(*UserUsageTracker)
+
+// WithMaxTrackedUsers sets how many users are tracked. When a new user
+// arrives at the limit, the user with the fewest tokens is dropped, so the
+// heaviest users stay billable. Non-positive values keep
+// DefaultMaxTrackedUsers.
+func WithMaxTrackedUsers(n int) UserUsageTrackerOption {
+	return func(t *UserUsageTracker) {
+		if n > 0 {
+			t.maxUsers = n
+		}
+	}
+}
+
+// NewUserUsageTracker returns an empty tracker.
+func NewUserUsageTracker(opts ...UserUsageTrackerOption) *UserUsageTracker {
+	t := &UserUsageTracker{
+		users:    make(map[string]*UserUsage),
+		maxUsers: DefaultMaxTrackedUsers,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// RecordRequest counts one request for userID and its estimated tokens.
+func (t *UserUsageTracker) RecordRequest(userID string, inputTokens, outputTokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.users[userID]
+	if !ok {
+		if len(t.users) >= t.maxUsers {
+			t.evictLowest()
+		}
+		u = &UserUsage{}
+		t.users[userID] = u
+	}
+	u.TotalRequests++
+	u.TotalTokens += int64(inputTokens + outputTokens)
+	u.TotalCostUSD += CalculateCost(inputTokens, outputTokens)
+}
+
+// evictLowest drops the user with the fewest tokens, ties broken by the
+// larger user ID so the choice does not depend on map order. t.mu must be
+// held.
+func (t *UserUsageTracker) evictLowest() {
+	var (
+		lowest string
+		fewest *UserUsage
+	)
+	for id, u := range t.users {
+		if fewest == nil || u.TotalTokens < fewest.TotalTokens ||
+			(u.TotalTokens == fewest.TotalTokens && id > lowest) {
+			lowest, fewest = id, u
+		}
+	}
+	if fewest != nil {
+		delete(t.users, lowest)
+	}
+}
+
+// Usage returns userID's counters and whether any were recorded.
+func (t *UserUsageTracker) Usage(userID string) (UserUsage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.users[userID]
+	if !ok {
+		return UserUsage{}, false
+	}
+	return *u, true
+}
+
+// TopUsers returns up to n users with the most tokens, ties broken by user
+// ID. A non-positive n returns every user.
+func (t *UserUsageTracker) TopUsers(n int) []UserUsageEntry {
+	t.mu.Lock()
+	entries := make([]UserUsageEntry, 0, len(t.users))
+	for id, u := range t.users {
+		entries = append(entries, UserUsageEntry{UserID: id, UserUsage: *u})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].TotalTokens != entries[j].TotalTokens {
+			return entries[i].TotalTokens > entries[j].TotalTokens
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// Reset clears userID's counters, returning them and whether it had any.
+func (t *UserUsageTracker) Reset(userID string) (UserUsage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.users[userID]
+	if !ok {
+		return UserUsage{}, false
+	}
+	delete(t.users, userID)
+	return *u, true
+}
+
+// requestUserID returns the user a request is made for: its X-User-ID
+// header, or the client IP when the header is missing.
+func requestUserID(c *gin.Context) string {
+	if id := strings.TrimSpace(c.GetHeader(UserIDHeader)); id != "" {
+		return id
+	}
+	return clientIP(c)
+}
+
+// requestTokens returns the estimated input and output tokens of a request
+// the proxy handlers served from upstream, and false for any other request.
+func requestTokens(c *gin.Context) (input, output int, ok bool) {
+	if m, found := c.Get("cost_metrics"); found {
+		if cm, isCost := m.(CostMetrics); isCost {
+			return cm.InputTokens, cm.OutputTokens, true
+		}
+	}
+	if n, found := c.Get("prompt_tokens"); found {
+		input, ok = n.(int)
+	}
+	return input, 0, ok
+}
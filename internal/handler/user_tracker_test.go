@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestUserUsageTracker_PerUserBreakdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	tracker := NewUserUsageTracker()
+	r := gin.New()
+	r.Use(LoggingMiddleware(slog.New(slog.NewTextHandler(&logs, nil)), WithUserUsageTracker(tracker)))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.Set("cost_metrics", CostMetrics{InputTokens: 100, OutputTokens: 50})
+		c.Status(http.StatusOK)
+	})
+	r.POST("/v1/embeddings", func(c *gin.Context) {
+		c.Set("prompt_tokens", 20)
+		c.Status(http.StatusOK)
+	})
+	r.POST("/fail", func(c *gin.Context) {
+		c.Set("cost_metrics", CostMetrics{InputTokens: 100})
+		c.Status(http.StatusServiceUnavailable)
+	})
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	requests := []struct {
+		method, path, user string
+	}{
+		{http.MethodPost, "/v1/chat/completions", "alice@example.com"},
+		{http.MethodPost, "/v1/chat/completions", "alice@example.com"},
+		{http.MethodPost, "/v1/embeddings", "alice@example.com"},
+		{http.MethodPost, "/v1/chat/completions", "bob"},
+		{http.MethodPost, "/fail", "bob"},
+		{http.MethodGet, "/health", "bob"},
+		{http.MethodPost, "/v1/embeddings", ""},
+	}
+	for _, rq := range requests {
+		req := httptest.NewRequest(rq.method, rq.path, nil)
+		req.RemoteAddr = "192.0.2.7:4321"
+		if rq.user != "" {
+			req.Header.Set(UserIDHeader, rq.user)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		user         string
+		wantTokens   int64
+		wantRequests int64
+	}{
+		{"alice@example.com", 320, 3},
+		{"bob", 150, 1},
+		{"192.0.2.7", 20, 1},
+	}
+	for _, tt := range tests {
+		u, ok := tracker.Usage(tt.user)
+		if !ok {
+			t.Errorf("Usage(%s) not recorded", tt.user)
+			continue
+		}
+		if u.TotalTokens != tt.wantTokens || u.TotalRequests != tt.wantRequests {
+			t.Errorf("Usage(%s) = %d tokens, %d requests, want %d, %d",
+				tt.user, u.TotalTokens, u.TotalRequests, tt.wantTokens, tt.wantRequests)
+		}
+		if u.TotalCostUSD <= 0 {
+			t.Errorf("Usage(%s).TotalCostUSD = %v, want > 0", tt.user, u.TotalCostUSD)
+		}
+	}
+
+	top := tracker.TopUsers(2)
+	if len(top) != 2 || top[0].UserID != "alice@example.com" || top[1].UserID != "bob" {
+		t.Errorf("TopUsers(2) = %+v, want alice@example.com then bob", top)
+	}
+
+	if strings.Contains(logs.String(), "alice@example.com") {
+		t.Errorf("logs contain an email user ID in plain text:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "user_id=bob") {
+		t.Errorf("logs missing user_id=bob:\n%s", logs.String())
+	}
+}
+
+func TestUserUsageTracker_MaxTrackedUsers(t *testing.T) {
+	tracker := NewUserUsageTracker(WithMaxTrackedUsers(3))
+	tracker.RecordRequest("alice", 500, 0)
+	tracker.RecordRequest("bob", 10, 0)
+	tracker.RecordRequest("carol", 200, 0)
+
+	// Client-chosen IDs beyond the limit replace the lightest user each time.
+	for i := range 100 {
+		tracker.RecordRequest(fmt.Sprintf("spoofed-%d", i), 1, 0)
+	}
+
+	if got := len(tracker.TopUsers(0)); got != 3 {
+		t.Errorf("tracked users = %d, want 3", got)
+	}
+	for _, id := range []string{"alice", "carol"} {
+		if _, ok := tracker.Usage(id); !ok {
+			t.Errorf("%s dropped, want the heaviest users kept", id)
+		}
+	}
+	if _, ok := tracker.Usage("bob"); ok {
+		t.Error("bob still tracked, want the lightest user dropped")
+	}
+	if _, ok := tracker.Usage("spoofed-99"); !ok {
+		t.Error("newest user not tracked")
+	}
+
+	// An existing user is updated in place and drops nobody.
+	tracker.RecordRequest("alice", 1, 0)
+	if _, ok := tracker.Usage("carol"); !ok {
+		t.Error("carol dropped by a request from a tracked user")
+	}
+}
+
+func TestAdminHandler_UserUsage(t *testing.T) {
+	tracker := NewUserUsageTracker()
+	tracker.RecordRequest("alice", 10, 0)
+	tracker.RecordRequest("bob", 300, 100)
+	tracker.RecordRequest("carol", 50, 50)
+	km := domain.NewKeyManager([]string{"AIzaSyFirstKey000000001"}, 0)
+	r := newAdminRouter(km, WithAdminUserUsageTracker(tracker))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(AdminTokenHeader, testAdminToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/admin/usage/users?limit=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /admin/usage/users status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp UserUsageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Users) != 2 || resp.Users[0].UserID != "bob" || resp.Users[1].UserID != "carol" {
+		t.Errorf("users = %+v, want bob then carol", resp.Users)
+	}
+	if resp.Users[0].TotalTokens != 400 {
+		t.Errorf("bob total_tokens = %d, want 400", resp.Users[0].TotalTokens)
+	}
+
+	if w := do(http.MethodGet, "/admin/usage/users?limit=0"); w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0 status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	if w := do(http.MethodDelete, "/admin/usage/users/bob"); w.Code != http.StatusOK {
+		t.Errorf("DELETE bob status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if _, ok := tracker.Usage("bob"); ok {
+		t.Error("bob's usage still recorded after reset")
+	}
+	if _, ok := tracker.Usage("alice"); !ok {
+		t.Error("alice's usage cleared by resetting bob")
+	}
+	if w := do(http.MethodDelete, "/admin/usage/users/bob"); w.Code != http.StatusNotFound {
+		t.Errorf("second DELETE bob status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
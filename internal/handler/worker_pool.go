@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+)
+
+// WorkerPool runs jobs on a fixed number of goroutines. Up to size jobs may
+// wait for a free worker; Submit rejects further jobs instead of blocking.
+type WorkerPool struct {
+	jobs     chan func()
+	size     int
+	active   atomic.Int64
+	rejected atomic.Int64
+	wg       sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWorkerPool starts size workers. size must be at least 1.
+func NewWorkerPool(size int) *WorkerPool {
+	if size < 1 {
+		size = 1
+	}
+	p := &WorkerPool{jobs: make(chan func(), size), size: size}
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		p.active.Add(1)
+		job()
+		p.active.Add(-1)
+	}
+}
+
+// Submit queues job and reports whether it was accepted. It returns false
+// when the queue is full or the pool is closed.
+func (p *WorkerPool) Submit(job func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.rejected.Add(1)
+		return false
+	}
+
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		p.rejected.Add(1)
+		return false
+	}
+}
+
+// Stats returns how many jobs are running and how many wait for a worker.
+func (p *WorkerPool) Stats() (active, queued int) {
+	return int(p.active.Load()), len(p.jobs)
+}
+
+// Size returns the number of workers.
+func (p *WorkerPool) Size() int {
+	return p.size
+}
+
+// Rejected returns how many jobs Submit has turned away.
+func (p *WorkerPool) Rejected() int64 {
+	return p.rejected.Load()
+}
+
+// Close stops accepting jobs, lets queued ones finish and waits for every
+// worker to exit.
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// WorkerPoolMiddleware runs the rest of the handler chain on pool, so the
+// number of requests doing work is bounded by the pool size rather than by
+// the number of connections. When the pool is full the request is answered
+// with 503. A panic in the chain is re-raised on the request goroutine so
+// RecoveryMiddleware still handles it.
+func WorkerPoolMiddleware(pool *WorkerPool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done := make(chan any, 1)
+		job := func() {
+			defer func() { done <- recover() }()
+			c.Next()
+		}
+
+		if !pool.Submit(job) {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, adapter.OpenAIError{
+				Error: adapter.OpenAIErrorDetail{
+					Message: "server is at capacity, retry later",
+					Type:    "server_error",
+				},
+			})
+			return
+		}
+
+		if p := <-done; p != nil {
+			panic(p)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/goleak"
+)
+
+// newPooledRouter serves GET /work through pool; the handler blocks until
+// release is closed when one is given.
+func newPooledRouter(pool *WorkerPool, release chan struct{}) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RecoveryMiddleware(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	r.GET("/work", WorkerPoolMiddleware(pool), func(c *gin.Context) {
+		if release != nil {
+			<-release
+		}
+		c.String(http.StatusOK, "done")
+	})
+	r.GET("/panic", WorkerPoolMiddleware(pool), func(c *gin.Context) {
+		panic("boom")
+	})
+	return r
+}
+
+func getPooled(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestWorkerPoolMiddleware_Serves(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	pool := NewWorkerPool(4)
+	r := newPooledRouter(pool, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The pool may be momentarily full; only 200 and 503 are valid.
+			if w := getPooled(r, "/work"); w.Code != http.StatusOK && w.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want 200 or 503", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	pool.Close()
+}
+
+func TestWorkerPoolMiddleware_FullPoolRejects(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	release := make(chan struct{})
+	pool := NewWorkerPool(1)
+	r := newPooledRouter(pool, release)
+
+	// One request runs and one waits in the queue.
+	results := make(chan int, 2)
+	go func() { results <- getPooled(r, "/work").Code }()
+	waitForStats(t, pool, 1, 0)
+	go func() { results <- getPooled(r, "/work").Code }()
+	waitForStats(t, pool, 1, 1)
+
+	w := getPooled(r, "/work")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status with a full pool = %d, want 503", w.Code)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-results; code != http.StatusOK {
+			t.Errorf("accepted request status = %d, want 200", code)
+		}
+	}
+
+	pool.Close()
+	if active, queued := pool.Stats(); active != 0 || queued != 0 {
+		t.Errorf("Stats() after Close = (%d, %d), want (0, 0)", active, queued)
+	}
+}
+
+func TestWorkerPoolMiddleware_PanicRecovered(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	pool := NewWorkerPool(1)
+	r := newPooledRouter(pool, nil)
+
+	if w := getPooled(r, "/panic"); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500 from RecoveryMiddleware", w.Code)
+	}
+	// The worker survives the panic.
+	if w := getPooled(r, "/work"); w.Code != http.StatusOK {
+		t.Errorf("status after panic = %d, want 200", w.Code)
+	}
+	pool.Close()
+}
+
+func TestWorkerPool_SubmitAfterClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	pool := NewWorkerPool(2)
+	pool.Close()
+	if pool.Submit(func() {}) {
+		t.Error("Submit() after Close = true, want false")
+	}
+	pool.Close() // idempotent
+}
+
+// waitForStats waits until pool reports the given active and queued counts.
+func waitForStats(t *testing.T, pool *WorkerPool, active, queued int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		a, q := pool.Stats()
+		if a == active && q == queued {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats() = (%d, %d), want (%d, %d)", a, q, active, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
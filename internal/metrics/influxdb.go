@@ -0,0 +1,228 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// DefaultInfluxFlushInterval is how often a point is written when no interval is set.
+const DefaultInfluxFlushInterval = 10 * time.Second
+
+// UsageTotals are cumulative usage counters sampled on every flush.
+type UsageTotals struct {
+	Requests  int64
+	TokensIn  int64
+	TokensOut int64
+	CostUSD   float64
+}
+
+// UsageSource returns the current usage totals.
+type UsageSource func() UsageTotals
+
+// InfluxDBReporter writes one line-protocol point to an InfluxDB v2 bucket
+// per flush interval. Key counts are sampled as gauges; requests, tokens and
+// cost are written as the change since the previous point, requests as a
+// per-second rate. A failed write is logged and the next interval tries again.
+type InfluxDBReporter struct {
+	writeURL string
+	token    string
+	km       *domain.KeyManager
+	usage    UsageSource
+	interval time.Duration
+	tags     map[string]string
+	client   *http.Client
+	logger   *slog.Logger
+
+	mu       sync.Mutex // guards last and lastTime
+	last     UsageTotals
+	lastTime time.Time
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// InfluxDBOption configures an InfluxDBReporter.
+type InfluxDBOption func(*InfluxDBReporter)
+
+// WithFlushInterval sets how often a point is written.
+func WithFlushInterval(d time.Duration) InfluxDBOption {
+	return func(r *InfluxDBReporter) {
+		if d > 0 {
+			r.interval = d
+		}
+	}
+}
+
+// WithInfluxTag adds a tag to every point. The host tag defaults to the
+// machine's hostname.
+func WithInfluxTag(key, value string) InfluxDBOption {
+	return func(r *InfluxDBReporter) { r.tags[key] = value }
+}
+
+// WithInfluxHTTPClient sets the client used for writes.
+func WithInfluxHTTPClient(c *http.Client) InfluxDBOption {
+	return func(r *InfluxDBReporter) { r.client = c }
+}
+
+// WithInfluxLogger sets the logger.
+func WithInfluxLogger(l *slog.Logger) InfluxDBOption {
+	return func(r *InfluxDBReporter) { r.logger = l }
+}
+
+// NewInfluxDBReporter returns a reporter writing to bucket in org at the
+// InfluxDB server baseURL, authenticated with token. Call Start to begin.
+func NewInfluxDBReporter(baseURL, org, bucket, token string, km *domain.KeyManager, usage UsageSource, opts ...InfluxDBOption) *InfluxDBReporter {
+	q := url.Values{}
+	q.Set("org", org)
+	q.Set("bucket", bucket)
+	q.Set("precision", "ns")
+
+	r := &InfluxDBReporter{
+		writeURL: strings.TrimSuffix(baseURL, "/") + "/api/v2/write?" + q.Encode(),
+		token:    token,
+		km:       km,
+		usage:    usage,
+		interval: DefaultInfluxFlushInterval,
+		tags:     map[string]string{},
+		client:   &http.Client{Timeout: 5 * time.Second},
+		logger:   slog.Default(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if host, err := os.Hostname(); err == nil {
+		r.tags["host"] = host
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Start writes a point every flush interval from a background goroutine
+// until Stop is called.
+func (r *InfluxDBReporter) Start() {
+	r.mu.Lock()
+	r.last = r.usage()
+	r.lastTime = time.Now()
+	r.mu.Unlock()
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Flush(context.Background())
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background writes and waits for an in-flight one to finish.
+func (r *InfluxDBReporter) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+// Flush writes one point now. Errors are logged, not returned, so an
+// unreachable InfluxDB never affects the router.
+func (r *InfluxDBReporter) Flush(ctx context.Context) {
+	now := time.Now()
+	line := r.point(now)
+
+	if err := r.write(ctx, line); err != nil {
+		r.logger.Warn("influxdb write failed", slog.String("error", err.Error()))
+	}
+}
+
+// point builds the line for now and advances the usage baseline.
+func (r *InfluxDBReporter) point(now time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cur := r.usage()
+	elapsed := now.Sub(r.lastTime).Seconds()
+	rps := 0.0
+	if elapsed > 0 {
+		rps = float64(cur.Requests-r.last.Requests) / elapsed
+	}
+
+	fields := fmt.Sprintf("active_keys=%di,dead_keys=%di,requests_per_second=%s,tokens_in=%di,tokens_out=%di,cost_usd=%s",
+		r.km.ActiveKeyCount(),
+		r.km.DeadKeyCount(),
+		formatFloat(rps),
+		cur.TokensIn-r.last.TokensIn,
+		cur.TokensOut-r.last.TokensOut,
+		formatFloat(cur.CostUSD-r.last.CostUSD),
+	)
+	r.last, r.lastTime = cur, now
+
+	return fmt.Sprintf("%s%s %s %d", Namespace, r.tagSet(), fields, now.UnixNano())
+}
+
+// tagSet renders ",k=v" pairs sorted by key, as InfluxDB recommends.
+func (r *InfluxDBReporter) tagSet() string {
+	keys := make([]string, 0, len(r.tags))
+	for k, v := range r.tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(escapeTag(k))
+		b.WriteByte('=')
+		b.WriteString(escapeTag(r.tags[k]))
+	}
+	return b.String()
+}
+
+func (r *InfluxDBReporter) write(ctx context.Context, line string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.writeURL, bytes.NewBufferString(line+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+r.token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("influxdb returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// tagEscaper escapes the characters line protocol reserves in tag keys and values.
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func escapeTag(s string) string {
+	return tagEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// influxWrite is one request captured by the mock InfluxDB.
+type influxWrite struct {
+	query map[string]string
+	auth  string
+	body  string
+}
+
+func newMockInfluxDB(t *testing.T, status int) (*httptest.Server, func() []influxWrite) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var writes []influxWrite
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" {
+			t.Errorf("path = %s, want /api/v2/write", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		q := r.URL.Query()
+
+		mu.Lock()
+		writes = append(writes, influxWrite{
+			query: map[string]string{"org": q.Get("org"), "bucket": q.Get("bucket"), "precision": q.Get("precision")},
+			auth:  r.Header.Get("Authorization"),
+			body:  string(body),
+		})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []influxWrite {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]influxWrite(nil), writes...)
+	}
+}
+
+// usageCounter is a UsageSource the test advances by hand.
+type usageCounter struct {
+	mu sync.Mutex
+	t  UsageTotals
+}
+
+func (u *usageCounter) get() UsageTotals {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.t
+}
+
+func (u *usageCounter) add(requests, in, out int64, cost float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.t.Requests += requests
+	u.t.TokensIn += in
+	u.t.TokensOut += out
+	u.t.CostUSD += cost
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// linePattern is the full point: measurement, sorted tags, typed fields, ns timestamp.
+var linePattern = regexp.MustCompile(`^hpn_router,host=router\\ 1,strategy=round-robin ` +
+	`active_keys=(\d+)i,dead_keys=(\d+)i,requests_per_second=([\d.]+),tokens_in=(\d+)i,tokens_out=(\d+)i,cost_usd=([\d.e-]+) (\d{19})\n$`)
+
+func TestInfluxDBReporter_LineProtocol(t *testing.T) {
+	server, writes := newMockInfluxDB(t, http.StatusNoContent)
+
+	km := domain.NewKeyManager([]string{"key1", "key2", "key3"}, time.Hour)
+	km.MarkAsDead("key3", "")
+	usage := &usageCounter{}
+
+	r := NewInfluxDBReporter(server.URL, "acme", "router", "secret-token", km, usage.get,
+		WithInfluxTag("host", "router 1"),
+		WithInfluxTag("strategy", "round-robin"),
+		WithInfluxLogger(discardLogger),
+	)
+	r.Start()
+	r.Stop()
+
+	usage.add(10, 1300, 2600, 0.0045)
+	r.Flush(context.Background())
+
+	got := writes()
+	if len(got) != 1 {
+		t.Fatalf("writes = %d, want 1", len(got))
+	}
+	w := got[0]
+	if w.query["org"] != "acme" || w.query["bucket"] != "router" || w.query["precision"] != "ns" {
+		t.Errorf("query = %v, want org=acme bucket=router precision=ns", w.query)
+	}
+	if w.auth != "Token secret-token" {
+		t.Errorf("Authorization = %q, want Token secret-token", w.auth)
+	}
+
+	m := linePattern.FindStringSubmatch(w.body)
+	if m == nil {
+		t.Fatalf("line = %q, does not match line protocol %s", w.body, linePattern)
+	}
+	want := map[int]string{1: "2", 2: "1", 4: "1300", 5: "2600", 6: "0.0045"}
+	for i, v := range want {
+		if m[i] != v {
+			t.Errorf("field %d = %s, want %s in %q", i, m[i], v, w.body)
+		}
+	}
+	if m[3] == "0" {
+		t.Errorf("requests_per_second = 0, want a positive rate after 10 requests")
+	}
+}
+
+func TestInfluxDBReporter_WritesDeltas(t *testing.T) {
+	server, writes := newMockInfluxDB(t, http.StatusNoContent)
+	km := domain.NewKeyManager([]string{"key1"}, time.Hour)
+	usage := &usageCounter{}
+	usage.add(100, 5000, 5000, 1) // before Start: not reported
+
+	r := NewInfluxDBReporter(server.URL, "acme", "router", "t", km, usage.get,
+		WithInfluxTag("host", "router 1"),
+		WithInfluxTag("strategy", "round-robin"),
+		WithInfluxLogger(discardLogger),
+	)
+	r.Start()
+	r.Stop()
+
+	r.Flush(context.Background())
+	usage.add(1, 7, 9, 0.5)
+	r.Flush(context.Background())
+
+	got := writes()
+	if len(got) != 2 {
+		t.Fatalf("writes = %d, want 2", len(got))
+	}
+	for i, want := range []string{"tokens_in=0i,tokens_out=0i,cost_usd=0 ", "tokens_in=7i,tokens_out=9i,cost_usd=0.5 "} {
+		if !strings.Contains(got[i].body, want) {
+			t.Errorf("write %d = %q, want %q", i, got[i].body, want)
+		}
+	}
+}
+
+func TestInfluxDBReporter_FlushesOnInterval(t *testing.T) {
+	server, writes := newMockInfluxDB(t, http.StatusNoContent)
+	km := domain.NewKeyManager([]string{"key1"}, time.Hour)
+
+	r := NewInfluxDBReporter(server.URL, "acme", "router", "t", km, (&usageCounter{}).get,
+		WithFlushInterval(10*time.Millisecond),
+		WithInfluxLogger(discardLogger),
+	)
+	r.Start()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(writes()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	r.Stop()
+
+	if n := len(writes()); n < 2 {
+		t.Errorf("writes = %d, want at least 2 on a 10ms interval", n)
+	}
+}
+
+func TestInfluxDBReporter_UnreachableIsNonFatal(t *testing.T) {
+	tests := []struct {
+		name string
+		url  func(t *testing.T) string
+	}{
+		{"error status", func(t *testing.T) string {
+			server, _ := newMockInfluxDB(t, http.StatusUnauthorized)
+			return server.URL
+		}},
+		{"connection refused", func(t *testing.T) string { return "http://127.0.0.1:1" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs strings.Builder
+			km := domain.NewKeyManager([]string{"key1"}, time.Hour)
+			r := NewInfluxDBReporter(tt.url(t), "acme", "router", "t", km, (&usageCounter{}).get,
+				WithInfluxLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+			)
+
+			r.Flush(context.Background())
+
+			if !strings.Contains(logs.String(), "influxdb write failed") {
+				t.Errorf("logs = %q, want the write failure logged", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+// Package metrics exposes router and key pool metrics in Prometheus format.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/handler"
+)
+
+// Namespace prefixes every metric exported by the router.
+const Namespace = "hpn_router"
+
+// sizeBuckets are the bucket boundaries, in bytes, of the request and
+// response size histograms.
+var sizeBuckets = []float64{512, 1024, 4096, 16384, 65536, 262144}
+
+// ttftBuckets are the bucket boundaries, in seconds, of the time to first
+// token histogram.
+var ttftBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30}
+
+// Metrics owns the Prometheus registry and the collectors recorded by the router.
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	reqSize  *prometheus.HistogramVec
+	respSize *prometheus.HistogramVec
+	ttft     *prometheus.HistogramVec
+	slow     *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	panics   prometheus.Counter
+}
+
+// New creates a registry with HTTP request metrics, key pool gauges read from km,
+// and the standard Go runtime and process collectors.
+func New(km *domain.KeyManager) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "requests_total",
+			Help:      "HTTP requests handled, by method, route and status code.",
+		}, []string{"method", "path", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency, by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "path"}),
+		reqSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "request_bytes",
+			Help:      "HTTP request body size in bytes, by method and route.",
+			Buckets:   sizeBuckets,
+		}, []string{"method", "path"}),
+		respSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "response_bytes",
+			Help:      "HTTP response body size in bytes, by method and route.",
+			Buckets:   sizeBuckets,
+		}, []string{"method", "path"}),
+		ttft: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "stream_first_token_seconds",
+			Help:      "Time from receiving a streamed chat completion until its first chunk is sent, by model.",
+			Buckets:   ttftBuckets,
+		}, []string{"model"}),
+		slow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "slow_requests_total",
+			Help:      "Requests slower than logging.slow_request_threshold_seconds, by model.",
+		}, []string{"model"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "provider_errors_total",
+			Help:      "Failed provider calls, by error class such as rate_limit or timeout.",
+		}, []string{"error_class"}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "panics_recovered_total",
+			Help:      "Panics recovered while handling a request.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.reqSize,
+		m.respSize,
+		m.ttft,
+		m.slow,
+		m.errors,
+		m.panics,
+		newKeyPoolCollector(km),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "cost_estimation_dropped_total",
+			Help:      "Requests estimated before responding because the async cost queue was full.",
+		}, func() float64 { return float64(handler.CostEstimationDroppedCount()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "provider_timeouts_total",
+			Help:      "Provider calls that timed out and were retried with the next key.",
+		}, func() float64 { return float64(handler.ProviderTimeoutCount()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "client_disconnects_total",
+			Help:      "Requests whose client disconnected before the response was written.",
+		}, func() float64 { return float64(handler.ClientDisconnectCount()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "low_keys_warnings_total",
+			Help:      "Times a dead key left the active keys at or below the minimum threshold.",
+		}, func() float64 { return float64(km.LowKeyWarnings()) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// keyPoolCollector exports the active, dead and total key gauges from one
+// KeyManager snapshot per scrape, so keys_active + keys_dead never exceeds
+// keys_total while keys die and are revived.
+type keyPoolCollector struct {
+	km     *domain.KeyManager
+	active *prometheus.Desc
+	dead   *prometheus.Desc
+	total  *prometheus.Desc
+}
+
+func newKeyPoolCollector(km *domain.KeyManager) *keyPoolCollector {
+	return &keyPoolCollector{
+		km:     km,
+		active: prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", "keys_active"), "API keys currently in rotation.", nil, nil),
+		dead:   prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", "keys_dead"), "API keys currently marked dead.", nil, nil),
+		total:  prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", "keys_total"), "API keys managed by the router.", nil, nil),
+	}
+}
+
+func (c *keyPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.dead
+	ch <- c.total
+}
+
+func (c *keyPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	states := c.km.GetAllKeyStates()
+	active, dead := domain.CountKeyStates(states)
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(active))
+	ch <- prometheus.MustNewConstMetric(c.dead, prometheus.GaugeValue, float64(dead))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(len(states)))
+}
+
+// Middleware records request count and latency, the request and response
+// sizes stored by handler.RequestSizeMiddleware when it runs after this one,
+// and the time to first token of streamed responses. Routes are labelled by their registered pattern so path
+// parameters don't explode label cardinality.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+
+		m.requests.WithLabelValues(c.Request.Method, path, strconv.Itoa(c.Writer.Status())).Inc()
+		m.duration.WithLabelValues(c.Request.Method, path).Observe(time.Since(start).Seconds())
+		if n, ok := c.Get(handler.RequestBytesKey); ok {
+			m.reqSize.WithLabelValues(c.Request.Method, path).Observe(float64(n.(int64)))
+			m.respSize.WithLabelValues(c.Request.Method, path).Observe(float64(c.GetInt64(handler.ResponseBytesKey)))
+		}
+		if d, ok := c.Get(handler.TTFTKey); ok {
+			m.ttft.WithLabelValues(c.GetString("model")).Observe(d.(time.Duration).Seconds())
+		}
+	}
+}
+
+// ObserveSlowRequest counts a slow request for model.
+func (m *Metrics) ObserveSlowRequest(model string) {
+	m.slow.WithLabelValues(model).Inc()
+}
+
+// ObserveProviderError counts a failed provider call of errorClass, one of
+// the handler.ErrorCategory constants.
+func (m *Metrics) ObserveProviderError(errorClass string) {
+	m.errors.WithLabelValues(errorClass).Inc()
+}
+
+// ObservePanic counts a panic recovered while handling a request.
+func (m *Metrics) ObservePanic() {
+	m.panics.Inc()
+}
+
+// SetBuildInfo exports hpn_router_build_info with the running version and
+// commit as labels and a constant value of 1.
+func (m *Metrics) SetBuildInfo(version, gitCommit string) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   Namespace,
+		Name:        "build_info",
+		Help:        "Router build information; always 1.",
+		ConstLabels: prometheus.Labels{"version": version, "git_commit": gitCommit},
+	}, func() float64 { return 1 }))
+}
+
+// ObserveWorkerPool exports the concurrency of pool: how many requests it
+// is running, how many it can run at once and how many it has rejected with
+// 503 for being at capacity.
+func (m *Metrics) ObserveWorkerPool(pool *handler.WorkerPool) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "concurrent_requests_active",
+			Help:      "Requests currently running on the worker pool.",
+		}, func() float64 {
+			active, _ := pool.Stats()
+			return float64(active)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "concurrent_requests_max",
+			Help:      "Requests the worker pool can run at once.",
+		}, func() float64 { return float64(pool.Size()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "concurrent_requests_rejected_total",
+			Help:      "Requests rejected with 503 because the worker pool was full.",
+		}, func() float64 { return float64(pool.Rejected()) }),
+	)
+}
+
+// Handler serves GET /metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/handler"
+)
+
+func newTestRouter(km *domain.KeyManager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	m := New(km)
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	r.GET("/metrics", m.Handler())
+	return r
+}
+
+func scrape(t *testing.T, r *gin.Engine) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %s, want text/plain", ct)
+	}
+	return w.Body.String()
+}
+
+func TestMetrics_KeyGauges(t *testing.T) {
+	km := domain.NewKeyManager([]string{"key-a", "key-b", "key-c"}, time.Minute)
+	km.MarkAsDead("key-b", "")
+
+	body := scrape(t, newTestRouter(km))
+
+	tests := []string{
+		"hpn_router_keys_active 2",
+		"hpn_router_keys_dead 1",
+		"hpn_router_keys_total 3",
+	}
+	for _, want := range tests {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestMetrics_LowKeyWarnings(t *testing.T) {
+	km := domain.NewKeyManager([]string{"key-a", "key-b", "key-c"}, time.Minute,
+		domain.WithMinActiveKeys(1),
+		domain.WithLogger(discardLogger),
+	)
+	r := newTestRouter(km)
+
+	steps := []struct {
+		name   string
+		change func()
+		want   string
+	}{
+		{"no warning yet", func() { km.MarkAsDead("key-a", "") }, "hpn_router_low_keys_warnings_total 0"},
+		{"first crossing", func() { km.MarkAsDead("key-b", "") }, "hpn_router_low_keys_warnings_total 1"},
+		{"recovered", func() { km.ReviveKey("key-a"); km.ReviveKey("key-b") }, "hpn_router_low_keys_warnings_total 1"},
+		{"second crossing", func() { km.MarkAsDead("key-a", ""); km.MarkAsDead("key-c", "") }, "hpn_router_low_keys_warnings_total 2"},
+	}
+	for _, s := range steps {
+		s.change()
+		if body := scrape(t, r); !strings.Contains(body, s.want) {
+			t.Errorf("%s: metrics missing %q", s.name, s.want)
+		}
+	}
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	r := newTestRouter(domain.NewKeyManager([]string{"key-a"}, 0))
+
+	for i := 0; i < 2; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	body := scrape(t, r)
+
+	tests := []string{
+		`hpn_router_requests_total{method="GET",path="/ping",status="200"} 2`,
+		`hpn_router_requests_total{method="GET",path="unmatched",status="404"} 1`,
+		`hpn_router_request_duration_seconds_count{method="GET",path="/ping"} 2`,
+	}
+	for _, want := range tests {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestMetrics_RequestSizes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := New(domain.NewKeyManager([]string{"key-a"}, 0))
+	r := gin.New()
+	r.Use(m.Middleware(), handler.RequestSizeMiddleware())
+	r.POST("/echo", func(c *gin.Context) {
+		io.Copy(io.Discard, c.Request.Body)
+		c.String(http.StatusOK, strings.Repeat("x", 2000))
+	})
+	r.GET("/metrics", m.Handler())
+
+	for _, n := range []int{100, 600} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("a", n))))
+	}
+
+	body := scrape(t, r)
+	tests := []string{
+		`hpn_router_request_bytes_bucket{method="POST",path="/echo",le="512"} 1`,
+		`hpn_router_request_bytes_bucket{method="POST",path="/echo",le="1024"} 2`,
+		`hpn_router_request_bytes_sum{method="POST",path="/echo"} 700`,
+		`hpn_router_response_bytes_bucket{method="POST",path="/echo",le="1024"} 0`,
+		`hpn_router_response_bytes_bucket{method="POST",path="/echo",le="4096"} 2`,
+		`hpn_router_response_bytes_bucket{method="POST",path="/echo",le="262144"} 2`,
+		`hpn_router_response_bytes_sum{method="POST",path="/echo"} 4000`,
+	}
+	for _, want := range tests {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestMetrics_StreamFirstToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := New(domain.NewKeyManager([]string{"key-a"}, 0))
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.POST("/stream", func(c *gin.Context) {
+		c.Set("model", "gemini-pro")
+		c.Set(handler.TTFTKey, 300*time.Millisecond)
+		c.String(http.StatusOK, "data: [DONE]\n\n")
+	})
+	r.GET("/metrics", m.Handler())
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/stream", nil))
+
+	body := scrape(t, r)
+	tests := []string{
+		`hpn_router_stream_first_token_seconds_bucket{model="gemini-pro",le="0.25"} 0`,
+		`hpn_router_stream_first_token_seconds_bucket{model="gemini-pro",le="0.5"} 1`,
+		`hpn_router_stream_first_token_seconds_count{model="gemini-pro"} 1`,
+	}
+	for _, want := range tests {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestMetrics_SlowRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := New(domain.NewKeyManager([]string{"key-a"}, time.Minute))
+	m.ObserveSlowRequest("gemini-pro")
+	m.ObserveSlowRequest("gemini-pro")
+	r := gin.New()
+	r.GET("/metrics", m.Handler())
+
+	if body := scrape(t, r); !strings.Contains(body, `hpn_router_slow_requests_total{model="gemini-pro"} 2`) {
+		t.Errorf("metrics missing slow request count:\n%s", body)
+	}
+}
+
+func TestMetrics_ProviderErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := New(domain.NewKeyManager([]string{"key-a"}, time.Minute))
+	m.ObserveProviderError(handler.ErrorCategoryRateLimit)
+	m.ObserveProviderError(handler.ErrorCategoryRateLimit)
+	m.ObserveProviderError(handler.ErrorCategoryTimeout)
+	r := gin.New()
+	r.GET("/metrics", m.Handler())
+
+	body := scrape(t, r)
+	for _, want := range []string{
+		`hpn_router_provider_errors_total{error_class="rate_limit"} 2`,
+		`hpn_router_provider_errors_total{error_class="timeout"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestMetrics_Panics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := New(domain.NewKeyManager([]string{"key-a"}, time.Minute))
+	m.ObservePanic()
+	r := gin.New()
+	r.GET("/metrics", m.Handler())
+
+	if body := scrape(t, r); !strings.Contains(body, "hpn_router_panics_recovered_total 1") {
+		t.Errorf("metrics missing panic count:\n%s", body)
+	}
+}
+
+func TestMetrics_WorkerPool(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	pool := handler.NewWorkerPool(1)
+	t.Cleanup(pool.Close)
+	m := New(domain.NewKeyManager([]string{"key-a"}, time.Minute))
+	m.ObserveWorkerPool(pool)
+	r := gin.New()
+	r.GET("/metrics", m.Handler())
+
+	started, release := make(chan struct{}), make(chan struct{})
+	pool.Submit(func() { close(started); <-release })
+	<-started
+	pool.Submit(func() {})
+	if pool.Submit(func() {}) {
+		t.Fatal("Submit accepted a job beyond the queue")
+	}
+
+	body := scrape(t, r)
+	close(release)
+	for _, want := range []string{
+		"hpn_router_concurrent_requests_active 1",
+		"hpn_router_concurrent_requests_max 1",
+		"hpn_router_concurrent_requests_rejected_total 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetrics_BuildInfo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := New(domain.NewKeyManager([]string{"key-a"}, time.Minute))
+	m.SetBuildInfo("v1.2.3", "abc123")
+	r := gin.New()
+	r.GET("/metrics", m.Handler())
+
+	if body := scrape(t, r); !strings.Contains(body, `hpn_router_build_info{git_commit="abc123",version="v1.2.3"} 1`) {
+		t.Errorf("metrics missing build info:\n%s", body)
+	}
+}
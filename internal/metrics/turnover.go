@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+// TurnoverWindow is how long key deaths are kept for TurnoverRate.
+const TurnoverWindow = 24 * time.Hour
+
+// KeyHealth is the key turnover report of GET /admin/metrics/key-health.
+type KeyHealth struct {
+	// TurnoverPerHour1h and TurnoverPerHour24h are key deaths per hour
+	// over the last hour and the last day.
+	TurnoverPerHour1h  float64 `json:"turnover_per_hour_1h"`
+	TurnoverPerHour24h float64 `json:"turnover_per_hour_24h"`
+
+	// TotalDeathsEver counts key deaths since the router started.
+	TotalDeathsEver int64 `json:"total_deaths_ever"`
+
+	KeysCurrentlyDead int `json:"keys_currently_dead"`
+
+	// AvgDeathDurationSeconds is how long keys stayed dead before they
+	// were revived, on average; 0 until a key is revived.
+	AvgDeathDurationSeconds float64 `json:"avg_death_duration_seconds"`
+}
+
+// KeyTurnoverTracker follows key deaths and revivals from the event bus.
+// Many deaths per hour point at a provider outage or a misconfigured pool
+// rather than at individual bad keys.
+type KeyTurnoverTracker struct {
+	km  *domain.KeyManager
+	now func() time.Time
+
+	mu        sync.Mutex
+	start     time.Time
+	deaths    []time.Time // within TurnoverWindow, oldest first
+	total     int64
+	deadSince map[string]time.Time
+	deadTime  time.Duration // summed over revivals
+	revivals  int64
+}
+
+// TurnoverOption configures a KeyTurnoverTracker.
+type TurnoverOption func(*KeyTurnoverTracker)
+
+// WithTurnoverClock sets the clock deaths are aged by.
+func WithTurnoverClock(now func() time.Time) TurnoverOption {
+	return func(t *KeyTurnoverTracker) { t.now = now }
+}
+
+// NewKeyTurnoverTracker returns a tracker for the pool of km. Subscribe its
+// Notify to the bus km publishes to.
+func NewKeyTurnoverTracker(km *domain.KeyManager, opts ...TurnoverOption) *KeyTurnoverTracker {
+	t := &KeyTurnoverTracker{
+		km:        km,
+		now:       time.Now,
+		deadSince: make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.start = t.now()
+	return t
+}
+
+// Notify records the deaths and revivals among key pool events.
+func (t *KeyTurnoverTracker) Notify(e domain.KeyEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch e.Type {
+	case domain.KeyEventDead, domain.KeyEventAllDead:
+		t.total++
+		t.deaths = append(t.deaths, e.Timestamp)
+		t.deadSince[e.Key] = e.Timestamp
+		t.prune(t.now())
+	case domain.KeyEventRevived:
+		if since, ok := t.deadSince[e.Key]; ok {
+			t.deadTime += e.Timestamp.Sub(since)
+			t.revivals++
+			delete(t.deadSince, e.Key)
+		}
+	case domain.KeyEventKeysRemoved:
+		// Removed keys are never revived; forget the ones that died.
+		for key := range t.deadSince {
+			if !t.km.IsKeyDead(key) {
+				delete(t.deadSince, key)
+			}
+		}
+	}
+}
+
+// TurnoverRate returns the key deaths per hour over the last window, at
+// most TurnoverWindow. Until the tracker has run for window, the rate is
+// taken over the time it has run, so early deaths are not averaged over
+// time that was never observed.
+func (t *KeyTurnoverTracker) TurnoverRate(window time.Duration) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.prune(now)
+	window = min(window, TurnoverWindow, now.Sub(t.start))
+	if window <= 0 {
+		return 0
+	}
+	from := now.Add(-window)
+	n := 0
+	for i := len(t.deaths) - 1; i >= 0 && !t.deaths[i].Before(from); i-- {
+		n++
+	}
+	return float64(n) / window.Hours()
+}
+
+// prune drops the deaths older than TurnoverWindow.
+func (t *KeyTurnoverTracker) prune(now time.Time) {
+	from := now.Add(-TurnoverWindow)
+	i := 0
+	for i < len(t.deaths) && t.deaths[i].Before(from) {
+		i++
+	}
+	t.deaths = t.deaths[i:]
+}
+
+// KeyHealth returns the current turnover report.
+func (t *KeyTurnoverTracker) KeyHealth() KeyHealth {
+	h := KeyHealth{
+		TurnoverPerHour1h:  t.TurnoverRate(time.Hour),
+		TurnoverPerHour24h: t.TurnoverRate(24 * time.Hour),
+		KeysCurrentlyDead:  t.km.DeadKeyCount(),
+	}
+	t.mu.Lock()
+	h.TotalDeathsEver = t.total
+	if t.revivals > 0 {
+		h.AvgDeathDurationSeconds = t.deadTime.Seconds() / float64(t.revivals)
+	}
+	t.mu.Unlock()
+	return h
+}
+
+// HandleKeyHealth serves GET /admin/metrics/key-health.
+func (t *KeyTurnoverTracker) HandleKeyHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, t.KeyHealth())
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+func TestKeyTurnoverTracker_MarkAsDead(t *testing.T) {
+	events := domain.NewEventBus()
+	keys := []string{"key-0", "key-1", "key-2", "key-3", "key-4", "key-5"}
+	km := domain.NewKeyManager(keys, time.Hour, domain.WithEventBus(events))
+
+	before := time.Now()
+	tracker := NewKeyTurnoverTracker(km)
+	started := time.Now()
+	events.Subscribe(tracker.Notify)
+
+	for _, key := range keys[:5] {
+		km.MarkAsDead(key, "rate limited")
+	}
+	events.Close()
+
+	measured := time.Now()
+	rate := tracker.TurnoverRate(time.Hour)
+	after := time.Now()
+
+	// The tracker measures from its start to the TurnoverRate call.
+	low := 5 * 3600 / after.Sub(before).Seconds()
+	high := 5 * 3600 / measured.Sub(started).Seconds()
+	if rate < low || rate > high {
+		t.Errorf("TurnoverRate(1h) = %.0f, want between %.0f and %.0f", rate, low, high)
+	}
+
+	h := tracker.KeyHealth()
+	if h.TotalDeathsEver != 5 || h.KeysCurrentlyDead != 5 || h.AvgDeathDurationSeconds != 0 {
+		t.Errorf("KeyHealth() = %+v, want 5 deaths, 5 dead keys and no revivals", h)
+	}
+}
+
+func TestKeyTurnoverTracker_Window(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	km := domain.NewKeyManager([]string{"key-a"}, time.Hour)
+	tracker := NewKeyTurnoverTracker(km, WithTurnoverClock(func() time.Time { return now }))
+
+	die := func(key string) {
+		tracker.Notify(domain.KeyEvent{Type: domain.KeyEventDead, Key: key, Timestamp: now})
+	}
+	revive := func(key string) {
+		tracker.Notify(domain.KeyEvent{Type: domain.KeyEventRevived, Key: key, Timestamp: now})
+	}
+
+	if got := tracker.TurnoverRate(time.Hour); got != 0 {
+		t.Errorf("TurnoverRate(1h) at start = %v, want 0", got)
+	}
+
+	// 12 deaths spread over the first day, each key dead for 10 minutes.
+	for i := range 12 {
+		key := fmt.Sprintf("key-%d", i)
+		die(key)
+		now = now.Add(10 * time.Minute)
+		revive(key)
+		now = now.Add(110 * time.Minute)
+	}
+	// Now 24h after start; the last death was 2h ago.
+	if got := tracker.TurnoverRate(24 * time.Hour); got != 0.5 {
+		t.Errorf("TurnoverRate(24h) = %v, want 0.5", got)
+	}
+	if got := tracker.TurnoverRate(time.Hour); got != 0 {
+		t.Errorf("TurnoverRate(1h) = %v, want 0", got)
+	}
+
+	// The first death leaves the window; the two new ones enter it.
+	now = now.Add(2 * time.Hour)
+	die("key-x")
+	die("key-y")
+	h := tracker.KeyHealth()
+	want := KeyHealth{
+		TurnoverPerHour1h:       2,
+		TurnoverPerHour24h:      13.0 / 24,
+		TotalDeathsEver:         14,
+		AvgDeathDurationSeconds: 600,
+	}
+	if h != want {
+		t.Errorf("KeyHealth() = %+v, want %+v", h, want)
+	}
+}
+
+func TestKeyTurnoverTracker_HandleKeyHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	km := domain.NewKeyManager([]string{"key-a", "key-b"}, time.Hour)
+	km.MarkAsDead("key-a", "rate limited")
+	tracker := NewKeyTurnoverTracker(km)
+
+	r := gin.New()
+	r.GET("/admin/metrics/key-health", tracker.HandleKeyHealth)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/metrics/key-health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"turnover_per_hour_1h", "turnover_per_hour_24h", "total_deaths_ever", "keys_currently_dead", "avg_death_duration_seconds"} {
+		if _, ok := body[field]; !ok {
+			t.Errorf("response %s lacks %s", w.Body, field)
+		}
+	}
+	if body["keys_currently_dead"] != 1.0 {
+		t.Errorf("keys_currently_dead = %v, want 1", body["keys_currently_dead"])
+	}
+}
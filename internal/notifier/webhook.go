@@ -0,0 +1,235 @@
+// Package notifier delivers key pool events to external systems.
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/security"
+)
+
+// SignatureHeader carries "sha256=<hex HMAC-SHA256 of the body>" when an HMAC
+// secret is configured.
+const SignatureHeader = "X-HPN-Signature"
+
+const (
+	// DefaultQueueSize is how many events may wait for delivery before new
+	// ones are dropped.
+	DefaultQueueSize = 100
+
+	// DefaultRetryCount is how many times a failed delivery is retried.
+	DefaultRetryCount = 3
+
+	// DefaultRetryBackoff is the wait before the first retry; it doubles after each attempt.
+	DefaultRetryBackoff = 500 * time.Millisecond
+
+	// DefaultTimeout bounds a single delivery attempt.
+	DefaultTimeout = 10 * time.Second
+)
+
+// Payload is the JSON body POSTed for every event.
+type Payload struct {
+	// Event is "key_dead", "key_revived", "all_keys_dead", "keys_added" or
+	// "keys_removed".
+	Event string `json:"event"`
+
+	// KeyName is the masked key the event is about. Batch events have none.
+	KeyName string `json:"key_name,omitempty"`
+
+	// Count is the number of keys a batch event covers.
+	Count int `json:"count,omitempty"`
+
+	// Timestamp is when the event happened, in RFC 3339 format.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Reason says why the key changed state, e.g. "cooldown expired".
+	Reason string `json:"reason,omitempty"`
+}
+
+// WebhookNotifier POSTs key events to a URL from a background goroutine, so
+// Notify never blocks the request path.
+type WebhookNotifier struct {
+	url          string
+	secret       []byte
+	retries      int
+	retryBackoff time.Duration
+	queueSize    int
+	client       *http.Client
+	logger       *slog.Logger
+
+	events    chan domain.KeyEvent
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// WebhookOption configures a WebhookNotifier.
+type WebhookOption func(*WebhookNotifier)
+
+// WithHMACSecret signs every payload with secret; see SignatureHeader.
+func WithHMACSecret(secret string) WebhookOption {
+	return func(n *WebhookNotifier) {
+		if secret != "" {
+			n.secret = []byte(secret)
+		}
+	}
+}
+
+// WithRetryCount sets how many times a failed delivery is retried.
+func WithRetryCount(count int) WebhookOption {
+	return func(n *WebhookNotifier) {
+		if count >= 0 {
+			n.retries = count
+		}
+	}
+}
+
+// WithRetryBackoff sets the wait before the first retry.
+func WithRetryBackoff(d time.Duration) WebhookOption {
+	return func(n *WebhookNotifier) { n.retryBackoff = d }
+}
+
+// WithQueueSize sets how many events may wait for delivery.
+func WithQueueSize(size int) WebhookOption {
+	return func(n *WebhookNotifier) {
+		if size > 0 {
+			n.queueSize = size
+		}
+	}
+}
+
+// WithHTTPClient sets the client used for deliveries.
+func WithHTTPClient(c *http.Client) WebhookOption {
+	return func(n *WebhookNotifier) { n.client = c }
+}
+
+// WithLogger sets the logger.
+func WithLogger(l *slog.Logger) WebhookOption {
+	return func(n *WebhookNotifier) { n.logger = l }
+}
+
+// NewWebhookNotifier returns a notifier for url and starts its delivery
+// goroutine. Call Close to stop it.
+func NewWebhookNotifier(url string, opts ...WebhookOption) *WebhookNotifier {
+	n := &WebhookNotifier{
+		url:          url,
+		retries:      DefaultRetryCount,
+		retryBackoff: DefaultRetryBackoff,
+		queueSize:    DefaultQueueSize,
+		client:       &http.Client{Timeout: DefaultTimeout},
+		logger:       slog.Default(),
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	n.events = make(chan domain.KeyEvent, n.queueSize)
+
+	go n.run()
+	return n
+}
+
+// Notify queues e for delivery. When the queue is full the event is dropped
+// and logged rather than blocking the caller. Subscribe it to a
+// domain.EventBus to receive key pool events.
+func (n *WebhookNotifier) Notify(e domain.KeyEvent) {
+	select {
+	case n.events <- e:
+	default:
+		n.logger.Warn("webhook queue full, event dropped",
+			slog.String("event", string(e.Type)),
+			slog.String("key", security.MaskKey(e.Key)),
+		)
+	}
+}
+
+// Close stops accepting events and waits until queued ones are delivered.
+// Notify must not be called after Close.
+func (n *WebhookNotifier) Close() {
+	n.closeOnce.Do(func() { close(n.events) })
+	<-n.done
+}
+
+func (n *WebhookNotifier) run() {
+	defer close(n.done)
+	for e := range n.events {
+		n.deliver(e)
+	}
+}
+
+// deliver sends e, retrying with exponential backoff on failure.
+func (n *WebhookNotifier) deliver(e domain.KeyEvent) {
+	p := Payload{
+		Event:     string(e.Type),
+		Count:     e.Count,
+		Timestamp: e.Timestamp.UTC(),
+		Reason:    e.Reason,
+	}
+	if e.Key != "" {
+		p.KeyName = security.MaskKey(e.Key)
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		n.logger.Error("webhook payload encoding failed", slog.String("error", err.Error()))
+		return
+	}
+
+	backoff := n.retryBackoff
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if err = n.post(body); err == nil {
+			return
+		}
+		n.logger.Warn("webhook delivery failed",
+			slog.String("event", string(e.Type)),
+			slog.Int("attempt", attempt+1),
+			slog.String("error", err.Error()),
+		)
+	}
+	n.logger.Error("webhook delivery abandoned",
+		slog.String("event", string(e.Type)),
+		slog.Int("attempts", n.retries+1),
+	)
+}
+
+// post sends one delivery attempt.
+func (n *WebhookNotifier) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != nil {
+		req.Header.Set(SignatureHeader, Sign(n.secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
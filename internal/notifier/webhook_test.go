@@ -0,0 +1,215 @@
+package notifier
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/domain"
+)
+
+const testSecret = "webhook-secret"
+
+// capturedRequest is a webhook delivery seen by the test server.
+type capturedRequest struct {
+	body      []byte
+	signature string
+}
+
+// newCaptureServer records deliveries, answering the first failures with 500.
+func newCaptureServer(t *testing.T, failures int) (*httptest.Server, func() []capturedRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var got []capturedRequest
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		got = append(got, capturedRequest{body: body, signature: r.Header.Get(SignatureHeader)})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []capturedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]capturedRequest(nil), got...)
+	}
+}
+
+func newTestNotifier(url string, opts ...WebhookOption) *WebhookNotifier {
+	opts = append([]WebhookOption{
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithRetryBackoff(time.Millisecond),
+	}, opts...)
+	return NewWebhookNotifier(url, opts...)
+}
+
+func TestWebhookNotifier_PayloadAndSignature(t *testing.T) {
+	server, received := newCaptureServer(t, 0)
+	n := newTestNotifier(server.URL, WithHMACSecret(testSecret))
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	n.Notify(domain.KeyEvent{Type: domain.KeyEventDead, Key: "AIzaSyTestKey1234567890", Timestamp: at})
+	n.Close()
+
+	got := received()
+	if len(got) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(got))
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(got[0].body, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", got[0].body, err)
+	}
+	if payload.Event != "key_dead" {
+		t.Errorf("event = %q, want key_dead", payload.Event)
+	}
+	if payload.KeyName != "AIzaSyTe...7890" {
+		t.Errorf("key_name = %q, want masked AIzaSyTe...7890", payload.KeyName)
+	}
+	if !payload.Timestamp.Equal(at) {
+		t.Errorf("timestamp = %v, want %v", payload.Timestamp, at)
+	}
+	if want := Sign([]byte(testSecret), got[0].body); got[0].signature != want {
+		t.Errorf("signature = %q, want %q", got[0].signature, want)
+	}
+	if wrong := Sign([]byte("other-secret"), got[0].body); got[0].signature == wrong {
+		t.Error("signature verifies with the wrong secret")
+	}
+}
+
+func TestWebhookNotifier_BatchPayload(t *testing.T) {
+	server, received := newCaptureServer(t, 0)
+	n := newTestNotifier(server.URL)
+
+	n.Notify(domain.KeyEvent{Type: domain.KeyEventKeysAdded, Count: 3, Timestamp: time.Now(), Reason: domain.ReasonAddedByAdmin})
+	n.Close()
+
+	got := received()
+	if len(got) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(got))
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(got[0].body, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", got[0].body, err)
+	}
+	if payload["event"] != "keys_added" || payload["count"] != float64(3) {
+		t.Errorf("payload = %s, want keys_added with count 3", got[0].body)
+	}
+	if _, ok := payload["key_name"]; ok {
+		t.Errorf("payload = %s, want no key_name for a batch event", got[0].body)
+	}
+}
+
+func TestWebhookNotifier_NoSecretNoSignature(t *testing.T) {
+	server, received := newCaptureServer(t, 0)
+	n := newTestNotifier(server.URL)
+
+	n.Notify(domain.KeyEvent{Type: domain.KeyEventRevived, Key: "AIzaSyTestKey1234567890", Timestamp: time.Now()})
+	n.Close()
+
+	got := received()
+	if len(got) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(got))
+	}
+	if got[0].signature != "" {
+		t.Errorf("signature = %q, want none without a secret", got[0].signature)
+	}
+}
+
+func TestWebhookNotifier_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		retries  int
+		want     int
+	}{
+		{"succeeds after retries", 2, 3, 1},
+		{"gives up", 5, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newCaptureServer(t, tt.failures)
+			n := newTestNotifier(server.URL, WithRetryCount(tt.retries))
+
+			n.Notify(domain.KeyEvent{Type: domain.KeyEventDead, Key: "AIzaSyTestKey1234567890", Timestamp: time.Now()})
+			n.Close()
+
+			if got := len(received()); got != tt.want {
+				t.Errorf("deliveries = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier_KeyManagerEvents(t *testing.T) {
+	server, received := newCaptureServer(t, 0)
+	n := newTestNotifier(server.URL)
+
+	bus := domain.NewEventBus()
+	bus.Subscribe(n.Notify)
+	km := domain.NewKeyManager([]string{"AIzaSyFirstKey000000001", "AIzaSySecondKey00000002"}, 0,
+		domain.WithEventBus(bus))
+	km.MarkAsDead("AIzaSyFirstKey000000001", "")
+	km.MarkAsDead("AIzaSySecondKey00000002", "")
+	km.MarkAsDead("AIzaSySecondKey00000002", "") // already dead: no event
+	km.ReviveKey("AIzaSyFirstKey000000001")
+	bus.Close()
+	n.Close()
+
+	var events []string
+	for _, r := range received() {
+		var p Payload
+		json.Unmarshal(r.body, &p)
+		events = append(events, p.Event)
+	}
+	want := []string{"key_dead", "all_keys_dead", "key_revived"}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("events[%d] = %s, want %s", i, events[i], want[i])
+		}
+	}
+}
+
+func TestWebhookNotifier_NotifyDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	n := newTestNotifier(server.URL, WithQueueSize(1), WithRetryCount(0))
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			n.Notify(domain.KeyEvent{Type: domain.KeyEventDead, Key: "AIzaSyTestKey1234567890", Timestamp: time.Now()})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notify blocked while the webhook was unresponsive")
+	}
+	close(release)
+	n.Close()
+}
@@ -0,0 +1,117 @@
+// Package profiling serves the net/http/pprof handlers on a port of their own,
+// so profiles are never reachable through the proxy's public listener.
+package profiling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// DefaultPort is the conventional pprof port.
+const DefaultPort = 6060
+
+// Server is the pprof listener. It does nothing unless enabled with WithPProf.
+type Server struct {
+	host    string
+	enabled bool
+	port    int
+	logger  *slog.Logger
+
+	srv *http.Server
+	ln  net.Listener
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithPProf enables the pprof routes on port. Port 0 picks a free port.
+func WithPProf(enabled bool, port int) Option {
+	return func(s *Server) {
+		s.enabled = enabled
+		s.port = port
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) { s.logger = l }
+}
+
+// NewServer returns a pprof server bound to host.
+func NewServer(host string, opts ...Option) *Server {
+	s := &Server{
+		host:   host,
+		port:   DefaultPort,
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Enabled reports whether Start will open a listener.
+func (s *Server) Enabled() bool {
+	return s.enabled
+}
+
+// Handler returns a mux serving /debug/pprof/. It is separate from
+// http.DefaultServeMux, which net/http/pprof also registers on.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// Start listens and serves in the background. It is a no-op when disabled.
+func (s *Server) Start() error {
+	if !s.enabled {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(s.host, fmt.Sprint(s.port)))
+	if err != nil {
+		return fmt.Errorf("pprof listen: %w", err)
+	}
+	s.ln = ln
+	s.srv = &http.Server{Handler: Handler()}
+
+	if s.host == "0.0.0.0" || s.host == "" || s.host == "::" {
+		s.logger.Warn("pprof is listening on all interfaces; firewall the port or bind server.host to localhost",
+			slog.String("address", ln.Addr().String()),
+		)
+	}
+	s.logger.Info("pprof server starting", slog.String("address", ln.Addr().String()))
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("pprof server error", slog.String("error", err.Error()))
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address Start is listening on, or "" when not started.
+func (s *Server) Addr() string {
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Shutdown stops the listener, if one was started.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,88 @@
+package profiling
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newTestServer(opts ...Option) *Server {
+	opts = append([]Option{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)
+	return NewServer("127.0.0.1", opts...)
+}
+
+func TestServer_ServesPProfWhenEnabled(t *testing.T) {
+	s := newTestServer(WithPProf(true, 0))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer s.Shutdown(context.Background())
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/goroutine?debug=1"} {
+		resp, err := http.Get("http://" + s.Addr() + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s status = %d, want 200", path, resp.StatusCode)
+		}
+		if len(body) == 0 {
+			t.Errorf("GET %s returned an empty body", path)
+		}
+	}
+}
+
+func TestServer_DisabledDoesNotListen(t *testing.T) {
+	s := newTestServer(WithPProf(false, 0))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if s.Enabled() {
+		t.Error("Enabled() = true, want false")
+	}
+	if s.Addr() != "" {
+		t.Errorf("Addr() = %q, want no listener", s.Addr())
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+func TestServer_WarnsOnAllInterfaces(t *testing.T) {
+	var logs strings.Builder
+	s := NewServer("0.0.0.0",
+		WithPProf(true, 0),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer s.Shutdown(context.Background())
+
+	if !strings.Contains(logs.String(), "level=WARN") {
+		t.Errorf("no warning logged for 0.0.0.0, got %q", logs.String())
+	}
+}
+
+func TestHandler_NotOnDefaultPaths(t *testing.T) {
+	s := newTestServer(WithPProf(true, 0))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer s.Shutdown(context.Background())
+
+	resp, err := http.Get("http://" + s.Addr() + "/chat/completions")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 for non-pprof paths", resp.StatusCode)
+	}
+}
@@ -0,0 +1,163 @@
+// Package recorder captures HTTP traffic as NDJSON, one request/response pair
+// per line, so production issues can be reproduced with cmd/replay.
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Entry is one recorded request/response pair.
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+
+	// RequestHeader holds the request headers except credentials.
+	RequestHeader http.Header `json:"request_header,omitempty"`
+
+	// RequestHash is the hex SHA-256 of RequestBody, for grouping identical
+	// requests without reading the bodies.
+	RequestHash string `json:"request_hash"`
+	RequestBody string `json:"request_body"`
+
+	Status       int    `json:"status"`
+	ResponseBody string `json:"response_body"`
+}
+
+// BodyRedacted replaces the request body and its hash in entries recorded
+// with WithRedactedBodies.
+const BodyRedacted = "[BODY_REDACTED]"
+
+// RecordingOption configures RecordingMiddleware.
+type RecordingOption func(*recordingConfig)
+
+type recordingConfig struct {
+	redactBodies bool
+	skipPrefixes []string
+}
+
+// WithRedactedBodies records BodyRedacted instead of the request body and
+// its hash, for deployments where prompts must never be stored. Such
+// entries cannot be replayed.
+func WithRedactedBodies(enabled bool) RecordingOption {
+	return func(cfg *recordingConfig) { cfg.redactBodies = enabled }
+}
+
+// WithSkippedPaths records nothing for requests whose path starts with one
+// of prefixes, such as the admin API, whose bodies carry provider API keys.
+func WithSkippedPaths(prefixes ...string) RecordingOption {
+	return func(cfg *recordingConfig) { cfg.skipPrefixes = append(cfg.skipPrefixes, prefixes...) }
+}
+
+// sensitiveHeaders are never written to a recording.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Admin-Token"}
+
+// RecordingMiddleware writes an Entry for every request to dest, one JSON
+// object per line. Writes are serialized, so dest need not be safe for
+// concurrent use. A failed write is dropped and never affects the response.
+func RecordingMiddleware(dest io.Writer, opts ...RecordingOption) gin.HandlerFunc {
+	var cfg recordingConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var mu sync.Mutex
+	enc := json.NewEncoder(dest)
+
+	return func(c *gin.Context) {
+		for _, prefix := range cfg.skipPrefixes {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+		start := time.Now()
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		header := c.Request.Header.Clone()
+		for _, h := range sensitiveHeaders {
+			header.Del(h)
+		}
+
+		writer := &bodyWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+
+		c.Next()
+
+		entry := Entry{
+			Timestamp:     start.UTC(),
+			Method:        c.Request.Method,
+			Path:          c.Request.URL.Path,
+			RequestHeader: header,
+			RequestHash:   Hash(body),
+			RequestBody:   string(body),
+			Status:        writer.Status(),
+			ResponseBody:  writer.body.String(),
+		}
+		if cfg.redactBodies {
+			entry.RequestHash = BodyRedacted
+			entry.RequestBody = BodyRedacted
+		}
+
+		mu.Lock()
+		_ = enc.Encode(entry)
+		mu.Unlock()
+	}
+}
+
+// Hash returns the hex SHA-256 of body.
+func Hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadEntries decodes a recording written by RecordingMiddleware. Blank lines
+// are skipped.
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// bodyWriter copies the response body while writing it to the client.
+type bodyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
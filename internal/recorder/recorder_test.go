@@ -0,0 +1,122 @@
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecordingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	r := gin.New()
+	r.Use(RecordingMiddleware(&out))
+	r.POST("/echo", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusCreated, "application/json", body)
+	})
+	r.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "healthy"}) })
+
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Admin-Token", "admin-secret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if strings.Contains(out.String(), "secret") {
+		t.Errorf("recording contains credentials: %s", out.String())
+	}
+
+	entries, err := ReadEntries(&out)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(entries))
+	}
+
+	e := entries[0]
+	if e.Method != http.MethodPost || e.Path != "/echo" || e.Status != http.StatusCreated {
+		t.Errorf("entry = %s %s %d, want POST /echo 201", e.Method, e.Path, e.Status)
+	}
+	if e.RequestBody != `{"a":1}` || e.ResponseBody != `{"a":1}` {
+		t.Errorf("bodies = %q / %q, want the echoed request", e.RequestBody, e.ResponseBody)
+	}
+	if e.RequestHash != Hash([]byte(`{"a":1}`)) {
+		t.Errorf("RequestHash = %s, want the SHA-256 of the body", e.RequestHash)
+	}
+	if got := e.RequestHeader.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if e.Timestamp.IsZero() {
+		t.Error("Timestamp is zero")
+	}
+
+	if got := entries[1].ResponseBody; got != `{"status":"healthy"}` {
+		t.Errorf("response body = %q, want the health JSON", got)
+	}
+}
+
+func TestRecordingMiddleware_RedactedBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	r := gin.New()
+	r.Use(RecordingMiddleware(&out, WithRedactedBodies(true)))
+	r.POST("/v1/chat/completions", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+
+	body := `{"messages":[{"role":"user","content":"secret prompt"}]}`
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+	if strings.Contains(out.String(), "secret prompt") || strings.Contains(out.String(), Hash([]byte(body))) {
+		t.Errorf("recording contains the body or its hash: %s", out.String())
+	}
+	entries, err := ReadEntries(&out)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadEntries() = %d entries, %v; want 1", len(entries), err)
+	}
+	e := entries[0]
+	if e.RequestBody != BodyRedacted || e.RequestHash != BodyRedacted {
+		t.Errorf("body = %q, hash = %q, want both %s", e.RequestBody, e.RequestHash, BodyRedacted)
+	}
+	if e.Method != http.MethodPost || e.Path != "/v1/chat/completions" || e.Status != http.StatusOK || e.ResponseBody != `{"ok":true}` {
+		t.Errorf("entry = %+v, want the other fields kept", e)
+	}
+}
+
+func TestRecordingMiddleware_SkippedPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	r := gin.New()
+	r.Use(RecordingMiddleware(&out, WithSkippedPaths("/admin/")))
+	r.POST("/admin/keys", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	r.POST("/echo", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/keys", strings.NewReader(`{"key":"AIzaSySecretKey"}`)))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{}`)))
+
+	if strings.Contains(out.String(), "AIzaSySecretKey") {
+		t.Errorf("recording contains the admin request: %s", out.String())
+	}
+	entries, err := ReadEntries(&out)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/echo" {
+		t.Errorf("entries = %+v, want only /echo", entries)
+	}
+}
+
+func TestReadEntries_Invalid(t *testing.T) {
+	if _, err := ReadEntries(strings.NewReader("{\"method\":\"GET\"}\n\nnot json\n")); err == nil {
+		t.Error("ReadEntries() error = nil, want a decode error")
+	}
+}
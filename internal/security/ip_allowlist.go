@@ -0,0 +1,63 @@
+package security
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPAllowlist matches client IPs against a set of addresses and CIDR ranges.
+// The zero value and a nil *IPAllowlist allow nothing.
+type IPAllowlist struct {
+	nets []*net.IPNet
+}
+
+// ParseIPAllowlist builds an allowlist from entries that are either single IPs
+// ("10.0.0.5", "::1") or CIDR ranges ("10.0.0.0/8").
+func ParseIPAllowlist(entries []string) (*IPAllowlist, error) {
+	a := &IPAllowlist{nets: make([]*net.IPNet, 0, len(entries))}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		a.nets = append(a.nets, ipNet)
+	}
+
+	return a, nil
+}
+
+// Allows reports whether ip falls inside any allowlisted range.
+func (a *IPAllowlist) Allows(ip string) bool {
+	if a == nil {
+		return false
+	}
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return false
+	}
+	for _, n := range a.nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
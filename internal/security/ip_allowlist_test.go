@@ -0,0 +1,53 @@
+package security
+
+import "testing"
+
+func TestIPAllowlist_Allows(t *testing.T) {
+	a, err := ParseIPAllowlist([]string{"127.0.0.1", "10.0.0.0/8", " ::1 ", ""})
+	if err != nil {
+		t.Fatalf("ParseIPAllowlist() error = %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"127.0.0.2", false},
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"::1", true},
+		{"::2", false},
+		{"not-an-ip", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := a.Allows(tt.ip); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIPAllowlist_Invalid(t *testing.T) {
+	for _, entry := range []string{"300.1.1.1", "10.0.0.0/40", "localhost"} {
+		t.Run(entry, func(t *testing.T) {
+			if _, err := ParseIPAllowlist([]string{entry}); err == nil {
+				t.Errorf("ParseIPAllowlist(%q) error = nil, want error", entry)
+			}
+		})
+	}
+}
+
+func TestIPAllowlist_Empty(t *testing.T) {
+	var nilList *IPAllowlist
+	empty, _ := ParseIPAllowlist(nil)
+
+	for name, a := range map[string]*IPAllowlist{"nil": nilList, "empty": empty} {
+		if a.Allows("127.0.0.1") {
+			t.Errorf("%s allowlist allows 127.0.0.1, want nothing allowed", name)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package security
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"regexp"
 	"strings"
@@ -11,6 +12,46 @@ import (
 // Redaction placeholder for sensitive data.
 const RedactedPlaceholder = "[REDACTED_KEY_XYZ]"
 
+// RedactMode selects how much of a detected secret is kept.
+type RedactMode int
+
+const (
+	// RedactFull replaces each secret with RedactedPlaceholder.
+	RedactFull RedactMode = iota
+
+	// RedactPartial keeps the first and last partialKeep characters of each
+	// secret, e.g. "AIza...[REDACTED]...ZXxy", so the failing key can be
+	// identified. Secrets too short to hide enough are replaced in full.
+	RedactPartial
+)
+
+// partialKeep is how many characters RedactPartial keeps at each end.
+const partialKeep = 4
+
+// minPartialLen is the shortest secret RedactPartial shortens rather than
+// replacing, leaving at least 12 characters hidden.
+const minPartialLen = 2*partialKeep + 12
+
+// String returns the config name of m.
+func (m RedactMode) String() string {
+	if m == RedactPartial {
+		return "partial"
+	}
+	return "full"
+}
+
+// ParseRedactMode parses a config value, "full" or "partial". An empty
+// string is RedactFull.
+func ParseRedactMode(s string) (RedactMode, error) {
+	switch s {
+	case "", "full":
+		return RedactFull, nil
+	case "partial":
+		return RedactPartial, nil
+	}
+	return RedactFull, fmt.Errorf("unknown redact mode %q, must be full or partial", s)
+}
+
 // sensitivePatterns contains regex patterns for common API key formats.
 var sensitivePatterns = []*regexp.Regexp{
 	// OpenAI keys: sk-... (varies 32-100+ chars)
@@ -19,10 +60,12 @@ var sensitivePatterns = []*regexp.Regexp{
 	regexp.MustCompile(`AIza[a-zA-Z0-9_-]{30,}`),
 	// Anthropic keys: sk-ant-...
 	regexp.MustCompile(`sk-ant-[a-zA-Z0-9_-]{20,}`),
-	// Generic Bearer tokens in strings
-	regexp.MustCompile(`Bearer\s+[a-zA-Z0-9_-]{20,}`),
+	// Generic Bearer tokens in strings; the group is the secret itself
+	regexp.MustCompile(`Bearer\s+([a-zA-Z0-9_-]{20,})`),
 	// API keys in query params: key=...
-	regexp.MustCompile(`key=[a-zA-Z0-9_-]{20,}`),
+	regexp.MustCompile(`key=([a-zA-Z0-9_-]{20,})`),
+	// Email addresses, e.g. user IDs sent in X-User-ID
+	regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`),
 	// Generic long alphanumeric strings that look like keys (40+ chars)
 	regexp.MustCompile(`[a-zA-Z0-9_-]{40,}`),
 }
@@ -30,22 +73,73 @@ var sensitivePatterns = []*regexp.Regexp{
 // Redact scans a string for sensitive patterns and replaces them.
 // This is the primary function for sanitizing log output.
 func Redact(s string) string {
+	return RedactWithMode(s, RedactFull)
+}
+
+// RedactWithMode is Redact with a choice of how much of each secret to keep.
+func RedactWithMode(s string, mode RedactMode) string {
 	result := s
 	for _, pattern := range sensitivePatterns {
-		result = pattern.ReplaceAllString(result, RedactedPlaceholder)
+		if mode == RedactPartial {
+			result = redactPartial(result, pattern)
+		} else {
+			result = pattern.ReplaceAllString(result, RedactedPlaceholder)
+		}
 	}
 	return result
 }
 
+// redactPartial shortens every match of pattern in s. When the pattern has
+// a group, only the group is shortened, so labels like "key=" stay intact.
+func redactPartial(s string, pattern *regexp.Regexp) string {
+	matches := pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		b.WriteString(s[last:start])
+		secret := s[start:end]
+		if len(secret) < minPartialLen {
+			b.WriteString(RedactedPlaceholder)
+		} else {
+			b.WriteString(secret[:partialKeep] + "...[REDACTED]..." + secret[len(secret)-partialKeep:])
+		}
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
 // RedactedHandler wraps an slog.Handler and redacts sensitive data from log records.
 type RedactedHandler struct {
 	inner slog.Handler
+	mode  RedactMode
+}
+
+// RedactedHandlerOption configures a RedactedHandler.
+type RedactedHandlerOption func(*RedactedHandler)
+
+// WithRedactMode sets how much of each secret is kept, RedactFull by default.
+// Attributes with sensitive names are always replaced in full.
+func WithRedactMode(mode RedactMode) RedactedHandlerOption {
+	return func(h *RedactedHandler) { h.mode = mode }
 }
 
 // NewRedactedHandler creates a new handler that wraps an existing handler
 // and redacts sensitive data from all log output.
-func NewRedactedHandler(inner slog.Handler) *RedactedHandler {
-	return &RedactedHandler{inner: inner}
+func NewRedactedHandler(inner slog.Handler, opts ...RedactedHandlerOption) *RedactedHandler {
+	h := &RedactedHandler{inner: inner}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Enabled reports whether the handler handles records at the given level.
@@ -56,43 +150,33 @@ func (h *RedactedHandler) Enabled(ctx context.Context, level slog.Level) bool {
 // Handle processes a log record, redacting sensitive data.
 func (h *RedactedHandler) Handle(ctx context.Context, r slog.Record) error {
 	// Redact the message
-	r = slog.Record{
-		Time:    r.Time,
-		Message: Redact(r.Message),
-		Level:   r.Level,
-		PC:      r.PC,
-	}
+	redacted := slog.NewRecord(r.Time, r.Level, RedactWithMode(r.Message, h.mode), r.PC)
 
-	// Redact attributes
-	attrs := make([]slog.Attr, 0)
+	// Redact attributes, read from the original record
 	r.Attrs(func(a slog.Attr) bool {
-		attrs = append(attrs, redactAttr(a))
+		redacted.AddAttrs(h.redactAttr(a))
 		return true
 	})
 
-	for _, a := range attrs {
-		r.AddAttrs(a)
-	}
-
-	return h.inner.Handle(ctx, r)
+	return h.inner.Handle(ctx, redacted)
 }
 
 // WithAttrs returns a new handler with the given attributes added.
 func (h *RedactedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	redacted := make([]slog.Attr, len(attrs))
 	for i, a := range attrs {
-		redacted[i] = redactAttr(a)
+		redacted[i] = h.redactAttr(a)
 	}
-	return &RedactedHandler{inner: h.inner.WithAttrs(redacted)}
+	return &RedactedHandler{inner: h.inner.WithAttrs(redacted), mode: h.mode}
 }
 
 // WithGroup returns a new handler with the given group name.
 func (h *RedactedHandler) WithGroup(name string) slog.Handler {
-	return &RedactedHandler{inner: h.inner.WithGroup(name)}
+	return &RedactedHandler{inner: h.inner.WithGroup(name), mode: h.mode}
 }
 
 // redactAttr redacts sensitive data from a single attribute.
-func redactAttr(a slog.Attr) slog.Attr {
+func (h *RedactedHandler) redactAttr(a slog.Attr) slog.Attr {
 	// Check for known sensitive keys
 	key := strings.ToLower(a.Key)
 	if isSensitiveKey(key) {
@@ -102,11 +186,11 @@ func redactAttr(a slog.Attr) slog.Attr {
 	// Redact string values
 	switch v := a.Value.Any().(type) {
 	case string:
-		return slog.String(a.Key, Redact(v))
+		return slog.String(a.Key, RedactWithMode(v, h.mode))
 	case []string:
 		redacted := make([]string, len(v))
 		for i, s := range v {
-			redacted[i] = Redact(s)
+			redacted[i] = RedactWithMode(s, h.mode)
 		}
 		return slog.Any(a.Key, redacted)
 	}
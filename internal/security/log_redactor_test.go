@@ -33,6 +33,12 @@ func TestRedact(t *testing.T) {
 			contains: RedactedPlaceholder,
 			excludes: "sk-abcdef",
 		},
+		{
+			name:     "Email address",
+			input:    "user_id=jane.doe+billing@example.co.uk",
+			contains: RedactedPlaceholder,
+			excludes: "jane.doe",
+		},
 		{
 			name:     "No sensitive data",
 			input:    "Normal log message",
@@ -111,3 +117,101 @@ func TestRedactedHandlerEnabled(t *testing.T) {
 		t.Error("Should be enabled for Error level when base is Warn")
 	}
 }
+
+func TestRedactWithMode(t *testing.T) {
+	const key = "AIzaSyABCDEFGHIJKLMNOPQRSTUVWXYZ12ZXxy"
+	tests := []struct {
+		name  string
+		input string
+		mode  RedactMode
+		want  string
+	}{
+		{
+			name:  "full",
+			input: "key " + key + " failed",
+			mode:  RedactFull,
+			want:  "key " + RedactedPlaceholder + " failed",
+		},
+		{
+			name:  "partial keeps prefix and suffix",
+			input: "key " + key + " failed",
+			mode:  RedactPartial,
+			want:  "key AIza...[REDACTED]...ZXxy failed",
+		},
+		{
+			name:  "partial keeps query param name",
+			input: "GET /v1beta/models?key=" + key,
+			mode:  RedactPartial,
+			want:  "GET /v1beta/models?key=AIza...[REDACTED]...ZXxy",
+		},
+		{
+			name:  "partial bearer token",
+			input: "Bearer abcdefghijklmnopqrstuvwx",
+			mode:  RedactPartial,
+			want:  "Bearer abcd...[REDACTED]...uvwx",
+		},
+		{
+			name:  "partial short secret replaced in full",
+			input: "user_id=jo@example.com",
+			mode:  RedactPartial,
+			want:  "user_id=" + RedactedPlaceholder,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactWithMode(tt.input, tt.mode); got != tt.want {
+				t.Errorf("RedactWithMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRedactMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RedactMode
+		wantErr bool
+	}{
+		{"", RedactFull, false},
+		{"full", RedactFull, false},
+		{"partial", RedactPartial, false},
+		{"none", RedactFull, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRedactMode(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRedactMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRedactMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactedHandler_PartialMode(t *testing.T) {
+	var buf bytes.Buffer
+	baseHandler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logger := slog.New(NewRedactedHandler(baseHandler, WithRedactMode(RedactPartial))).With("component", "proxy")
+
+	logger.Warn("key failed",
+		slog.String("error", "invalid key AIzaSyABCDEFGHIJKLMNOPQRSTUVWXYZ12ZXxy"),
+		slog.String("api_key", "AIzaSyABCDEFGHIJKLMNOPQRSTUVWXYZ12ZXxy"),
+		slog.Int("status", 403),
+	)
+
+	output := buf.String()
+	for _, want := range []string{
+		"component=proxy",
+		`error="invalid key AIza...[REDACTED]...ZXxy"`,
+		"api_key=" + RedactedPlaceholder,
+		"status=403",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log output = %s, want it to contain %s", output, want)
+		}
+	}
+}
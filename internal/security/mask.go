@@ -0,0 +1,14 @@
+package security
+
+// MaskKey hides all but the first 8 and last 4 characters of an API key, so
+// logs and admin responses can tell keys apart without revealing them. Keys
+// too short to hide enough become "***"; an empty key stays empty.
+func MaskKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 12 {
+		return "***"
+	}
+	return key[:8] + "..." + key[len(key)-4:]
+}
@@ -0,0 +1,22 @@
+package security
+
+import "testing"
+
+func TestMaskKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"AIzaSyTestKey1234567890", "AIzaSyTe...7890"},
+		{"1234567890123", "12345678...0123"},
+		{"123456789012", "***"},
+		{"short", "***"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := MaskKey(tt.key); got != tt.want {
+			t.Errorf("MaskKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,680 @@
+// Package spec builds the OpenAPI 3.0 description of the router's HTTP API.
+// Request and response schemas are derived by reflection from the adapter and
+// handler types the handlers encode, so the document stays in sync with what
+// they actually accept and return.
+package spec
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/handler"
+	"github.com/hpn/hpn-g-router/internal/metrics"
+)
+
+const (
+	// OpenAPIVersion is the OpenAPI specification version the document conforms to.
+	OpenAPIVersion = "3.0.3"
+
+	// Title is the API title advertised in the document.
+	Title = "HPN Router API"
+
+	// APIVersion is the version of the router API described by the document.
+	APIVersion = "1.0.0"
+
+	schemaRefPrefix = "#/components/schemas/"
+
+	adminSecurityScheme = "AdminToken"
+)
+
+// Build constructs the OpenAPI document describing every route served by the router.
+func Build(version string) (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: OpenAPIVersion,
+		Info: &openapi3.Info{
+			Title:       Title,
+			Description: "OpenAI-compatible proxy for Google Gemini with automatic API key rotation.",
+			Version:     version,
+		},
+		Paths: openapi3.Paths{},
+		Components: openapi3.Components{
+			Schemas: openapi3.Schemas{},
+			SecuritySchemes: openapi3.SecuritySchemes{
+				adminSecurityScheme: &openapi3.SecuritySchemeRef{
+					Value: openapi3.NewSecurityScheme().
+						WithType("apiKey").
+						WithIn(openapi3.ParameterInHeader).
+						WithName(handler.AdminTokenHeader).
+						WithDescription("Shared admin token from admin.token. The /admin routes are only served when it is set."),
+				},
+			},
+		},
+	}
+
+	if err := addReflectedSchemas(doc); err != nil {
+		return nil, err
+	}
+
+	doc.AddOperation("/v1/chat/completions", http.MethodPost, chatCompletionOperation("createChatCompletion"))
+
+	// The unversioned alias gets its own operation so the two never share mutable state.
+	chatAlias := chatCompletionOperation("createChatCompletionUnversioned")
+	chatAlias.Deprecated = true
+	doc.AddOperation("/chat/completions", http.MethodPost, chatAlias)
+
+	batch := openapi3.NewOperation()
+	batch.OperationID = "createChatCompletionBatch"
+	batch.Summary = "Create chat completions for a batch of requests"
+	batch.Description = "Items are processed concurrently and independently; failed items carry an error instead of a response."
+	batch.Tags = []string{"chat"}
+	batch.Parameters = geminiExtensionParameters()
+	batch.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("BatchCompletionRequest")),
+	}
+	batch.AddResponse(http.StatusOK, jsonResponse("Per-item results in request order", "BatchCompletionResponse"))
+	batch.AddResponse(http.StatusBadRequest, jsonResponse("Invalid request", "OpenAIError"))
+	batch.AddResponse(http.StatusForbidden, jsonResponse("Safety override not allowed for this client", "OpenAIError"))
+	batch.AddResponse(http.StatusServiceUnavailable, jsonResponse("The router is at capacity", "OpenAIError"))
+	doc.AddOperation("/v1/chat/completions/batch", http.MethodPost, batch)
+
+	embeddings := openapi3.NewOperation()
+	embeddings.OperationID = "createEmbedding"
+	embeddings.Summary = "Create embeddings (OpenAI-compatible)"
+	embeddings.Tags = []string{"embeddings"}
+	embeddings.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("OpenAIEmbeddingRequest")),
+	}
+	embeddings.AddResponse(http.StatusOK, withAttemptHeaders(jsonResponse("Embeddings", "OpenAIEmbeddingResponse")))
+	embeddings.AddResponse(http.StatusBadRequest, jsonResponse("Invalid request", "OpenAIError"))
+	embeddings.AddResponse(http.StatusTooManyRequests, busyResponse())
+	embeddings.AddResponse(http.StatusServiceUnavailable, unavailableResponse())
+	doc.AddOperation("/v1/embeddings", http.MethodPost, embeddings)
+
+	embeddingsGet := openapi3.NewOperation()
+	embeddingsGet.OperationID = "getEmbeddings"
+	embeddingsGet.Summary = "Not supported; embeddings are created with POST"
+	embeddingsGet.Tags = []string{"embeddings"}
+	embeddingsGet.AddResponse(http.StatusMethodNotAllowed, jsonResponse("Method not allowed", "OpenAIError"))
+	doc.AddOperation("/v1/embeddings", http.MethodGet, embeddingsGet)
+
+	models := openapi3.NewOperation()
+	models.OperationID = "listModels"
+	models.Summary = "List available models"
+	models.Tags = []string{"models"}
+	models.AddResponse(http.StatusOK, jsonResponse("Model list", "OpenAIModelList"))
+	doc.AddOperation("/v1/models", http.MethodGet, models)
+
+	health := openapi3.NewOperation()
+	health.OperationID = "getHealth"
+	health.Summary = "Report router and key pool health"
+	health.Tags = []string{"ops"}
+	health.AddResponse(http.StatusOK, jsonResponse("Health status", "HealthResponse"))
+	doc.AddOperation("/health", http.MethodGet, health)
+
+	ready := openapi3.NewOperation()
+	ready.OperationID = "getReadiness"
+	ready.Summary = "Report whether the router can serve requests"
+	ready.Tags = []string{"ops"}
+	ready.AddResponse(http.StatusOK, jsonResponse("At least one key is in rotation", "ReadinessResponse"))
+	ready.AddResponse(http.StatusServiceUnavailable, jsonResponse("No key is in rotation", "ReadinessResponse"))
+	doc.AddOperation("/healthz/ready", http.MethodGet, ready)
+
+	prom := openapi3.NewOperation()
+	prom.OperationID = "getMetrics"
+	prom.Summary = "Prometheus metrics for requests and the key pool"
+	prom.Tags = []string{"ops"}
+	prom.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription("Metrics in the Prometheus text exposition format").
+		WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/plain; version=0.0.4"})))
+	doc.AddOperation("/metrics", http.MethodGet, prom)
+
+	listKeys := adminOperation("listKeys", "List keys with their rotation status")
+	listKeys.AddResponse(http.StatusOK, jsonResponse("Key pool status", "KeyListResponse"))
+	doc.AddOperation("/admin/keys", http.MethodGet, listKeys)
+
+	addKey := adminOperation("addKey", "Add a key to rotation until the next restart")
+	addKey.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("AddKeyRequest")),
+	}
+	addKey.AddResponse(http.StatusCreated, jsonResponse("The added key, masked", "KeyStatus"))
+	addKey.AddResponse(http.StatusBadRequest, jsonResponse("Invalid request", "OpenAIError"))
+	addKey.AddResponse(http.StatusConflict, jsonResponse("The key or name is already in the pool", "OpenAIError"))
+	doc.AddOperation("/admin/keys", http.MethodPost, addKey)
+
+	removeKey := keyActionOperation("removeKey", "Drain a key, then remove it from the pool until the next restart")
+	removeKey.Description = "Waits for requests using the key to finish, up to admin.drain_timeout_seconds."
+	removeKey.AddResponse(http.StatusConflict, jsonResponse("The key is already being removed", "OpenAIError"))
+	removeKey.AddResponse(http.StatusGatewayTimeout, jsonResponse("Requests using the key outlasted the drain timeout; the key was kept", "OpenAIError"))
+	doc.AddOperation("/admin/keys/{name}", http.MethodDelete, removeKey)
+
+	addKeys := adminOperation("addKeys", "Add several keys to rotation at once until the next restart")
+	addKeys.Description = "Keys already in the pool are skipped and counted as duplicates. If any key is invalid or its name is in use, no key is added."
+	addKeys.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("AddKeysRequest")),
+	}
+	addKeys.AddResponse(http.StatusOK, jsonResponse("How many keys were added and skipped", "BatchKeysResponse"))
+	addKeys.AddResponse(http.StatusBadRequest, jsonResponse("Invalid request", "OpenAIError"))
+	addKeys.AddResponse(http.StatusConflict, jsonResponse("A name is already in use", "OpenAIError"))
+	doc.AddOperation("/admin/keys/batch", http.MethodPost, addKeys)
+
+	removeKeys := adminOperation("removeKeys", "Remove several keys from the pool at once until the next restart")
+	removeKeys.Description = "Unlike removeKey, does not wait for requests using the keys to finish."
+	removeKeys.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("RemoveKeysRequest")),
+	}
+	removeKeys.AddResponse(http.StatusOK, jsonResponse("How many keys were removed and not found", "BatchKeysResponse"))
+	removeKeys.AddResponse(http.StatusBadRequest, jsonResponse("Invalid request", "OpenAIError"))
+	doc.AddOperation("/admin/keys/batch", http.MethodDelete, removeKeys)
+
+	keyLatency := adminOperation("getKeyLatency", "Report the latency EWMA of each key")
+	keyLatency.AddResponse(http.StatusOK, jsonResponse("Per-key latency, fastest first", "KeyLatencyResponse"))
+	doc.AddOperation("/admin/keys/latency", http.MethodGet, keyLatency)
+
+	keyStates := adminOperation("listKeyStates", "Report the full state of every key")
+	keyStates.AddResponse(http.StatusOK, jsonResponse("Key states sorted by status, then name", "KeyStateListResponse"))
+	doc.AddOperation("/admin/keys/state", http.MethodGet, keyStates)
+
+	keyState := adminOperation("getKeyState", "Report the full state of a key")
+	keyState.Description = "Status is one of active, dead, half_open (cooldown passed, revived on the next selection), draining, over_quota, expired or paused."
+	keyState.Parameters = openapi3.Parameters{{
+		Value: openapi3.NewPathParameter("name").
+			WithDescription("Configured key name, as listed by GET /admin/keys.").
+			WithSchema(openapi3.NewStringSchema()),
+	}}
+	keyState.AddResponse(http.StatusOK, jsonResponse("The key's state", "KeyState"))
+	keyState.AddResponse(http.StatusNotFound, jsonResponse("No key with that name", "OpenAIError"))
+	doc.AddOperation("/admin/keys/{name}/state", http.MethodGet, keyState)
+
+	revive := keyActionOperation("reviveKey", "Return a dead key to rotation without waiting for its cooldown")
+	doc.AddOperation("/admin/keys/{name}/revive", http.MethodPost, revive)
+
+	kill := keyActionOperation("killKey", "Take a key out of rotation until it is revived")
+	doc.AddOperation("/admin/keys/{name}/kill", http.MethodPost, kill)
+
+	pause := keyActionOperation("pauseKey", "Take a key out of rotation until it is resumed, without a cooldown")
+	pause.AddResponse(http.StatusConflict, jsonResponse("The key is being removed", "OpenAIError"))
+	doc.AddOperation("/admin/keys/{name}/pause", http.MethodPost, pause)
+
+	resume := keyActionOperation("resumeKey", "Return a paused key to rotation")
+	resume.AddResponse(http.StatusConflict, jsonResponse("The key is not paused", "OpenAIError"))
+	doc.AddOperation("/admin/keys/{name}/resume", http.MethodPost, resume)
+
+	snapshot := adminOperation("createKeyPoolSnapshot", "Write the key pool state to the snapshot file")
+	snapshot.Description = "Writes active and dead keys with their usage to admin.snapshot_path, or admin.state_path when it is unset; a new instance restores the dead keys at startup."
+	snapshot.AddResponse(http.StatusOK, jsonResponse("Snapshot written", "SnapshotResponse"))
+	snapshot.AddResponse(http.StatusNotFound, jsonResponse("No snapshot path configured", "OpenAIError"))
+	snapshot.AddResponse(http.StatusInternalServerError, jsonResponse("The snapshot could not be written", "OpenAIError"))
+	doc.AddOperation("/admin/snapshot", http.MethodPost, snapshot)
+
+	usage := adminOperation("getUsage", "Report request totals and per-key usage")
+	usage.AddResponse(http.StatusOK, jsonResponse("Usage since startup", "UsageResponse"))
+	doc.AddOperation("/admin/usage", http.MethodGet, usage)
+
+	projection := adminOperation("getUsageProjection", "Project the monthly cost from the current request rate")
+	projection.Description = "Multiplies the request rate over the last minute by 30 days and the cost of a request with the average token counts since startup."
+	projection.AddResponse(http.StatusOK, jsonResponse("Current rate and projected monthly cost", "UsageProjectionResponse"))
+	doc.AddOperation("/admin/usage/projection", http.MethodGet, projection)
+
+	userUsage := adminOperation("getUserUsage", "Report the end users with the most tokens")
+	userUsage.Description = "Usage is attributed to the " + handler.UserIDHeader + " request header, or the client IP without it."
+	userUsage.Parameters = openapi3.Parameters{{
+		Value: openapi3.NewQueryParameter("limit").
+			WithDescription(fmt.Sprintf("Number of users to list; default %d.", handler.DefaultTopUsers)).
+			WithSchema(openapi3.NewIntegerSchema().WithMin(1)),
+	}}
+	userUsage.AddResponse(http.StatusOK, jsonResponse("Top users by token count", "UserUsageResponse"))
+	userUsage.AddResponse(http.StatusBadRequest, jsonResponse("Invalid limit", "OpenAIError"))
+	doc.AddOperation("/admin/usage/users", http.MethodGet, userUsage)
+
+	resetUserUsage := adminOperation("resetUserUsage", "Reset a user's usage counters")
+	resetUserUsage.Parameters = openapi3.Parameters{{
+		Value: openapi3.NewPathParameter("id").
+			WithDescription("User ID, as listed by GET /admin/usage/users.").
+			WithSchema(openapi3.NewStringSchema()),
+	}}
+	resetUserUsage.AddResponse(http.StatusOK, jsonResponse("The counters before the reset", "UserUsageEntry"))
+	resetUserUsage.AddResponse(http.StatusNotFound, jsonResponse("No usage recorded for that user", "OpenAIError"))
+	doc.AddOperation("/admin/usage/users/{id}", http.MethodDelete, resetUserUsage)
+
+	cacheEntries := adminOperation("listCacheEntries", "List the response cache entries with their age and idle time")
+	cacheEntries.Parameters = openapi3.Parameters{
+		{Value: openapi3.NewQueryParameter("offset").
+			WithDescription("Number of entries to skip; default 0.").
+			WithSchema(openapi3.NewIntegerSchema().WithMin(0))},
+		{Value: openapi3.NewQueryParameter("limit").
+			WithDescription(fmt.Sprintf("Number of entries to list; default %d.", handler.DefaultCacheEntriesLimit)).
+			WithSchema(openapi3.NewIntegerSchema().WithMin(1))},
+	}
+	cacheEntries.AddResponse(http.StatusOK, jsonResponse("A page of cache entries, ordered by key", "CacheEntriesResponse"))
+	cacheEntries.AddResponse(http.StatusBadRequest, jsonResponse("Invalid offset or limit", "OpenAIError"))
+	doc.AddOperation("/admin/cache/entries", http.MethodGet, cacheEntries)
+
+	configSchema := adminOperation("getConfigSchema", "JSON Schema of the configuration file")
+	configSchema.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription("A JSON Schema document describing config.yaml").
+		WithContent(openapi3.NewContentWithSchema(openapi3.NewObjectSchema(), []string{"application/json"})))
+	doc.AddOperation("/admin/config/schema", http.MethodGet, configSchema)
+
+	configCurrent := adminOperation("getCurrentConfig", "The running configuration with API keys masked")
+	configCurrent.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription("The configuration, valid against GET /admin/config/schema; secrets are left out").
+		WithContent(openapi3.NewContentWithSchema(openapi3.NewObjectSchema(), []string{"application/json"})))
+	configCurrent.AddResponse(http.StatusNotFound, jsonResponse("The router was started without a configuration", "OpenAIError"))
+	doc.AddOperation("/admin/config/current", http.MethodGet, configCurrent)
+
+	setCooldown := adminOperation("setCooldown", "Change how long dead keys wait before they are revived, until the next restart")
+	setCooldown.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("SetCooldownRequest")),
+	}
+	setCooldown.AddResponse(http.StatusOK, jsonResponse("The new and previous cooldown", "CooldownResponse"))
+	setCooldown.AddResponse(http.StatusBadRequest, jsonResponse("Missing or negative cooldown_seconds", "OpenAIError"))
+	doc.AddOperation("/admin/config/cooldown", http.MethodPut, setCooldown)
+
+	setStrategy := adminOperation("setStrategy", "Switch the key rotation strategy, until the next restart")
+	setStrategy.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("SetStrategyRequest")),
+	}
+	setStrategy.AddResponse(http.StatusOK, jsonResponse("The new and previous strategy", "StrategyResponse"))
+	setStrategy.AddResponse(http.StatusBadRequest, jsonResponse("Missing or unknown strategy", "OpenAIError"))
+	doc.AddOperation("/admin/config/strategy", http.MethodPut, setStrategy)
+
+	getLogLevel := adminOperation("getLogLevel", "The log level in use and the configured one")
+	getLogLevel.AddResponse(http.StatusOK, jsonResponse("The current and configured log level", "LogLevelResponse"))
+	getLogLevel.AddResponse(http.StatusNotFound, jsonResponse("The log level cannot be changed at runtime", "OpenAIError"))
+	doc.AddOperation("/admin/log-level", http.MethodGet, getLogLevel)
+
+	setLogLevel := adminOperation("setLogLevel", "Change the log level until admin.log_level_revert_seconds pass")
+	setLogLevel.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("SetLogLevelRequest")),
+	}
+	setLogLevel.AddResponse(http.StatusOK, jsonResponse("The new level and when it reverts", "LogLevelResponse"))
+	setLogLevel.AddResponse(http.StatusBadRequest, jsonResponse("Missing or unknown level", "OpenAIError"))
+	setLogLevel.AddResponse(http.StatusNotFound, jsonResponse("The log level cannot be changed at runtime", "OpenAIError"))
+	doc.AddOperation("/admin/log-level", http.MethodPut, setLogLevel)
+
+	setBaseURL := adminOperation("setProviderBaseURL", "Point a provider's requests at a new base URL until the next restart")
+	setBaseURL.Parameters = openapi3.Parameters{{
+		Value: openapi3.NewPathParameter("type").
+			WithDescription("Provider type, such as google.").
+			WithSchema(openapi3.NewStringSchema()),
+	}}
+	setBaseURL.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("SetBaseURLRequest")),
+	}
+	setBaseURL.AddResponse(http.StatusOK, jsonResponse("The new and previous base URL", "ProviderBaseURLResponse"))
+	setBaseURL.AddResponse(http.StatusBadRequest, jsonResponse("Missing or non-https base_url", "OpenAIError"))
+	setBaseURL.AddResponse(http.StatusNotFound, jsonResponse("Unknown provider", "OpenAIError"))
+	doc.AddOperation("/admin/providers/{type}/base-url", http.MethodPut, setBaseURL)
+
+	metricsStream := adminOperation("streamMetrics", "Stream live key pool and traffic metrics")
+	metricsStream.Description = "Server-sent events: a \"metrics\" event every second whose data is a MetricsEvent, and a \":keep-alive\" comment every 30 seconds."
+	metricsStream.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription("Event stream of MetricsEvent payloads").
+		WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/event-stream"})))
+	doc.AddOperation("/admin/metrics/stream", http.MethodGet, metricsStream)
+
+	keyHealth := adminOperation("getKeyHealth", "Key deaths per hour, dead keys and how long keys stay dead")
+	keyHealth.AddResponse(http.StatusOK, jsonResponse("Key turnover report", "KeyHealth"))
+	doc.AddOperation("/admin/metrics/key-health", http.MethodGet, keyHealth)
+
+	latencyStats := adminOperation("getLatencyStats", "Response time percentiles per route over the last requests")
+	latencyStats.AddResponse(http.StatusOK, jsonResponse("Latency percentiles in milliseconds", "LatencyStatsResponse"))
+	doc.AddOperation("/admin/stats/latency", http.MethodGet, latencyStats)
+
+	specJSON := openapi3.NewOperation()
+	specJSON.OperationID = "getOpenAPIJSON"
+	specJSON.Summary = "OpenAPI document (JSON)"
+	specJSON.Tags = []string{"ops"}
+	specJSON.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription("OpenAPI document").
+		WithContent(openapi3.NewContentWithSchema(openapi3.NewObjectSchema(), []string{"application/json"})))
+	doc.AddOperation("/openapi.json", http.MethodGet, specJSON)
+
+	specYAML := openapi3.NewOperation()
+	specYAML.OperationID = "getOpenAPIYAML"
+	specYAML.Summary = "OpenAPI document (YAML)"
+	specYAML.Tags = []string{"ops"}
+	specYAML.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription("OpenAPI document").
+		WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"application/yaml"})))
+	doc.AddOperation("/openapi.yaml", http.MethodGet, specYAML)
+
+	return doc, nil
+}
+
+// chatCompletionOperation builds the chat completion operation under the given operationId.
+func chatCompletionOperation(operationID string) *openapi3.Operation {
+	op := openapi3.NewOperation()
+	op.OperationID = operationID
+	op.Summary = "Create a chat completion (OpenAI-compatible)"
+	op.Tags = []string{"chat"}
+	op.Parameters = append(geminiExtensionParameters(), &openapi3.ParameterRef{
+		Value: openapi3.NewHeaderParameter(handler.IdempotencyKeyHeader).
+			WithDescription("Replays the stored response of an earlier successful request with the same key, for 24 hours, without calling the provider. Echoed in " + handler.IdempotencyKeyResponseHeader + ".").
+			WithSchema(openapi3.NewStringSchema()),
+	})
+	op.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithRequired(true).
+			WithJSONSchemaRef(schemaRef("OpenAIRequest")),
+	}
+	ok := withAttemptHeaders(jsonResponse("Chat completion, or a stream of chat.completion.chunk server-sent events ending in data: [DONE] when the request sets stream or accepts text/event-stream", "OpenAIResponse"))
+	ok.Content[handler.ContentTypeEventStream] = openapi3.NewMediaType().WithSchema(openapi3.NewStringSchema())
+	op.AddResponse(http.StatusOK, ok)
+	op.AddResponse(http.StatusBadRequest, jsonResponse("Invalid request", "OpenAIError"))
+	op.AddResponse(http.StatusForbidden, jsonResponse("Safety override not allowed for this client", "OpenAIError"))
+	op.AddResponse(http.StatusConflict, jsonResponse("A request with the same Idempotency-Key is still being processed", "OpenAIError"))
+	op.AddResponse(http.StatusTooManyRequests, busyResponse())
+	op.AddResponse(http.StatusBadGateway, jsonResponse("Provider returned an invalid response", "OpenAIError"))
+	op.AddResponse(http.StatusServiceUnavailable, unavailableResponse())
+	return op
+}
+
+// geminiExtensionParameters describes the optional X-Gemini-* request headers.
+func geminiExtensionParameters() openapi3.Parameters {
+	topK := openapi3.NewHeaderParameter(handler.HeaderGeminiTopK).
+		WithDescription("Gemini generationConfig.topK for this request.").
+		WithSchema(openapi3.NewIntegerSchema().WithMin(1))
+
+	threshold := openapi3.NewHeaderParameter(handler.HeaderGeminiSafetyThreshold).
+		WithDescription("Gemini safety threshold applied to every harm category.").
+		WithSchema(openapi3.NewStringSchema().WithEnum(
+			adapter.SafetyBlockNone, adapter.SafetyBlockOnlyHigh,
+			adapter.SafetyBlockMediumAndAbove, adapter.SafetyBlockLowAndAbove,
+		))
+
+	level := openapi3.NewHeaderParameter(handler.HeaderGeminiSafetyLevel).
+		WithDescription("Shorthand safety level; none requires an allowlisted client. Cannot be combined with " + handler.HeaderGeminiSafetyThreshold + ".").
+		WithSchema(openapi3.NewStringSchema().WithEnum("strict", "moderate", "none"))
+
+	thinking := openapi3.NewHeaderParameter(handler.HeaderGeminiThinkingBudget).
+		WithDescription("Gemini thinking budget in tokens; 0 turns thinking off. The reasoning is not returned but counts as completion tokens.").
+		WithSchema(openapi3.NewIntegerSchema().WithMin(0).WithMax(adapter.MaxGeminiThinkingBudget))
+
+	return openapi3.Parameters{{Value: topK}, {Value: threshold}, {Value: level}, {Value: thinking}}
+}
+
+// busyResponse describes the 429 sent when every key is busy and the request
+// could not be queued or waited too long.
+func busyResponse() *openapi3.Response {
+	resp := jsonResponse("All keys are at their concurrency limit", "OpenAIError")
+	resp.Headers = openapi3.Headers{
+		"Retry-After": &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+			Description: "Seconds to wait before retrying.",
+			Schema:      openapi3.NewIntegerSchema().NewRef(),
+		}}},
+	}
+	return resp
+}
+
+// unavailableResponse describes the 503 sent when every key is exhausted or
+// the router is at capacity.
+func unavailableResponse() *openapi3.Response {
+	resp := jsonResponse("All keys exhausted or the router is at capacity", "OpenAIError")
+	resp.Headers = openapi3.Headers{
+		"Retry-After": &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+			Description: "Seconds until the first dead key returns to rotation; sent only while every key is dead.",
+			Schema:      openapi3.NewIntegerSchema().WithMin(1).NewRef(),
+		}}},
+	}
+	return resp
+}
+
+// withAttemptHeaders documents the key attempt headers on resp.
+func withAttemptHeaders(resp *openapi3.Response) *openapi3.Response {
+	if resp.Headers == nil {
+		resp.Headers = openapi3.Headers{}
+	}
+	resp.Headers[handler.HeaderKeyAttemptCount] = &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+		Description: "Number of keys tried for the request; omitted when proxy.expose_attempt_header is false.",
+		Schema:      openapi3.NewIntegerSchema().WithMin(1).NewRef(),
+	}}}
+	resp.Headers[handler.HeaderProvider] = &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+		Description: "Adapter of the key that served the request, such as gemini.",
+		Schema:      openapi3.NewStringSchema().NewRef(),
+	}}}
+	resp.Headers[handler.HeaderProviderAttempts] = &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+		Description: "Comma-separated adapters of every key tried, in order; omitted when proxy.expose_attempt_header is false.",
+		Schema:      openapi3.NewStringSchema().NewRef(),
+	}}}
+	return resp
+}
+
+// adminOperation builds an operation guarded by the admin token.
+func adminOperation(operationID, summary string) *openapi3.Operation {
+	op := openapi3.NewOperation()
+	op.OperationID = operationID
+	op.Summary = summary
+	op.Tags = []string{"admin"}
+	op.Security = openapi3.NewSecurityRequirements().
+		With(openapi3.NewSecurityRequirement().Authenticate(adminSecurityScheme))
+	op.AddResponse(http.StatusUnauthorized, jsonResponse("Missing or invalid admin token", "OpenAIError"))
+	return op
+}
+
+// keyActionOperation builds an admin operation on the key named in the path.
+func keyActionOperation(operationID, summary string) *openapi3.Operation {
+	op := adminOperation(operationID, summary)
+	op.Parameters = openapi3.Parameters{{
+		Value: openapi3.NewPathParameter("name").
+			WithDescription("Configured key name, as listed by GET /admin/keys.").
+			WithSchema(openapi3.NewStringSchema()),
+	}}
+	op.AddResponse(http.StatusOK, jsonResponse("Key status and pool counts after the action", "KeyActionResponse"))
+	op.AddResponse(http.StatusNotFound, jsonResponse("No key with that name", "OpenAIError"))
+	return op
+}
+
+// addReflectedSchemas generates component schemas from the adapter and handler types.
+func addReflectedSchemas(doc *openapi3.T) error {
+	types := map[string]interface{}{
+		"OpenAIRequest":   adapter.OpenAIRequest{},
+		"OpenAIResponse":  adapter.OpenAIResponse{},
+		"OpenAIError":     adapter.OpenAIError{},
+		"OpenAIModelList": adapter.OpenAIModelList{},
+		"HealthResponse":  handler.HealthResponse{},
+
+		"ReadinessResponse": handler.ReadinessResponse{},
+
+		"OpenAIEmbeddingRequest":  adapter.OpenAIEmbeddingRequest{},
+		"OpenAIEmbeddingResponse": adapter.OpenAIEmbeddingResponse{},
+
+		"KeyListResponse":    handler.KeyListResponse{},
+		"KeyLatencyResponse": handler.KeyLatencyResponse{},
+		"KeyActionResponse":  handler.KeyActionResponse{},
+		"SnapshotResponse":   handler.SnapshotResponse{},
+		"KeyStatus":          handler.KeyStatus{},
+		"AddKeyRequest":      handler.AddKeyRequest{},
+		"UsageResponse":      handler.UsageResponse{},
+		"UserUsageResponse":  handler.UserUsageResponse{},
+		"UserUsageEntry":     handler.UserUsageEntry{},
+		"MetricsEvent":       handler.MetricsEvent{},
+
+		"CacheEntriesResponse": handler.CacheEntriesResponse{},
+
+		"KeyState":             domain.KeyState{},
+		"KeyStateListResponse": handler.KeyStateListResponse{},
+
+		"AddKeysRequest":    handler.AddKeysRequest{},
+		"RemoveKeysRequest": handler.RemoveKeysRequest{},
+		"BatchKeysResponse": handler.BatchKeysResponse{},
+
+		"SetBaseURLRequest":       handler.SetBaseURLRequest{},
+		"ProviderBaseURLResponse": handler.ProviderBaseURLResponse{},
+
+		"SetCooldownRequest": handler.SetCooldownRequest{},
+		"CooldownResponse":   handler.CooldownResponse{},
+
+		"SetStrategyRequest": handler.SetStrategyRequest{},
+		"StrategyResponse":   handler.StrategyResponse{},
+
+		"OpenAIContentPart": adapter.OpenAIContentPart{},
+
+		"SetLogLevelRequest": handler.SetLogLevelRequest{},
+		"LogLevelResponse":   handler.LogLevelResponse{},
+
+		"BatchCompletionRequest":  handler.BatchCompletionRequest{},
+		"BatchCompletionResponse": handler.BatchCompletionResponse{},
+		"BatchResult":             handler.BatchResult{},
+
+		"UsageProjectionResponse": handler.UsageProjectionResponse{},
+
+		"KeyHealth": metrics.KeyHealth{},
+
+		"LatencyStatsResponse": handler.LatencyStatsResponse{},
+	}
+
+	for name, value := range types {
+		ref, err := openapi3gen.NewSchemaRefForValue(value, doc.Components.Schemas)
+		if err != nil {
+			return fmt.Errorf("failed to generate schema for %s: %w", name, err)
+		}
+		doc.Components.Schemas[name] = ref
+	}
+
+	// Mark the fields the handler rejects requests without.
+	chat := doc.Components.Schemas["OpenAIRequest"].Value
+	chat.Required = []string{"model", "messages"}
+
+	// StopSequences unmarshals from either a string or an array of strings.
+	chat.Properties["stop"] = openapi3.NewOneOfSchema(
+		openapi3.NewStringSchema(),
+		openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()),
+	).NewRef()
+
+	// OpenAIMessage unmarshals its content from a string or an array of
+	// content parts. The message schema is shared with responses, whose
+	// content is always a string, so the request gets its own copy.
+	messages := ownProperty(chat, "messages")
+	message := *messages.Items.Value
+	message.Properties = maps.Clone(message.Properties)
+	message.Properties["content"] = &openapi3.SchemaRef{Value: &openapi3.Schema{OneOf: openapi3.SchemaRefs{
+		openapi3.NewStringSchema().NewRef(),
+		arrayOf("OpenAIContentPart"),
+	}}}
+	messages.Items = openapi3.NewSchemaRef("", &message)
+	contentPart := doc.Components.Schemas["OpenAIContentPart"].Value
+	contentPart.Required = []string{"type"}
+	ownProperty(contentPart, "type").WithEnum(adapter.ContentPartText, adapter.ContentPartFileURI)
+
+	// ToolChoice unmarshals from a mode string or a function object.
+	toolFunction := openapi3.NewObjectSchema().
+		WithProperty("name", openapi3.NewStringSchema())
+	toolFunction.Required = []string{"name"}
+	toolChoice := openapi3.NewObjectSchema().
+		WithProperty("type", openapi3.NewStringSchema().WithEnum("function")).
+		WithProperty("function", toolFunction)
+	toolChoice.Required = []string{"type", "function"}
+	chat.Properties["tool_choice"] = openapi3.NewOneOfSchema(
+		openapi3.NewStringSchema().WithEnum(adapter.ToolChoiceNone, adapter.ToolChoiceAuto, adapter.ToolChoiceRequired),
+		toolChoice,
+	).NewRef()
+
+	// openapi3gen has no notion of nullable; param, code and details are
+	// pointers without omitempty, so the handler always sends them and sends
+	// null when unset.
+	detail := doc.Components.Schemas["OpenAIError"].Value.Properties["error"].Value
+	detail.Required = []string{"message", "type", "param", "code", "details"}
+	for _, field := range []string{"param", "code", "details"} {
+		ownProperty(detail, field).Nullable = true
+	}
+	doc.Components.Schemas["OpenAIError"].Value.Required = []string{"error"}
+
+	// Choices always carry logprobs, null when the provider reports none.
+	choice := doc.Components.Schemas["OpenAIResponse"].Value.Properties["choices"].Value.Items.Value
+	ownProperty(choice, "logprobs").Nullable = true
+
+	// EmbeddingInput unmarshals from either a string or an array of strings.
+	embedding := doc.Components.Schemas["OpenAIEmbeddingRequest"].Value
+	embedding.Required = []string{"input"}
+	embedding.Properties["input"] = openapi3.NewOneOfSchema(
+		openapi3.NewStringSchema(),
+		openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()),
+	).NewRef()
+	ownProperty(embedding, "encoding_format").WithEnum("float")
+
+	// Gemini returns at most MaxGeminiCandidates candidates per request.
+	ownProperty(doc.Components.Schemas["OpenAIRequest"].Value, "n").
+		WithMin(1).WithMax(adapter.MaxGeminiCandidates)
+
+	ownProperty(doc.Components.Schemas["HealthResponse"].Value, "status").WithEnum("healthy", "degraded")
+
+	ownProperty(doc.Components.Schemas["ReadinessResponse"].Value, "status").WithEnum("ready", "not_ready")
+
+	ownProperty(doc.Components.Schemas["KeyStatus"].Value, "status").WithEnum("active", "over_quota", "dead")
+	doc.Components.Schemas["KeyListResponse"].Value.Properties["data"] = arrayOf("KeyStatus")
+	doc.Components.Schemas["AddKeyRequest"].Value.Required = []string{"key", "provider", "name"}
+	doc.Components.Schemas["SetBaseURLRequest"].Value.Required = []string{"base_url"}
+	doc.Components.Schemas["SetCooldownRequest"].Value.Required = []string{"cooldown_seconds"}
+	ownProperty(doc.Components.Schemas["SetCooldownRequest"].Value, "cooldown_seconds").WithMin(0)
+	doc.Components.Schemas["SetStrategyRequest"].Value.Required = []string{"strategy"}
+	ownProperty(doc.Components.Schemas["SetStrategyRequest"].Value, "strategy").
+		WithEnum("round-robin", "random", "weighted", "least-used", "priority")
+	doc.Components.Schemas["SetLogLevelRequest"].Value.Required = []string{"level"}
+	ownProperty(doc.Components.Schemas["SetLogLevelRequest"].Value, "level").WithEnum("debug", "info", "warn", "error")
+
+	// Batch types embed the chat types; point at the shared components instead of inline copies.
+	batchReq := doc.Components.Schemas["BatchCompletionRequest"].Value
+	batchReq.Required = []string{"requests"}
+	batchReq.Properties["requests"] = arrayOf("OpenAIRequest")
+
+	batchResult := doc.Components.Schemas["BatchResult"].Value
+	batchResult.Required = []string{"id"}
+	batchResult.Properties["response"] = schemaRef("OpenAIResponse")
+
+	batchResp := doc.Components.Schemas["BatchCompletionResponse"].Value
+	batchResp.Required = []string{"results"}
+	batchResp.Properties["results"] = arrayOf("BatchResult")
+
+	return nil
+}
+
+// ownProperty replaces a property's schema with a private copy and returns it.
+// openapi3gen reuses one schema value for every field of the same Go type, so
+// editing a property in place would leak into its siblings.
+func ownProperty(s *openapi3.Schema, name string) *openapi3.Schema {
+	clone := *s.Properties[name].Value
+	s.Properties[name] = openapi3.NewSchemaRef("", &clone)
+	return &clone
+}
+
+// schemaRef returns a reference to a named component schema.
+func schemaRef(name string) *openapi3.SchemaRef {
+	return openapi3.NewSchemaRef(schemaRefPrefix+name, nil)
+}
+
+// arrayOf returns an array schema whose items reference a named component schema.
+func arrayOf(name string) *openapi3.SchemaRef {
+	return &openapi3.SchemaRef{Value: &openapi3.Schema{Type: "array", Items: schemaRef(name)}}
+}
+
+// jsonResponse builds a JSON response referencing a named component schema.
+func jsonResponse(description, schema string) *openapi3.Response {
+	return openapi3.NewResponse().
+		WithDescription(description).
+		WithJSONSchemaRef(schemaRef(schema))
+}
@@ -0,0 +1,172 @@
+package spec
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestBuild_ValidDocument(t *testing.T) {
+	doc, err := Build("test")
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	// Round-trip through the loader so $refs are resolved the same way a client would.
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	loaded, err := openapi3.NewLoader().LoadFromData(raw)
+	if err != nil {
+		t.Fatalf("LoadFromData() error = %v", err)
+	}
+	if err := loaded.Validate(context.Background()); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestBuild_Paths(t *testing.T) {
+	doc, err := Build("test")
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		method string
+	}{
+		{"/v1/chat/completions", "POST"},
+		{"/chat/completions", "POST"},
+		{"/v1/chat/completions/batch", "POST"},
+		{"/v1/embeddings", "POST"},
+		{"/v1/embeddings", "GET"},
+		{"/v1/models", "GET"},
+		{"/health", "GET"},
+		{"/healthz/ready", "GET"},
+		{"/metrics", "GET"},
+		{"/admin/keys", "GET"},
+		{"/admin/keys", "POST"},
+		{"/admin/keys/{name}", "DELETE"},
+		{"/admin/keys/batch", "POST"},
+		{"/admin/keys/batch", "DELETE"},
+		{"/admin/keys/latency", "GET"},
+		{"/admin/keys/state", "GET"},
+		{"/admin/keys/{name}/state", "GET"},
+		{"/admin/keys/{name}/revive", "POST"},
+		{"/admin/keys/{name}/kill", "POST"},
+		{"/admin/snapshot", "POST"},
+		{"/admin/usage", "GET"},
+		{"/admin/usage/projection", "GET"},
+		{"/admin/usage/users", "GET"},
+		{"/admin/usage/users/{id}", "DELETE"},
+		{"/admin/cache/entries", "GET"},
+		{"/admin/config/schema", "GET"},
+		{"/admin/config/current", "GET"},
+		{"/admin/config/cooldown", "PUT"},
+		{"/admin/log-level", "GET"},
+		{"/admin/log-level", "PUT"},
+		{"/admin/metrics/stream", "GET"},
+		{"/admin/metrics/key-health", "GET"},
+		{"/admin/stats/latency", "GET"},
+		{"/openapi.json", "GET"},
+		{"/openapi.yaml", "GET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			item := doc.Paths.Find(tt.path)
+			if item == nil {
+				t.Fatalf("path %s missing from spec", tt.path)
+			}
+			if item.GetOperation(tt.method) == nil {
+				t.Errorf("%s %s missing from spec", tt.method, tt.path)
+			}
+		})
+	}
+}
+
+func TestBuild_RequestSchemaFromAdapter(t *testing.T) {
+	doc, err := Build("test")
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	req, ok := doc.Components.Schemas["OpenAIRequest"]
+	if !ok {
+		t.Fatal("OpenAIRequest schema missing")
+	}
+	for _, field := range []string{"model", "messages", "temperature", "max_tokens", "stream"} {
+		if _, ok := req.Value.Properties[field]; !ok {
+			t.Errorf("OpenAIRequest schema missing property %q", field)
+		}
+	}
+}
+
+func TestBuild_ChatAliasIsIndependent(t *testing.T) {
+	doc, err := Build("test")
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	chat := doc.Paths.Find("/v1/chat/completions").Post
+	alias := doc.Paths.Find("/chat/completions").Post
+
+	if chat == alias {
+		t.Fatal("alias shares the *Operation with /v1/chat/completions")
+	}
+	if chat.RequestBody == alias.RequestBody {
+		t.Error("alias shares RequestBody with /v1/chat/completions")
+	}
+	if chat.Deprecated {
+		t.Error("/v1/chat/completions marked deprecated")
+	}
+	if !alias.Deprecated {
+		t.Error("/chat/completions not marked deprecated")
+	}
+
+	// Mutating one response map must not leak into the other.
+	alias.Responses["418"] = &openapi3.ResponseRef{Value: openapi3.NewResponse()}
+	if _, leaked := chat.Responses["418"]; leaked {
+		t.Error("alias shares Responses with /v1/chat/completions")
+	}
+}
+
+func TestBuild_SchemaEditsStayLocal(t *testing.T) {
+	doc, err := Build("test")
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	detail := doc.Components.Schemas["OpenAIError"].Value.Properties["error"].Value
+	embedding := doc.Components.Schemas["OpenAIEmbeddingRequest"].Value
+
+	tests := []struct {
+		name   string
+		schema *openapi3.Schema
+	}{
+		{"OpenAIError.error.message", detail.Properties["message"].Value},
+		{"OpenAIError.error.type", detail.Properties["type"].Value},
+		{"OpenAIEmbeddingRequest.model", embedding.Properties["model"].Value},
+		{"OpenAIEmbeddingRequest.user", embedding.Properties["user"].Value},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.schema.Nullable {
+				t.Error("unexpectedly nullable")
+			}
+			if len(tt.schema.Enum) > 0 {
+				t.Errorf("unexpected enum %v", tt.schema.Enum)
+			}
+		})
+	}
+
+	for _, field := range []string{"param", "code", "details"} {
+		if !detail.Properties[field].Value.Nullable {
+			t.Errorf("%s must be nullable", field)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package testutil
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockStreamChunks is the number of chunks a ConfigurableMockProvider
+// streams for a streamGenerateContent request.
+const MockStreamChunks = 3
+
+// MockBehavior is how a ConfigurableMockProvider answers.
+type MockBehavior struct {
+	// ResponseDelay holds back the whole answer, status included.
+	ResponseDelay time.Duration
+
+	// FirstChunkDelay holds back the first chunk of a streamed answer,
+	// after the status was sent.
+	FirstChunkDelay time.Duration
+
+	// FailAfterChunks aborts the connection of a streamed answer after
+	// that many chunks; 0 streams every chunk.
+	FailAfterChunks int
+
+	// ResponseBody is the Gemini JSON sent, once or as every chunk of a
+	// streamed answer. Nil sends GeminiResponseBody for a 200 and
+	// GeminiErrorBody for other statuses.
+	ResponseBody []byte
+
+	// StatusCode is the status sent; 0 sends 200.
+	StatusCode int
+
+	// FailRate is the share of requests, from 0 to 1, answered with 503
+	// and GeminiErrorBody instead.
+	FailRate float64
+}
+
+// ConfigurableMockProvider is a Gemini API stand-in for tests, answering
+// generateContent and streamGenerateContent requests as its MockBehavior
+// says. Behaviors can be set per API key and changed mid-test through
+// Control. A delayed answer is dropped as soon as the request is cancelled.
+type ConfigurableMockProvider struct {
+	mu       sync.Mutex
+	behavior MockBehavior
+	keys     map[string]MockBehavior
+	calls    int
+	byKey    map[string]int
+}
+
+// NewConfigurableMockProvider returns a provider answering every key as b
+// says. Serve it with httptest.NewServer.
+func NewConfigurableMockProvider(b MockBehavior) *ConfigurableMockProvider {
+	return &ConfigurableMockProvider{
+		behavior: b,
+		keys:     make(map[string]MockBehavior),
+		byKey:    make(map[string]int),
+	}
+}
+
+// MockControl changes how a ConfigurableMockProvider answers while it
+// serves requests. It is safe for concurrent use.
+type MockControl struct {
+	p *ConfigurableMockProvider
+}
+
+// Control returns the control of p.
+func (p *ConfigurableMockProvider) Control() MockControl {
+	return MockControl{p: p}
+}
+
+// Set replaces the behavior of keys without one of their own.
+func (c MockControl) Set(b MockBehavior) {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	c.p.behavior = b
+}
+
+// SetKey sets the behavior of requests made with key.
+func (c MockControl) SetKey(key string, b MockBehavior) {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	c.p.keys[key] = b
+}
+
+// ClearKeys drops the behaviors set with SetKey.
+func (c MockControl) ClearKeys() {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	c.p.keys = make(map[string]MockBehavior)
+}
+
+// Calls returns the number of requests received.
+func (c MockControl) Calls() int {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	return c.p.calls
+}
+
+// CallsByKey returns the number of requests received per API key.
+func (c MockControl) CallsByKey() map[string]int {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	byKey := make(map[string]int, len(c.p.byKey))
+	for k, n := range c.p.byKey {
+		byKey[k] = n
+	}
+	return byKey
+}
+
+// Reset zeroes the call counts.
+func (c MockControl) Reset() {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	c.p.calls = 0
+	c.p.byKey = make(map[string]int)
+}
+
+// ServeHTTP implements http.Handler.
+func (p *ConfigurableMockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The server only notices a client leaving once the body was read.
+	io.Copy(io.Discard, r.Body)
+
+	key := r.URL.Query().Get("key")
+	p.mu.Lock()
+	p.calls++
+	p.byKey[key]++
+	b, ok := p.keys[key]
+	if !ok {
+		b = p.behavior
+	}
+	p.mu.Unlock()
+
+	status := b.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := b.ResponseBody
+	if b.FailRate > 0 && rand.Float64() < b.FailRate {
+		status, body = http.StatusServiceUnavailable, nil
+	}
+	if body == nil && status == http.StatusOK {
+		body = GeminiResponseBody("Hello from the mock provider.")
+	} else if body == nil {
+		body = GeminiErrorBody(status, "mock provider error")
+	}
+
+	if !sleep(r, b.ResponseDelay) {
+		return
+	}
+	if status != http.StatusOK || !strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	if !sleep(r, b.FirstChunkDelay) {
+		return
+	}
+	for i := range MockStreamChunks {
+		if b.FailAfterChunks > 0 && i == b.FailAfterChunks {
+			panic(http.ErrAbortHandler)
+		}
+		w.Write([]byte("data: "))
+		w.Write(body)
+		w.Write([]byte("\n\n"))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// sleep waits for d and reports whether r was still wanted afterwards.
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// GeminiResponseBody returns a Gemini generateContent response answering
+// text, with 10 prompt and 15 completion tokens.
+func GeminiResponseBody(text string) []byte {
+	return mustJSON(map[string]any{
+		"candidates": []map[string]any{{
+			"content": map[string]any{
+				"parts": []map[string]any{{"text": text}},
+				"role":  "model",
+			},
+			"finishReason": "STOP",
+			"index":        0,
+		}},
+		"usageMetadata": map[string]any{
+			"promptTokenCount":     10,
+			"candidatesTokenCount": 15,
+			"totalTokenCount":      25,
+		},
+	})
+}
+
+// GeminiErrorBody returns a Gemini error response for an HTTP status.
+func GeminiErrorBody(code int, message string) []byte {
+	return mustJSON(map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"status":  geminiStatus(code),
+		},
+	})
+}
+
+// geminiStatus returns the Gemini error status for an HTTP status.
+func geminiStatus(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
+
+func mustJSON(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
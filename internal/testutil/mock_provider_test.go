@@ -0,0 +1,160 @@
+package testutil
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	generatePath = "/models/gemini-1.5-pro:generateContent"
+	streamPath   = "/models/gemini-1.5-pro:streamGenerateContent"
+)
+
+func post(t *testing.T, ctx context.Context, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func TestConfigurableMockProvider_Responses(t *testing.T) {
+	mock := NewConfigurableMockProvider(MockBehavior{})
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	ctl := mock.Control()
+	ctl.SetKey("limited", MockBehavior{StatusCode: http.StatusTooManyRequests})
+
+	get := func(key string) (int, string) {
+		resp, err := post(t, context.Background(), server.URL+generatePath+"?key="+key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("ok"); code != http.StatusOK || body != string(GeminiResponseBody("Hello from the mock provider.")) {
+		t.Errorf("default answer = %d %s", code, body)
+	}
+	if code, body := get("limited"); code != http.StatusTooManyRequests || !strings.Contains(body, "RESOURCE_EXHAUSTED") {
+		t.Errorf("key answer = %d %s, want 429 RESOURCE_EXHAUSTED", code, body)
+	}
+
+	// Behavior changes apply to the next request.
+	ctl.Set(MockBehavior{StatusCode: http.StatusInternalServerError, ResponseBody: []byte(`{"custom":true}`)})
+	if code, body := get("ok"); code != http.StatusInternalServerError || body != `{"custom":true}` {
+		t.Errorf("answer after Set = %d %s, want 500 with the custom body", code, body)
+	}
+	if got := ctl.Calls(); got != 3 {
+		t.Errorf("Calls() = %d, want 3", got)
+	}
+	if got := ctl.CallsByKey(); got["ok"] != 2 || got["limited"] != 1 {
+		t.Errorf("CallsByKey() = %v, want ok:2 limited:1", got)
+	}
+
+	// Without its own behavior a key falls back to the shared one.
+	ctl.ClearKeys()
+	ctl.Set(MockBehavior{FailRate: 1})
+	if code, body := get("limited"); code != http.StatusServiceUnavailable || !strings.Contains(body, "UNAVAILABLE") {
+		t.Errorf("answer with FailRate 1 = %d %s, want 503 UNAVAILABLE", code, body)
+	}
+	ctl.Reset()
+	if got := ctl.Calls(); got != 0 || len(ctl.CallsByKey()) != 0 {
+		t.Errorf("Calls() = %d, CallsByKey() = %v after Reset, want none", got, ctl.CallsByKey())
+	}
+}
+
+func TestConfigurableMockProvider_ResponseDelay(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	server := httptest.NewServer(NewConfigurableMockProvider(MockBehavior{ResponseDelay: delay}))
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := post(t, context.Background(), server.URL+generatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("answered after %v, want at least %v", elapsed, delay)
+	}
+}
+
+func TestConfigurableMockProvider_DelayCancelled(t *testing.T) {
+	server := httptest.NewServer(NewConfigurableMockProvider(MockBehavior{ResponseDelay: time.Hour}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := post(t, ctx, server.URL+generatePath); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// Close waits for the handler, which stops waiting once the client left.
+	start := time.Now()
+	server.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("handler ran %v after the request was cancelled", elapsed)
+	}
+}
+
+func TestConfigurableMockProvider_Stream(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	server := httptest.NewServer(NewConfigurableMockProvider(MockBehavior{FirstChunkDelay: delay}))
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := post(t, context.Background(), server.URL+streamPath+"?alt=sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("headers after %v, want them before the %v first chunk delay", elapsed, delay)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	chunks := 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "data: ") {
+			continue
+		}
+		if chunks == 0 && time.Since(start) < delay {
+			t.Errorf("first chunk after %v, want at least %v", time.Since(start), delay)
+		}
+		chunks++
+	}
+	if chunks != MockStreamChunks {
+		t.Errorf("received %d chunks, want %d", chunks, MockStreamChunks)
+	}
+}
+
+func TestConfigurableMockProvider_FailAfterChunks(t *testing.T) {
+	server := httptest.NewServer(NewConfigurableMockProvider(MockBehavior{FailAfterChunks: 1}))
+	defer server.Close()
+
+	resp, err := post(t, context.Background(), server.URL+streamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		t.Error("stream ended cleanly, want the connection aborted")
+	}
+	if got := strings.Count(string(body), "data: "); got != 1 {
+		t.Errorf("received %d chunks before the abort, want 1", got)
+	}
+}
@@ -0,0 +1,45 @@
+// Package testutil holds the TestMain setup shared by the test packages.
+package testutil
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Seed seeds the random sources of tests so runs are reproducible.
+const Seed = 1
+
+// Main runs the tests of m and exits, failing when goroutines are still
+// running afterwards, as goleak.VerifyTestMain does. During benchmarks the
+// default slog logger discards its output.
+func Main(m *testing.M, opts ...goleak.Option) {
+	flag.Parse()
+	if f := flag.Lookup("test.bench"); f != nil && f.Value.String() != "" {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+	goleak.VerifyTestMain(m, opts...)
+}
+
+// Rand returns a random source seeded with Seed that is safe for
+// concurrent use.
+func Rand() *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewPCG(Seed, Seed)})
+}
+
+// lockedSource serializes calls to a rand.Source.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
@@ -1,6 +1,7 @@
 // Package ui provides cyberpunk-styled console output for the HPN Router.
 // It creates a visually impressive terminal experience with colorized logs,
-// status badges, and ASCII art.
+// status badges, and ASCII art. Per-request output goes through the active
+// Theme, see SetTheme.
 package ui
 
 import (
@@ -14,6 +15,9 @@ import (
 // COLOR DEFINITIONS - Cyberpunk Theme
 // ══════════════════════════════════════════════════════════════════════════════
 
+// CyberpunkTheme is the default Theme: colored badges and emoji.
+type CyberpunkTheme struct{}
+
 var (
 	// Badge colors
 	successBadge   = color.New(color.BgGreen, color.FgBlack, color.Bold)
@@ -48,7 +52,7 @@ var (
 
 // PrintSuccess logs a successful request with green styling.
 // Format: [200 OK] message
-func PrintSuccess(status int, msg string) {
+func (CyberpunkTheme) PrintSuccess(status int, msg string) {
 	successBadge.Printf(" %d OK ", status)
 	fmt.Print(" ")
 	successText.Println(msg)
@@ -56,7 +60,7 @@ func PrintSuccess(status int, msg string) {
 
 // PrintSwitching logs a key failover with warning styling.
 // Format: ⚠️ [SWITCHING] fromKey → toKey
-func PrintSwitching(fromKey, toKey string) {
+func (CyberpunkTheme) PrintSwitching(fromKey, toKey string) {
 	fmt.Print("⚠️  ")
 	warningBadge.Print("[SWITCHING]")
 	fmt.Print(" ")
@@ -67,7 +71,7 @@ func PrintSwitching(fromKey, toKey string) {
 
 // PrintDeadKey logs when a key is marked as dead.
 // Format: 💀 [DEAD KEY] key marked as dead (reason)
-func PrintDeadKey(key string, reason string) {
+func (CyberpunkTheme) PrintDeadKey(key string, reason string) {
 	fmt.Print("💀 ")
 	errorBadge.Print(" DEAD KEY ")
 	fmt.Print(" ")
@@ -85,7 +89,7 @@ func PrintRouterInfo(msg string) {
 
 // PrintChaChing logs the money saved message in bright green.
 // Format: 💸 CHA-CHING! You saved $X.XX on this request. Total Saved: $X.XX
-func PrintChaChing(saved, total string) {
+func (CyberpunkTheme) PrintChaChing(saved, total string) {
 	moneyGreen.Print("💸 CHA-CHING! ")
 	fmt.Print("You saved ")
 	moneyGreen.Print(saved)
@@ -95,7 +99,7 @@ func PrintChaChing(saved, total string) {
 
 // PrintCacheHit logs a cache hit with lightning styling.
 // Format: ⚡ CACHE HIT | key:xxxx...xxxx | 0ms
-func PrintCacheHit(cacheKey string, latency time.Duration) {
+func (CyberpunkTheme) PrintCacheHit(cacheKey string, latency time.Duration) {
 	neonBlue.Print("⚡ CACHE HIT ")
 	fmt.Print("| key:")
 	mutedText.Print(maskKeyShort(cacheKey))
@@ -109,7 +113,9 @@ func PrintCacheHit(cacheKey string, latency time.Duration) {
 
 // PrintRequest logs a request with styled output.
 // Color-codes status, method, and latency for quick visual parsing.
-func PrintRequest(method, path string, status int, latency time.Duration, keyUsed string) {
+// A streamed response passes its time to first token as ttft, shown after
+// the latency; pass 0 otherwise.
+func (CyberpunkTheme) PrintRequest(method, path string, status int, latency, ttft time.Duration, keyUsed string) {
 	// Timestamp
 	mutedText.Printf("%s ", time.Now().Format("15:04:05"))
 
@@ -128,6 +134,11 @@ func PrintRequest(method, path string, status int, latency time.Duration, keyUse
 	printLatency(latency)
 	fmt.Print(" ")
 
+	// Time to first token of streamed responses
+	if ttft > 0 {
+		mutedText.Printf("ttft:%dms ", ttft.Milliseconds())
+	}
+
 	// Key used (masked)
 	if keyUsed != "" {
 		mutedText.Printf("key:%s", maskKeyShort(keyUsed))
@@ -222,7 +233,7 @@ func PrintStartupInfo(host string, port int, activeKeys int, strategy string) {
 	if activeKeys > 0 {
 		successText.Printf("%d", activeKeys)
 	} else {
-		errorText.Printf("%d")
+		errorText.Printf("%d", activeKeys)
 	}
 	fmt.Print(" | Strategy: ")
 	accentText.Println(strategy)
@@ -239,6 +250,12 @@ func printEndpoints() {
 	fmt.Print(" /v1/chat/completions ")
 	mutedText.Print("  Chat completion (OpenAI-compatible)")
 	mutedText.Println(" │")
+
+	mutedText.Print("  │ ")
+	methodPOST.Print(" POST ")
+	fmt.Print(" /v1/embeddings       ")
+	mutedText.Print("  Create embeddings                ")
+	mutedText.Println(" │")
 	
 	mutedText.Print("  │ ")
 	methodGET.Print(" GET  ")
@@ -251,6 +268,18 @@ func printEndpoints() {
 	fmt.Print(" /health              ")
 	mutedText.Print("  Health check                     ")
 	mutedText.Println(" │")
+
+	mutedText.Print("  │ ")
+	methodGET.Print(" GET  ")
+	fmt.Print(" /metrics             ")
+	mutedText.Print("  Prometheus metrics               ")
+	mutedText.Println(" │")
+
+	mutedText.Print("  │ ")
+	methodGET.Print(" GET  ")
+	fmt.Print(" /openapi.json        ")
+	mutedText.Print("  OpenAPI 3.0 specification        ")
+	mutedText.Println(" │")
 	
 	mutedText.Println("  └─────────────────────────────────────────────────────────┘")
 	fmt.Println()
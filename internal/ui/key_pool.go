@@ -0,0 +1,80 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+)
+
+// KeyStatus is one row of the key pool table. All fields are preformatted
+// for display.
+type KeyStatus struct {
+	Name       string
+	Status     string
+	Provider   string
+	Weight     string
+	LastUsed   string
+	ErrorCount string
+}
+
+// Status symbols use single-attribute colors so every escape sequence has
+// the same length and tabwriter keeps the columns aligned.
+var (
+	activeSymbol   = color.New(color.FgGreen).Sprint("●")
+	deadSymbol     = color.New(color.FgRed).Sprint("✖")
+	halfOpenSymbol = color.New(color.FgYellow).Sprint("◑")
+	otherSymbol    = color.New(color.FgHiBlack).Sprint("○")
+)
+
+// PrintKeyPoolStatus prints keys as an aligned table with a colored status
+// symbol per key, followed by a totals row.
+// Format: [KEY POOL] 2 keys: 1 active, 1 dead, 0 half-open
+func PrintKeyPoolStatus(keys []KeyStatus) {
+	counts := make(map[string]int)
+	errors := 0
+	for _, k := range keys {
+		counts[k.Status]++
+		if n, err := strconv.Atoi(k.ErrorCount); err == nil {
+			errors += n
+		}
+	}
+	summary := []string{
+		fmt.Sprintf("%d active", counts["active"]),
+		fmt.Sprintf("%d dead", counts["dead"]),
+		fmt.Sprintf("%d half-open", counts["half_open"]),
+	}
+	if other := len(keys) - counts["active"] - counts["dead"] - counts["half_open"]; other > 0 {
+		summary = append(summary, fmt.Sprintf("%d other", other))
+	}
+
+	fmt.Fprintln(color.Output)
+	infoBadge.Fprint(color.Output, "[KEY POOL]")
+	fmt.Fprintf(color.Output, " %d keys: %s\n", len(keys), strings.Join(summary, ", "))
+
+	w := tabwriter.NewWriter(color.Output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  \tNAME\tSTATUS\tPROVIDER\tWEIGHT\tLAST USED\tERRORS")
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			statusSymbol(k.Status), k.Name, k.Status, k.Provider, k.Weight, k.LastUsed, k.ErrorCount)
+	}
+	fmt.Fprintf(w, "  %s\tTOTAL\t%d/%d active\t\t\t\t%d\n", otherSymbol, counts["active"], len(keys), errors)
+	w.Flush()
+	fmt.Fprintln(color.Output)
+}
+
+// statusSymbol returns the colored symbol for a KeyState status.
+func statusSymbol(status string) string {
+	switch status {
+	case "active":
+		return activeSymbol
+	case "dead":
+		return deadSymbol
+	case "half_open":
+		return halfOpenSymbol
+	default:
+		return otherSymbol
+	}
+}
@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestPrintKeyPoolStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []KeyStatus
+		want string
+	}{
+		{"no keys", nil, "0 keys: 0 active, 0 dead, 0 half-open"},
+		{"empty fields", []KeyStatus{{}}, "1 keys: 0 active, 0 dead, 0 half-open, 1 other"},
+		{
+			name: "mixed statuses",
+			keys: []KeyStatus{
+				{Name: "primary", Status: "active", Provider: "google", Weight: "2", LastUsed: "15:04:05", ErrorCount: "0"},
+				{Name: "secondary", Status: "dead", Provider: "google", Weight: "1", LastUsed: "never", ErrorCount: "3"},
+				{Name: "backup", Status: "half_open", Provider: "openai", Weight: "-", LastUsed: "never", ErrorCount: "1"},
+				{Name: "old", Status: "draining", ErrorCount: "n/a"},
+			},
+			want: "4 keys: 1 active, 1 dead, 1 half-open, 1 other",
+		},
+	}
+
+	out := color.Output
+	t.Cleanup(func() { color.Output = out })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			color.Output = &buf
+
+			PrintKeyPoolStatus(tt.keys)
+
+			if !strings.Contains(buf.String(), tt.want) || !strings.Contains(buf.String(), "TOTAL") {
+				t.Errorf("output = %q, want totals %q", buf.String(), tt.want)
+			}
+			for _, k := range tt.keys {
+				if !strings.Contains(buf.String(), k.Name) {
+					t.Errorf("output = %q, want key %q listed", buf.String(), k.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// Theme names accepted by NewTheme and logging.ui_theme.
+const (
+	ThemeCyberpunk = "cyberpunk"
+	ThemeMinimal   = "minimal"
+	ThemeNone      = "none"
+)
+
+// Theme renders the per-request console output.
+type Theme interface {
+	PrintSuccess(status int, msg string)
+	PrintSwitching(fromKey, toKey string)
+	PrintDeadKey(key, reason string)
+	PrintRequest(method, path string, status int, latency, ttft time.Duration, keyUsed string)
+	PrintChaChing(saved, total string)
+	PrintCacheHit(cacheKey string, latency time.Duration)
+}
+
+// NewTheme returns the theme called name, or nil when there is none.
+func NewTheme(name string) Theme {
+	switch name {
+	case ThemeCyberpunk:
+		return CyberpunkTheme{}
+	case ThemeMinimal:
+		return NewMinimalTheme(os.Stdout)
+	case ThemeNone:
+		return NullTheme{}
+	default:
+		return nil
+	}
+}
+
+// theme is the active theme of the package-level Print functions.
+var theme Theme = CyberpunkTheme{}
+
+// SetTheme makes t the theme of the package-level Print functions. It is
+// not safe to call while requests are served; set it at startup.
+func SetTheme(t Theme) {
+	theme = t
+}
+
+// PrintSuccess logs a successful request with the active theme.
+func PrintSuccess(status int, msg string) { theme.PrintSuccess(status, msg) }
+
+// PrintSwitching logs a key failover with the active theme.
+func PrintSwitching(fromKey, toKey string) { theme.PrintSwitching(fromKey, toKey) }
+
+// PrintDeadKey logs a key marked as dead with the active theme.
+func PrintDeadKey(key, reason string) { theme.PrintDeadKey(key, reason) }
+
+// PrintChaChing logs the money saved by a request with the active theme.
+func PrintChaChing(saved, total string) { theme.PrintChaChing(saved, total) }
+
+// PrintCacheHit logs a cache hit with the active theme.
+func PrintCacheHit(cacheKey string, latency time.Duration) { theme.PrintCacheHit(cacheKey, latency) }
+
+// PrintRequest logs a completed request with the active theme. A streamed
+// response passes its time to first token as ttft; pass 0 otherwise.
+func PrintRequest(method, path string, status int, latency, ttft time.Duration, keyUsed string) {
+	theme.PrintRequest(method, path, status, latency, ttft, keyUsed)
+}
+
+// MinimalTheme writes plain ASCII lines in the format of the standard log
+// package, without colors or emoji, for log aggregators.
+type MinimalTheme struct {
+	logger *log.Logger
+}
+
+// NewMinimalTheme returns a MinimalTheme writing to w.
+func NewMinimalTheme(w io.Writer) MinimalTheme {
+	return MinimalTheme{logger: log.New(w, "", log.LstdFlags)}
+}
+
+// PrintSuccess implements Theme.
+func (t MinimalTheme) PrintSuccess(status int, msg string) {
+	t.logger.Printf("[%d OK] %s", status, msg)
+}
+
+// PrintSwitching implements Theme.
+func (t MinimalTheme) PrintSwitching(fromKey, toKey string) {
+	t.logger.Printf("[SWITCHING] %s -> %s", maskKeyShort(fromKey), maskKeyShort(toKey))
+}
+
+// PrintDeadKey implements Theme.
+func (t MinimalTheme) PrintDeadKey(key, reason string) {
+	t.logger.Printf("[DEAD KEY] %s marked as dead (%s)", maskKeyShort(key), reason)
+}
+
+// PrintRequest implements Theme.
+func (t MinimalTheme) PrintRequest(method, path string, status int, latency, ttft time.Duration, keyUsed string) {
+	format := "%s %s %d %dms"
+	args := []any{method, path, status, latency.Milliseconds()}
+	if ttft > 0 {
+		format += " ttft:%dms"
+		args = append(args, ttft.Milliseconds())
+	}
+	if keyUsed != "" {
+		format += " key:%s"
+		args = append(args, maskKeyShort(keyUsed))
+	}
+	t.logger.Printf(format, args...)
+}
+
+// PrintChaChing implements Theme.
+func (t MinimalTheme) PrintChaChing(saved, total string) {
+	t.logger.Printf("[SAVED] %s on this request, total saved %s", saved, total)
+}
+
+// PrintCacheHit implements Theme.
+func (t MinimalTheme) PrintCacheHit(cacheKey string, latency time.Duration) {
+	t.logger.Printf("[CACHE HIT] key:%s %dms", maskKeyShort(cacheKey), latency.Milliseconds())
+}
+
+// NullTheme discards all output.
+type NullTheme struct{}
+
+// PrintSuccess implements Theme.
+func (NullTheme) PrintSuccess(int, string) {}
+
+// PrintSwitching implements Theme.
+func (NullTheme) PrintSwitching(string, string) {}
+
+// PrintDeadKey implements Theme.
+func (NullTheme) PrintDeadKey(string, string) {}
+
+// PrintRequest implements Theme.
+func (NullTheme) PrintRequest(string, string, int, time.Duration, time.Duration, string) {}
+
+// PrintChaChing implements Theme.
+func (NullTheme) PrintChaChing(string, string) {}
+
+// PrintCacheHit implements Theme.
+func (NullTheme) PrintCacheHit(string, time.Duration) {}
@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// printAll calls every Print function of the active theme.
+func printAll() {
+	PrintSuccess(200, "request served")
+	PrintSwitching("AIzaSyOldKey1234567890", "AIzaSyNewKey1234567890")
+	PrintDeadKey("AIzaSyOldKey1234567890", "rate limited")
+	PrintRequest("POST", "/v1/chat/completions", 200, 120*time.Millisecond, 40*time.Millisecond, "AIzaSyNewKey1234567890")
+	PrintChaChing("$0.0012", "$1.23")
+	PrintCacheHit("0123456789abcdef", 0)
+}
+
+func TestNewTheme(t *testing.T) {
+	for _, name := range []string{ThemeCyberpunk, ThemeMinimal, ThemeNone} {
+		if NewTheme(name) == nil {
+			t.Errorf("NewTheme(%q) = nil, want a theme", name)
+		}
+	}
+	if got := NewTheme("neon"); got != nil {
+		t.Errorf("NewTheme(neon) = %T, want nil", got)
+	}
+}
+
+func TestNullTheme(t *testing.T) {
+	stdout, out := os.Stdout, color.Output
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var colored bytes.Buffer
+	os.Stdout, color.Output = w, &colored
+	SetTheme(NullTheme{})
+	t.Cleanup(func() {
+		os.Stdout, color.Output = stdout, out
+		SetTheme(CyberpunkTheme{})
+	})
+
+	printAll()
+	w.Close()
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(plain) + colored.Len(); n != 0 {
+		t.Errorf("output = %q%q, want 0 bytes", plain, colored.String())
+	}
+}
+
+func TestMinimalTheme(t *testing.T) {
+	var buf bytes.Buffer
+	SetTheme(NewMinimalTheme(&buf))
+	t.Cleanup(func() { SetTheme(CyberpunkTheme{}) })
+
+	printAll()
+	if buf.Len() == 0 {
+		t.Fatal("output is empty")
+	}
+	for i, b := range buf.Bytes() {
+		if b >= 0x80 || b == 0x1b {
+			t.Fatalf("output = %q, byte %d is %#x, want plain ASCII", buf.String(), i, b)
+		}
+	}
+	if got := buf.String(); !strings.Contains(got, "POST /v1/chat/completions 200 120ms ttft:40ms key:AIza...7890") {
+		t.Errorf("output = %q, want the request line", got)
+	}
+}
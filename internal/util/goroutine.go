@@ -0,0 +1,68 @@
+// Package util holds small helpers shared by the router's packages.
+package util
+
+import (
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// DefaultRestartDelay is how long SafeGo waits before restarting a
+// goroutine that panicked.
+const DefaultRestartDelay = time.Second
+
+// GoOption configures SafeGo.
+type GoOption func(*goConfig)
+
+type goConfig struct {
+	restartDelay time.Duration
+	onPanic      func(recovered any)
+}
+
+// WithRestartDelay sets how long to wait before restarting after a panic.
+func WithRestartDelay(d time.Duration) GoOption {
+	return func(cfg *goConfig) { cfg.restartDelay = d }
+}
+
+// WithOnPanic calls fn with each recovered panic value, e.g. to count them.
+func WithOnPanic(fn func(recovered any)) GoOption {
+	return func(cfg *goConfig) { cfg.onPanic = fn }
+}
+
+// SafeGo runs fn in a new goroutine. If fn panics, the panic is logged and
+// fn is started again after the restart delay, so a bug does not silently
+// stop background work. The goroutine ends when fn returns normally.
+func SafeGo(fn func(), logger *slog.Logger, opts ...GoOption) {
+	cfg := goConfig{restartDelay: DefaultRestartDelay}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	go func() {
+		for runRecovered(fn, logger, cfg) {
+			time.Sleep(cfg.restartDelay)
+		}
+	}()
+}
+
+// runRecovered runs fn and reports whether it panicked.
+func runRecovered(fn func(), logger *slog.Logger, cfg goConfig) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			logger.Error("background goroutine panicked, restarting",
+				slog.Any("panic", r),
+				slog.Duration("restart_in", cfg.restartDelay),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if cfg.onPanic != nil {
+				cfg.onPanic(r)
+			}
+		}
+	}()
+	fn()
+	return false
+}
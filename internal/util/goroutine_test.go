@@ -0,0 +1,65 @@
+package util
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestSafeGo_RestartsAfterPanic(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	var runs, panics atomic.Int32
+	done := make(chan struct{})
+	SafeGo(func() {
+		if runs.Add(1) < 3 {
+			panic("boom")
+		}
+		close(done)
+	}, logger,
+		WithRestartDelay(time.Millisecond),
+		WithOnPanic(func(r any) {
+			if r != "boom" {
+				t.Errorf("recovered = %v, want boom", r)
+			}
+			panics.Add(1)
+		}),
+	)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("fn not restarted: runs = %d", runs.Load())
+	}
+	if got := panics.Load(); got != 2 {
+		t.Errorf("panics = %d, want 2", got)
+	}
+	if got := strings.Count(buf.String(), "background goroutine panicked"); got != 2 {
+		t.Errorf("logged %d panics, want 2:\n%s", got, buf.String())
+	}
+}
+
+func TestSafeGo_ReturnEndsGoroutine(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var runs atomic.Int32
+	done := make(chan struct{})
+	SafeGo(func() {
+		runs.Add(1)
+		close(done)
+	}, nil, WithRestartDelay(time.Millisecond))
+
+	<-done
+	time.Sleep(10 * time.Millisecond)
+	if got := runs.Load(); got != 1 {
+		t.Errorf("runs = %d, want 1", got)
+	}
+}
@@ -0,0 +1,283 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The keys and cooldown the router is started with in docker-compose.yml.
+const (
+	integrationKey1 = "AIzaSyIntegrationKey0001"
+	integrationKey2 = "AIzaSyIntegrationKey0002"
+	keyCooldown     = 2 * time.Second
+)
+
+var (
+	routerURL = envOr("ROUTER_URL", "http://localhost:8080")
+	mockURL   = envOr("MOCK_URL", "http://localhost:8081")
+	client    = &http.Client{Timeout: 30 * time.Second}
+)
+
+// TestMain runs the tests only with INTEGRATION=true, against the router and
+// mock provider started by docker-compose.yml:
+//
+//	docker compose -f tests/integration/docker-compose.yml up -d --build
+//	INTEGRATION=true go test ./tests/integration/
+func TestMain(m *testing.M) {
+	if os.Getenv("INTEGRATION") != "true" {
+		fmt.Println("skipping integration tests, set INTEGRATION=true to run them")
+		os.Exit(0)
+	}
+	for _, url := range []string{routerURL + "/health", mockURL + "/mock/stats"} {
+		if err := waitReady(url, 30*time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "integration: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// waitReady polls url until it answers 200 or timeout passes.
+func waitReady(url string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not ready after %s", url, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// setupMock configures the mock provider, zeroes its stats and registers a
+// cleanup that restores healthy keys and waits for the router to revive any
+// key the test killed.
+func setupMock(t *testing.T, cfg MockProviderConfig) {
+	t.Helper()
+	setMockConfig(t, cfg)
+	resp, err := client.Post(mockURL+"/mock/reset", "application/json", nil)
+	if err != nil {
+		t.Fatalf("reset mock: %v", err)
+	}
+	resp.Body.Close()
+
+	t.Cleanup(func() {
+		setMockConfig(t, MockProviderConfig{})
+		time.Sleep(keyCooldown + 500*time.Millisecond)
+	})
+}
+
+func setMockConfig(t *testing.T, cfg MockProviderConfig) {
+	t.Helper()
+	body, _ := json.Marshal(cfg)
+	req, _ := http.NewRequest(http.MethodPut, mockURL+"/mock/config", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("configure mock: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("configure mock: status = %d, want 204", resp.StatusCode)
+	}
+}
+
+func mockStats(t *testing.T) MockProviderStats {
+	t.Helper()
+	resp, err := client.Get(mockURL + "/mock/stats")
+	if err != nil {
+		t.Fatalf("mock stats: %v", err)
+	}
+	defer resp.Body.Close()
+	var stats MockProviderStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("mock stats: %v", err)
+	}
+	return stats
+}
+
+// chat sends a chat completion with content through the router and returns
+// the status and body. Distinct contents keep the router's cache out of the
+// way.
+func chat(t *testing.T, content string) (int, []byte) {
+	t.Helper()
+	status, body, err := postChat(content)
+	if err != nil {
+		t.Fatalf("chat completion: %v", err)
+	}
+	return status, body
+}
+
+func postChat(content string) (int, []byte, error) {
+	body, _ := json.Marshal(map[string]any{
+		"model":    "gpt-4",
+		"messages": []map[string]string{{"role": "user", "content": content}},
+	})
+	resp, err := client.Post(routerURL+"/v1/chat/completions", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// uniqueContent returns a prompt no earlier request used.
+func uniqueContent(t *testing.T, n int) string {
+	return fmt.Sprintf("%s %d %d", t.Name(), time.Now().UnixNano(), n)
+}
+
+func TestIntegration_NormalFlow(t *testing.T) {
+	setupMock(t, MockProviderConfig{})
+
+	status, body := chat(t, uniqueContent(t, 0))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", status, body)
+	}
+	var resp struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("invalid response JSON: %v", err)
+	}
+	if resp.Object != "chat.completion" || len(resp.Choices) != 1 {
+		t.Fatalf("response = %s, want one chat.completion choice", body)
+	}
+	if got := resp.Choices[0].Message.Content; got != "Hello from the mock provider." {
+		t.Errorf("content = %q, want the mock provider's text", got)
+	}
+	if got := mockStats(t).Calls; got != 1 {
+		t.Errorf("provider calls = %d, want 1", got)
+	}
+}
+
+func TestIntegration_AllKeysExhaustedRecovery(t *testing.T) {
+	setupMock(t, MockProviderConfig{KeyResponses: map[string]int{
+		integrationKey1: http.StatusTooManyRequests,
+		integrationKey2: http.StatusTooManyRequests,
+	}})
+
+	status, body := chat(t, uniqueContent(t, 0))
+	if status == http.StatusOK {
+		t.Fatalf("status = 200 with every key rate limited: %s", body)
+	}
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error.Message == "" {
+		t.Errorf("body = %s, want an OpenAI error", body)
+	}
+
+	// The provider recovers; the keys return once their cooldown has passed.
+	setMockConfig(t, MockProviderConfig{})
+	time.Sleep(keyCooldown + 500*time.Millisecond)
+	if status, body := chat(t, uniqueContent(t, 1)); status != http.StatusOK {
+		t.Errorf("status = %d after the cooldown, want 200: %s", status, body)
+	}
+}
+
+func TestIntegration_CacheHit(t *testing.T) {
+	setupMock(t, MockProviderConfig{})
+
+	content := uniqueContent(t, 0)
+	status, first := chat(t, content)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", status, first)
+	}
+	status, second := chat(t, content)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d on the repeat, want 200: %s", status, second)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("repeat body = %s, want the cached %s", second, first)
+	}
+	if got := mockStats(t).Calls; got != 1 {
+		t.Errorf("provider calls = %d, want 1 with the repeat served from cache", got)
+	}
+}
+
+func TestIntegration_ConcurrentFlood(t *testing.T) {
+	setupMock(t, MockProviderConfig{ResponseDelay: 20 * time.Millisecond})
+
+	const requests = 100
+	statuses := make([]int, requests)
+	errs := make([]error, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], _, errs[i] = postChat(uniqueContent(t, i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, status := range statuses {
+		if errs[i] != nil || status != http.StatusOK {
+			t.Errorf("request %d: status = %d, error = %v, want 200", i, status, errs[i])
+		}
+	}
+	stats := mockStats(t)
+	if stats.Calls != requests {
+		t.Errorf("provider calls = %d, want %d", stats.Calls, requests)
+	}
+	if stats.CallsByKey[integrationKey1] == 0 || stats.CallsByKey[integrationKey2] == 0 {
+		t.Errorf("calls by key = %v, want both keys used", stats.CallsByKey)
+	}
+}
+
+func TestIntegration_KeyRevivalAfterCooldown(t *testing.T) {
+	setupMock(t, MockProviderConfig{KeyResponses: map[string]int{
+		integrationKey1: http.StatusTooManyRequests,
+	}})
+
+	// Whichever key the rotation starts with, key1 is tried and killed
+	// within two requests, and every request still succeeds.
+	for i := 0; i < 4; i++ {
+		if status, body := chat(t, uniqueContent(t, i)); status != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", status, body)
+		}
+	}
+	if got := mockStats(t).CallsByKey[integrationKey1]; got != 1 {
+		t.Fatalf("key1 calls = %d, want 1 before it is marked dead", got)
+	}
+
+	setMockConfig(t, MockProviderConfig{})
+	time.Sleep(keyCooldown + 500*time.Millisecond)
+	for i := 4; i < 8; i++ {
+		if status, body := chat(t, uniqueContent(t, i)); status != http.StatusOK {
+			t.Fatalf("status = %d after the cooldown, want 200: %s", status, body)
+		}
+	}
+	if got := mockStats(t).CallsByKey[integrationKey1]; got < 2 {
+		t.Errorf("key1 calls = %d, want it back in rotation after the cooldown", got)
+	}
+}
@@ -0,0 +1,147 @@
+// Package integration runs the router and a mock Gemini provider as separate
+// services and tests them end to end over the network.
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hpn/hpn-g-router/internal/testutil"
+)
+
+// Environment variables configuring a MockProviderServer.
+const (
+	// EnvMockResponseDelay delays every answer, as a Go duration such as "50ms".
+	EnvMockResponseDelay = "MOCK_RESPONSE_DELAY"
+
+	// EnvMockFailRate is the share of requests, from 0 to 1, answered with 503.
+	EnvMockFailRate = "MOCK_FAIL_RATE"
+
+	// EnvMockKeyResponses fixes the status returned for keys, as
+	// comma-separated key=status pairs such as "key1=429,key2=200".
+	EnvMockKeyResponses = "MOCK_KEY_RESPONSES"
+)
+
+// MockProviderConfig is how a MockProviderServer answers.
+type MockProviderConfig struct {
+	// ResponseDelay is how long every answer is held back.
+	ResponseDelay time.Duration `json:"response_delay"`
+
+	// FailRate is the share of requests answered with 503, from 0 to 1.
+	FailRate float64 `json:"fail_rate"`
+
+	// KeyResponses maps API keys to the status they get. Keys not listed
+	// get 200 with a completion.
+	KeyResponses map[string]int `json:"key_responses"`
+}
+
+// MockProviderConfigFromEnv reads the MOCK_* environment variables.
+func MockProviderConfigFromEnv() (MockProviderConfig, error) {
+	var cfg MockProviderConfig
+	if v := os.Getenv(EnvMockResponseDelay); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("%s: %q is not a non-negative duration", EnvMockResponseDelay, v)
+		}
+		cfg.ResponseDelay = d
+	}
+	if v := os.Getenv(EnvMockFailRate); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return cfg, fmt.Errorf("%s: %q must be between 0 and 1", EnvMockFailRate, v)
+		}
+		cfg.FailRate = rate
+	}
+	if v := os.Getenv(EnvMockKeyResponses); v != "" {
+		cfg.KeyResponses = make(map[string]int)
+		for _, pair := range strings.Split(v, ",") {
+			key, status, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			code, err := strconv.Atoi(status)
+			if !ok || key == "" || err != nil || code < 200 || code > 599 {
+				return cfg, fmt.Errorf("%s: %q must be key=status", EnvMockKeyResponses, pair)
+			}
+			cfg.KeyResponses[key] = code
+		}
+	}
+	return cfg, nil
+}
+
+// MockProviderStats counts the generateContent calls a MockProviderServer
+// received since it started or was last reset.
+type MockProviderStats struct {
+	Calls      int            `json:"calls"`
+	CallsByKey map[string]int `json:"calls_by_key"`
+}
+
+// MockProviderServer serves a testutil.ConfigurableMockProvider over the
+// network, configured by a MockProviderConfig. Besides the Gemini API it
+// serves control endpoints for tests:
+//
+//	GET  /mock/stats   the MockProviderStats
+//	PUT  /mock/config  replace the MockProviderConfig
+//	POST /mock/reset   zero the stats
+type MockProviderServer struct {
+	provider *testutil.ConfigurableMockProvider
+}
+
+// NewMockProviderServer returns a server answering as cfg says.
+func NewMockProviderServer(cfg MockProviderConfig) *MockProviderServer {
+	m := &MockProviderServer{provider: testutil.NewConfigurableMockProvider(testutil.MockBehavior{})}
+	m.SetConfig(cfg)
+	return m
+}
+
+// ServeHTTP implements http.Handler.
+func (m *MockProviderServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/mock/stats" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, m.Stats())
+	case r.URL.Path == "/mock/config" && r.Method == http.MethodPut:
+		var cfg MockProviderConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		m.SetConfig(cfg)
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/mock/reset" && r.Method == http.MethodPost:
+		m.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, ":generateContent"):
+		m.provider.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Stats returns the calls received so far.
+func (m *MockProviderServer) Stats() MockProviderStats {
+	ctl := m.provider.Control()
+	return MockProviderStats{Calls: ctl.Calls(), CallsByKey: ctl.CallsByKey()}
+}
+
+// SetConfig replaces how the server answers.
+func (m *MockProviderServer) SetConfig(cfg MockProviderConfig) {
+	ctl := m.provider.Control()
+	ctl.ClearKeys()
+	ctl.Set(testutil.MockBehavior{ResponseDelay: cfg.ResponseDelay, FailRate: cfg.FailRate})
+	for key, status := range cfg.KeyResponses {
+		ctl.SetKey(key, testutil.MockBehavior{ResponseDelay: cfg.ResponseDelay, StatusCode: status})
+	}
+}
+
+// Reset zeroes the call counts.
+func (m *MockProviderServer) Reset() {
+	m.provider.Control().Reset()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,33 @@
+// Command mockprovider serves a mock Gemini API for the integration tests,
+// configured by the MOCK_RESPONSE_DELAY, MOCK_FAIL_RATE and
+// MOCK_KEY_RESPONSES environment variables.
+//
+// Usage:
+//
+//	mockprovider [-addr :8081]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/hpn/hpn-g-router/tests/integration"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	flag.Parse()
+
+	cfg, err := integration.MockProviderConfigFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mockprovider: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("mockprovider: listening on %s\n", *addr)
+	if err := http.ListenAndServe(*addr, integration.NewMockProviderServer(cfg)); err != nil {
+		fmt.Fprintf(os.Stderr, "mockprovider: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,387 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/respjson"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/handler"
+)
+
+// OpenAI compatibility suite: the official openai-go client talks to the
+// router, which talks to a scripted Gemini. A client error, a panic or a
+// response missing a field the OpenAI schema requires fails the test.
+
+// compatReply is the text the mock Gemini generates before max_tokens and
+// stop sequences are applied, one token per word.
+const compatReply = "The quick brown fox jumps over the lazy dog"
+
+// mockGemini answers generateContent from the request it receives and keeps
+// the last request for assertions.
+type mockGemini struct {
+	mu   sync.Mutex
+	last adapter.GeminiRequest
+}
+
+func (m *mockGemini) lastRequest() adapter.GeminiRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+func (m *mockGemini) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req adapter.GeminiRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	m.last = req
+	m.mu.Unlock()
+
+	cfg := req.GenerationConfig
+	n := 1
+	if cfg.CandidateCount != nil {
+		n = *cfg.CandidateCount
+	}
+
+	text, finish := compatReply, "STOP"
+	for _, stop := range cfg.StopSequences {
+		if i := strings.Index(text, stop); i >= 0 {
+			text = text[:i]
+		}
+	}
+	words := strings.Fields(text)
+	if cfg.MaxOutputTokens != nil && len(words) > *cfg.MaxOutputTokens {
+		words, finish = words[:*cfg.MaxOutputTokens], "MAX_TOKENS"
+	}
+
+	resp := adapter.GeminiResponse{
+		UsageMetadata: &adapter.GeminiUsageMetadata{
+			PromptTokenCount:     len(req.Contents),
+			CandidatesTokenCount: n * len(words),
+			TotalTokenCount:      len(req.Contents) + n*len(words),
+		},
+	}
+	for i := 0; i < n; i++ {
+		resp.Candidates = append(resp.Candidates, adapter.GeminiCandidate{
+			Content:      adapter.GeminiContent{Role: "model", Parts: []adapter.GeminiPart{{Text: strings.Join(words, " ")}}},
+			FinishReason: finish,
+			Index:        i,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// newCompatClient starts the router in front of a mock Gemini and returns an
+// openai-go client pointed at it.
+func newCompatClient(t *testing.T) (openai.Client, *mockGemini) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	gemini := &mockGemini{}
+	upstream := httptest.NewServer(gemini)
+	t.Cleanup(upstream.Close)
+
+	km := domain.NewKeyManager([]string{"AIzaSyCompatKey0000000000"}, time.Minute)
+	h := handler.NewProxyHandler(km, nil,
+		handler.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		handler.WithAdapterOptions(adapter.WithBaseURL(upstream.URL)),
+	)
+
+	r := gin.New()
+	r.Use(handler.StripAuthHeadersMiddleware())
+	r.POST("/v1/chat/completions", h.HandleChatCompletion)
+	r.GET("/v1/models", h.HandleModels)
+
+	router := httptest.NewServer(r)
+	t.Cleanup(router.Close)
+
+	client := openai.NewClient(
+		option.WithBaseURL(router.URL+"/v1/"),
+		option.WithAPIKey("sk-compat-test"),
+		option.WithMaxRetries(0),
+	)
+	return client, gemini
+}
+
+// requireFields fails the test for every required field the response left
+// out, set to null or sent with the wrong type.
+func requireFields(t *testing.T, what string, fields map[string]respjson.Field) {
+	t.Helper()
+	for name, f := range fields {
+		if !f.Valid() {
+			t.Errorf("%s.%s missing or invalid (raw %q)", what, name, f.Raw())
+		}
+	}
+}
+
+// checkCompletion validates the parts of the chat.completion schema the
+// router produces.
+func checkCompletion(t *testing.T, c *openai.ChatCompletion) {
+	t.Helper()
+
+	requireFields(t, "completion", map[string]respjson.Field{
+		"id":      c.JSON.ID,
+		"object":  c.JSON.Object,
+		"created": c.JSON.Created,
+		"model":   c.JSON.Model,
+		"choices": c.JSON.Choices,
+		"usage":   c.JSON.Usage,
+	})
+	if c.Object != "chat.completion" {
+		t.Errorf("object = %q, want chat.completion", c.Object)
+	}
+	if len(c.Choices) == 0 {
+		t.Fatal("choices is empty")
+	}
+	for i, choice := range c.Choices {
+		what := fmt.Sprintf("choices[%d]", i)
+		requireFields(t, what, map[string]respjson.Field{
+			"index":         choice.JSON.Index,
+			"message":       choice.JSON.Message,
+			"finish_reason": choice.JSON.FinishReason,
+		})
+		requireFields(t, what+".message", map[string]respjson.Field{
+			"role":    choice.Message.JSON.Role,
+			"content": choice.Message.JSON.Content,
+		})
+		if choice.Index != int64(i) {
+			t.Errorf("%s.index = %d, want %d", what, choice.Index, i)
+		}
+		if choice.Message.Role != "assistant" {
+			t.Errorf("%s.message.role = %q, want assistant", what, choice.Message.Role)
+		}
+	}
+
+	requireFields(t, "usage", map[string]respjson.Field{
+		"prompt_tokens":     c.Usage.JSON.PromptTokens,
+		"completion_tokens": c.Usage.JSON.CompletionTokens,
+		"total_tokens":      c.Usage.JSON.TotalTokens,
+	})
+	if c.Usage.TotalTokens != c.Usage.PromptTokens+c.Usage.CompletionTokens {
+		t.Errorf("usage = %+v, want total = prompt + completion", c.Usage)
+	}
+}
+
+func complete(t *testing.T, client openai.Client, params openai.ChatCompletionNewParams) *openai.ChatCompletion {
+	t.Helper()
+	if params.Model == "" {
+		params.Model = openai.ChatModelGPT4
+	}
+	c, err := client.Chat.Completions.New(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Chat.Completions.New() error = %v", err)
+	}
+	checkCompletion(t, c)
+	return c
+}
+
+func TestOpenAICompat_ChatCompletion(t *testing.T) {
+	client, _ := newCompatClient(t)
+
+	c := complete(t, client, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Hello")},
+	})
+
+	if c.Model != openai.ChatModelGPT4 {
+		t.Errorf("model = %q, want %q", c.Model, openai.ChatModelGPT4)
+	}
+	if got := c.Choices[0].Message.Content; got != compatReply {
+		t.Errorf("content = %q, want %q", got, compatReply)
+	}
+	if got := c.Choices[0].FinishReason; got != "stop" {
+		t.Errorf("finish_reason = %q, want stop", got)
+	}
+}
+
+func TestOpenAICompat_SystemMessage(t *testing.T) {
+	client, gemini := newCompatClient(t)
+
+	complete(t, client, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("You are terse."),
+			openai.UserMessage("Hello"),
+		},
+	})
+
+	req := gemini.lastRequest()
+	if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "You are terse." {
+		t.Errorf("systemInstruction = %+v, want the system message", req.SystemInstruction)
+	}
+	if len(req.Contents) != 1 || req.Contents[0].Role != "user" {
+		t.Errorf("contents = %+v, want only the user message", req.Contents)
+	}
+}
+
+func TestOpenAICompat_Temperature(t *testing.T) {
+	client, gemini := newCompatClient(t)
+
+	complete(t, client, openai.ChatCompletionNewParams{
+		Messages:    []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Hello")},
+		Temperature: openai.Float(0.2),
+	})
+
+	if got := gemini.lastRequest().GenerationConfig.Temperature; got == nil || *got != 0.2 {
+		t.Errorf("upstream temperature = %v, want 0.2", got)
+	}
+}
+
+func TestOpenAICompat_MaxTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		params openai.ChatCompletionNewParams
+	}{
+		{"max_tokens", openai.ChatCompletionNewParams{MaxTokens: openai.Int(3)}},
+		{"max_completion_tokens", openai.ChatCompletionNewParams{MaxCompletionTokens: openai.Int(3)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newCompatClient(t)
+			tt.params.Messages = []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Hello")}
+
+			c := complete(t, client, tt.params)
+
+			if got := c.Choices[0].Message.Content; got != "The quick brown" {
+				t.Errorf("content = %q, want the first 3 tokens", got)
+			}
+			if got := c.Choices[0].FinishReason; got != "length" {
+				t.Errorf("finish_reason = %q, want length", got)
+			}
+		})
+	}
+}
+
+func TestOpenAICompat_StopSequences(t *testing.T) {
+	tests := []struct {
+		name string
+		stop openai.ChatCompletionNewParamsStopUnion
+	}{
+		{"string", openai.ChatCompletionNewParamsStopUnion{OfString: openai.String(" jumps")}},
+		{"array", openai.ChatCompletionNewParamsStopUnion{OfStringArray: []string{" jumps", " lazy"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newCompatClient(t)
+
+			c := complete(t, client, openai.ChatCompletionNewParams{
+				Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Hello")},
+				Stop:     tt.stop,
+			})
+
+			if got := c.Choices[0].Message.Content; got != "The quick brown fox" {
+				t.Errorf("content = %q, want the text before the stop sequence", got)
+			}
+			if got := c.Choices[0].FinishReason; got != "stop" {
+				t.Errorf("finish_reason = %q, want stop", got)
+			}
+		})
+	}
+}
+
+func TestOpenAICompat_MultiTurn(t *testing.T) {
+	client, gemini := newCompatClient(t)
+
+	complete(t, client, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage("My name is Ada."),
+			openai.AssistantMessage("Hello Ada."),
+			openai.UserMessage("What is my name?"),
+		},
+	})
+
+	want := []struct{ role, text string }{
+		{"user", "My name is Ada."},
+		{"model", "Hello Ada."},
+		{"user", "What is my name?"},
+	}
+	got := gemini.lastRequest().Contents
+	if len(got) != len(want) {
+		t.Fatalf("contents = %+v, want %d turns", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Role != w.role || got[i].Parts[0].Text != w.text {
+			t.Errorf("turn %d = %s %q, want %s %q", i, got[i].Role, got[i].Parts[0].Text, w.role, w.text)
+		}
+	}
+}
+
+func TestOpenAICompat_MultipleChoices(t *testing.T) {
+	client, _ := newCompatClient(t)
+
+	c := complete(t, client, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Hello")},
+		N:        openai.Int(3),
+	})
+
+	if len(c.Choices) != 3 {
+		t.Errorf("choices = %d, want 3", len(c.Choices))
+	}
+}
+
+func TestOpenAICompat_ErrorFormat(t *testing.T) {
+	client, _ := newCompatClient(t)
+
+	_, err := client.Chat.Completions.New(context.Background(), openai.ChatCompletionNewParams{
+		Model:    openai.ChatModelGPT4,
+		Messages: []openai.ChatCompletionMessageParamUnion{},
+	})
+
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want *openai.Error", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", apiErr.StatusCode)
+	}
+	requireFields(t, "error", map[string]respjson.Field{
+		"message": apiErr.JSON.Message,
+		"type":    apiErr.JSON.Type,
+	})
+	if apiErr.Type != "invalid_request_error" {
+		t.Errorf("error.type = %q, want invalid_request_error", apiErr.Type)
+	}
+}
+
+func TestOpenAICompat_Models(t *testing.T) {
+	client, _ := newCompatClient(t)
+
+	page, err := client.Models.List(context.Background())
+	if err != nil {
+		t.Fatalf("Models.List() error = %v", err)
+	}
+	if len(page.Data) == 0 {
+		t.Fatal("models list is empty")
+	}
+	for i, m := range page.Data {
+		requireFields(t, fmt.Sprintf("data[%d]", i), map[string]respjson.Field{
+			"id":       m.JSON.ID,
+			"object":   m.JSON.Object,
+			"created":  m.JSON.Created,
+			"owned_by": m.JSON.OwnedBy,
+		})
+		if m.Object != "model" {
+			t.Errorf("data[%d].object = %q, want model", i, m.Object)
+		}
+	}
+}
@@ -12,91 +12,40 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/hpn/hpn-g-router/internal/adapter"
 	"github.com/hpn/hpn-g-router/internal/domain"
 	"github.com/hpn/hpn-g-router/internal/handler"
+	"github.com/hpn/hpn-g-router/internal/testutil"
 )
 
-// MockProviderServer creates an httptest server that simulates a Gemini API provider.
-// Logic:
-// - "Bearer KEY_FAIL" -> HTTP 429 (Too Many Requests)
-// - "Bearer KEY_ERROR" -> HTTP 500 (Internal Server Error)
-// - "Bearer KEY_SUCCESS" -> HTTP 200 (OK) with valid OpenAI-compatible JSON
-func NewMockProviderServer(requestCounter *int32) *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Increment request counter
-		if requestCounter != nil {
-			atomic.AddInt32(requestCounter, 1)
-		}
-
-		// Extract API key from URL query parameter (Gemini format: ?key=XXX)
-		apiKey := r.URL.Query().Get("key")
-
-		// Determine response based on API key
-		switch apiKey {
-		case "KEY_FAIL":
-			// Return 429 Too Many Requests (Rate Limited)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusTooManyRequests)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": map[string]interface{}{
-					"code":    429,
-					"message": "Resource has been exhausted (e.g. check quota).",
-					"status":  "RESOURCE_EXHAUSTED",
-				},
-			})
-
-		case "KEY_ERROR":
-			// Return 500 Internal Server Error
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": map[string]interface{}{
-					"code":    500,
-					"message": "Internal server error",
-					"status":  "INTERNAL",
-				},
-			})
-
-		case "KEY_SUCCESS":
-			// Return 200 OK with valid Gemini response
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"candidates": []map[string]interface{}{
-					{
-						"content": map[string]interface{}{
-							"parts": []map[string]interface{}{
-								{"text": "Hello! I'm a mock AI assistant. How can I help you today?"},
-							},
-							"role": "model",
-						},
-						"finishReason": "STOP",
-						"index":        0,
-					},
-				},
-				"usageMetadata": map[string]interface{}{
-					"promptTokenCount":     10,
-					"candidatesTokenCount": 15,
-					"totalTokenCount":      25,
-				},
-			})
-
-		default:
-			// Unknown key
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": map[string]interface{}{
-					"code":    401,
-					"message": "API key not valid",
-					"status":  "UNAUTHENTICATED",
-				},
-			})
-		}
+// NewMockProviderServer creates an httptest server that simulates a Gemini API provider.
+// It answers every key with HTTP 200 and valid Gemini JSON; failures are
+// injected in front of it by chaosWrapper.
+func NewMockProviderServer() *httptest.Server {
+	return httptest.NewServer(testutil.NewConfigurableMockProvider(testutil.MockBehavior{
+		ResponseBody: testutil.GeminiResponseBody("Hello! I'm a mock AI assistant. How can I help you today?"),
 	}))
 }
 
+// mockKeyChaos is the failure injected for each test key:
+// - "KEY_FAIL" -> 429 (Too Many Requests)
+// - "KEY_ERROR" -> 503 (Service Unavailable)
+// Other keys, such as "KEY_SUCCESS", reach the mock provider.
+var mockKeyChaos = map[string]adapter.ChaosConfig{
+	"KEY_FAIL":  {FailureRate: 1.0, ErrorType: adapter.ChaosErrorRateLimit},
+	"KEY_ERROR": {FailureRate: 1.0, ErrorType: adapter.ChaosErrorServerError},
+}
+
+// chaosWrapper wraps the adapter of every attempt in a ChaosAdapter failing
+// as mockKeyChaos sets for its key, and counts the attempts in calls.
+func chaosWrapper(calls *int32) func(key string, p adapter.AIProvider) adapter.AIProvider {
+	return func(key string, p adapter.AIProvider) adapter.AIProvider {
+		atomic.AddInt32(calls, 1)
+		return adapter.NewChaosAdapter(p, mockKeyChaos[key])
+	}
+}
+
 // TestRouterE2E contains all end-to-end test scenarios
 func TestRouterE2E(t *testing.T) {
 	tests := []struct {
@@ -155,8 +104,8 @@ func TestRouterE2E(t *testing.T) {
 		{
 			name:           "Case C: Exhaustion - All Keys Fail",
 			keys:           []string{"KEY_FAIL", "KEY_ERROR"},
-			expectedStatus: http.StatusBadGateway, // Router returns 502 when all keys exhausted
-			expectedCalls:  2,                      // Both keys should be tried
+			expectedStatus: http.StatusServiceUnavailable, // Router returns 503 when all keys exhausted
+			expectedCalls:  2,                             // Both keys should be tried
 			concurrency:    1,
 			validateResponse: func(t *testing.T, resp map[string]interface{}) {
 				// Should return OpenAI-compatible error
@@ -189,7 +138,7 @@ func TestRouterE2E(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Setup mock provider server
 			var requestCounter int32
-			mockServer := NewMockProviderServer(&requestCounter)
+			mockServer := NewMockProviderServer()
 			defer mockServer.Close()
 
 			// Create KeyManager with test keys
@@ -200,7 +149,12 @@ func TestRouterE2E(t *testing.T) {
 				keyManager,
 				nil,
 				handler.WithMaxRetries(len(tt.keys)), // Retry count matches key count
+				handler.WithBaseURL(mockServer.URL),
+				handler.WithAdapterWrapper(chaosWrapper(&requestCounter)),
 			)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/v1/chat/completions", proxyHandler.HandleChatCompletion)
 
 			// Create test request
 			reqBody := adapter.OpenAIRequest{
@@ -217,8 +171,7 @@ func TestRouterE2E(t *testing.T) {
 				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(bodyBytes))
 				req.Header.Set("Content-Type", "application/json")
 
-				// Create custom adapter with mock server URL
-				executeRequestWithMockAdapter(t, proxyHandler, keyManager, mockServer.URL, req, w)
+				router.ServeHTTP(w, req)
 
 				// Verify status code
 				if w.Code != tt.expectedStatus {
@@ -251,7 +204,7 @@ func TestRouterE2E(t *testing.T) {
 						req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(bodyBytes))
 						req.Header.Set("Content-Type", "application/json")
 
-						executeRequestWithMockAdapter(t, proxyHandler, keyManager, mockServer.URL, req, w)
+						router.ServeHTTP(w, req)
 
 						if w.Code == http.StatusOK {
 							atomic.AddInt32(&successCount, 1)
@@ -280,95 +233,6 @@ func TestRouterE2E(t *testing.T) {
 	}
 }
 
-// executeRequestWithMockAdapter creates a custom GeminiAdapter pointing to the mock server
-// and executes the request through the proxy handler logic.
-func executeRequestWithMockAdapter(
-	t *testing.T,
-	proxyHandler *handler.ProxyHandler,
-	keyManager *domain.KeyManager,
-	mockBaseURL string,
-	req *http.Request,
-	w *httptest.ResponseRecorder,
-) {
-	// Parse request body
-	var openAIReq adapter.OpenAIRequest
-	if err := json.NewDecoder(req.Body).Decode(&openAIReq); err != nil {
-		t.Fatalf("Failed to decode request: %v", err)
-	}
-
-	// Execute retry logic manually (simulating ProxyHandler.executeWithRetry)
-	maxRetries := 3
-	var lastErr error
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// Get next key
-		key, err := keyManager.GetNextKey()
-		if err != nil {
-			// No keys available
-			w.WriteHeader(http.StatusBadGateway)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": map[string]interface{}{
-					"message": "No API keys available",
-					"type":    "server_error",
-				},
-			})
-			return
-		}
-
-		// Create adapter with mock base URL
-		geminiAdapter := adapter.NewGeminiAdapter(
-			key,
-			adapter.WithBaseURL(mockBaseURL),
-		)
-
-		// Execute request
-		resp, err := geminiAdapter.ChatCompletion(req.Context(), openAIReq)
-		if err == nil {
-			// Success!
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(resp)
-			return
-		}
-
-		// Check if error is retryable
-		errStr := err.Error()
-		isRetryable := strings.Contains(errStr, "429") ||
-			strings.Contains(errStr, "500") ||
-			strings.Contains(errStr, "502") ||
-			strings.Contains(errStr, "503")
-
-		if isRetryable {
-			// Mark key as dead and retry
-			keyManager.MarkAsDead(key)
-			lastErr = err
-			continue
-		}
-
-		// Non-retryable error
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": map[string]interface{}{
-				"message": err.Error(),
-				"type":    "invalid_request_error",
-			},
-		})
-		return
-	}
-
-	// All retries exhausted
-	w.WriteHeader(http.StatusServiceUnavailable)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error": map[string]interface{}{
-			"message": "Service temporarily unavailable. Please try again later.",
-			"type":    "server_error",
-		},
-	})
-
-	if lastErr != nil {
-		t.Logf("All retries exhausted, last error: %v", lastErr)
-	}
-}
-
 // TestKeyManagerConcurrency stress-tests KeyManager for thread safety
 func TestKeyManagerConcurrency(t *testing.T) {
 	keys := []string{"KEY_1", "KEY_2", "KEY_3", "KEY_4", "KEY_5"}
@@ -450,7 +314,7 @@ func TestHealthEndpoint(t *testing.T) {
 	}
 
 	// Mark one key as dead
-	keyManager.MarkAsDead("KEY_1")
+	keyManager.MarkAsDead("KEY_1", "")
 
 	activeKeys = keyManager.ActiveKeyCount()
 	deadKeys = keyManager.DeadKeyCount()
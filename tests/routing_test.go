@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hpn/hpn-g-router/internal/adapter"
+	"github.com/hpn/hpn-g-router/internal/domain"
+	"github.com/hpn/hpn-g-router/internal/handler"
+)
+
+// newRoutingServer serves the proxy routes the way the production server
+// does: behind CanonicalPathHandler, redirecting trailing slashes and
+// answering unknown routes with OpenAI errors.
+func newRoutingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(&mockGemini{})
+	t.Cleanup(upstream.Close)
+
+	km := domain.NewKeyManager([]string{"AIzaSyRoutingKey000000000"}, time.Minute)
+	h := handler.NewProxyHandler(km, nil,
+		handler.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		handler.WithAdapterOptions(adapter.WithBaseURL(upstream.URL)),
+	)
+
+	r := gin.New()
+	r.RedirectTrailingSlash = true
+	r.NoRoute(handler.NotFoundHandler())
+	r.POST("/v1/chat/completions", h.HandleChatCompletion)
+	r.POST("/v1/chat/completions/batch", h.HandleBatchCompletion)
+	r.GET("/v1/models", h.HandleModels)
+
+	srv := httptest.NewServer(handler.CanonicalPathHandler(r))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// noRedirect is a client that returns redirects instead of following them.
+var noRedirect = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func TestRouting_TrailingSlashRedirect(t *testing.T) {
+	srv := newRoutingServer(t)
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantLocation string
+	}{
+		{http.MethodGet, "/v1/models/", http.StatusMovedPermanently, "/v1/models"},
+		{http.MethodGet, "/v1/models/?limit=5&after=x", http.StatusMovedPermanently, "/v1/models?limit=5&after=x"},
+		{http.MethodPost, "/v1/chat/completions/", http.StatusTemporaryRedirect, "/v1/chat/completions"},
+		{http.MethodPost, "/v1/chat/completions/?stream=false", http.StatusTemporaryRedirect, "/v1/chat/completions?stream=false"},
+		{http.MethodPost, "//v1//chat/completions/", http.StatusTemporaryRedirect, "/v1/chat/completions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := noRedirect.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestRouting_CanonicalPath(t *testing.T) {
+	srv := newRoutingServer(t)
+	body := `{"model":"gemini-2.0-flash","messages":[{"role":"user","content":"hi"}]}`
+
+	for _, path := range []string{"//v1//chat/completions", "/v1/chat/./completions", "/v1/%63hat/completions"} {
+		t.Run(path, func(t *testing.T) {
+			resp, err := noRedirect.Post(srv.URL+path, "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				b, _ := io.ReadAll(resp.Body)
+				t.Fatalf("status = %d, want 200: %s", resp.StatusCode, b)
+			}
+		})
+	}
+}
+
+func TestRouting_WrongCaseNotFound(t *testing.T) {
+	srv := newRoutingServer(t)
+
+	resp, err := noRedirect.Post(srv.URL+"/V1/Chat/Completions", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want JSON", ct)
+	}
+	var got adapter.OpenAIError
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Error.Type != "invalid_request_error" || !strings.Contains(got.Error.Message, "/V1/Chat/Completions") {
+		t.Errorf("error = %+v, want an invalid_request_error naming the path", got.Error)
+	}
+}